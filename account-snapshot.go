@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"k8s.io/klog/v2"
+)
+
+// An account snapshot CAR has the state of the accounts at an epoch boundary, alongside the
+// transaction history of the epoch CARs. It's a CARv1 of raw (codec 0x55, sha256) nodes: its root,
+// and first node, is the header of the snapshot (the magic, then the epoch and the slot of the
+// snapshot, as little-endian uint64s), and each of the other nodes is the record of an account:
+//
+//	pubkey (32) | lamports (u64) | owner (32) | executable (u8) | rent epoch (u64) | data
+//
+// The accounts are looked up with a pubkey-to-account index of the CAR.
+
+const accountSnapshotMagic = "accsnap1"
+
+const accountSnapshotHeaderSize = len(accountSnapshotMagic) + 8 + 8
+
+type accountSnapshotHeader struct {
+	Epoch uint64
+	// Slot is the slot of the snapshot: the state of the accounts is the one after this slot.
+	Slot uint64
+}
+
+func (h accountSnapshotHeader) bytes() []byte {
+	buf := make([]byte, 0, accountSnapshotHeaderSize)
+	buf = append(buf, accountSnapshotMagic...)
+	buf = binary.LittleEndian.AppendUint64(buf, h.Epoch)
+	buf = binary.LittleEndian.AppendUint64(buf, h.Slot)
+	return buf
+}
+
+func parseAccountSnapshotHeader(data []byte) (accountSnapshotHeader, error) {
+	if len(data) != accountSnapshotHeaderSize || string(data[:len(accountSnapshotMagic)]) != accountSnapshotMagic {
+		return accountSnapshotHeader{}, fmt.Errorf("not an account snapshot header")
+	}
+	data = data[len(accountSnapshotMagic):]
+	return accountSnapshotHeader{
+		Epoch: binary.LittleEndian.Uint64(data[:8]),
+		Slot:  binary.LittleEndian.Uint64(data[8:]),
+	}, nil
+}
+
+// AccountRecord is the state of an account in an account snapshot.
+type AccountRecord struct {
+	Pubkey     solana.PublicKey
+	Lamports   uint64
+	Owner      solana.PublicKey
+	Executable bool
+	RentEpoch  uint64
+	Data       []byte
+}
+
+const accountRecordHeaderSize = 32 + 8 + 32 + 1 + 8
+
+func (a *AccountRecord) bytes() []byte {
+	buf := make([]byte, 0, accountRecordHeaderSize+len(a.Data))
+	buf = append(buf, a.Pubkey[:]...)
+	buf = binary.LittleEndian.AppendUint64(buf, a.Lamports)
+	buf = append(buf, a.Owner[:]...)
+	if a.Executable {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, a.RentEpoch)
+	return append(buf, a.Data...)
+}
+
+func parseAccountRecord(data []byte) (*AccountRecord, error) {
+	if len(data) < accountRecordHeaderSize {
+		return nil, fmt.Errorf("account record too short: %d bytes", len(data))
+	}
+	record := &AccountRecord{}
+	copy(record.Pubkey[:], data[:32])
+	record.Lamports = binary.LittleEndian.Uint64(data[32:40])
+	copy(record.Owner[:], data[40:72])
+	switch data[72] {
+	case 0:
+	case 1:
+		record.Executable = true
+	default:
+		return nil, fmt.Errorf("invalid executable flag %d", data[72])
+	}
+	record.RentEpoch = binary.LittleEndian.Uint64(data[73:81])
+	record.Data = data[accountRecordHeaderSize:]
+	return record, nil
+}
+
+func rawNodeCid(data []byte) (cid.Cid, error) {
+	return cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum(data)
+}
+
+// accountSnapshotCarWriter writes an account snapshot CAR.
+type accountSnapshotCarWriter struct {
+	w           io.Writer
+	rootCid     cid.Cid
+	numAccounts uint64
+}
+
+func newAccountSnapshotCarWriter(w io.Writer, header accountSnapshotHeader) (*accountSnapshotCarWriter, error) {
+	headerNode := header.bytes()
+	rootCid, err := rawNodeCid(headerNode)
+	if err != nil {
+		return nil, err
+	}
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{rootCid}, Version: 1}, w); err != nil {
+		return nil, fmt.Errorf("failed to write car header: %w", err)
+	}
+	if err := util.LdWrite(w, rootCid.Bytes(), headerNode); err != nil {
+		return nil, fmt.Errorf("failed to write the snapshot header: %w", err)
+	}
+	return &accountSnapshotCarWriter{w: w, rootCid: rootCid}, nil
+}
+
+func (w *accountSnapshotCarWriter) add(record *AccountRecord) error {
+	data := record.bytes()
+	c, err := rawNodeCid(data)
+	if err != nil {
+		return err
+	}
+	if err := util.LdWrite(w.w, c.Bytes(), data); err != nil {
+		return fmt.Errorf("failed to write account %s: %w", record.Pubkey, err)
+	}
+	w.numAccounts++
+	return nil
+}
+
+// CreateIndex_accountSnapshot creates the pubkey-to-account index of an account snapshot CAR.
+func CreateIndex_accountSnapshot(
+	ctx context.Context,
+	network indexes.Network,
+	tmpDir string,
+	carPath string,
+	indexDir string,
+) (_ string, retErr error) {
+	numNodes, err := carCountItems(carPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to count the nodes of the car: %w", err)
+	}
+	if numNodes < 2 {
+		return "", fmt.Errorf("the car has no accounts")
+	}
+	file, err := openCarFile(carPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	rd, err := newCarReader(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open car file: %w", err)
+	}
+	if len(rd.header.Roots) != 1 {
+		return "", fmt.Errorf("an account snapshot car must have 1 root, got %d", len(rd.header.Roots))
+	}
+	rootCid := rd.header.Roots[0]
+	var offset uint64
+	{
+		var buf bytes.Buffer
+		if err = carv1.WriteHeader(rd.header, &buf); err != nil {
+			return "", err
+		}
+		offset = uint64(buf.Len())
+	}
+	c, sectionLen, data, err := readNodeInfoWithData(rd.br)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the snapshot header: %w", err)
+	}
+	header, err := parseAccountSnapshotHeader(data)
+	if err != nil || !c.Equals(rootCid) {
+		return "", fmt.Errorf("the first node of the car must be the snapshot header, its root")
+	}
+	offset += sectionLen
+
+	tmpDir = filepath.Join(tmpDir, "index-pubkey-to-account-"+time.Now().Format("20060102-150405.000000000")+fmt.Sprintf("-%d", rand.Int63()))
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create pubkey_to_account tmp dir: %w", err)
+	}
+	index, err := indexes.NewWriter_PubkeyToAccount(header.Epoch, rootCid, network, header.Slot, tmpDir, numNodes-1)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pubkey_to_account index: %w", err)
+	}
+	defer index.Close()
+
+	klog.Infof("Indexing the accounts of the snapshot of epoch %d (slot %d)...", header.Epoch, header.Slot)
+	task := progress.Start("index account-snapshot")
+	task.SetTotal(numNodes-1, 0)
+	defer func() { task.Done(retErr) }()
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		_, sectionLen, data, err := readNodeInfoWithData(rd.br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		record, err := parseAccountRecord(data)
+		if err != nil {
+			return "", fmt.Errorf("invalid account record at offset %d: %w", offset, err)
+		}
+		// the record is at the end of the section.
+		if err := index.Put(record.Pubkey, offset+sectionLen-uint64(len(data)), uint64(len(data))); err != nil {
+			return "", fmt.Errorf("failed to index account %s: %w", record.Pubkey, err)
+		}
+		offset += sectionLen
+		task.Add(1, 0)
+	}
+
+	klog.Infof("Sealing index...")
+	if err := index.Seal(ctx, indexDir); err != nil {
+		return "", fmt.Errorf("failed to seal index: %w", err)
+	}
+	klog.Infof("Index created at %s", index.GetFilepath())
+	return index.GetFilepath(), nil
+}
+
+// AccountSnapshot reads the accounts of an account snapshot CAR, with its pubkey-to-account index.
+type AccountSnapshot struct {
+	car   ReaderAtCloser
+	index *indexes.PubkeyToAccount_Reader
+}
+
+// Slot returns the slot of the snapshot.
+func (s *AccountSnapshot) Slot() uint64 {
+	return s.index.SnapshotSlot()
+}
+
+// GetAccount returns the state of the account in the snapshot; compactindexsized.ErrNotFound if
+// the account is not in the snapshot (it had no lamports).
+func (s *AccountSnapshot) GetAccount(pubkey solana.PublicKey) (*AccountRecord, error) {
+	oas, err := s.index.Get(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readSectionFromReaderAt(s.car, oas.Offset, oas.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the record of account %s: %w", pubkey, err)
+	}
+	record, err := parseAccountRecord(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record of account %s: %w", pubkey, err)
+	}
+	if record.Pubkey != pubkey {
+		return nil, fmt.Errorf("the record of account %s is the one of %s", pubkey, record.Pubkey)
+	}
+	return record, nil
+}
+
+// openAccountSnapshot opens the account snapshot of the epoch config, if any.
+func (e *Epoch) openAccountSnapshot(ctx context.Context, config *Config) error {
+	if config.AccountSnapshot.Car.URI.IsZero() {
+		return nil
+	}
+	indexFile, err := e.mountIndex(ctx, "account_snapshot", config.AccountSnapshot.Index.URI)
+	if err != nil {
+		return fmt.Errorf("failed to open the account snapshot index file: %w", err)
+	}
+	index, err := indexes.OpenWithReader_PubkeyToAccount(indexFile)
+	if err != nil {
+		return fmt.Errorf("failed to open the account snapshot index: %w", err)
+	}
+	if index.Meta().Epoch != e.Epoch() {
+		return fmt.Errorf("epoch mismatch in the account snapshot index: expected %d, got %d", e.Epoch(), index.Meta().Epoch)
+	}
+	car, err := openIndexStorage(ctx, config.AccountSnapshot.Car.URI.String())
+	if err != nil {
+		return fmt.Errorf("failed to open the account snapshot car: %w", err)
+	}
+	e.onClose = append(e.onClose, car.Close)
+	e.accountSnapshot = &AccountSnapshot{
+		car:   car,
+		index: index,
+	}
+	return nil
+}
+
+// GetAccountSnapshot returns the account snapshot of the epoch, or nil if it has none.
+func (e *Epoch) GetAccountSnapshot() *AccountSnapshot {
+	return e.accountSnapshot
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountRecordRoundTrip(t *testing.T) {
+	record := &AccountRecord{
+		Pubkey:     solana.PublicKey{1},
+		Lamports:   1_000_000,
+		Owner:      solana.SystemProgramID,
+		Executable: true,
+		RentEpoch:  361,
+		Data:       []byte{0xde, 0xad},
+	}
+	parsed, err := parseAccountRecord(record.bytes())
+	require.NoError(t, err)
+	require.Equal(t, record, parsed)
+
+	_, err = parseAccountRecord(record.bytes()[:accountRecordHeaderSize-1])
+	require.Error(t, err)
+
+	header := accountSnapshotHeader{Epoch: 500, Slot: 215_999_999}
+	parsedHeader, err := parseAccountSnapshotHeader(header.bytes())
+	require.NoError(t, err)
+	require.Equal(t, header, parsedHeader)
+	_, err = parseAccountSnapshotHeader(record.bytes())
+	require.Error(t, err)
+}
+
+func TestAccountSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	carPath := filepath.Join(dir, "accounts.car")
+
+	var buf bytes.Buffer
+	writer, err := newAccountSnapshotCarWriter(&buf, accountSnapshotHeader{Epoch: 500, Slot: 215_999_999})
+	require.NoError(t, err)
+	accounts := []*AccountRecord{
+		{Pubkey: solana.PublicKey{1}, Lamports: 10, Owner: solana.SystemProgramID, RentEpoch: 1, Data: []byte{}},
+		{Pubkey: solana.PublicKey{2}, Lamports: 20, Owner: solana.TokenProgramID, Data: bytes.Repeat([]byte{7}, 165)},
+		{Pubkey: solana.PublicKey{3}, Lamports: 30, Owner: solana.BPFLoaderUpgradeableProgramID, Executable: true, Data: []byte{2, 0, 0, 0}},
+	}
+	for _, account := range accounts {
+		require.NoError(t, writer.add(account))
+	}
+	require.Equal(t, uint64(3), writer.numAccounts)
+	require.NoError(t, os.WriteFile(carPath, buf.Bytes(), 0o644))
+
+	indexPath, err := CreateIndex_accountSnapshot(context.TODO(), indexes.NetworkMainnet, dir, carPath, dir)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(indexPath, "-mainnet-pubkey-to-account.index"))
+
+	index, err := indexes.Open_PubkeyToAccount(indexPath)
+	require.NoError(t, err)
+	require.Equal(t, uint64(500), index.Meta().Epoch)
+	require.Equal(t, writer.rootCid, index.Meta().RootCid)
+	car, err := os.Open(carPath)
+	require.NoError(t, err)
+	snapshot := &AccountSnapshot{car: car, index: index}
+	defer car.Close()
+	defer index.Close()
+	require.Equal(t, uint64(215_999_999), snapshot.Slot())
+
+	for _, account := range accounts {
+		got, err := snapshot.GetAccount(account.Pubkey)
+		require.NoError(t, err)
+		require.Equal(t, account, got)
+	}
+	_, err = snapshot.GetAccount(solana.PublicKey{4})
+	require.ErrorIs(t, err, compactindexsized.ErrNotFound)
+
+	value := accountAtEpochBoundary(accounts[2])
+	require.Equal(t, [2]string{"AgAAAA==", "base64"}, value.Data)
+	require.Equal(t, uint64(4), value.Space)
+	require.True(t, value.Executable)
+}
+
+func TestParseGetAccountAtEpochBoundaryRequest(t *testing.T) {
+	parse := func(params string) (*GetAccountAtEpochBoundaryRequest, error) {
+		raw := json.RawMessage(params)
+		return parseGetAccountAtEpochBoundaryRequest(&raw)
+	}
+	pubkey := solana.SystemProgramID.String()
+	params, err := parse(`["` + pubkey + `", 500]`)
+	require.NoError(t, err)
+	require.Equal(t, solana.SystemProgramID, params.Pubkey)
+	require.Equal(t, uint64(500), params.Epoch)
+
+	_, err = parse(`["` + pubkey + `", 500, {"encoding": "base64"}]`)
+	require.NoError(t, err)
+	_, err = parse(`["` + pubkey + `", 500, {"encoding": "jsonParsed"}]`)
+	require.Error(t, err)
+	_, err = parse(`["` + pubkey + `"]`)
+	require.Error(t, err)
+	_, err = parse(`["not a pubkey", 500]`)
+	require.Error(t, err)
+}
@@ -79,68 +79,8 @@ func adaptTransactionMetaToExpectedOutput(m map[string]any) map[string]any {
 			}
 			// remove loadedReadonlyAddresses and loadedWritableAddresses
 		}
-		if preTokenBalances, ok := meta["preTokenBalances"]; !ok {
-			meta["preTokenBalances"] = []any{}
-		} else {
-			// in preTokenBalances.[].uiTokenAmount.decimals if not present, set to 0
-			preTokenBalances, ok := preTokenBalances.([]any)
-			if ok {
-				for _, preTokenBalanceAny := range preTokenBalances {
-					preTokenBalance, ok := preTokenBalanceAny.(map[string]any)
-					if ok {
-						uiTokenAmountAny, ok := preTokenBalance["uiTokenAmount"]
-						if ok {
-							uiTokenAmount, ok := uiTokenAmountAny.(map[string]any)
-							if ok {
-								_, ok := uiTokenAmount["decimals"]
-								if !ok {
-									uiTokenAmount["decimals"] = 0
-								}
-								_, ok = uiTokenAmount["uiAmount"]
-								if !ok {
-									uiTokenAmount["uiAmount"] = nil
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-		if postTokenBalances, ok := meta["postTokenBalances"]; !ok {
-			meta["postTokenBalances"] = []any{}
-		} else {
-			// in postTokenBalances.[].uiTokenAmount.decimals if not present, set to 0
-			postTokenBalances, ok := postTokenBalances.([]any)
-			if ok {
-				for _, postTokenBalanceAny := range postTokenBalances {
-					postTokenBalance, ok := postTokenBalanceAny.(map[string]any)
-					if ok {
-						uiTokenAmountAny, ok := postTokenBalance["uiTokenAmount"]
-						if ok {
-							uiTokenAmount, ok := uiTokenAmountAny.(map[string]any)
-							if ok {
-								_, ok := uiTokenAmount["decimals"]
-								if !ok {
-									uiTokenAmount["decimals"] = 0
-								}
-								_, ok = uiTokenAmount["uiAmount"]
-								if !ok {
-									uiTokenAmount["uiAmount"] = nil
-								}
-								_, ok = uiTokenAmount["amount"]
-								if !ok {
-									uiTokenAmount["amount"] = "0"
-								}
-								_, ok = uiTokenAmount["uiAmountString"]
-								if !ok {
-									uiTokenAmount["uiAmountString"] = "0"
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+		meta["preTokenBalances"] = adaptTokenBalances(meta["preTokenBalances"])
+		meta["postTokenBalances"] = adaptTokenBalances(meta["postTokenBalances"])
 
 		delete(meta, "returnDataNone")
 
@@ -221,6 +161,10 @@ func adaptTransactionMetaToExpectedOutput(m map[string]any) map[string]any {
 				if !ok {
 					continue
 				}
+				// the stack height is only in the recent metas.
+				if _, ok := instruction["stackHeight"]; !ok {
+					instruction["stackHeight"] = nil
+				}
 				{
 					if accounts, ok := instruction["accounts"]; ok {
 						// as string
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ApiVersion is the behavior of the handlers of the standard (non-faithful_) methods.
+type ApiVersion string
+
+const (
+	// ApiVersionLegacy (v0) is the historical output of the server, with the faithful extensions
+	// of the standard methods (e.g. the leader of getBlock, the instructionLogs of jsonParsed).
+	ApiVersionLegacy ApiVersion = "v0"
+	// ApiVersionStrict (v1) matches the output of the mainnet RPC: the faithful extensions of the
+	// standard methods are left out, and their faithful options are ignored. The faithful_ methods
+	// are the same in both versions.
+	ApiVersionStrict ApiVersion = "v1"
+)
+
+func ParseApiVersion(s string) (ApiVersion, error) {
+	switch version := ApiVersion(strings.TrimSpace(s)); version {
+	case ApiVersionLegacy, ApiVersionStrict:
+		return version, nil
+	case "":
+		return ApiVersionLegacy, nil
+	default:
+		return "", fmt.Errorf("unknown API version %q (supported: v0, v1)", s)
+	}
+}
+
+// apiVersionHeader is the request header with which a client selects the API version
+// (e.g. "X-Faithful-Api-Version: v1"); the response has the version that was used.
+const apiVersionHeader = "X-Faithful-Api-Version"
+
+// requestApiVersion returns the API version of the request: the one of its path (POST /v0 or
+// POST /v1), else the one of its header, else the server default.
+func requestApiVersion(reqCtx *fasthttp.RequestCtx, serverDefault ApiVersion) ApiVersion {
+	if version, ok := apiVersionFromPath(string(reqCtx.Path())); ok {
+		return version
+	}
+	if value := strings.TrimSpace(string(reqCtx.Request.Header.Peek(apiVersionHeader))); value != "" {
+		if version, err := ParseApiVersion(value); err == nil {
+			return version
+		}
+	}
+	if serverDefault == "" {
+		return ApiVersionLegacy
+	}
+	return serverDefault
+}
+
+// apiVersionFromPath returns the API version of a versioned route (/v0 or /v1).
+func apiVersionFromPath(path string) (ApiVersion, bool) {
+	switch ApiVersion(strings.Trim(path, "/")) {
+	case ApiVersionLegacy:
+		return ApiVersionLegacy, true
+	case ApiVersionStrict:
+		return ApiVersionStrict, true
+	default:
+		return "", false
+	}
+}
+
+// apiVersion returns the API version of the request.
+func (multi *MultiEpoch) apiVersion(reqCtx *fasthttp.RequestCtx) ApiVersion {
+	var serverDefault ApiVersion
+	if multi.options != nil {
+		serverDefault = multi.options.ApiVersion
+	}
+	return requestApiVersion(reqCtx, serverDefault)
+}
+
+// strict returns true if the request is served with the strict API version (see ApiVersionStrict).
+func (c *requestContext) strict() bool {
+	return c.apiVersion == ApiVersionStrict
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseApiVersion(t *testing.T) {
+	version, err := ParseApiVersion("")
+	require.NoError(t, err)
+	require.Equal(t, ApiVersionLegacy, version)
+	version, err = ParseApiVersion("v1")
+	require.NoError(t, err)
+	require.Equal(t, ApiVersionStrict, version)
+	_, err = ParseApiVersion("v2")
+	require.Error(t, err)
+}
+
+func TestRequestApiVersion(t *testing.T) {
+	var reqCtx fasthttp.RequestCtx
+	reqCtx.Request.SetRequestURI("/")
+	require.Equal(t, ApiVersionLegacy, requestApiVersion(&reqCtx, ""))
+	require.Equal(t, ApiVersionStrict, requestApiVersion(&reqCtx, ApiVersionStrict))
+
+	// the header overrides the server default; an invalid one is ignored.
+	reqCtx.Request.Header.Set(apiVersionHeader, "v1")
+	require.Equal(t, ApiVersionStrict, requestApiVersion(&reqCtx, ApiVersionLegacy))
+	reqCtx.Request.Header.Set(apiVersionHeader, "v9")
+	require.Equal(t, ApiVersionLegacy, requestApiVersion(&reqCtx, ApiVersionLegacy))
+
+	// the route overrides the header.
+	reqCtx.Request.Header.Set(apiVersionHeader, "v1")
+	reqCtx.Request.SetRequestURI("/v0/")
+	require.Equal(t, ApiVersionLegacy, requestApiVersion(&reqCtx, ApiVersionStrict))
+	reqCtx.Request.SetRequestURI("/v1")
+	reqCtx.Request.Header.Del(apiVersionHeader)
+	require.Equal(t, ApiVersionStrict, requestApiVersion(&reqCtx, ApiVersionLegacy))
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryanuber/go-glob"
+	"k8s.io/klog/v2"
+)
+
+// ArtifactCacheConfig is the retention policy of the managed cache directory, where the remote
+// files of the epochs are downloaded (e.g. the index files in download mode), so that a
+// long-running server doesn't slowly fill the disk.
+type ArtifactCacheConfig struct {
+	// Dir is the managed cache directory.
+	Dir string
+	// MaxBytes (optional) is the largest total size of the files of the directory; beyond it,
+	// the least recently used files are removed.
+	MaxBytes uint64
+	// MaxIdle (optional) removes the files that were not used for that long.
+	MaxIdle time.Duration
+	// Pins are glob patterns (on the paths relative to Dir, or the file names) of the files that are never removed.
+	Pins []string
+	// Interval is the time between two garbage collections.
+	Interval time.Duration
+}
+
+// CachedArtifact is a file of the managed cache directory.
+type CachedArtifact struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"lastAccess"`
+	Pinned     bool      `json:"pinned"`
+	// InUse is true if a loaded epoch has the file open; such a file is never removed.
+	InUse bool `json:"inUse"`
+}
+
+// ArtifactCacheGCResult is the outcome of a garbage collection of the managed cache directory.
+type ArtifactCacheGCResult struct {
+	StartedAt    time.Time `json:"startedAt"`
+	Took         string    `json:"took"`
+	Files        int       `json:"files"`
+	Bytes        uint64    `json:"bytes"`
+	Evicted      []string  `json:"evicted"`
+	EvictedBytes uint64    `json:"evictedBytes"`
+	Errors       []string  `json:"errors,omitempty"`
+}
+
+// ArtifactCacheStatus describes the managed cache directory, for the admin API.
+type ArtifactCacheStatus struct {
+	Dir      string                 `json:"dir"`
+	MaxBytes uint64                 `json:"maxBytes"`
+	MaxIdle  string                 `json:"maxIdle"`
+	Pins     []string               `json:"pins"`
+	Files    []CachedArtifact       `json:"files"`
+	Bytes    uint64                 `json:"bytes"`
+	LastGC   *ArtifactCacheGCResult `json:"lastGC"`
+}
+
+// artifactCache garbage-collects the managed cache directory according to its retention policy.
+type artifactCache struct {
+	conf ArtifactCacheConfig
+	// inUse returns the paths of the files that the loaded epochs have open.
+	inUse func() map[string]bool
+	now   func() time.Time
+
+	mu     sync.Mutex // serializes the garbage collections, and guards the fields below.
+	pins   []string
+	lastGC *ArtifactCacheGCResult
+}
+
+func newArtifactCache(conf ArtifactCacheConfig, inUse func() map[string]bool) *artifactCache {
+	return &artifactCache{
+		conf:  conf,
+		inUse: inUse,
+		now:   time.Now,
+		pins:  append([]string(nil), conf.Pins...),
+	}
+}
+
+// Run garbage-collects the directory every interval, until the context is done.
+func (c *artifactCache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Collect()
+		}
+	}
+}
+
+// Pin adds a pattern to the pin list (the files matching it are never removed).
+func (c *artifactCache) Pin(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pin := range c.pins {
+		if pin == pattern {
+			return
+		}
+	}
+	c.pins = append(c.pins, pattern)
+}
+
+// Unpin removes a pattern from the pin list, and returns false if it was not there.
+func (c *artifactCache) Unpin(pattern string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pin := range c.pins {
+		if pin == pattern {
+			c.pins = append(c.pins[:i], c.pins[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isPinnedLocked returns true if the file (relative to the directory) matches a pattern of the pin list.
+func (c *artifactCache) isPinnedLocked(rel string) bool {
+	for _, pin := range c.pins {
+		if glob.Glob(pin, rel) || glob.Glob(pin, filepath.Base(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanLocked returns the files of the directory, least recently used first.
+func (c *artifactCache) scanLocked() ([]CachedArtifact, error) {
+	inUse := c.inUse()
+	var files []CachedArtifact
+	err := filepath.WalkDir(c.conf.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.conf.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// skip the directories, and the downloads in progress.
+		if !entry.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.conf.Dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, CachedArtifact{
+			Path:       path,
+			Size:       info.Size(),
+			LastAccess: fileAccessTime(info),
+			Pinned:     c.isPinnedLocked(rel),
+			InUse:      inUse[absPath(path)],
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].LastAccess.Before(files[j].LastAccess) })
+	return files, err
+}
+
+// Collect removes the files that are idle for too long, then the least recently used ones
+// while the directory is too large; the pinned files and the ones in use are kept.
+func (c *artifactCache) Collect() *ArtifactCacheGCResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	startedAt := c.now()
+	result := &ArtifactCacheGCResult{
+		StartedAt: startedAt.UTC(),
+		Evicted:   make([]string, 0),
+	}
+	files, err := c.scanLocked()
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	var total uint64
+	for _, file := range files {
+		total += uint64(file.Size)
+	}
+	for _, file := range files {
+		if file.Pinned || file.InUse {
+			continue
+		}
+		idle := c.conf.MaxIdle > 0 && startedAt.Sub(file.LastAccess) > c.conf.MaxIdle
+		oversize := c.conf.MaxBytes > 0 && total > c.conf.MaxBytes
+		if !idle && !oversize {
+			continue
+		}
+		if err := os.Remove(file.Path); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		total -= uint64(file.Size)
+		result.Evicted = append(result.Evicted, file.Path)
+		result.EvictedBytes += uint64(file.Size)
+		metrics_artifactCacheEvictions.Inc()
+		metrics_artifactCacheEvictedBytes.Add(float64(file.Size))
+		klog.Infof("Artifact cache: removed %q (%d bytes, last used %s)", file.Path, file.Size, file.LastAccess.Format(time.RFC3339))
+	}
+	if c.conf.MaxBytes > 0 && total > c.conf.MaxBytes {
+		klog.Warningf("Artifact cache: %q is %d bytes, over its limit of %d, but the remaining files are pinned or in use", c.conf.Dir, total, c.conf.MaxBytes)
+	}
+	result.Files = len(files) - len(result.Evicted)
+	result.Bytes = total
+	result.Took = c.now().Sub(startedAt).String()
+	metrics_artifactCacheBytes.Set(float64(total))
+	metrics_artifactCacheFiles.Set(float64(result.Files))
+	c.lastGC = result
+	return result
+}
+
+// Status returns the files of the directory and the outcome of the last garbage collection.
+func (c *artifactCache) Status() (*ArtifactCacheStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	files, err := c.scanLocked()
+	if err != nil {
+		return nil, err
+	}
+	status := &ArtifactCacheStatus{
+		Dir:      c.conf.Dir,
+		MaxBytes: c.conf.MaxBytes,
+		MaxIdle:  c.conf.MaxIdle.String(),
+		Pins:     append([]string{}, c.pins...),
+		Files:    files,
+		LastGC:   c.lastGC,
+	}
+	if status.Files == nil {
+		status.Files = make([]CachedArtifact, 0)
+	}
+	for _, file := range files {
+		status.Bytes += uint64(file.Size)
+	}
+	return status, nil
+}
+
+// touchArtifact records that the file was used now (in its access time, which the
+// garbage collection of the managed cache directory is based on), keeping its modification time.
+func touchArtifact(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if err := os.Chtimes(path, time.Now(), info.ModTime()); err != nil {
+		klog.V(3).Infof("failed to update the access time of %q: %v", path, err)
+	}
+}
+
+// downloadedFilesInUse returns the paths of the downloaded index files of the loaded epochs.
+func (m *MultiEpoch) downloadedFilesInUse() map[string]bool {
+	inUse := make(map[string]bool)
+	for _, epochNumber := range m.GetEpochNumbers() {
+		epoch, err := m.getLoadedEpoch(epochNumber)
+		if err != nil {
+			continue
+		}
+		for _, ep := range []*Epoch{epoch, epoch.standby} {
+			if ep == nil {
+				continue
+			}
+			ep.indexMu.RLock()
+			for _, mount := range ep.indexMounts {
+				if mount.Mode() == IndexModeDownload {
+					inUse[absPath(mount.localPath())] = true
+				}
+			}
+			ep.indexMu.RUnlock()
+		}
+	}
+	return inUse
+}
+
+// absPath returns the absolute path of the file (or the path itself, if that fails).
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
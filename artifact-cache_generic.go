@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+func fileAccessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
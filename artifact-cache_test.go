@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactCacheCollect(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, lastAccess time.Time) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+		require.NoError(t, os.Chtimes(path, lastAccess, lastAccess))
+		return path
+	}
+	oldest := write("a-slot-to-cid.index", 100, now.Add(-4*time.Hour))
+	inUse := write("b-slot-to-cid.index", 100, now.Add(-3*time.Hour))
+	pinned := write("epoch-1/c-sig-exists.index", 100, now.Add(-2*time.Hour))
+	older := write("d-sig-to-cid.index", 100, now.Add(-time.Hour))
+	newest := write("e-sig-to-cid.index", 100, now)
+	// a download in progress.
+	write("f-sig-to-cid.index.123.tmp", 100, now.Add(-5*time.Hour))
+
+	cache := newArtifactCache(ArtifactCacheConfig{
+		Dir:      dir,
+		MaxBytes: 300,
+		Pins:     []string{"*-sig-exists.index"},
+	}, func() map[string]bool {
+		return map[string]bool{absPath(inUse): true}
+	})
+
+	result := cache.Collect()
+	require.Empty(t, result.Errors)
+	// the least recently used files go first, but the pinned one and the one in use are kept.
+	require.Equal(t, []string{oldest, older}, result.Evicted)
+	require.Equal(t, uint64(200), result.EvictedBytes)
+	require.Equal(t, uint64(300), result.Bytes)
+	require.Equal(t, 3, result.Files)
+	require.FileExists(t, inUse)
+	require.FileExists(t, pinned)
+	require.FileExists(t, newest)
+
+	status, err := cache.Status()
+	require.NoError(t, err)
+	require.Len(t, status.Files, 3)
+	require.Equal(t, result, status.LastGC)
+
+	// once unpinned, the formerly pinned file is the least recently used one that can go.
+	require.True(t, cache.Unpin("*-sig-exists.index"))
+	require.False(t, cache.Unpin("*-sig-exists.index"))
+	write("g-sig-to-cid.index", 100, now)
+	result = cache.Collect()
+	require.Equal(t, []string{pinned}, result.Evicted)
+	require.FileExists(t, newest)
+}
+
+func TestArtifactCacheMaxIdle(t *testing.T) {
+	dir := t.TempDir()
+	idle := filepath.Join(dir, "idle.index")
+	recent := filepath.Join(dir, "recent.index")
+	require.NoError(t, os.WriteFile(idle, []byte("idle"), 0o644))
+	require.NoError(t, os.WriteFile(recent, []byte("recent"), 0o644))
+	require.NoError(t, os.Chtimes(idle, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)))
+
+	cache := newArtifactCache(ArtifactCacheConfig{
+		Dir:     dir,
+		MaxIdle: 24 * time.Hour,
+	}, func() map[string]bool { return nil })
+	result := cache.Collect()
+	require.Equal(t, []string{idle}, result.Evicted)
+	require.FileExists(t, recent)
+
+	// a missing directory is empty.
+	cache = newArtifactCache(ArtifactCacheConfig{Dir: filepath.Join(dir, "missing")}, func() map[string]bool { return nil })
+	result = cache.Collect()
+	require.Empty(t, result.Errors)
+	require.Zero(t, result.Files)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"gopkg.in/yaml.v3"
+	"k8s.io/klog/v2"
+)
+
+// defaultArtifactRegistryBase is where the files of the epochs are hosted by default.
+const defaultArtifactRegistryBase = "https://files.old-faithful.net"
+
+// ArtifactRegistry resolves the URLs of the files of an epoch (root CID, CAR and indexes) from the
+// epoch number. The URLs are templates with the placeholders {base}, {epoch}, {cid} (the root CID
+// of the epoch, fetched from the RootCid URL) and {network}.
+type ArtifactRegistry struct {
+	Base               string `yaml:"base"`
+	Network            string `yaml:"network"`
+	RootCid            string `yaml:"root_cid"`
+	Car                string `yaml:"car"`
+	CidToOffsetAndSize string `yaml:"cid_to_offset_and_size"`
+	SlotToCid          string `yaml:"slot_to_cid"`
+	SigToCid           string `yaml:"sig_to_cid"`
+	SigExists          string `yaml:"sig_exists"`
+}
+
+// defaultArtifactRegistry is the layout of old-faithful.net.
+var defaultArtifactRegistry = ArtifactRegistry{
+	Base:               defaultArtifactRegistryBase,
+	Network:            "mainnet",
+	RootCid:            "{base}/{epoch}/epoch-{epoch}.cid",
+	Car:                "{base}/{epoch}/epoch-{epoch}.car",
+	CidToOffsetAndSize: "{base}/{epoch}/epoch-{epoch}-{cid}-{network}-cid-to-offset-and-size.index",
+	SlotToCid:          "{base}/{epoch}/epoch-{epoch}-{cid}-{network}-slot-to-cid.index",
+	SigToCid:           "{base}/{epoch}/epoch-{epoch}-{cid}-{network}-sig-to-cid.index",
+	SigExists:          "{base}/{epoch}/epoch-{epoch}-{cid}-{network}-sig-exists.index",
+}
+
+// loadArtifactRegistry returns the registry described by where: the default one if empty,
+// the default layout at another base URL if it's a URL, or else a YAML file with the templates
+// (the missing ones are the default ones).
+func loadArtifactRegistry(where string) (*ArtifactRegistry, error) {
+	registry := defaultArtifactRegistry
+	switch {
+	case where == "":
+	case URI(where).IsRemoteWeb():
+		registry.Base = strings.TrimSuffix(where, "/")
+	default:
+		var fromFile ArtifactRegistry
+		if err := loadFromYAML(where, &fromFile); err != nil {
+			return nil, fmt.Errorf("failed to load the artifact registry %q: %w", where, err)
+		}
+		for _, field := range []struct {
+			dst *string
+			src string
+		}{
+			{&registry.Base, fromFile.Base},
+			{&registry.Network, fromFile.Network},
+			{&registry.RootCid, fromFile.RootCid},
+			{&registry.Car, fromFile.Car},
+			{&registry.CidToOffsetAndSize, fromFile.CidToOffsetAndSize},
+			{&registry.SlotToCid, fromFile.SlotToCid},
+			{&registry.SigToCid, fromFile.SigToCid},
+			{&registry.SigExists, fromFile.SigExists},
+		} {
+			if field.src != "" {
+				*field.dst = field.src
+			}
+		}
+	}
+	return &registry, nil
+}
+
+// expand returns the URL of the template for the given epoch and root CID.
+func (r *ArtifactRegistry) expand(template string, epoch uint64, rootCid cid.Cid) string {
+	replacer := strings.NewReplacer(
+		"{base}", r.Base,
+		"{epoch}", strconv.FormatUint(epoch, 10),
+		"{cid}", rootCid.String(),
+		"{network}", r.Network,
+	)
+	return replacer.Replace(template)
+}
+
+// ResolvedEpoch is the files of an epoch, as resolved by an artifact registry.
+type ResolvedEpoch struct {
+	Epoch              uint64
+	RootCid            cid.Cid
+	Car                string
+	CidToOffsetAndSize string
+	SlotToCid          string
+	SigToCid           string
+	SigExists          string
+}
+
+// Resolve fetches the root CID of the epoch, and returns the URLs of its files.
+func (r *ArtifactRegistry) Resolve(ctx context.Context, epoch uint64) (*ResolvedEpoch, error) {
+	rootCidURL := r.expand(r.RootCid, epoch, cid.Undef)
+	rootCid, err := fetchRootCid(ctx, rootCidURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the root CID of epoch %d from %q: %w", epoch, rootCidURL, err)
+	}
+	return &ResolvedEpoch{
+		Epoch:              epoch,
+		RootCid:            rootCid,
+		Car:                r.expand(r.Car, epoch, rootCid),
+		CidToOffsetAndSize: r.expand(r.CidToOffsetAndSize, epoch, rootCid),
+		SlotToCid:          r.expand(r.SlotToCid, epoch, rootCid),
+		SigToCid:           r.expand(r.SigToCid, epoch, rootCid),
+		SigExists:          r.expand(r.SigExists, epoch, rootCid),
+	}, nil
+}
+
+// fetchRootCid reads the root CID of an epoch from the given URL (or local file).
+func fetchRootCid(ctx context.Context, where string) (cid.Cid, error) {
+	var body []byte
+	if URI(where).IsRemoteWeb() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, where, nil)
+		if err != nil {
+			return cid.Undef, err
+		}
+		resp, err := splitcarfetcher.NewHTTPClient().Do(req)
+		if err != nil {
+			return cid.Undef, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return cid.Undef, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		body, err = io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			return cid.Undef, err
+		}
+	} else {
+		var err error
+		body, err = os.ReadFile(where)
+		if err != nil {
+			return cid.Undef, err
+		}
+	}
+	return cid.Parse(strings.TrimSpace(string(body)))
+}
+
+// epochConfigFile is the YAML of an epoch config (see Config), for the generated ones.
+type epochConfigFile struct {
+	Epoch   uint64 `yaml:"epoch"`
+	Version uint64 `yaml:"version"`
+	Data    struct {
+		Car struct {
+			URI string `yaml:"uri"`
+		} `yaml:"car"`
+	} `yaml:"data"`
+	Indexes struct {
+		Mode               IndexMode `yaml:"mode,omitempty"`
+		LocalDir           string    `yaml:"local_dir,omitempty"`
+		CidToOffsetAndSize struct {
+			URI string `yaml:"uri"`
+		} `yaml:"cid_to_offset_and_size"`
+		SlotToCid struct {
+			URI string `yaml:"uri"`
+		} `yaml:"slot_to_cid"`
+		SigToCid struct {
+			URI string `yaml:"uri"`
+		} `yaml:"sig_to_cid"`
+		SigExists struct {
+			URI string `yaml:"uri"`
+		} `yaml:"sig_exists"`
+	} `yaml:"indexes"`
+}
+
+// writeResolvedEpochConfig writes the config of the resolved epoch in dir, and returns its path.
+// With a download dir, the index files are downloaded there when the epoch is loaded
+// (the CAR is always read remotely).
+func writeResolvedEpochConfig(resolved *ResolvedEpoch, dir string, downloadDir string) (string, error) {
+	if resolved.Epoch == 0 {
+		// the genesis of epoch 0 must be a local file.
+		return "", fmt.Errorf("epoch 0 can't be resolved from an artifact registry (it needs the genesis); use a config file")
+	}
+	var file epochConfigFile
+	file.Epoch = resolved.Epoch
+	file.Version = ConfigVersion
+	file.Data.Car.URI = resolved.Car
+	file.Indexes.CidToOffsetAndSize.URI = resolved.CidToOffsetAndSize
+	file.Indexes.SlotToCid.URI = resolved.SlotToCid
+	file.Indexes.SigToCid.URI = resolved.SigToCid
+	file.Indexes.SigExists.URI = resolved.SigExists
+	if downloadDir != "" {
+		file.Indexes.Mode = IndexModeDownload
+		file.Indexes.LocalDir = downloadDir
+	}
+	data, err := yaml.Marshal(&file)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("epoch-%d.yml", resolved.Epoch))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// resolveEpochConfigs resolves the given epochs with the registry, and writes their configs in dir.
+func resolveEpochConfigs(ctx context.Context, registry *ArtifactRegistry, epochs []uint64, dir string, downloadDir string) ([]string, error) {
+	var paths []string
+	for _, epoch := range epochs {
+		resolved, err := registry.Resolve(ctx, epoch)
+		if err != nil {
+			return nil, err
+		}
+		path, err := writeResolvedEpochConfig(resolved, dir, downloadDir)
+		if err != nil {
+			return nil, err
+		}
+		klog.Infof("Resolved epoch %d (root %s) from the artifact registry; config written to %q", epoch, resolved.RootCid, path)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
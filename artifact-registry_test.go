@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactRegistryResolve(t *testing.T) {
+	const rootCid = "bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/455/epoch-455.cid" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(rootCid + "\n"))
+	}))
+	defer server.Close()
+
+	registry, err := loadArtifactRegistry(server.URL + "/")
+	require.NoError(t, err)
+	resolved, err := registry.Resolve(context.Background(), 455)
+	require.NoError(t, err)
+	require.Equal(t, rootCid, resolved.RootCid.String())
+	require.Equal(t, server.URL+"/455/epoch-455.car", resolved.Car)
+	require.Equal(t, server.URL+"/455/epoch-455-"+rootCid+"-mainnet-slot-to-cid.index", resolved.SlotToCid)
+	require.Equal(t, server.URL+"/455/epoch-455-"+rootCid+"-mainnet-sig-exists.index", resolved.SigExists)
+
+	_, err = registry.Resolve(context.Background(), 456)
+	require.Error(t, err)
+
+	// the generated config is a valid epoch config.
+	dir := t.TempDir()
+	path, err := writeResolvedEpochConfig(resolved, dir, filepath.Join(dir, "indexes"))
+	require.NoError(t, err)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.NoError(t, config.Validate())
+	require.Equal(t, uint64(455), *config.Epoch)
+	require.Equal(t, URI(resolved.Car), config.Data.Car.URI)
+	require.Equal(t, URI(resolved.CidToOffsetAndSize), config.Indexes.CidToOffsetAndSize.URI)
+	require.Equal(t, IndexModeDownload, config.Indexes.Mode)
+
+	resolved.Epoch = 0
+	_, err = writeResolvedEpochConfig(resolved, dir, "")
+	require.Error(t, err)
+}
+
+func TestLoadArtifactRegistryFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.yml")
+	require.NoError(t, os.WriteFile(path, []byte("base: https://mirror.example\nnetwork: testnet\ncar: \"{base}/cars/{epoch}.car\"\n"), 0o644))
+	registry, err := loadArtifactRegistry(path)
+	require.NoError(t, err)
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	require.Equal(t, "https://mirror.example", registry.Base)
+	require.Equal(t, "https://mirror.example/cars/7.car", registry.expand(registry.Car, 7, rootCid))
+	// the templates that are not in the file are the default ones.
+	require.Equal(t, defaultArtifactRegistry.SlotToCid, registry.SlotToCid)
+	require.Contains(t, registry.expand(registry.SlotToCid, 7, rootCid), "-testnet-slot-to-cid.index")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/logging"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// AuditLog is an append-only JSONL log of the data served to clients.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// AuditEntry is a line of the audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	// Token is a fingerprint of the credentials used by the client (if any); the credentials themselves are never logged.
+	Token      string   `json:"token,omitempty"`
+	RemoteAddr string   `json:"remoteAddr"`
+	Method     string   `json:"method"`
+	Slot       *uint64  `json:"slot,omitempty"`
+	Signature  string   `json:"signature,omitempty"`
+	Address    string   `json:"address,omitempty"`
+	Cid        string   `json:"cid,omitempty"`
+	Status     int      `json:"status"`
+	Bytes      int      `json:"bytes"`
+	SourceCids []string `json:"sourceCids,omitempty"`
+}
+
+// OpenAuditLog opens (or creates) the audit log at the given path; new entries are appended.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{file: file}, nil
+}
+
+// Write appends the entry to the log.
+func (a *AuditLog) Write(entry *AuditEntry) error {
+	line, err := fasterJson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// a single write per entry, so that lines are never interleaved.
+	_, err = a.file.Write(line)
+	return err
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// tokenFingerprint returns a fingerprint of the credentials of the request
+// (Authorization header, or X-Api-Key header, or api-key query arg).
+func tokenFingerprint(reqCtx *fasthttp.RequestCtx) string {
+	token := reqCtx.Request.Header.Peek("Authorization")
+	if len(token) == 0 {
+		token = reqCtx.Request.Header.Peek("X-Api-Key")
+	}
+	if len(token) == 0 {
+		token = reqCtx.QueryArgs().Peek("api-key")
+	}
+	if len(token) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(bytes.TrimSpace(token))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// auditTarget fills in the slot/signature/address requested by the given request.
+func auditTarget(entry *AuditEntry, req *jsonrpc2.Request) {
+	if req == nil || req.Params == nil {
+		return
+	}
+	var params []any
+	if err := fasterJson.Unmarshal(*req.Params, &params); err != nil || len(params) == 0 {
+		return
+	}
+	switch req.Method {
+	case "getBlock", "getBlockTime", "faithful_getEntries", "faithful_getBlockHash256":
+		if slot, ok := params[0].(float64); ok && slot >= 0 {
+			v := uint64(slot)
+			entry.Slot = &v
+		}
+	case "getTransaction":
+		if sig, ok := params[0].(string); ok {
+			entry.Signature = sig
+		}
+	case "getSignaturesForAddress", "faithful_getAccountAtEpochBoundary":
+		if address, ok := params[0].(string); ok {
+			entry.Address = address
+		}
+	case "faithful_getRawNode":
+		if c, ok := params[0].(string); ok {
+			entry.Cid = c
+		}
+	}
+}
+
+// auditRestTarget fills in the slot/CID requested by the given GET API request.
+func auditRestTarget(entry *AuditEntry, reqCtx *fasthttp.RequestCtx) {
+	path := string(reqCtx.Path())
+	switch restRoute(reqCtx) {
+	case "GET " + restPathBlock:
+		if slot, err := strconv.ParseUint(strings.TrimPrefix(path, restPathBlock), 10, 64); err == nil {
+			entry.Slot = &slot
+		}
+	case "GET " + restPathNode:
+		if c, err := cid.Parse(strings.TrimPrefix(path, restPathNode)); err == nil {
+			entry.Cid = c.String()
+		}
+	}
+}
+
+// newAuditEntry creates the audit entry for a served request.
+func newAuditEntry(reqCtx *fasthttp.RequestCtx, reqID string, method string, req *jsonrpc2.Request) *AuditEntry {
+	entry := &AuditEntry{
+		Time:       time.Now().UTC(),
+		RequestID:  reqID,
+		Token:      tokenFingerprint(reqCtx),
+		RemoteAddr: reqCtx.RemoteIP().String(),
+		Method:     sanitizeMethod(method),
+		Status:     reqCtx.Response.StatusCode(),
+		Bytes:      len(reqCtx.Response.Body()),
+	}
+	if req != nil {
+		auditTarget(entry, req)
+	} else {
+		auditRestTarget(entry, reqCtx)
+	}
+	if rootCids := string(reqCtx.Response.Header.Peek("DAG-Root-CID")); rootCids != "" {
+		entry.SourceCids = strings.Split(rootCids, ",")
+	}
+	return entry
+}
+
+func (a *AuditLog) record(reqCtx *fasthttp.RequestCtx, reqID string, method string, req *jsonrpc2.Request) {
+	if err := a.Write(newAuditEntry(reqCtx, reqID, method, req)); err != nil {
+		rpcLog.Error("failed to write audit log", logging.RequestID(reqID), logging.Err(err))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := OpenAuditLog(path)
+	require.NoError(t, err)
+
+	reqCtx := &fasthttp.RequestCtx{}
+	reqCtx.Request.Header.Set("Authorization", "Bearer secret")
+	reqCtx.Response.Header.Set("DAG-Root-CID", "bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+	reqCtx.Response.SetBodyString(`{"result":{}}`)
+
+	auditLog.record(reqCtx, "req-1", "getBlock", newTestRequest(t, "getBlock", `[123, {"encoding": "json"}]`))
+	auditLog.record(reqCtx, "req-2", "getTransaction", newTestRequest(t, "getTransaction", `["sig"]`))
+	require.NoError(t, auditLog.Close())
+
+	// reopening appends.
+	auditLog, err = OpenAuditLog(path)
+	require.NoError(t, err)
+	auditLog.record(reqCtx, "req-3", "getSlot", nil)
+	require.NoError(t, auditLog.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	entries := make([]AuditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, fasterJson.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "req-1", entries[0].RequestID)
+	require.NotNil(t, entries[0].Slot)
+	require.Equal(t, uint64(123), *entries[0].Slot)
+	require.Equal(t, len(`{"result":{}}`), entries[0].Bytes)
+	require.Equal(t, []string{"bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa"}, entries[0].SourceCids)
+	require.Contains(t, entries[0].Token, "sha256:")
+	require.NotContains(t, entries[0].Token, "secret")
+
+	require.Equal(t, "sig", entries[1].Signature)
+	require.Nil(t, entries[1].Slot)
+
+	require.Equal(t, "req-3", entries[2].RequestID)
+}
+
+func TestAuditEntryTarget(t *testing.T) {
+	restRequest := func(path string) *fasthttp.RequestCtx {
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Request.Header.SetMethod("GET")
+		reqCtx.Request.SetRequestURI(path)
+		return reqCtx
+	}
+	entry := newAuditEntry(restRequest("/block/123?encoding=base64"), "req-1", "GET /block/", nil)
+	require.NotNil(t, entry.Slot)
+	require.Equal(t, uint64(123), *entry.Slot)
+	entry = newAuditEntry(restRequest("/node/"+DummyCID.String()), "req-2", "GET /node/", nil)
+	require.Equal(t, DummyCID.String(), entry.Cid)
+	require.Nil(t, entry.Slot)
+	entry = newAuditEntry(restRequest("/node/not-a-cid"), "req-3", "GET /node/", nil)
+	require.Empty(t, entry.Cid)
+
+	entry = newAuditEntry(&fasthttp.RequestCtx{}, "req-4", "faithful_getRawNode", newTestRequest(t, "faithful_getRawNode", `["`+DummyCID.String()+`"]`))
+	require.Equal(t, DummyCID.String(), entry.Cid)
+
+	// a response served from the response cache has the CIDs of the original response.
+	responseCache, err := NewResponseCache(context.Background(), ResponseCacheConfig{TTL: time.Minute})
+	require.NoError(t, err)
+	handler := cacheMiddleware(responseCache)(func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		call.HTTP.Response.Header.Set("DAG-Root-CID", DummyCID.String())
+		return nil, call.Reply(ctx, 123)
+	})
+	for _, reqID := range []string{"miss", "hit"} {
+		var req fasthttp.Request
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Init(&req, nil, nil)
+		rpcRequest := newTestRequest(t, "getBlockTime", `[123]`)
+		_, err := handler(context.Background(), &RPCCall{Request: rpcRequest, HTTP: reqCtx, conn: &requestContext{ctx: reqCtx}})
+		require.NoError(t, err)
+		entry := newAuditEntry(reqCtx, reqID, "getBlockTime", rpcRequest)
+		require.Equal(t, []string{DummyCID.String()}, entry.SourceCids, reqID)
+	}
+}
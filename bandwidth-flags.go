@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+// newBandwidthFlags returns the global flags that cap the bandwidth of the remote traffic
+// (the range reads of the remote CAR and index files, and the downloads), so that background
+// syncing doesn't starve the serving traffic on the same NIC.
+func newBandwidthFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "bandwidth-limit",
+			Usage:   "cap the bandwidth of all the remote reads and downloads, per second (e.g. 100MB)",
+			EnvVars: []string{"FAITHFUL_BANDWIDTH_LIMIT"},
+			Action: func(cctx *cli.Context, v string) error {
+				return setBandwidthLimit("bandwidth-limit", v, splitcarfetcher.DefaultBandwidth.SetGlobal)
+			},
+		},
+		&cli.StringFlag{
+			Name:    "bandwidth-limit-per-source",
+			Usage:   "cap the bandwidth of the remote reads and downloads from each host, per second (e.g. 50MB)",
+			EnvVars: []string{"FAITHFUL_BANDWIDTH_LIMIT_PER_SOURCE"},
+			Action: func(cctx *cli.Context, v string) error {
+				return setBandwidthLimit("bandwidth-limit-per-source", v, splitcarfetcher.DefaultBandwidth.SetPerSource)
+			},
+		},
+		&cli.StringFlag{
+			Name:    "bandwidth-limit-downloads",
+			Usage:   "cap the bandwidth of the downloads (index files, whole remote CARs), per second (e.g. 20MB), outside of --bandwidth-off-peak",
+			EnvVars: []string{"FAITHFUL_BANDWIDTH_LIMIT_DOWNLOADS"},
+			Action: func(cctx *cli.Context, v string) error {
+				return setBandwidthLimit("bandwidth-limit-downloads", v, splitcarfetcher.DefaultBandwidth.SetDownloads)
+			},
+		},
+		&cli.StringFlag{
+			Name:    "bandwidth-off-peak",
+			Usage:   "daily window of local time (HH:MM-HH:MM, e.g. 01:00-06:00) during which --bandwidth-limit-downloads doesn't apply",
+			EnvVars: []string{"FAITHFUL_BANDWIDTH_OFF_PEAK"},
+			Action: func(cctx *cli.Context, v string) error {
+				if v == "" {
+					return nil
+				}
+				window, err := splitcarfetcher.ParseOffPeakWindow(v)
+				if err != nil {
+					return err
+				}
+				splitcarfetcher.DefaultBandwidth.SetOffPeak(window)
+				klog.Infof("Off-peak window for the downloads: %s", window)
+				return nil
+			},
+		},
+	}
+}
+
+// setBandwidthLimit parses a bandwidth (bytes per second, with an optional unit) and sets it.
+func setBandwidthLimit(name string, v string, set func(bytesPerSecond int64)) error {
+	if v == "" {
+		return nil
+	}
+	bytesPerSecond, err := humanize.ParseBytes(v)
+	if err != nil {
+		return fmt.Errorf("invalid --%s %q: %w", name, v, err)
+	}
+	set(int64(bytesPerSecond))
+	klog.Infof("Bandwidth: --%s=%s/s", name, humanize.Bytes(bytesPerSecond))
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// batchFetchMaxGap is the max distance (in bytes) between two nodes in the CAR
+	// for them to be fetched with the same read.
+	batchFetchMaxGap = 64 * 1024
+	// batchFetchMaxRangeSize is the max size of a single coalesced read.
+	batchFetchMaxRangeSize = 8 * 1024 * 1024
+)
+
+// batchFetchItem is a node to be fetched, with its location in the CAR.
+type batchFetchItem struct {
+	cid cid.Cid
+	oas *indexes.OffsetAndSize
+}
+
+// batchFetchRange is a contiguous range of the CAR that contains one or more nodes.
+type batchFetchRange struct {
+	start uint64
+	end   uint64
+	items []batchFetchItem
+}
+
+// coalesceBatchFetchItems groups the given items (which must be sorted by offset)
+// into ranges that can be read with a single read each.
+func coalesceBatchFetchItems(items []batchFetchItem, maxGap uint64, maxRangeSize uint64) []batchFetchRange {
+	ranges := make([]batchFetchRange, 0)
+	for _, item := range items {
+		itemEnd := item.oas.Offset + item.oas.Size
+		if len(ranges) > 0 {
+			last := &ranges[len(ranges)-1]
+			if item.oas.Offset <= last.end+maxGap && itemEnd-last.start <= maxRangeSize {
+				if itemEnd > last.end {
+					last.end = itemEnd
+				}
+				last.items = append(last.items, item)
+				continue
+			}
+		}
+		ranges = append(ranges, batchFetchRange{
+			start: item.oas.Offset,
+			end:   itemEnd,
+			items: []batchFetchItem{item},
+		})
+	}
+	return ranges
+}
+
+// GetNodesByCids returns the raw nodes for the given CIDs.
+// The nodes that are not in the cache are resolved to their offsets in the CAR,
+// sorted, coalesced into as few reads as possible, and fetched concurrently.
+func (ser *Epoch) GetNodesByCids(ctx context.Context, cids []cid.Cid) (map[cid.Cid][]byte, error) {
+	return ser.getNodesByCids(ctx, cids, false)
+}
+
+// getNodesByCids is GetNodesByCids; with skipErrors, the nodes that can't be read are logged
+// and nil in the result, instead of failing the whole batch.
+func (ser *Epoch) getNodesByCids(ctx context.Context, cids []cid.Cid, skipErrors bool) (map[cid.Cid][]byte, error) {
+	// skip returns whether the error of a node is to be skipped.
+	skip := func(c cid.Cid, err error) bool {
+		if !skipErrors || ctx.Err() != nil {
+			return false
+		}
+		klog.Errorf("batch fetch: skipping node %s: %v", c, err)
+		return true
+	}
+	out := make(map[cid.Cid][]byte, len(cids))
+	missing := make([]cid.Cid, 0)
+	for _, c := range cids {
+		if _, ok := out[c]; ok {
+			continue
+		}
+		data, err, has := ser.GetCache().GetRawCarObject(c)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			observeNodeRead(ctx, len(data), true)
+			out[c] = data
+			continue
+		}
+		out[c] = nil // mark as seen
+		missing = append(missing, c)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	mu := &sync.Mutex{}
+
+	if ser.lassieFetcher != nil {
+		// No offsets: fetch each node individually.
+		wg, ctx := dagFetchPool.Group(ctx)
+		for _, c := range missing {
+			c := c
+			wg.Go(func() error {
+				data, err := ser.GetNodeByCid(ctx, c)
+				if err != nil {
+					if skip(c, err) {
+						return nil
+					}
+					return err
+				}
+				mu.Lock()
+				out[c] = data
+				mu.Unlock()
+				return nil
+			})
+		}
+		if err := wg.Wait(); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	// Resolve the offsets.
+	items := make([]batchFetchItem, len(missing))
+	{
+		wg, ctx := dagFetchPool.Group(ctx)
+		for i, c := range missing {
+			i, c := i, c
+			wg.Go(func() error {
+				oas, err := ser.FindOffsetAndSizeFromCid(ctx, c)
+				if err != nil {
+					if skip(c, err) {
+						return nil
+					}
+					return fmt.Errorf("failed to find offset for CID %s: %w", c, err)
+				}
+				items[i] = batchFetchItem{cid: c, oas: oas}
+				return nil
+			})
+		}
+		if err := wg.Wait(); err != nil {
+			return nil, err
+		}
+	}
+	{
+		// the skipped nodes have no offset.
+		found := items[:0]
+		for _, item := range items {
+			if item.oas != nil {
+				found = append(found, item)
+			}
+		}
+		items = found
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].oas.Offset < items[j].oas.Offset
+	})
+	ranges := coalesceBatchFetchItems(items, batchFetchMaxGap, batchFetchMaxRangeSize)
+	klog.V(4).Infof("batch fetch: %d nodes (%d from cache), %d reads", len(out), len(out)-len(missing), len(ranges))
+
+	// Read the ranges.
+	wg, ctx := dagFetchPool.Group(ctx)
+	for _, rng := range ranges {
+		rng := rng
+		wg.Go(func() error {
+			buf, err := ser.ReadAtFromCar(ctx, rng.start, rng.end-rng.start)
+			if err != nil {
+				err = fmt.Errorf("failed to read CAR range %d-%d: %w", rng.start, rng.end, err)
+				for _, item := range rng.items {
+					if !skip(item.cid, err) {
+						return err
+					}
+				}
+				return nil
+			}
+			for _, item := range rng.items {
+				relative := item.oas.Offset - rng.start
+				data, err := parseNodeFromSection(buf[relative:relative+item.oas.Size], item.cid)
+				data, err = ser.verifyNode(ctx, item.cid, item.oas, data, err)
+				if err != nil {
+					if skip(item.cid, err) {
+						continue
+					}
+					return err
+				}
+				observeNodeRead(ctx, len(data), false)
+				mu.Lock()
+				out[item.cid] = data
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetEntriesByCids returns the entries for the given CIDs, in the same order.
+func (ser *Epoch) GetEntriesByCids(ctx context.Context, cids []cid.Cid) ([]*ipldbindcode.Entry, error) {
+	nodes, err := ser.GetNodesByCids(ctx, cids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*ipldbindcode.Entry, len(cids))
+	startedDecodingAt := time.Now()
+	for i, c := range cids {
+		decoded, err := iplddecoders.DecodeEntry(nodes[c])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode entry with CID %s: %w", c, err)
+		}
+		out[i] = decoded
+	}
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+	return out, nil
+}
+
+// GetTransactionsByCids returns the transactions for the given CIDs, in the same order.
+// A transaction that can't be read or decoded doesn't fail the others: it's logged, and nil.
+func (ser *Epoch) GetTransactionsByCids(ctx context.Context, cids []cid.Cid) ([]*ipldbindcode.Transaction, error) {
+	nodes, err := ser.getNodesByCids(ctx, cids, true)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*ipldbindcode.Transaction, len(cids))
+	startedDecodingAt := time.Now()
+	for i, c := range cids {
+		if nodes[c] == nil {
+			// skipped.
+			continue
+		}
+		decoded, err := iplddecoders.DecodeTransaction(nodes[c])
+		if err != nil {
+			klog.Errorf("failed to decode Transaction %s: %v", c, err)
+			continue
+		}
+		out[i] = decoded
+	}
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+	return out, nil
+}
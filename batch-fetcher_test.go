@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/ipfs/go-cid"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceBatchFetchItems(t *testing.T) {
+	item := func(offset, size uint64) batchFetchItem {
+		return batchFetchItem{
+			cid: cid.Undef,
+			oas: &indexes.OffsetAndSize{Offset: offset, Size: size},
+		}
+	}
+	items := []batchFetchItem{
+		item(100, 10),  // [100, 110)
+		item(110, 20),  // adjacent
+		item(135, 5),   // gap of 5
+		item(500, 10),  // gap too big
+		item(510, 100), // range would be too big
+	}
+	ranges := coalesceBatchFetchItems(items, 10, 100)
+	require.Len(t, ranges, 3)
+
+	require.Equal(t, uint64(100), ranges[0].start)
+	require.Equal(t, uint64(140), ranges[0].end)
+	require.Len(t, ranges[0].items, 3)
+
+	require.Equal(t, uint64(500), ranges[1].start)
+	require.Equal(t, uint64(510), ranges[1].end)
+	require.Len(t, ranges[1].items, 1)
+
+	require.Equal(t, uint64(510), ranges[2].start)
+	require.Equal(t, uint64(610), ranges[2].end)
+	require.Len(t, ranges[2].items, 1)
+
+	require.Empty(t, coalesceBatchFetchItems(nil, 10, 100))
+}
+
+func TestGetTransactionsByCidsSkipsUnreadable(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	readable, _ := cacheTestNode(t, cache, &ipldbindcode.Transaction{
+		Kind:     int(iplddecoders.KindTransaction),
+		Data:     ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: []byte{1}},
+		Metadata: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame)},
+		Slot:     10,
+	}, ipldbindcode.Prototypes.Transaction.Type())
+	// in the index, but the epoch has no CAR to read it from.
+	unreadable := DummyCID
+	require.NoError(t, cache.PutCidToOffsetAndSize(unreadable, &indexes.OffsetAndSize{Offset: 100, Size: 10}))
+	// not a transaction.
+	entry, _ := cacheTestNode(t, cache, &ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	epoch := &Epoch{epoch: 0, config: &Config{}, allCache: cache}
+
+	txs, err := epoch.GetTransactionsByCids(ctx, []cid.Cid{unreadable, readable, entry})
+	require.NoError(t, err)
+	require.Len(t, txs, 3)
+	require.Nil(t, txs[0])
+	require.Equal(t, 10, txs[1].Slot)
+	require.Nil(t, txs[2])
+
+	// the other nodes still fail the batch.
+	_, err = epoch.GetNodesByCids(ctx, []cid.Cid{unreadable, readable})
+	require.ErrorContains(t, err, "no CAR reader available")
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+)
+
+// The micro-benchmarks of `bench internal`.
+const (
+	benchSlotToCid          = "slot-to-cid lookups"
+	benchCidToOffsetAndSize = "cid-to-offset-and-size lookups"
+	benchNodeReads          = "node reads"
+	benchBlockAssembly      = "block assemblies"
+)
+
+var benchNames = []string{benchSlotToCid, benchCidToOffsetAndSize, benchNodeReads, benchBlockAssembly}
+
+// benchBaselines are the operations per second (per worker) expected from the kinds of storage;
+// they are rough orders of magnitude, to tell a misconfigured storage (e.g. indexes on a network
+// filesystem, or a remote CAR without cache) from a healthy one, not precise targets.
+var benchBaselines = map[string]map[string]float64{
+	"nvme": {
+		benchSlotToCid:          20_000,
+		benchCidToOffsetAndSize: 15_000,
+		benchNodeReads:          10_000,
+		benchBlockAssembly:      50,
+	},
+	"ssd": {
+		benchSlotToCid:          8_000,
+		benchCidToOffsetAndSize: 6_000,
+		benchNodeReads:          4_000,
+		benchBlockAssembly:      20,
+	},
+	"hdd": {
+		benchSlotToCid:          150,
+		benchCidToOffsetAndSize: 100,
+		benchNodeReads:          80,
+		benchBlockAssembly:      0.5,
+	},
+	"remote": {
+		benchSlotToCid:          50,
+		benchCidToOffsetAndSize: 40,
+		benchNodeReads:          30,
+		benchBlockAssembly:      0.2,
+	},
+}
+
+// benchBaselineNames returns the names of the baselines, sorted.
+func benchBaselineNames() []string {
+	names := make([]string, 0, len(benchBaselines))
+	for name := range benchBaselines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultBenchBaseline returns the baseline for the storage of the epoch config.
+func defaultBenchBaseline(config *Config) string {
+	if config.Data.Car != nil && config.Data.Car.URI.IsLocal() && config.Indexes.SlotToCid.URI.IsLocal() {
+		return "nvme"
+	}
+	return "remote"
+}
+
+// BenchConfig is the configuration of `bench internal`.
+type BenchConfig struct {
+	// Duration is how long each benchmark runs.
+	Duration time.Duration
+	// Workers is the number of concurrent workers of each benchmark.
+	Workers int
+	// Seed makes the sequence of slots reproducible.
+	Seed int64
+	// Baseline is the name of the baseline to compare with.
+	Baseline string
+}
+
+// BenchResult is the outcome of a micro-benchmark.
+type BenchResult struct {
+	Name      string  `json:"name"`
+	Ops       int64   `json:"ops"`
+	Errors    int64   `json:"errors"`
+	Bytes     int64   `json:"bytes"`
+	Seconds   float64 `json:"seconds"`
+	OpsPerSec float64 `json:"opsPerSec"`
+	// Expected is the ops per second of the baseline, for the number of workers.
+	Expected float64 `json:"expected"`
+	// Ratio is OpsPerSec / Expected.
+	Ratio   float64 `json:"ratio"`
+	Verdict string  `json:"verdict"`
+	// Skipped is why the benchmark didn't run (e.g. no sample to run it on).
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// benchOp is one operation of a benchmark; it returns the bytes it read.
+type benchOp func(ctx context.Context, rng *rand.Rand) (int, error)
+
+// runBench runs the operation with the given workers, for the given duration.
+func runBench(ctx context.Context, name string, conf BenchConfig, op benchOp) *BenchResult {
+	ctx, cancel := context.WithTimeout(ctx, conf.Duration)
+	defer cancel()
+	var mu sync.Mutex
+	result := &BenchResult{Name: name}
+	startedAt := time.Now()
+	var wg sync.WaitGroup
+	for worker := 0; worker < conf.Workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			// each worker has its own reproducible sequence.
+			rng := rand.New(rand.NewSource(conf.Seed + int64(worker)))
+			var ops, errs, bytes int64
+			for ctx.Err() == nil {
+				n, err := op(ctx, rng)
+				if err != nil {
+					if ctx.Err() != nil {
+						break
+					}
+					errs++
+					continue
+				}
+				ops++
+				bytes += int64(n)
+			}
+			mu.Lock()
+			result.Ops += ops
+			result.Errors += errs
+			result.Bytes += bytes
+			mu.Unlock()
+		}(worker)
+	}
+	wg.Wait()
+	result.Seconds = time.Since(startedAt).Seconds()
+	if result.Seconds > 0 {
+		result.OpsPerSec = float64(result.Ops) / result.Seconds
+	}
+	return result
+}
+
+// compareWithBaseline sets the expected ops per second and the verdict of the result.
+func compareWithBaseline(result *BenchResult, baseline string, workers int) {
+	expected, ok := benchBaselines[baseline][result.Name]
+	if !ok || result.Skipped != "" {
+		return
+	}
+	result.Expected = expected * float64(workers)
+	result.Ratio = result.OpsPerSec / result.Expected
+	switch {
+	case result.Ops == 0:
+		result.Verdict = "FAILED"
+	case result.Ratio >= 0.5:
+		result.Verdict = "ok"
+	case result.Ratio >= 0.1:
+		result.Verdict = "slow"
+	default:
+		result.Verdict = "very slow"
+	}
+}
+
+// benchSample is the blocks that the benchmarks run on: random slots of the epoch that have a block.
+type benchSample struct {
+	slots     []uint64
+	blockCids []cid.Cid
+	offsets   []*indexes.OffsetAndSize
+}
+
+// maxBenchSample is the largest number of blocks sampled.
+const maxBenchSample = 1000
+
+// sampleBlocks picks (reproducibly) up to n random slots of the epoch that have a block.
+func (e *Epoch) sampleBlocks(ctx context.Context, seed int64, n int) (*benchSample, error) {
+	slotToCid, err := e.getSlotToCidIndex()
+	if err != nil {
+		return nil, err
+	}
+	first, last := CalcEpochLimits(e.Epoch())
+	if coverage, ok := slotToCid.Coverage(); ok {
+		first, last = coverage.FirstSlot, coverage.LastSlot
+	}
+	rng := rand.New(rand.NewSource(seed))
+	sample := &benchSample{}
+	for attempts := 0; len(sample.slots) < n && attempts < n*10; attempts++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		slot := first + uint64(rng.Int63n(int64(last-first+1)))
+		blockCid, err := slotToCid.Get(slot)
+		if errors.Is(err, compactindexsized.ErrNotFound) {
+			// skipped.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up slot %d: %w", slot, err)
+		}
+		oas, err := e.FindOffsetAndSizeFromCid(ctx, blockCid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up the offset of block %s: %w", blockCid, err)
+		}
+		sample.slots = append(sample.slots, slot)
+		sample.blockCids = append(sample.blockCids, blockCid)
+		sample.offsets = append(sample.offsets, oas)
+	}
+	return sample, nil
+}
+
+// RunInternalBenchmarks runs the micro-benchmarks of the index and CAR read paths on the epoch.
+// The cache is bypassed (the lookups go to the indexes, the reads to the CAR), except for the
+// block assemblies, which start each with an empty cache.
+func (e *Epoch) RunInternalBenchmarks(ctx context.Context, conf BenchConfig) ([]*BenchResult, error) {
+	sample, err := e.sampleBlocks(ctx, conf.Seed, maxBenchSample)
+	if err != nil {
+		return nil, err
+	}
+	skip := func(name string, why string) *BenchResult {
+		return &BenchResult{Name: name, Skipped: why}
+	}
+	var results []*BenchResult
+
+	slotToCid, err := e.getSlotToCidIndex()
+	if err != nil {
+		return nil, err
+	}
+	first, last := CalcEpochLimits(e.Epoch())
+	results = append(results, runBench(ctx, benchSlotToCid, conf, func(ctx context.Context, rng *rand.Rand) (int, error) {
+		// random slots, skipped or not: a miss costs the same lookup.
+		_, err := slotToCid.Get(first + uint64(rng.Int63n(int64(last-first+1))))
+		if err != nil && !errors.Is(err, compactindexsized.ErrNotFound) {
+			return 0, err
+		}
+		return 0, nil
+	}))
+
+	if len(sample.slots) == 0 {
+		results = append(results,
+			skip(benchCidToOffsetAndSize, "no block found in the epoch"),
+			skip(benchNodeReads, "no block found in the epoch"),
+			skip(benchBlockAssembly, "no block found in the epoch"),
+		)
+	} else {
+		if e.cidToOffsetAndSizeIndex == nil {
+			results = append(results, skip(benchCidToOffsetAndSize, "the epoch has no cid-to-offset-and-size index"))
+		} else {
+			results = append(results, runBench(ctx, benchCidToOffsetAndSize, conf, func(ctx context.Context, rng *rand.Rand) (int, error) {
+				_, err := e.cidToOffsetAndSizeIndex.Get(sample.blockCids[rng.Intn(len(sample.blockCids))])
+				return 0, err
+			}))
+		}
+		results = append(results, runBench(ctx, benchNodeReads, conf, func(ctx context.Context, rng *rand.Rand) (int, error) {
+			i := rng.Intn(len(sample.blockCids))
+			data, err := e.GetNodeByOffsetAndSize(ctx, sample.blockCids[i], sample.offsets[i])
+			return len(data), err
+		}))
+		// the assemblies use the cache of the epoch, emptied before each of them.
+		assemblyConf := conf
+		assemblyConf.Workers = 1
+		result := runBench(ctx, benchBlockAssembly, assemblyConf, func(ctx context.Context, rng *rand.Rand) (int, error) {
+			if err := e.GetCache().Reset(); err != nil {
+				return 0, err
+			}
+			_, objects, err := e.CollectBlockObjects(ctx, sample.slots[rng.Intn(len(sample.slots))])
+			var size int
+			for _, data := range objects {
+				size += len(data)
+			}
+			return size, err
+		})
+		results = append(results, result)
+	}
+	for _, result := range results {
+		workers := conf.Workers
+		if result.Name == benchBlockAssembly {
+			workers = 1
+		}
+		compareWithBaseline(result, conf.Baseline, workers)
+	}
+	return results, nil
+}
+
+// printBenchResults writes the results as a table.
+func printBenchResults(out io.Writer, results []*BenchResult, conf BenchConfig) error {
+	fmt.Fprintf(out, "Baseline: %s, %d worker(s), %s per benchmark, seed %d\n\n", conf.Baseline, conf.Workers, conf.Duration, conf.Seed)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BENCHMARK\tOPS/SEC\tEXPECTED\tRATIO\tMB/SEC\tERRORS\tVERDICT")
+	for _, result := range results {
+		if result.Skipped != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\tskipped: %s\n", result.Name, result.Skipped)
+			continue
+		}
+		var mbPerSec float64
+		if result.Seconds > 0 {
+			mbPerSec = float64(result.Bytes) / result.Seconds / (1024 * 1024)
+		}
+		fmt.Fprintf(w, "%s\t%.1f\t%.1f\t%.2f\t%.1f\t%d\t%s\n", result.Name, result.OpsPerSec, result.Expected, result.Ratio, mbPerSec, result.Errors, result.Verdict)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunBench(t *testing.T) {
+	conf := BenchConfig{Duration: 50 * time.Millisecond, Workers: 2, Seed: 7}
+	var mu sync.Mutex
+	var firsts []int64
+	result := runBench(context.Background(), benchNodeReads, conf, func(ctx context.Context, rng *rand.Rand) (int, error) {
+		n := rng.Int63()
+		mu.Lock()
+		if len(firsts) < 2 {
+			firsts = append(firsts, n)
+		}
+		mu.Unlock()
+		if n%10 == 0 {
+			return 0, errors.New("failed")
+		}
+		time.Sleep(time.Millisecond)
+		return 100, nil
+	})
+	require.Equal(t, benchNodeReads, result.Name)
+	require.Positive(t, result.Ops)
+	require.Equal(t, result.Ops*100, result.Bytes)
+	require.InDelta(t, 0.05, result.Seconds, 0.04)
+	require.InDelta(t, float64(result.Ops)/result.Seconds, result.OpsPerSec, 0.001)
+	// the workers have reproducible sequences: their first draws are the ones of their seeds.
+	require.ElementsMatch(t, []int64{rand.New(rand.NewSource(7)).Int63(), rand.New(rand.NewSource(8)).Int63()}, firsts)
+}
+
+func TestCompareWithBaseline(t *testing.T) {
+	result := &BenchResult{Name: benchSlotToCid, Ops: 100, OpsPerSec: 12_000}
+	compareWithBaseline(result, "nvme", 1)
+	require.Equal(t, 20_000.0, result.Expected)
+	require.InDelta(t, 0.6, result.Ratio, 0.001)
+	require.Equal(t, "ok", result.Verdict)
+
+	result = &BenchResult{Name: benchSlotToCid, Ops: 100, OpsPerSec: 12_000}
+	compareWithBaseline(result, "nvme", 4)
+	require.Equal(t, "slow", result.Verdict)
+
+	result = &BenchResult{Name: benchNodeReads, Ops: 100, OpsPerSec: 50}
+	compareWithBaseline(result, "ssd", 1)
+	require.Equal(t, "very slow", result.Verdict)
+
+	result = &BenchResult{Name: benchNodeReads}
+	compareWithBaseline(result, "ssd", 1)
+	require.Equal(t, "FAILED", result.Verdict)
+
+	skipped := &BenchResult{Name: benchBlockAssembly, Skipped: "no block"}
+	compareWithBaseline(skipped, "ssd", 1)
+	require.Empty(t, skipped.Verdict)
+
+	var out bytes.Buffer
+	require.NoError(t, printBenchResults(&out, []*BenchResult{result, skipped}, BenchConfig{Baseline: "ssd", Workers: 1, Duration: time.Second}))
+	require.Contains(t, out.String(), "skipped: no block")
+	require.Contains(t, out.String(), "FAILED")
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"golang.org/x/sync/errgroup"
+)
+
+// assembledBlock is what getBlock reads from the DAG of a block (its entries, transactions and
+// rewards), before it's rendered in the requested encoding; it's shared by all the requests for
+// the block, whatever their params, and must not be modified.
+type assembledBlock struct {
+	// transactionNodes are the transactions of the block, in the order of its entries.
+	transactionNodes []*ipldbindcode.Transaction
+	lastEntryHash    solana.Hash
+	// rewards are the uncompressed rewards of the block (nil if it has none);
+	// they're only read for the requests that want them.
+	rewards       []byte
+	rewardsLoaded bool
+	size          int
+}
+
+// BlockAssemblyCache is an LRU cache of the assembled blocks, keyed by block CID, so that the
+// requests for the same block with different encodings or options (which are different entries
+// of the ResponseCache) walk its DAG only once. The blocks are immutable, so the entries
+// never need to be invalidated. Its methods are safe to call concurrently, and on a nil cache.
+type BlockAssemblyCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	ll       *list.List
+	entries  map[cid.Cid]*list.Element
+}
+
+type blockAssemblyCacheEntry struct {
+	blockCid cid.Cid
+	block    *assembledBlock
+}
+
+func NewBlockAssemblyCache(maxSizeMB int) (*BlockAssemblyCache, error) {
+	if maxSizeMB <= 0 {
+		return nil, fmt.Errorf("block assembly cache size must be positive")
+	}
+	return &BlockAssemblyCache{
+		maxBytes: maxSizeMB * 1024 * 1024,
+		ll:       list.New(),
+		entries:  make(map[cid.Cid]*list.Element),
+	}, nil
+}
+
+// Get returns the assembled block.
+func (c *BlockAssemblyCache) Get(blockCid cid.Cid) (*assembledBlock, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[blockCid]
+	if !ok {
+		metrics_blockAssemblyCache.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	metrics_blockAssemblyCache.WithLabelValues("hit").Inc()
+	return elem.Value.(*blockAssemblyCacheEntry).block, true
+}
+
+// Put caches the assembled block (replacing the previous one, e.g. without the rewards), and
+// evicts the least recently used blocks above the max size; blocks bigger than a tenth of the
+// cache are not cached.
+func (c *BlockAssemblyCache) Put(blockCid cid.Cid, block *assembledBlock) {
+	if c == nil {
+		return
+	}
+	if block.size > c.maxBytes/10 {
+		metrics_blockAssemblyCache.WithLabelValues("too_big").Inc()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[blockCid]; ok {
+		entry := elem.Value.(*blockAssemblyCacheEntry)
+		c.size += block.size - entry.block.size
+		entry.block = block
+		c.ll.MoveToFront(elem)
+	} else {
+		c.entries[blockCid] = c.ll.PushFront(&blockAssemblyCacheEntry{blockCid: blockCid, block: block})
+		c.size += block.size
+	}
+	for c.size > c.maxBytes {
+		oldest := c.ll.Back()
+		entry := oldest.Value.(*blockAssemblyCacheEntry)
+		c.ll.Remove(oldest)
+		delete(c.entries, entry.blockCid)
+		c.size -= entry.block.size
+		metrics_blockAssemblyCache.WithLabelValues("evicted").Inc()
+	}
+}
+
+// Len returns the number of cached blocks.
+func (c *BlockAssemblyCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// isBlockAssembled returns whether the block is in the cache (with its rewards, if wanted).
+func (multi *MultiEpoch) isBlockAssembled(blockCid cid.Cid, withRewards bool) bool {
+	if multi.options == nil || multi.options.BlockAssemblyCache == nil {
+		return false
+	}
+	assembled, ok := multi.options.BlockAssemblyCache.Get(blockCid)
+	return ok && (!withRewards || assembled.rewardsLoaded)
+}
+
+// getAssembledBlock returns the transactions and the last entry hash of the block, and its
+// rewards if wanted, from the cache or else from the DAG of the block.
+func (multi *MultiEpoch) getAssembledBlock(
+	ctx context.Context,
+	epochHandler *Epoch,
+	block *ipldbindcode.Block,
+	blockCid cid.Cid,
+	withRewards bool,
+) (*assembledBlock, error) {
+	var cache *BlockAssemblyCache
+	if multi.options != nil {
+		cache = multi.options.BlockAssemblyCache
+	}
+	assembled, ok := cache.Get(blockCid)
+	if ok && (!withRewards || assembled.rewardsLoaded) {
+		return assembled, nil
+	}
+	// the rewards and the transactions are separate subtrees of the block: they're read concurrently,
+	// which matters for the epoch-boundary blocks, with a lot of rewards.
+	var rewards []byte
+	wg := new(errgroup.Group)
+	if !ok {
+		wg.Go(func() (err error) {
+			defer recoverPanic("dag_worker", &err)
+			assembled, err = assembleBlock(ctx, epochHandler, block)
+			return err
+		})
+	}
+	if withRewards {
+		wg.Go(func() (err error) {
+			defer recoverPanic("dag_worker", &err)
+			rewards, err = loadBlockRewards(ctx, epochHandler, block)
+			return err
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	if withRewards {
+		// a copy: the cached block is shared.
+		withLoadedRewards := *assembled
+		withLoadedRewards.rewards = rewards
+		withLoadedRewards.rewardsLoaded = true
+		withLoadedRewards.size += len(rewards)
+		assembled = &withLoadedRewards
+	}
+	cache.Put(blockCid, assembled)
+	return assembled, nil
+}
+
+// assembleBlock reads the entries and the transactions of the block.
+func assembleBlock(ctx context.Context, epochHandler *Epoch, block *ipldbindcode.Block) (*assembledBlock, error) {
+	assembled := &assembledBlock{}
+	// get entries from the block
+	entryCids := make([]cid.Cid, len(block.Entries))
+	for entryIndex, entry := range block.Entries {
+		entryCids[entryIndex] = entry.(cidlink.Link).Cid
+	}
+	entryNodes, err := epochHandler.GetEntriesByCids(ctx, entryCids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entries: %v", err)
+	}
+	if len(entryNodes) > 0 {
+		assembled.lastEntryHash = solana.HashFromBytes(entryNodes[len(entryNodes)-1].Hash)
+	}
+
+	// get the transactions from all the entries with a single batch
+	txCids := make([]cid.Cid, 0)
+	for _, entryNode := range entryNodes {
+		for _, tx := range entryNode.Transactions {
+			txCids = append(txCids, tx.(cidlink.Link).Cid)
+		}
+	}
+	txNodes, err := epochHandler.GetTransactionsByCids(ctx, txCids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %v", err)
+	}
+	assembled.transactionNodes = make([]*ipldbindcode.Transaction, 0, len(txNodes))
+	for _, txNode := range txNodes {
+		if txNode == nil {
+			// not readable (logged by GetTransactionsByCids): the block is served without it.
+			continue
+		}
+		assembled.transactionNodes = append(assembled.transactionNodes, txNode)
+		assembled.size += len(txNode.Data.Data) + len(txNode.Metadata.Data)
+	}
+	return assembled, nil
+}
+
+// countBlockTransactions returns the number of transactions of the block, from the cache or
+// else from its entries, without reading the transactions.
+func (multi *MultiEpoch) countBlockTransactions(ctx context.Context, epochHandler *Epoch, block *ipldbindcode.Block, blockCid cid.Cid) (int, error) {
+	if multi.options != nil {
+		if assembled, ok := multi.options.BlockAssemblyCache.Get(blockCid); ok {
+			return len(assembled.transactionNodes), nil
+		}
+	}
+	entryCids := make([]cid.Cid, len(block.Entries))
+	for entryIndex, entry := range block.Entries {
+		entryCids[entryIndex] = entry.(cidlink.Link).Cid
+	}
+	entryNodes, err := epochHandler.GetEntriesByCids(ctx, entryCids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get entries: %v", err)
+	}
+	numTransactions := 0
+	for _, entryNode := range entryNodes {
+		numTransactions += len(entryNode.Transactions)
+	}
+	return numTransactions, nil
+}
+
+// loadBlockRewards reads and decompresses the rewards of the block; nil if it has none.
+func loadBlockRewards(ctx context.Context, epochHandler *Epoch, block *ipldbindcode.Block) ([]byte, error) {
+	rewardsCid := block.Rewards.(cidlink.Link).Cid
+	if rewardsCid.Equals(DummyCID) {
+		return nil, nil
+	}
+	rewardsNode, err := epochHandler.GetRewardsByCid(ctx, rewardsCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode Rewards: %v", err)
+	}
+	rewardsBuf, err := loadDataFromDataFrames(ctx, &rewardsNode.Data, epochHandler.GetDataFrameByCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Rewards dataFrames: %v", err)
+	}
+
+	startedDecodingAt := time.Now()
+	uncompressedRewards, err := decompressZstd(rewardsBuf)
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress Rewards: %v", err)
+	}
+	return uncompressedRewards, nil
+}
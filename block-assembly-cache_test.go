@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockAssemblyCache(t *testing.T) {
+	cache, err := NewBlockAssemblyCache(1)
+	require.NoError(t, err)
+	blockCid := func(i int) cid.Cid {
+		return cid.NewCidV1(cid.DagCBOR, []byte{byte(i)})
+	}
+	block := func(size int) *assembledBlock {
+		return &assembledBlock{size: size}
+	}
+
+	_, ok := cache.Get(blockCid(0))
+	require.False(t, ok)
+
+	first := block(50_000)
+	cache.Put(blockCid(0), first)
+	got, ok := cache.Get(blockCid(0))
+	require.True(t, ok)
+	require.Same(t, first, got)
+
+	// replaced, e.g. with the rewards.
+	withRewards := block(60_000)
+	withRewards.rewardsLoaded = true
+	cache.Put(blockCid(0), withRewards)
+	got, ok = cache.Get(blockCid(0))
+	require.True(t, ok)
+	require.True(t, got.rewardsLoaded)
+	require.Equal(t, 1, cache.Len())
+
+	// the least recently used blocks are evicted.
+	for i := 1; i <= 20; i++ {
+		cache.Put(blockCid(i), block(60_000))
+		_, ok = cache.Get(blockCid(0))
+		require.True(t, ok)
+	}
+	require.Equal(t, 17, cache.Len())
+	_, ok = cache.Get(blockCid(1))
+	require.False(t, ok)
+	_, ok = cache.Get(blockCid(20))
+	require.True(t, ok)
+
+	// too big.
+	cache.Put(blockCid(21), block(200_000))
+	_, ok = cache.Get(blockCid(21))
+	require.False(t, ok)
+
+	// disabled.
+	var disabled *BlockAssemblyCache
+	disabled.Put(blockCid(0), first)
+	_, ok = disabled.Get(blockCid(0))
+	require.False(t, ok)
+
+	_, err = NewBlockAssemblyCache(0)
+	require.Error(t, err)
+}
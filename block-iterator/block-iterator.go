@@ -0,0 +1,255 @@
+package blockiterator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/util"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/readahead"
+)
+
+// Object is a raw node read from the CAR.
+type Object struct {
+	Cid    cid.Cid
+	Offset uint64 // offset of the section in the CAR
+	Size   uint64 // size of the whole section (length prefix + CID + data)
+	Data   []byte
+}
+
+// Block is a block, together with all the nodes that were written
+// to the CAR right before it (entries, transactions, dataframes, rewards).
+type Block struct {
+	Object
+	Block *ipldbindcode.Block
+	// Objects are the nodes of the block DAG, in the order in which they appear in the CAR.
+	Objects []Object
+}
+
+// Slot returns the slot of the block.
+func (b *Block) Slot() uint64 {
+	return uint64(b.Block.Slot)
+}
+
+type Options struct {
+	// FirstSlot and LastSlot (inclusive) limit the iteration to the given slot range.
+	// If LastSlot is nil, there is no upper limit.
+	FirstSlot uint64
+	LastSlot  *uint64
+	// StartOffset is the offset in the CAR where to start reading from; it must be
+	// the offset of a section that starts a block DAG (i.e. right after the end of a block);
+	// use it (resolved via the indexes) to avoid reading the CAR from the beginning
+	// when the FirstSlot is far into the epoch.
+	// If 0, the reading starts right after the CAR header.
+	StartOffset uint64
+	// ChunkSize is the size of the sequential reads; defaults to readahead.DefaultChunkSize.
+	ChunkSize int
+}
+
+// Iterator walks the blocks of a CAR in slot order, with large sequential reads.
+// The CAR is expected to be laid out like the CARs produced by the faithful tooling,
+// i.e. with each block written after all the nodes of its DAG, and blocks written in slot order.
+type Iterator struct {
+	file      io.Closer
+	br        *bufio.Reader
+	offset    uint64
+	opts      Options
+	headerLen uint64
+	done      bool
+}
+
+// Open opens the CAR file at the given path for iteration.
+func Open(carPath string, opts *Options) (*Iterator, error) {
+	file, err := os.Open(carPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CAR file: %w", err)
+	}
+	it, err := NewFromReader(file, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return it, nil
+}
+
+// NewFromReader creates a new iterator that reads from the given CAR(v1) reader.
+func NewFromReader(r io.ReadSeekCloser, opts *Options) (*Iterator, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.LastSlot != nil && opts.FirstSlot > *opts.LastSlot {
+		return nil, fmt.Errorf("invalid slot range: %d > %d", opts.FirstSlot, *opts.LastSlot)
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = readahead.DefaultChunkSize
+	}
+	it := &Iterator{
+		file: r,
+		br:   bufio.NewReaderSize(r, chunkSize),
+		opts: *opts,
+	}
+	// Skip the CAR header.
+	headerLen, prefixLen, err := readSectionLength(it.br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR header length: %w", err)
+	}
+	if _, err := it.br.Discard(int(headerLen)); err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+	it.headerLen = headerLen + prefixLen
+	it.offset = it.headerLen
+	if opts.StartOffset > it.offset {
+		if _, err := r.Seek(int64(opts.StartOffset), io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek to offset %d: %w", opts.StartOffset, err)
+		}
+		it.br.Reset(r)
+		it.offset = opts.StartOffset
+	}
+	return it, nil
+}
+
+// HeaderSize returns the size of the CAR header (including its length prefix).
+func (it *Iterator) HeaderSize() uint64 {
+	return it.headerLen
+}
+
+// Next returns the next block; io.EOF is returned when there are no more blocks
+// in the CAR, or in the requested slot range.
+func (it *Iterator) Next() (*Block, error) {
+	if it.done {
+		return nil, io.EOF
+	}
+	objects := make([]Object, 0)
+	for {
+		obj, err := it.readObject()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				it.done = true
+			}
+			return nil, err
+		}
+		kind, err := iplddecoders.GetKind(obj.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kind of node %s at offset %d: %w", obj.Cid, obj.Offset, err)
+		}
+		switch kind {
+		case iplddecoders.KindBlock:
+			block, err := iplddecoders.DecodeBlock(obj.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode block %s at offset %d: %w", obj.Cid, obj.Offset, err)
+			}
+			slot := uint64(block.Slot)
+			if slot < it.opts.FirstSlot {
+				// not yet in range; drop the DAG and keep going.
+				objects = objects[:0]
+				continue
+			}
+			if it.opts.LastSlot != nil && slot > *it.opts.LastSlot {
+				it.done = true
+				return nil, io.EOF
+			}
+			return &Block{
+				Object:  obj,
+				Block:   block,
+				Objects: objects,
+			}, nil
+		case iplddecoders.KindSubset, iplddecoders.KindEpoch:
+			// These are not part of any block DAG.
+			continue
+		default:
+			objects = append(objects, obj)
+		}
+	}
+}
+
+// ForEach calls the callback for every block; iteration stops at the first error.
+func (it *Iterator) ForEach(callback func(*Block) error) error {
+	for {
+		block, err := it.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := callback(block); err != nil {
+			return err
+		}
+	}
+}
+
+// Close closes the underlying reader.
+func (it *Iterator) Close() error {
+	return it.file.Close()
+}
+
+func (it *Iterator) readObject() (Object, error) {
+	sectionLen, prefixLen, err := readSectionLength(it.br)
+	if err != nil {
+		return Object{}, err
+	}
+	cidLen, c, err := cid.CidFromReader(it.br)
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to read CID at offset %d: %w", it.offset, err)
+	}
+	if sectionLen < uint64(cidLen) {
+		return Object{}, fmt.Errorf("malformed car; section at offset %d has %d bytes, less than its %d-byte CID", it.offset, sectionLen, cidLen)
+	}
+	data := make([]byte, sectionLen-uint64(cidLen))
+	if _, err := io.ReadFull(it.br, data); err != nil {
+		return Object{}, fmt.Errorf("failed to read node at offset %d: %w", it.offset, err)
+	}
+	obj := Object{
+		Cid:    c,
+		Offset: it.offset,
+		Size:   prefixLen + sectionLen,
+		Data:   data,
+	}
+	it.offset += obj.Size
+	return obj, nil
+}
+
+type byteReaderWithCounter struct {
+	io.ByteReader
+	Offset uint64
+}
+
+func (b *byteReaderWithCounter) ReadByte() (byte, error) {
+	c, err := b.ByteReader.ReadByte()
+	if err == nil {
+		b.Offset++
+	}
+	return c, err
+}
+
+// readSectionLength returns the length of the next section, and the size of the length prefix.
+func readSectionLength(r *bufio.Reader) (uint64, uint64, error) {
+	if _, err := r.Peek(1); err != nil { // no more blocks, likely clean io.EOF
+		if errors.Is(err, io.ErrNoProgress) {
+			return 0, 0, io.EOF
+		}
+		return 0, 0, err
+	}
+
+	br := byteReaderWithCounter{r, 0}
+	l, err := binary.ReadUvarint(&br)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return 0, 0, io.ErrUnexpectedEOF // don't silently pretend this is a clean EOF
+		}
+		return 0, 0, err
+	}
+
+	if l > uint64(util.MaxAllowedSectionSize) { // Don't OOM
+		return 0, 0, errors.New("malformed car; section is bigger than util.MaxAllowedSectionSize")
+	}
+
+	return l, br.Offset, nil
+}
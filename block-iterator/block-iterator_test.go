@@ -0,0 +1,160 @@
+package blockiterator
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/util"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+type testCar struct {
+	buf bytes.Buffer
+}
+
+func newTestCar(t *testing.T) *testCar {
+	car := &testCar{}
+	require.NoError(t, util.LdWrite(&car.buf, []byte("fake-header")))
+	return car
+}
+
+func (car *testCar) offset() uint64 {
+	return uint64(car.buf.Len())
+}
+
+func (car *testCar) put(t *testing.T, v any, typ schema.Type) cid.Cid {
+	data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+	require.NoError(t, err)
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+	require.NoError(t, err)
+	require.NoError(t, util.LdWrite(&car.buf, c.Bytes(), data))
+	return c
+}
+
+// putBlock writes an entry and then the block that links to it.
+func (car *testCar) putBlock(t *testing.T, slot int) cid.Cid {
+	entryCid := car.put(t, &ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	return car.put(t, &ipldbindcode.Block{
+		Kind:      int(iplddecoders.KindBlock),
+		Slot:      slot,
+		Shredding: ipldbindcode.List__Shredding{},
+		Entries:   ipldbindcode.List__Link{cidlink.Link{Cid: entryCid}},
+		Rewards:   cidlink.Link{Cid: entryCid},
+	}, ipldbindcode.Prototypes.Block.Type())
+}
+
+func (car *testCar) putSubset(t *testing.T, first, last int, blocks ...cid.Cid) {
+	links := make(ipldbindcode.List__Link, 0, len(blocks))
+	for _, c := range blocks {
+		links = append(links, datamodel.Link(cidlink.Link{Cid: c}))
+	}
+	car.put(t, &ipldbindcode.Subset{
+		Kind:   int(iplddecoders.KindSubset),
+		First:  first,
+		Last:   last,
+		Blocks: links,
+	}, ipldbindcode.Prototypes.Subset.Type())
+}
+
+func (car *testCar) iterator(t *testing.T, opts *Options) *Iterator {
+	it, err := NewFromReader(nopCloser{bytes.NewReader(car.buf.Bytes())}, opts)
+	require.NoError(t, err)
+	return it
+}
+
+func collectSlots(t *testing.T, it *Iterator) []uint64 {
+	slots := make([]uint64, 0)
+	require.NoError(t, it.ForEach(func(b *Block) error {
+		require.Len(t, b.Objects, 1)
+		slots = append(slots, b.Slot())
+		return nil
+	}))
+	return slots
+}
+
+func TestIterator(t *testing.T) {
+	car := newTestCar(t)
+	b10 := car.putBlock(t, 10)
+	b11 := car.putBlock(t, 11)
+	car.putSubset(t, 10, 11, b10, b11)
+	startOf13 := car.offset()
+	b13 := car.putBlock(t, 13)
+	b14 := car.putBlock(t, 14)
+	car.putSubset(t, 13, 14, b13, b14)
+
+	t.Run("all", func(t *testing.T) {
+		it := car.iterator(t, nil)
+		require.Equal(t, []uint64{10, 11, 13, 14}, collectSlots(t, it))
+
+		_, err := it.Next()
+		require.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("slot range", func(t *testing.T) {
+		lastSlot := uint64(13)
+		it := car.iterator(t, &Options{FirstSlot: 11, LastSlot: &lastSlot})
+		require.Equal(t, []uint64{11, 13}, collectSlots(t, it))
+	})
+	t.Run("start offset", func(t *testing.T) {
+		it := car.iterator(t, &Options{StartOffset: startOf13})
+		block, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint64(13), block.Slot())
+		require.Equal(t, b13, block.Cid)
+		require.Equal(t, startOf13, block.Objects[0].Offset)
+	})
+	t.Run("invalid range", func(t *testing.T) {
+		lastSlot := uint64(1)
+		_, err := NewFromReader(nopCloser{bytes.NewReader(car.buf.Bytes())}, &Options{FirstSlot: 2, LastSlot: &lastSlot})
+		require.Error(t, err)
+	})
+}
+
+func TestIteratorMalformedSection(t *testing.T) {
+	car := newTestCar(t)
+	b10 := car.putBlock(t, 10)
+	// a section shorter than its CID.
+	require.NoError(t, util.LdWrite(&car.buf, b10.Bytes()[:4]))
+	car.buf.Write(b10.Bytes()[4:])
+
+	it := car.iterator(t, nil)
+	block, err := it.Next()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), block.Slot())
+	_, err = it.Next()
+	require.ErrorContains(t, err, "malformed car")
+}
+
+func TestIteratorSlotZero(t *testing.T) {
+	car := newTestCar(t)
+	b0 := car.putBlock(t, 0)
+	b1 := car.putBlock(t, 1)
+	car.putSubset(t, 0, 1, b0, b1)
+
+	// the range [0, 0] has an upper limit.
+	lastSlot := uint64(0)
+	it := car.iterator(t, &Options{LastSlot: &lastSlot})
+	require.Equal(t, []uint64{0}, collectSlots(t, it))
+
+	it = car.iterator(t, &Options{})
+	require.Equal(t, []uint64{0, 1}, collectSlots(t, it))
+}
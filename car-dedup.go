@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+)
+
+// carDedupKinds are the kinds of the nodes that can be identical across blocks
+// (e.g. the same large metadata in several transactions), and so are deduplicated.
+var carDedupKinds = []iplddecoders.Kind{
+	iplddecoders.KindDataFrame,
+	iplddecoders.KindRewards,
+}
+
+func isCarDedupKind(kind iplddecoders.Kind) bool {
+	for _, k := range carDedupKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type carDedupKindStats struct {
+	NumNodes       uint64
+	NumDuplicates  uint64
+	DuplicateBytes uint64
+}
+
+// carDedupReport is the result of the analysis (or the rewrite) of a CAR.
+type carDedupReport struct {
+	NumNodes  uint64
+	NumBytes  uint64
+	ByKind    map[iplddecoders.Kind]*carDedupKindStats
+	Rewritten bool
+	// Contents are the ones of the rewritten CAR (only when it's written).
+	Contents carContents
+}
+
+// NumDuplicates returns the number of duplicate nodes (the ones after the first occurrence).
+func (r *carDedupReport) NumDuplicates() uint64 {
+	var total uint64
+	for _, stats := range r.ByKind {
+		total += stats.NumDuplicates
+	}
+	return total
+}
+
+// DuplicateBytes returns the size of the sections of the duplicate nodes, i.e. what the rewrite saves.
+func (r *carDedupReport) DuplicateBytes() uint64 {
+	var total uint64
+	for _, stats := range r.ByKind {
+		total += stats.DuplicateBytes
+	}
+	return total
+}
+
+func (r *carDedupReport) String() string {
+	var b strings.Builder
+	kinds := make([]iplddecoders.Kind, 0, len(r.ByKind))
+	for kind := range r.ByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	fmt.Fprintf(&b, "%s nodes, %s\n", humanize.Comma(int64(r.NumNodes)), humanize.Bytes(r.NumBytes))
+	for _, kind := range kinds {
+		stats := r.ByKind[kind]
+		fmt.Fprintf(
+			&b,
+			"  %s: %s nodes, %s duplicates (%s)\n",
+			kind,
+			humanize.Comma(int64(stats.NumNodes)),
+			humanize.Comma(int64(stats.NumDuplicates)),
+			humanize.Bytes(stats.DuplicateBytes),
+		)
+	}
+	verb := "Potential savings"
+	if r.Rewritten {
+		verb = "Saved"
+	}
+	var percent float64
+	if r.NumBytes > 0 {
+		percent = float64(r.DuplicateBytes()) / float64(r.NumBytes) * 100
+	}
+	fmt.Fprintf(&b, "%s: %s (%.2f%%)", verb, humanize.Bytes(r.DuplicateBytes()), percent)
+	return b.String()
+}
+
+// dedupCar finds the identical (i.e. with the same CID) DataFrame and Rewards nodes of the CAR read from r;
+// if w is not nil, the CAR is written to it with only the first occurrence of each of them.
+// The other nodes are written as they are, in the same order: since a node is always before the nodes
+// that link to it, the first occurrence of a duplicate node is before all the nodes that link to it.
+func dedupCar(ctx context.Context, r io.Reader, w io.Writer) (*carDedupReport, error) {
+	rd, err := newCarReader(io.NopCloser(r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open car: %w", err)
+	}
+	if w != nil {
+		if err := carv1.WriteHeader(rd.header, w); err != nil {
+			return nil, fmt.Errorf("failed to write car header: %w", err)
+		}
+	}
+	report := &carDedupReport{
+		ByKind:    make(map[iplddecoders.Kind]*carDedupKindStats),
+		Rewritten: w != nil,
+	}
+	for _, kind := range carDedupKinds {
+		report.ByKind[kind] = &carDedupKindStats{}
+	}
+	if len(rd.header.Roots) == 1 {
+		report.Contents.Root = rd.header.Roots[0]
+	}
+	seen := make(map[string]struct{})
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c, sectionLen, data, err := readNodeInfoWithData(rd.br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		report.NumNodes++
+		report.NumBytes += sectionLen
+		kind, err := iplddecoders.GetKind(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get kind of node %s: %w", c, err)
+		}
+		if isCarDedupKind(kind) {
+			stats := report.ByKind[kind]
+			stats.NumNodes++
+			key := c.KeyString()
+			if _, ok := seen[key]; ok {
+				stats.NumDuplicates++
+				stats.DuplicateBytes += sectionLen
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		if w != nil {
+			if err := util.LdWrite(w, c.Bytes(), data); err != nil {
+				return nil, fmt.Errorf("failed to write node %s: %w", c, err)
+			}
+			if err := report.Contents.observe(kind, data); err != nil {
+				return nil, fmt.Errorf("node %s: %w", c, err)
+			}
+		}
+	}
+	return report, nil
+}
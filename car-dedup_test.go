@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+func putTestNode(t *testing.T, buf *bytes.Buffer, v any, typ schema.Type) cid.Cid {
+	data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+	require.NoError(t, err)
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+	require.NoError(t, err)
+	require.NoError(t, util.LdWrite(buf, c.Bytes(), data))
+	return c
+}
+
+func TestDedupCar(t *testing.T) {
+	var car bytes.Buffer
+	root, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum([]byte("root"))
+	require.NoError(t, err)
+	require.NoError(t, carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &car))
+
+	frame := func(data string) *ipldbindcode.DataFrame {
+		return &ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: []byte(data)}
+	}
+	frameType := ipldbindcode.Prototypes.DataFrame.Type()
+	rewardsType := ipldbindcode.Prototypes.Rewards.Type()
+	putTestNode(t, &car, frame("same"), frameType)
+	putTestNode(t, &car, frame("other"), frameType)
+	putTestNode(t, &car, &ipldbindcode.Rewards{Kind: int(iplddecoders.KindRewards), Slot: 1, Data: *frame("")}, rewardsType)
+	putTestNode(t, &car, frame("same"), frameType)
+	putTestNode(t, &car, &ipldbindcode.Rewards{Kind: int(iplddecoders.KindRewards), Slot: 1, Data: *frame("")}, rewardsType)
+
+	report, err := dedupCar(context.Background(), bytes.NewReader(car.Bytes()), nil)
+	require.NoError(t, err)
+	require.False(t, report.Rewritten)
+	require.Equal(t, uint64(5), report.NumNodes)
+	require.Equal(t, uint64(2), report.NumDuplicates())
+	require.Equal(t, &carDedupKindStats{NumNodes: 3, NumDuplicates: 1, DuplicateBytes: report.ByKind[iplddecoders.KindDataFrame].DuplicateBytes}, report.ByKind[iplddecoders.KindDataFrame])
+	require.Equal(t, uint64(1), report.ByKind[iplddecoders.KindRewards].NumDuplicates)
+
+	var out bytes.Buffer
+	rewritten, err := dedupCar(context.Background(), bytes.NewReader(car.Bytes()), &out)
+	require.NoError(t, err)
+	require.True(t, rewritten.Rewritten)
+	require.Equal(t, report.DuplicateBytes(), uint64(car.Len()-out.Len()))
+
+	// the new CAR has the same header, and no duplicates.
+	again, err := dedupCar(context.Background(), bytes.NewReader(out.Bytes()), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), again.NumNodes)
+	require.Zero(t, again.NumDuplicates())
+	header, err := readHeader(bytes.NewReader(out.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{root}, header.Roots)
+}
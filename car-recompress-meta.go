@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+)
+
+// carRecompressStats are the before/after statistics of the recompression of the metadata of a CAR.
+type carRecompressStats struct {
+	NumTransactions uint64
+	NumRecompressed uint64
+	// NumSkipped is the number of metadata that are split in multiple DataFrames
+	// (which are left as they are).
+	NumSkipped       uint64
+	UncompressedSize uint64
+	SizeBefore       uint64
+	SizeAfter        uint64
+	// DecodeBefore and DecodeAfter are the time spent decompressing the metadata,
+	// i.e. the CPU cost of serving them.
+	DecodeBefore  time.Duration
+	DecodeAfter   time.Duration
+	CarSizeBefore uint64
+	CarSizeAfter  uint64
+	NewRoot       cid.Cid
+	// Contents are the ones of the new CAR.
+	Contents carContents
+}
+
+func (s *carRecompressStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Transactions: %s (%s metadata recompressed, %s skipped because they are split in multiple frames)\n",
+		humanize.Comma(int64(s.NumTransactions)),
+		humanize.Comma(int64(s.NumRecompressed)),
+		humanize.Comma(int64(s.NumSkipped)),
+	)
+	fmt.Fprintf(&b, "Metadata: %s uncompressed\n", humanize.Bytes(s.UncompressedSize))
+	fmt.Fprintf(&b, "  before: %s (ratio %.2f), decompressed in %s\n", humanize.Bytes(s.SizeBefore), ratio(s.UncompressedSize, s.SizeBefore), s.DecodeBefore)
+	fmt.Fprintf(&b, "  after:  %s (ratio %.2f), decompressed in %s\n", humanize.Bytes(s.SizeAfter), ratio(s.UncompressedSize, s.SizeAfter), s.DecodeAfter)
+	if s.CarSizeBefore > 0 {
+		fmt.Fprintf(&b, "CAR: %s -> %s\n", humanize.Bytes(s.CarSizeBefore), humanize.Bytes(s.CarSizeAfter))
+	}
+	if s.NewRoot.Defined() {
+		fmt.Fprintf(&b, "New root CID: %s", s.NewRoot)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func ratio(uncompressed, compressed uint64) float64 {
+	if compressed == 0 {
+		return 0
+	}
+	return float64(uncompressed) / float64(compressed)
+}
+
+// metaRecompressor recompresses the metadata of the transactions of a CAR, and rewrites the nodes
+// that link (directly or not) to the transactions that changed, since their CIDs change too:
+// the entries, blocks, subsets and the epoch (so the CAR has a new root).
+//
+// The CAR is processed in one pass, since a node is always after the nodes it links to;
+// only the new CIDs of the nodes that are not yet linked (e.g. the blocks of the current subset)
+// are kept in memory.
+type metaRecompressor struct {
+	encoder *zstd.Encoder
+	stats   carRecompressStats
+	// newCids are the new CIDs of the rewritten nodes, until they are linked.
+	newCids map[cid.Cid]cid.Cid
+	// blockNodes are the nodes of the current block in newCids, forgotten once the block is written.
+	blockNodes []cid.Cid
+}
+
+func newMetaRecompressor(level int, dict []byte) (*metaRecompressor, error) {
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+	}
+	if len(dict) > 0 {
+		opts = append(opts, zstd.WithEncoderDict(dict))
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	return &metaRecompressor{
+		encoder: encoder,
+		newCids: make(map[cid.Cid]cid.Cid),
+	}, nil
+}
+
+// recompress reads the CAR from r and writes the new one to w; the header of the new CAR still has
+// the old root (which is only known at the end), so it must be replaced with rewriteCarHeaderRoot.
+func (m *metaRecompressor) recompress(ctx context.Context, r io.Reader, w io.Writer) (*carRecompressStats, *carv1.CarHeader, error) {
+	rd, err := newCarReader(io.NopCloser(r))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open car: %w", err)
+	}
+	if err := carv1.WriteHeader(rd.header, w); err != nil {
+		return nil, nil, fmt.Errorf("failed to write car header: %w", err)
+	}
+	if len(rd.header.Roots) != 1 {
+		return nil, nil, fmt.Errorf("car has %d roots, expected 1", len(rd.header.Roots))
+	}
+	oldRoot := rd.header.Roots[0]
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		c, sectionLen, data, err := readNodeInfoWithData(rd.br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		m.stats.CarSizeBefore += sectionLen
+		newCid, newData, err := m.rewriteNode(c, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to rewrite node %s: %w", c, err)
+		}
+		if err := util.LdWrite(w, newCid.Bytes(), newData); err != nil {
+			return nil, nil, fmt.Errorf("failed to write node %s: %w", newCid, err)
+		}
+		m.stats.CarSizeAfter += uint64(util.LdSize(newCid.Bytes(), newData))
+		if kind, err := iplddecoders.GetKind(newData); err == nil {
+			if err := m.stats.Contents.observe(kind, newData); err != nil {
+				return nil, nil, fmt.Errorf("node %s: %w", newCid, err)
+			}
+		}
+	}
+	m.stats.NewRoot = oldRoot
+	if newRoot, ok := m.newCids[oldRoot]; ok {
+		m.stats.NewRoot = newRoot
+	}
+	m.stats.Contents.Root = m.stats.NewRoot
+	return &m.stats, rd.header, nil
+}
+
+// rewriteNode returns the node as it must be written to the new CAR.
+func (m *metaRecompressor) rewriteNode(c cid.Cid, data []byte) (cid.Cid, []byte, error) {
+	kind, err := iplddecoders.GetKind(data)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	switch kind {
+	case iplddecoders.KindTransaction:
+		tx, err := iplddecoders.DecodeTransaction(data)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		m.stats.NumTransactions++
+		changed, err := m.recompressMeta(tx)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		if !changed {
+			return c, data, nil
+		}
+		return m.encode(c, tx, ipldbindcode.Prototypes.Transaction.Type(), true)
+	case iplddecoders.KindEntry:
+		entry, err := iplddecoders.DecodeEntry(data)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		if !m.relink(entry.Transactions) {
+			return c, data, nil
+		}
+		return m.encode(c, entry, ipldbindcode.Prototypes.Entry.Type(), true)
+	case iplddecoders.KindBlock:
+		block, err := iplddecoders.DecodeBlock(data)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		changed := m.relink(block.Entries)
+		// the nodes of the block are not linked by the next blocks (even if they are not linked by this one).
+		for _, nodeCid := range m.blockNodes {
+			delete(m.newCids, nodeCid)
+		}
+		m.blockNodes = m.blockNodes[:0]
+		if !changed {
+			return c, data, nil
+		}
+		return m.encode(c, block, ipldbindcode.Prototypes.Block.Type(), false)
+	case iplddecoders.KindSubset:
+		subset, err := iplddecoders.DecodeSubset(data)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		changed := m.relink(subset.Blocks)
+		if !changed {
+			return c, data, nil
+		}
+		return m.encode(c, subset, ipldbindcode.Prototypes.Subset.Type(), false)
+	case iplddecoders.KindEpoch:
+		epoch, err := iplddecoders.DecodeEpoch(data)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		changed := m.relink(epoch.Subsets)
+		if !changed {
+			return c, data, nil
+		}
+		return m.encode(c, epoch, ipldbindcode.Prototypes.Epoch.Type(), false)
+	default:
+		// DataFrames and Rewards don't link to nodes that change.
+		return c, data, nil
+	}
+}
+
+// recompressMeta recompresses the metadata of the transaction, if it's in a single frame.
+func (m *metaRecompressor) recompressMeta(tx *ipldbindcode.Transaction) (bool, error) {
+	if len(tx.Metadata.Data) == 0 {
+		return false, nil
+	}
+	if tx.Metadata.HasNext() {
+		m.stats.NumSkipped++
+		return false, nil
+	}
+	startedAt := time.Now()
+	uncompressed, err := decompressZstd(tx.Metadata.Data)
+	if err != nil {
+		return false, fmt.Errorf("failed to decompress metadata: %w", err)
+	}
+	m.stats.DecodeBefore += time.Since(startedAt)
+	recompressed := m.encoder.EncodeAll(uncompressed, nil)
+
+	// check that the new metadata decompress to the same data.
+	startedAt = time.Now()
+	check, err := decompressZstd(recompressed)
+	if err != nil {
+		return false, fmt.Errorf("failed to decompress the recompressed metadata: %w", err)
+	}
+	m.stats.DecodeAfter += time.Since(startedAt)
+	if !bytes.Equal(check, uncompressed) {
+		return false, fmt.Errorf("recompressed metadata don't match the original ones")
+	}
+
+	m.stats.NumRecompressed++
+	m.stats.UncompressedSize += uint64(len(uncompressed))
+	m.stats.SizeBefore += uint64(len(tx.Metadata.Data))
+	m.stats.SizeAfter += uint64(len(recompressed))
+	tx.Metadata.Data = recompressed
+	if tx.Metadata.HasHash() {
+		hash := int(ipldbindcode.Checksum(recompressed))
+		p := &hash
+		tx.Metadata.Hash = &p
+	}
+	return true, nil
+}
+
+// relink replaces the links to the rewritten nodes with their new CIDs, and returns true if any changed;
+// the new CIDs are then forgotten, since a node is linked only once.
+func (m *metaRecompressor) relink(links ipldbindcode.List__Link) bool {
+	changed := false
+	for i, link := range links {
+		cl, ok := link.(cidlink.Link)
+		if !ok {
+			continue
+		}
+		if newCid, ok := m.newCids[cl.Cid]; ok {
+			links[i] = cidlink.Link{Cid: newCid}
+			delete(m.newCids, cl.Cid)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// encode encodes the rewritten node, with a CID of the same type as the old one.
+func (m *metaRecompressor) encode(oldCid cid.Cid, v any, typ schema.Type, inBlock bool) (cid.Cid, []byte, error) {
+	data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to encode node: %w", err)
+	}
+	newCid, err := oldCid.Prefix().Sum(data)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to compute CID: %w", err)
+	}
+	m.newCids[oldCid] = newCid
+	if inBlock {
+		m.blockNodes = append(m.blockNodes, oldCid)
+	}
+	return newCid, data, nil
+}
+
+// rewriteCarHeaderRoot replaces the root in the header written at the start of w;
+// the new header must have the same size, which is the case if the CIDs have the same type.
+func rewriteCarHeaderRoot(w io.WriterAt, header *carv1.CarHeader, newRoot cid.Cid) error {
+	var oldBuf, newBuf bytes.Buffer
+	if err := carv1.WriteHeader(header, &oldBuf); err != nil {
+		return err
+	}
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{newRoot}, Version: header.Version}, &newBuf); err != nil {
+		return err
+	}
+	if oldBuf.Len() != newBuf.Len() {
+		return fmt.Errorf("the new header has a different size: %d != %d", newBuf.Len(), oldBuf.Len())
+	}
+	_, err := w.WriteAt(newBuf.Bytes(), 0)
+	return err
+}
+
+// dumpMetaSamples writes up to maxSamples uncompressed metadata of the CAR to the dir (one file each),
+// to train a dictionary, e.g. with `zstd --train <dir>/* -o meta.dict`.
+func dumpMetaSamples(ctx context.Context, r io.Reader, dir string, maxSamples int) (int, error) {
+	rd, err := newCarReader(io.NopCloser(r))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open car: %w", err)
+	}
+	numSamples := 0
+	for numSamples < maxSamples {
+		if err := ctx.Err(); err != nil {
+			return numSamples, err
+		}
+		c, _, data, err := readNodeInfoWithData(rd.br)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return numSamples, err
+		}
+		if kind, err := iplddecoders.GetKind(data); err != nil || kind != iplddecoders.KindTransaction {
+			continue
+		}
+		tx, err := iplddecoders.DecodeTransaction(data)
+		if err != nil {
+			return numSamples, fmt.Errorf("failed to decode transaction %s: %w", c, err)
+		}
+		if len(tx.Metadata.Data) == 0 || tx.Metadata.HasNext() {
+			continue
+		}
+		uncompressed, err := decompressZstd(tx.Metadata.Data)
+		if err != nil {
+			return numSamples, fmt.Errorf("failed to decompress metadata of transaction %s: %w", c, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("meta-%08d", numSamples)), uncompressed, 0o644); err != nil {
+			return numSamples, err
+		}
+		numSamples++
+	}
+	return numSamples, nil
+}
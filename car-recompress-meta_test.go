@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEpochCar returns a CAR with one transaction (with the given metadata, compressed at level 1)
+// in one entry, block and subset.
+func newTestEpochCar(t *testing.T, meta []byte) []byte {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	require.NoError(t, err)
+	var nodes bytes.Buffer
+	txCid := putTestNode(t, &nodes, &ipldbindcode.Transaction{
+		Kind:     int(iplddecoders.KindTransaction),
+		Data:     ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: []byte("tx")},
+		Metadata: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: encoder.EncodeAll(meta, nil)},
+		Slot:     1,
+	}, ipldbindcode.Prototypes.Transaction.Type())
+	entryCid := putTestNode(t, &nodes, &ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{cidlink.Link{Cid: txCid}},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	rewardsCid := putTestNode(t, &nodes, &ipldbindcode.Rewards{
+		Kind: int(iplddecoders.KindRewards),
+		Slot: 1,
+		Data: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame)},
+	}, ipldbindcode.Prototypes.Rewards.Type())
+	blockCid := putTestNode(t, &nodes, &ipldbindcode.Block{
+		Kind:      int(iplddecoders.KindBlock),
+		Slot:      1,
+		Shredding: ipldbindcode.List__Shredding{},
+		Entries:   ipldbindcode.List__Link{cidlink.Link{Cid: entryCid}},
+		Rewards:   cidlink.Link{Cid: rewardsCid},
+	}, ipldbindcode.Prototypes.Block.Type())
+	subsetCid := putTestNode(t, &nodes, &ipldbindcode.Subset{
+		Kind:   int(iplddecoders.KindSubset),
+		First:  1,
+		Last:   1,
+		Blocks: ipldbindcode.List__Link{cidlink.Link{Cid: blockCid}},
+	}, ipldbindcode.Prototypes.Subset.Type())
+	epochCid := putTestNode(t, &nodes, &ipldbindcode.Epoch{
+		Kind:    int(iplddecoders.KindEpoch),
+		Subsets: ipldbindcode.List__Link{cidlink.Link{Cid: subsetCid}},
+	}, ipldbindcode.Prototypes.Epoch.Type())
+
+	var car bytes.Buffer
+	require.NoError(t, carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{epochCid}, Version: 1}, &car))
+	car.Write(nodes.Bytes())
+	return car.Bytes()
+}
+
+func TestRecompressCarMeta(t *testing.T) {
+	meta := bytes.Repeat([]byte("some transaction metadata; "), 100)
+	car := newTestEpochCar(t, meta)
+	oldHeader, err := readHeader(bytes.NewReader(car))
+	require.NoError(t, err)
+
+	recompressor, err := newMetaRecompressor(19, nil)
+	require.NoError(t, err)
+	outPath := filepath.Join(t.TempDir(), "out.car")
+	stats, err := recompressCarMetaToFile(context.Background(), recompressor, bytes.NewReader(car), outPath)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.NumTransactions)
+	require.Equal(t, uint64(1), stats.NumRecompressed)
+	require.Equal(t, uint64(len(meta)), stats.UncompressedSize)
+	require.NotEqual(t, oldHeader.Roots[0], stats.NewRoot)
+
+	out, err := os.ReadFile(outPath)
+	require.NoError(t, err)
+	header, err := readHeader(bytes.NewReader(out))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{stats.NewRoot}, header.Roots)
+
+	// all the links point to nodes of the new CAR, and the metadata are the same.
+	nodes := make(map[cid.Cid][]byte)
+	r := bufio.NewReader(bytes.NewReader(out))
+	_, err = util.LdRead(r)
+	require.NoError(t, err)
+	for {
+		c, data, err := util.ReadNode(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		nodes[c] = data
+	}
+	epoch, err := iplddecoders.DecodeEpoch(nodes[stats.NewRoot])
+	require.NoError(t, err)
+	subset, err := iplddecoders.DecodeSubset(nodes[epoch.Subsets[0].(cidlink.Link).Cid])
+	require.NoError(t, err)
+	block, err := iplddecoders.DecodeBlock(nodes[subset.Blocks[0].(cidlink.Link).Cid])
+	require.NoError(t, err)
+	entry, err := iplddecoders.DecodeEntry(nodes[block.Entries[0].(cidlink.Link).Cid])
+	require.NoError(t, err)
+	tx, err := iplddecoders.DecodeTransaction(nodes[entry.Transactions[0].(cidlink.Link).Cid])
+	require.NoError(t, err)
+	got, err := decompressZstd(tx.Metadata.Data)
+	require.NoError(t, err)
+	require.Equal(t, meta, got)
+	require.NotNil(t, nodes[block.Rewards.(cidlink.Link).Cid])
+}
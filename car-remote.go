@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"k8s.io/klog/v2"
+)
+
+// A remote CAR (HTTP/S or S3) is read sequentially with ranged requests, so that a CAR can be
+// indexed (or dumped, compressed...) without a local copy; an interrupted request is resumed
+// where it stopped.
+
+const (
+	defaultRemoteCarChunkSize  = 64 * 1024 * 1024
+	defaultRemoteCarRetries    = 5
+	defaultRemoteCarRetryDelay = time.Second
+)
+
+// isRemoteCarPath returns true if the CAR is read from HTTP/S or S3.
+func isRemoteCarPath(carPath string) bool {
+	return isRemoteURI(carPath) || strings.HasPrefix(carPath, "s3://")
+}
+
+// remoteCarURL returns the HTTP URL of a remote CAR. s3://<bucket>/<key> is fetched (path-style)
+// from the endpoint of AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL if set, or else from
+// https://<bucket>.s3.amazonaws.com/<key>; the requests are not signed, so the object must be public.
+func remoteCarURL(carPath string) (string, error) {
+	if !strings.HasPrefix(carPath, "s3://") {
+		return carPath, nil
+	}
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(carPath, "s3://"), "/")
+	if !ok || bucket == "" || key == "" {
+		return "", fmt.Errorf("invalid S3 path %q: expected s3://<bucket>/<key>", carPath)
+	}
+	for _, env := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(env); endpoint != "" {
+			return strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + key, nil
+		}
+	}
+	return "https://" + bucket + ".s3.amazonaws.com/" + key, nil
+}
+
+// remoteCarReader reads a remote file sequentially, in ranges of chunkSize bytes.
+type remoteCarReader struct {
+	ctx        context.Context
+	url        string
+	httpClient *http.Client
+	chunkSize  int64
+	retries    int
+	retryDelay time.Duration
+
+	offset int64
+	// size is the size of the file, -1 until the first response.
+	size    int64
+	body    io.ReadCloser
+	bodyEnd int64
+	// failures is the number of consecutive failed requests.
+	failures int
+}
+
+func openRemoteCar(ctx context.Context, carPath string) (*remoteCarReader, error) {
+	u, err := remoteCarURL(carPath)
+	if err != nil {
+		return nil, err
+	}
+	r := &remoteCarReader{
+		ctx:        ctx,
+		url:        u,
+		httpClient: http.DefaultClient,
+		chunkSize:  defaultRemoteCarChunkSize,
+		retries:    defaultRemoteCarRetries,
+		retryDelay: defaultRemoteCarRetryDelay,
+		size:       -1,
+	}
+	// the first request checks that the CAR exists, and gets its size.
+	if err := r.openRange(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openRange requests the next range of the file.
+func (r *remoteCarReader) openRange() error {
+	end := r.offset + r.chunkSize - 1
+	if r.size >= 0 {
+		end = min(end, r.size-1)
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.offset, end))
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", redactURL(r.url), err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, last, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err == nil && start != r.offset {
+			err = fmt.Errorf("expected a range starting at %d, got %d", r.offset, start)
+		}
+		if err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to read %s: %w", redactURL(r.url), err)
+		}
+		r.bodyEnd = last + 1
+		r.size = size
+		if size < 0 && last < end {
+			// a short range of a file of unknown size: its end.
+			r.size = last + 1
+		}
+	case http.StatusOK:
+		// the server ignores the ranges: the body is the whole file (of unknown size if -1).
+		if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("failed to read %s: %w", redactURL(r.url), err)
+		}
+		r.size = resp.ContentLength
+		r.bodyEnd = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the offset is the end of the file.
+		resp.Body.Close()
+		r.size = r.offset
+		return nil
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("failed to read %s: status %d", redactURL(r.url), resp.StatusCode)
+	}
+	r.body = splitcarfetcher.DefaultBandwidth.ReadCloser(r.ctx, r.url, splitcarfetcher.TrafficDownload, resp.Body)
+	return nil
+}
+
+// parseContentRange parses a Content-Range header, e.g. "bytes 0-99/1000"; size is -1 if it's
+// unknown ("bytes 0-99/*").
+func parseContentRange(contentRange string) (start int64, last int64, size int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", contentRange)
+	byteRange, total, ok := strings.Cut(strings.TrimPrefix(contentRange, "bytes "), "/")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	first, end, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, 0, invalid
+	}
+	if start, err = strconv.ParseInt(first, 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+	if last, err = strconv.ParseInt(end, 10, 64); err != nil {
+		return 0, 0, 0, invalid
+	}
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return 0, 0, 0, invalid
+		}
+	}
+	return start, last, size, nil
+}
+
+func (r *remoteCarReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if r.size >= 0 && r.offset >= r.size {
+				return 0, io.EOF
+			}
+			if err := r.openRange(); err != nil {
+				if err := r.retry(err); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+		if err == io.EOF && (r.bodyEnd < 0 || r.offset >= r.bodyEnd) {
+			// the end of the range.
+			r.body.Close()
+			r.body = nil
+			if r.bodyEnd < 0 {
+				r.size = r.offset
+			}
+			err = nil
+		}
+		if err != nil {
+			r.body.Close()
+			r.body = nil
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err := r.retry(err); err != nil {
+				return n, err
+			}
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// retry waits before the next attempt, or returns err if there were too many failures.
+func (r *remoteCarReader) retry(err error) error {
+	r.failures++
+	if r.failures > r.retries || r.ctx.Err() != nil {
+		return err
+	}
+	delay := r.retryDelay << (r.failures - 1)
+	klog.Warningf("Reading %s at offset %d failed (%v); retrying in %s", redactURL(r.url), r.offset, err, delay)
+	return sleepContext(r.ctx, delay)
+}
+
+func (r *remoteCarReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
+
+// redactURL removes the query of the URL (e.g. the signature of a presigned URL), for the logs.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+	u.RawQuery = "REDACTED"
+	return u.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteCarReader(t *testing.T) {
+	content := make([]byte, 10_000)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 3 {
+			// a connection cut in the middle of a range.
+			var start, end int
+			_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			require.NoError(t, err)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start : start+10])
+			return
+		}
+		http.ServeContent(w, r, "epoch.car", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	r := &remoteCarReader{
+		ctx:        context.Background(),
+		url:        server.URL,
+		httpClient: server.Client(),
+		chunkSize:  3000,
+		retries:    1,
+		retryDelay: time.Millisecond,
+		size:       -1,
+	}
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+	require.Equal(t, int64(len(content)), r.size)
+	// 4 ranges, and the retry of the cut one.
+	require.Equal(t, int32(5), requests.Load())
+}
+
+func TestRemoteCarReaderWithoutRanges(t *testing.T) {
+	content := []byte("the whole file, at once")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	r := &remoteCarReader{
+		ctx:        context.Background(),
+		url:        server.URL,
+		httpClient: server.Client(),
+		chunkSize:  4,
+		size:       -1,
+	}
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, content, got)
+}
+
+func TestRemoteCarURL(t *testing.T) {
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	u, err := remoteCarURL("s3://bucket/epoch-0/epoch-0.car")
+	require.NoError(t, err)
+	require.Equal(t, "https://bucket.s3.amazonaws.com/epoch-0/epoch-0.car", u)
+
+	t.Setenv("AWS_ENDPOINT_URL", "http://localhost:9000/")
+	u, err = remoteCarURL("s3://bucket/epoch-0.car")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:9000/bucket/epoch-0.car", u)
+
+	_, err = remoteCarURL("s3://bucket")
+	require.Error(t, err)
+
+	u, err = remoteCarURL("https://files.old-faithful.net/0/epoch-0.car")
+	require.NoError(t, err)
+	require.Equal(t, "https://files.old-faithful.net/0/epoch-0.car", u)
+
+	start, last, size, err := parseContentRange("bytes 100-199/1000")
+	require.NoError(t, err)
+	require.Equal(t, []int64{100, 199, 1000}, []int64{start, last, size})
+	_, _, size, err = parseContentRange("bytes 0-99/*")
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), size)
+
+	require.Equal(t, "https://bucket.s3.amazonaws.com/a.car?REDACTED", redactURL("https://bucket.s3.amazonaws.com/a.car?X-Amz-Signature=secret"))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	seekablezstd "github.com/rpcpool/yellowstone-faithful/seekable-zstd"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"k8s.io/klog/v2"
+)
+
+// seekTableSidecarSuffix is the suffix of the sidecar file with the seek table of a zstd-compressed CAR
+// that doesn't have one at its end (e.g. epoch-0.car.zst.seektable).
+const seekTableSidecarSuffix = ".seektable"
+
+// isZstdCarPath returns true if the CAR at the given path (or URL) is zstd-compressed.
+func isZstdCarPath(where string) bool {
+	return strings.HasSuffix(where, ".zst") || strings.HasSuffix(where, ".zstd")
+}
+
+func isRemoteURI(where string) bool {
+	return strings.HasPrefix(where, "http://") || strings.HasPrefix(where, "https://")
+}
+
+// zstdCarReader reads the decompressed data of a zstd-compressed CAR at any offset.
+type zstdCarReader struct {
+	*seekablezstd.Reader
+	compressed ReaderAtCloser
+}
+
+func (r *zstdCarReader) Close() error {
+	return errors.Join(r.Reader.Close(), r.compressed.Close())
+}
+
+// openZstdCarStorage opens a zstd-compressed CAR (local or remote) for random access.
+// The CAR must be compressed in the seekable format (e.g. with `faithful-cli car compress`),
+// or have a seek table sidecar next to it.
+func openZstdCarStorage(ctx context.Context, where string) (*zstdCarReader, error) {
+	var compressed ReaderAtCloser
+	var size int64
+	if isRemoteURI(where) {
+		klog.Infof("opening zstd-compressed CAR file from %q as HTTP remote file", where)
+		rem, remSize, err := splitcarfetcher.NewRemoteHTTPFileAsIoReaderAt(ctx, where)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open remote CAR file %q: %w", where, err)
+		}
+		compressed = &readCloserWrapper{
+			rac:      rem,
+			name:     where,
+			isRemote: true,
+			size:     remSize,
+		}
+		size = remSize
+	} else {
+		file, err := os.Open(where)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open CAR file: %w", err)
+		}
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to stat CAR file: %w", err)
+		}
+		compressed = file
+		size = stat.Size()
+	}
+	rd, err := openSeekableZstd(ctx, where, compressed, size)
+	if err != nil {
+		compressed.Close()
+		return nil, fmt.Errorf("failed to open zstd-compressed CAR file %q: %w", where, err)
+	}
+	klog.Infof("opened zstd-compressed CAR file %q: %d frames, %d bytes decompressed", where, rd.NumFrames(), rd.Size())
+	return &zstdCarReader{
+		Reader:     rd,
+		compressed: compressed,
+	}, nil
+}
+
+// openSeekableZstd uses the seek table at the end of the data, or else the one in the sidecar file.
+func openSeekableZstd(ctx context.Context, where string, compressed io.ReaderAt, size int64) (*seekablezstd.Reader, error) {
+	rd, err := seekablezstd.Open(compressed, size)
+	if err == nil {
+		return rd, nil
+	}
+	if !errors.Is(err, seekablezstd.ErrNoSeekTable) {
+		return nil, err
+	}
+	sidecarPath := where + seekTableSidecarSuffix
+	sidecar, sidecarErr := readSeekTableSidecar(ctx, sidecarPath)
+	if sidecarErr != nil {
+		return nil, fmt.Errorf("the file has no seek table at its end, and failed to read the sidecar %q: %w", sidecarPath, sidecarErr)
+	}
+	table := new(seekablezstd.SeekTable)
+	if err := table.UnmarshalBinary(sidecar); err != nil {
+		return nil, fmt.Errorf("failed to parse the seek table sidecar %q: %w", sidecarPath, err)
+	}
+	return seekablezstd.NewReader(compressed, size, table)
+}
+
+func readSeekTableSidecar(ctx context.Context, where string) ([]byte, error) {
+	if !isRemoteURI(where) {
+		return os.ReadFile(where)
+	}
+	rem, size, err := splitcarfetcher.NewRemoteHTTPFileAsIoReaderAt(ctx, where)
+	if err != nil {
+		return nil, err
+	}
+	defer rem.Close()
+	buf := make([]byte, size)
+	if _, err := rem.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// openCarFile opens a CAR file for a sequential read; a zstd-compressed CAR (in any format)
+// is decompressed as it is read, - is stdin, and an HTTP/S or S3 CAR is read with ranged requests.
+func openCarFile(carPath string) (io.ReadCloser, error) {
+	if carPath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	var file io.ReadCloser
+	var err error
+	if isRemoteCarPath(carPath) {
+		file, err = openRemoteCar(context.Background(), carPath)
+	} else {
+		file, err = os.Open(carPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isZstdCarPath(carPath) {
+		return file, nil
+	}
+	decoder, err := zstd.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	return &zstdFileReader{Decoder: decoder, file: file}, nil
+}
+
+type zstdFileReader struct {
+	*zstd.Decoder
+	file io.Closer
+}
+
+func (r *zstdFileReader) Close() error {
+	r.Decoder.Close()
+	return r.file.Close()
+}
+
+// compressCar compresses the CAR to a seekable zstd file, that can be served directly.
+func compressCar(r io.Reader, w io.Writer, frameSize int, level int) (*seekablezstd.SeekTable, error) {
+	zw, err := seekablezstd.NewWriter(w, frameSize, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return zw.SeekTable(), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"k8s.io/klog/v2"
+)
+
+// clickHouseClient sends queries to ClickHouse over its HTTP interface.
+type clickHouseClient struct {
+	url        string // e.g. http://localhost:8123
+	database   string
+	user       string
+	password   string
+	httpClient *http.Client
+}
+
+// exec runs the query, with the (optional) body as its data, and returns the response.
+func (c *clickHouseClient) exec(ctx context.Context, query string, body []byte) ([]byte, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	if c.database != "" {
+		params.Set("database", c.database)
+	}
+	var reqBody io.Reader
+	compressed := false
+	if len(body) > 0 {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		reqBody = &buf
+		compressed = true
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.url, "/")+"/?"+params.Encode(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if c.user != "" {
+		req.Header.Set("X-ClickHouse-User", c.user)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("clickhouse returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// The tables of the ClickHouse loader; the ReplacingMergeTree engine deduplicates the rows
+// inserted again when a load is resumed after an interruption.
+const (
+	clickHouseBlocksTableSchema = `CREATE TABLE IF NOT EXISTS %s (
+	slot UInt64,
+	parent_slot UInt64,
+	block_time DateTime,
+	block_height Nullable(UInt64),
+	blockhash String,
+	transaction_count UInt32
+) ENGINE = ReplacingMergeTree ORDER BY slot`
+	clickHouseTransactionsTableSchema = `CREATE TABLE IF NOT EXISTS %s (
+	slot UInt64,
+	block_time DateTime,
+	tx_index UInt32,
+	signature String,
+	fee_payer String,
+	fee UInt64,
+	success Bool,
+	err Nullable(String),
+	version String,
+	account_keys Array(String),
+	program_ids Array(String),
+	num_instructions UInt32
+) ENGINE = ReplacingMergeTree ORDER BY (slot, tx_index)`
+)
+
+type clickHouseBlockRow struct {
+	Slot             uint64  `json:"slot"`
+	ParentSlot       uint64  `json:"parent_slot"`
+	BlockTime        int64   `json:"block_time"`
+	BlockHeight      *uint64 `json:"block_height"`
+	Blockhash        string  `json:"blockhash"`
+	TransactionCount int     `json:"transaction_count"`
+}
+
+type clickHouseTransactionRow struct {
+	Slot            uint64   `json:"slot"`
+	BlockTime       int64    `json:"block_time"`
+	TxIndex         int      `json:"tx_index"`
+	Signature       string   `json:"signature"`
+	FeePayer        string   `json:"fee_payer"`
+	Fee             uint64   `json:"fee"`
+	Success         bool     `json:"success"`
+	Err             *string  `json:"err"`
+	Version         string   `json:"version"`
+	AccountKeys     []string `json:"account_keys"`
+	ProgramIDs      []string `json:"program_ids"`
+	NumInstructions int      `json:"num_instructions"`
+}
+
+// clickHouseLoader inserts blocks and their transactions into ClickHouse, in batches.
+type clickHouseLoader struct {
+	client            *clickHouseClient
+	blocksTable       string
+	transactionsTable string
+	batchSize         int
+	blocks            bytes.Buffer
+	transactions      bytes.Buffer
+	numBlocks         int
+	numTransactions   int
+}
+
+func newClickHouseLoader(client *clickHouseClient, tablePrefix string, batchSize int) *clickHouseLoader {
+	return &clickHouseLoader{
+		client:            client,
+		blocksTable:       tablePrefix + "blocks",
+		transactionsTable: tablePrefix + "transactions",
+		batchSize:         batchSize,
+	}
+}
+
+// createTables creates the tables if they don't exist.
+func (l *clickHouseLoader) createTables(ctx context.Context) error {
+	if _, err := l.client.exec(ctx, fmt.Sprintf(clickHouseBlocksTableSchema, l.blocksTable), nil); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", l.blocksTable, err)
+	}
+	if _, err := l.client.exec(ctx, fmt.Sprintf(clickHouseTransactionsTableSchema, l.transactionsTable), nil); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", l.transactionsTable, err)
+	}
+	return nil
+}
+
+// lastLoadedSlot returns the last slot whose block was loaded (false if none): the rows of a block
+// are inserted after the ones of its transactions, so the slots up to it are complete.
+func (l *clickHouseLoader) lastLoadedSlot(ctx context.Context, fromSlot uint64, toSlot uint64) (uint64, bool, error) {
+	resp, err := l.client.exec(ctx, fmt.Sprintf(
+		"SELECT count(), max(slot) FROM %s WHERE slot >= %d AND slot <= %d FORMAT TabSeparated",
+		l.blocksTable, fromSlot, toSlot,
+	), nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get the last loaded slot: %w", err)
+	}
+	fields := strings.Fields(string(resp))
+	if len(fields) != 2 {
+		return 0, false, fmt.Errorf("unexpected response to the last loaded slot query: %q", resp)
+	}
+	count, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if count == 0 {
+		return 0, false, nil
+	}
+	slot, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return slot, true, nil
+}
+
+// add adds the rows of the block (and its transactions) to the batch, and flushes it when full.
+func (l *clickHouseLoader) add(ctx context.Context, block *transcodeBlock) error {
+	txEncoder := json.NewEncoder(&l.transactions)
+	for _, tx := range block.Transactions {
+		if err := txEncoder.Encode(newClickHouseTransactionRow(block, &tx)); err != nil {
+			return err
+		}
+		l.numTransactions++
+	}
+	if err := json.NewEncoder(&l.blocks).Encode(clickHouseBlockRow{
+		Slot:             block.Slot,
+		ParentSlot:       block.ParentSlot,
+		BlockTime:        block.BlockTime,
+		BlockHeight:      block.BlockHeight,
+		Blockhash:        block.Blockhash.String(),
+		TransactionCount: len(block.Transactions),
+	}); err != nil {
+		return err
+	}
+	l.numBlocks++
+	if l.numTransactions+l.numBlocks >= l.batchSize {
+		return l.flush(ctx)
+	}
+	return nil
+}
+
+// flush inserts the batch: the transactions first, then the blocks (see lastLoadedSlot).
+func (l *clickHouseLoader) flush(ctx context.Context) error {
+	if l.numBlocks == 0 && l.numTransactions == 0 {
+		return nil
+	}
+	if l.numTransactions > 0 {
+		if _, err := l.client.exec(ctx, "INSERT INTO "+l.transactionsTable+" FORMAT JSONEachRow", l.transactions.Bytes()); err != nil {
+			return fmt.Errorf("failed to insert %d transactions: %w", l.numTransactions, err)
+		}
+	}
+	if _, err := l.client.exec(ctx, "INSERT INTO "+l.blocksTable+" FORMAT JSONEachRow", l.blocks.Bytes()); err != nil {
+		return fmt.Errorf("failed to insert %d blocks: %w", l.numBlocks, err)
+	}
+	klog.V(2).Infof("clickhouse: inserted %d blocks and %d transactions", l.numBlocks, l.numTransactions)
+	l.blocks.Reset()
+	l.transactions.Reset()
+	l.numBlocks = 0
+	l.numTransactions = 0
+	return nil
+}
+
+func newClickHouseTransactionRow(block *transcodeBlock, tx *transcodeTransaction) clickHouseTransactionRow {
+	row := clickHouseTransactionRow{
+		Slot:            block.Slot,
+		BlockTime:       block.BlockTime,
+		TxIndex:         tx.Index,
+		Fee:             transactionFeeFromMeta(tx.Meta),
+		Success:         true,
+		Version:         fmt.Sprint(transactionVersion(&tx.Transaction)),
+		NumInstructions: len(tx.Transaction.Message.Instructions),
+	}
+	if len(tx.Transaction.Signatures) > 0 {
+		row.Signature = tx.Transaction.Signatures[0].String()
+	}
+	accountKeys := tx.Transaction.Message.AccountKeys
+	if len(accountKeys) > 0 {
+		row.FeePayer = accountKeys[0].String()
+	}
+	writable, readonly := loadedAddressesFromMeta(tx.Meta)
+	allKeys := make([]solana.PublicKey, 0, len(accountKeys)+len(writable)+len(readonly))
+	allKeys = append(append(append(allKeys, accountKeys...), writable...), readonly...)
+	row.AccountKeys = make([]string, len(allKeys))
+	for i, key := range allKeys {
+		row.AccountKeys[i] = key.String()
+	}
+	seenPrograms := make(map[uint16]bool)
+	row.ProgramIDs = []string{}
+	for _, inst := range tx.Transaction.Message.Instructions {
+		if seenPrograms[inst.ProgramIDIndex] || int(inst.ProgramIDIndex) >= len(allKeys) {
+			continue
+		}
+		seenPrograms[inst.ProgramIDIndex] = true
+		row.ProgramIDs = append(row.ProgramIDs, allKeys[inst.ProgramIDIndex].String())
+	}
+	if txErr, err := transactionErrorFromMeta(tx.Meta); err == nil && txErr != nil {
+		row.Success = false
+		if buf, err := json.Marshal(txErr); err == nil {
+			s := string(buf)
+			row.Err = &s
+		}
+	}
+	return row
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClickHouse records the queries and the inserted rows.
+type fakeClickHouse struct {
+	mu      sync.Mutex
+	queries []string
+	rows    map[string][]map[string]any
+	// response is returned to the SELECT queries.
+	response string
+}
+
+func (f *fakeClickHouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := r.URL.Query().Get("query")
+	f.queries = append(f.queries, query)
+	if r.Header.Get("X-ClickHouse-User") != "loader" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasPrefix(query, "SELECT"):
+		io.WriteString(w, f.response)
+	case strings.HasPrefix(query, "INSERT INTO "):
+		table := strings.Fields(query)[2]
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			var row map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.rows[table] = append(f.rows[table], row)
+		}
+	}
+}
+
+func TestClickHouseLoader(t *testing.T) {
+	fake := &fakeClickHouse{rows: make(map[string][]map[string]any), response: "0\t0\n"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := &clickHouseClient{url: server.URL, database: "default", user: "loader", httpClient: server.Client()}
+	loader := newClickHouseLoader(client, "solana_", 5)
+	ctx := context.Background()
+
+	require.NoError(t, loader.createTables(ctx))
+	require.Len(t, fake.queries, 2)
+	require.True(t, strings.HasPrefix(fake.queries[0], "CREATE TABLE IF NOT EXISTS solana_blocks ("))
+	require.True(t, strings.HasPrefix(fake.queries[1], "CREATE TABLE IF NOT EXISTS solana_transactions ("))
+
+	_, ok, err := loader.lastLoadedSlot(ctx, 0, 100)
+	require.NoError(t, err)
+	require.False(t, ok)
+	fake.response = "3\t42\n"
+	slot, ok, err := loader.lastLoadedSlot(ctx, 0, 100)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(42), slot)
+
+	payer := solana.NewWallet().PublicKey()
+	program := solana.NewWallet().PublicKey()
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1, 2, 3}},
+		Message: solana.Message{
+			AccountKeys: solana.PublicKeySlice{payer, program},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 1},
+				{ProgramIDIndex: 1},
+			},
+		},
+	}
+	height := uint64(7)
+	block := &transcodeBlock{
+		Slot:        43,
+		ParentSlot:  42,
+		BlockTime:   1700000000,
+		BlockHeight: &height,
+		Transactions: []transcodeTransaction{
+			{Index: 0, Transaction: tx, Meta: &confirmed_block.TransactionStatusMeta{Fee: 5000}},
+			{Index: 1, Transaction: tx},
+		},
+	}
+	// 2 transactions and a block: below the batch size.
+	require.NoError(t, loader.add(ctx, block))
+	require.Empty(t, fake.rows)
+	block.Slot = 44
+	require.NoError(t, loader.add(ctx, block))
+	require.Len(t, fake.rows["solana_transactions"], 4)
+	require.Len(t, fake.rows["solana_blocks"], 2)
+	// the transactions are inserted before the blocks.
+	require.True(t, strings.HasPrefix(fake.queries[len(fake.queries)-2], "INSERT INTO solana_transactions"))
+	require.True(t, strings.HasPrefix(fake.queries[len(fake.queries)-1], "INSERT INTO solana_blocks"))
+
+	txRow := fake.rows["solana_transactions"][0]
+	require.Equal(t, float64(43), txRow["slot"])
+	require.Equal(t, tx.Signatures[0].String(), txRow["signature"])
+	require.Equal(t, payer.String(), txRow["fee_payer"])
+	require.Equal(t, float64(5000), txRow["fee"])
+	require.Equal(t, true, txRow["success"])
+	require.Equal(t, "legacy", txRow["version"])
+	require.Equal(t, []any{program.String()}, txRow["program_ids"])
+	require.Equal(t, float64(2), txRow["num_instructions"])
+	blockRow := fake.rows["solana_blocks"][1]
+	require.Equal(t, float64(44), blockRow["slot"])
+	require.Equal(t, float64(7), blockRow["block_height"])
+	require.Equal(t, float64(2), blockRow["transaction_count"])
+
+	// nothing left to flush.
+	numQueries := len(fake.queries)
+	require.NoError(t, loader.flush(ctx))
+	require.Len(t, fake.queries, numQueries)
+
+	client.user = "someone"
+	_, err = client.exec(ctx, "SELECT 1", nil)
+	require.ErrorContains(t, err, "status 401")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"github.com/urfave/cli/v2"
+	"github.com/ybbus/jsonrpc/v3"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Bench() *cli.Command {
+	return &cli.Command{
+		Name:        "bench",
+		Usage:       "Benchmarks.",
+		Description: "Benchmarks of the read paths, on the local hardware and data.",
+		Before: func(c *cli.Context) error {
+			return nil
+		},
+		Flags: []cli.Flag{},
+		Subcommands: []*cli.Command{
+			newCmd_BenchInternal(),
+		},
+	}
+}
+
+func newCmd_BenchInternal() *cli.Command {
+	var duration time.Duration
+	var workers int
+	var seed int64
+	var baseline string
+	var outputJSON bool
+	return &cli.Command{
+		Name:        "internal",
+		Usage:       "Run micro-benchmarks of the index and CAR read paths of an epoch.",
+		Description: "Measure the slot-to-cid and cid-to-offset-and-size lookups, the node reads and the block assemblies per second on the storage of the given epoch config (bypassing the cache), and compare them with the expected baselines of a kind of storage, to diagnose a misconfigured storage. The sequence of slots is reproducible (see --seed).",
+		ArgsUsage:   "<epoch config file>",
+		Before: func(c *cli.Context) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:        "duration",
+				Usage:       "How long to run each benchmark",
+				Value:       10 * time.Second,
+				Destination: &duration,
+			},
+			&cli.IntFlag{
+				Name:        "workers",
+				Usage:       "How many concurrent workers run the lookups and the node reads (the block assemblies run on one)",
+				Value:       1,
+				Destination: &workers,
+			},
+			&cli.Int64Flag{
+				Name:        "seed",
+				Usage:       "Seed of the random sequence of slots; the same seed reads the same slots",
+				Value:       1,
+				Destination: &seed,
+			},
+			&cli.StringFlag{
+				Name:        "baseline",
+				Usage:       fmt.Sprintf("The kind of storage to compare with (%s); default: nvme for a local CAR and indexes, remote otherwise", strings.Join(benchBaselineNames(), ", ")),
+				Destination: &baseline,
+			},
+			&cli.BoolFlag{
+				Name:        "json",
+				Usage:       "Print the results as JSON",
+				Destination: &outputJSON,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() != 1 {
+				return cli.Exit("expected exactly one epoch config file", 1)
+			}
+			if workers < 1 {
+				return cli.Exit("--workers must be at least 1", 1)
+			}
+			if duration <= 0 {
+				return cli.Exit("--duration must be positive", 1)
+			}
+			config, err := LoadConfig(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("failed to load config file %q: %s", c.Args().First(), err.Error()), 1)
+			}
+			if err := config.Validate(); err != nil {
+				return cli.Exit(fmt.Sprintf("invalid config file %q: %s", c.Args().First(), err.Error()), 1)
+			}
+			if config.IsFilecoinMode() {
+				return cli.Exit("the benchmarks need a CAR file (the config is in filecoin mode)", 1)
+			}
+			if baseline == "" {
+				baseline = defaultBenchBaseline(config)
+			}
+			if _, ok := benchBaselines[baseline]; !ok {
+				return cli.Exit(fmt.Sprintf("unknown baseline %q (supported: %s)", baseline, strings.Join(benchBaselineNames(), ", ")), 1)
+			}
+
+			conf := bigcache.DefaultConfig(5 * time.Minute)
+			conf.HardMaxCacheSize = 256
+			allCache, err := hugecache.NewWithConfig(c.Context, conf)
+			if err != nil {
+				return fmt.Errorf("failed to create cache: %w", err)
+			}
+			lotusAPIAddress := "https://api.node.glif.io"
+			cl := jsonrpc.NewClient(lotusAPIAddress)
+			minerInfo := splitcarfetcher.NewMinerInfo(
+				cl,
+				24*time.Hour,
+				5*time.Second,
+			)
+			epoch, err := NewEpochFromConfig(config, c, allCache, minerInfo)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("failed to create epoch from config %q: %s", config.ConfigFilepath(), err.Error()), 1)
+			}
+			defer epoch.Close()
+
+			benchConf := BenchConfig{
+				Duration: duration,
+				Workers:  workers,
+				Seed:     seed,
+				Baseline: baseline,
+			}
+			klog.Infof("Benchmarking epoch %d (%d benchmarks of %s each)...", epoch.Epoch(), len(benchNames), duration)
+			results, err := epoch.RunInternalBenchmarks(c.Context, benchConf)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("failed to run the benchmarks: %s", err.Error()), 1)
+			}
+			if outputJSON {
+				return fasterJson.NewEncoder(os.Stdout).Encode(map[string]any{
+					"epoch":    epoch.Epoch(),
+					"baseline": baseline,
+					"workers":  workers,
+					"seed":     seed,
+					"results":  results,
+				})
+			}
+			return printBenchResults(os.Stdout, results, benchConf)
+		},
+	}
+}
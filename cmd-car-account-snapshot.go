@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/readahead"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_CarAccountSnapshot() *cli.Command {
+	var epoch uint64
+	var slot uint64
+	var outPath string
+	return &cli.Command{
+		Name:        "account-snapshot",
+		Usage:       "Write an account snapshot CAR from a JSONL file of accounts.",
+		Description: "Write the account snapshot CAR of an epoch boundary from a JSONL file of accounts (\"-\" for stdin), one object per line with the pubkey, lamports, owner, executable, rentEpoch and base64 data of an account, e.g. as dumped from a ledger snapshot; then create its index with `index account-snapshot`.",
+		ArgsUsage:   "<accounts-jsonl>",
+		Flags: []cli.Flag{
+			&cli.Uint64Flag{
+				Name:        "epoch",
+				Usage:       "the epoch of the snapshot (the accounts are the state at its start)",
+				Destination: &epoch,
+				Required:    true,
+			},
+			&cli.Uint64Flag{
+				Name:        "slot",
+				Usage:       "the slot of the snapshot (the accounts are the state after this slot)",
+				Destination: &slot,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the CAR to write",
+				Destination: &outPath,
+				Required:    true,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			inPath := c.Args().Get(0)
+			if inPath == "" {
+				return fmt.Errorf("missing accounts-jsonl argument")
+			}
+			var in io.Reader = os.Stdin
+			if inPath != "-" {
+				file, err := os.Open(inPath)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+			startedAt := time.Now()
+			// the CAR is written to a temporary file, so that an interrupted run doesn't leave a truncated snapshot.
+			tmpFile, err := os.CreateTemp(filepath.Dir(outPath), filepath.Base(outPath)+".tmp-*")
+			if err != nil {
+				return err
+			}
+			defer os.Remove(tmpFile.Name())
+			defer tmpFile.Close()
+			out := bufio.NewWriterSize(tmpFile, readahead.MiB)
+			writer, err := newAccountSnapshotCarWriter(out, accountSnapshotHeader{Epoch: epoch, Slot: slot})
+			if err != nil {
+				return err
+			}
+			if err := readAccountsJsonl(in, writer.add); err != nil {
+				return err
+			}
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			if err := tmpFile.Close(); err != nil {
+				return err
+			}
+			if err := os.Rename(tmpFile.Name(), outPath); err != nil {
+				return err
+			}
+			klog.Infof("Wrote %d accounts to %s (root %s) in %s", writer.numAccounts, outPath, writer.rootCid, time.Since(startedAt))
+			return nil
+		},
+	}
+}
+
+// accountJson is an account of the JSONL input of `car account-snapshot`.
+type accountJson struct {
+	Pubkey     string `json:"pubkey"`
+	Lamports   uint64 `json:"lamports"`
+	Owner      string `json:"owner"`
+	Executable bool   `json:"executable"`
+	RentEpoch  uint64 `json:"rentEpoch"`
+	Data       string `json:"data"` // base64
+}
+
+// readAccountsJsonl calls fn with each account of the JSONL input.
+func readAccountsJsonl(in io.Reader, fn func(*AccountRecord) error) error {
+	scanner := bufio.NewScanner(in)
+	// the data of an account can be up to 10 MiB, i.e. ~14 MiB of base64.
+	scanner.Buffer(make([]byte, 0, readahead.MiB), 16*readahead.MiB)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var account accountJson
+		if err := fasterJson.Unmarshal(line, &account); err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		record, err := account.record()
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (a *accountJson) record() (*AccountRecord, error) {
+	pubkey, err := solana.PublicKeyFromBase58(a.Pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey %q: %w", a.Pubkey, err)
+	}
+	owner, err := solana.PublicKeyFromBase58(a.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("invalid owner %q of %s: %w", a.Owner, pubkey, err)
+	}
+	data, err := base64.StdEncoding.DecodeString(a.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data of %s: %w", pubkey, err)
+	}
+	return &AccountRecord{
+		Pubkey:     pubkey,
+		Lamports:   a.Lamports,
+		Owner:      owner,
+		Executable: a.Executable,
+		RentEpoch:  a.RentEpoch,
+		Data:       data,
+	}, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	seekablezstd "github.com/rpcpool/yellowstone-faithful/seekable-zstd"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_CarCompress() *cli.Command {
+	var outPath string
+	var frameSize string
+	var level int
+	var dryRun bool
+	return &cli.Command{
+		Name:        "compress",
+		Usage:       "Compress a CAR to a seekable zstd file that can be served directly.",
+		Description: "Compress the CAR in independent zstd frames, followed by a seek table (in the seekable zstd format), so that the RPC server and the CLI tools can read the compressed CAR at any offset without decompressing it first. The indexes of the original CAR can be used with the compressed one. The smaller the frames, the less data is decompressed for each read, but the worse the compression ratio.",
+		ArgsUsage:   "<car-path>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the compressed CAR; defaults to the path of the CAR with a .zst suffix",
+				Destination: &outPath,
+			},
+			&cli.StringFlag{
+				Name:        "frame-size",
+				Usage:       "size of the (decompressed) data of each frame",
+				Value:       humanize.IBytes(seekablezstd.DefaultFrameSize),
+				Destination: &frameSize,
+			},
+			&cli.IntFlag{
+				Name:        "level",
+				Usage:       "zstd compression level (1-22)",
+				Value:       3,
+				Destination: &level,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "compress the CAR and print what would be written (the compressed CAR, with its exact size and number of frames), without writing anything",
+				Destination: &dryRun,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			carPath := c.Args().Get(0)
+			if carPath == "" {
+				return fmt.Errorf("missing car-path argument")
+			}
+			if isZstdCarPath(carPath) {
+				return fmt.Errorf("the CAR is already compressed")
+			}
+			if outPath == "" {
+				if carPath == "-" {
+					return fmt.Errorf("--out is required when reading the CAR from stdin")
+				}
+				outPath = carPath + ".zst"
+			}
+			parsedFrameSize, err := humanize.ParseBytes(frameSize)
+			if err != nil {
+				return fmt.Errorf("invalid --frame-size: %w", err)
+			}
+			if parsedFrameSize == 0 || parsedFrameSize > seekablezstd.MaxScanFrameSize {
+				return fmt.Errorf("--frame-size must be between 1 byte and %s", humanize.IBytes(seekablezstd.MaxScanFrameSize))
+			}
+
+			in, err := openCarFile(carPath)
+			if err != nil {
+				return fmt.Errorf("failed to open car: %w", err)
+			}
+			defer in.Close()
+			if dryRun {
+				plan, err := planCarCompression(carPath, in, outPath, int(parsedFrameSize), level)
+				if err != nil {
+					return err
+				}
+				fmt.Println(plan.String())
+				return nil
+			}
+			out, err := os.Create(outPath)
+			if err != nil {
+				return fmt.Errorf("failed to create output file: %w", err)
+			}
+			startedAt := time.Now()
+			task, r := startCarProgress("car compress", carPath, in)
+			bw := bufio.NewWriterSize(out, 8*1024*1024)
+			table, err := compressCar(bufio.NewReaderSize(r, 8*1024*1024), bw, int(parsedFrameSize), level)
+			if err == nil {
+				err = bw.Flush()
+			}
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			task.Done(err)
+			if err != nil {
+				os.Remove(outPath)
+				return fmt.Errorf("failed to compress car: %w", err)
+			}
+			compressedSize := table.CompressedSize() + int64(table.EncodedSize())
+			klog.Infof("Compressed %s to %s (%s, ratio %.2f, %d frames) in %s",
+				humanize.IBytes(uint64(table.DecompressedSize())),
+				outPath,
+				humanize.IBytes(uint64(compressedSize)),
+				ratio(uint64(table.DecompressedSize()), uint64(compressedSize)),
+				len(table.Frames),
+				time.Since(startedAt),
+			)
+			return nil
+		},
+	}
+}
+
+// planCarCompression compresses the CAR like the compress command, and returns what it would
+// write to outPath, without writing anything.
+func planCarCompression(carPath string, in io.Reader, outPath string, frameSize int, level int) (_ *dryRunPlan, retErr error) {
+	startedAt := time.Now()
+	task, r := startCarProgress("car compress", carPath, in)
+	defer func() { task.Done(retErr) }()
+	out := &countingWriter{}
+	table, err := compressCar(bufio.NewReaderSize(r, 8*1024*1024), out, frameSize, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress car: %w", err)
+	}
+	klog.Infof("Done in %s", time.Since(startedAt))
+	plan := &dryRunPlan{}
+	plan.add(outPath, out.n, fmt.Sprintf(
+		"seekable zstd CAR with %s frames (%s decompressed, ratio %.2f)",
+		humanize.Comma(int64(len(table.Frames))),
+		humanize.IBytes(uint64(table.DecompressedSize())),
+		ratio(uint64(table.DecompressedSize()), uint64(out.n)),
+	))
+	return plan, nil
+}
+
+func newCmd_CarSeekTable() *cli.Command {
+	var outPath string
+	return &cli.Command{
+		Name:        "seektable",
+		Usage:       "Write the seek table sidecar of a zstd-compressed CAR made of multiple frames.",
+		Description: "Scan the frames of a zstd-compressed CAR that has no seek table (e.g. compressed by another tool, in multiple frames), and write their seek table to a sidecar file, next to the CAR by default (<car-path>" + seekTableSidecarSuffix + "), where the RPC server looks for it. A CAR compressed as a single frame (like with a plain `zstd` command) can't be read at random offsets: recompress it with `car compress` instead.",
+		ArgsUsage:   "<car.zst-path>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the sidecar file; defaults to the path of the CAR with a " + seekTableSidecarSuffix + " suffix",
+				Destination: &outPath,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			carPath := c.Args().Get(0)
+			if carPath == "" {
+				return fmt.Errorf("missing car-path argument")
+			}
+			if outPath == "" {
+				outPath = carPath + seekTableSidecarSuffix
+			}
+			in, err := os.Open(carPath)
+			if err != nil {
+				return fmt.Errorf("failed to open car: %w", err)
+			}
+			defer in.Close()
+			startedAt := time.Now()
+			table, err := seekablezstd.ScanFrames(in)
+			if err != nil {
+				return fmt.Errorf("failed to scan the frames of %s: %w", carPath, err)
+			}
+			buf, err := table.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(outPath, buf, 0o644); err != nil {
+				return err
+			}
+			klog.Infof("Wrote the seek table of %d frames (%s decompressed) to %s in %s",
+				len(table.Frames),
+				humanize.IBytes(uint64(table.DecompressedSize())),
+				outPath,
+				time.Since(startedAt),
+			)
+			return nil
+		},
+	}
+}
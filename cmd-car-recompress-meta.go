@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_CarRecompressMeta() *cli.Command {
+	var outPath string
+	var level int
+	var dictPath string
+	var inputDicts cli.StringSlice
+	var samplesDir string
+	var numSamples int
+	var indexDir string
+	var verify bool
+	var dryRun bool
+	var network indexes.Network
+	return &cli.Command{
+		Name:        "recompress-meta",
+		Usage:       "Recompress the metadata of the transactions of a CAR with a different zstd level or a dictionary.",
+		Description: "Recompress the transaction metadata at another zstd level, or with a dictionary, and print the before/after sizes and decompression times (i.e. the storage saved and the CPU cost of serving them). With --out, write the new CAR: the transactions, entries, blocks, subsets and epoch that change get new CIDs (so the CAR gets a new root, and the indexes must be created again, e.g. with --index-dir). The metadata split in multiple DataFrames are left as they are. To train a dictionary, dump samples with --dump-samples and run `zstd --train <dir>/* -o meta.dict`. The RPC server needs the dictionary to serve the new CAR (see `rpc --zstd-dict`).",
+		ArgsUsage:   "<car-path>",
+		Before: func(c *cli.Context) error {
+			if network == "" {
+				network = indexes.NetworkMainnet
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the new CAR to write; if empty, only the statistics are printed",
+				Destination: &outPath,
+			},
+			&cli.IntFlag{
+				Name:        "level",
+				Usage:       "zstd compression level (1-22)",
+				Value:       19,
+				Destination: &level,
+			},
+			&cli.StringFlag{
+				Name:        "dict",
+				Usage:       "path of the zstd dictionary to compress with (e.g. trained with `zstd --train`)",
+				Destination: &dictPath,
+			},
+			&cli.StringSliceFlag{
+				Name:        "zstd-dict",
+				Usage:       "path of the zstd dictionaries that the metadata of the input CAR were compressed with, if any",
+				Destination: &inputDicts,
+			},
+			&cli.StringFlag{
+				Name:        "dump-samples",
+				Usage:       "instead of recompressing, write uncompressed metadata samples to this dir, to train a dictionary",
+				Destination: &samplesDir,
+			},
+			&cli.IntFlag{
+				Name:        "num-samples",
+				Usage:       "number of samples to write with --dump-samples",
+				Value:       10_000,
+				Destination: &numSamples,
+			},
+			&cli.StringFlag{
+				Name:        "index-dir",
+				Usage:       "create all the indexes for the new CAR in this dir (requires --out)",
+				Destination: &indexDir,
+			},
+			&cli.BoolFlag{
+				Name:        "verify",
+				Usage:       "verify the indexes after creating them",
+				Destination: &verify,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "read the CAR and print what would be written (the new CAR, with its exact size, root and slot range, and the indexes), without writing anything",
+				Destination: &dryRun,
+			},
+			&cli.StringFlag{
+				Name:  "tmp-dir",
+				Usage: "temporary directory to use for storing intermediate files",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "the cluster of the epoch; one of: mainnet, testnet, devnet",
+				Action: func(c *cli.Context, s string) error {
+					network = indexes.Network(s)
+					if !indexes.IsValidNetwork(network) {
+						return fmt.Errorf("invalid network: %q", network)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			carPath := c.Args().Get(0)
+			if carPath == "" {
+				return fmt.Errorf("missing car-path argument")
+			}
+			if indexDir != "" && outPath == "" {
+				return fmt.Errorf("--index-dir requires --out")
+			}
+			if outPath == carPath {
+				return fmt.Errorf("--out must be different from the input CAR")
+			}
+			if dryRun && samplesDir != "" {
+				return fmt.Errorf("--dry-run can't be used with --dump-samples")
+			}
+			var dict []byte
+			decodeDicts := inputDicts.Value()
+			if dictPath != "" {
+				var err error
+				dict, err = os.ReadFile(dictPath)
+				if err != nil {
+					return fmt.Errorf("failed to read dictionary: %w", err)
+				}
+				// to check the recompressed metadata.
+				decodeDicts = append(decodeDicts, dictPath)
+			}
+			if err := loadZstdDictionaries(decodeDicts); err != nil {
+				return err
+			}
+
+			file, err := openCarFile(carPath)
+			if err != nil {
+				return fmt.Errorf("failed to open car: %w", err)
+			}
+			defer file.Close()
+
+			startedAt := time.Now()
+			if samplesDir != "" {
+				if err := os.MkdirAll(samplesDir, 0o755); err != nil {
+					return err
+				}
+				task, in := startCarProgress("car recompress-meta", carPath, file)
+				n, err := dumpMetaSamples(c.Context, in, samplesDir, numSamples)
+				task.Done(err)
+				if err != nil {
+					return err
+				}
+				klog.Infof("Wrote %d samples to %s in %s; train a dictionary with: zstd --train %s/* -o meta.dict", n, samplesDir, time.Since(startedAt), samplesDir)
+				return nil
+			}
+
+			recompressor, err := newMetaRecompressor(level, dict)
+			if err != nil {
+				return err
+			}
+			task, in := startCarProgress("car recompress-meta", carPath, file)
+			if dryRun {
+				stats, plan, err := planCarMetaRecompression(c.Context, recompressor, in, outPath, indexDir, network)
+				task.Done(err)
+				if err != nil {
+					return err
+				}
+				klog.Infof("Done in %s", time.Since(startedAt))
+				fmt.Println(stats.String())
+				fmt.Println(plan.String())
+				return nil
+			}
+			stats, err := recompressCarMetaToFile(c.Context, recompressor, in, outPath)
+			task.Done(err)
+			if err != nil {
+				return err
+			}
+			klog.Infof("Done in %s", time.Since(startedAt))
+			fmt.Println(stats.String())
+			if outPath == "" {
+				return nil
+			}
+			klog.Infof("New CAR written to %s", outPath)
+			if indexDir == "" {
+				klog.Info("Skipping the indexes; the indexes of the original CAR can't be used with the new one.")
+				return nil
+			}
+			klog.Infof("Creating all indexes for %s in %s", outPath, indexDir)
+			indexPaths, numTotalItems, err := createAllIndexes(
+				c.Context,
+				network,
+				c.String("tmp-dir"),
+				outPath,
+				indexDir,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create indexes: %w", err)
+			}
+			klog.Info("Indexes created:")
+			fmt.Println(indexPaths.String())
+			if verify {
+				return verifyAllIndexes(
+					context.Background(),
+					outPath,
+					indexPaths,
+					numTotalItems,
+				)
+			}
+			return nil
+		},
+	}
+}
+
+// recompressCarMetaToFile writes the recompressed CAR to outPath (if not empty), with its new root.
+func recompressCarMetaToFile(ctx context.Context, recompressor *metaRecompressor, in io.Reader, outPath string) (*carRecompressStats, error) {
+	if outPath == "" {
+		stats, _, err := recompressor.recompress(ctx, in, io.Discard)
+		return stats, err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output car: %w", err)
+	}
+	bw := bufio.NewWriterSize(out, 8*1024*1024)
+	stats, header, err := recompressor.recompress(ctx, in, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = rewriteCarHeaderRoot(out, header, stats.NewRoot)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return nil, err
+	}
+	return stats, nil
+}
+
+// planCarMetaRecompression recompresses the metadata like recompressCarMetaToFile, and returns what
+// it would write to outPath (and indexDir, if not empty), without writing anything.
+func planCarMetaRecompression(ctx context.Context, recompressor *metaRecompressor, in io.Reader, outPath string, indexDir string, network indexes.Network) (*carRecompressStats, *dryRunPlan, error) {
+	out := &countingWriter{}
+	stats, _, err := recompressor.recompress(ctx, in, out)
+	if err != nil {
+		return nil, nil, err
+	}
+	plan := &dryRunPlan{}
+	if outPath != "" {
+		plan.addCar(outPath, out.n, &stats.Contents)
+		if indexDir != "" {
+			plan.addIndexes(indexDir, network, &stats.Contents)
+		}
+	}
+	return stats, plan, nil
+}
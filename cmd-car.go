@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Car() *cli.Command {
+	return &cli.Command{
+		Name:        "car",
+		Usage:       "Analyze and rewrite CAR files.",
+		Description: "Analyze and rewrite CAR files.",
+		Subcommands: []*cli.Command{
+			newCmd_CarDedup(),
+			newCmd_CarRecompressMeta(),
+			newCmd_CarCompress(),
+			newCmd_CarSeekTable(),
+			newCmd_CarAccountSnapshot(),
+		},
+	}
+}
+
+func newCmd_CarDedup() *cli.Command {
+	var outPath string
+	var indexDir string
+	var verify bool
+	var dryRun bool
+	var network indexes.Network
+	return &cli.Command{
+		Name:        "dedup",
+		Usage:       "Find the identical DataFrame and Rewards nodes of a CAR, and optionally rewrite it without the duplicates.",
+		Description: "Report how many DataFrame and Rewards nodes of the CAR are identical to a previous one (i.e. have the same CID), and how much space removing them would save. With --out, write a new CAR with only the first occurrence of each of them; with --index-dir, also create all the indexes for the new CAR (the offsets change, so the indexes of the original CAR can't be used with it).",
+		ArgsUsage:   "<car-path>",
+		Before: func(c *cli.Context) error {
+			if network == "" {
+				network = indexes.NetworkMainnet
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the deduplicated CAR to write; if empty, only the report is printed",
+				Destination: &outPath,
+			},
+			&cli.StringFlag{
+				Name:        "index-dir",
+				Usage:       "create all the indexes for the deduplicated CAR in this dir (requires --out)",
+				Destination: &indexDir,
+			},
+			&cli.BoolFlag{
+				Name:        "verify",
+				Usage:       "verify the indexes after creating them",
+				Destination: &verify,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "read the CAR and print what would be written (the deduplicated CAR, with its exact size and slot range, and the indexes), without writing anything",
+				Destination: &dryRun,
+			},
+			&cli.StringFlag{
+				Name:  "tmp-dir",
+				Usage: "temporary directory to use for storing intermediate files",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "the cluster of the epoch; one of: mainnet, testnet, devnet",
+				Action: func(c *cli.Context, s string) error {
+					network = indexes.Network(s)
+					if !indexes.IsValidNetwork(network) {
+						return fmt.Errorf("invalid network: %q", network)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			carPath := c.Args().Get(0)
+			if carPath == "" {
+				return fmt.Errorf("missing car-path argument")
+			}
+			if indexDir != "" {
+				if outPath == "" {
+					return fmt.Errorf("--index-dir requires --out")
+				}
+				if ok, err := isDirectory(indexDir); err != nil {
+					return err
+				} else if !ok {
+					return fmt.Errorf("index-dir is not a directory")
+				}
+			}
+			if outPath == carPath {
+				return fmt.Errorf("--out must be different from the input CAR")
+			}
+
+			startedAt := time.Now()
+			if dryRun {
+				report, plan, err := planCarDeduplicated(c.Context, carPath, outPath, indexDir, network)
+				if err != nil {
+					return err
+				}
+				klog.Infof("Done in %s", time.Since(startedAt))
+				fmt.Println(report.String())
+				fmt.Println(plan.String())
+				return nil
+			}
+			report, err := rewriteCarDeduplicated(c.Context, carPath, outPath)
+			if err != nil {
+				return err
+			}
+			klog.Infof("Done in %s", time.Since(startedAt))
+			fmt.Println(report.String())
+			if outPath == "" {
+				return nil
+			}
+			klog.Infof("Deduplicated CAR written to %s", outPath)
+			if indexDir == "" {
+				klog.Info("Skipping the indexes; the indexes of the original CAR can't be used with the new one.")
+				return nil
+			}
+			klog.Infof("Creating all indexes for %s in %s", outPath, indexDir)
+			indexPaths, numTotalItems, err := createAllIndexes(
+				c.Context,
+				network,
+				c.String("tmp-dir"),
+				outPath,
+				indexDir,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to create indexes: %w", err)
+			}
+			klog.Info("Indexes created:")
+			fmt.Println(indexPaths.String())
+			if verify {
+				return verifyAllIndexes(
+					context.Background(),
+					outPath,
+					indexPaths,
+					numTotalItems,
+				)
+			}
+			return nil
+		},
+	}
+}
+
+// rewriteCarDeduplicated analyzes the CAR, and writes the deduplicated one to outPath (if not empty).
+func rewriteCarDeduplicated(ctx context.Context, carPath string, outPath string) (_ *carDedupReport, retErr error) {
+	file, err := openCarFile(carPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open car: %w", err)
+	}
+	defer file.Close()
+	task, in := startCarProgress("car dedup", carPath, file)
+	defer func() { task.Done(retErr) }()
+	if outPath == "" {
+		return dedupCar(ctx, in, nil)
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output car: %w", err)
+	}
+	bw := bufio.NewWriterSize(out, 8*1024*1024)
+	report, err := dedupCar(ctx, in, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+		return nil, err
+	}
+	return report, nil
+}
+
+// planCarDeduplicated analyzes the CAR like rewriteCarDeduplicated, and returns what it would write
+// to outPath (and indexDir, if not empty), without writing anything.
+func planCarDeduplicated(ctx context.Context, carPath string, outPath string, indexDir string, network indexes.Network) (_ *carDedupReport, _ *dryRunPlan, retErr error) {
+	plan := &dryRunPlan{}
+	if outPath == "" {
+		report, err := rewriteCarDeduplicated(ctx, carPath, "")
+		return report, plan, err
+	}
+	file, err := openCarFile(carPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open car: %w", err)
+	}
+	defer file.Close()
+	task, in := startCarProgress("car dedup", carPath, file)
+	defer func() { task.Done(retErr) }()
+	out := &countingWriter{}
+	report, err := dedupCar(ctx, in, out)
+	if err != nil {
+		return nil, nil, err
+	}
+	report.Rewritten = false
+	plan.addCar(outPath, out.n, &report.Contents)
+	if indexDir != "" {
+		plan.addIndexes(indexDir, network, &report.Contents)
+	}
+	return report, plan, nil
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"strconv"
 	"strings"
@@ -117,12 +116,12 @@ func newCmd_DumpCar() *cli.Command {
 			}
 
 			carPath := c.Args().First()
-			var file fs.File
+			var file io.ReadCloser
 			var err error
 			if carPath == "-" {
 				file = os.Stdin
 			} else {
-				file, err = os.Open(carPath)
+				file, err = openCarFile(carPath)
 				if err != nil {
 					klog.Exit(err.Error())
 				}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"github.com/urfave/cli/v2"
+	"github.com/ybbus/jsonrpc/v3"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_preheat() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	return &cli.Command{
+		Name:        "preheat",
+		Usage:       "Warm the OS page cache for a slot range.",
+		Description: "Sequentially read the CAR byte ranges for the given slot range (resolved via the indexes) to warm the OS page cache before an expected traffic spike. A running RPC server can do the same via the admin API (POST /preheat?from=<slot>&to=<slot>).",
+		ArgsUsage:   "<one or more config files or directories containing config files (nested is fine)>",
+		Before: func(c *cli.Context) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to preheat",
+				Required:    true,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to preheat (inclusive)",
+				Required:    true,
+				Destination: &toSlot,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			configFiles, err := GetListOfConfigFiles(
+				c.Args().Slice(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			configs := make(ConfigSlice, 0)
+			for _, configFile := range configFiles {
+				config, err := LoadConfig(configFile)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("failed to load config file %q: %s", configFile, err.Error()), 1)
+				}
+				if config.IsFilecoinMode() {
+					klog.Infof("Config %q is in filecoin mode; skipping", configFile)
+					continue
+				}
+				start, stop := CalcEpochLimits(*config.Epoch)
+				if !Uint64RangesHavePartialOverlapIncludingEdges([2]uint64{start, stop}, [2]uint64{fromSlot, toSlot}) {
+					continue
+				}
+				configs = append(configs, config)
+			}
+			if err := configs.Validate(); err != nil {
+				return cli.Exit(fmt.Sprintf("error validating configs: %s", err.Error()), 1)
+			}
+			configs.SortByEpoch()
+			if len(configs) == 0 {
+				return cli.Exit(fmt.Sprintf("no epoch configs overlap with slot range %d-%d", fromSlot, toSlot), 1)
+			}
+
+			// The cache is only needed to satisfy the epoch; keep it small.
+			conf := bigcache.DefaultConfig(5 * time.Minute)
+			conf.HardMaxCacheSize = 64
+			allCache, err := hugecache.NewWithConfig(c.Context, conf)
+			if err != nil {
+				return fmt.Errorf("failed to create cache: %w", err)
+			}
+
+			lotusAPIAddress := "https://api.node.glif.io"
+			cl := jsonrpc.NewClient(lotusAPIAddress)
+			minerInfo := splitcarfetcher.NewMinerInfo(
+				cl,
+				24*time.Hour,
+				5*time.Second,
+			)
+
+			startedAt := time.Now()
+			var totalBytes uint64
+			for _, config := range configs {
+				epoch, err := NewEpochFromConfig(config, c, allCache, minerInfo)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("failed to create epoch from config %q: %s", config.ConfigFilepath(), err.Error()), 1)
+				}
+				result, err := epoch.Preheat(c.Context, fromSlot, toSlot)
+				epoch.Close()
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("failed to preheat epoch %d: %s", *config.Epoch, err.Error()), 1)
+				}
+				klog.Infof(
+					"Preheated epoch %d (slots %d-%d): read %d bytes in %s",
+					result.Epoch,
+					result.FirstSlot,
+					result.LastSlot,
+					result.BytesRead,
+					result.Took,
+				)
+				totalBytes += result.BytesRead
+			}
+			klog.Infof("Preheated %d epochs: read %d bytes in %s", len(configs), totalBytes, time.Since(startedAt))
+			return nil
+		},
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Replay() *cli.Command {
+	return &cli.Command{
+		Name:        "replay",
+		Usage:       "Replay the transactions of the epochs to downstream consumers.",
+		Description: "Read the transactions of a slot range from the CARs of the epochs (sequentially, starting at the first slot via the indexes), select them with a filter, and deliver them to downstream consumers, e.g. to backfill them from the history.",
+		Subcommands: []*cli.Command{
+			newCmd_ReplayWebhook(),
+		},
+	}
+}
+
+// newTransactionFilterFlags returns the flags of the transaction filter of the replays.
+func newTransactionFilterFlags(accounts *cli.StringSlice, programs *cli.StringSlice, includeVote *bool, includeFailed *bool) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "account",
+			Usage:       "select the transactions that reference any of these accounts (repeatable)",
+			Destination: accounts,
+		},
+		&cli.StringSliceFlag{
+			Name:        "program",
+			Usage:       "select the transactions that invoke any of these programs (repeatable)",
+			Destination: programs,
+		},
+		&cli.BoolFlag{
+			Name:        "include-vote",
+			Usage:       "also select the vote transactions",
+			Destination: includeVote,
+		},
+		&cli.BoolFlag{
+			Name:        "include-failed",
+			Usage:       "also select the failed transactions",
+			Destination: includeFailed,
+		},
+	}
+}
+
+func newCmd_ReplayWebhook() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	var urls cli.StringSlice
+	var secret string
+	var encoding string
+	var batchSize int
+	var retries int
+	var retryDelay time.Duration
+	var timeout time.Duration
+	var accounts cli.StringSlice
+	var programs cli.StringSlice
+	var includeVote bool
+	var includeFailed bool
+	var consumersPath string
+	var pacing replayPacing
+	var cursorFlags replayCursorFlags
+	var fillGapsFrom string
+	return &cli.Command{
+		Name:        "webhook",
+		Usage:       "POST the transactions of a slot range to webhooks.",
+		Description: "POST the transactions of the slot range selected by the filter to the webhooks, as JSON arrays of getTransaction results, in slot order. With --secret, each request is signed: the X-Faithful-Signature header is sha256=<hex of the HMAC-SHA256 of '<X-Faithful-Timestamp>.<body>'>. The X-Faithful-Delivery header identifies the content of a request, for the deduplication of the retries. A delivery that still fails after the retries stops the replay, with the slot to restart from.",
+		ArgsUsage:   "<one or more config files or directories containing config files (nested is fine)>",
+		Flags: append([]cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to replay",
+				Value:       0,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to replay (inclusive); 0 means no limit",
+				Value:       0,
+				Destination: &toSlot,
+			},
+			&cli.StringSliceFlag{
+				Name:        "url",
+				Usage:       "URL of a webhook (repeatable; each gets all the transactions)",
+				Destination: &urls,
+			},
+			&cli.StringFlag{
+				Name:        "consumers",
+				Usage:       "JSON or YAML file of the consumers, each with its own webhooks, filter and cursor, fed by the same read of the CARs (instead of --url and the filter flags)",
+				Destination: &consumersPath,
+			},
+			&cli.StringFlag{
+				Name:        "secret",
+				Usage:       "secret of the HMAC signatures of the requests",
+				EnvVars:     []string{"FAITHFUL_WEBHOOK_SECRET"},
+				Destination: &secret,
+			},
+			&cli.StringFlag{
+				Name:        "encoding",
+				Usage:       "encoding of the transactions: json, jsonParsed, base64, base64+zstd or base58",
+				Value:       string(solana.EncodingJSON),
+				Destination: &encoding,
+			},
+			&cli.IntFlag{
+				Name:        "batch-size",
+				Usage:       "maximum number of transactions of a request",
+				Value:       1,
+				Destination: &batchSize,
+			},
+			&cli.IntFlag{
+				Name:        "retries",
+				Usage:       "number of retries of a failed request (network errors, 5xx and 429 responses)",
+				Value:       5,
+				Destination: &retries,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-delay",
+				Usage:       "delay before the first retry of a request, doubled at each retry",
+				Value:       time.Second,
+				Destination: &retryDelay,
+			},
+			&cli.DurationFlag{
+				Name:        "timeout",
+				Usage:       "timeout of each request",
+				Value:       30 * time.Second,
+				Destination: &timeout,
+			},
+			&cli.StringFlag{
+				Name:        "fill-gaps-from",
+				Usage:       "proxy config file (like the --proxy of the rpc command) of an RPC server to fetch the blocks of the slots that no epoch config covers from; these transactions have \"source\": \"upstream\"",
+				Destination: &fillGapsFrom,
+			},
+		}, append(append(newTransactionFilterFlags(&accounts, &programs, &includeVote, &includeFailed), newReplayPacingFlags(&pacing)...), newReplayCursorFlags(&cursorFlags)...)...),
+		Action: func(c *cli.Context) (retErr error) {
+			if c.Args().Len() < 1 {
+				return cli.Exit("expected at least one config file or directory", 1)
+			}
+			if toSlot == 0 {
+				toSlot = ^uint64(0)
+			}
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			if err := pacing.Validate(); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			var consumerConfigs []webhookConsumerConfig
+			switch {
+			case consumersPath != "" && len(urls.Value()) > 0:
+				return cli.Exit("--url and --consumers are mutually exclusive", 1)
+			case consumersPath != "":
+				var err error
+				consumerConfigs, err = loadWebhookConsumers(consumersPath)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+			case len(urls.Value()) > 0:
+				consumerConfigs = []webhookConsumerConfig{{
+					ID:     cursorFlags.consumerID,
+					URLs:   urls.Value(),
+					Secret: secret,
+					Filter: transactionFilterConfig{
+						Accounts:      accounts.Value(),
+						Programs:      programs.Value(),
+						IncludeVote:   includeVote,
+						IncludeFailed: includeFailed,
+					},
+				}}
+			default:
+				return cli.Exit("expected --url or --consumers", 1)
+			}
+
+			httpClient := &http.Client{Timeout: timeout}
+			task := progress.Start("replay webhook")
+			defer func() { task.Done(retErr) }()
+			var consumers []replayConsumer
+			for _, config := range consumerConfigs {
+				consumer, ok, err := newWebhookConsumer(config, encoding, batchSize, fromSlot, toSlot, &cursorFlags)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				if !ok {
+					klog.Infof("Consumer %q already replayed the slot range", config.ID)
+					continue
+				}
+				for _, url := range config.URLs {
+					consumer.batcher.webhooks = append(consumer.batcher.webhooks, &webhook{
+						url:        url,
+						secret:     config.Secret,
+						httpClient: httpClient,
+						retries:    retries,
+						retryDelay: retryDelay,
+					})
+				}
+				consumer.batcher.pacer = newReplayPacer(pacing)
+				consumer.onDelivered = func(size int) {
+					task.Add(1, uint64(size))
+				}
+				klog.Infof("Consumer %q: %d webhooks from slot %d (%s)", consumer.name, len(config.URLs), consumer.from, consumer.filter.String())
+				consumers = append(consumers, consumer)
+			}
+			if len(consumers) == 0 {
+				return nil
+			}
+			fanOut := newReplayFanOut(consumers)
+			configs, err := loadConfigsForSlotRange(
+				c.Args().Slice(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+				fanOut.fromSlot(),
+				toSlot,
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			scanner, err := newEpochScanner(c)
+			if err != nil {
+				return err
+			}
+
+			var filler *upstreamGapFiller
+			if fillGapsFrom != "" {
+				proxyConfig, err := LoadProxyConfig(fillGapsFrom)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("failed to load proxy config file %q: %s", fillGapsFrom, err.Error()), 1)
+				}
+				filler = &upstreamGapFiller{
+					source: newUpstreamBlockSource(proxyConfig, httpClient),
+					gaps:   upstreamGaps(configs, fanOut.fromSlot(), toSlot),
+				}
+				if len(filler.gaps) > 0 {
+					klog.Infof("Will fill %d slot ranges from %q", len(filler.gaps), proxyConfig.Target)
+				}
+			}
+
+			klog.Infof("Replaying the transactions of the slots %d-%d of %d epochs to %d consumers (%s)", fanOut.fromSlot(), toSlot, len(configs), len(consumers), pacing.String())
+			startedAt := time.Now()
+			if err := replayToConsumers(c.Context, scanner, configs, toSlot, newReplayPacer(pacing), filler, consumers); err != nil {
+				return err
+			}
+			if filler != nil {
+				klog.Infof("Filled %d blocks from the upstream", filler.filled)
+			}
+			for _, consumer := range consumers {
+				klog.Infof("Consumer %q: delivered %d transactions", consumer.id(), consumer.(*webhookConsumer).batcher.delivered)
+			}
+			klog.Infof("Replay done in %s", time.Since(startedAt))
+			return nil
+		},
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/allegro/bigcache/v3"
 	"github.com/fsnotify/fsnotify"
 	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/logging"
+	remotecache "github.com/rpcpool/yellowstone-faithful/remote-cache"
 	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
 	"github.com/ryanuber/go-glob"
 	"github.com/urfave/cli/v2"
@@ -30,8 +33,49 @@ func newCmd_rpc() *cli.Command {
 	var watch bool
 	var pathForProxyForUnknownRpcMethods string
 	var epochSearchConcurrency int
+	var epochSearchOrder string
 	var epochLoadConcurrency int
+	var fetchConcurrency int
+	var responseCacheTTL time.Duration
+	var responseCacheMaxSizeMB int
+	var responseCacheRemote string
+	var blockAssemblyCacheSizeMB int
+	var auditLogPath string
+	var discrepancyLogPath string
+	var slowQueryThreshold time.Duration
+	var slowQueryLogPath string
+	var shedReadLatency time.Duration
+	var shedQueueDepth int
+	var priorityConfigPath string
 	var maxCacheSizeMB int
+	var rebuildIndexes bool
+	var rebuildIndexesTmpDir string
+	var sampleIndexes int
+	var sampleIndexesMaxMismatchRate float64
+	var sampleIndexesDegrade bool
+	var standbyLatencySLO time.Duration
+	var standbyFailoverAfter int
+	var standbyFailbackAfter time.Duration
+	var integrityCheckInterval time.Duration
+	var integrityAlertWebhook string
+	var integrityAlertExec string
+	var adminListenOn string
+	var compatMethods cli.StringSlice
+	var largeIntsAsStrings bool
+	var apiVersion string
+	var requestTimeout time.Duration
+	var maxBlockTransactions int
+	var pluginPaths cli.StringSlice
+	var zstdDicts cli.StringSlice
+	var epochsToResolve cli.Uint64Slice
+	var artifactRegistry string
+	var epochDir string
+	var epochDownloadIndexes bool
+	var artifactCacheDir string
+	var artifactCacheMaxSizeMB int
+	var artifactCacheMaxIdle time.Duration
+	var artifactCachePins cli.StringSlice
+	var artifactCacheGCInterval time.Duration
 	return &cli.Command{
 		Name:        "rpc",
 		Usage:       "Start a Solana JSON RPC server.",
@@ -83,18 +127,264 @@ func newCmd_rpc() *cli.Command {
 				Value:       runtime.NumCPU(),
 				Destination: &epochSearchConcurrency,
 			},
+			&cli.StringFlag{
+				Name:        "epoch-search-order",
+				Usage:       "How to search the epochs for a signature: bloom (check the sig-exists indexes of all the epochs first, then look up the candidates, newest first), newest-first or oldest-first (look up the sig-to-cid indexes directly)",
+				Value:       string(EpochSearchBloom),
+				Destination: &epochSearchOrder,
+			},
 			&cli.IntFlag{
 				Name:        "epoch-load-concurrency",
 				Usage:       "How many epochs to load in parallel when starting the RPC server",
 				Value:       runtime.NumCPU(),
 				Destination: &epochLoadConcurrency,
 			},
+			&cli.IntFlag{
+				Name:        "fetch-concurrency",
+				Usage:       "How many DAG nodes (entries, transactions, etc.) to fetch in parallel, shared by all the requests",
+				Value:       runtime.NumCPU() * 2,
+				Destination: &fetchConcurrency,
+			},
+			&cli.BoolFlag{
+				Name:        "rebuild-indexes",
+				Usage:       "Rebuild from the (local) CAR file, in the background, the slot-to-cid and sig-to-cid index files that are missing, fail their checksum, or don't match their epoch; the methods that need them are unavailable until done",
+				Value:       false,
+				Destination: &rebuildIndexes,
+			},
+			&cli.StringFlag{
+				Name:        "rebuild-indexes-tmp-dir",
+				Usage:       "Where to write the intermediate files while rebuilding indexes (default: the system's temp dir)",
+				Value:       "",
+				Destination: &rebuildIndexesTmpDir,
+			},
+			&cli.IntFlag{
+				Name:        "sample-indexes",
+				Usage:       "When loading an epoch (from a CAR file), verify this many random entries of each of its indexes against the CAR (the node at the offset, the block of the slot, the transaction of the signature), to catch an index that is not of the CAR; disabled if 0",
+				Value:       0,
+				Destination: &sampleIndexes,
+			},
+			&cli.Float64Flag{
+				Name:        "sample-indexes-max-mismatch-rate",
+				Usage:       "The highest share (0 to 1) of the sampled entries of an index that may not match the CAR; above it, the epoch fails to load (see --sample-indexes-degrade)",
+				Value:       0,
+				Destination: &sampleIndexesMaxMismatchRate,
+			},
+			&cli.BoolFlag{
+				Name:        "sample-indexes-degrade",
+				Usage:       "Serve the epochs with an index above --sample-indexes-max-mismatch-rate anyway, with a warning and the index_sample_mismatch_rate metric",
+				Value:       false,
+				Destination: &sampleIndexesDegrade,
+			},
+			&cli.DurationFlag{
+				Name:        "standby-latency-slo",
+				Usage:       "For the epochs with a standby (the standby section of their config), a read from their storage (CAR read or index lookup) slower than this counts as a failed read; disabled if 0",
+				Value:       DefaultStandbyFailoverConfig.LatencySLO,
+				Destination: &standbyLatencySLO,
+			},
+			&cli.IntFlag{
+				Name:        "standby-failover-after",
+				Usage:       "Promote the standby of an epoch after this many consecutive failed reads of the epoch",
+				Value:       DefaultStandbyFailoverConfig.FailoverAfter,
+				Destination: &standbyFailoverAfter,
+			},
+			&cli.DurationFlag{
+				Name:        "standby-failback-after",
+				Usage:       "How long a promoted standby serves its epoch before the epoch is tried again",
+				Value:       DefaultStandbyFailoverConfig.FailbackAfter,
+				Destination: &standbyFailbackAfter,
+			},
+			&cli.DurationFlag{
+				Name:        "integrity-check-interval",
+				Usage:       "Re-verify the sha256 (from the epoch configs) of the local CAR and index files of the loaded epochs at this interval, and alert when a file fails; disabled if 0",
+				Value:       0,
+				Destination: &integrityCheckInterval,
+			},
+			&cli.StringFlag{
+				Name:        "integrity-alert-webhook",
+				Usage:       "URL to POST (as JSON) the files that fail their integrity check",
+				Value:       "",
+				Destination: &integrityAlertWebhook,
+			},
+			&cli.StringFlag{
+				Name:        "integrity-alert-exec",
+				Usage:       "Shell command to run for each file that fails its integrity check (with the failure as JSON on its stdin, and in FAITHFUL_INTEGRITY_* environment variables)",
+				Value:       "",
+				Destination: &integrityAlertExec,
+			},
 			&cli.IntFlag{
 				Name:        "max-cache",
 				Usage:       "Maximum size of the cache in MB",
 				Value:       0,
 				Destination: &maxCacheSizeMB,
 			},
+			&cli.DurationFlag{
+				Name:        "response-cache-ttl",
+				Usage:       "How long to cache the responses of identical requests (getBlock, getTransaction, etc.); disabled if 0",
+				Value:       0,
+				Destination: &responseCacheTTL,
+			},
+			&cli.IntFlag{
+				Name:        "response-cache-max-size",
+				Usage:       "Maximum size of the response cache in MB",
+				Value:       1024,
+				Destination: &responseCacheMaxSizeMB,
+			},
+			&cli.StringFlag{
+				Name:        "response-cache-remote",
+				Usage:       "URL of a cache shared by all the replicas for the response cache, e.g. redis://localhost:6379/0 or memcached://localhost:11211",
+				Value:       "",
+				Destination: &responseCacheRemote,
+			},
+			&cli.IntFlag{
+				Name:        "block-assembly-cache-size",
+				Usage:       "Maximum size in MB of the cache of the blocks read by getBlock (transactions and rewards, by block CID), shared by the requests with different encodings and options; disabled if 0",
+				Value:       0,
+				Destination: &blockAssemblyCacheSizeMB,
+			},
+			&cli.StringFlag{
+				Name:        "audit-log",
+				Usage:       "Path to a JSONL file where to append a record for every request (time, token fingerprint, method, slot/signature, bytes served, source CIDs)",
+				Value:       "",
+				Destination: &auditLogPath,
+			},
+			&cli.StringFlag{
+				Name:        "discrepancy-log",
+				Usage:       "Path to a JSONL file where to append the nodes read from a CAR that don't match their CID (with the alternate source that had them, if any), for the repair of the CAR files",
+				Value:       "",
+				Destination: &discrepancyLogPath,
+			},
+			&cli.DurationFlag{
+				Name:        "slow-query-threshold",
+				Usage:       "Requests that take longer than this are written to the slow-query log, with their per-phase timing; disabled if 0",
+				Value:       0,
+				Destination: &slowQueryThreshold,
+			},
+			&cli.StringFlag{
+				Name:        "slow-query-log",
+				Usage:       "Path to a JSONL file where to append the slow queries; if empty, they are written to the logs",
+				Value:       "",
+				Destination: &slowQueryLogPath,
+			},
+			&cli.DurationFlag{
+				Name:        "shed-read-latency",
+				Usage:       "When the average latency of the reads from the CAR files is above this, the heavy requests (getBlock, getSignaturesForAddress, faithful_getTransactions) are rejected with a Retry-After; disabled if 0",
+				Value:       0,
+				Destination: &shedReadLatency,
+			},
+			&cli.IntFlag{
+				Name:        "shed-queue-depth",
+				Usage:       "When more than this many DAG fetches are waiting for a worker, the heavy requests are rejected with a Retry-After; disabled if 0",
+				Value:       0,
+				Destination: &shedQueueDepth,
+			},
+			&cli.StringFlag{
+				Name:        "priority-config",
+				Usage:       "Path to a JSON or YAML file that assigns priority classes (low, normal, high) to methods and client tokens, and the share of the fetch workers of each class",
+				Value:       "",
+				Destination: &priorityConfigPath,
+			},
+			&cli.StringFlag{
+				Name:        "admin-listen",
+				Usage:       "Listen address for the admin API (cache stats, pinning, invalidation); disabled if empty. Do not expose publicly.",
+				Value:       "",
+				Destination: &adminListenOn,
+			},
+			&cli.StringSliceFlag{
+				Name:        "compat-methods",
+				Usage:       "Answer these methods that generic clients call but that are not about the archive (getBlockCommitment, getSlotLeader, minimumLedgerSlot), and give a clean error for the methods about the live state (unsupported); or all",
+				Value:       cli.NewStringSlice(),
+				Destination: &compatMethods,
+			},
+			&cli.BoolFlag{
+				Name:        "json-large-ints-as-strings",
+				Usage:       "Return the integers of the responses above 2^53-1 (e.g. lamports, u64 balances) as strings, for the JavaScript clients; a request can override it with the X-Large-Ints-As-Strings header",
+				Value:       false,
+				Destination: &largeIntsAsStrings,
+			},
+			&cli.StringFlag{
+				Name:        "api-version",
+				Usage:       "The API version of the requests that don't select one (with the POST /v0 or /v1 route, or the X-Faithful-Api-Version header): v0 (legacy, with the faithful extensions of the standard methods) or v1 (strict, like the mainnet RPC)",
+				Value:       string(ApiVersionLegacy),
+				Destination: &apiVersion,
+			},
+			&cli.DurationFlag{
+				Name:        "request-timeout",
+				Usage:       "Deadline of the requests, after which their index lookups and node reads fail with a timeout error; a request can shorten it with the X-Timeout-Ms header; no deadline if 0",
+				Value:       DefaultRequestTimeout,
+				Destination: &requestTimeout,
+			},
+			&cli.IntFlag{
+				Name:        "max-block-transactions",
+				Usage:       "getBlock refuses to return the blocks with more transactions than this in full (transactionDetails full or accounts), with a block_too_large error, so that the clients page them; no limit if 0",
+				Value:       0,
+				Destination: &maxBlockTransactions,
+			},
+			&cli.StringSliceFlag{
+				Name:        "plugin",
+				Usage:       "Path of an executable that serves custom methods, started as a subprocess (see the README for its protocol); can be repeated",
+				Value:       cli.NewStringSlice(),
+				Destination: &pluginPaths,
+			},
+			&cli.StringSliceFlag{
+				Name:        "zstd-dict",
+				Usage:       "Path of a zstd dictionary that the data of some CARs were compressed with (see `car recompress-meta`); can be repeated",
+				Value:       cli.NewStringSlice(),
+				Destination: &zstdDicts,
+			},
+			&cli.Uint64SliceFlag{
+				Name:        "epoch",
+				Usage:       "Serve this epoch, with its CAR and index files resolved from the artifact registry (see --artifact-registry) instead of a config file; can be repeated",
+				Value:       cli.NewUint64Slice(),
+				Destination: &epochsToResolve,
+			},
+			&cli.StringFlag{
+				Name:        "artifact-registry",
+				Usage:       "Where --epoch resolves the files of the epochs: the base URL of a server with the layout of old-faithful.net, or a YAML file with URL templates (default: https://files.old-faithful.net)",
+				Value:       "",
+				Destination: &artifactRegistry,
+			},
+			&cli.StringFlag{
+				Name:        "epoch-dir",
+				Usage:       "Where to write the configs of the epochs of --epoch (and download their index files, with --epoch-download-indexes)",
+				Value:       filepath.Join(os.TempDir(), "faithful-epochs"),
+				Destination: &epochDir,
+			},
+			&cli.BoolFlag{
+				Name:        "epoch-download-indexes",
+				Usage:       "Download the index files of the epochs of --epoch into --epoch-dir, instead of reading them remotely (the CAR files are always read remotely)",
+				Value:       false,
+				Destination: &epochDownloadIndexes,
+			},
+			&cli.StringFlag{
+				Name:        "artifact-cache-dir",
+				Usage:       "Managed cache directory: where the index files are downloaded (e.g. the indexes.local_dir of the configs), whose files are removed according to the --artifact-cache-* retention policy (default: the download dir of --epoch-download-indexes, if any)",
+				Value:       "",
+				Destination: &artifactCacheDir,
+			},
+			&cli.IntFlag{
+				Name:        "artifact-cache-max-size-mb",
+				Usage:       "Remove the least recently used files of the managed cache directory while it's larger than this (0 for no limit); the files in use by the loaded epochs and the pinned ones are kept",
+				Value:       0,
+				Destination: &artifactCacheMaxSizeMB,
+			},
+			&cli.DurationFlag{
+				Name:        "artifact-cache-max-idle",
+				Usage:       "Remove the files of the managed cache directory that were not used for that long (0 to keep them)",
+				Value:       0,
+				Destination: &artifactCacheMaxIdle,
+			},
+			&cli.StringSliceFlag{
+				Name:        "artifact-cache-pin",
+				Usage:       "Never remove the files of the managed cache directory matching this glob pattern (on the file name or the path relative to the directory); can be repeated",
+				Value:       cli.NewStringSlice(),
+				Destination: &artifactCachePins,
+			},
+			&cli.DurationFlag{
+				Name:        "artifact-cache-gc-interval",
+				Usage:       "How often to apply the retention policy of the managed cache directory",
+				Value:       10 * time.Minute,
+				Destination: &artifactCacheGCInterval,
+			},
 		),
 		Action: func(c *cli.Context) error {
 			src := c.Args().Slice()
@@ -106,17 +396,65 @@ func newCmd_rpc() *cli.Command {
 			if err != nil {
 				return cli.Exit(err.Error(), 1)
 			}
+			if epochs := epochsToResolve.Value(); len(epochs) > 0 {
+				registry, err := loadArtifactRegistry(artifactRegistry)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				downloadDir := ""
+				if epochDownloadIndexes {
+					downloadDir = filepath.Join(epochDir, "indexes")
+				}
+				resolved, err := resolveEpochConfigs(c.Context, registry, epochs, epochDir, downloadDir)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				configFiles = append(configFiles, resolved...)
+			}
 			klog.Infof("Found %d config files:", len(configFiles))
 			for _, configFile := range configFiles {
 				klog.V(3).Infof("  - %s", configFile)
 			}
 
+			if err := loadZstdDictionaries(zstdDicts.Value()); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+
 			conf := bigcache.DefaultConfig(5 * time.Minute)
 			conf.HardMaxCacheSize = maxCacheSizeMB
 			allCache, err := hugecache.NewWithConfig(c.Context, conf)
 			if err != nil {
 				return fmt.Errorf("failed to create cache: %w", err)
 			}
+			registerCacheMetrics(allCache)
+			setDagFetchConcurrency(fetchConcurrency)
+			registerWorkerPoolMetrics(dagFetchPool)
+			if rebuildIndexes {
+				setIndexRebuildConfig(&IndexRebuildConfig{TmpDir: rebuildIndexesTmpDir})
+			}
+			if sampleIndexes > 0 {
+				setIndexSamplingConfig(&IndexSamplingConfig{
+					NumSamples:      sampleIndexes,
+					MaxMismatchRate: sampleIndexesMaxMismatchRate,
+					Degrade:         sampleIndexesDegrade,
+				})
+			}
+
+			if standbyFailoverAfter < 1 {
+				return cli.Exit("--standby-failover-after must be at least 1", 1)
+			}
+			setStandbyFailoverConfig(StandbyFailoverConfig{
+				LatencySLO:    standbyLatencySLO,
+				FailoverAfter: standbyFailoverAfter,
+				FailbackAfter: standbyFailbackAfter,
+			})
+
+			if discrepancyLogPath != "" {
+				if err := setDiscrepancyLogFile(discrepancyLogPath); err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				klog.Infof("Writing the node discrepancies to %q", discrepancyLogPath)
+			}
 
 			// Load configs:
 			configs := make(ConfigSlice, 0)
@@ -133,6 +471,9 @@ func newCmd_rpc() *cli.Command {
 			}
 			configs.SortByEpoch()
 			klog.Infof("Loaded %d epoch configs", len(configs))
+			if err := checkFileDescriptorLimit(configs); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
 			klog.Info("Initializing epochs...")
 
 			startedInitiatingEpochsAt := time.Now()
@@ -175,10 +516,41 @@ func newCmd_rpc() *cli.Command {
 				return epochs[i].Epoch() < epochs[j].Epoch()
 			})
 
+			searchOrder, err := ParseEpochSearchOrder(epochSearchOrder)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			enabledCompatMethods, err := ParseCompatMethods(compatMethods.Value())
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			defaultApiVersion, err := ParseApiVersion(apiVersion)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			var blockAssemblyCache *BlockAssemblyCache
+			if blockAssemblyCacheSizeMB > 0 {
+				blockAssemblyCache, err = NewBlockAssemblyCache(blockAssemblyCacheSizeMB)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				klog.Infof("Block assembly cache enabled (max-size=%dMB)", blockAssemblyCacheSizeMB)
+			}
 			multi := NewMultiEpoch(&Options{
 				GsfaOnlySignatures:     gsfaOnlySignatures,
 				EpochSearchConcurrency: epochSearchConcurrency,
+				EpochSearchOrder:       searchOrder,
+				CompatMethods:          enabledCompatMethods,
+				LargeIntsAsStrings:     largeIntsAsStrings,
+				ApiVersion:             defaultApiVersion,
+				RequestTimeout:         requestTimeout,
+				MaxBlockTransactions:   maxBlockTransactions,
+				BlockAssemblyCache:     blockAssemblyCache,
 			})
+			if names := multi.EnabledCompatMethods(); len(names) > 0 {
+				klog.Infof("Compat methods enabled: %s", strings.Join(names, ", "))
+			}
+			registerIndexMetrics(multi)
 
 			defer func() {
 				if err := multi.Close(); err != nil {
@@ -236,17 +608,17 @@ func newCmd_rpc() *cli.Command {
 								// find the config file, load it, and update the epoch (replace)
 								config, err := LoadConfig(event.Name)
 								if err != nil {
-									klog.Errorf("error loading config file %q: %s", event.Name, err.Error())
+									configLog.Error("failed to load config file", logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								epoch, err := NewEpochFromConfig(config, c, allCache, minerInfo)
 								if err != nil {
-									klog.Errorf("error creating epoch from config file %q: %s", event.Name, err.Error())
+									configLog.Error("failed to create epoch from config file", logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								err = multi.ReplaceOrAddEpoch(epoch.Epoch(), epoch)
 								if err != nil {
-									klog.Errorf("error replacing epoch %d: %s", epoch.Epoch(), err.Error())
+									configLog.Error("failed to replace epoch", logging.Epoch(epoch.Epoch()), logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								klog.V(2).Infof("Epoch %d added/replaced in %s", epoch.Epoch(), time.Since(startedAt))
@@ -259,17 +631,17 @@ func newCmd_rpc() *cli.Command {
 								// find the config file, load it, and add it to the multi-epoch (if not already added)
 								config, err := LoadConfig(event.Name)
 								if err != nil {
-									klog.Errorf("error loading config file %q: %s", event.Name, err.Error())
+									configLog.Error("failed to load config file", logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								epoch, err := NewEpochFromConfig(config, c, allCache, minerInfo)
 								if err != nil {
-									klog.Errorf("error creating epoch from config file %q: %s", event.Name, err.Error())
+									configLog.Error("failed to create epoch from config file", logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								err = multi.AddEpoch(epoch.Epoch(), epoch)
 								if err != nil {
-									klog.Errorf("error adding epoch %d: %s", epoch.Epoch(), err.Error())
+									configLog.Error("failed to add epoch", logging.Epoch(epoch.Epoch()), logging.String("file", event.Name), logging.Err(err))
 									return
 								}
 								klog.V(2).Infof("Epoch %d added in %s", epoch.Epoch(), time.Since(startedAt))
@@ -282,7 +654,7 @@ func newCmd_rpc() *cli.Command {
 								// find the epoch that corresponds to this file, and remove it (if any)
 								epNumber, err := multi.RemoveEpochByConfigFilepath(event.Name)
 								if err != nil {
-									klog.Errorf("error removing epoch for config file %q: %s", event.Name, err.Error())
+									configLog.Error("failed to remove epoch for config file", logging.String("file", event.Name), logging.Err(err))
 								}
 								klog.V(2).Infof("Epoch %d removed in %s", epNumber, time.Since(startedAt))
 								metrics_epochsAvailable.WithLabelValues(fmt.Sprintf("%d", epNumber)).Set(0)
@@ -300,15 +672,126 @@ func newCmd_rpc() *cli.Command {
 				}
 			}
 
-			var listenerConfig *ListenerConfig
+			listenerConfig := &ListenerConfig{}
 			if pathForProxyForUnknownRpcMethods != "" {
 				proxyConfig, err := LoadProxyConfig(pathForProxyForUnknownRpcMethods)
 				if err != nil {
 					return cli.Exit(fmt.Sprintf("failed to load proxy config file %q: %s", pathForProxyForUnknownRpcMethods, err.Error()), 1)
 				}
-				listenerConfig = &ListenerConfig{
-					ProxyConfig: proxyConfig,
+				listenerConfig.ProxyConfig = proxyConfig
+			}
+			if responseCacheTTL > 0 {
+				var remote remotecache.Cache
+				if responseCacheRemote != "" {
+					remote, err = remotecache.New(responseCacheRemote)
+					if err != nil {
+						return cli.Exit(err.Error(), 1)
+					}
+					defer remote.Close()
+				}
+				responseCache, err := NewResponseCache(c.Context, ResponseCacheConfig{
+					TTL:       responseCacheTTL,
+					MaxSizeMB: responseCacheMaxSizeMB,
+					Remote:    remote,
+				})
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
 				}
+				klog.Infof("Response cache enabled (ttl=%s, max-size=%dMB)", responseCacheTTL, responseCacheMaxSizeMB)
+				listenerConfig.ResponseCache = responseCache
+			}
+
+			if auditLogPath != "" {
+				auditLog, err := OpenAuditLog(auditLogPath)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				defer auditLog.Close()
+				klog.Infof("Writing audit log to %q", auditLogPath)
+				listenerConfig.AuditLog = auditLog
+			}
+
+			if slowQueryThreshold > 0 {
+				slowQueryLog, err := NewSlowQueryLog(slowQueryThreshold, slowQueryLogPath)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				defer slowQueryLog.Close()
+				listenerConfig.SlowQueryLog = slowQueryLog
+			}
+
+			if priorityConfigPath != "" {
+				priorities, err := LoadPriorityConfig(priorityConfigPath)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				dagFetchPool.SetWeights(priorities.PoolWeights())
+				listenerConfig.Priorities = priorities
+				klog.Infof("Loaded priority config from %q", priorityConfigPath)
+			}
+
+			if shedReadLatency > 0 || shedQueueDepth > 0 {
+				listenerConfig.LoadShedder = NewLoadShedder(LoadShedderConfig{
+					MaxReadLatency: shedReadLatency,
+					MaxQueueDepth:  shedQueueDepth,
+				})
+				klog.Infof("Load shedding enabled (read-latency=%s, queue-depth=%d)", shedReadLatency, shedQueueDepth)
+			}
+
+			if integrityCheckInterval > 0 {
+				checker := newIntegrityChecker(multi, IntegrityCheckConfig{
+					Interval:   integrityCheckInterval,
+					WebhookURL: integrityAlertWebhook,
+					Exec:       integrityAlertExec,
+				})
+				go checker.Run(c.Context)
+				klog.Infof("Integrity checks of the epoch files enabled (every %s)", integrityCheckInterval)
+			}
+
+			if artifactCacheDir == "" && epochDownloadIndexes && len(epochsToResolve.Value()) > 0 {
+				artifactCacheDir = filepath.Join(epochDir, "indexes")
+			}
+			var artifacts *artifactCache
+			if artifactCacheDir != "" {
+				artifacts = newArtifactCache(ArtifactCacheConfig{
+					Dir:      artifactCacheDir,
+					MaxBytes: uint64(artifactCacheMaxSizeMB) * 1024 * 1024,
+					MaxIdle:  artifactCacheMaxIdle,
+					Pins:     artifactCachePins.Value(),
+					Interval: artifactCacheGCInterval,
+				}, multi.downloadedFilesInUse)
+				go func() {
+					artifacts.Collect()
+					artifacts.Run(c.Context)
+				}()
+				klog.Infof("Managed cache directory %q (max size %d MB, max idle %s, garbage collected every %s)", artifactCacheDir, artifactCacheMaxSizeMB, artifactCacheMaxIdle, artifactCacheGCInterval)
+			}
+
+			if adminListenOn != "" {
+				go func() {
+					err := multi.ListenAndServeAdmin(c.Context, adminListenOn, &AdminConfig{
+						Cache:         allCache,
+						ArtifactCache: artifacts,
+						LoadEpoch: func(config *Config) (*Epoch, error) {
+							return NewEpochFromConfig(config, c, allCache, minerInfo)
+						},
+					})
+					if err != nil {
+						klog.Errorf("admin API error: %s", err)
+					}
+				}()
+			}
+
+			if len(pluginPaths.Value()) > 0 {
+				plugins, err := StartMethodPlugins(pluginPaths.Value(), listenOn)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				defer func() {
+					for _, plugin := range plugins {
+						plugin.Close()
+					}
+				}()
 			}
 
 			return multi.ListenAndServe(c.Context, listenOn, listenerConfig)
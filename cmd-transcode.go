@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/parquet"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Transcode() *cli.Command {
+	return &cli.Command{
+		Name:        "transcode",
+		Usage:       "Export the blocks and transactions of the epochs to other data stores and formats.",
+		Description: "Read the blocks and transactions of a slot range from the CARs of the epochs (sequentially, starting at the first slot via the indexes), and export them to other data stores and formats, for analytics.",
+		Subcommands: []*cli.Command{
+			newCmd_TranscodeClickHouse(),
+			newCmd_TranscodeParquet(),
+			newCmd_TranscodeEntries(),
+		},
+	}
+}
+
+func newCmd_TranscodeClickHouse() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	var clickHouse clickHouseClient
+	var tablePrefix string
+	var batchSize int
+	var resume bool
+	var timeout time.Duration
+	var manifestPath string
+	return &cli.Command{
+		Name:        "clickhouse",
+		Usage:       "Load the blocks and transactions of a slot range into ClickHouse.",
+		Description: "Load the blocks and transactions of the slot range into the <prefix>blocks and <prefix>transactions tables of ClickHouse (created if they don't exist), in batches, over the HTTP interface. The rows of a block are inserted after the ones of its transactions, so with --resume (the default) an interrupted load restarts after the last block loaded in the range; the tables use the ReplacingMergeTree engine, so the rows of a batch inserted again are deduplicated.",
+		ArgsUsage:   "<one or more config files or directories containing config files (nested is fine)>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to load",
+				Value:       0,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to load (inclusive); 0 means no limit",
+				Value:       0,
+				Destination: &toSlot,
+			},
+			&cli.StringFlag{
+				Name:        "clickhouse-url",
+				Usage:       "URL of the HTTP interface of ClickHouse",
+				Value:       "http://localhost:8123",
+				EnvVars:     []string{"CLICKHOUSE_URL"},
+				Destination: &clickHouse.url,
+			},
+			&cli.StringFlag{
+				Name:        "clickhouse-database",
+				Usage:       "ClickHouse database of the tables",
+				Value:       "default",
+				EnvVars:     []string{"CLICKHOUSE_DATABASE"},
+				Destination: &clickHouse.database,
+			},
+			&cli.StringFlag{
+				Name:        "clickhouse-user",
+				Usage:       "ClickHouse user",
+				EnvVars:     []string{"CLICKHOUSE_USER"},
+				Destination: &clickHouse.user,
+			},
+			&cli.StringFlag{
+				Name:        "clickhouse-password",
+				Usage:       "ClickHouse password",
+				EnvVars:     []string{"CLICKHOUSE_PASSWORD"},
+				Destination: &clickHouse.password,
+			},
+			&cli.StringFlag{
+				Name:        "table-prefix",
+				Usage:       "prefix of the names of the tables",
+				Value:       "solana_",
+				Destination: &tablePrefix,
+			},
+			&cli.IntFlag{
+				Name:        "batch-size",
+				Usage:       "number of rows (blocks and transactions) inserted at a time",
+				Value:       100_000,
+				Destination: &batchSize,
+			},
+			&cli.BoolFlag{
+				Name:        "resume",
+				Usage:       "restart after the last block already loaded in the slot range",
+				Value:       true,
+				Destination: &resume,
+			},
+			&cli.DurationFlag{
+				Name:        "timeout",
+				Usage:       "timeout of each ClickHouse query",
+				Value:       5 * time.Minute,
+				Destination: &timeout,
+			},
+			&cli.StringFlag{
+				Name:        "manifest",
+				Usage:       "path of the manifest of the export to write: a JSON file with the slot range, the epochs, the row counts",
+				Destination: &manifestPath,
+			},
+		},
+		Action: func(c *cli.Context) (retErr error) {
+			if c.Args().Len() < 1 {
+				return cli.Exit("expected at least one config file or directory", 1)
+			}
+			if toSlot == 0 {
+				toSlot = ^uint64(0)
+			}
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			if batchSize < 1 {
+				return cli.Exit("--batch-size must be at least 1", 1)
+			}
+			clickHouse.httpClient = &http.Client{Timeout: timeout}
+			loader := newClickHouseLoader(&clickHouse, tablePrefix, batchSize)
+			if err := loader.createTables(c.Context); err != nil {
+				return err
+			}
+			manifest := newExportManifest("transcode clickhouse", fromSlot, toSlot, includePatterns.Value(), excludePatterns.Value())
+			manifest.Options = map[string]string{
+				"database":    clickHouse.database,
+				"tablePrefix": tablePrefix,
+			}
+			if resume {
+				lastSlot, ok, err := loader.lastLoadedSlot(c.Context, fromSlot, toSlot)
+				if err != nil {
+					return err
+				}
+				if ok {
+					if lastSlot == toSlot {
+						klog.Infof("The slot range is already loaded")
+						return nil
+					}
+					klog.Infof("Resuming after slot %d, already loaded", lastSlot)
+					fromSlot = lastSlot + 1
+					manifest.ResumedFrom = &fromSlot
+				}
+			}
+			configs, err := loadConfigsForSlotRange(
+				c.Args().Slice(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+				fromSlot,
+				toSlot,
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			scanner, err := newEpochScanner(c)
+			if err != nil {
+				return err
+			}
+
+			klog.Infof("Loading the slots %d-%d of %d epochs into ClickHouse", fromSlot, toSlot, len(configs))
+			startedAt := time.Now()
+			task := progress.Start("transcode clickhouse")
+			defer func() { task.Done(retErr) }()
+			var numBlocks, numTransactions uint64
+			err = transcodeSlotRange(c.Context, scanner, configs, fromSlot, toSlot, func(block *transcodeBlock) error {
+				numBlocks++
+				numTransactions += uint64(len(block.Transactions))
+				task.Add(1, 0)
+				manifest.addBlock(block.Slot)
+				manifest.addRows("transactions", uint64(len(block.Transactions)))
+				return loader.add(c.Context, block)
+			})
+			if err != nil {
+				return err
+			}
+			if err := loader.flush(c.Context); err != nil {
+				return err
+			}
+			if manifestPath != "" {
+				manifest.setEpochs(configs, scanner.RootCids())
+				if err := manifest.Write(manifestPath); err != nil {
+					return fmt.Errorf("failed to write the manifest: %w", err)
+				}
+			}
+			klog.Infof("Loaded %d blocks and %d transactions in %s", numBlocks, numTransactions, time.Since(startedAt))
+			return nil
+		},
+	}
+}
+
+func newCmd_TranscodeParquet() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	var outPath string
+	var rowGroupSize int
+	var compression string
+	var manifestPath string
+	return &cli.Command{
+		Name:        "parquet",
+		Usage:       "Write the instructions of a slot range to a Parquet file.",
+		Description: "Write one row per instruction (top-level and inner) of the transactions of the slot range to a Parquet file, with its program id, accounts and data, and the program name and instruction type for the programs whose instructions can be decoded (system, SPL token, token-2022, associated token account, memo, vote, stake, compute budget, upgradeable loader and address lookup table). The inner instructions are only available for the epochs whose transaction metas are in the protobuf format.",
+		ArgsUsage:   "<one or more config files or directories containing config files (nested is fine)>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to write",
+				Value:       0,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to write (inclusive); 0 means no limit",
+				Value:       0,
+				Destination: &toSlot,
+			},
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the Parquet file to write",
+				Required:    true,
+				Destination: &outPath,
+			},
+			&cli.IntFlag{
+				Name:        "row-group-size",
+				Usage:       "maximum number of rows of each row group (buffered in memory)",
+				Value:       parquet.DefaultRowGroupRows,
+				Destination: &rowGroupSize,
+			},
+			&cli.StringFlag{
+				Name:        "compression",
+				Usage:       "compression of the pages: none, gzip or zstd",
+				Value:       "zstd",
+				Destination: &compression,
+			},
+			&cli.StringFlag{
+				Name:        "manifest",
+				Usage:       "path of the manifest of the export to write: a JSON file with the slot range, the epochs, the row counts and the size and sha256 of the Parquet file",
+				Destination: &manifestPath,
+			},
+		},
+		Action: func(c *cli.Context) (retErr error) {
+			if c.Args().Len() < 1 {
+				return cli.Exit("expected at least one config file or directory", 1)
+			}
+			if toSlot == 0 {
+				toSlot = ^uint64(0)
+			}
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			var codec parquet.Codec
+			switch compression {
+			case "none":
+				codec = parquet.Uncompressed
+			case "gzip":
+				codec = parquet.Gzip
+			case "zstd":
+				codec = parquet.Zstd
+			default:
+				return cli.Exit(fmt.Sprintf("unknown compression %q", compression), 1)
+			}
+			configs, err := loadConfigsForSlotRange(
+				c.Args().Slice(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+				fromSlot,
+				toSlot,
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			scanner, err := newEpochScanner(c)
+			if err != nil {
+				return err
+			}
+
+			// write to a temporary file, renamed when complete, so that an interrupted export
+			// doesn't leave a file without its footer.
+			file, err := os.CreateTemp(filepath.Dir(outPath), "."+filepath.Base(outPath)+".*.tmp")
+			if err != nil {
+				return fmt.Errorf("failed to create the output file: %w", err)
+			}
+			defer func() {
+				if retErr != nil {
+					file.Close()
+					os.Remove(file.Name())
+				}
+			}()
+			hashed := newHashingWriter(file)
+			buffered := bufio.NewWriterSize(hashed, 4*1024*1024)
+			pw, err := parquet.NewWriter(buffered, instructionParquetColumns, &parquet.Options{
+				Codec:        codec,
+				RowGroupRows: rowGroupSize,
+			})
+			if err != nil {
+				return err
+			}
+			writer := &instructionParquetWriter{w: pw}
+
+			klog.Infof("Writing the instructions of the slots %d-%d of %d epochs to %s", fromSlot, toSlot, len(configs), outPath)
+			startedAt := time.Now()
+			task := progress.Start("transcode parquet")
+			defer func() { task.Done(retErr) }()
+			manifest := newExportManifest("transcode parquet", fromSlot, toSlot, includePatterns.Value(), excludePatterns.Value())
+			manifest.Options = map[string]string{
+				"compression":  compression,
+				"rowGroupSize": strconv.Itoa(rowGroupSize),
+			}
+			var numBlocks uint64
+			err = transcodeSlotRange(c.Context, scanner, configs, fromSlot, toSlot, func(block *transcodeBlock) error {
+				numBlocks++
+				task.Add(1, 0)
+				manifest.addBlock(block.Slot)
+				manifest.addRows("transactions", uint64(len(block.Transactions)))
+				return writer.add(block)
+			})
+			if err != nil {
+				return err
+			}
+			if err := pw.Close(); err != nil {
+				return err
+			}
+			if err := buffered.Flush(); err != nil {
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			if err := os.Rename(file.Name(), outPath); err != nil {
+				return err
+			}
+			if manifestPath != "" {
+				manifest.addRows("instructions", writer.numInstructions)
+				manifest.Files = append(manifest.Files, hashed.manifestFile(outPath))
+				manifest.setEpochs(configs, scanner.RootCids())
+				if err := manifest.Write(manifestPath); err != nil {
+					return fmt.Errorf("failed to write the manifest: %w", err)
+				}
+			}
+			klog.Infof("Wrote %d instructions of %d blocks in %s", writer.numInstructions, numBlocks, time.Since(startedAt))
+			return nil
+		},
+	}
+}
+
+func newCmd_TranscodeEntries() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	var outPath string
+	var manifestPath string
+	return &cli.Command{
+		Name:        "entries",
+		Usage:       "Write the entries of a slot range in the format of the validator's ledger.",
+		Description: "Write the PoH entries of the blocks of the slot range to a file, in the format of the validator's ledger, so that the slots can be shredded and inserted into the blockstore of a test validator for replay experiments: for each block, in slot order, the bincode serialization of (slot, parent slot, Vec<Entry>), with the transactions in their wire format; the records are concatenated, so a file can be read with consecutive bincode::deserialize_from calls.",
+		ArgsUsage:   "<one or more config files or directories containing config files (nested is fine)>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to write",
+				Value:       0,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to write (inclusive); 0 means no limit",
+				Value:       0,
+				Destination: &toSlot,
+			},
+			&cli.StringFlag{
+				Name:        "out",
+				Usage:       "path of the file to write",
+				Required:    true,
+				Destination: &outPath,
+			},
+			&cli.StringFlag{
+				Name:        "manifest",
+				Usage:       "path of the manifest of the export to write: a JSON file with the slot range, the epochs, the row counts and the size and sha256 of the entries file",
+				Destination: &manifestPath,
+			},
+		},
+		Action: func(c *cli.Context) (retErr error) {
+			if c.Args().Len() < 1 {
+				return cli.Exit("expected at least one config file or directory", 1)
+			}
+			if toSlot == 0 {
+				toSlot = ^uint64(0)
+			}
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			configs, err := loadConfigsForSlotRange(
+				c.Args().Slice(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+				fromSlot,
+				toSlot,
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			scanner, err := newEpochScanner(c)
+			if err != nil {
+				return err
+			}
+
+			// write to a temporary file, renamed when complete, so that an interrupted export
+			// doesn't leave a truncated record.
+			file, err := os.CreateTemp(filepath.Dir(outPath), "."+filepath.Base(outPath)+".*.tmp")
+			if err != nil {
+				return fmt.Errorf("failed to create the output file: %w", err)
+			}
+			defer func() {
+				if retErr != nil {
+					file.Close()
+					os.Remove(file.Name())
+				}
+			}()
+			hashed := newHashingWriter(file)
+			buffered := bufio.NewWriterSize(hashed, 4*1024*1024)
+			writer := newLedgerEntriesWriter(buffered)
+
+			klog.Infof("Writing the entries of the slots %d-%d of %d epochs to %s", fromSlot, toSlot, len(configs), outPath)
+			startedAt := time.Now()
+			task := progress.Start("transcode entries")
+			defer func() { task.Done(retErr) }()
+			manifest := newExportManifest("transcode entries", fromSlot, toSlot, includePatterns.Value(), excludePatterns.Value())
+			var numBlocks uint64
+			err = transcodeSlotRange(c.Context, scanner, configs, fromSlot, toSlot, func(block *transcodeBlock) error {
+				numBlocks++
+				task.Add(1, 0)
+				manifest.addBlock(block.Slot)
+				manifest.addRows("transactions", uint64(len(block.Transactions)))
+				return writer.add(block)
+			})
+			if err != nil {
+				return err
+			}
+			if err := buffered.Flush(); err != nil {
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			if err := os.Rename(file.Name(), outPath); err != nil {
+				return err
+			}
+			if manifestPath != "" {
+				manifest.addRows("entries", writer.numEntries)
+				manifest.Files = append(manifest.Files, hashed.manifestFile(outPath))
+				manifest.setEpochs(configs, scanner.RootCids())
+				if err := manifest.Write(manifestPath); err != nil {
+					return fmt.Errorf("failed to write the manifest: %w", err)
+				}
+			}
+			klog.Infof("Wrote %d entries of %d blocks in %s", writer.numEntries, numBlocks, time.Since(startedAt))
+			return nil
+		},
+	}
+}
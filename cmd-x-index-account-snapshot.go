@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Index_accountSnapshot() *cli.Command {
+	var network indexes.Network
+	return &cli.Command{
+		Name:        "account-snapshot",
+		Description: "Given an account snapshot CAR, create an index of the file that maps the pubkeys of the accounts to their records.",
+		ArgsUsage:   "<car-path> <index-dir>",
+		Before: func(c *cli.Context) error {
+			if network == "" {
+				network = indexes.NetworkMainnet
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "tmp-dir",
+				Usage: "temporary directory to use for storing intermediate files",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "the cluster of the snapshot; one of: mainnet, testnet, devnet",
+				Action: func(c *cli.Context, s string) error {
+					network = indexes.Network(s)
+					if !indexes.IsValidNetwork(network) {
+						return fmt.Errorf("invalid network: %q", network)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			carPath := c.Args().Get(0)
+			indexDir := c.Args().Get(1)
+
+			if ok, err := isDirectory(indexDir); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("index-dir is not a directory")
+			}
+
+			startedAt := time.Now()
+			klog.Infof("Creating Pubkey-to-Account index for %s", carPath)
+			indexFilepath, err := CreateIndex_accountSnapshot(
+				c.Context,
+				network,
+				c.String("tmp-dir"),
+				carPath,
+				indexDir,
+			)
+			if err != nil {
+				return err
+			}
+			klog.Infof("Index created at %s in %s", indexFilepath, time.Since(startedAt))
+			return nil
+		},
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/rpcpool/yellowstone-faithful/indexes"
 	"github.com/rpcpool/yellowstone-faithful/indexmeta"
 	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/progress"
 	"github.com/urfave/cli/v2"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/klog/v2"
@@ -26,10 +27,11 @@ import (
 func newCmd_Index_all() *cli.Command {
 	var verify bool
 	var network indexes.Network
+	var buildOptions indexBuildOptions
 	return &cli.Command{
 		Name:        "all",
 		Usage:       "Create all the necessary indexes for a Solana epoch.",
-		Description: "Given a CAR file containing a Solana epoch, create all the necessary indexes and save them in the specified index dir.",
+		Description: "Given a CAR file containing a Solana epoch, create all the necessary indexes and save them in the specified index dir. Use - as the car-path to read the CAR from stdin (e.g. piped from a download), in a single pass: the index entries are kept in the tmp dir until the end of the stream, instead of the whole CAR. An http(s):// or s3:// car-path is read the same way, with ranged requests that resume after a failure, so no local copy of the CAR is needed.",
 		ArgsUsage:   "<car-path> <index-dir>",
 		Before: func(c *cli.Context) error {
 			if network == "" {
@@ -59,6 +61,9 @@ func newCmd_Index_all() *cli.Command {
 					return nil
 				},
 			},
+			newSigToCidFormatFlag(&buildOptions.SigToCidFormat),
+			newSlotToCidFormatFlag("slot-to-cid-format", &buildOptions.SlotToCidFormat),
+			newCidToOffsetEncodingFlag(&buildOptions.CidToOffsetEncoding),
 		},
 		Subcommands: []*cli.Command{},
 		Action: func(c *cli.Context) error {
@@ -72,6 +77,9 @@ func newCmd_Index_all() *cli.Command {
 			if indexDir == "" {
 				return fmt.Errorf("missing index-dir argument")
 			}
+			if carPath == "-" && verify {
+				return fmt.Errorf("--verify needs to read the CAR again, so it can't be used with a CAR from stdin")
+			}
 			if ok, err := isDirectory(indexDir); err != nil {
 				return err
 			} else if !ok {
@@ -87,7 +95,7 @@ func newCmd_Index_all() *cli.Command {
 				klog.Infof("Indexes will be saved in %s", indexDir)
 
 				indexPaths, numTotalItems, err := createAllIndexes(
-					c.Context,
+					withIndexBuildOptions(c.Context, buildOptions),
 					network,
 					tmpDir,
 					carPath,
@@ -119,7 +127,21 @@ func createAllIndexes(
 	tmpDir string,
 	carPath string,
 	indexDir string,
-) (*IndexPaths, uint64, error) {
+) (_ *IndexPaths, _ uint64, retErr error) {
+	if carPath == "-" {
+		klog.Infof("Reading the CAR from stdin")
+		return createAllIndexesFromStream(ctx, network, tmpDir, os.Stdin, indexDir)
+	}
+	if isRemoteCarPath(carPath) {
+		// a single pass over the remote CAR, without a local copy.
+		klog.Infof("Reading the CAR from %s", redactURL(carPath))
+		carFile, err := openCarFile(carPath)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to open car file: %w", err)
+		}
+		defer carFile.Close()
+		return createAllIndexesFromStream(ctx, network, tmpDir, carFile, indexDir)
+	}
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -129,7 +151,7 @@ func createAllIndexes(
 		return nil, 0, fmt.Errorf("CAR file %q does not exist", carPath)
 	}
 
-	carFile, err := os.Open(carPath)
+	carFile, err := openCarFile(carPath)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to open car file: %w", err)
 	}
@@ -175,12 +197,27 @@ func createAllIndexes(
 	epoch := uint64(epochObject.Epoch)
 	klog.Infof("This CAR file is for epoch %d and cluster %s", epoch, network)
 
+	estimate := estimateAllIndexes(
+		numTotalItems,
+		numItems[byte(iplddecoders.KindBlock)],
+		numItems[byte(iplddecoders.KindTransaction)],
+	)
+	release, err := reserveIndexMemory(ctx, estimate.MemoryBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	if err := checkIndexResources(estimate, tmpDir, indexDir); err != nil {
+		return nil, 0, err
+	}
+
 	cid_to_offset_and_size, err := NewBuilder_CidToOffset(
 		epoch,
 		rootCID,
 		network,
 		tmpDir,
 		numTotalItems,
+		indexBuildOptionsOf(ctx).CidToOffsetEncoding,
 	)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create cid_to_offset_and_size index: %w", err)
@@ -193,6 +230,7 @@ func createAllIndexes(
 		network,
 		tmpDir,
 		numItems[byte(iplddecoders.KindBlock)],
+		indexBuildOptionsOf(ctx).SlotToCidFormat,
 	)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create slot_to_cid index: %w", err)
@@ -205,6 +243,7 @@ func createAllIndexes(
 		network,
 		tmpDir,
 		numItems[byte(iplddecoders.KindTransaction)],
+		indexBuildOptionsOf(ctx).SigToCidFormat,
 	)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create sig_to_cid index: %w", err)
@@ -229,13 +268,15 @@ func createAllIndexes(
 		totalOffset = uint64(buf.Len())
 	}
 
+	blockhashes := newBlockhashCollector()
+
 	numIndexedOffsets := uint64(0)
 	numIndexedBlocks := uint64(0)
 	numIndexedTransactions := uint64(0)
-	lastCheckpoint := time.Now()
 	klog.Infof("Indexing...")
-	var eta time.Duration
-	startedAt := time.Now()
+	task := progress.Start("index all")
+	task.SetTotal(numTotalItems, 0)
+	defer func() { task.Done(retErr) }()
 	for {
 		_cid, sectionLength, block, err := rd.NextNode()
 		if err != nil {
@@ -266,8 +307,17 @@ func createAllIndexes(
 				if err != nil {
 					return nil, 0, fmt.Errorf("failed to index slot to cid: %w", err)
 				}
+				blockhashes.addBlock(block)
 				numIndexedBlocks++
 			}
+		case iplddecoders.KindEntry:
+			{
+				entry, err := iplddecoders.DecodeEntry(block.RawData())
+				if err != nil {
+					return nil, 0, fmt.Errorf("failed to decode entry: %w", err)
+				}
+				blockhashes.addEntry(_cid, entry)
+			}
 		case iplddecoders.KindTransaction:
 			{
 				txNode, err := iplddecoders.DecodeTransaction(block.RawData())
@@ -292,37 +342,8 @@ func createAllIndexes(
 		}
 
 		totalOffset += sectionLength
-
-		if numIndexedOffsets%1_000_000 == 0 && numIndexedOffsets > 0 {
-			timeForChunk := time.Since(lastCheckpoint)
-			numChunksLeft := ((numTotalItems - numIndexedOffsets) / 1_000_000) + 1
-			eta = timeForChunk * time.Duration(numChunksLeft)
-			lastCheckpoint = time.Now()
-		}
-		if numIndexedOffsets%100_000 == 0 {
-			var etaString string
-			if eta > 0 {
-				etaString = fmt.Sprintf(" ETA: %s   ", eta.Truncate(time.Second).String())
-			} else {
-				etaString = ", ETA: ---   "
-			}
-			printToStderr(
-				fmt.Sprintf("\rIndexing: %s/%s items [%s%%] %s",
-					humanize.Comma(int64(numIndexedOffsets)),
-					humanize.Comma(int64(numTotalItems)),
-					humanize.CommafWithDigits(float64(numIndexedOffsets)/float64(numTotalItems)*100, 2),
-					etaString,
-				),
-			)
-		}
+		task.Add(1, sectionLength)
 	}
-	printToStderr(
-		fmt.Sprintf("\rIndexed %s items in %s                           \n",
-			humanize.Comma(int64(numIndexedOffsets)),
-			time.Since(startedAt).Truncate(time.Second),
-		),
-	)
-	printToStderr("\n")
 	klog.Infof(
 		"Indexed %s offsets, %s blocks, %s transactions",
 		humanize.Comma(int64(numIndexedOffsets)),
@@ -330,6 +351,54 @@ func createAllIndexes(
 		humanize.Comma(int64(numIndexedTransactions)),
 	)
 
+	slot_to_blockhash, err := NewBuilder_SlotToBlockhash(
+		epoch,
+		rootCID,
+		network,
+		tmpDir,
+		blockhashes.numBlocks(),
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create slot_to_blockhash index: %w", err)
+	}
+	defer slot_to_blockhash.Close()
+	if err := blockhashes.writeTo(slot_to_blockhash); err != nil {
+		return nil, 0, err
+	}
+
+	paths, err := sealAllIndexes(
+		ctx,
+		epoch,
+		rootCID,
+		network,
+		indexDir,
+		cid_to_offset_and_size,
+		slot_to_cid,
+		sig_to_cid,
+		slot_to_blockhash,
+		sig_exists,
+		sigExistsFilepath,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	return paths, numTotalItems, nil
+}
+
+// sealAllIndexes seals the indexes (concurrently) in the index dir.
+func sealAllIndexes(
+	ctx context.Context,
+	epoch uint64,
+	rootCID cid.Cid,
+	network indexes.Network,
+	indexDir string,
+	cid_to_offset_and_size *indexes.CidToOffsetAndSize_Writer,
+	slot_to_cid *indexes.SlotToCid_Writer,
+	sig_to_cid *indexes.SigToCid_Writer,
+	slot_to_blockhash *indexes.SlotToBlockhash_Writer,
+	sig_exists *bucketteer.Writer,
+	sigExistsFilepath string,
+) (*IndexPaths, error) {
 	klog.Infof("Preparing to seal indexes (DO NOT EXIT)...")
 
 	paths := &IndexPaths{}
@@ -341,7 +410,7 @@ func createAllIndexes(
 		// seal the indexes
 		wg.Go(func() error {
 			klog.Infof("Sealing cid_to_offset_and_size index...")
-			err = cid_to_offset_and_size.Seal(ctx, indexDir)
+			err := cid_to_offset_and_size.Seal(ctx, indexDir)
 			if err != nil {
 				return fmt.Errorf("failed to seal cid_to_offset_and_size index: %w", err)
 			}
@@ -352,7 +421,7 @@ func createAllIndexes(
 
 		wg.Go(func() error {
 			klog.Infof("Sealing slot_to_cid index...")
-			err = slot_to_cid.Seal(ctx, indexDir)
+			err := slot_to_cid.Seal(ctx, indexDir)
 			if err != nil {
 				return fmt.Errorf("failed to seal slot_to_cid index: %w", err)
 			}
@@ -363,7 +432,7 @@ func createAllIndexes(
 
 		wg.Go(func() error {
 			klog.Infof("Sealing sig_to_cid index...")
-			err = sig_to_cid.Seal(ctx, indexDir)
+			err := sig_to_cid.Seal(ctx, indexDir)
 			if err != nil {
 				return fmt.Errorf("failed to seal sig_to_cid index: %w", err)
 			}
@@ -372,6 +441,17 @@ func createAllIndexes(
 			return nil
 		})
 
+		wg.Go(func() error {
+			klog.Infof("Sealing slot_to_blockhash index...")
+			err := slot_to_blockhash.Seal(ctx, indexDir)
+			if err != nil {
+				return fmt.Errorf("failed to seal slot_to_blockhash index: %w", err)
+			}
+			paths.SlotToBlockhash = slot_to_blockhash.GetFilepath()
+			klog.Infof("Successfully sealed slot_to_blockhash index: %s", paths.SlotToBlockhash)
+			return nil
+		})
+
 		wg.Go(func() error {
 			klog.Infof("Sealing sig_exists index...")
 			meta := indexmeta.Meta{}
@@ -384,7 +464,7 @@ func createAllIndexes(
 			if err := meta.AddString(indexmeta.MetadataKey_Network, string(network)); err != nil {
 				return fmt.Errorf("failed to add network to sig_exists index metadata: %w", err)
 			}
-			if _, err = sig_exists.Seal(meta); err != nil {
+			if _, err := sig_exists.Seal(meta); err != nil {
 				return fmt.Errorf("failed to seal sig_exists index: %w", err)
 			}
 			klog.Infof("Successfully sealed sig_exists index: %s", paths.SignatureExists)
@@ -392,11 +472,11 @@ func createAllIndexes(
 		})
 
 		if err := wg.Wait(); err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 	}
 
-	return paths, numTotalItems, nil
+	return paths, nil
 }
 
 func greenBackground(s string) string {
@@ -408,10 +488,12 @@ func blackText(s string) string {
 }
 
 type IndexPaths struct {
-	CidToOffsetAndSize string
-	SlotToCid          string
-	SignatureToCid     string
-	SignatureExists    string
+	CidToOffsetAndSize string `json:"cidToOffsetAndSize"`
+	SlotToCid          string `json:"slotToCid"`
+	SignatureToCid     string `json:"sigToCid"`
+	SignatureExists    string `json:"sigExists"`
+	// SlotToBlockhash is the optional sidecar of the blockhashes (see blockhashCollector).
+	SlotToBlockhash string `json:"slotToBlockhash,omitempty"`
 }
 
 // IndexPaths.String
@@ -429,6 +511,11 @@ func (p *IndexPaths) String() string {
 	builder.WriteString("  sig_exists:\n    uri: ")
 	builder.WriteString(quoteSingle(p.SignatureExists))
 	builder.WriteString("\n")
+	if p.SlotToBlockhash != "" {
+		builder.WriteString("  slot_to_blockhash:\n    uri: ")
+		builder.WriteString(quoteSingle(p.SlotToBlockhash))
+		builder.WriteString("\n")
+	}
 	return builder.String()
 }
 
@@ -442,17 +529,19 @@ func NewBuilder_CidToOffset(
 	network indexes.Network,
 	tmpDir string,
 	numItems uint64,
+	encoding indexes.ValueEncoding,
 ) (*indexes.CidToOffsetAndSize_Writer, error) {
 	tmpDir = filepath.Join(tmpDir, "index-cid-to-offset-"+time.Now().Format("20060102-150405.000000000")+fmt.Sprintf("-%d", rand.Int63()))
 	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create cid_to_offset_and_size tmp dir: %w", err)
 	}
-	index, err := indexes.NewWriter_CidToOffsetAndSize(
+	index, err := indexes.NewWriterWithEncoding_CidToOffsetAndSize(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems,
+		encoding,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cid-to-offset-and-size index: %w", err)
@@ -466,17 +555,19 @@ func NewBuilder_SignatureToCid(
 	network indexes.Network,
 	tmpDir string,
 	numItems uint64,
+	format indexes.Format,
 ) (*indexes.SigToCid_Writer, error) {
 	tmpDir = filepath.Join(tmpDir, "index-sig-to-cid-"+time.Now().Format("20060102-150405.000000000")+fmt.Sprintf("-%d", rand.Int63()))
 	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create sig_to_cid tmp dir: %w", err)
 	}
-	index, err := indexes.NewWriter_SigToCid(
+	index, err := indexes.NewWriterWithFormat_SigToCid(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems,
+		format,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create sig_to_cid index: %w", err)
@@ -490,17 +581,19 @@ func NewBuilder_SlotToCid(
 	network indexes.Network,
 	tmpDir string,
 	numItems uint64,
+	format indexes.Format,
 ) (*indexes.SlotToCid_Writer, error) {
 	tmpDir = filepath.Join(tmpDir, "index-slot-to-cid-"+time.Now().Format("20060102-150405.000000000")+fmt.Sprintf("-%d", rand.Int63()))
 	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
 		return nil, fmt.Errorf("failed to create slot_to_cid tmp dir: %w", err)
 	}
-	index, err := indexes.NewWriter_SlotToCid(
+	index, err := indexes.NewWriterWithFormat_SlotToCid(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems,
+		format,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create slot_to_cid index: %w", err)
@@ -513,17 +606,19 @@ func verifyAllIndexes(
 	carPath string,
 	indexes *IndexPaths,
 	numTotalItems uint64,
-) error {
-	// Check if the CAR file exists:
-	exists, err := fileExists(carPath)
-	if err != nil {
-		return fmt.Errorf("failed to check if CAR file exists: %w", err)
-	}
-	if !exists {
-		return fmt.Errorf("CAR file %q does not exist", carPath)
+) (retErr error) {
+	if !isRemoteCarPath(carPath) {
+		// Check if the CAR file exists (a remote one is checked when opened):
+		exists, err := fileExists(carPath)
+		if err != nil {
+			return fmt.Errorf("failed to check if CAR file exists: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("CAR file %q does not exist", carPath)
+		}
 	}
 
-	carFile, err := os.Open(carPath)
+	carFile, err := openCarFile(carPath)
 	if err != nil {
 		return fmt.Errorf("failed to open car file: %w", err)
 	}
@@ -573,6 +668,22 @@ func verifyAllIndexes(
 		defer sig_exists.Close()
 	}
 
+	var blockhashes *blockhashCollector
+	verifyBlockhashes := func() error { return nil }
+	if indexes.SlotToBlockhash != "" {
+		slot_to_blockhash, err := OpenIndex_SlotToBlockhash(
+			indexes.SlotToBlockhash,
+		)
+		if err != nil {
+			return err
+		}
+		defer slot_to_blockhash.Close()
+		blockhashes = newBlockhashCollector()
+		verifyBlockhashes = func() error {
+			return blockhashes.verify(slot_to_blockhash)
+		}
+	}
+
 	totalOffset := uint64(0)
 	{
 		var buf bytes.Buffer
@@ -586,9 +697,9 @@ func verifyAllIndexes(
 	numIndexedBlocks := uint64(0)
 	numIndexedTransactions := uint64(0)
 	klog.Infof("Verifying indexes...")
-	lastCheckpoint := time.Now()
-	var eta time.Duration
-	startedAt := time.Now()
+	task := progress.Start("verify indexes")
+	task.SetTotal(numTotalItems, 0)
+	defer func() { task.Done(retErr) }()
 	for {
 		_cid, sectionLength, block, err := rd.NextNode()
 		if err != nil {
@@ -629,8 +740,19 @@ func verifyAllIndexes(
 				if !got.Equals(_cid) {
 					return fmt.Errorf("slot to cid mismatch for %d: expected cid %s, got %s", block.Slot, _cid, got)
 				}
+				if blockhashes != nil {
+					blockhashes.addBlock(block)
+				}
 				numIndexedBlocks++
 			}
+		case iplddecoders.KindEntry:
+			if blockhashes != nil {
+				entry, err := iplddecoders.DecodeEntry(block.RawData())
+				if err != nil {
+					return fmt.Errorf("failed to decode entry: %w", err)
+				}
+				blockhashes.addEntry(_cid, entry)
+			}
 		case iplddecoders.KindTransaction:
 			{
 				txNode, err := iplddecoders.DecodeTransaction(block.RawData())
@@ -663,48 +785,19 @@ func verifyAllIndexes(
 		}
 
 		totalOffset += sectionLength
-
-		if numIndexedOffsets%1_000_000 == 0 && numIndexedOffsets > 0 && numTotalItems > 0 {
-			timeForChunk := time.Since(lastCheckpoint)
-			numChunksLeft := ((numTotalItems - numIndexedOffsets) / 1_000_000) + 1
-			eta = timeForChunk * time.Duration(numChunksLeft)
-			lastCheckpoint = time.Now()
-		}
-		if numIndexedOffsets%100_000 == 0 {
-			if numTotalItems > 0 {
-				var etaString string
-				if eta > 0 {
-					etaString = fmt.Sprintf(", ETA: %s   ", eta.Truncate(time.Second).String())
-				} else {
-					etaString = ", ETA: ---   "
-				}
-				printToStderr(
-					fmt.Sprintf("\rVerifying index: %s/%s items [%s%%] %s",
-						humanize.Comma(int64(numIndexedOffsets)),
-						humanize.Comma(int64(numTotalItems)),
-						humanize.CommafWithDigits(float64(numIndexedOffsets)/float64(numTotalItems)*100, 2),
-						etaString,
-					),
-				)
-			} else {
-				printToStderr(
-					fmt.Sprintf("\rVerifying index: %s items",
-						humanize.Comma(int64(numIndexedOffsets)),
-					),
-				)
-			}
-		}
+		task.Add(1, sectionLength)
 	}
 
-	printToStderr(
-		fmt.Sprintf(
-			"\rVerified %s offsets, %s blocks, %s transactions in %s\n",
-			humanize.Comma(int64(numIndexedOffsets)),
-			humanize.Comma(int64(numIndexedBlocks)),
-			humanize.Comma(int64(numIndexedTransactions)),
-			time.Since(startedAt).Truncate(time.Second),
-		))
+	if err := verifyBlockhashes(); err != nil {
+		return err
+	}
 
+	klog.Infof(
+		"Verified %s offsets, %s blocks, %s transactions",
+		humanize.Comma(int64(numIndexedOffsets)),
+		humanize.Comma(int64(numIndexedBlocks)),
+		humanize.Comma(int64(numIndexedTransactions)),
+	)
 	return nil
 }
 
@@ -14,6 +14,7 @@ func newCmd_Index_cid2offset() *cli.Command {
 	var verify bool
 	var epoch uint64
 	var network indexes.Network
+	var encoding indexes.ValueEncoding
 	return &cli.Command{
 		Name:        "cid-to-offset",
 		Description: "Given a CAR file containing a Solana epoch, create an index of the file that maps CIDs to offsets in the CAR file.",
@@ -52,6 +53,7 @@ func newCmd_Index_cid2offset() *cli.Command {
 					return nil
 				},
 			},
+			newCidToOffsetEncodingFlag(&encoding),
 		},
 		Subcommands: []*cli.Command{},
 		Action: func(c *cli.Context) error {
@@ -72,7 +74,7 @@ func newCmd_Index_cid2offset() *cli.Command {
 				}()
 				klog.Infof("Creating CID-to-offset index for %s", carPath)
 				indexFilepath, err := CreateIndex_cid2offset(
-					context.TODO(),
+					withIndexBuildOptions(context.TODO(), indexBuildOptions{CidToOffsetEncoding: encoding}),
 					epoch,
 					network,
 					tmpDir,
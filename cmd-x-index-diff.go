@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+)
+
+func newCmd_Index_diff() *cli.Command {
+	var maxDifferences int
+	return &cli.Command{
+		Name:        "diff",
+		Usage:       "Compare the entries of two indexes of the same kind.",
+		Description: "Compare two compact indexes of the same kind (e.g. a rebuilt index and the original), and report the entries that are in only one of them and the entries with different values. The keys are not stored in the indexes: an entry is identified by its bucket and the hash of its key in the bucket, and the buckets with different keys (and so different hash domains) are reported as a whole. Exits with status 1 if the indexes differ.",
+		ArgsUsage:   "<index-a> <index-b>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:        "max-differences",
+				Usage:       "maximum number of differences to print",
+				Value:       100,
+				Destination: &maxDifferences,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			pathA := c.Args().Get(0)
+			pathB := c.Args().Get(1)
+			if pathA == "" || pathB == "" {
+				return fmt.Errorf("missing index paths")
+			}
+			a, err := os.Open(pathA)
+			if err != nil {
+				return fmt.Errorf("failed to open index: %w", err)
+			}
+			defer a.Close()
+			b, err := os.Open(pathB)
+			if err != nil {
+				return fmt.Errorf("failed to open index: %w", err)
+			}
+			defer b.Close()
+
+			report, err := indexes.Diff(c.Context, a, b, maxDifferences)
+			if err != nil {
+				return cli.Exit(err, 2)
+			}
+			printIndexDiff(report)
+			if !report.Equal() {
+				return cli.Exit("", 1)
+			}
+			return nil
+		},
+	}
+}
+
+func printIndexDiff(report *indexes.DiffReport) {
+	metaA, metaB := report.MetaA, report.MetaB
+	if metaA.Epoch != metaB.Epoch || !metaA.RootCid.Equals(metaB.RootCid) || metaA.Network != metaB.Network {
+		fmt.Printf("metadata: epoch %d, root %s, %s <> epoch %d, root %s, %s\n",
+			metaA.Epoch, metaA.RootCid, metaA.Network,
+			metaB.Epoch, metaB.RootCid, metaB.Network,
+		)
+	}
+	kind := metaA.IndexKind
+	for _, diff := range report.Differences {
+		switch {
+		case diff.DomainMismatch:
+			fmt.Printf("bucket %d: different keys (%d <> %d entries)\n", diff.Bucket, diff.NumEntriesA, diff.NumEntriesB)
+		case diff.ValueB == nil:
+			fmt.Printf("bucket %d, hash %06x: < %s\n", diff.Bucket, diff.Hash, indexes.FormatValue(kind, diff.ValueA))
+		case diff.ValueA == nil:
+			fmt.Printf("bucket %d, hash %06x: > %s\n", diff.Bucket, diff.Hash, indexes.FormatValue(kind, diff.ValueB))
+		default:
+			fmt.Printf("bucket %d, hash %06x: %s <> %s\n", diff.Bucket, diff.Hash, indexes.FormatValue(kind, diff.ValueA), indexes.FormatValue(kind, diff.ValueB))
+		}
+	}
+	fmt.Printf(
+		"%s index: %d entries only in a, %d only in b, %d different values, %d buckets with different keys\n",
+		kind,
+		report.OnlyInA,
+		report.OnlyInB,
+		report.Mismatches,
+		report.DomainMismatches,
+	)
+}
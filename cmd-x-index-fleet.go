@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Index_fleet() *cli.Command {
+	var verify bool
+	var network indexes.Network
+	var concurrency int
+	var memoryBudget string
+	var retries int
+	var retryDelay time.Duration
+	var reportPath string
+	return &cli.Command{
+		Name:        "fleet",
+		Usage:       "Create all the necessary indexes for many epochs.",
+		Description: "Given a directory of CAR files (*.car, *.car.zst), or a manifest (JSON or YAML) that lists them (`cars: [{path, index_dir, network, priority}]`), create all the indexes of each CAR (like `index all`), several at a time, within a memory budget: a build starts only when its estimated memory fits in the budget. The CARs with a higher priority are indexed first; the failed builds are retried. The consolidated report (JSON) is updated as the builds finish; when run again with the same report, the CARs already indexed are skipped.",
+		ArgsUsage:   "<car-dir-or-manifest> <index-dir>",
+		Before: func(c *cli.Context) error {
+			if network == "" {
+				network = indexes.NetworkMainnet
+			}
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:        "verify",
+				Usage:       "verify the indexes of each CAR after creating them",
+				Destination: &verify,
+			},
+			&cli.StringFlag{
+				Name:  "tmp-dir",
+				Usage: "temporary directory to use for storing intermediate files",
+				Value: "",
+			},
+			&cli.StringFlag{
+				Name:  "network",
+				Usage: "the cluster of the epochs (unless set in the manifest); one of: mainnet, testnet, devnet",
+				Action: func(c *cli.Context, s string) error {
+					network = indexes.Network(s)
+					if !indexes.IsValidNetwork(network) {
+						return fmt.Errorf("invalid network: %q", network)
+					}
+					return nil
+				},
+			},
+			&cli.IntFlag{
+				Name:        "concurrency",
+				Usage:       "maximum number of CARs indexed at the same time",
+				Value:       2,
+				Destination: &concurrency,
+			},
+			&cli.StringFlag{
+				Name:        "memory-budget",
+				Usage:       "total estimated memory of the concurrent builds (e.g. 64GiB); unlimited if empty",
+				Destination: &memoryBudget,
+			},
+			&cli.IntFlag{
+				Name:        "retries",
+				Usage:       "number of times a failed build is retried",
+				Value:       1,
+				Destination: &retries,
+			},
+			&cli.DurationFlag{
+				Name:        "retry-delay",
+				Usage:       "delay before retrying a failed build",
+				Value:       time.Minute,
+				Destination: &retryDelay,
+			},
+			&cli.StringFlag{
+				Name:        "report",
+				Usage:       "path of the JSON report; defaults to fleet-report.json in the index dir",
+				Destination: &reportPath,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			manifestPath := c.Args().Get(0)
+			indexDir := c.Args().Get(1)
+			tmpDir := c.String("tmp-dir")
+			if manifestPath == "" {
+				return fmt.Errorf("missing car-dir-or-manifest argument")
+			}
+			if indexDir == "" {
+				return fmt.Errorf("missing index-dir argument")
+			}
+			if ok, err := isDirectory(indexDir); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("index-dir is not a directory")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if retries < 0 {
+				return fmt.Errorf("--retries must not be negative")
+			}
+			var budget uint64
+			if memoryBudget != "" {
+				var err error
+				budget, err = humanize.ParseBytes(memoryBudget)
+				if err != nil {
+					return fmt.Errorf("invalid --memory-budget: %w", err)
+				}
+			}
+			if reportPath == "" {
+				reportPath = filepath.Join(indexDir, "fleet-report.json")
+			}
+
+			manifest, err := loadFleetManifest(manifestPath)
+			if err != nil {
+				return err
+			}
+			jobs := newFleetJobs(manifest, indexDir, network)
+			klog.Infof("Indexing %d CARs, %d at a time", len(jobs), concurrency)
+
+			startedAt := time.Now()
+			fleet := &Fleet{
+				Concurrency:  concurrency,
+				MemoryBudget: budget,
+				Retries:      retries,
+				RetryDelay:   retryDelay,
+				ReportPath:   reportPath,
+				build: func(ctx context.Context, job *FleetJob, indexDir string) (*IndexPaths, uint64, error) {
+					paths, numTotalItems, err := createAllIndexes(ctx, indexes.Network(job.Network), tmpDir, job.Car, indexDir)
+					if err != nil {
+						return nil, 0, err
+					}
+					if verify {
+						if err := verifyAllIndexes(ctx, job.Car, paths, numTotalItems); err != nil {
+							return nil, 0, fmt.Errorf("failed to verify the indexes: %w", err)
+						}
+					}
+					return paths, numTotalItems, nil
+				},
+			}
+			report, err := fleet.Run(c.Context, jobs)
+			if err != nil {
+				return err
+			}
+			klog.Infof(
+				"Indexed %d CARs, %d failed, %d skipped (already indexed), in %s; report: %s",
+				report.Done,
+				report.Failed,
+				report.Skipped,
+				time.Since(startedAt).Truncate(time.Second),
+				reportPath,
+			)
+			for _, job := range report.Jobs {
+				if job.State == FleetJobFailed {
+					klog.Errorf("- %s: failed after %d attempts: %s", job.Car, job.Attempts, job.Error)
+				}
+			}
+			if report.Failed > 0 {
+				return fmt.Errorf("failed to index %d of %d CARs", report.Failed, len(report.Jobs))
+			}
+			return nil
+		},
+	}
+}
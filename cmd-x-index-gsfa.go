@@ -20,11 +20,13 @@ import (
 	"github.com/ipfs/go-libipfs/blocks"
 	"github.com/ipld/go-car"
 	"github.com/rpcpool/yellowstone-faithful/gsfa"
+	"github.com/rpcpool/yellowstone-faithful/gsfa/txinfo"
 	"github.com/rpcpool/yellowstone-faithful/indexes"
 	"github.com/rpcpool/yellowstone-faithful/indexmeta"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
 	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
 	"github.com/rpcpool/yellowstone-faithful/readahead"
+	solanatxmetaparsers "github.com/rpcpool/yellowstone-faithful/solana-tx-meta-parsers"
 	concurrently "github.com/tejzpr/ordered-concurrently/v3"
 	"github.com/urfave/cli/v2"
 	"k8s.io/klog/v2"
@@ -33,6 +35,7 @@ import (
 func newCmd_Index_gsfa() *cli.Command {
 	var epoch uint64
 	var network indexes.Network
+	var accountFilter gsfaAccountFilter
 	return &cli.Command{
 		Name:        "gsfa",
 		Description: "Create GSFA index from a CAR file",
@@ -78,6 +81,21 @@ func newCmd_Index_gsfa() *cli.Command {
 					return nil
 				},
 			},
+			&cli.BoolFlag{
+				Name:        "only-writable",
+				Usage:       "index only the accounts that are writable in the transactions",
+				Destination: &accountFilter.OnlyWritable,
+			},
+			&cli.BoolFlag{
+				Name:        "only-signers",
+				Usage:       "index only the accounts that signed the transactions",
+				Destination: &accountFilter.OnlySigners,
+			},
+			&cli.BoolFlag{
+				Name:        "exclude-vote",
+				Usage:       "don't index the vote program and the vote accounts of the vote transactions",
+				Destination: &accountFilter.ExcludeVote,
+			},
 		},
 		Action: func(c *cli.Context) error {
 			carPath := c.Args().First()
@@ -151,6 +169,12 @@ func newCmd_Index_gsfa() *cli.Command {
 			if err := meta.AddString(indexmeta.MetadataKey_Network, string(network)); err != nil {
 				return fmt.Errorf("failed to add network to sig_exists index metadata: %w", err)
 			}
+			if !accountFilter.IsZero() {
+				klog.Infof("Indexing only these accounts: %s", accountFilter)
+				if err := meta.AddString(indexmeta.MetadataKey_GsfaFilter, accountFilter.String()); err != nil {
+					return fmt.Errorf("failed to add account filter to gsfa index metadata: %w", err)
+				}
+			}
 			accu, err := gsfa.NewGsfaWriter(
 				gsfaIndexDir,
 				flushEvery,
@@ -203,9 +227,16 @@ func newCmd_Index_gsfa() *cli.Command {
 						tx := resValue.Transaction
 						slot := resValue.Slot
 						sig := tx.Signatures[0]
-						err = accu.Push(slot, sig, tx.Message.AccountKeys)
-						if err != nil {
-							klog.Exitf("Error while pushing to gsfa index: %s", err)
+						// the transactions without any account to index are skipped.
+						if keys := accountFilter.Keys(&tx); len(keys) > 0 {
+							err = accu.PushWithInfo(slot, sig, keys, txinfo.Info{
+								Memo:          formatMemosFromTransaction(&tx),
+								Err:           resValue.Err,
+								StatusUnknown: resValue.ErrUnknown,
+							})
+							if err != nil {
+								klog.Exitf("Error while pushing to gsfa index: %s", err)
+							}
 						}
 						waitResultsReceived.Done()
 						numReceivedAtomic.Add(-1)
@@ -277,6 +308,11 @@ func formatIndexDirname_gsfa(epoch uint64, rootCid cid.Cid, network indexes.Netw
 type TransactionWithSlot struct {
 	Slot        uint64
 	Transaction solana.Transaction
+	// Err is the error of the transaction as returned by the RPC (JSON), or nil if the transaction succeeded.
+	Err []byte
+	// ErrUnknown is true if the status of the transaction can't be determined
+	// (e.g. the meta is split in multiple objects).
+	ErrUnknown bool
 }
 
 type txParserWorker struct {
@@ -325,9 +361,15 @@ func (w txParserWorker) Run(ctx context.Context) interface{} {
 			} else if len(tx.Signatures) == 0 {
 				klog.Exitf("Error while unmarshaling transaction from nodex %s: no signatures", block.Cid())
 			}
+			txErr, err := transactionErrorFromNode(decoded)
+			if err != nil {
+				klog.Warningf("Can't get the status of transaction %s from nodex %s: %s", tx.Signatures[0], block.Cid(), err)
+			}
 			return TransactionWithSlot{
 				Slot:        uint64(decoded.Slot),
 				Transaction: tx,
+				Err:         txErr,
+				ErrUnknown:  err != nil,
 			}
 		} else {
 			klog.Warningf("Transaction data is split into multiple objects for %s; skipping", block.Cid())
@@ -335,3 +377,30 @@ func (w txParserWorker) Run(ctx context.Context) interface{} {
 	}
 	return nil
 }
+
+// transactionErrorFromNode returns the error of the transaction (as JSON), or nil if it succeeded.
+func transactionErrorFromNode(decoded *ipldbindcode.Transaction) ([]byte, error) {
+	if total, ok := decoded.Metadata.GetTotal(); ok && total > 1 {
+		return nil, fmt.Errorf("metadata is split into multiple objects")
+	}
+	metaBuffer := decoded.Metadata.Bytes()
+	if len(metaBuffer) == 0 {
+		return nil, nil
+	}
+	uncompressedMeta, err := decompressZstd(metaBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress metadata: %w", err)
+	}
+	meta, err := solanatxmetaparsers.ParseAnyTransactionStatusMeta(uncompressedMeta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	txErr, err := transactionErrorFromMeta(meta)
+	if err != nil {
+		return nil, err
+	}
+	if txErr == nil {
+		return nil, nil
+	}
+	return fasterJson.Marshal(txErr)
+}
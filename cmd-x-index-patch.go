@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Index_patch() *cli.Command {
+	var entries cli.StringSlice
+	var note string
+	var dryRun bool
+	return &cli.Command{
+		Name:        "patch",
+		Usage:       "Rewrite the values of some entries of an index, without rebuilding it.",
+		Description: "Set new values for entries of a compact index (e.g. after fixing a mis-extracted block), and append an audit record (time, number of entries, note) to the metadata in its header. An entry is `<key>=<value>`: for cid-to-offset-and-size, `<cid>=<offset>:<size>`; for slot-to-cid, `<slot>=<cid>`; for sig-to-cid, `<signature>=<cid>`. The keys are not stored in the index, so they must be keys of the index: the entry with the hash of the key is rewritten. If <dst-index> is omitted, the index is replaced in place.",
+		ArgsUsage:   "<src-index> [<dst-index>]",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "entry",
+				Usage:       "an entry to rewrite, as <key>=<value> (repeatable)",
+				Destination: &entries,
+				Required:    true,
+			},
+			&cli.StringFlag{
+				Name:        "note",
+				Usage:       "why the entries are patched, kept in the audit record",
+				Destination: &note,
+				Required:    true,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "check the entries against the index and print what would be written (the patched index, with its exact size and number of entries), without writing anything",
+				Destination: &dryRun,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			srcPath := c.Args().Get(0)
+			dstPath := c.Args().Get(1)
+			if srcPath == "" {
+				return fmt.Errorf("missing index path")
+			}
+			if dstPath == "" {
+				dstPath = srcPath
+			}
+			kind, err := indexKindOf(srcPath)
+			if err != nil {
+				return err
+			}
+			patches := make([]compactindexsized.Patch, 0, len(entries.Value()))
+			for _, entry := range entries.Value() {
+				key, value, ok := strings.Cut(entry, "=")
+				if !ok {
+					return fmt.Errorf("invalid entry %q: want <key>=<value>", entry)
+				}
+				patch, err := indexes.ParsePatch(kind, key, value)
+				if err != nil {
+					return fmt.Errorf("invalid entry %q: %w", entry, err)
+				}
+				patches = append(patches, patch)
+			}
+
+			record := indexes.PatchRecord{
+				Time: time.Now(),
+				Note: note,
+			}
+			if dryRun {
+				plan, err := planIndexRewrite(srcPath, dstPath, fmt.Sprintf("%d of them patched", len(patches)), func(src *os.File) (*compactindexsized.RewriteStats, error) {
+					return indexes.PlanPatch(c.Context, src, patches, record)
+				})
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				fmt.Println(plan.String())
+				return nil
+			}
+			_, _, err = rewriteIndexFile(srcPath, dstPath, func(src *os.File, dst *os.File) error {
+				return indexes.Patch(c.Context, src, dst, patches, record)
+			})
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			for _, entry := range entries.Value() {
+				klog.Infof("Patched %s", entry)
+			}
+			klog.Infof("Patched %d entries of %s index %s into %s", len(patches), kind, srcPath, dstPath)
+			return nil
+		},
+	}
+}
+
+// indexKindOf returns the kind of the compact index at path.
+func indexKindOf(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer file.Close()
+	index, err := compactindexsized.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index %s: %w", path, err)
+	}
+	kind, ok := index.GetKind()
+	if !ok {
+		return nil, fmt.Errorf("index %s has no kind", path)
+	}
+	return kind, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+func newCmd_Index_repack() *cli.Command {
+	var dryRun bool
+	return &cli.Command{
+		Name:        "repack",
+		Usage:       "Rewrite an index with another value encoding, without the CAR file.",
+		Description: "Rewrite a compact index (cid-to-offset-and-size, slot-to-cid, sig-to-cid) with its values in another encoding: packed values (cid-to-offset-and-size only) are written with the header version 2, plain values with the version 1 that older versions can read. The metadata and the buckets are kept: the keys are not stored in the index, so the number of buckets, and the format of a sig-to-cid index, can only be changed by indexing the CAR again. If <dst-index> is omitted, the index is replaced in place.",
+		ArgsUsage:   "<src-index> [<dst-index>]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "value-encoding",
+				Usage: "the encoding of the values of the repacked index; one of: plain, packed",
+				Value: string(indexes.ValueEncodingPacked),
+				Action: func(c *cli.Context, s string) error {
+					if !indexes.IsValidValueEncoding(indexes.ValueEncoding(s)) {
+						return fmt.Errorf("invalid value encoding: %q", s)
+					}
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "read the index and print what would be written (the repacked index, with its exact size and number of entries), without writing anything",
+				Destination: &dryRun,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			srcPath := c.Args().Get(0)
+			dstPath := c.Args().Get(1)
+			if srcPath == "" {
+				return fmt.Errorf("missing index path")
+			}
+			if dstPath == "" {
+				dstPath = srcPath
+			}
+			encoding := indexes.ValueEncoding(c.String("value-encoding"))
+
+			startedAt := time.Now()
+			if dryRun {
+				plan, err := planIndexRewrite(srcPath, dstPath, fmt.Sprintf("%s values", encoding), func(src *os.File) (*compactindexsized.RewriteStats, error) {
+					return indexes.PlanRepack(c.Context, src, encoding)
+				})
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				klog.Infof("Done in %s", time.Since(startedAt))
+				fmt.Println(plan.String())
+				return nil
+			}
+			srcSize, dstSize, err := repackIndex(c.Context, srcPath, dstPath, encoding)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			klog.Infof(
+				"Repacked %s (%s) to %s (%s, %s values) in %s",
+				srcPath,
+				humanize.Bytes(uint64(srcSize)),
+				dstPath,
+				humanize.Bytes(uint64(dstSize)),
+				encoding,
+				time.Since(startedAt),
+			)
+			return nil
+		},
+	}
+}
+
+// repackIndex writes the index at srcPath to dstPath (which may be srcPath) with the given
+// value encoding. It returns the sizes of both indexes.
+func repackIndex(ctx context.Context, srcPath string, dstPath string, encoding indexes.ValueEncoding) (int64, int64, error) {
+	return rewriteIndexFile(srcPath, dstPath, func(src *os.File, dst *os.File) error {
+		return indexes.Repack(ctx, src, dst, encoding)
+	})
+}
+
+// rewriteIndexFile writes the index at srcPath to dstPath (which may be srcPath) with rewrite;
+// the new index is written next to dstPath, and renamed once complete. It returns the sizes of
+// both indexes.
+func rewriteIndexFile(srcPath string, dstPath string, rewrite func(src *os.File, dst *os.File) error) (int64, int64, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat index: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".rewrite-*")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create the new index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := rewrite(src, tmp); err != nil {
+		return 0, 0, fmt.Errorf("failed to rewrite %s: %w", srcPath, err)
+	}
+	tmpInfo, err := tmp.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to stat the new index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to close the new index: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), srcInfo.Mode().Perm()); err != nil {
+		return 0, 0, fmt.Errorf("failed to set the mode of the new index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dstPath); err != nil {
+		return 0, 0, fmt.Errorf("failed to move the new index to %s: %w", dstPath, err)
+	}
+	return srcInfo.Size(), tmpInfo.Size(), nil
+}
+
+// planIndexRewrite returns what rewriteIndexFile would write to dstPath, from the stats of the
+// rewrite that plan computes for the index at srcPath; detail (optional) describes the rewrite.
+func planIndexRewrite(srcPath string, dstPath string, detail string, plan func(src *os.File) (*compactindexsized.RewriteStats, error)) (*dryRunPlan, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	defer src.Close()
+	stats, err := plan(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite %s: %w", srcPath, err)
+	}
+	kind, err := indexKindOf(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf("%s index with %s entries", kind, humanize.Comma(int64(stats.NumEntries)))
+	if detail != "" {
+		description += ", " + detail
+	}
+	if dstPath == srcPath {
+		description += "; replaces the source index"
+	}
+	p := &dryRunPlan{}
+	p.add(dstPath, stats.Size, description)
+	return p, nil
+}
@@ -14,6 +14,7 @@ func newCmd_Index_sig2cid() *cli.Command {
 	var verify bool
 	var epoch uint64
 	var network indexes.Network
+	var format indexes.Format
 	return &cli.Command{
 		Name:        "sig-to-cid",
 		Description: "Given a CAR file containing a Solana epoch, create an index of the file that maps transaction signatures to CIDs.",
@@ -52,6 +53,7 @@ func newCmd_Index_sig2cid() *cli.Command {
 					return nil
 				},
 			},
+			newSigToCidFormatFlag(&format),
 		},
 		Subcommands: []*cli.Command{},
 		Action: func(c *cli.Context) error {
@@ -72,7 +74,7 @@ func newCmd_Index_sig2cid() *cli.Command {
 				}()
 				klog.Infof("Creating Sig-to-CID index for %s", carPath)
 				indexFilepath, err := CreateIndex_sig2cid(
-					context.TODO(),
+					withIndexBuildOptions(context.TODO(), indexBuildOptions{SigToCidFormat: format}),
 					epoch,
 					network,
 					tmpDir,
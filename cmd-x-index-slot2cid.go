@@ -14,6 +14,7 @@ func newCmd_Index_slot2cid() *cli.Command {
 	var verify bool
 	var epoch uint64
 	var network indexes.Network
+	var format indexes.Format
 	return &cli.Command{
 		Name:        "slot-to-cid",
 		Description: "Given a CAR file containing a Solana epoch, create an index of the file that maps slot numbers to CIDs.",
@@ -52,6 +53,7 @@ func newCmd_Index_slot2cid() *cli.Command {
 					return nil
 				},
 			},
+			newSlotToCidFormatFlag("format", &format),
 		},
 		Subcommands: []*cli.Command{},
 		Action: func(c *cli.Context) error {
@@ -72,7 +74,7 @@ func newCmd_Index_slot2cid() *cli.Command {
 				}()
 				klog.Infof("Creating Slot-to-CID index for %s", carPath)
 				indexFilepath, err := CreateIndex_slot2cid(
-					context.TODO(),
+					withIndexBuildOptions(context.TODO(), indexBuildOptions{SlotToCidFormat: format}),
 					epoch,
 					network,
 					tmpDir,
@@ -20,6 +20,11 @@ func newCmd_Index() *cli.Command {
 			newCmd_Index_all(), // NOTE: not actually all.
 			newCmd_Index_gsfa(),
 			newCmd_Index_sigExists(),
+			newCmd_Index_fleet(),
+			newCmd_Index_repack(),
+			newCmd_Index_diff(),
+			newCmd_Index_patch(),
+			newCmd_Index_accountSnapshot(),
 		},
 	}
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+var errSigPrefixLimitReached = errors.New("limit reached")
+
+func newCmd_XSigPrefix() *cli.Command {
+	var includePatterns cli.StringSlice
+	var excludePatterns cli.StringSlice
+	var fromSlot uint64
+	var toSlot uint64
+	var limit int
+	return &cli.Command{
+		Name:        "x-sig-prefix",
+		Usage:       "Find the transactions whose signature starts with a prefix.",
+		Description: "Scan the transactions of the epochs (optionally limited to a slot range) for the signatures that start with the given base58 prefix, e.g. a truncated signature from a user report, and print them with their slot and CID. The indexes only have hashes of the signatures, so the CAR files are read sequentially; only the signatures whose first 2 bytes can match the prefix are encoded and compared.",
+		ArgsUsage:   "<prefix> <one or more config files or directories containing config files (nested is fine)>",
+		Before: func(c *cli.Context) error {
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:        "include",
+				Usage:       "Include files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(),
+				Destination: &includePatterns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "exclude",
+				Usage:       "Exclude files or dirs matching the given glob patterns",
+				Value:       cli.NewStringSlice(".git"),
+				Destination: &excludePatterns,
+			},
+			&cli.Uint64Flag{
+				Name:        "from",
+				Usage:       "First slot of the range to scan",
+				Value:       0,
+				Destination: &fromSlot,
+			},
+			&cli.Uint64Flag{
+				Name:        "to",
+				Usage:       "Last slot of the range to scan (inclusive); 0 means no limit",
+				Value:       0,
+				Destination: &toSlot,
+			},
+			&cli.IntFlag{
+				Name:        "limit",
+				Usage:       "Stop after finding this many transactions; 0 means no limit",
+				Value:       100,
+				Destination: &limit,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Args().Len() < 2 {
+				return cli.Exit("expected a prefix and at least one config file or directory", 1)
+			}
+			matcher, err := newSigPrefixMatcher(c.Args().First())
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("invalid prefix: %s", err.Error()), 1)
+			}
+			if toSlot == 0 {
+				toSlot = ^uint64(0)
+			}
+			if fromSlot > toSlot {
+				return cli.Exit(fmt.Sprintf("invalid slot range: %d > %d", fromSlot, toSlot), 1)
+			}
+			configs, err := loadConfigsForSlotRange(
+				c.Args().Tail(),
+				includePatterns.Value(),
+				excludePatterns.Value(),
+				fromSlot,
+				toSlot,
+			)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			scanner, err := newEpochScanner(c)
+			if err != nil {
+				return err
+			}
+
+			klog.Infof("Scanning %d epochs for the signatures starting with %q (%d candidate buckets out of 65536)", len(configs), c.Args().First(), matcher.NumCandidateBuckets())
+			startedAt := time.Now()
+			var numFound int
+			var numScanned uint64
+			for _, config := range configs {
+				epoch, err := scanner.open(config)
+				if err != nil {
+					return cli.Exit(err.Error(), 1)
+				}
+				scanned, err := epoch.FindSignaturesByPrefix(c.Context, matcher, fromSlot, toSlot, func(match sigPrefixMatch) error {
+					fmt.Printf("%s\tslot=%d\tcid=%s\n", match.Signature, match.Slot, match.Cid)
+					numFound++
+					if limit > 0 && numFound >= limit {
+						return errSigPrefixLimitReached
+					}
+					return nil
+				})
+				epoch.Close()
+				numScanned += scanned
+				if errors.Is(err, errSigPrefixLimitReached) {
+					klog.Infof("Found %d transactions (the limit); stopping", numFound)
+					break
+				}
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("failed to scan epoch %d: %s", *config.Epoch, err.Error()), 1)
+				}
+			}
+			klog.Infof("Found %d transactions out of %d scanned in %s", numFound, numScanned, time.Since(startedAt))
+			return nil
+		},
+	}
+}
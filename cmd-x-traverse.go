@@ -97,7 +97,7 @@ func newCmd_XTraverse() *cli.Command {
 								{
 									var transaction solana.Transaction
 									{
-										txBuffer, err := loadDataFromDataFrames(&tx.Data, simpleIter.GetDataFrame)
+										txBuffer, err := loadDataFromDataFrames(context.Background(), &tx.Data, simpleIter.GetDataFrame)
 										if err != nil {
 											panic(err)
 										}
@@ -112,7 +112,7 @@ func newCmd_XTraverse() *cli.Command {
 										fmt.Println(transaction.String())
 									}
 									{
-										metaBuffer, err := loadDataFromDataFrames(&tx.Metadata, simpleIter.GetDataFrame)
+										metaBuffer, err := loadDataFromDataFrames(context.Background(), &tx.Metadata, simpleIter.GetDataFrame)
 										if err != nil {
 											panic(err)
 										}
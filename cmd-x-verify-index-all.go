@@ -12,7 +12,7 @@ func newCmd_VerifyIndex_all() *cli.Command {
 	return &cli.Command{
 		Name:        "all",
 		Description: "Verify all indexes.",
-		ArgsUsage:   "<car-path> <index-cid-to-offset> <index-slot-to-cid> <index-sig-to-cid> <index-sig-exists>",
+		ArgsUsage:   "<car-path> <index-cid-to-offset> <index-slot-to-cid> <index-sig-to-cid> <index-sig-exists> [<index-slot-to-blockhash>]",
 		Before: func(c *cli.Context) error {
 			return nil
 		},
@@ -23,6 +23,7 @@ func newCmd_VerifyIndex_all() *cli.Command {
 			indexFilePathSlot2Cid := c.Args().Get(2)
 			indexFilePathSig2Cid := c.Args().Get(3)
 			indexFilePathSigExists := c.Args().Get(4)
+			indexFilePathSlot2Blockhash := c.Args().Get(5)
 
 			{
 				startedAt := time.Now()
@@ -38,6 +39,7 @@ func newCmd_VerifyIndex_all() *cli.Command {
 						SlotToCid:          indexFilePathSlot2Cid,
 						SignatureToCid:     indexFilePathSig2Cid,
 						SignatureExists:    indexFilePathSigExists,
+						SlotToBlockhash:    indexFilePathSlot2Blockhash,
 					},
 					0,
 				)
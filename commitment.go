@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// All the data in the archive is finalized, so the commitment of the requests is only validated
+// (like the RPC does), so that strict clients that always send it keep working.
+
+// errCommitmentBelowConfirmed is the error of the methods that don't support the processed commitment (same as solana).
+var errCommitmentBelowConfirmed = errors.New("Method does not support commitment below `confirmed`")
+
+// parseCommitment parses the value of a commitment option.
+func parseCommitment(v any) (rpc.CommitmentType, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("commitment must be a string, got %T", v)
+	}
+	switch commitment := rpc.CommitmentType(s); commitment {
+	case rpc.CommitmentProcessed, rpc.CommitmentConfirmed, rpc.CommitmentFinalized:
+		return commitment, nil
+	default:
+		return "", fmt.Errorf("unknown commitment %q, expected one of `processed`, `confirmed`, `finalized`", s)
+	}
+}
+
+// checkIsAtLeastConfirmed returns an error if the commitment is processed (nil means the default, finalized).
+func checkIsAtLeastConfirmed(commitment *rpc.CommitmentType) error {
+	if commitment != nil && *commitment == rpc.CommitmentProcessed {
+		return errCommitmentBelowConfirmed
+	}
+	return nil
+}
+
+// parseCommitmentConfig parses the commitment from the optional config object at the given position
+// of the params (e.g. getSlot([config])), and returns nil if there's none.
+func parseCommitmentConfig(raw *json.RawMessage, position int) (*rpc.CommitmentType, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var params []any
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) <= position || params[position] == nil {
+		return nil, nil
+	}
+	config, ok := params[position].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("config must be an object, got %T", params[position])
+	}
+	commitmentRaw, ok := config["commitment"]
+	if !ok {
+		return nil, nil
+	}
+	commitment, err := parseCommitment(commitmentRaw)
+	if err != nil {
+		return nil, err
+	}
+	return &commitment, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommitment(t *testing.T) {
+	for _, valid := range []string{"processed", "confirmed", "finalized"} {
+		got, err := parseCommitment(valid)
+		require.NoError(t, err)
+		require.Equal(t, rpc.CommitmentType(valid), got)
+	}
+	_, err := parseCommitment("max")
+	require.Error(t, err)
+	_, err = parseCommitment(1.0)
+	require.Error(t, err)
+
+	processed := rpc.CommitmentProcessed
+	confirmed := rpc.CommitmentConfirmed
+	require.ErrorIs(t, checkIsAtLeastConfirmed(&processed), errCommitmentBelowConfirmed)
+	require.NoError(t, checkIsAtLeastConfirmed(&confirmed))
+	require.NoError(t, checkIsAtLeastConfirmed(nil))
+}
+
+func TestParseCommitmentConfig(t *testing.T) {
+	parse := func(params string) (*rpc.CommitmentType, error) {
+		raw := json.RawMessage(params)
+		return parseCommitmentConfig(&raw, 0)
+	}
+	got, err := parse(`[]`)
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	got, err = parse(`[{"commitment":"processed","minContextSlot":1}]`)
+	require.NoError(t, err)
+	require.Equal(t, rpc.CommitmentProcessed, *got)
+
+	_, err = parse(`[{"commitment":"latest"}]`)
+	require.Error(t, err)
+	_, err = parse(`["finalized"]`)
+	require.Error(t, err)
+}
+
+func TestGetBlockRequestCommitment(t *testing.T) {
+	for params, wantErr := range map[string]bool{
+		`[1]`:                             false,
+		`[1, {"commitment":"confirmed"}]`: false,
+		`[1, {"commitment":"processed"}]`: true,
+		`[1, {"commitment":"recent"}]`:    true,
+	} {
+		raw := json.RawMessage(params)
+		req, err := parseGetBlockRequest(&raw)
+		if err == nil {
+			err = req.Validate()
+		}
+		if wantErr {
+			require.Error(t, err, params)
+		} else {
+			require.NoError(t, err, params)
+		}
+	}
+}
@@ -110,12 +110,20 @@ func (b *Builder) SetKind(kind []byte) error {
 	return nil
 }
 
-func (b *Builder) Metadata() *indexmeta.Meta {
-	return b.Header.Metadata
+// SetValueFields makes the index store its values packed: the values are made of little-endian
+// unsigned integers of the given byte widths (e.g. 6 and 3 for an offset and a size), and in
+// each bucket, each field is stored as the difference to its minimum in the bucket, with the
+// bit width of the largest difference. Lookups return the values as they were inserted.
+func (b *Builder) SetValueFields(fields ...uint8) error {
+	if err := validateValueFields(fields, b.Header.ValueSize); err != nil {
+		return err
+	}
+	b.Header.ValueFields = append([]uint8(nil), fields...)
+	return nil
 }
 
-func (b *Builder) getValueSize() int {
-	return int(b.Header.ValueSize)
+func (b *Builder) Metadata() *indexmeta.Meta {
+	return b.Header.Metadata
 }
 
 // Insert writes a key-value mapping to the index.
@@ -138,30 +146,11 @@ func (b *Builder) Seal(ctx context.Context, file *os.File) (err error) {
 		file.Sync()
 	}()
 
-	// Write header.
-	headerBuf := b.Header.Bytes()
-	headerSize := int64(len(headerBuf))
-	numWroteHeader, err := file.Write(headerBuf[:])
+	headerSize, err := writeHeader(file, &b.Header)
 	if err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
-	}
-	if numWroteHeader != len(headerBuf) {
-		return fmt.Errorf("failed to write header: wrote %d bytes, expected %d", numWroteHeader, len(headerBuf))
+		return err
 	}
 	b.headerSize = headerSize
-	// Create hole to leave space for bucket header table.
-	bucketTableLen := int64(b.Header.NumBuckets) * bucketHdrLen
-	err = fallocate(file, headerSize, bucketTableLen)
-	if errors.Is(err, syscall.EOPNOTSUPP) {
-		// The underlying file system may not support fallocate
-		err = fake_fallocate(file, headerSize, bucketTableLen)
-		if err != nil {
-			return fmt.Errorf("failed to fake fallocate() bucket table: %w", err)
-		}
-	}
-	if err != nil {
-		return fmt.Errorf("failed to fallocate() bucket table: %w", err)
-	}
 	// Seal each bucket.
 	for i := range b.buckets {
 		if err := b.sealBucket(ctx, i, file); err != nil {
@@ -183,6 +172,40 @@ func (b *Builder) sealBucket(ctx context.Context, i int, f *os.File) error {
 	if err != nil {
 		return fmt.Errorf("failed to mine bucket %d: %w", i, err)
 	}
+	return writeBucket(f, &b.Header, b.headerSize, uint(i), domain, entries)
+}
+
+// writeHeader writes the header of the index, and leaves space for the table of bucket
+// headers; it returns the size of the header.
+func writeHeader(file *os.File, header *Header) (int64, error) {
+	headerBuf := header.Bytes()
+	headerSize := int64(len(headerBuf))
+	numWroteHeader, err := file.Write(headerBuf[:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to write header: %w", err)
+	}
+	if numWroteHeader != len(headerBuf) {
+		return 0, fmt.Errorf("failed to write header: wrote %d bytes, expected %d", numWroteHeader, len(headerBuf))
+	}
+	// Create hole to leave space for bucket header table.
+	bucketTableLen := int64(header.NumBuckets) * bucketHdrLen
+	err = fallocate(file, headerSize, bucketTableLen)
+	if errors.Is(err, syscall.EOPNOTSUPP) {
+		// The underlying file system may not support fallocate
+		err = fake_fallocate(file, headerSize, bucketTableLen)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fake fallocate() bucket table: %w", err)
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to fallocate() bucket table: %w", err)
+	}
+	return headerSize, nil
+}
+
+// writeBucket appends the entries of bucket i (in their final order) to the index, and writes
+// its bucket header.
+func writeBucket(f *os.File, header *Header, headerSize int64, i uint, domain uint32, entries []Entry) error {
 	// Find current file length.
 	offset, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
@@ -195,17 +218,25 @@ func (b *Builder) sealBucket(ctx context.Context, i int, f *os.File) error {
 	desc := BucketDescriptor{
 		BucketHeader: BucketHeader{
 			HashDomain: domain,
-			NumEntries: uint32(bucket.records),
+			NumEntries: uint32(len(entries)),
 			HashLen:    HashSize,
 			FileOffset: uint64(offset),
 		},
-		Stride:      b.getEntryStride(),
-		OffsetWidth: uint8(b.getValueSize()),
+		Stride:      uint8(HashSize) + uint8(header.ValueSize),
+		OffsetWidth: uint8(header.ValueSize),
 	}
-	desc.BucketHeader.headerSize = b.headerSize
-	// Write entries to file.
+	desc.BucketHeader.headerSize = headerSize
 	wr := bufio.NewWriter(f)
-	entryBuf := make([]byte, b.getEntryStride()) // TODO remove hardcoded constant
+	if len(header.ValueFields) > 0 {
+		// the packing of the values comes before the entries.
+		desc.packing = newValuePacking(header.ValueFields, entries)
+		desc.Stride = uint8(HashSize + desc.packing.packedSize())
+		if _, err := wr.Write(desc.packing.marshalHeader()); err != nil {
+			return fmt.Errorf("failed to write value packing to index: %w", err)
+		}
+	}
+	// Write entries to file.
+	entryBuf := make([]byte, desc.Stride)
 	for _, entry := range entries {
 		desc.marshalEntry(entryBuf, entry)
 		if _, err := wr.Write(entryBuf[:]); err != nil {
@@ -216,17 +247,12 @@ func (b *Builder) sealBucket(ctx context.Context, i int, f *os.File) error {
 		return fmt.Errorf("failed to flush bucket to index: %w", err)
 	}
 	// Write header to file.
-	if err := desc.BucketHeader.writeTo(f, uint(i)); err != nil {
+	if err := desc.BucketHeader.writeTo(f, i); err != nil {
 		return fmt.Errorf("failed to write bucket header %d: %w", i, err)
 	}
 	return nil
 }
 
-func (b *Builder) getEntryStride() uint8 {
-	offsetSize := b.getValueSize()
-	return uint8(HashSize) + uint8(offsetSize)
-}
-
 func (b *Builder) Close() error {
 	for _, c := range b.closers {
 		c.Close()
@@ -100,11 +100,19 @@ var Magic = [8]byte{'c', 'o', 'm', 'p', 'i', 's', 'z', 'd'}
 
 const Version = uint8(1)
 
+// VersionPackedValues is the version of the indexes with packed values (see ValueFields);
+// the readers of version 1 refuse them, instead of returning packed values.
+const VersionPackedValues = uint8(2)
+
 // Header occurs once at the beginning of the index.
 type Header struct {
 	ValueSize  uint64
 	NumBuckets uint32
-	Metadata   *indexmeta.Meta
+	// ValueFields are the byte widths of the little-endian unsigned integers that the values are
+	// made of, if the buckets store them packed (see packing.go); empty if the values are
+	// stored as they are.
+	ValueFields []uint8
+	Metadata    *indexmeta.Meta
 }
 
 // Load checks the Magic sequence and loads the header fields.
@@ -128,11 +136,24 @@ func (h *Header) Load(buf []byte) error {
 		Metadata:   new(indexmeta.Meta),
 	}
 	// Check version.
-	if buf[24] != Version {
-		return fmt.Errorf("unsupported index version: want %d, got %d", Version, buf[20])
+	metadataStart := 25
+	switch buf[24] {
+	case Version:
+	case VersionPackedValues:
+		numFields := int(buf[25])
+		if 26+numFields > len(buf) {
+			return fmt.Errorf("invalid header length")
+		}
+		h.ValueFields = append([]uint8(nil), buf[26:26+numFields]...)
+		metadataStart = 26 + numFields
+		if err := validateValueFields(h.ValueFields, h.ValueSize); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported index version: want %d or %d, got %d", Version, VersionPackedValues, buf[24])
 	}
 	// read key-value pairs
-	if err := h.Metadata.UnmarshalBinary(buf[25:]); err != nil {
+	if err := h.Metadata.UnmarshalBinary(buf[metadataStart:]); err != nil {
 		return fmt.Errorf("failed to unmarshal metadata: %w", err)
 	}
 	if h.ValueSize == 0 {
@@ -152,7 +173,14 @@ func (h *Header) Bytes() []byte {
 		// number of buckets
 		binary.Write(buf, binary.LittleEndian, h.NumBuckets)
 		// version
-		buf.WriteByte(Version)
+		if len(h.ValueFields) > 0 {
+			buf.WriteByte(VersionPackedValues)
+			// value fields
+			buf.WriteByte(uint8(len(h.ValueFields)))
+			buf.Write(h.ValueFields)
+		} else {
+			buf.WriteByte(Version)
+		}
 		// key-value pairs
 		if h.Metadata == nil {
 			h.Metadata = new(indexmeta.Meta)
@@ -231,10 +259,16 @@ type BucketDescriptor struct {
 	BucketHeader
 	Stride      uint8 // size of one entry in bucket
 	OffsetWidth uint8 // with of offset field in bucket
+	// packing is the packing of the values of the bucket, if they are packed.
+	packing *valuePacking
 }
 
 func (b *BucketDescriptor) unmarshalEntry(buf []byte) (e Entry) {
 	e.Hash = uintLe(buf[0:b.HashLen])
+	if b.packing != nil {
+		e.Value = b.packing.unpack(buf[b.HashLen:b.Stride])
+		return
+	}
 	e.Value = make([]byte, b.OffsetWidth)
 	copy(e.Value[:], buf[b.HashLen:b.HashLen+b.OffsetWidth])
 	return
@@ -245,6 +279,10 @@ func (b *BucketDescriptor) marshalEntry(buf []byte, e Entry) {
 		panic("serializeEntry: buf too small")
 	}
 	putUintLe(buf[0:b.HashLen], e.Hash)
+	if b.packing != nil {
+		b.packing.pack(buf[b.HashLen:b.Stride], e.Value)
+		return
+	}
 	copy(buf[b.HashLen:b.HashLen+b.OffsetWidth], e.Value[:])
 }
 
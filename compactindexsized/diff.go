@@ -0,0 +1,112 @@
+package compactindexsized
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Difference is a difference between the entries of a bucket of two indexes.
+//
+// The keys are not stored in the indexes, so an entry is identified by its bucket and the hash
+// of its key in the bucket; the hashes of the two buckets can only be matched if the buckets
+// have the same hash domain, which is the case if they have the same keys (the domain is the
+// first one without collisions).
+type Difference struct {
+	Bucket uint
+	// Hash is the hash of the key of the entry, unless the buckets have different hash domains.
+	Hash uint64
+	// ValueA and ValueB are the values of the entry in each index (nil if the entry is not in
+	// the index).
+	ValueA []byte
+	ValueB []byte
+	// DomainMismatch is whether the buckets have different hash domains (i.e. different keys),
+	// so their entries can't be compared; NumEntriesA and NumEntriesB are then their sizes.
+	DomainMismatch bool
+	NumEntriesA    uint32
+	NumEntriesB    uint32
+}
+
+// Diff compares the entries of two indexes, bucket by bucket, and calls fn for each difference,
+// in the order of the buckets and of the hashes; it stops at the first error of fn.
+//
+// The indexes must have the same value size and number of buckets (i.e. the same number of
+// keys, give or take a bucket); their values may have different encodings.
+func Diff(ctx context.Context, a *DB, b *DB, fn func(Difference) error) error {
+	if a.Header.ValueSize != b.Header.ValueSize {
+		return fmt.Errorf("the indexes have different value sizes: %d and %d", a.Header.ValueSize, b.Header.ValueSize)
+	}
+	if a.Header.NumBuckets != b.Header.NumBuckets {
+		return fmt.Errorf("the indexes have different numbers of buckets (%d and %d): their keys are in different buckets", a.Header.NumBuckets, b.Header.NumBuckets)
+	}
+	for i := uint(0); i < uint(a.Header.NumBuckets); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bucketA, entriesA, err := loadBucket(a, i)
+		if err != nil {
+			return fmt.Errorf("index a: %w", err)
+		}
+		bucketB, entriesB, err := loadBucket(b, i)
+		if err != nil {
+			return fmt.Errorf("index b: %w", err)
+		}
+		if bucketA.HashDomain != bucketB.HashDomain {
+			if err := fn(Difference{
+				Bucket:         i,
+				DomainMismatch: true,
+				NumEntriesA:    bucketA.NumEntries,
+				NumEntriesB:    bucketB.NumEntries,
+			}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := diffEntries(i, entriesA, entriesB, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadBucket(db *DB, i uint) (*Bucket, []Entry, error) {
+	bucket, err := db.GetBucket(i)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read bucket %d: %w", i, err)
+	}
+	entries, err := bucket.Load(0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load bucket %d: %w", i, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Hash < entries[j].Hash
+	})
+	return bucket, entries, nil
+}
+
+// diffEntries compares the entries (sorted by hash) of bucket i of two indexes.
+func diffEntries(i uint, entriesA []Entry, entriesB []Entry, fn func(Difference) error) error {
+	for len(entriesA) > 0 || len(entriesB) > 0 {
+		var diff *Difference
+		switch {
+		case len(entriesB) == 0 || (len(entriesA) > 0 && entriesA[0].Hash < entriesB[0].Hash):
+			diff = &Difference{Bucket: i, Hash: entriesA[0].Hash, ValueA: entriesA[0].Value}
+			entriesA = entriesA[1:]
+		case len(entriesA) == 0 || entriesB[0].Hash < entriesA[0].Hash:
+			diff = &Difference{Bucket: i, Hash: entriesB[0].Hash, ValueB: entriesB[0].Value}
+			entriesB = entriesB[1:]
+		default:
+			if !bytes.Equal(entriesA[0].Value, entriesB[0].Value) {
+				diff = &Difference{Bucket: i, Hash: entriesA[0].Hash, ValueA: entriesA[0].Value, ValueB: entriesB[0].Value}
+			}
+			entriesA, entriesB = entriesA[1:], entriesB[1:]
+		}
+		if diff != nil {
+			if err := fn(*diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package compactindexsized
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	build := func(numItems int, valueOf func(i int) uint64, fields ...uint8) *DB {
+		builder, err := NewBuilderSized(t.TempDir(), uint(numItems), 8)
+		require.NoError(t, err)
+		defer builder.Close()
+		if len(fields) > 0 {
+			require.NoError(t, builder.SetValueFields(fields...))
+		}
+		for i := 0; i < numItems; i++ {
+			value := make([]byte, 8)
+			putUintLe(value, valueOf(i))
+			require.NoError(t, builder.Insert([]byte(fmt.Sprintf("key-%d", i)), value))
+		}
+		file, err := os.CreateTemp(t.TempDir(), "compactindex-final-")
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+		require.NoError(t, builder.Seal(context.Background(), file))
+		db, err := Open(file)
+		require.NoError(t, err)
+		return db
+	}
+	diff := func(a, b *DB) []Difference {
+		var diffs []Difference
+		require.NoError(t, Diff(context.Background(), a, b, func(d Difference) error {
+			diffs = append(diffs, d)
+			return nil
+		}))
+		return diffs
+	}
+	identity := func(i int) uint64 { return uint64(i) }
+	original := build(1000, identity)
+
+	// the same entries, with packed values.
+	require.Empty(t, diff(original, build(1000, identity, 8)))
+
+	// a different value.
+	changed := build(1000, func(i int) uint64 {
+		if i == 42 {
+			return 4242
+		}
+		return uint64(i)
+	})
+	bucket, err := original.LookupBucket([]byte("key-42"))
+	require.NoError(t, err)
+	diffs := diff(original, changed)
+	require.Equal(t, []Difference{{
+		Hash:   bucket.Hash([]byte("key-42")),
+		ValueA: []byte{42, 0, 0, 0, 0, 0, 0, 0},
+		ValueB: []byte{0x92, 0x10, 0, 0, 0, 0, 0, 0},
+	}}, diffs)
+
+	// a missing key.
+	missing := build(999, identity)
+	bucket, err = original.LookupBucket([]byte("key-999"))
+	require.NoError(t, err)
+	diffs = diff(original, missing)
+	require.Equal(t, []Difference{{
+		Hash:   bucket.Hash([]byte("key-999")),
+		ValueA: []byte{0xe7, 0x03, 0, 0, 0, 0, 0, 0},
+	}}, diffs)
+	diffs = diff(missing, original)
+	require.Len(t, diffs, 1)
+	require.Nil(t, diffs[0].ValueA)
+
+	// a different number of buckets.
+	require.Error(t, Diff(context.Background(), original, build(20_000, identity), func(Difference) error { return nil }))
+}
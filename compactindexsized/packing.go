@@ -0,0 +1,162 @@
+package compactindexsized
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Packed values
+//
+// If the header has ValueFields, the values are made of little-endian unsigned integers of
+// these byte widths (e.g. a 6-byte offset and a 3-byte size), and each bucket stores them
+// packed: each field is the difference to the smallest value of the field in the bucket (frame
+// of reference), with the bit width of the largest difference. The entries of a bucket keep a
+// constant size (rounded up to bytes), so that they are still searched in place; a varint
+// encoding would make them variable-sized.
+//
+// The data of such a bucket starts with the base (uint64) and the bit width (uint8) of each
+// field, before the entries.
+
+// packedFieldHdrLen is the size of the base and the bit width of a field.
+const packedFieldHdrLen = 8 + 1
+
+// valuePacking is the packing of the values of a bucket.
+type valuePacking struct {
+	// fields are the byte widths of the fields of the values.
+	fields []uint8
+	bases  []uint64
+	// widths are the bit widths of the fields in the bucket.
+	widths []uint8
+}
+
+// newValuePacking returns the packing of the values of the entries of a bucket.
+func newValuePacking(fields []uint8, entries []Entry) *valuePacking {
+	p := &valuePacking{
+		fields: fields,
+		bases:  make([]uint64, len(fields)),
+		widths: make([]uint8, len(fields)),
+	}
+	maxes := make([]uint64, len(fields))
+	for i := range p.bases {
+		p.bases[i] = ^uint64(0)
+	}
+	for _, entry := range entries {
+		off := 0
+		for i, size := range fields {
+			v := uintLe(entry.Value[off : off+int(size)])
+			p.bases[i] = min(p.bases[i], v)
+			maxes[i] = max(maxes[i], v)
+			off += int(size)
+		}
+	}
+	for i := range fields {
+		if len(entries) == 0 {
+			p.bases[i] = 0
+			continue
+		}
+		p.widths[i] = uint8(bits.Len64(maxes[i] - p.bases[i]))
+	}
+	return p
+}
+
+// loadValuePacking parses the packing at the start of the data of a bucket.
+func loadValuePacking(fields []uint8, buf []byte) (*valuePacking, error) {
+	if len(buf) < len(fields)*packedFieldHdrLen {
+		return nil, fmt.Errorf("packing header is too short")
+	}
+	p := &valuePacking{
+		fields: fields,
+		bases:  make([]uint64, len(fields)),
+		widths: make([]uint8, len(fields)),
+	}
+	for i, size := range fields {
+		field := buf[i*packedFieldHdrLen:]
+		p.bases[i] = binary.LittleEndian.Uint64(field[:8])
+		p.widths[i] = field[8]
+		if p.widths[i] > 8*size {
+			return nil, fmt.Errorf("invalid bit width %d of a %d-byte field", p.widths[i], size)
+		}
+	}
+	return p, nil
+}
+
+// headerLen is the size of the packing at the start of the bucket.
+func (p *valuePacking) headerLen() int {
+	return len(p.fields) * packedFieldHdrLen
+}
+
+// marshalHeader returns the packing, as written at the start of the bucket.
+func (p *valuePacking) marshalHeader() []byte {
+	buf := make([]byte, p.headerLen())
+	for i := range p.fields {
+		field := buf[i*packedFieldHdrLen:]
+		binary.LittleEndian.PutUint64(field[:8], p.bases[i])
+		field[8] = p.widths[i]
+	}
+	return buf
+}
+
+// packedSize is the size of a packed value.
+func (p *valuePacking) packedSize() int {
+	total := 0
+	for _, width := range p.widths {
+		total += int(width)
+	}
+	return (total + 7) / 8
+}
+
+// pack writes the packed value to buf.
+func (p *valuePacking) pack(buf []byte, value []byte) {
+	for i := range buf[:p.packedSize()] {
+		buf[i] = 0
+	}
+	off, bit := 0, 0
+	for i, size := range p.fields {
+		delta := uintLe(value[off:off+int(size)]) - p.bases[i]
+		for b := 0; b < int(p.widths[i]); b++ {
+			if delta&(1<<b) != 0 {
+				buf[(bit+b)/8] |= 1 << ((bit + b) % 8)
+			}
+		}
+		off += int(size)
+		bit += int(p.widths[i])
+	}
+}
+
+// unpack returns the value of a packed value.
+func (p *valuePacking) unpack(buf []byte) []byte {
+	size := 0
+	for _, fieldSize := range p.fields {
+		size += int(fieldSize)
+	}
+	value := make([]byte, size)
+	off, bit := 0, 0
+	for i, fieldSize := range p.fields {
+		var delta uint64
+		for b := 0; b < int(p.widths[i]); b++ {
+			if buf[(bit+b)/8]&(1<<((bit+b)%8)) != 0 {
+				delta |= 1 << b
+			}
+		}
+		putUintLe(value[off:off+int(fieldSize)], p.bases[i]+delta)
+		off += int(fieldSize)
+		bit += int(p.widths[i])
+	}
+	return value
+}
+
+// validateValueFields checks that the fields make up values of valueSize bytes.
+func validateValueFields(fields []uint8, valueSize uint64) error {
+	total := uint64(0)
+	for _, size := range fields {
+		if size == 0 || size > 8 {
+			return fmt.Errorf("invalid value field size %d: must be between 1 and 8 bytes", size)
+		}
+		total += uint64(size)
+	}
+	if total != valueSize {
+		return fmt.Errorf("the value fields make %d bytes, but the value size is %d", total, valueSize)
+	}
+	return nil
+}
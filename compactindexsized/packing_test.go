@@ -0,0 +1,82 @@
+package compactindexsized
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackedValues(t *testing.T) {
+	const numItems = 25_000
+	rng := rand.New(rand.NewSource(1))
+	// a 6-byte offset (of a ~100 GB file) and a 3-byte size (< 64 KiB).
+	values := make([][]byte, numItems)
+	for i := range values {
+		values[i] = make([]byte, 9)
+		putUintLe(values[i][:6], uint64(rng.Int63n(100_000_000_000)))
+		putUintLe(values[i][6:], uint64(rng.Intn(65536)))
+	}
+	build := func(fields ...uint8) *os.File {
+		builder, err := NewBuilderSized(t.TempDir(), numItems, 9)
+		require.NoError(t, err)
+		defer builder.Close()
+		if len(fields) > 0 {
+			require.NoError(t, builder.SetValueFields(fields...))
+		}
+		for i, value := range values {
+			require.NoError(t, builder.Insert([]byte(fmt.Sprintf("key-%d", i)), value))
+		}
+		file, err := os.CreateTemp(t.TempDir(), "compactindex-final-")
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+		require.NoError(t, builder.Seal(context.Background(), file))
+		return file
+	}
+	plain := build()
+	packed := build(6, 3)
+
+	db, err := Open(packed)
+	require.NoError(t, err)
+	require.Equal(t, []uint8{6, 3}, db.Header.ValueFields)
+	for _, prefetch := range []bool{false, true} {
+		db.Prefetch(prefetch)
+		for i, value := range values {
+			got, err := db.Lookup([]byte(fmt.Sprintf("key-%d", i)))
+			require.NoError(t, err)
+			require.Equal(t, value, got)
+		}
+	}
+	_, err = db.Lookup([]byte("missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// 10 bytes per entry (a 3-byte hash, 37 + 16 bits) instead of 12.
+	plainInfo, err := plain.Stat()
+	require.NoError(t, err)
+	packedInfo, err := packed.Stat()
+	require.NoError(t, err)
+	require.Less(t, packedInfo.Size(), plainInfo.Size()*11/12)
+}
+
+func TestValueFields(t *testing.T) {
+	builder, err := NewBuilderSized(t.TempDir(), 1, 9)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.Error(t, builder.SetValueFields(6, 2))
+	require.Error(t, builder.SetValueFields(9))
+	require.NoError(t, builder.SetValueFields(6, 3))
+
+	header := Header{ValueSize: 9, NumBuckets: 1, ValueFields: []uint8{6, 3}}
+	var loaded Header
+	require.NoError(t, loaded.Load(header.Bytes()))
+	require.Equal(t, header.ValueFields, loaded.ValueFields)
+	require.Equal(t, VersionPackedValues, header.Bytes()[24])
+
+	// a value of a single entry (all fields at their base) packs to 0 bytes.
+	packing := newValuePacking([]uint8{6, 3}, []Entry{{Value: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}}})
+	require.Zero(t, packing.packedSize())
+	require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}, packing.unpack(nil))
+}
@@ -21,6 +21,7 @@ type DB struct {
 	headerSize int64
 	Stream     io.ReaderAt
 	prefetch   bool
+	stats      stats
 }
 
 var ErrInvalidMagic = errors.New("invalid magic")
@@ -64,6 +65,12 @@ func (db *DB) Prefetch(yes bool) {
 	db.prefetch = yes
 }
 
+// HotRegionSize returns the size of the region at the start of the index (the header and
+// the table of bucket headers) that is read by every lookup.
+func (db *DB) HotRegionSize() int64 {
+	return bucketOffset(db.headerSize, uint(db.Header.NumBuckets))
+}
+
 // GetKind returns the kind of the index.
 func (db *DB) GetKind() ([]byte, bool) {
 	return db.Header.Metadata.Get(indexmeta.MetadataKey_Kind)
@@ -86,7 +93,10 @@ func (db *DB) GetValueSize() uint64 {
 // Lookup queries for a key in the index and returns the value (offset), if any.
 //
 // Returns ErrNotFound if the key is unknown.
-func (db *DB) Lookup(key []byte) ([]byte, error) {
+func (db *DB) Lookup(key []byte) (value []byte, err error) {
+	defer func() {
+		db.stats.lookupDone(err)
+	}()
 	bucket, err := db.LookupBucket(key)
 	if err != nil {
 		return nil, err
@@ -118,13 +128,33 @@ func (db *DB) GetBucket(i uint) (*Bucket, error) {
 	if readErr != nil {
 		return nil, readErr
 	}
-	bucket.Entries = io.NewSectionReader(db.Stream, int64(bucket.FileOffset), int64(bucket.NumEntries)*int64(bucket.Stride))
+	db.stats.bucketProbes.Add(1)
+	db.stats.bytesRead.Add(bucketHdrLen)
+	bucket.stats = &db.stats
+	entriesOffset := int64(bucket.FileOffset)
+	if fields := db.Header.ValueFields; len(fields) > 0 {
+		// the packing of the values comes before the entries.
+		buf := make([]byte, len(fields)*packedFieldHdrLen)
+		if _, err := db.Stream.ReadAt(buf, entriesOffset); err != nil {
+			return nil, fmt.Errorf("failed to read the value packing of bucket %d: %w", i, err)
+		}
+		db.stats.bytesRead.Add(uint64(len(buf)))
+		packing, err := loadValuePacking(fields, buf)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %d: %w", i, err)
+		}
+		bucket.packing = packing
+		bucket.Stride = uint8(HashSize + packing.packedSize())
+		entriesOffset += int64(len(buf))
+	}
+	bucket.Entries = io.NewSectionReader(db.Stream, entriesOffset, int64(bucket.NumEntries)*int64(bucket.Stride))
 	if db.prefetch {
 		// TODO: find good value for numEntriesToPrefetch
 		numEntriesToPrefetch := minInt64(3_000, int64(bucket.NumEntries))
-		prefetchSize := int64(db.entryStride()) * numEntriesToPrefetch
+		prefetchSize := int64(bucket.Stride) * numEntriesToPrefetch
 		buf := make([]byte, prefetchSize)
-		_, err := bucket.Entries.ReadAt(buf, 0)
+		n, err := bucket.Entries.ReadAt(buf, 0)
+		db.stats.bytesRead.Add(uint64(n))
 		if err != nil && !errors.Is(err, io.EOF) {
 			return nil, err
 		}
@@ -171,6 +201,7 @@ func (b *BucketHeader) writeTo(wr io.WriterAt, i uint) error {
 type Bucket struct {
 	BucketDescriptor
 	Entries *io.SectionReader
+	stats   *stats
 }
 
 // maxEntriesPerBucket is the hardcoded maximum permitted number of entries per bucket.
@@ -228,6 +259,7 @@ func (b *Bucket) loadEntry(i int) (Entry, error) {
 	off := int64(i) * int64(b.Stride)
 	buf := make([]byte, b.Stride)
 	n, err := b.Entries.ReadAt(buf, off)
+	b.stats.entryRead(n)
 	if n != len(buf) {
 		return Entry{}, err
 	}
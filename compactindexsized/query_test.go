@@ -92,4 +92,5 @@ func TestOpen_HeaderOnly(t *testing.T) {
 			},
 		},
 	}, db.Header)
+	assert.Equal(t, int64(8+4+30+0x42*bucketHdrLen), db.HotRegionSize())
 }
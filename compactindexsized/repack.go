@@ -0,0 +1,196 @@
+package compactindexsized
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// Repack writes the index again to file, with the given value fields (see
+// Builder.SetValueFields), or with the values as they are if there are none; the version of
+// the header follows from the value fields, and the metadata is kept.
+//
+// The keys are not stored in the index, so the buckets are copied as they are, with their hash
+// domains and the order of their entries: the number of buckets (a function of the keys) can
+// only be changed by building the index again.
+//
+// The file should be opened with access mode os.O_RDWR, and be empty.
+func Repack(ctx context.Context, db *DB, file *os.File, valueFields []uint8) error {
+	header, err := repackHeader(db, valueFields)
+	if err != nil {
+		return err
+	}
+	return rewrite(ctx, db, file, header, nil)
+}
+
+// PlanRepack returns the size and the number of entries of the index that Repack would write,
+// without writing it.
+func PlanRepack(ctx context.Context, db *DB, valueFields []uint8) (*RewriteStats, error) {
+	header, err := repackHeader(db, valueFields)
+	if err != nil {
+		return nil, err
+	}
+	return planRewrite(ctx, db, header, nil)
+}
+
+// repackHeader returns the header of the index repacked with the value fields.
+func repackHeader(db *DB, valueFields []uint8) (*Header, error) {
+	header := &Header{
+		ValueSize:  db.Header.ValueSize,
+		NumBuckets: db.Header.NumBuckets,
+		Metadata:   db.Header.Metadata,
+	}
+	if len(valueFields) > 0 {
+		if err := validateValueFields(valueFields, header.ValueSize); err != nil {
+			return nil, err
+		}
+		header.ValueFields = append([]uint8(nil), valueFields...)
+	}
+	return header, nil
+}
+
+// Patch is the new value of the entry of a key.
+type Patch struct {
+	Key   []byte
+	Value []byte
+}
+
+// ApplyPatches writes the index again to file, with the new values of the entries of the keys,
+// and the given metadata (e.g. with a record of the patches); the buckets and the value
+// encoding are kept.
+//
+// The keys are not stored in the index: the entry of a key is the one with the hash of the key
+// in its bucket, so the keys must be keys of the index, or they would replace the value of
+// another key with the same hash (if any). A key without an entry is an ErrNotFound error.
+//
+// The file should be opened with access mode os.O_RDWR, and be empty.
+func ApplyPatches(ctx context.Context, db *DB, file *os.File, metadata *indexmeta.Meta, patches []Patch) error {
+	header := *db.Header
+	header.Metadata = metadata
+	edit, err := patchEdit(&header, patches)
+	if err != nil {
+		return err
+	}
+	return rewrite(ctx, db, file, &header, edit)
+}
+
+// PlanPatches returns the size and the number of entries of the index that ApplyPatches would
+// write, without writing it; like ApplyPatches, it fails if a key has no entry.
+func PlanPatches(ctx context.Context, db *DB, metadata *indexmeta.Meta, patches []Patch) (*RewriteStats, error) {
+	header := *db.Header
+	header.Metadata = metadata
+	edit, err := patchEdit(&header, patches)
+	if err != nil {
+		return nil, err
+	}
+	return planRewrite(ctx, db, &header, edit)
+}
+
+// patchEdit returns the edit of the buckets that applies the patches.
+func patchEdit(header *Header, patches []Patch) (func(i uint, bucket *Bucket, entries []Entry) error, error) {
+	bucketPatches := make(map[uint][]Patch)
+	for _, patch := range patches {
+		if uint64(len(patch.Value)) != header.ValueSize {
+			return nil, fmt.Errorf("the value of key %x has %d bytes, but the value size is %d", patch.Key, len(patch.Value), header.ValueSize)
+		}
+		i := header.BucketHash(patch.Key)
+		bucketPatches[i] = append(bucketPatches[i], patch)
+	}
+	return func(i uint, bucket *Bucket, entries []Entry) error {
+		for _, patch := range bucketPatches[i] {
+			hash := bucket.Hash(patch.Key)
+			found := false
+			for j := range entries {
+				if entries[j].Hash == hash {
+					entries[j].Value = patch.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("key %x: %w", patch.Key, ErrNotFound)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// RewriteStats are the size and the number of entries of a rewritten index.
+type RewriteStats struct {
+	Size       int64
+	NumEntries uint64
+}
+
+// rewrite writes the buckets of the index to file, with the given header, after calling edit
+// (if not nil) with the entries of each bucket.
+func rewrite(ctx context.Context, db *DB, file *os.File, header *Header, edit func(i uint, bucket *Bucket, entries []Entry) error) error {
+	defer func() {
+		file.Sync()
+	}()
+
+	headerSize, err := writeHeader(file, header)
+	if err != nil {
+		return err
+	}
+	return loadBuckets(ctx, db, header, edit, func(i uint, bucket *Bucket, entries []Entry) error {
+		if err := writeBucket(file, header, headerSize, i, bucket.HashDomain, entries); err != nil {
+			return fmt.Errorf("failed to write bucket %d: %w", i, err)
+		}
+		return nil
+	})
+}
+
+// planRewrite is rewrite without the writes: it returns the size of the file that rewrite
+// would write (see writeHeader and writeBucket), and its number of entries.
+func planRewrite(ctx context.Context, db *DB, header *Header, edit func(i uint, bucket *Bucket, entries []Entry) error) (*RewriteStats, error) {
+	stats := &RewriteStats{
+		Size: int64(len(header.Bytes())) + int64(header.NumBuckets)*bucketHdrLen,
+	}
+	err := loadBuckets(ctx, db, header, edit, func(_ uint, _ *Bucket, entries []Entry) error {
+		stride := HashSize + int(header.ValueSize)
+		if len(header.ValueFields) > 0 {
+			packing := newValuePacking(header.ValueFields, entries)
+			stats.Size += int64(packing.headerLen())
+			stride = HashSize + packing.packedSize()
+		}
+		stats.Size += int64(len(entries) * stride)
+		stats.NumEntries += uint64(len(entries))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// loadBuckets calls fn with the entries of each bucket of the index, in order, after calling
+// edit (if not nil) with them.
+func loadBuckets(ctx context.Context, db *DB, header *Header, edit func(i uint, bucket *Bucket, entries []Entry) error, fn func(i uint, bucket *Bucket, entries []Entry) error) error {
+	for i := uint(0); i < uint(header.NumBuckets); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bucket, err := db.GetBucket(i)
+		if err != nil {
+			return fmt.Errorf("failed to read bucket %d: %w", i, err)
+		}
+		entries, err := bucket.Load(0)
+		if err != nil {
+			return fmt.Errorf("failed to load bucket %d: %w", i, err)
+		}
+		if len(entries) != int(bucket.NumEntries) {
+			return fmt.Errorf("bucket %d is truncated: %d of %d entries", i, len(entries), bucket.NumEntries)
+		}
+		if edit != nil {
+			if err := edit(i, bucket, entries); err != nil {
+				return err
+			}
+		}
+		if err := fn(i, bucket, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package compactindexsized
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepack(t *testing.T) {
+	const numItems = 25_000
+	builder, err := NewBuilderSized(t.TempDir(), numItems, 9)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.NoError(t, builder.SetKind([]byte("test")))
+	values := make([][]byte, numItems)
+	for i := range values {
+		values[i] = make([]byte, 9)
+		putUintLe(values[i][:6], uint64(i)*4096)
+		putUintLe(values[i][6:], uint64(i%1000))
+		require.NoError(t, builder.Insert([]byte(fmt.Sprintf("key-%d", i)), values[i]))
+	}
+	plain, err := os.CreateTemp(t.TempDir(), "compactindex-plain-")
+	require.NoError(t, err)
+	defer plain.Close()
+	require.NoError(t, builder.Seal(context.Background(), plain))
+
+	repack := func(src *os.File, fields ...uint8) *os.File {
+		db, err := Open(src)
+		require.NoError(t, err)
+		dst, err := os.CreateTemp(t.TempDir(), "compactindex-repacked-")
+		require.NoError(t, err)
+		t.Cleanup(func() { dst.Close() })
+		require.NoError(t, Repack(context.Background(), db, dst, fields))
+		return dst
+	}
+	packed := repack(plain, 6, 3)
+
+	// the plans have the sizes of the repacked indexes.
+	for _, fields := range [][]uint8{nil, {6, 3}} {
+		db, err := Open(plain)
+		require.NoError(t, err)
+		stats, err := PlanRepack(context.Background(), db, fields)
+		require.NoError(t, err)
+		info, err := repack(plain, fields...).Stat()
+		require.NoError(t, err)
+		require.Equal(t, &RewriteStats{Size: info.Size(), NumEntries: numItems}, stats)
+	}
+
+	db, err := Open(packed)
+	require.NoError(t, err)
+	require.Equal(t, []uint8{6, 3}, db.Header.ValueFields)
+	require.True(t, db.KindIs([]byte("test")))
+	for i, value := range values {
+		got, err := db.Lookup([]byte(fmt.Sprintf("key-%d", i)))
+		require.NoError(t, err)
+		require.Equal(t, value, got)
+	}
+	_, err = db.Lookup([]byte("missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// unpacking restores the original index.
+	unpacked := repack(packed)
+	want, err := io.ReadAll(io.NewSectionReader(plain, 0, 1<<40))
+	require.NoError(t, err)
+	got, err := io.ReadAll(io.NewSectionReader(unpacked, 0, 1<<40))
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	db, err = Open(plain)
+	require.NoError(t, err)
+	dst, err := os.CreateTemp(t.TempDir(), "compactindex-invalid-")
+	require.NoError(t, err)
+	defer dst.Close()
+	require.Error(t, Repack(context.Background(), db, dst, []uint8{4, 4}))
+}
+
+func TestApplyPatches(t *testing.T) {
+	const numItems = 1000
+	builder, err := NewBuilderSized(t.TempDir(), numItems, 8)
+	require.NoError(t, err)
+	defer builder.Close()
+	for i := 0; i < numItems; i++ {
+		value := make([]byte, 8)
+		putUintLe(value, uint64(i))
+		require.NoError(t, builder.Insert([]byte(fmt.Sprintf("key-%d", i)), value))
+	}
+	file, err := os.CreateTemp(t.TempDir(), "compactindex-final-")
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, builder.Seal(context.Background(), file))
+	db, err := Open(file)
+	require.NoError(t, err)
+
+	metadata := &indexmeta.Meta{}
+	require.NoError(t, metadata.Add([]byte("patch"), []byte("fix")))
+	patched, err := os.CreateTemp(t.TempDir(), "compactindex-patched-")
+	require.NoError(t, err)
+	defer patched.Close()
+	require.NoError(t, ApplyPatches(context.Background(), db, patched, metadata, []Patch{
+		{Key: []byte("key-7"), Value: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+	}))
+
+	stats, err := PlanPatches(context.Background(), db, metadata, []Patch{
+		{Key: []byte("key-7"), Value: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+	})
+	require.NoError(t, err)
+	info, err := patched.Stat()
+	require.NoError(t, err)
+	require.Equal(t, &RewriteStats{Size: info.Size(), NumEntries: numItems}, stats)
+	_, err = PlanPatches(context.Background(), db, metadata, []Patch{{Key: []byte("missing"), Value: make([]byte, 8)}})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	db, err = Open(patched)
+	require.NoError(t, err)
+	got, ok := db.Header.Metadata.Get([]byte("patch"))
+	require.True(t, ok)
+	require.Equal(t, []byte("fix"), got)
+	for i := 0; i < numItems; i++ {
+		value, err := db.Lookup([]byte(fmt.Sprintf("key-%d", i)))
+		require.NoError(t, err)
+		if i == 7 {
+			require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, value)
+		} else {
+			require.Equal(t, uint64(i), uintLe(value))
+		}
+	}
+
+	dst, err := os.CreateTemp(t.TempDir(), "compactindex-invalid-")
+	require.NoError(t, err)
+	defer dst.Close()
+	require.Error(t, ApplyPatches(context.Background(), db, dst, metadata, []Patch{{Key: []byte("key-7"), Value: []byte{1}}}))
+	require.ErrorIs(t, ApplyPatches(context.Background(), db, dst, metadata, []Patch{{Key: []byte("missing"), Value: make([]byte, 8)}}), ErrNotFound)
+}
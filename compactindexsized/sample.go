@@ -0,0 +1,52 @@
+package compactindexsized
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// SampledEntry is an entry of the index picked at random, with its bucket.
+//
+// The keys are not stored in the index: IsKey tells whether a key (e.g. read from the data
+// that the value points to) is the key of the entry, as far as the hashes can tell.
+type SampledEntry struct {
+	Entry
+	bucket     uint
+	numBuckets uint32
+	header     BucketHeader
+}
+
+// maxSampleAttempts is the number of empty buckets picked before giving up.
+const maxSampleAttempts = 100
+
+// SampleEntry returns an entry of the index picked at random: a random bucket, then a random
+// entry of the bucket.
+func (db *DB) SampleEntry(rng *rand.Rand) (*SampledEntry, error) {
+	for attempt := 0; attempt < maxSampleAttempts; attempt++ {
+		i := uint(rng.Int63n(int64(db.Header.NumBuckets)))
+		bucket, err := db.GetBucket(i)
+		if err != nil {
+			return nil, err
+		}
+		if bucket.NumEntries == 0 {
+			continue
+		}
+		entry, err := bucket.loadEntry(rng.Intn(int(bucket.NumEntries)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read an entry of bucket %d: %w", i, err)
+		}
+		return &SampledEntry{
+			Entry:      entry,
+			bucket:     i,
+			numBuckets: db.Header.NumBuckets,
+			header:     bucket.BucketHeader,
+		}, nil
+	}
+	return nil, fmt.Errorf("found no entries in %d random buckets", maxSampleAttempts)
+}
+
+// IsKey returns whether key hashes to the bucket and the hash of the entry.
+func (e *SampledEntry) IsKey(key []byte) bool {
+	header := Header{NumBuckets: e.numBuckets}
+	return header.BucketHash(key) == e.bucket && e.header.Hash(key) == e.Hash
+}
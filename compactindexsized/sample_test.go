@@ -0,0 +1,44 @@
+package compactindexsized
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleEntry(t *testing.T) {
+	const numItems = 25_000
+	builder, err := NewBuilderSized(t.TempDir(), numItems, 8)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.NoError(t, builder.SetValueFields(8))
+	for i := 0; i < numItems; i++ {
+		value := make([]byte, 8)
+		putUintLe(value, uint64(i))
+		require.NoError(t, builder.Insert([]byte(fmt.Sprintf("key-%d", i)), value))
+	}
+	file, err := os.CreateTemp(t.TempDir(), "compactindex-final-")
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, builder.Seal(context.Background(), file))
+	db, err := Open(file)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(1))
+	seen := make(map[uint64]bool)
+	for n := 0; n < 100; n++ {
+		entry, err := db.SampleEntry(rng)
+		require.NoError(t, err)
+		// the value is the number of the key.
+		i := uintLe(entry.Value)
+		require.Less(t, i, uint64(numItems))
+		require.True(t, entry.IsKey([]byte(fmt.Sprintf("key-%d", i))))
+		require.False(t, entry.IsKey([]byte(fmt.Sprintf("key-%d", i+1))))
+		seen[i] = true
+	}
+	require.Greater(t, len(seen), 90)
+}
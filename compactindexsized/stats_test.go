@@ -0,0 +1,55 @@
+package compactindexsized
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	const numKeys = uint(1000)
+	const valueSize = 8
+
+	builder, err := NewBuilderSized("", numKeys, valueSize)
+	require.NoError(t, err)
+	defer builder.Close()
+
+	key := make([]byte, 16)
+	for i := uint(0); i < numKeys; i++ {
+		binary.LittleEndian.PutUint64(key, uint64(i))
+		require.NoError(t, builder.Insert(key, itob(uint64(i)+1)))
+	}
+	targetFile, err := os.CreateTemp("", "compactindex-stats-")
+	require.NoError(t, err)
+	defer os.Remove(targetFile.Name())
+	defer targetFile.Close()
+	require.NoError(t, builder.Seal(context.TODO(), targetFile))
+
+	db, err := Open(targetFile)
+	require.NoError(t, err)
+	require.Equal(t, Stats{}, db.Stats())
+
+	binary.LittleEndian.PutUint64(key, 42)
+	value, err := db.Lookup(key)
+	require.NoError(t, err)
+	require.Equal(t, uint64(43), btoi(value))
+
+	stats := db.Stats()
+	require.Equal(t, uint64(1), stats.Lookups)
+	require.Equal(t, uint64(0), stats.NotFound)
+	require.Equal(t, uint64(0), stats.Failures)
+	require.Equal(t, uint64(1), stats.BucketProbes)
+	require.GreaterOrEqual(t, stats.EntryProbes, uint64(1))
+	require.Equal(t, uint64(bucketHdrLen)+stats.EntryProbes*uint64(db.entryStride()), stats.BytesRead)
+
+	binary.LittleEndian.PutUint64(key, uint64(numKeys)+1)
+	_, err = db.Lookup(key)
+	require.ErrorIs(t, err, ErrNotFound)
+	stats = db.Stats()
+	require.Equal(t, uint64(2), stats.Lookups)
+	require.Equal(t, uint64(1), stats.NotFound)
+	require.Equal(t, uint64(2), stats.BucketProbes)
+}
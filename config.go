@@ -83,9 +83,35 @@ func LoadConfig(configFilepath string) (*Config, error) {
 		return nil, fmt.Errorf("config file %q: %s", configFilepath, err.Error())
 	}
 	config.hashOfConfigFile = sum
+	config.inheritStandby()
 	return &config, nil
 }
 
+// inheritStandby fills the standby config (if any) with what it has in common with the epoch.
+func (c *Config) inheritStandby() {
+	standby := c.Standby
+	if standby == nil {
+		return
+	}
+	standby.originalFilepath = c.originalFilepath
+	standby.hashOfConfigFile = c.hashOfConfigFile
+	if standby.Epoch == nil {
+		standby.Epoch = c.Epoch
+	}
+	if standby.Version == nil {
+		standby.Version = c.Version
+	}
+	if standby.Genesis.URI.IsZero() {
+		standby.Genesis = c.Genesis
+	}
+	if standby.LeaderSchedule.URI.IsZero() {
+		standby.LeaderSchedule = c.LeaderSchedule
+	}
+	if standby.StakeWeights.URI.IsZero() {
+		standby.StakeWeights = c.StakeWeights
+	}
+}
+
 func hashFileSha256(filePath string) (string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -104,6 +130,14 @@ type PieceURLInfo struct {
 	URI URI `json:"uri" yaml:"uri"` // URL to the piece.
 }
 
+// AlternateSource is another source of the nodes of a CAR: a copy of the CAR, or an IPFS gateway.
+type AlternateSource struct {
+	// Car is a copy of the CAR file (a local path or a HTTP url), read at the offsets of the indexes.
+	Car URI `json:"car" yaml:"car"`
+	// IPFSGateway is the URL of a trustless IPFS gateway, from which the nodes are fetched by CID.
+	IPFSGateway string `json:"ipfs_gateway" yaml:"ipfs_gateway"`
+}
+
 type Config struct {
 	originalFilepath string
 	hashOfConfigFile string
@@ -111,7 +145,8 @@ type Config struct {
 	Version          *uint64 `json:"version" yaml:"version"`
 	Data             struct {
 		Car *struct {
-			URI        URI `json:"uri" yaml:"uri"`
+			URI        URI    `json:"uri" yaml:"uri"`
+			Sha256     string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks for local files.
 			FromPieces *struct {
 				Metadata struct {
 					URI URI `json:"uri" yaml:"uri"` // Local path to the metadata file.
@@ -121,6 +156,8 @@ type Config struct {
 				} `json:"deals" yaml:"deals"`
 				PieceToURI map[cid.Cid]PieceURLInfo `json:"piece_to_uri" yaml:"piece_to_uri"` // Map of piece CID to URL.
 			} `json:"from_pieces" yaml:"from_pieces"`
+			// Alternates (optional) are where the nodes that don't match their CID are read again from.
+			Alternates []AlternateSource `json:"alternates" yaml:"alternates"`
 		} `json:"car" yaml:"car"`
 		Filecoin *struct {
 			// Enable enables Filecoin mode. If false, or if this section is not present, CAR mode is used.
@@ -130,28 +167,71 @@ type Config struct {
 		} `json:"filecoin" yaml:"filecoin"`
 	} `json:"data" yaml:"data"`
 	Indexes struct {
+		// Mode is how the remote index files are accessed: "remote" (default), "download" or "pinned";
+		// use "mmap" for index files on a (network) filesystem. Can be changed live with the admin API.
+		Mode IndexMode `json:"mode" yaml:"mode"`
+		// LocalDir is where the remote index files are downloaded (required by the "download" mode).
+		LocalDir           string `json:"local_dir" yaml:"local_dir"`
 		CidToOffsetAndSize struct {
-			URI URI `json:"uri" yaml:"uri"`
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks.
 		} `json:"cid_to_offset_and_size" yaml:"cid_to_offset_and_size"` // Latest index version. Includes offset and size.
 		CidToOffset struct {
-			URI URI `json:"uri" yaml:"uri"`
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks.
 		} `json:"cid_to_offset" yaml:"cid_to_offset"` // Legacy	index, deprecated. Only includes offset.
 		SlotToCid struct {
-			URI URI `json:"uri" yaml:"uri"`
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked at startup for local files, and by the integrity checks.
 		} `json:"slot_to_cid" yaml:"slot_to_cid"`
 		SigToCid struct {
-			URI URI `json:"uri" yaml:"uri"`
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked at startup for local files, and by the integrity checks.
 		} `json:"sig_to_cid" yaml:"sig_to_cid"`
 		Gsfa struct {
 			URI URI `json:"uri" yaml:"uri"`
 		} `json:"gsfa" yaml:"gsfa"`
 		SigExists struct {
-			URI URI `json:"uri" yaml:"uri"`
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks.
 		} `json:"sig_exists" yaml:"sig_exists"`
+		// SlotToBlockhash (optional) has the blockhash and the previous blockhash of each slot;
+		// without it, getBlock reads the parent block to return the previousBlockhash.
+		SlotToBlockhash struct {
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked at startup for local files, and by the integrity checks.
+		} `json:"slot_to_blockhash" yaml:"slot_to_blockhash"`
 	} `json:"indexes" yaml:"indexes"`
 	Genesis struct {
 		URI URI `json:"uri" yaml:"uri"`
 	} `json:"genesis" yaml:"genesis"`
+	// LeaderSchedule (optional) is a local JSON file with the leader schedule of the epoch, in the
+	// format of the result of getLeaderSchedule; it answers getSlotLeaders and getBlockProduction.
+	LeaderSchedule struct {
+		URI URI `json:"uri" yaml:"uri"`
+	} `json:"leader_schedule" yaml:"leader_schedule"`
+	// StakeWeights (optional) is a local JSON file with the active stake of the validators in the
+	// epoch, by identity, in lamports.
+	StakeWeights struct {
+		URI URI `json:"uri" yaml:"uri"`
+	} `json:"stake_weights" yaml:"stake_weights"`
+	// AccountSnapshot (optional) is the state of the accounts at the start of the epoch: an
+	// account snapshot CAR and its pubkey-to-account index, for faithful_getAccountAtEpochBoundary.
+	AccountSnapshot struct {
+		Car struct {
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks.
+		} `json:"car" yaml:"car"`
+		Index struct {
+			URI    URI    `json:"uri" yaml:"uri"`
+			Sha256 string `json:"sha256" yaml:"sha256"` // Optional; checked by the integrity checks.
+		} `json:"index" yaml:"index"`
+	} `json:"account_snapshot" yaml:"account_snapshot"`
+	// Standby (optional) is a copy of the epoch on other storage (its own data and indexes),
+	// opened along with the epoch and promoted to serve it when the reads of the epoch fail or
+	// are too slow (see --standby-latency-slo); its epoch, version, genesis and sidecars are the
+	// ones of the epoch, unless set.
+	Standby *Config `json:"standby" yaml:"standby"`
 }
 
 // IsDeprecatedIndexes returns true if the config is using the deprecated indexes version.
@@ -221,6 +301,18 @@ func (c ConfigSlice) Validate() error {
 	return nil
 }
 
+// withStandbys returns the configs, and the configs of their standbys.
+func (c ConfigSlice) withStandbys() ConfigSlice {
+	out := make(ConfigSlice, 0, len(c))
+	for _, config := range c {
+		out = append(out, config)
+		if config.Standby != nil {
+			out = append(out, config.Standby)
+		}
+	}
+	return out
+}
+
 func (c ConfigSlice) SortByEpoch() {
 	sort.Slice(c, func(i, j int) bool {
 		return *c[i].Epoch < *c[j].Epoch
@@ -301,6 +393,19 @@ func (c *Config) Validate() error {
 				}
 			}
 		}
+		for i, alternate := range c.Data.Car.Alternates {
+			if alternate.Car.IsZero() == (alternate.IPFSGateway == "") {
+				return fmt.Errorf("data.car.alternates[%d] must have either a car or an ipfs_gateway", i)
+			}
+			if !alternate.Car.IsZero() {
+				if err := isSupportedURI(alternate.Car, fmt.Sprintf("data.car.alternates[%d].car", i)); err != nil {
+					return err
+				}
+			}
+			if alternate.IPFSGateway != "" && !URI(alternate.IPFSGateway).IsRemoteWeb() {
+				return fmt.Errorf("data.car.alternates[%d].ipfs_gateway must be a HTTP url", i)
+			}
+		}
 		// CidToOffsetAndSize and CidToOffset cannot be both set or both unset.
 		if !c.Indexes.CidToOffsetAndSize.URI.IsZero() && !c.Indexes.CidToOffset.URI.IsZero() {
 			return fmt.Errorf("indexes.cid_to_offset_and_size.uri and indexes.cid_to_offset.uri cannot both be set")
@@ -397,6 +502,18 @@ func (c *Config) Validate() error {
 		if !c.Indexes.SigExists.URI.IsValid() {
 			return fmt.Errorf("indexes.sig_exists.uri is invalid")
 		}
+		if !c.Indexes.SlotToBlockhash.URI.IsZero() && !c.Indexes.SlotToBlockhash.URI.IsValid() {
+			return fmt.Errorf("indexes.slot_to_blockhash.uri is invalid")
+		}
+		// the account snapshot (optional) needs both its car and its index.
+		if !c.AccountSnapshot.Car.URI.IsZero() || !c.AccountSnapshot.Index.URI.IsZero() {
+			if !c.AccountSnapshot.Car.URI.IsValid() || !(c.AccountSnapshot.Car.URI.IsLocal() || c.AccountSnapshot.Car.URI.IsRemoteWeb()) {
+				return fmt.Errorf("account_snapshot.car.uri must be a local path or a HTTP url")
+			}
+			if !c.AccountSnapshot.Index.URI.IsValid() {
+				return fmt.Errorf("account_snapshot.index.uri is invalid")
+			}
+		}
 		{
 			if !c.Indexes.Gsfa.URI.IsZero() && !c.Indexes.Gsfa.URI.IsValid() {
 				return fmt.Errorf("indexes.gsfa.uri is invalid")
@@ -407,6 +524,29 @@ func (c *Config) Validate() error {
 			}
 		}
 	}
+	{
+		if c.Indexes.Mode != "" && !c.Indexes.Mode.IsValid() {
+			return fmt.Errorf("indexes.mode %q is invalid (supported: remote, download, mmap, pinned)", c.Indexes.Mode)
+		}
+		if c.Indexes.Mode == IndexModeDownload && c.Indexes.LocalDir == "" {
+			return fmt.Errorf("indexes.mode is %q, but indexes.local_dir is not set", c.Indexes.Mode)
+		}
+		if c.Indexes.Mode == IndexModeMmap {
+			for name, uri := range map[string]URI{
+				"cid_to_offset_and_size": c.Indexes.CidToOffsetAndSize.URI,
+				"cid_to_offset":          c.Indexes.CidToOffset.URI,
+				"slot_to_cid":            c.Indexes.SlotToCid.URI,
+				"sig_to_cid":             c.Indexes.SigToCid.URI,
+				"sig_exists":             c.Indexes.SigExists.URI,
+				"slot_to_blockhash":      c.Indexes.SlotToBlockhash.URI,
+				"account_snapshot":       c.AccountSnapshot.Index.URI,
+			} {
+				if !uri.IsZero() && !uri.IsLocal() {
+					return fmt.Errorf("indexes.mode is %q, but indexes.%s.uri is not a local path", c.Indexes.Mode, name)
+				}
+			}
+		}
+	}
 	{
 		// if epoch is 0, then the genesis URI must be set:
 		if *c.Epoch == 0 {
@@ -422,5 +562,27 @@ func (c *Config) Validate() error {
 			}
 		}
 	}
+	{
+		// the sidecar files (optional), if set, must be local files:
+		for name, uri := range map[string]URI{
+			"leader_schedule": c.LeaderSchedule.URI,
+			"stake_weights":   c.StakeWeights.URI,
+		} {
+			if !uri.IsZero() && !uri.IsLocal() {
+				return fmt.Errorf("%s.uri must be a local file", name)
+			}
+		}
+	}
+	if c.Standby != nil {
+		if c.Standby.Standby != nil {
+			return fmt.Errorf("standby.standby is not supported")
+		}
+		if c.Standby.Epoch != nil && *c.Standby.Epoch != *c.Epoch {
+			return fmt.Errorf("standby.epoch (%d) is not the epoch (%d)", *c.Standby.Epoch, *c.Epoch)
+		}
+		if err := c.Standby.Validate(); err != nil {
+			return fmt.Errorf("standby: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,227 @@
+// Package dataframe reassembles the data that is split across multiple DataFrames.
+//
+// The first DataFrame (e.g. the data of a Transaction node) links to the next ones
+// with its `next` field, and each of those can link to more frames (e.g. each frame can
+// link to the following one only): the frames are in depth-first order
+// (see the DataFrame type in ledger.ipldsch). The chains are traversed iteratively,
+// so that their length is not bounded by the stack, and the cycles are detected.
+package dataframe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+)
+
+// DefaultMaxSize is the default max size of the reassembled data.
+const DefaultMaxSize = 256 * 1024 * 1024
+
+var (
+	// ErrTooLarge is returned when the data is larger than the max size.
+	ErrTooLarge = errors.New("data is too large")
+	// ErrInvalidChain is returned when the frames don't match their index and total, or when they form a cycle.
+	ErrInvalidChain = errors.New("invalid DataFrame chain")
+)
+
+// Getter returns the DataFrame with the given CID.
+type Getter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error)
+
+// iterator returns the frames of a chain in order, fetching the linked ones as needed.
+type iterator struct {
+	ctx   context.Context
+	get   Getter
+	first *ipldbindcode.DataFrame
+	total int
+	// pending is the stack of the lists of links that remain to be visited;
+	// the links of a frame are visited before the remaining links of its parent.
+	pending [][]datamodel.Link
+	// visited is the set of the frames already visited, to detect the cycles.
+	visited map[cid.Cid]struct{}
+	count   int
+}
+
+func newIterator(ctx context.Context, first *ipldbindcode.DataFrame, get Getter) *iterator {
+	total, ok := first.GetTotal()
+	if !ok || total <= 0 {
+		// unknown.
+		total = -1
+	}
+	return &iterator{
+		ctx:     ctx,
+		get:     get,
+		first:   first,
+		total:   total,
+		visited: make(map[cid.Cid]struct{}),
+	}
+}
+
+// next returns the next frame (and its CID, which is undefined for the first frame), or io.EOF.
+func (it *iterator) next() (cid.Cid, *ipldbindcode.DataFrame, error) {
+	var frameCid cid.Cid
+	var frame *ipldbindcode.DataFrame
+	if it.count == 0 {
+		frame = it.first
+	} else {
+		if len(it.pending) == 0 {
+			if it.total >= 0 && it.count != it.total {
+				return cid.Undef, nil, fmt.Errorf("%w: got %d frames, expected %d", ErrInvalidChain, it.count, it.total)
+			}
+			return cid.Undef, nil, io.EOF
+		}
+		if err := it.ctx.Err(); err != nil {
+			return cid.Undef, nil, err
+		}
+		links := it.pending[len(it.pending)-1]
+		if len(links) == 1 {
+			// done with this list: this keeps the stack small for the long sequential chains
+			// (where each frame links to the next one).
+			it.pending = it.pending[:len(it.pending)-1]
+		} else {
+			it.pending[len(it.pending)-1] = links[1:]
+		}
+		link, ok := links[0].(cidlink.Link)
+		if !ok {
+			return cid.Undef, nil, fmt.Errorf("%w: unexpected link type %T", ErrInvalidChain, links[0])
+		}
+		frameCid = link.Cid
+		if _, ok := it.visited[frameCid]; ok {
+			return cid.Undef, nil, fmt.Errorf("%w: cycle at frame #%d (%s)", ErrInvalidChain, it.count, frameCid)
+		}
+		it.visited[frameCid] = struct{}{}
+		var err error
+		frame, err = it.get(it.ctx, frameCid)
+		if err != nil {
+			return cid.Undef, nil, fmt.Errorf("failed to get DataFrame %s: %w", frameCid, err)
+		}
+	}
+	if index, ok := frame.GetIndex(); ok && index != it.count {
+		return cid.Undef, nil, fmt.Errorf("%w: frame #%d has index %d", ErrInvalidChain, it.count, index)
+	}
+	it.count++
+	if it.total >= 0 && it.count > it.total {
+		return cid.Undef, nil, fmt.Errorf("%w: more than %d frames", ErrInvalidChain, it.total)
+	}
+	if next, ok := frame.GetNext(); ok && len(next) > 0 {
+		it.pending = append(it.pending, next)
+	}
+	return frameCid, frame, nil
+}
+
+// Walk calls fn for each frame linked (directly or not) by the first one, in order.
+func Walk(ctx context.Context, first *ipldbindcode.DataFrame, get Getter, fn func(c cid.Cid, frame *ipldbindcode.DataFrame) error) error {
+	it := newIterator(ctx, first, get)
+	for {
+		c, frame, err := it.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if it.count == 1 {
+			// the first frame.
+			continue
+		}
+		if err := fn(c, frame); err != nil {
+			return err
+		}
+	}
+}
+
+// Reader reads the data of a chain of DataFrames, fetching the frames as the data is read.
+// The hash of the data (if any) is verified at the end: the last Read returns an error instead of io.EOF
+// if it doesn't match.
+type Reader struct {
+	it       *iterator
+	current  []byte
+	size     int
+	maxSize  int
+	verifier *ipldbindcode.HashVerifier
+	err      error
+}
+
+// NewReader returns a reader of the data of the frames that start with the given one.
+func NewReader(ctx context.Context, first *ipldbindcode.DataFrame, get Getter) *Reader {
+	r := &Reader{
+		it:      newIterator(ctx, first, get),
+		maxSize: DefaultMaxSize,
+	}
+	if first.HasHash() {
+		r.verifier = ipldbindcode.NewHashVerifier()
+	}
+	return r
+}
+
+// SetMaxSize sets the max size of the data; a larger data makes Read return ErrTooLarge.
+func (r *Reader) SetMaxSize(maxSize int) {
+	r.maxSize = maxSize
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.current) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		_, frame, err := r.it.next()
+		if errors.Is(err, io.EOF) {
+			r.err = io.EOF
+			if r.verifier != nil {
+				hash, _ := r.it.first.GetHash()
+				if err := r.verifier.Verify(hash); err != nil {
+					r.err = err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.size += len(frame.Bytes())
+		if r.size > r.maxSize {
+			r.err = fmt.Errorf("%w: more than %d bytes", ErrTooLarge, r.maxSize)
+			continue
+		}
+		r.current = frame.Bytes()
+	}
+	n := copy(p, r.current)
+	if r.verifier != nil {
+		r.verifier.Write(r.current[:n])
+	}
+	r.current = r.current[n:]
+	return n, nil
+}
+
+// Load returns the whole data of the frames that start with the given one, after verifying its hash (if any).
+func Load(ctx context.Context, first *ipldbindcode.DataFrame, get Getter) ([]byte, error) {
+	if !first.HasNext() {
+		// the data is in a single frame: no need to copy it.
+		if total, ok := first.GetTotal(); ok && total > 1 {
+			return nil, fmt.Errorf("%w: got 1 frame, expected %d", ErrInvalidChain, total)
+		}
+		if index, ok := first.GetIndex(); ok && index != 0 {
+			return nil, fmt.Errorf("%w: frame #0 has index %d", ErrInvalidChain, index)
+		}
+		if len(first.Bytes()) > DefaultMaxSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, DefaultMaxSize)
+		}
+		if hash, ok := first.GetHash(); ok {
+			if err := ipldbindcode.VerifyHash(first.Bytes(), hash); err != nil {
+				return nil, err
+			}
+		}
+		return first.Bytes(), nil
+	}
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, NewReader(ctx, first, get)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
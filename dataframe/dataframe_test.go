@@ -0,0 +1,226 @@
+package dataframe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtrPtr(v int) **int {
+	p := &v
+	return &p
+}
+
+func newFrame(index int, total int, data []byte) *ipldbindcode.DataFrame {
+	return &ipldbindcode.DataFrame{
+		Kind:  6,
+		Index: intPtrPtr(index),
+		Total: intPtrPtr(total),
+		Data:  data,
+	}
+}
+
+type store map[cid.Cid]*ipldbindcode.DataFrame
+
+func (s store) add(t *testing.T, frame *ipldbindcode.DataFrame) datamodel.Link {
+	index, _ := frame.GetIndex()
+	c, err := cid.Prefix{Version: 1, Codec: cid.DagCBOR, MhType: multihash.SHA2_256, MhLength: -1}.Sum([]byte(fmt.Sprintf("frame-%d", index)))
+	require.NoError(t, err)
+	s[c] = frame
+	return cidlink.Link{Cid: c}
+}
+
+func (s store) get(ctx context.Context, c cid.Cid) (*ipldbindcode.DataFrame, error) {
+	frame, ok := s[c]
+	if !ok {
+		return nil, fmt.Errorf("not found: %s", c)
+	}
+	return frame, nil
+}
+
+func setNext(frame *ipldbindcode.DataFrame, links ...datamodel.Link) {
+	list := ipldbindcode.List__Link(links)
+	p := &list
+	frame.Next = &p
+}
+
+func setHash(frame *ipldbindcode.DataFrame, data []byte) {
+	frame.Hash = intPtrPtr(int(crc64.Checksum(data, crc64.MakeTable(crc64.ISO))))
+}
+
+// newChain returns the 10 frames of the example in ledger.ipldsch (frame 0 links to 1-5, and frame 5 links to 6-9).
+func newChain(t *testing.T) (*ipldbindcode.DataFrame, store, []byte) {
+	s := make(store)
+	frames := make([]*ipldbindcode.DataFrame, 10)
+	var all []byte
+	for i := range frames {
+		data := []byte(fmt.Sprintf("<%d>", i))
+		all = append(all, data...)
+		frames[i] = newFrame(i, len(frames), data)
+	}
+	links := make([]datamodel.Link, len(frames))
+	for i := 1; i < len(frames); i++ {
+		links[i] = s.add(t, frames[i])
+	}
+	setNext(frames[5], links[6:]...)
+	setNext(frames[0], links[1:6]...)
+	setHash(frames[0], all)
+	return frames[0], s, all
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	{
+		// single frame.
+		frame := newFrame(0, 1, []byte("hello"))
+		setHash(frame, []byte("hello"))
+		got, err := Load(ctx, frame, nil)
+		require.NoError(t, err)
+		require.Equal(t, []byte("hello"), got)
+
+		setHash(frame, []byte("world"))
+		_, err = Load(ctx, frame, nil)
+		require.Error(t, err)
+	}
+	{
+		first, s, all := newChain(t)
+		got, err := Load(ctx, first, s.get)
+		require.NoError(t, err)
+		require.Equal(t, string(all), string(got))
+
+		var visited []int
+		require.NoError(t, Walk(ctx, first, s.get, func(c cid.Cid, frame *ipldbindcode.DataFrame) error {
+			require.True(t, c.Defined())
+			index, _ := frame.GetIndex()
+			visited = append(visited, index)
+			return nil
+		}))
+		require.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, visited)
+	}
+	{
+		// wrong hash.
+		first, s, all := newChain(t)
+		setHash(first, all[1:])
+		_, err := Load(ctx, first, s.get)
+		require.Error(t, err)
+	}
+	{
+		// missing frames.
+		first, s, _ := newChain(t)
+		first.Total = intPtrPtr(11)
+		_, err := Load(ctx, first, s.get)
+		require.ErrorIs(t, err, ErrInvalidChain)
+	}
+	{
+		// too many frames.
+		first, s, _ := newChain(t)
+		first.Total = intPtrPtr(9)
+		_, err := Load(ctx, first, s.get)
+		require.ErrorIs(t, err, ErrInvalidChain)
+	}
+	{
+		// frames out of order.
+		first, s, _ := newChain(t)
+		next, _ := first.GetNext()
+		next[0], next[1] = next[1], next[0]
+		_, err := Load(ctx, first, s.get)
+		require.ErrorIs(t, err, ErrInvalidChain)
+	}
+	{
+		// missing frame.
+		first, s, _ := newChain(t)
+		next, _ := first.GetNext()
+		delete(s, next[2].(cidlink.Link).Cid)
+		_, err := Load(ctx, first, s.get)
+		require.Error(t, err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	first, s, all := newChain(t)
+	{
+		r := NewReader(context.Background(), first, s.get)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, all, got)
+	}
+	{
+		r := NewReader(context.Background(), first, s.get)
+		r.SetMaxSize(len(all) - 1)
+		_, err := io.ReadAll(r)
+		require.ErrorIs(t, err, ErrTooLarge)
+	}
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		r := NewReader(ctx, first, s.get)
+		buf := make([]byte, 3)
+		_, err := io.ReadFull(r, buf)
+		require.NoError(t, err)
+		require.Equal(t, "<0>", string(buf))
+		cancel()
+		_, err = io.ReadAll(r)
+		require.True(t, errors.Is(err, context.Canceled))
+	}
+}
+
+func TestSequentialChain(t *testing.T) {
+	// each frame links to the next one.
+	const numFrames = 10000
+	s := make(store)
+	frames := make([]*ipldbindcode.DataFrame, numFrames)
+	var all []byte
+	for i := range frames {
+		data := []byte{byte(i), byte(i >> 8)}
+		all = append(all, data...)
+		frames[i] = newFrame(i, numFrames, data)
+	}
+	for i := numFrames - 1; i > 0; i-- {
+		link := s.add(t, frames[i])
+		setNext(frames[i-1], link)
+	}
+	setHash(frames[0], all)
+
+	r := NewReader(context.Background(), frames[0], s.get)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, all, got)
+	require.LessOrEqual(t, len(r.it.pending), 1)
+}
+
+func TestCycle(t *testing.T) {
+	ctx := context.Background()
+	{
+		// a frame that links back to a previous one (without total and index, so that only the cycle detection stops it).
+		s := make(store)
+		first := &ipldbindcode.DataFrame{Kind: 6, Data: []byte("a")}
+		second := &ipldbindcode.DataFrame{Kind: 6, Data: []byte("b")}
+		secondLink := s.add(t, second)
+		setNext(first, secondLink)
+		setNext(second, secondLink)
+		_, err := Load(ctx, first, s.get)
+		require.ErrorIs(t, err, ErrInvalidChain)
+	}
+	{
+		// the same frame linked twice.
+		first, s, _ := newChain(t)
+		next, _ := first.GetNext()
+		next[1] = next[0]
+		first.Total = nil
+		for _, frame := range s {
+			frame.Index = nil
+		}
+		first.Index = nil
+		err := Walk(ctx, first, s.get, func(cid.Cid, *ipldbindcode.DataFrame) error { return nil })
+		require.ErrorIs(t, err, ErrInvalidChain)
+	}
+}
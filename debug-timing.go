@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type debugPhase int
+
+const (
+	debugPhaseIndexLookup debugPhase = iota
+	debugPhaseCarRead
+	debugPhaseDecode
+	debugPhaseEncode
+	numDebugPhases
+)
+
+var debugPhaseNames = [numDebugPhases]string{
+	debugPhaseIndexLookup: "indexLookup",
+	debugPhaseCarRead:     "carRead",
+	debugPhaseDecode:      "decode",
+	debugPhaseEncode:      "encode",
+}
+
+// debugTiming accumulates the time spent by a request in each kind of work, across all the
+// goroutines that serve it; it's returned to the client that asked for it (withDebugTiming).
+// NOTE: the durations are cumulative, so concurrent work can add up to more than the total.
+type debugTiming struct {
+	startedAt time.Time
+	durations [numDebugPhases]atomic.Int64
+	counts    [numDebugPhases]atomic.Int64
+}
+
+const debugTimingKey = MyContextKey("debugTiming")
+
+// withDebugTiming returns a context that collects the debug timings of the request.
+func withDebugTiming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugTimingKey, &debugTiming{startedAt: time.Now()})
+}
+
+func getDebugTimingFromContext(ctx context.Context) *debugTiming {
+	dt, _ := ctx.Value(debugTimingKey).(*debugTiming)
+	return dt
+}
+
+// observeDebugTiming records the work started at startedAt, if the request collects debug timings.
+func observeDebugTiming(ctx context.Context, phase debugPhase, startedAt time.Time) {
+	dt := getDebugTimingFromContext(ctx)
+	if dt == nil {
+		return
+	}
+	dt.durations[phase].Add(int64(time.Since(startedAt)))
+	dt.counts[phase].Add(1)
+}
+
+type debugPhaseTiming struct {
+	Count int64   `json:"count"`
+	Ms    float64 `json:"ms"`
+}
+
+func (dt *debugTiming) summary() map[string]any {
+	out := make(map[string]any, numDebugPhases+1)
+	for phase, name := range debugPhaseNames {
+		out[name] = debugPhaseTiming{
+			Count: dt.counts[phase].Load(),
+			Ms:    durationToMs(time.Duration(dt.durations[phase].Load())),
+		}
+	}
+	out["totalMs"] = durationToMs(time.Since(dt.startedAt))
+	return out
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// appendDebugTiming adds the debugTiming field to the given JSON object
+// (after it was encoded, so that the encoding time is included).
+func appendDebugTiming(raw []byte, dt *debugTiming) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		// not an object.
+		return raw, nil
+	}
+	field, err := fasterJson.Marshal(dt.summary())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(trimmed)+len(field)+16)
+	out = append(out, trimmed[:len(trimmed)-1]...)
+	if len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, `"debugTiming":`...)
+	out = append(out, field...)
+	out = append(out, '}')
+	return out, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugTiming(t *testing.T) {
+	// no-op if the request doesn't collect the timings.
+	observeDebugTiming(context.Background(), debugPhaseDecode, time.Now())
+
+	ctx := withDebugTiming(context.Background())
+	dt := getDebugTimingFromContext(ctx)
+	require.NotNil(t, dt)
+	observeDebugTiming(ctx, debugPhaseIndexLookup, time.Now().Add(-2*time.Millisecond))
+	observeDebugTiming(ctx, debugPhaseIndexLookup, time.Now().Add(-3*time.Millisecond))
+	observeDebugTiming(ctx, debugPhaseCarRead, time.Now())
+
+	for _, raw := range []string{`{"blockhash":"abc"}`, `{ }`} {
+		out, err := appendDebugTiming([]byte(raw), dt)
+		require.NoError(t, err)
+		var got struct {
+			Blockhash   string                     `json:"blockhash"`
+			DebugTiming map[string]json.RawMessage `json:"debugTiming"`
+		}
+		require.NoError(t, json.Unmarshal(out, &got), string(out))
+		require.Contains(t, got.DebugTiming, "totalMs")
+
+		var indexLookup debugPhaseTiming
+		require.NoError(t, json.Unmarshal(got.DebugTiming["indexLookup"], &indexLookup))
+		require.Equal(t, int64(2), indexLookup.Count)
+		require.GreaterOrEqual(t, indexLookup.Ms, 5.0)
+
+		var decode debugPhaseTiming
+		require.NoError(t, json.Unmarshal(got.DebugTiming["decode"], &decode))
+		require.Equal(t, debugPhaseTiming{}, decode)
+	}
+
+	// not an object: unchanged.
+	out, err := appendDebugTiming([]byte(`null`), dt)
+	require.NoError(t, err)
+	require.Equal(t, `null`, string(out))
+}
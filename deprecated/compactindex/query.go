@@ -11,6 +11,7 @@ type DB struct {
 	Header
 	Stream   io.ReaderAt
 	prefetch bool
+	stats    stats
 }
 
 // Open returns a handle to access a compactindex.
@@ -41,7 +42,10 @@ func (db *DB) Prefetch(yes bool) {
 // Lookup queries for a key in the index and returns the value (offset), if any.
 //
 // Returns ErrNotFound if the key is unknown.
-func (db *DB) Lookup(key []byte) (uint64, error) {
+func (db *DB) Lookup(key []byte) (value uint64, err error) {
+	defer func() {
+		db.stats.lookupDone(err)
+	}()
 	bucket, err := db.LookupBucket(key)
 	if err != nil {
 		return 0, err
@@ -72,13 +76,17 @@ func (db *DB) GetBucket(i uint) (*Bucket, error) {
 	if readErr != nil {
 		return nil, readErr
 	}
+	db.stats.bucketProbes.Add(1)
+	db.stats.bytesRead.Add(bucketHdrLen)
+	bucket.stats = &db.stats
 	bucket.Entries = io.NewSectionReader(db.Stream, int64(bucket.FileOffset), int64(bucket.NumEntries)*int64(bucket.Stride))
 	if db.prefetch {
 		// TODO: find good value for numEntriesToPrefetch
 		numEntriesToPrefetch := minInt64(3_000, int64(bucket.NumEntries))
 		prefetchSize := (4 + 3) * numEntriesToPrefetch
 		buf := make([]byte, prefetchSize)
-		_, err := bucket.Entries.ReadAt(buf, 0)
+		n, err := bucket.Entries.ReadAt(buf, 0)
+		db.stats.bytesRead.Add(uint64(n))
 		if err != nil && !errors.Is(err, io.EOF) {
 			return nil, err
 		}
@@ -124,6 +132,7 @@ func (b *BucketHeader) writeTo(wr io.WriterAt, i uint) error {
 type Bucket struct {
 	BucketDescriptor
 	Entries *io.SectionReader
+	stats   *stats
 }
 
 // maxEntriesPerBucket is the hardcoded maximum permitted number of entries per bucket.
@@ -202,6 +211,7 @@ func (b *Bucket) loadEntry(i int) (Entry, error) {
 	off := int64(i) * int64(b.Stride)
 	buf := make([]byte, b.Stride)
 	n, err := b.Entries.ReadAt(buf, off)
+	b.stats.entryRead(n)
 	if n != len(buf) {
 		return Entry{}, err
 	}
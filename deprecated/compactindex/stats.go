@@ -0,0 +1,60 @@
+package compactindex
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Stats are the counters of the lookups done on a DB since it was opened.
+type Stats struct {
+	Lookups  uint64 // calls to Lookup
+	NotFound uint64 // lookups of keys that are not in the index
+	Failures uint64 // lookups that failed with an error other than ErrNotFound
+	// BucketProbes is the number of bucket headers read.
+	BucketProbes uint64
+	// EntryProbes is the number of hashtable entries read (i.e. the search steps).
+	EntryProbes uint64
+	// BytesRead is the number of bytes read from the index (headers, entries and prefetches).
+	BytesRead uint64
+}
+
+type stats struct {
+	lookups      atomic.Uint64
+	notFound     atomic.Uint64
+	failures     atomic.Uint64
+	bucketProbes atomic.Uint64
+	entryProbes  atomic.Uint64
+	bytesRead    atomic.Uint64
+}
+
+// Stats returns the lookup counters of the DB.
+func (db *DB) Stats() Stats {
+	return Stats{
+		Lookups:      db.stats.lookups.Load(),
+		NotFound:     db.stats.notFound.Load(),
+		Failures:     db.stats.failures.Load(),
+		BucketProbes: db.stats.bucketProbes.Load(),
+		EntryProbes:  db.stats.entryProbes.Load(),
+		BytesRead:    db.stats.bytesRead.Load(),
+	}
+}
+
+func (s *stats) lookupDone(err error) {
+	s.lookups.Add(1)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		s.notFound.Add(1)
+	default:
+		s.failures.Add(1)
+	}
+}
+
+// entryRead records a read of an entry of a bucket (the bucket might not be tracked).
+func (s *stats) entryRead(size int) {
+	if s == nil {
+		return
+	}
+	s.entryProbes.Add(1)
+	s.bytesRead.Add(uint64(size))
+}
@@ -16,6 +16,7 @@ type DB struct {
 	Header
 	Stream   io.ReaderAt
 	prefetch bool
+	stats    stats
 }
 
 // Open returns a handle to access a compactindex.
@@ -46,7 +47,10 @@ func (db *DB) Prefetch(yes bool) {
 // Lookup queries for a key in the index and returns the value (offset), if any.
 //
 // Returns ErrNotFound if the key is unknown.
-func (db *DB) Lookup(key []byte) ([36]byte, error) {
+func (db *DB) Lookup(key []byte) (value [36]byte, err error) {
+	defer func() {
+		db.stats.lookupDone(err)
+	}()
 	bucket, err := db.LookupBucket(key)
 	if err != nil {
 		return Empty, err
@@ -77,13 +81,17 @@ func (db *DB) GetBucket(i uint) (*Bucket, error) {
 	if readErr != nil {
 		return nil, readErr
 	}
+	db.stats.bucketProbes.Add(1)
+	db.stats.bytesRead.Add(bucketHdrLen)
+	bucket.stats = &db.stats
 	bucket.Entries = io.NewSectionReader(db.Stream, int64(bucket.FileOffset), int64(bucket.NumEntries)*int64(bucket.Stride))
 	if db.prefetch {
 		// TODO: find good value for numEntriesToPrefetch
 		numEntriesToPrefetch := minInt64(3_000, int64(bucket.NumEntries))
 		prefetchSize := (36 + 3) * numEntriesToPrefetch
 		buf := make([]byte, prefetchSize)
-		_, err := bucket.Entries.ReadAt(buf, 0)
+		n, err := bucket.Entries.ReadAt(buf, 0)
+		db.stats.bytesRead.Add(uint64(n))
 		if err != nil && !errors.Is(err, io.EOF) {
 			return nil, err
 		}
@@ -129,6 +137,7 @@ func (b *BucketHeader) writeTo(wr io.WriterAt, i uint) error {
 type Bucket struct {
 	BucketDescriptor
 	Entries *io.SectionReader
+	stats   *stats
 }
 
 // maxEntriesPerBucket is the hardcoded maximum permitted number of entries per bucket.
@@ -191,6 +200,7 @@ func (b *Bucket) loadEntry(i int) (Entry, error) {
 	off := int64(i) * int64(b.Stride)
 	buf := make([]byte, b.Stride)
 	n, err := b.Entries.ReadAt(buf, off)
+	b.stats.entryRead(n)
 	if n != len(buf) {
 		return Entry{}, err
 	}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+)
+
+// carContents are the blocks and the epoch of a CAR, seen while it's written.
+type carContents struct {
+	Root      cid.Cid
+	NumBlocks uint64
+	FirstSlot uint64
+	LastSlot  uint64
+	Epoch     *uint64
+}
+
+// observe records the node of the given kind, if it's a block or the epoch.
+func (c *carContents) observe(kind iplddecoders.Kind, data []byte) error {
+	switch kind {
+	case iplddecoders.KindBlock:
+		block, err := iplddecoders.DecodeBlock(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode block: %w", err)
+		}
+		slot := uint64(block.Slot)
+		if c.NumBlocks == 0 || slot < c.FirstSlot {
+			c.FirstSlot = slot
+		}
+		if c.NumBlocks == 0 || slot > c.LastSlot {
+			c.LastSlot = slot
+		}
+		c.NumBlocks++
+	case iplddecoders.KindEpoch:
+		epoch, err := iplddecoders.DecodeEpoch(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode epoch: %w", err)
+		}
+		number := uint64(epoch.Epoch)
+		c.Epoch = &number
+	}
+	return nil
+}
+
+func (c *carContents) String() string {
+	var parts []string
+	if c.Root.Defined() {
+		parts = append(parts, "root "+c.Root.String())
+	}
+	if c.Epoch != nil {
+		parts = append(parts, fmt.Sprintf("epoch %d", *c.Epoch))
+	}
+	if c.NumBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("slots %d-%d (%s blocks)", c.FirstSlot, c.LastSlot, humanize.Comma(int64(c.NumBlocks))))
+	} else {
+		parts = append(parts, "no blocks")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dryRunPlan is what a command would write; with --dry-run, the rewrite commands compute it
+// (reading their input in full, so the sizes are exact) and print it instead of writing.
+type dryRunPlan struct {
+	files []dryRunFile
+}
+
+type dryRunFile struct {
+	path        string
+	size        int64 // -1 if unknown.
+	description string
+}
+
+func (p *dryRunPlan) add(path string, size int64, description string) {
+	p.files = append(p.files, dryRunFile{path: path, size: size, description: description})
+}
+
+// addCar adds a CAR file, with its contents.
+func (p *dryRunPlan) addCar(path string, size int64, contents *carContents) {
+	p.add(path, size, "CAR with "+contents.String())
+}
+
+// addIndexes adds the indexes that `index all` would create in indexDir for the CAR.
+func (p *dryRunPlan) addIndexes(indexDir string, network indexes.Network, contents *carContents) {
+	epoch := "<epoch>"
+	if contents.Epoch != nil {
+		epoch = fmt.Sprint(*contents.Epoch)
+	}
+	pattern := filepath.Join(indexDir, fmt.Sprintf("epoch-%s-%s-%s-*.index", epoch, contents.Root, network))
+	p.add(pattern, -1, "the cid-to-offset-and-size, slot-to-cid, sig-to-cid and sig-exists indexes of the new CAR")
+}
+
+func (p *dryRunPlan) String() string {
+	var b strings.Builder
+	if len(p.files) == 0 {
+		b.WriteString("Dry run: nothing would be written.")
+		return b.String()
+	}
+	b.WriteString("Dry run: nothing was written. Would write:")
+	for _, file := range p.files {
+		size := "size unknown"
+		if file.size >= 0 {
+			size = fmt.Sprintf("%s, %s bytes", humanize.Bytes(uint64(file.size)), humanize.Comma(file.size))
+		}
+		fmt.Fprintf(&b, "\n  %s (%s): %s", file.path, size, file.description)
+	}
+	return b.String()
+}
+
+// countingWriter counts the bytes written to it, and discards them.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunDedup(t *testing.T) {
+	var car bytes.Buffer
+	root, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum([]byte("root"))
+	require.NoError(t, err)
+	require.NoError(t, carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &car))
+
+	frameType := ipldbindcode.Prototypes.DataFrame.Type()
+	frame := &ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: []byte("same")}
+	frameCid := putTestNode(t, &car, frame, frameType)
+	putTestNode(t, &car, frame, frameType)
+	for _, slot := range []int{20, 10} {
+		putTestNode(t, &car, &ipldbindcode.Block{
+			Kind:      int(iplddecoders.KindBlock),
+			Slot:      slot,
+			Shredding: ipldbindcode.List__Shredding{},
+			Entries:   ipldbindcode.List__Link{},
+			Rewards:   cidlink.Link{Cid: frameCid},
+		}, ipldbindcode.Prototypes.Block.Type())
+	}
+	putTestNode(t, &car, &ipldbindcode.Epoch{
+		Kind:    int(iplddecoders.KindEpoch),
+		Epoch:   3,
+		Subsets: ipldbindcode.List__Link{},
+	}, ipldbindcode.Prototypes.Epoch.Type())
+
+	// the dry run counts exactly the bytes of the rewrite.
+	var out bytes.Buffer
+	rewritten, err := dedupCar(context.Background(), bytes.NewReader(car.Bytes()), &out)
+	require.NoError(t, err)
+	counter := &countingWriter{}
+	report, err := dedupCar(context.Background(), bytes.NewReader(car.Bytes()), counter)
+	require.NoError(t, err)
+	require.Equal(t, int64(out.Len()), counter.n)
+	require.Equal(t, rewritten.Contents, report.Contents)
+
+	epoch := uint64(3)
+	require.Equal(t, carContents{Root: root, NumBlocks: 2, FirstSlot: 10, LastSlot: 20, Epoch: &epoch}, report.Contents)
+
+	plan := &dryRunPlan{}
+	require.Equal(t, "Dry run: nothing would be written.", plan.String())
+	plan.addCar("/out/epoch-3.car", counter.n, &report.Contents)
+	plan.addIndexes("/out/indexes", indexes.NetworkMainnet, &report.Contents)
+	require.Contains(t, plan.String(), "Dry run: nothing was written. Would write:\n  /out/epoch-3.car (")
+	require.Contains(t, plan.String(), "CAR with root "+root.String()+", epoch 3, slots 10-20 (2 blocks)")
+	require.Contains(t, plan.String(), "/out/indexes/epoch-3-"+root.String()+"-mainnet-*.index (size unknown)")
+}
+
+func TestDryRunCompress(t *testing.T) {
+	car := bytes.Repeat([]byte("0123456789abcdef"), 10_000)
+	var out bytes.Buffer
+	table, err := compressCar(bytes.NewReader(car), &out, 16*1024, 3)
+	require.NoError(t, err)
+
+	plan, err := planCarCompression("-", bytes.NewReader(car), "/out/epoch-3.car.zst", 16*1024, 3)
+	require.NoError(t, err)
+	require.Len(t, plan.files, 1)
+	require.Equal(t, "/out/epoch-3.car.zst", plan.files[0].path)
+	require.Equal(t, int64(out.Len()), plan.files[0].size)
+	require.Contains(t, plan.files[0].description, fmt.Sprintf("with %d frames", len(table.Frames)))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// warmChunkSize is the size of the reads that warm the index files.
+const warmChunkSize = 1 << 20
+
+// AttachOptions are the preparations of an epoch attached with the admin API, done before it's
+// added to the served epochs, so that its first requests don't hit cold indexes.
+type AttachOptions struct {
+	// Warm reads the hot region of the index files of the epoch (their header and bucket
+	// table, read by every lookup), to bring it in the page cache (or in the cache of the
+	// remote storage).
+	Warm bool
+	// NumSamples (optional) verifies this many random entries of each index of the epoch
+	// against its CAR (see IndexSamplingConfig); the epoch is not attached if they don't match.
+	NumSamples int
+}
+
+// AttachResult is what was done to attach an epoch.
+type AttachResult struct {
+	Epoch       uint64        `json:"epoch"`
+	WarmedBytes uint64        `json:"warmedBytes"`
+	WarmTook    time.Duration `json:"warmTook"`
+	SampleTook  time.Duration `json:"sampleTook"`
+}
+
+// AttachEpoch prepares the (loaded) epoch according to the options, then adds it to the served
+// epochs at once; if it can't be, the epoch is closed.
+func (m *MultiEpoch) AttachEpoch(ctx context.Context, epoch *Epoch, opts AttachOptions) (result *AttachResult, err error) {
+	defer func() {
+		if err != nil {
+			epoch.Close()
+		}
+	}()
+	result = &AttachResult{Epoch: epoch.Epoch()}
+	if _, err := m.GetEpoch(epoch.Epoch()); err == nil {
+		return nil, fmt.Errorf("epoch %d already exists", epoch.Epoch())
+	}
+	if opts.Warm {
+		startedAt := time.Now()
+		result.WarmedBytes, err = epoch.warmIndexes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to warm the indexes of epoch %d: %w", epoch.Epoch(), err)
+		}
+		result.WarmTook = time.Since(startedAt)
+	}
+	if opts.NumSamples > 0 {
+		if epoch.IsFilecoinMode() {
+			return nil, fmt.Errorf("the indexes of epoch %d can't be sampled without a CAR", epoch.Epoch())
+		}
+		conf := &IndexSamplingConfig{NumSamples: opts.NumSamples}
+		if indexSamplingConfig != nil {
+			conf.MaxMismatchRate = indexSamplingConfig.MaxMismatchRate
+		}
+		startedAt := time.Now()
+		if err := epoch.sampleIndexes(ctx, conf); err != nil {
+			return nil, fmt.Errorf("epoch %d: %w", epoch.Epoch(), err)
+		}
+		result.SampleTook = time.Since(startedAt)
+	}
+	if err := m.AddEpoch(epoch.Epoch(), epoch); err != nil {
+		return nil, err
+	}
+	metrics_epochsAvailable.WithLabelValues(fmt.Sprintf("%d", epoch.Epoch())).Set(1)
+	klog.Infof("Epoch %d attached (warmed %d bytes in %s, sampled in %s)", epoch.Epoch(), result.WarmedBytes, result.WarmTook, result.SampleTook)
+	return result, nil
+}
+
+// warmIndexes reads the hot region of the index files of the epoch, and returns how many
+// bytes were read.
+func (e *Epoch) warmIndexes(ctx context.Context) (uint64, error) {
+	e.indexMu.RLock()
+	mounts := make([]*indexMount, 0, len(e.indexMounts))
+	for _, mount := range e.indexMounts {
+		mounts = append(mounts, mount)
+	}
+	e.indexMu.RUnlock()
+	var warmed uint64
+	buf := make([]byte, warmChunkSize)
+	for _, mount := range mounts {
+		size, err := indexHotRegionSize(mount)
+		if err != nil {
+			return warmed, fmt.Errorf("index %s: %w", mount.name, err)
+		}
+		for off := int64(0); off < size; off += int64(len(buf)) {
+			if err := ctx.Err(); err != nil {
+				return warmed, err
+			}
+			chunk := buf[:min(int64(len(buf)), size-off)]
+			n, err := mount.ReadAt(chunk, off)
+			warmed += uint64(n)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return warmed, fmt.Errorf("index %s: %w", mount.name, err)
+			}
+		}
+	}
+	return warmed, nil
+}
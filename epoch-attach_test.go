@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachEpoch(t *testing.T) {
+	rootCid := cid.MustParse("bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+	start, _ := CalcEpochLimits(1)
+	dir := t.TempDir()
+	writer, err := indexes.NewWriter_SlotToCid(1, rootCid, indexes.NetworkMainnet, dir, 4)
+	require.NoError(t, err)
+	for offset := uint64(0); offset < 4; offset++ {
+		require.NoError(t, writer.Put(start+offset, rootCid))
+	}
+	require.NoError(t, writer.Seal(context.Background(), dir))
+	path := filepath.Join(dir, filepath.Base(writer.GetFilepath()))
+
+	epoch := &Epoch{epoch: 1, config: &Config{}}
+	mount, err := epoch.mountIndex(context.Background(), "slot_to_cid", URI(path))
+	require.NoError(t, err)
+	defer epoch.Close()
+	db, err := compactindexsized.Open(mount)
+	require.NoError(t, err)
+
+	multi := NewMultiEpoch(&Options{})
+	result, err := multi.AttachEpoch(context.Background(), epoch, AttachOptions{Warm: true})
+	require.NoError(t, err)
+	require.Equal(t, uint64(db.HotRegionSize()), result.WarmedBytes)
+	served, err := multi.GetEpoch(1)
+	require.NoError(t, err)
+	require.Same(t, epoch, served)
+
+	// an epoch that is already served is not replaced.
+	_, err = multi.AttachEpoch(context.Background(), &Epoch{epoch: 1, config: &Config{}}, AttachOptions{})
+	require.ErrorContains(t, err, "already exists")
+	served, err = multi.GetEpoch(1)
+	require.NoError(t, err)
+	require.Same(t, epoch, served)
+}
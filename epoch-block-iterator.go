@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	blockiterator "github.com/rpcpool/yellowstone-faithful/block-iterator"
+)
+
+// NewBlockIterator returns an iterator that walks the blocks of this epoch in slot order,
+// reading the CAR sequentially; the start of the slot range is resolved via the indexes,
+// so that the CAR is not read from the beginning.
+func (ser *Epoch) NewBlockIterator(ctx context.Context, firstSlot, lastSlot uint64) (*blockiterator.Iterator, error) {
+	if ser.IsFilecoinMode() {
+		return nil, fmt.Errorf("epoch %d is in filecoin mode; there is no CAR file to iterate", ser.Epoch())
+	}
+	carRange, err := ser.carRangeForSlots(ctx, firstSlot, lastSlot)
+	if err != nil {
+		return nil, err
+	}
+	opts := &blockiterator.Options{
+		FirstSlot:   carRange.FirstSlot,
+		LastSlot:    &carRange.LastSlot,
+		StartOffset: carRange.StartOffset,
+	}
+	if ser.config.Data.Car != nil && ser.config.Data.Car.URI.IsLocal() && !isZstdCarPath(string(ser.config.Data.Car.URI)) {
+		return blockiterator.Open(string(ser.config.Data.Car.URI), opts)
+	}
+	if ser.remoteCarReader == nil {
+		return nil, fmt.Errorf("no CAR reader available")
+	}
+	// The remote reader is owned by the epoch, so it must not be closed by the iterator.
+	return blockiterator.NewFromReader(
+		nopReadSeekCloser{io.NewSectionReader(ser.remoteCarReader, 0, math.MaxInt64)},
+		opts,
+	)
+}
+
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+type carSlotRange struct {
+	FirstSlot   uint64
+	LastSlot    uint64
+	StartOffset uint64
+	EndOffset   uint64
+}
+
+// carRangeForSlots returns the CAR byte range [StartOffset, EndOffset) that contains the blocks
+// (and their whole DAGs) for the given slot range, clamped to the limits of this epoch.
+//
+// The objects of a block are written to the CAR before the block itself, so the
+// range starts right after the last block that precedes the first slot,
+// and ends at the end of the last block in the range.
+func (ser *Epoch) carRangeForSlots(ctx context.Context, firstSlot, lastSlot uint64) (*carSlotRange, error) {
+	epochStart, epochStop := CalcEpochLimits(ser.Epoch())
+	if firstSlot < epochStart {
+		firstSlot = epochStart
+	}
+	if lastSlot > epochStop {
+		lastSlot = epochStop
+	}
+	if firstSlot > lastSlot {
+		return nil, fmt.Errorf("slot range does not overlap with epoch %d", ser.Epoch())
+	}
+	out := &carSlotRange{
+		FirstSlot:   firstSlot,
+		LastSlot:    lastSlot,
+		StartOffset: ser.carHeaderSize,
+	}
+	// Find the end offset: the end of the last block in the range.
+	for slot := lastSlot; ; slot-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end, ok := ser.blockEndOffset(ctx, slot)
+		if ok {
+			out.EndOffset = end
+			break
+		}
+		if slot == firstSlot {
+			return nil, fmt.Errorf("no blocks found in slot range %d-%d", firstSlot, lastSlot)
+		}
+	}
+	// Find the start offset: the end of the last block before the range,
+	// or the beginning of the CAR data if there is none.
+	for slot := firstSlot; slot > epochStart; slot-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end, ok := ser.blockEndOffset(ctx, slot-1)
+		if ok {
+			out.StartOffset = end
+			break
+		}
+	}
+	return out, nil
+}
+
+// blockEndOffset returns the CAR offset right after the block for the given slot;
+// false is returned if the slot has no block (skipped or missing).
+func (ser *Epoch) blockEndOffset(ctx context.Context, slot uint64) (uint64, bool) {
+	blockCid, err := ser.FindCidFromSlot(ctx, slot)
+	if err != nil {
+		return 0, false
+	}
+	oas, err := ser.FindOffsetAndSizeFromCid(ctx, blockCid)
+	if err != nil {
+		return 0, false
+	}
+	return oas.Offset + oas.Size, true
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"k8s.io/klog/v2"
+)
+
+// IndexRebuildConfig enables the regeneration of the missing or stale index files of the epochs.
+type IndexRebuildConfig struct {
+	// TmpDir is where the intermediate files are written (default: the system's temp dir).
+	TmpDir string
+}
+
+// indexRebuildConfig is nil when the regeneration of the index files is disabled.
+var indexRebuildConfig *IndexRebuildConfig
+
+// setIndexRebuildConfig enables (or disables, if nil) the regeneration of the index files;
+// must be called before loading the epochs.
+func setIndexRebuildConfig(conf *IndexRebuildConfig) {
+	indexRebuildConfig = conf
+}
+
+// IndexNotReadyError is returned by the lookups in an index that is being rebuilt.
+type IndexNotReadyError struct {
+	Epoch uint64
+	Index string
+}
+
+func (e *IndexNotReadyError) Error() string {
+	return fmt.Sprintf("the %s index of epoch %d is being rebuilt", e.Index, e.Epoch)
+}
+
+type createIndexFunc func(ctx context.Context, epoch uint64, network indexes.Network, tmpDir string, carPath string, indexDir string) (string, error)
+
+// indexRebuild is an index file to regenerate from the CAR file, once the epoch is loaded.
+type indexRebuild struct {
+	name   string
+	uri    URI
+	reason error
+	create createIndexFunc
+	// install opens the regenerated index file, and swaps it in.
+	install func(ctx context.Context, rootCid cid.Cid) error
+}
+
+// checkLocalIndexFile returns an error if the local index file is missing, or doesn't have the expected checksum (if set).
+func checkLocalIndexFile(uri URI, expectedSha256 string) error {
+	if !uri.IsLocal() {
+		return nil
+	}
+	exists, err := fileExists(string(uri))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("index file %q does not exist", uri)
+	}
+	if expectedSha256 == "" {
+		return nil
+	}
+	got, err := hashFileSha256(string(uri))
+	if err != nil {
+		return fmt.Errorf("failed to compute the checksum of index file %q: %w", uri, err)
+	}
+	if got != expectedSha256 {
+		return fmt.Errorf("checksum mismatch for index file %q: expected sha256 %s, got %s", uri, expectedSha256, got)
+	}
+	return nil
+}
+
+// canRebuildIndex returns true if the index file at the given URI can be regenerated from the CAR file of the epoch.
+func (e *Epoch) canRebuildIndex(uri URI) bool {
+	return indexRebuildConfig != nil &&
+		uri.IsLocal() &&
+		e.IsCarMode() &&
+		!e.config.IsCarFromPieces() &&
+		e.config.Data.Car.URI.IsLocal()
+}
+
+// scheduleIndexRebuild registers the index file to regenerate once the epoch is loaded.
+func (e *Epoch) scheduleIndexRebuild(rebuild indexRebuild) {
+	klog.Warningf("Epoch %d: the %s index is unusable (%s); it will be rebuilt from the CAR file in the background", e.Epoch(), rebuild.name, rebuild.reason)
+	e.pendingRebuilds = append(e.pendingRebuilds, rebuild)
+}
+
+// startIndexRebuilds starts the regeneration of the index files that were scheduled while loading the epoch;
+// until done, the methods that need these indexes fail with an IndexNotReadyError.
+func (e *Epoch) startIndexRebuilds(ctx context.Context) {
+	if len(e.pendingRebuilds) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	e.onClose = append(e.onClose, func() error {
+		cancel()
+		return nil
+	})
+	network := indexes.NetworkMainnet
+	if e.cidToOffsetAndSizeIndex != nil && e.cidToOffsetAndSizeIndex.Meta().Network != "" {
+		network = e.cidToOffsetAndSizeIndex.Meta().Network
+	}
+	rootCid := e.rootCid
+	for _, rebuild := range e.pendingRebuilds {
+		go func(rebuild indexRebuild) {
+			metrics_indexRebuildsInProgress.Inc()
+			defer metrics_indexRebuildsInProgress.Dec()
+			startedAt := time.Now()
+			err := e.rebuildIndex(ctx, rebuild, network, rootCid)
+			if err != nil {
+				metrics_indexRebuilds.WithLabelValues(rebuild.name, "failure").Inc()
+				klog.Errorf("Epoch %d: failed to rebuild the %s index: %s", e.Epoch(), rebuild.name, err)
+				return
+			}
+			metrics_indexRebuilds.WithLabelValues(rebuild.name, "success").Inc()
+			klog.Infof("Epoch %d: rebuilt the %s index in %s", e.Epoch(), rebuild.name, time.Since(startedAt))
+		}(rebuild)
+	}
+	e.pendingRebuilds = nil
+}
+
+func (e *Epoch) rebuildIndex(ctx context.Context, rebuild indexRebuild, network indexes.Network, rootCid cid.Cid) error {
+	target := string(rebuild.uri)
+	indexDir := filepath.Dir(target)
+	if err := os.MkdirAll(indexDir, 0o755); err != nil {
+		return err
+	}
+	tmpDir := indexRebuildConfig.TmpDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	created, err := rebuild.create(ctx, e.Epoch(), network, tmpDir, string(e.config.Data.Car.URI), indexDir)
+	if err != nil {
+		return err
+	}
+	// the new index file is moved in place of the old one (if any) at once; the old one
+	// is not in use (it could not be opened).
+	if created != target {
+		if err := os.Rename(created, target); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return rebuild.install(ctx, rootCid)
+}
+
+// openSlotToCidIndex opens the slot-to-cid index file of the epoch, and checks that it's the one of the epoch.
+func (e *Epoch) openSlotToCidIndex(ctx context.Context, rootCid cid.Cid) (*indexes.SlotToCid_Reader, error) {
+	uri := e.config.Indexes.SlotToCid.URI
+	if err := checkLocalIndexFile(uri, e.config.Indexes.SlotToCid.Sha256); err != nil {
+		return nil, err
+	}
+	slotToCidIndexFile, err := e.mountIndex(ctx, "slot_to_cid", uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open slot-to-cid index file: %w", err)
+	}
+	slotToCidIndex, err := indexes.OpenWithReader_SlotToCid(slotToCidIndexFile)
+	if err == nil && !slotToCidIndex.IsDeprecatedOldVersion() {
+		if e.Epoch() != slotToCidIndex.Meta().Epoch {
+			err = fmt.Errorf("epoch mismatch in slot-to-cid index: expected %d, got %d", e.Epoch(), slotToCidIndex.Meta().Epoch)
+		} else if rootCid != cid.Undef && !rootCid.Equals(slotToCidIndex.Meta().RootCid) {
+			err = fmt.Errorf("root CID mismatch in slot-to-cid index: expected %s, got %s", rootCid, slotToCidIndex.Meta().RootCid)
+		}
+	} else if err != nil {
+		err = fmt.Errorf("failed to open slot-to-cid index: %w", err)
+	}
+	if err != nil {
+		e.unmountIndex("slot_to_cid")
+		return nil, err
+	}
+	if uri.IsRemoteWeb() {
+		slotToCidIndex.Prefetch(true)
+	}
+	return slotToCidIndex, nil
+}
+
+// openSlotToBlockhashIndex opens the (optional) slot-to-blockhash index file of the epoch, and checks
+// that it's the one of the epoch.
+func (e *Epoch) openSlotToBlockhashIndex(ctx context.Context, rootCid cid.Cid) (*indexes.SlotToBlockhash_Reader, error) {
+	uri := e.config.Indexes.SlotToBlockhash.URI
+	if err := checkLocalIndexFile(uri, e.config.Indexes.SlotToBlockhash.Sha256); err != nil {
+		return nil, err
+	}
+	slotToBlockhashIndexFile, err := e.mountIndex(ctx, "slot_to_blockhash", uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open slot-to-blockhash index file: %w", err)
+	}
+	slotToBlockhashIndex, err := indexes.OpenWithReader_SlotToBlockhash(slotToBlockhashIndexFile)
+	if err == nil {
+		if e.Epoch() != slotToBlockhashIndex.Meta().Epoch {
+			err = fmt.Errorf("epoch mismatch in slot-to-blockhash index: expected %d, got %d", e.Epoch(), slotToBlockhashIndex.Meta().Epoch)
+		} else if rootCid != cid.Undef && !rootCid.Equals(slotToBlockhashIndex.Meta().RootCid) {
+			err = fmt.Errorf("root CID mismatch in slot-to-blockhash index: expected %s, got %s", rootCid, slotToBlockhashIndex.Meta().RootCid)
+		}
+	} else {
+		err = fmt.Errorf("failed to open slot-to-blockhash index: %w", err)
+	}
+	if err != nil {
+		e.unmountIndex("slot_to_blockhash")
+		return nil, err
+	}
+	if uri.IsRemoteWeb() {
+		slotToBlockhashIndex.Prefetch(true)
+	}
+	return slotToBlockhashIndex, nil
+}
+
+// openSigToCidIndex opens the sig-to-cid index file of the epoch, and checks that it's the one of the epoch.
+func (e *Epoch) openSigToCidIndex(ctx context.Context, rootCid cid.Cid) (*indexes.SigToCid_Reader, error) {
+	uri := e.config.Indexes.SigToCid.URI
+	if err := checkLocalIndexFile(uri, e.config.Indexes.SigToCid.Sha256); err != nil {
+		return nil, err
+	}
+	sigToCidIndexFile, err := e.mountIndex(ctx, "sig_to_cid", uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sig-to-cid index file: %w", err)
+	}
+	sigToCidIndex, err := indexes.OpenWithReader_SigToCid(sigToCidIndexFile)
+	if err == nil && !sigToCidIndex.IsDeprecatedOldVersion() {
+		if e.Epoch() != sigToCidIndex.Meta().Epoch {
+			err = fmt.Errorf("epoch mismatch in sig-to-cid index: expected %d, got %d", e.Epoch(), sigToCidIndex.Meta().Epoch)
+		} else if !rootCid.Equals(sigToCidIndex.Meta().RootCid) {
+			err = fmt.Errorf("root CID mismatch in sig-to-cid index: expected %s, got %s", rootCid, sigToCidIndex.Meta().RootCid)
+		}
+	} else if err != nil {
+		err = fmt.Errorf("failed to open sig-to-cid index: %w", err)
+	}
+	if err != nil {
+		e.unmountIndex("sig_to_cid")
+		return nil, err
+	}
+	if uri.IsRemoteWeb() {
+		sigToCidIndex.Prefetch(true)
+	}
+	return sigToCidIndex, nil
+}
+
+func (e *Epoch) getSlotToCidIndex() (*indexes.SlotToCid_Reader, error) {
+	e.indexMu.RLock()
+	defer e.indexMu.RUnlock()
+	if e.slotToCidIndex == nil {
+		return nil, &IndexNotReadyError{Epoch: e.Epoch(), Index: "slot_to_cid"}
+	}
+	return e.slotToCidIndex, nil
+}
+
+func (e *Epoch) getSigToCidIndex() (*indexes.SigToCid_Reader, error) {
+	e.indexMu.RLock()
+	defer e.indexMu.RUnlock()
+	if e.sigToCidIndex == nil {
+		return nil, &IndexNotReadyError{Epoch: e.Epoch(), Index: "sig_to_cid"}
+	}
+	return e.sigToCidIndex, nil
+}
+
+func (e *Epoch) installSlotToCidIndex(ctx context.Context, rootCid cid.Cid) error {
+	slotToCidIndex, err := e.openSlotToCidIndex(ctx, rootCid)
+	if err != nil {
+		return err
+	}
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.slotToCidIndex = slotToCidIndex
+	return nil
+}
+
+func (e *Epoch) installSigToCidIndex(ctx context.Context, rootCid cid.Cid) error {
+	sigToCidIndex, err := e.openSigToCidIndex(ctx, rootCid)
+	if err != nil {
+		return err
+	}
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.sigToCidIndex = sigToCidIndex
+	return nil
+}
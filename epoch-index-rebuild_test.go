@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLocalIndexFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "epoch-0-slot-to-cid.index")
+
+	require.ErrorContains(t, checkLocalIndexFile(URI(path), ""), "does not exist")
+	// remote index files are not checked.
+	require.NoError(t, checkLocalIndexFile(URI("https://example.com/epoch-0-slot-to-cid.index"), "abc"))
+
+	data := []byte("index data")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	require.NoError(t, checkLocalIndexFile(URI(path), ""))
+	require.NoError(t, checkLocalIndexFile(URI(path), fmt.Sprintf("%x", sha256.Sum256(data))))
+	require.ErrorContains(t, checkLocalIndexFile(URI(path), fmt.Sprintf("%x", sha256.Sum256([]byte("other")))), "checksum mismatch")
+}
+
+func TestIndexNotReady(t *testing.T) {
+	ep := &Epoch{epoch: 7}
+	_, err := ep.getSlotToCidIndex()
+	var notReady *IndexNotReadyError
+	require.ErrorAs(t, err, &notReady)
+	require.Equal(t, "slot_to_cid", notReady.Index)
+	_, err = ep.getSigToCidIndex()
+	require.ErrorAs(t, err, &notReady)
+	require.Equal(t, "sig_to_cid", notReady.Index)
+
+	// the handlers report it as a public error, that the client can retry.
+	rpcErr, err := errInternal(fmt.Errorf("failed to find CID for slot 123: %w", &IndexNotReadyError{Epoch: 7, Index: "slot_to_cid"}))
+	require.Equal(t, int64(CodeIndexNotReady), rpcErr.Code)
+	require.Equal(t, map[string]any{"reason": ReasonIndexNotReady, "epoch": float64(7), "index": "slot_to_cid"}, errorData(t, rpcErr))
+	require.True(t, errors.As(err, &notReady))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"k8s.io/klog/v2"
+)
+
+// IndexSamplingConfig enables the verification of random entries of the indexes of the epochs
+// against their CAR files, when the epochs are loaded, to catch mismatched CAR/index pairs.
+type IndexSamplingConfig struct {
+	// NumSamples is the number of entries verified in each index.
+	NumSamples int
+	// MaxMismatchRate is the highest share of the entries of an index that may fail the
+	// verification.
+	MaxMismatchRate float64
+	// Degrade loads the epochs with an index above MaxMismatchRate (with a warning, and the
+	// index_sample_mismatch_rate metric), instead of failing.
+	Degrade bool
+}
+
+// indexSamplingConfig is nil when the verification of the indexes is disabled.
+var indexSamplingConfig *IndexSamplingConfig
+
+// setIndexSamplingConfig enables (or disables, if nil) the verification of the indexes; must
+// be called before loading the epochs.
+func setIndexSamplingConfig(conf *IndexSamplingConfig) {
+	indexSamplingConfig = conf
+}
+
+// errSampleUnverifiable marks a sampled entry that can't be verified (e.g. a transaction split
+// in several frames); it's not counted.
+var errSampleUnverifiable = errors.New("the entry can't be verified")
+
+// maxReportedSampleMismatches is the number of mismatches of an index that are logged.
+const maxReportedSampleMismatches = 3
+
+// indexSampleResult is the verification of the sampled entries of an index.
+type indexSampleResult struct {
+	index      string
+	checked    int
+	mismatches int
+}
+
+func (r *indexSampleResult) mismatchRate() float64 {
+	if r.checked == 0 {
+		return 0
+	}
+	return float64(r.mismatches) / float64(r.checked)
+}
+
+// sampleIndexes verifies random entries of the indexes of the epoch against the CAR file; it
+// returns an error if an index has too many mismatches (unless the config degrades).
+func (e *Epoch) sampleIndexes(ctx context.Context, conf *IndexSamplingConfig) error {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var results []*indexSampleResult
+	if e.cidToOffsetAndSizeIndex != nil {
+		results = append(results, e.sampleIndex("cid_to_offset_and_size", conf.NumSamples, func() error {
+			return e.verifyCidToOffsetAndSizeSample(ctx, rng)
+		}))
+	}
+	if e.slotToCidIndex != nil {
+		results = append(results, e.sampleIndex("slot_to_cid", conf.NumSamples, func() error {
+			return e.verifySlotToCidSample(ctx, rng)
+		}))
+	}
+	if e.sigToCidIndex != nil {
+		results = append(results, e.sampleIndex("sig_to_cid", conf.NumSamples, func() error {
+			return e.verifySigToCidSample(ctx, rng)
+		}))
+	}
+	return e.judgeIndexSamples(conf, results)
+}
+
+// sampleIndex verifies numSamples entries of an index with verify; nil if the index can't be
+// sampled.
+func (e *Epoch) sampleIndex(index string, numSamples int, verify func() error) *indexSampleResult {
+	result := &indexSampleResult{index: index}
+	for i := 0; i < numSamples; i++ {
+		err := verify()
+		switch {
+		case err == nil:
+			result.checked++
+		case errors.Is(err, indexes.ErrSamplingUnsupported):
+			klog.Infof("Epoch %d: the entries of the %s index can't be sampled", e.Epoch(), index)
+			return nil
+		case errors.Is(err, errSampleUnverifiable):
+		default:
+			result.checked++
+			result.mismatches++
+			if result.mismatches <= maxReportedSampleMismatches {
+				klog.Warningf("Epoch %d: a sampled entry of the %s index doesn't match the CAR: %s", e.Epoch(), index, err)
+			}
+		}
+	}
+	return result
+}
+
+// judgeIndexSamples reports the mismatch rates of the indexes, and returns an error if one of
+// them is above the threshold (unless the config degrades).
+func (e *Epoch) judgeIndexSamples(conf *IndexSamplingConfig, results []*indexSampleResult) error {
+	epoch := strconv.FormatUint(e.Epoch(), 10)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		rate := result.mismatchRate()
+		metrics_indexSampleMismatchRate.WithLabelValues(epoch, result.index).Set(rate)
+		if rate <= conf.MaxMismatchRate {
+			klog.V(2).Infof("Epoch %d: %d sampled entries of the %s index match the CAR", e.Epoch(), result.checked, result.index)
+			continue
+		}
+		err := fmt.Errorf(
+			"%d of %d sampled entries of the %s index don't match the CAR (%.1f%%, max %.1f%%): the index is probably not of this CAR",
+			result.mismatches,
+			result.checked,
+			result.index,
+			rate*100,
+			conf.MaxMismatchRate*100,
+		)
+		if !conf.Degrade {
+			return err
+		}
+		klog.Warningf("Epoch %d: %s; serving it anyway", e.Epoch(), err)
+	}
+	return nil
+}
+
+// verifyCidToOffsetAndSizeSample checks that the node at the offset of a random entry has the
+// size of the entry, a CID that is the key of the entry, and data that match the CID and decode.
+func (e *Epoch) verifyCidToOffsetAndSizeSample(ctx context.Context, rng *rand.Rand) error {
+	sample, err := e.cidToOffsetAndSizeIndex.Sample(rng)
+	if err != nil {
+		return err
+	}
+	oas := sample.Value
+	if oas.Size == 0 {
+		return fmt.Errorf("the entry at offset %d has a size of 0", oas.Offset)
+	}
+	section, err := e.ReadAtFromCar(ctx, oas.Offset, oas.Size)
+	if err != nil {
+		return fmt.Errorf("failed to read the node at offset %d: %w", oas.Offset, err)
+	}
+	sectionLen, n := binary.Uvarint(section)
+	if n <= 0 || sectionLen+uint64(n) != oas.Size {
+		return fmt.Errorf("the node at offset %d doesn't have the size %d", oas.Offset, oas.Size)
+	}
+	cidLen, gotCid, err := cid.CidFromBytes(section[n:])
+	if err != nil {
+		return fmt.Errorf("failed to read the CID at offset %d: %w", oas.Offset, err)
+	}
+	if !sample.IsCid(gotCid) {
+		return fmt.Errorf("the CID %s at offset %d is not the key of the entry", gotCid, oas.Offset)
+	}
+	data := section[n+cidLen:]
+	if sum, err := gotCid.Prefix().Sum(data); err != nil || !sum.Equals(gotCid) {
+		return fmt.Errorf("the data of the node %s at offset %d don't match its CID", gotCid, oas.Offset)
+	}
+	if _, err := iplddecoders.DecodeAny(data); err != nil {
+		return fmt.Errorf("failed to decode the node %s at offset %d: %w", gotCid, oas.Offset, err)
+	}
+	return nil
+}
+
+// verifySlotToCidSample checks that the CID of a random entry is a block of the slot of the entry.
+func (e *Epoch) verifySlotToCidSample(ctx context.Context, rng *rand.Rand) error {
+	sample, err := e.slotToCidIndex.Sample(rng)
+	if err != nil {
+		return err
+	}
+	data, err := e.GetNodeByCid(ctx, sample.Value)
+	if err != nil {
+		return fmt.Errorf("failed to get the block %s: %w", sample.Value, err)
+	}
+	block, err := iplddecoders.DecodeBlock(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode the block %s: %w", sample.Value, err)
+	}
+	if !sample.IsSlot(uint64(block.Slot)) {
+		return fmt.Errorf("the block %s of slot %d is not the block of the entry", sample.Value, block.Slot)
+	}
+	return nil
+}
+
+// verifySigToCidSample checks that the CID of a random entry is a transaction with the
+// signature of the entry.
+func (e *Epoch) verifySigToCidSample(ctx context.Context, rng *rand.Rand) error {
+	sample, err := e.sigToCidIndex.Sample(rng)
+	if err != nil {
+		return err
+	}
+	tx, err := e.GetTransactionByCid(ctx, sample.Value)
+	if err != nil {
+		return fmt.Errorf("failed to get the transaction %s: %w", sample.Value, err)
+	}
+	sig, err := readFirstSignature(tx.Data.Bytes())
+	if err != nil {
+		// a transaction that is split in several frames has its signatures in the first one.
+		return errSampleUnverifiable
+	}
+	if !sample.IsSignature(sig) {
+		return fmt.Errorf("the transaction %s (%s) is not the transaction of the entry", sample.Value, sig)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleIndex(t *testing.T) {
+	ep := &Epoch{epoch: 7}
+	n := 0
+	result := ep.sampleIndex("cid_to_offset_and_size", 10, func() error {
+		n++
+		switch {
+		case n <= 2:
+			return fmt.Errorf("the CID at offset %d is not the key of the entry", n)
+		case n == 3:
+			return errSampleUnverifiable
+		default:
+			return nil
+		}
+	})
+	require.Equal(t, 9, result.checked)
+	require.Equal(t, 2, result.mismatches)
+
+	require.Nil(t, ep.sampleIndex("sig_to_cid", 10, func() error {
+		return indexes.ErrSamplingUnsupported
+	}))
+
+	results := []*indexSampleResult{result, nil}
+	require.NoError(t, ep.judgeIndexSamples(&IndexSamplingConfig{MaxMismatchRate: 0.25}, results))
+	err := ep.judgeIndexSamples(&IndexSamplingConfig{MaxMismatchRate: 0.1}, results)
+	require.ErrorContains(t, err, "2 of 9 sampled entries of the cid_to_offset_and_size index")
+	require.NoError(t, ep.judgeIndexSamples(&IndexSamplingConfig{MaxMismatchRate: 0.1, Degrade: true}, results))
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// IntegrityCheckConfig enables the periodic re-verification of the checksums (the sha256 of the
+// epoch configs) of the local files of the loaded epochs, to detect bit-rot.
+type IntegrityCheckConfig struct {
+	// Interval is the time between two rounds of checks.
+	Interval time.Duration
+	// WebhookURL (optional) is POSTed the IntegrityFailure of each file that fails its check.
+	WebhookURL string
+	// Exec (optional) is a shell command run for each file that fails its check, with the
+	// IntegrityFailure on its stdin (and in FAITHFUL_INTEGRITY_* environment variables).
+	Exec string
+}
+
+// IntegrityFailure is a file of an epoch that doesn't have the checksum of the epoch config
+// (or that can't be read); it's the body of the alerts.
+type IntegrityFailure struct {
+	Time           time.Time `json:"time"`
+	Epoch          uint64    `json:"epoch"`
+	Artifact       string    `json:"artifact"`
+	Path           string    `json:"path"`
+	ExpectedSha256 string    `json:"expectedSha256"`
+	ActualSha256   string    `json:"actualSha256,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// epochArtifact is a local file of an epoch with an expected checksum.
+type epochArtifact struct {
+	Name   string
+	Path   string
+	Sha256 string
+}
+
+// checksummedArtifacts returns the local files of the epoch that have a checksum in its config;
+// the downloaded copies of the remote index files are checked against the checksums of the remote files.
+func (e *Epoch) checksummedArtifacts() []epochArtifact {
+	var out []epochArtifact
+	if car := e.config.Data.Car; car != nil && car.Sha256 != "" && car.URI.IsLocal() && !e.config.IsCarFromPieces() {
+		out = append(out, epochArtifact{Name: "car", Path: string(car.URI), Sha256: car.Sha256})
+	}
+	if snapshotCar := e.config.AccountSnapshot.Car; snapshotCar.Sha256 != "" && snapshotCar.URI.IsLocal() {
+		out = append(out, epochArtifact{Name: "account_snapshot_car", Path: string(snapshotCar.URI), Sha256: snapshotCar.Sha256})
+	}
+	for _, index := range []struct {
+		name   string
+		uri    URI
+		sha256 string
+	}{
+		{"cid_to_offset_and_size", e.config.Indexes.CidToOffsetAndSize.URI, e.config.Indexes.CidToOffsetAndSize.Sha256},
+		{"cid_to_offset", e.config.Indexes.CidToOffset.URI, e.config.Indexes.CidToOffset.Sha256},
+		{"slot_to_cid", e.config.Indexes.SlotToCid.URI, e.config.Indexes.SlotToCid.Sha256},
+		{"sig_to_cid", e.config.Indexes.SigToCid.URI, e.config.Indexes.SigToCid.Sha256},
+		{"sig_exists", e.config.Indexes.SigExists.URI, e.config.Indexes.SigExists.Sha256},
+		{"slot_to_blockhash", e.config.Indexes.SlotToBlockhash.URI, e.config.Indexes.SlotToBlockhash.Sha256},
+		{"account_snapshot", e.config.AccountSnapshot.Index.URI, e.config.AccountSnapshot.Index.Sha256},
+	} {
+		if index.uri.IsZero() || index.sha256 == "" {
+			continue
+		}
+		path := string(index.uri)
+		if !index.uri.IsLocal() {
+			mount, ok := e.getIndexMount(index.name)
+			if !ok || mount.Mode() != IndexModeDownload {
+				continue
+			}
+			path = mount.localPath()
+		}
+		out = append(out, epochArtifact{Name: index.name, Path: path, Sha256: index.sha256})
+	}
+	return out
+}
+
+// integrityChecker periodically re-verifies the checksums of the files of the epochs, and
+// alerts when a file starts failing its check (once, until it passes again).
+type integrityChecker struct {
+	conf       IntegrityCheckConfig
+	multi      *MultiEpoch
+	httpClient *http.Client
+	// failing are the files failing their check, by epoch, artifact and path.
+	failing map[string]bool
+}
+
+func newIntegrityChecker(multi *MultiEpoch, conf IntegrityCheckConfig) *integrityChecker {
+	return &integrityChecker{
+		conf:       conf,
+		multi:      multi,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		failing:    make(map[string]bool),
+	}
+}
+
+// Run checks the files every interval, until the context is done.
+func (c *integrityChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkAll(ctx)
+		}
+	}
+}
+
+// checkAll checks the files of all the loaded epochs, alerts for the new failures, and returns them.
+func (c *integrityChecker) checkAll(ctx context.Context) []*IntegrityFailure {
+	startedAt := time.Now()
+	var failures []*IntegrityFailure
+	checked := make(map[string]bool)
+	for _, epochNumber := range c.multi.GetEpochNumbers() {
+		epoch, err := c.multi.getLoadedEpoch(epochNumber)
+		if err != nil {
+			continue
+		}
+		for _, artifact := range epoch.checksummedArtifacts() {
+			if ctx.Err() != nil {
+				return failures
+			}
+			key := fmt.Sprintf("%d/%s/%s", epochNumber, artifact.Name, artifact.Path)
+			checked[key] = true
+			failure := checkArtifact(epochNumber, artifact)
+			label := strconv.FormatUint(epochNumber, 10)
+			if failure == nil {
+				metrics_integrityCheckFailing.WithLabelValues(label, artifact.Name).Set(0)
+				if c.failing[key] {
+					klog.Infof("Integrity check: %s of epoch %d (%q) is valid again", artifact.Name, epochNumber, artifact.Path)
+					delete(c.failing, key)
+				}
+				continue
+			}
+			metrics_integrityCheckFailing.WithLabelValues(label, artifact.Name).Set(1)
+			if c.failing[key] {
+				// already alerted.
+				continue
+			}
+			c.failing[key] = true
+			failures = append(failures, failure)
+			c.alert(ctx, failure)
+		}
+	}
+	// forget the files of the epochs that were removed.
+	for key := range c.failing {
+		if !checked[key] {
+			delete(c.failing, key)
+		}
+	}
+	klog.V(3).Infof("Integrity check of %d files done in %s (%d new failures)", len(checked), time.Since(startedAt), len(failures))
+	return failures
+}
+
+// checkArtifact returns the failure of the file, or nil if it has the expected checksum.
+func checkArtifact(epoch uint64, artifact epochArtifact) *IntegrityFailure {
+	failure := &IntegrityFailure{
+		Time:           time.Now().UTC(),
+		Epoch:          epoch,
+		Artifact:       artifact.Name,
+		Path:           artifact.Path,
+		ExpectedSha256: artifact.Sha256,
+	}
+	got, err := hashFileSha256(artifact.Path)
+	if err != nil {
+		failure.Error = err.Error()
+		return failure
+	}
+	if strings.EqualFold(got, artifact.Sha256) {
+		return nil
+	}
+	failure.ActualSha256 = got
+	failure.Error = "checksum mismatch"
+	return failure
+}
+
+// alert logs the failure, and sends it to the webhook and the command (if configured).
+func (c *integrityChecker) alert(ctx context.Context, failure *IntegrityFailure) {
+	klog.Errorf(
+		"Integrity check failed for %s of epoch %d (%q): %s (expected sha256 %s, got %q)",
+		failure.Artifact, failure.Epoch, failure.Path, failure.Error, failure.ExpectedSha256, failure.ActualSha256,
+	)
+	body, err := json.Marshal(failure)
+	if err != nil {
+		klog.Errorf("Failed to encode the integrity alert: %v", err)
+		return
+	}
+	if c.conf.WebhookURL != "" {
+		hook := &webhook{
+			url:        c.conf.WebhookURL,
+			httpClient: c.httpClient,
+			retries:    3,
+			retryDelay: time.Second,
+		}
+		if err := hook.deliver(ctx, body); err != nil {
+			klog.Errorf("Failed to send the integrity alert to the webhook: %v", err)
+		}
+	}
+	if c.conf.Exec != "" {
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", c.conf.Exec)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Env = append(os.Environ(),
+			"FAITHFUL_INTEGRITY_EPOCH="+strconv.FormatUint(failure.Epoch, 10),
+			"FAITHFUL_INTEGRITY_ARTIFACT="+failure.Artifact,
+			"FAITHFUL_INTEGRITY_PATH="+failure.Path,
+			"FAITHFUL_INTEGRITY_EXPECTED_SHA256="+failure.ExpectedSha256,
+			"FAITHFUL_INTEGRITY_ACTUAL_SHA256="+failure.ActualSha256,
+			"FAITHFUL_INTEGRITY_ERROR="+failure.Error,
+		)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			klog.Errorf("Integrity alert command failed: %v: %s", err, bytes.TrimSpace(output))
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrityChecker(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "epoch-1-slot-to-cid.index")
+	require.NoError(t, os.WriteFile(path, []byte("slot-to-cid"), 0o644))
+	sum, err := hashFileSha256(path)
+	require.NoError(t, err)
+
+	config := &Config{}
+	config.Indexes.SlotToCid.URI = URI(path)
+	config.Indexes.SlotToCid.Sha256 = sum
+	// without a checksum, a file is not checked.
+	config.Indexes.SigToCid.URI = URI(filepath.Join(dir, "missing.index"))
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(1, &Epoch{epoch: 1, config: config}))
+
+	var mu sync.Mutex
+	var received []IntegrityFailure
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var failure IntegrityFailure
+		require.NoError(t, json.Unmarshal(body, &failure))
+		mu.Lock()
+		received = append(received, failure)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	receivedAlerts := func() []IntegrityFailure {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]IntegrityFailure(nil), received...)
+	}
+
+	execOutput := filepath.Join(dir, "alert.txt")
+	checker := newIntegrityChecker(multi, IntegrityCheckConfig{
+		WebhookURL: server.URL,
+		Exec:       `echo "$FAITHFUL_INTEGRITY_EPOCH $FAITHFUL_INTEGRITY_ARTIFACT" > ` + execOutput,
+	})
+	ctx := context.Background()
+	require.Empty(t, checker.checkAll(ctx))
+
+	// bit-rot.
+	require.NoError(t, os.WriteFile(path, []byte("slot-to-cix"), 0o644))
+	failures := checker.checkAll(ctx)
+	require.Len(t, failures, 1)
+	require.Equal(t, "slot_to_cid", failures[0].Artifact)
+	require.Equal(t, sum, failures[0].ExpectedSha256)
+	require.NotEmpty(t, failures[0].ActualSha256)
+	require.Len(t, receivedAlerts(), 1)
+	require.Equal(t, path, receivedAlerts()[0].Path)
+	output, err := os.ReadFile(execOutput)
+	require.NoError(t, err)
+	require.Equal(t, "1 slot_to_cid\n", string(output))
+
+	// a failing file is alerted once, until it's valid again.
+	require.Empty(t, checker.checkAll(ctx))
+	require.Len(t, receivedAlerts(), 1)
+	require.NoError(t, os.WriteFile(path, []byte("slot-to-cid"), 0o644))
+	require.Empty(t, checker.checkAll(ctx))
+	require.NoError(t, os.Remove(path))
+	failures = checker.checkAll(ctx)
+	require.Len(t, failures, 1)
+	require.Contains(t, failures[0].Error, "no such file")
+	require.Len(t, receivedAlerts(), 2)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// maxDetachedEpochAge is how long a detached epoch is kept open for the requests
+// that were in flight when it was detached; it's closed after that even if they're not done.
+const maxDetachedEpochAge = 10 * time.Minute
+
+// epochLeases defers the closing of the epochs removed from (or replaced in) a MultiEpoch
+// until the requests that were in flight when they were removed are done: requests are
+// numbered in order, and an epoch detached after request N can only be used by requests up to N.
+type epochLeases struct {
+	mu       sync.Mutex
+	lastSeq  uint64
+	inFlight map[uint64]struct{}
+	detached []detachedEpoch
+	now      func() time.Time
+}
+
+type detachedEpoch struct {
+	epoch      *Epoch
+	seq        uint64 // the last request started before the epoch was detached.
+	detachedAt time.Time
+}
+
+func newEpochLeases() *epochLeases {
+	return &epochLeases{
+		inFlight: make(map[uint64]struct{}),
+		now:      time.Now,
+	}
+}
+
+// begin registers a request, and returns its number (to pass to end).
+func (l *epochLeases) begin() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastSeq++
+	l.inFlight[l.lastSeq] = struct{}{}
+	return l.lastSeq
+}
+
+// end marks the request as done, closing the detached epochs it was the last possible user of.
+func (l *epochLeases) end(seq uint64) {
+	l.mu.Lock()
+	delete(l.inFlight, seq)
+	drained := l.takeDrainedLocked()
+	l.mu.Unlock()
+	closeDetachedEpochs(drained)
+}
+
+// detach closes the epoch once the requests in flight are done.
+func (l *epochLeases) detach(ep *Epoch) {
+	l.mu.Lock()
+	l.detached = append(l.detached, detachedEpoch{
+		epoch:      ep,
+		seq:        l.lastSeq,
+		detachedAt: l.now(),
+	})
+	drained := l.takeDrainedLocked()
+	l.mu.Unlock()
+	closeDetachedEpochs(drained)
+}
+
+// closeAll closes all the detached epochs, regardless of the requests in flight.
+func (l *epochLeases) closeAll() {
+	l.mu.Lock()
+	detached := l.detached
+	l.detached = nil
+	l.mu.Unlock()
+	closeDetachedEpochs(detached)
+}
+
+// numDetached returns the number of detached epochs that are not closed yet.
+func (l *epochLeases) numDetached() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.detached)
+}
+
+func (l *epochLeases) takeDrainedLocked() []detachedEpoch {
+	if len(l.detached) == 0 {
+		return nil
+	}
+	oldestInFlight := uint64(0)
+	for seq := range l.inFlight {
+		if oldestInFlight == 0 || seq < oldestInFlight {
+			oldestInFlight = seq
+		}
+	}
+	now := l.now()
+	var drained []detachedEpoch
+	kept := l.detached[:0]
+	for _, d := range l.detached {
+		if oldestInFlight == 0 || oldestInFlight > d.seq {
+			drained = append(drained, d)
+			continue
+		}
+		if now.Sub(d.detachedAt) > maxDetachedEpochAge {
+			klog.Warningf("closing epoch %d, detached %s ago, while requests that may use it are still in flight", d.epoch.Epoch(), now.Sub(d.detachedAt))
+			drained = append(drained, d)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	for i := len(kept); i < len(l.detached); i++ {
+		l.detached[i] = detachedEpoch{}
+	}
+	l.detached = kept
+	return drained
+}
+
+func closeDetachedEpochs(detached []detachedEpoch) {
+	for _, d := range detached {
+		if err := d.epoch.Close(); err != nil {
+			klog.Errorf("error closing detached epoch %d: %v", d.epoch.Epoch(), err)
+		}
+	}
+}
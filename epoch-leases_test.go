@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochLeases(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	leases := newEpochLeases()
+	leases.now = func() time.Time { return now }
+
+	closer := &countingCloser{}
+	epoch := &Epoch{epoch: 100, onClose: []func() error{closer.Close}}
+
+	before := leases.begin()
+	leases.detach(epoch)
+	after := leases.begin()
+
+	// a request started after the epoch was detached can't be using it.
+	leases.end(after)
+	require.Equal(t, int32(0), closer.closed.Load())
+	require.Equal(t, 1, leases.numDetached())
+
+	leases.end(before)
+	require.Equal(t, int32(1), closer.closed.Load())
+	require.Equal(t, 0, leases.numDetached())
+
+	// with no request in flight, the epoch is closed right away.
+	other := &countingCloser{}
+	leases.detach(&Epoch{epoch: 101, onClose: []func() error{other.Close}})
+	require.Equal(t, int32(1), other.closed.Load())
+
+	// a stuck request doesn't keep the epoch open forever.
+	stuck := leases.begin()
+	third := &countingCloser{}
+	leases.detach(&Epoch{epoch: 102, onClose: []func() error{third.Close}})
+	require.Equal(t, int32(0), third.closed.Load())
+	now = now.Add(maxDetachedEpochAge + time.Second)
+	leases.end(leases.begin())
+	require.Equal(t, int32(1), third.closed.Load())
+	leases.end(stuck)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/dataframe"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+)
+
+// CollectBlockObjects returns the CID of the block for the given slot, and the raw
+// objects that make up the block DAG (block, entries, transactions, rewards, and all the
+// DataFrames that continue them).
+func (ser *Epoch) CollectBlockObjects(ctx context.Context, slot uint64) (cid.Cid, map[cid.Cid][]byte, error) {
+	blockCid, err := ser.FindCidFromSlot(ctx, slot)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to find CID for slot %d: %w", slot, err)
+	}
+	objects := make(map[cid.Cid][]byte)
+	get := func(c cid.Cid) ([]byte, error) {
+		if data, ok := objects[c]; ok {
+			return data, nil
+		}
+		data, err := ser.GetNodeByCid(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node by cid %s: %w", c, err)
+		}
+		objects[c] = data
+		return data, nil
+	}
+	getFrame := func(ctx context.Context, frameCid cid.Cid) (*ipldbindcode.DataFrame, error) {
+		data, err := get(frameCid)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := iplddecoders.DecodeDataFrame(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode DataFrame with CID %s: %w", frameCid, err)
+		}
+		return decoded, nil
+	}
+	collectFrames := func(frame ipldbindcode.DataFrame) error {
+		// the frames are collected by the getter.
+		return dataframe.Walk(ctx, &frame, getFrame, func(cid.Cid, *ipldbindcode.DataFrame) error { return nil })
+	}
+
+	blockData, err := get(blockCid)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	block, err := iplddecoders.DecodeBlock(blockData)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("failed to decode block with CID %s: %w", blockCid, err)
+	}
+	for _, entryLink := range block.Entries {
+		entryCid := entryLink.(cidlink.Link).Cid
+		entryData, err := get(entryCid)
+		if err != nil {
+			return cid.Undef, nil, err
+		}
+		entry, err := iplddecoders.DecodeEntry(entryData)
+		if err != nil {
+			return cid.Undef, nil, fmt.Errorf("failed to decode Entry with CID %s: %w", entryCid, err)
+		}
+		for _, txLink := range entry.Transactions {
+			txCid := txLink.(cidlink.Link).Cid
+			txData, err := get(txCid)
+			if err != nil {
+				return cid.Undef, nil, err
+			}
+			tx, err := iplddecoders.DecodeTransaction(txData)
+			if err != nil {
+				return cid.Undef, nil, fmt.Errorf("failed to decode Transaction with CID %s: %w", txCid, err)
+			}
+			if err := collectFrames(tx.Data); err != nil {
+				return cid.Undef, nil, err
+			}
+			if err := collectFrames(tx.Metadata); err != nil {
+				return cid.Undef, nil, err
+			}
+		}
+	}
+	if block.Rewards != nil {
+		rewardsCid := block.Rewards.(cidlink.Link).Cid
+		if !rewardsCid.Equals(DummyCID) {
+			rewardsData, err := get(rewardsCid)
+			if err != nil {
+				return cid.Undef, nil, err
+			}
+			rewards, err := iplddecoders.DecodeRewards(rewardsData)
+			if err != nil {
+				return cid.Undef, nil, fmt.Errorf("failed to decode Rewards with CID %s: %w", rewardsCid, err)
+			}
+			if err := collectFrames(rewards.Data); err != nil {
+				return cid.Undef, nil, err
+			}
+		}
+	}
+	return blockCid, objects, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// preheatChunkSize is the size of the sequential reads done when preheating.
+const preheatChunkSize = 4 * 1024 * 1024
+
+type PreheatResult struct {
+	Epoch       uint64        `json:"epoch"`
+	FirstSlot   uint64        `json:"firstSlot"`
+	LastSlot    uint64        `json:"lastSlot"`
+	StartOffset uint64        `json:"startOffset"`
+	EndOffset   uint64        `json:"endOffset"`
+	BytesRead   uint64        `json:"bytesRead"`
+	Took        time.Duration `json:"took"`
+}
+
+// Preheat sequentially reads the CAR byte range that contains the blocks
+// (and their whole DAGs) for the given slot range, to warm the OS page cache.
+// The slot range is clamped to the limits of this epoch.
+func (ser *Epoch) Preheat(ctx context.Context, firstSlot, lastSlot uint64) (*PreheatResult, error) {
+	if ser.IsFilecoinMode() {
+		return nil, fmt.Errorf("epoch %d is in filecoin mode; there is no CAR file to preheat", ser.Epoch())
+	}
+	startedAt := time.Now()
+	carRange, err := ser.carRangeForSlots(ctx, firstSlot, lastSlot)
+	if err != nil {
+		return nil, err
+	}
+	startOffset, endOffset := carRange.StartOffset, carRange.EndOffset
+	klog.V(2).Infof("Preheating epoch %d, slots %d-%d: reading CAR bytes %d-%d (%d bytes)", ser.Epoch(), carRange.FirstSlot, carRange.LastSlot, startOffset, endOffset, endOffset-startOffset)
+
+	var bytesRead uint64
+	for offset := startOffset; offset < endOffset; offset += preheatChunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		length := uint64(preheatChunkSize)
+		if offset+length > endOffset {
+			length = endOffset - offset
+		}
+		data, err := ser.ReadAtFromCar(ctx, offset, length)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CAR at offset %d: %w", offset, err)
+		}
+		bytesRead += uint64(len(data))
+	}
+	return &PreheatResult{
+		Epoch:       ser.Epoch(),
+		FirstSlot:   carRange.FirstSlot,
+		LastSlot:    carRange.LastSlot,
+		StartOffset: startOffset,
+		EndOffset:   endOffset,
+		BytesRead:   bytesRead,
+		Took:        time.Since(startedAt),
+	}, nil
+}
+
+// Preheat preheats the given slot range on all the available epochs that overlap with it.
+func (m *MultiEpoch) Preheat(ctx context.Context, firstSlot, lastSlot uint64) ([]*PreheatResult, error) {
+	if firstSlot > lastSlot {
+		return nil, fmt.Errorf("invalid slot range: %d > %d", firstSlot, lastSlot)
+	}
+	results := make([]*PreheatResult, 0)
+	for epochNumber := CalcEpochForSlot(firstSlot); epochNumber <= CalcEpochForSlot(lastSlot); epochNumber++ {
+		epochHandler, err := m.GetEpoch(epochNumber)
+		if err != nil {
+			klog.V(2).Infof("Preheat: epoch %d is not available; skipping", epochNumber)
+			continue
+		}
+		result, err := epochHandler.Preheat(ctx, firstSlot, lastSlot)
+		if err != nil {
+			return results, fmt.Errorf("failed to preheat epoch %d: %w", epochNumber, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
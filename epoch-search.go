@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/klog/v2"
+)
+
+// EpochSearchOrder is how the epochs are searched for a signature (in multi-epoch mode).
+type EpochSearchOrder string
+
+const (
+	// EpochSearchBloom first checks the sig-exists filters of all the epochs (in parallel), then
+	// looks up the signature in the sig-to-cid indexes of the candidate epochs only, newest first.
+	EpochSearchBloom EpochSearchOrder = "bloom"
+	// EpochSearchNewestFirst looks up the signature in the sig-to-cid indexes, newest epoch first.
+	EpochSearchNewestFirst EpochSearchOrder = "newest-first"
+	// EpochSearchOldestFirst looks up the signature in the sig-to-cid indexes, oldest epoch first.
+	EpochSearchOldestFirst EpochSearchOrder = "oldest-first"
+)
+
+func ParseEpochSearchOrder(s string) (EpochSearchOrder, error) {
+	switch order := EpochSearchOrder(s); order {
+	case EpochSearchBloom, EpochSearchNewestFirst, EpochSearchOldestFirst:
+		return order, nil
+	case "":
+		return EpochSearchBloom, nil
+	default:
+		return "", fmt.Errorf("unknown epoch search order %q (supported: bloom, newest-first, oldest-first)", s)
+	}
+}
+
+// epochSearchHint restricts the epochs searched for a signature to the ones that contain the
+// given slot range; the epochs closest to the hint are searched first.
+type epochSearchHint struct {
+	MinSlot *uint64
+	MaxSlot *uint64
+}
+
+// orderEpochsForSearch returns the epochs to search, in the order in which to search them.
+func orderEpochsForSearch(numbers []uint64, order EpochSearchOrder, hint *epochSearchHint) []uint64 {
+	out := make([]uint64, 0, len(numbers))
+	for _, epochNumber := range numbers {
+		if hint != nil && hint.MinSlot != nil && epochNumber < CalcEpochForSlot(*hint.MinSlot) {
+			continue
+		}
+		if hint != nil && hint.MaxSlot != nil && epochNumber > CalcEpochForSlot(*hint.MaxSlot) {
+			continue
+		}
+		out = append(out, epochNumber)
+	}
+	oldestFirst := order == EpochSearchOldestFirst
+	if hint != nil && (hint.MinSlot != nil) != (hint.MaxSlot != nil) {
+		// only one bound: start from the bound.
+		oldestFirst = hint.MinSlot != nil
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if oldestFirst {
+			return out[i] < out[j]
+		}
+		return out[i] > out[j]
+	})
+	return out
+}
+
+// filterEpochsWithSigExists returns the epochs (in the same order) whose sig-exists filter might contain the signature,
+// and the ones that don't have such a filter.
+func (multi *MultiEpoch) filterEpochsWithSigExists(ctx context.Context, numbers []uint64, sig solana.Signature) ([]uint64, error) {
+	buckets := multi.getAllBucketteers()
+	maybe := make([]bool, len(numbers))
+	wg, ctx := errgroup.WithContext(ctx)
+	if multi.options.EpochSearchConcurrency > 0 {
+		wg.SetLimit(multi.options.EpochSearchConcurrency)
+	}
+	for i, epochNumber := range numbers {
+		bucket, ok := buckets[epochNumber]
+		if !ok {
+			// can't exclude this epoch.
+			maybe[i] = true
+			continue
+		}
+		i, epochNumber, bucket := i, epochNumber, bucket
+		wg.Go(func() error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			has, err := bucket.Has(sig)
+			if err != nil {
+				return fmt.Errorf("failed to check if signature exists in epoch %d: %w", epochNumber, err)
+			}
+			maybe[i] = has
+			return nil
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	candidates := make([]uint64, 0)
+	for i, epochNumber := range numbers {
+		if maybe[i] {
+			candidates = append(candidates, epochNumber)
+		}
+	}
+	return candidates, nil
+}
+
+// filterEpochsForSignature returns the epochs (in the same order) in which to look up the
+// signature: with the bloom search order, the ones whose sig-exists filter might contain it.
+func (multi *MultiEpoch) filterEpochsForSignature(ctx context.Context, numbers []uint64, sig solana.Signature) ([]uint64, error) {
+	candidates := numbers
+	if multi.options.EpochSearchOrder == EpochSearchBloom || multi.options.EpochSearchOrder == "" {
+		startedSearchingCandidatesAt := time.Now()
+		var err error
+		candidates, err = multi.filterEpochsWithSigExists(ctx, numbers, sig)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(4).Infof(
+			"Searched %d epochs in %s, and found %d candidate epochs for signature %s: %v",
+			len(numbers),
+			time.Since(startedSearchingCandidatesAt),
+			len(candidates),
+			sig,
+			candidates,
+		)
+	}
+	metrics_epochSearchCandidates.Observe(float64(len(candidates)))
+	return candidates, nil
+}
+
+// findEpochNumberFromSignature returns the epoch that contains the transaction with the given signature,
+// or ErrNotFound; the hint (if not nil) restricts the search.
+func (multi *MultiEpoch) findEpochNumberFromSignature(ctx context.Context, sig solana.Signature, hint *epochSearchHint) (uint64, error) {
+	numbers := orderEpochsForSearch(multi.GetEpochNumbers(), multi.options.EpochSearchOrder, hint)
+	if len(numbers) == 0 {
+		return 0, ErrNotFound
+	}
+	if len(numbers) == 1 && hint == nil {
+		return numbers[0], nil
+	}
+
+	candidates, err := multi.filterEpochsForSignature(ctx, numbers, sig)
+	if err != nil {
+		return 0, err
+	}
+	if len(candidates) == 0 {
+		return 0, ErrNotFound
+	}
+
+	// Look up the signature in the candidate epochs, in parallel (the first ones are started first):
+	wg := NewFirstResponse(ctx, multi.options.EpochSearchConcurrency)
+	for _, epochNumber := range candidates {
+		epochNumber := epochNumber
+		spawned := wg.Spawn(func() (any, error) {
+			epoch, err := multi.GetEpoch(epochNumber)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
+			}
+			// the lookup alone can match the hash, or the fingerprint, of another signature
+			// (1 in 65,536 with the mph format): check the transaction, or a wrong epoch could
+			// be the first response.
+			if _, err := epoch.FindTransactionCidFromSignature(ctx, sig); err == nil {
+				return epochNumber, nil
+			}
+			// Not found in this epoch.
+			return nil, nil
+		})
+		if !spawned {
+			// already found.
+			break
+		}
+	}
+	switch result := wg.Wait().(type) {
+	case nil:
+		// All epochs were searched, but the signature was not found.
+		return 0, ErrNotFound
+	case error:
+		// An error occurred while searching one of the epochs.
+		return 0, result
+	case uint64:
+		// The signature was found in one of the epochs.
+		return result, nil
+	default:
+		return 0, fmt.Errorf("unexpected result: (%T) %v", result, result)
+	}
+}
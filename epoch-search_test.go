@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/multiformats/go-multihash"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEpochSearchOrder(t *testing.T) {
+	order, err := ParseEpochSearchOrder("")
+	require.NoError(t, err)
+	require.Equal(t, EpochSearchBloom, order)
+
+	order, err = ParseEpochSearchOrder("oldest-first")
+	require.NoError(t, err)
+	require.Equal(t, EpochSearchOldestFirst, order)
+
+	_, err = ParseEpochSearchOrder("random")
+	require.Error(t, err)
+}
+
+func TestOrderEpochsForSearch(t *testing.T) {
+	numbers := []uint64{3, 0, 5, 1, 4, 2}
+	slot := func(epoch uint64) *uint64 {
+		s := epoch*EpochLen + 10
+		return &s
+	}
+
+	require.Equal(t, []uint64{5, 4, 3, 2, 1, 0}, orderEpochsForSearch(numbers, EpochSearchBloom, nil))
+	require.Equal(t, []uint64{5, 4, 3, 2, 1, 0}, orderEpochsForSearch(numbers, EpochSearchNewestFirst, nil))
+	require.Equal(t, []uint64{0, 1, 2, 3, 4, 5}, orderEpochsForSearch(numbers, EpochSearchOldestFirst, nil))
+
+	// both bounds: only the epochs in the range.
+	require.Equal(t, []uint64{4, 3, 2}, orderEpochsForSearch(numbers, EpochSearchNewestFirst, &epochSearchHint{MinSlot: slot(2), MaxSlot: slot(4)}))
+	require.Equal(t, []uint64{2, 3, 4}, orderEpochsForSearch(numbers, EpochSearchOldestFirst, &epochSearchHint{MinSlot: slot(2), MaxSlot: slot(4)}))
+	// one bound: starting from the bound.
+	require.Equal(t, []uint64{3, 4, 5}, orderEpochsForSearch(numbers, EpochSearchNewestFirst, &epochSearchHint{MinSlot: slot(3)}))
+	require.Equal(t, []uint64{1, 0}, orderEpochsForSearch(numbers, EpochSearchOldestFirst, &epochSearchHint{MaxSlot: slot(1)}))
+	// no epoch in the range.
+	require.Empty(t, orderEpochsForSearch(numbers, EpochSearchBloom, &epochSearchHint{MinSlot: slot(7)}))
+}
+
+func TestGetTransactionOptionsSearchHint(t *testing.T) {
+	opts, err := parseGetTransactionOptions(map[string]any{"encoding": "json"})
+	require.NoError(t, err)
+	require.Nil(t, opts.searchHint())
+
+	opts, err = parseGetTransactionOptions(map[string]any{"minSlot": float64(100), "maxSlot": float64(200)})
+	require.NoError(t, err)
+	require.NoError(t, opts.Validate())
+	hint := opts.searchHint()
+	require.NotNil(t, hint)
+	require.Equal(t, uint64(100), *hint.MinSlot)
+	require.Equal(t, uint64(200), *hint.MaxSlot)
+
+	opts, err = parseGetTransactionOptions(map[string]any{"minSlot": float64(200), "maxSlot": float64(100)})
+	require.NoError(t, err)
+	require.Error(t, opts.Validate())
+
+	_, err = parseGetTransactionOptions(map[string]any{"minSlot": "100"})
+	require.Error(t, err)
+	_, err = parseGetTransactionOptions(map[string]any{"maxSlot": float64(-1)})
+	require.Error(t, err)
+}
+
+func TestFindEpochNumberFromSignatureChecksTheTransaction(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	rootCid := cid.MustParse("bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+
+	// putTransaction puts a transaction with the signature in the cache, and returns its CID.
+	putTransaction := func(sig solana.Signature) cid.Cid {
+		data, err := ipld.Marshal(dagcbor.Encode, &ipldbindcode.Transaction{
+			Kind:     int(iplddecoders.KindTransaction),
+			Data:     ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: append([]byte{1}, sig[:]...)},
+			Metadata: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame)},
+		}, ipldbindcode.Prototypes.Transaction.Type())
+		require.NoError(t, err)
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+		require.NoError(t, err)
+		require.NoError(t, cache.PutRawCarObject(c, data))
+		return c
+	}
+	// openSigToCid returns an mph sig-to-cid index of the epoch with the transaction of the signature.
+	openSigToCid := func(epoch uint64, sig solana.Signature) *indexes.SigToCid_Reader {
+		dir := t.TempDir()
+		writer, err := indexes.NewWriterWithFormat_SigToCid(epoch, rootCid, indexes.NetworkMainnet, dir, 1, indexes.FormatMPH)
+		require.NoError(t, err)
+		require.NoError(t, writer.Put(sig, putTransaction(sig)))
+		require.NoError(t, writer.Seal(ctx, dir))
+		index, err := indexes.Open_SigToCid(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+		require.NoError(t, err)
+		t.Cleanup(func() { index.Close() })
+		return index
+	}
+
+	sigInNewer := solana.Signature{1}
+	newer := openSigToCid(1, sigInNewer)
+	// a signature of the older epoch, with the fingerprint of the one of the newer epoch: the
+	// lookup in the newer epoch finds it.
+	random := rand.New(rand.NewSource(1))
+	var sigInOlder solana.Signature
+	for i := 0; ; i++ {
+		require.Less(t, i, 1<<24, "no colliding fingerprint")
+		random.Read(sigInOlder[:])
+		if _, err := newer.Get(sigInOlder); err == nil && sigInOlder != sigInNewer {
+			break
+		}
+	}
+	older := openSigToCid(0, sigInOlder)
+
+	multi := NewMultiEpoch(&Options{EpochSearchOrder: EpochSearchNewestFirst, EpochSearchConcurrency: 1})
+	require.NoError(t, multi.AddEpoch(0, &Epoch{epoch: 0, config: &Config{}, sigToCidIndex: older, allCache: cache}))
+	require.NoError(t, multi.AddEpoch(1, &Epoch{epoch: 1, config: &Config{}, sigToCidIndex: newer, allCache: cache}))
+
+	// the newer epoch is searched first, but its transaction doesn't have the signature.
+	epochNumber, err := multi.findEpochNumberFromSignature(ctx, sigInOlder, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), epochNumber)
+	epochNumber, err = multi.findEpochNumberFromSignature(ctx, sigInNewer, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), epochNumber)
+}
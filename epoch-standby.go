@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"k8s.io/klog/v2"
+)
+
+// StandbyFailoverConfig is when the standby of an epoch (see Config.Standby) is promoted to serve
+// the epoch, and for how long.
+type StandbyFailoverConfig struct {
+	// LatencySLO is the longest a read from the storage of the epoch (a CAR read, or an index
+	// lookup) may take; a slower read counts as a failed one.
+	LatencySLO time.Duration
+	// FailoverAfter is the number of consecutive failed reads after which the standby is promoted.
+	FailoverAfter int
+	// FailbackAfter is how long the standby serves the epoch before the epoch is given another
+	// chance (it's promoted again after FailoverAfter failed reads).
+	FailbackAfter time.Duration
+}
+
+// DefaultStandbyFailoverConfig is the failover of the standbys, unless configured otherwise.
+var DefaultStandbyFailoverConfig = StandbyFailoverConfig{
+	LatencySLO:    2 * time.Second,
+	FailoverAfter: 5,
+	FailbackAfter: 5 * time.Minute,
+}
+
+var standbyFailoverConfig = DefaultStandbyFailoverConfig
+
+// setStandbyFailoverConfig sets the failover of the standbys; must be called before loading the epochs.
+func setStandbyFailoverConfig(conf StandbyFailoverConfig) {
+	standbyFailoverConfig = conf
+}
+
+// epochFailover tracks the health of the reads of an epoch that has a standby, and promotes the
+// standby when the reads keep failing or being slower than the SLO.
+type epochFailover struct {
+	epoch uint64
+	conf  StandbyFailoverConfig
+	now   func() time.Time
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	promotedAt          time.Time // zero when the epoch serves itself.
+}
+
+func newEpochFailover(epoch uint64, conf StandbyFailoverConfig) *epochFailover {
+	return &epochFailover{
+		epoch: epoch,
+		conf:  conf,
+		now:   time.Now,
+	}
+}
+
+// isStorageFailure returns true if the error of a read is a failure of the storage; a key that is
+// not in an index, an index that is not ready or a request that is past its deadline are not.
+func isStorageFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var notReady *IndexNotReadyError
+	return !errors.Is(err, compactindexsized.ErrNotFound) &&
+		!errors.As(err, &notReady) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// observe records a read from the storage of the epoch; the reads made while the standby is
+// promoted (by the requests that were already using the epoch) are ignored.
+func (f *epochFailover) observe(latency time.Duration, err error) {
+	failed := isStorageFailure(err) || (f.conf.LatencySLO > 0 && latency > f.conf.LatencySLO)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.promotedAt.IsZero() {
+		return
+	}
+	if !failed {
+		f.consecutiveFailures = 0
+		return
+	}
+	f.consecutiveFailures++
+	if f.consecutiveFailures < f.conf.FailoverAfter {
+		return
+	}
+	f.promotedAt = f.now()
+	f.consecutiveFailures = 0
+	klog.Warningf(
+		"Epoch %d: %d consecutive reads failed or were slower than %s (last: %s, %v); promoting the standby for %s",
+		f.epoch,
+		f.conf.FailoverAfter,
+		f.conf.LatencySLO,
+		latency,
+		err,
+		f.conf.FailbackAfter,
+	)
+	metrics_epochStandbyFailovers.WithLabelValues(strconv.FormatUint(f.epoch, 10)).Inc()
+	metrics_epochStandbyServing.WithLabelValues(strconv.FormatUint(f.epoch, 10)).Set(1)
+}
+
+// usingStandby returns true if the standby serves the epoch, failing back to the epoch once the
+// standby has served it for FailbackAfter.
+func (f *epochFailover) usingStandby() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.promotedAt.IsZero() {
+		return false
+	}
+	if f.now().Sub(f.promotedAt) < f.conf.FailbackAfter {
+		return true
+	}
+	f.promotedAt = time.Time{}
+	klog.Infof("Epoch %d: the standby served it for %s; failing back to the epoch", f.epoch, f.conf.FailbackAfter)
+	metrics_epochStandbyServing.WithLabelValues(strconv.FormatUint(f.epoch, 10)).Set(0)
+	return false
+}
+
+// openStandby opens the standby of the epoch (if it has one), to be promoted when the reads of the
+// epoch fail; the standby must be a copy of the epoch.
+func (e *Epoch) openStandby(open func(config *Config) (*Epoch, error)) error {
+	if e.config.Standby == nil {
+		return nil
+	}
+	standby, err := open(e.config.Standby)
+	if err != nil {
+		return fmt.Errorf("failed to open the standby of epoch %d: %w", e.Epoch(), err)
+	}
+	if !standby.GetRootCid().Equals(e.GetRootCid()) {
+		standby.Close()
+		return fmt.Errorf("the standby of epoch %d is not a copy of it: root CID %s, expected %s", e.Epoch(), standby.GetRootCid(), e.GetRootCid())
+	}
+	e.standby = standby
+	e.failover = newEpochFailover(e.Epoch(), standbyFailoverConfig)
+	e.onClose = append(e.onClose, standby.Close)
+	metrics_epochStandbyServing.WithLabelValues(strconv.FormatUint(e.Epoch(), 10)).Set(0)
+	klog.Infof("Epoch %d has a standby", e.Epoch())
+	return nil
+}
+
+// serving returns the epoch that serves the requests for the epoch: itself, or its standby while
+// the standby is promoted.
+func (e *Epoch) serving() *Epoch {
+	if e.standby != nil && e.failover.usingStandby() {
+		return e.standby
+	}
+	return e
+}
+
+// observeRead records a read from the storage of the epoch, for the failover to its standby.
+func (e *Epoch) observeRead(startedAt time.Time, err error) {
+	if e.failover != nil {
+		e.failover.observe(time.Since(startedAt), err)
+	}
+}
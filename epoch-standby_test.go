@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochFailover(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	failover := newEpochFailover(7, StandbyFailoverConfig{
+		LatencySLO:    time.Second,
+		FailoverAfter: 3,
+		FailbackAfter: time.Minute,
+	})
+	failover.now = func() time.Time { return now }
+	storageErr := errors.New("connection reset by peer")
+
+	// a successful read resets the count.
+	failover.observe(time.Millisecond, storageErr)
+	failover.observe(time.Millisecond, storageErr)
+	failover.observe(time.Millisecond, nil)
+	failover.observe(time.Millisecond, storageErr)
+	require.False(t, failover.usingStandby())
+
+	// the keys that are not found, and the requests past their deadline, are not failures.
+	failover.observe(time.Millisecond, fmt.Errorf("lookup: %w", compactindexsized.ErrNotFound))
+	failover.observe(time.Millisecond, &IndexNotReadyError{Epoch: 7, Index: "slot_to_cid"})
+	require.False(t, failover.usingStandby())
+
+	// the slow reads are.
+	failover.observe(time.Millisecond, storageErr)
+	failover.observe(2*time.Second, nil)
+	failover.observe(2*time.Second, fmt.Errorf("lookup: %w", compactindexsized.ErrNotFound))
+	require.True(t, failover.usingStandby())
+
+	// the reads of the requests still using the epoch don't count.
+	failover.observe(time.Millisecond, storageErr)
+	now = now.Add(time.Minute)
+	require.False(t, failover.usingStandby())
+	failover.observe(time.Millisecond, storageErr)
+	require.False(t, failover.usingStandby())
+}
+
+func TestEpochServing(t *testing.T) {
+	standby := &Epoch{epoch: 7}
+	epoch := &Epoch{epoch: 7, standby: standby, failover: newEpochFailover(7, StandbyFailoverConfig{FailoverAfter: 1, FailbackAfter: time.Minute})}
+	require.Same(t, epoch, epoch.serving())
+	epoch.observeRead(time.Now(), errors.New("i/o timeout"))
+	require.Same(t, standby, epoch.serving())
+
+	// without a standby, the epoch serves itself.
+	alone := &Epoch{epoch: 8}
+	alone.observeRead(time.Now(), errors.New("i/o timeout"))
+	require.Same(t, alone, alone.serving())
+}
+
+func TestLoadConfigStandby(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "epoch-7.yaml")
+	config := `epoch: 7
+version: 1
+leader_schedule:
+  uri: /data/epoch-7-leaders.json
+data:
+  car:
+    uri: /data/epoch-7.car
+indexes:
+  cid_to_offset_and_size:
+    uri: /data/epoch-7-cid-to-offset-and-size.index
+  slot_to_cid:
+    uri: /data/epoch-7-slot-to-cid.index
+  sig_to_cid:
+    uri: /data/epoch-7-sig-to-cid.index
+  sig_exists:
+    uri: /data/epoch-7-sig-exists.index
+standby:
+  data:
+    car:
+      uri: https://mirror.example/epoch-7.car
+  indexes:
+    cid_to_offset_and_size:
+      uri: https://mirror.example/epoch-7-cid-to-offset-and-size.index
+    slot_to_cid:
+      uri: https://mirror.example/epoch-7-slot-to-cid.index
+    sig_to_cid:
+      uri: https://mirror.example/epoch-7-sig-to-cid.index
+    sig_exists:
+      uri: https://mirror.example/epoch-7-sig-exists.index
+`
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+	loaded, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.NoError(t, loaded.Validate())
+	standby := loaded.Standby
+	require.NotNil(t, standby)
+	require.Equal(t, uint64(7), *standby.Epoch)
+	require.Equal(t, URI("https://mirror.example/epoch-7.car"), standby.Data.Car.URI)
+	require.Equal(t, loaded.LeaderSchedule.URI, standby.LeaderSchedule.URI)
+	require.Equal(t, path, standby.ConfigFilepath())
+	require.Len(t, ConfigSlice{loaded}.withStandbys(), 2)
+
+	// the standby must be of the same epoch, and complete.
+	require.NoError(t, os.WriteFile(path, []byte(config+"  epoch: 8\n"), 0o644))
+	loaded, err = LoadConfig(path)
+	require.NoError(t, err)
+	require.ErrorContains(t, loaded.Validate(), "standby.epoch")
+
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(config, "https://mirror.example/epoch-7-sig-exists.index", "''", 1)), 0o644))
+	loaded, err = LoadConfig(path)
+	require.NoError(t, err)
+	require.ErrorContains(t, loaded.Validate(), "standby: indexes.sig_exists.uri must be set")
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/multiformats/go-multiaddr"
@@ -23,6 +24,7 @@ import (
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/rpcpool/yellowstone-faithful/bucketteer"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
 	deprecatedbucketter "github.com/rpcpool/yellowstone-faithful/deprecated/bucketteer"
 	"github.com/rpcpool/yellowstone-faithful/gsfa"
 	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
@@ -42,10 +44,15 @@ type Epoch struct {
 	config         *Config
 	// genesis:
 	genesis *GenesisContainer
+	// the sidecars (optional):
+	leaderSchedule  *LeaderSchedule
+	stakeWeights    map[solana.PublicKey]uint64
+	accountSnapshot *AccountSnapshot
 	// contains indexes and block data for the epoch
 	lassieFetcher               *lassieWrapper
 	localCarReader              *carv2.Reader
 	remoteCarReader             ReaderAtCloser
+	alternates                  []alternateNodeSource // where the nodes that don't match their CID are read again from.
 	carHeaderSize               uint64
 	rootCid                     cid.Cid
 	cidToOffsetAndSizeIndex     *indexes.CidToOffsetAndSize_Reader
@@ -53,9 +60,20 @@ type Epoch struct {
 	slotToCidIndex              *indexes.SlotToCid_Reader
 	sigToCidIndex               *indexes.SigToCid_Reader
 	sigExists                   SigExistsIndex
+	slotToBlockhashIndex        *indexes.SlotToBlockhash_Reader
 	gsfaReader                  *gsfa.GsfaReader
 	onClose                     []func() error
 	allCache                    *hugecache.Cache
+	// the standby (optional), and when it serves the epoch (see epoch-standby.go):
+	standby  *Epoch
+	failover *epochFailover
+
+	// indexMu guards the index files, and the indexes that can be swapped in after loading.
+	indexMu         sync.RWMutex
+	indexMounts     map[string]*indexMount
+	indexMountRefs  map[string]*resourceRef // the references to the shared index files.
+	indexesClosed   bool
+	pendingRebuilds []indexRebuild
 }
 
 func (r *Epoch) GetCache() *hugecache.Cache {
@@ -66,6 +84,32 @@ func (e *Epoch) Epoch() uint64 {
 	return e.epoch
 }
 
+// IndexStats returns the lookup counters of the indexes of the epoch, by index kind.
+func (e *Epoch) IndexStats() map[string]indexes.IndexStats {
+	out := make(map[string]indexes.IndexStats)
+	e.indexMu.RLock()
+	defer e.indexMu.RUnlock()
+	if e.cidToOffsetAndSizeIndex != nil {
+		out["cid_to_offset_and_size"] = e.cidToOffsetAndSizeIndex.Stats()
+	}
+	if e.deprecated_cidToOffsetIndex != nil {
+		out["cid_to_offset"] = e.deprecated_cidToOffsetIndex.Stats()
+	}
+	if e.slotToCidIndex != nil {
+		out["slot_to_cid"] = e.slotToCidIndex.Stats()
+	}
+	if e.sigToCidIndex != nil {
+		out["sig_to_cid"] = e.sigToCidIndex.Stats()
+	}
+	if e.slotToBlockhashIndex != nil {
+		out["slot_to_blockhash"] = e.slotToBlockhashIndex.Stats()
+	}
+	if e.accountSnapshot != nil {
+		out["account_snapshot"] = e.accountSnapshot.index.Stats()
+	}
+	return out
+}
+
 func (e *Epoch) IsFilecoinMode() bool {
 	return e.isFilecoinMode
 }
@@ -83,6 +127,9 @@ func (e *Epoch) Close() error {
 			multiErr = append(multiErr, err)
 		}
 	}
+	if err := e.closeIndexMounts(); err != nil {
+		multiErr = append(multiErr, err)
+	}
 	return errors.Join(multiErr...)
 }
 
@@ -123,17 +170,16 @@ func NewEpochFromConfig(
 			}
 		}
 	}
+	if err := ep.loadLeaderSidecars(config); err != nil {
+		return nil, err
+	}
 	if isCarMode {
 		if config.IsDeprecatedIndexes() {
 			// The CAR-mode requires a cid-to-offset index.
-			cidToOffsetIndexFile, err := openIndexStorage(
-				c.Context,
-				string(config.Indexes.CidToOffset.URI),
-			)
+			cidToOffsetIndexFile, err := ep.mountIndex(c.Context, "cid_to_offset", config.Indexes.CidToOffset.URI)
 			if err != nil {
 				return nil, fmt.Errorf("failed to open cid-to-offset index file: %w", err)
 			}
-			ep.onClose = append(ep.onClose, cidToOffsetIndexFile.Close)
 
 			cidToOffsetIndex, err := indexes.Deprecated_OpenWithReader_CidToOffset(cidToOffsetIndexFile)
 			if err != nil {
@@ -145,14 +191,10 @@ func NewEpochFromConfig(
 			ep.deprecated_cidToOffsetIndex = cidToOffsetIndex
 		} else {
 			// The CAR-mode requires a cid-to-offset index.
-			cidToOffsetAndSizeIndexFile, err := openIndexStorage(
-				c.Context,
-				string(config.Indexes.CidToOffsetAndSize.URI),
-			)
+			cidToOffsetAndSizeIndexFile, err := ep.mountIndex(c.Context, "cid_to_offset_and_size", config.Indexes.CidToOffsetAndSize.URI)
 			if err != nil {
 				return nil, fmt.Errorf("failed to open cid-to-offset index file: %w", err)
 			}
-			ep.onClose = append(ep.onClose, cidToOffsetAndSizeIndexFile.Close)
 
 			cidToOffsetAndSizeIndex, err := indexes.OpenWithReader_CidToOffsetAndSize(cidToOffsetAndSizeIndexFile)
 			if err != nil {
@@ -171,62 +213,53 @@ func NewEpochFromConfig(
 	}
 
 	{
-		slotToCidIndexFile, err := openIndexStorage(
-			c.Context,
-			string(config.Indexes.SlotToCid.URI),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open slot-to-cid index file: %w", err)
-		}
-		ep.onClose = append(ep.onClose, slotToCidIndexFile.Close)
-
-		slotToCidIndex, err := indexes.OpenWithReader_SlotToCid(slotToCidIndexFile)
+		slotToCidIndex, err := ep.openSlotToCidIndex(c.Context, lastRootCid)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open slot-to-cid index: %w", err)
-		}
-		if config.Indexes.SlotToCid.URI.IsRemoteWeb() {
-			slotToCidIndex.Prefetch(true)
-		}
-		ep.slotToCidIndex = slotToCidIndex
-
-		if !slotToCidIndex.IsDeprecatedOldVersion() {
-			if ep.Epoch() != slotToCidIndex.Meta().Epoch {
-				return nil, fmt.Errorf("epoch mismatch in slot-to-cid index: expected %d, got %d", ep.Epoch(), slotToCidIndex.Meta().Epoch)
+			if !ep.canRebuildIndex(config.Indexes.SlotToCid.URI) {
+				return nil, err
 			}
-			if lastRootCid != cid.Undef && !lastRootCid.Equals(slotToCidIndex.Meta().RootCid) {
-				return nil, fmt.Errorf("root CID mismatch in slot-to-cid index: expected %s, got %s", lastRootCid, slotToCidIndex.Meta().RootCid)
+			ep.scheduleIndexRebuild(indexRebuild{
+				name:    "slot_to_cid",
+				uri:     config.Indexes.SlotToCid.URI,
+				reason:  err,
+				create:  CreateIndex_slot2cid,
+				install: ep.installSlotToCidIndex,
+			})
+		} else {
+			ep.slotToCidIndex = slotToCidIndex
+			if !slotToCidIndex.IsDeprecatedOldVersion() {
+				lastRootCid = slotToCidIndex.Meta().RootCid
 			}
-			lastRootCid = slotToCidIndex.Meta().RootCid
 		}
 	}
 
 	{
-		sigToCidIndexFile, err := openIndexStorage(
-			c.Context,
-			string(config.Indexes.SigToCid.URI),
-		)
+		sigToCidIndex, err := ep.openSigToCidIndex(c.Context, lastRootCid)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open sig-to-cid index file: %w", err)
+			if !ep.canRebuildIndex(config.Indexes.SigToCid.URI) {
+				return nil, err
+			}
+			ep.scheduleIndexRebuild(indexRebuild{
+				name:    "sig_to_cid",
+				uri:     config.Indexes.SigToCid.URI,
+				reason:  err,
+				create:  CreateIndex_sig2cid,
+				install: ep.installSigToCidIndex,
+			})
+		} else {
+			ep.sigToCidIndex = sigToCidIndex
 		}
-		ep.onClose = append(ep.onClose, sigToCidIndexFile.Close)
+	}
 
-		sigToCidIndex, err := indexes.OpenWithReader_SigToCid(sigToCidIndexFile)
+	if !config.Indexes.SlotToBlockhash.URI.IsZero() {
+		slotToBlockhashIndex, err := ep.openSlotToBlockhashIndex(c.Context, lastRootCid)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open sig-to-cid index: %w", err)
-		}
-		if config.Indexes.SigToCid.URI.IsRemoteWeb() {
-			sigToCidIndex.Prefetch(true)
-		}
-		ep.sigToCidIndex = sigToCidIndex
-
-		if !sigToCidIndex.IsDeprecatedOldVersion() {
-			if ep.Epoch() != sigToCidIndex.Meta().Epoch {
-				return nil, fmt.Errorf("epoch mismatch in sig-to-cid index: expected %d, got %d", ep.Epoch(), sigToCidIndex.Meta().Epoch)
-			}
-			if !lastRootCid.Equals(sigToCidIndex.Meta().RootCid) {
-				return nil, fmt.Errorf("root CID mismatch in sig-to-cid index: expected %s, got %s", lastRootCid, sigToCidIndex.Meta().RootCid)
-			}
+			return nil, err
 		}
+		ep.slotToBlockhashIndex = slotToBlockhashIndex
+	}
+	if err := ep.openAccountSnapshot(c.Context, config); err != nil {
+		return nil, err
 	}
 
 	{
@@ -254,6 +287,9 @@ func NewEpochFromConfig(
 				if !lastRootCid.Equals(gotRootCid) {
 					return nil, fmt.Errorf("root CID mismatch in gsfa index: expected %s, got %s", lastRootCid, gotRootCid)
 				}
+				if filter, ok := gsfaIndex.Meta().GetString(indexmeta.MetadataKey_GsfaFilter); ok {
+					klog.Infof("Epoch %d: the gsfa index has only some of the accounts (%s)", ep.Epoch(), filter)
+				}
 			}
 		}
 	}
@@ -278,7 +314,6 @@ func NewEpochFromConfig(
 	if isCarMode {
 		var localCarReader *carv2.Reader
 		var remoteCarReader ReaderAtCloser
-		var err error
 		if config.IsCarFromPieces() {
 
 			metadata, err := splitcarfetcher.MetadataFromYaml(string(config.Data.Car.FromPieces.Metadata.URI))
@@ -387,20 +422,20 @@ func NewEpochFromConfig(
 				}
 				remoteCarReader = scrFromURLs
 			}
+			ep.onClose = append(ep.onClose, remoteCarReader.Close)
 		} else {
-			localCarReader, remoteCarReader, err = openCarStorage(c.Context, string(config.Data.Car.URI))
+			// the CAR file is shared with the other epochs that have it open (e.g. the previous
+			// instance of this epoch, while it's still serving requests after a reload).
+			storage, ref, err := acquireCarStorage(c.Context, string(config.Data.Car.URI))
 			if err != nil {
 				return nil, fmt.Errorf("failed to open CAR file: %w", err)
 			}
-		}
-		if localCarReader != nil {
-			ep.onClose = append(ep.onClose, localCarReader.Close)
-		}
-		if remoteCarReader != nil {
-			ep.onClose = append(ep.onClose, remoteCarReader.Close)
+			ep.onClose = append(ep.onClose, ref.Release)
+			localCarReader, remoteCarReader = storage.local, storage.remote
 		}
 		ep.localCarReader = localCarReader
 		ep.remoteCarReader = remoteCarReader
+		ep.openAlternates()
 		if remoteCarReader != nil {
 			// determine the header size so that we know where the data starts:
 			headerSizeBuf, err := readSectionFromReaderAt(remoteCarReader, 0, 10)
@@ -436,14 +471,10 @@ func NewEpochFromConfig(
 		}
 	}
 	{
-		sigExistsFile, err := openIndexStorage(
-			c.Context,
-			string(config.Indexes.SigExists.URI),
-		)
+		sigExistsFile, err := ep.mountIndex(c.Context, "sig_exists", config.Indexes.SigExists.URI)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open sig-exists index file: %w", err)
 		}
-		ep.onClose = append(ep.onClose, sigExistsFile.Close)
 
 		if config.IsDeprecatedIndexes() {
 			sigExists, err := deprecatedbucketter.NewReader(sigExistsFile)
@@ -480,6 +511,20 @@ func NewEpochFromConfig(
 	}
 
 	ep.rootCid = lastRootCid
+	if isCarMode && indexSamplingConfig != nil {
+		if err := ep.sampleIndexes(c.Context, indexSamplingConfig); err != nil {
+			ep.Close()
+			return nil, fmt.Errorf("epoch %d: %w", ep.Epoch(), err)
+		}
+	}
+	ep.startIndexRebuilds(c.Context)
+	err := ep.openStandby(func(standbyConfig *Config) (*Epoch, error) {
+		return NewEpochFromConfig(standbyConfig, c, allCache, minerInfo)
+	})
+	if err != nil {
+		ep.Close()
+		return nil, err
+	}
 
 	return ep, nil
 }
@@ -596,6 +641,10 @@ func (s *Epoch) prefetchSubgraph(ctx context.Context, wantedCid cid.Cid) error {
 }
 
 func (s *Epoch) GetNodeByCid(ctx context.Context, wantedCid cid.Cid) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		// the request is past its deadline.
+		return nil, err
+	}
 	{
 		// try from cache
 		data, err, has := s.GetCache().GetRawCarObject(wantedCid)
@@ -603,6 +652,7 @@ func (s *Epoch) GetNodeByCid(ctx context.Context, wantedCid cid.Cid) ([]byte, er
 			return nil, err
 		}
 		if has {
+			observeNodeRead(ctx, len(data), true)
 			return data, nil
 		}
 	}
@@ -610,6 +660,8 @@ func (s *Epoch) GetNodeByCid(ctx context.Context, wantedCid cid.Cid) ([]byte, er
 		// Fetch the node from lassie.
 		data, err := s.lassieFetcher.GetNodeByCid(ctx, wantedCid)
 		if err == nil {
+			observeStorageRead(ctx, uint64(len(data)))
+			observeNodeRead(ctx, len(data), false)
 			// put in cache
 			s.GetCache().PutRawCarObject(wantedCid, data)
 			return data, nil
@@ -622,10 +674,22 @@ func (s *Epoch) GetNodeByCid(ctx context.Context, wantedCid cid.Cid) ([]byte, er
 		// not found or error
 		return nil, fmt.Errorf("failed to find offset for CID %s: %w", wantedCid, err)
 	}
-	return s.GetNodeByOffsetAndSize(ctx, wantedCid, oas)
+	data, err := s.GetNodeByOffsetAndSize(ctx, wantedCid, oas)
+	data, err = s.verifyNode(ctx, wantedCid, oas, data, err)
+	if err != nil {
+		return nil, err
+	}
+	observeNodeRead(ctx, len(data), false)
+	return data, nil
 }
 
-func (s *Epoch) ReadAtFromCar(ctx context.Context, offset uint64, length uint64) ([]byte, error) {
+func (s *Epoch) ReadAtFromCar(ctx context.Context, offset uint64, length uint64) (_ []byte, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer observeCarRead(ctx, time.Now())
+	defer func(startedAt time.Time) { s.observeRead(startedAt, err) }(time.Now())
+	observeStorageRead(ctx, length)
 	if s.localCarReader == nil {
 		// try remote reader
 		if s.remoteCarReader == nil {
@@ -647,15 +711,21 @@ func (s *Epoch) ReadAtFromCar(ctx context.Context, offset uint64, length uint64)
 	return data, nil
 }
 
-func (s *Epoch) GetNodeByOffsetAndSize(ctx context.Context, wantedCid cid.Cid, offsetAndSize *indexes.OffsetAndSize) ([]byte, error) {
+func (s *Epoch) GetNodeByOffsetAndSize(ctx context.Context, wantedCid cid.Cid, offsetAndSize *indexes.OffsetAndSize) (_ []byte, err error) {
 	if offsetAndSize == nil {
 		return nil, fmt.Errorf("offsetAndSize must not be nil")
 	}
 	if offsetAndSize.Size == 0 {
 		return nil, fmt.Errorf("offsetAndSize.Size must not be 0")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	offset := offsetAndSize.Offset
 	length := offsetAndSize.Size
+	defer observeCarRead(ctx, time.Now())
+	defer func(startedAt time.Time) { s.observeRead(startedAt, err) }(time.Now())
+	observeStorageRead(ctx, length)
 	if s.localCarReader == nil {
 		// try remote reader
 		if s.remoteCarReader == nil {
@@ -731,7 +801,7 @@ func parseNodeFromSection(section []byte, wantedCid cid.Cid) ([]byte, error) {
 	}
 	// verify that the CID we read matches the one we expected.
 	if !gotCid.Equals(wantedCid) {
-		return nil, fmt.Errorf("CID mismatch: expected %s, got %s", wantedCid, gotCid)
+		return nil, fmt.Errorf("%w: expected %s, got %s", errNodeCidMismatch, wantedCid, gotCid)
 	}
 	return data[cidLen:], nil
 }
@@ -740,6 +810,7 @@ func (ser *Epoch) FindCidFromSlot(ctx context.Context, slot uint64) (o cid.Cid,
 	startedAt := time.Now()
 	defer func() {
 		klog.V(4).Infof("Found CID for slot %d in %s: %s", slot, time.Since(startedAt), o)
+		observeDebugTiming(ctx, debugPhaseIndexLookup, startedAt)
 	}()
 
 	// try from cache
@@ -748,7 +819,16 @@ func (ser *Epoch) FindCidFromSlot(ctx context.Context, slot uint64) (o cid.Cid,
 	} else if has {
 		return c, nil
 	}
-	found, err := ser.slotToCidIndex.Get(slot)
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	slotToCidIndex, err := ser.getSlotToCidIndex()
+	if err != nil {
+		return cid.Undef, err
+	}
+	readAt := time.Now()
+	found, err := slotToCidIndex.Get(slot)
+	ser.observeRead(readAt, err)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -756,12 +836,60 @@ func (ser *Epoch) FindCidFromSlot(ctx context.Context, slot uint64) (o cid.Cid,
 	return found, nil
 }
 
+// GetPreviousBlockhash returns the blockhash of the parent of the block of the slot, from the
+// slot-to-blockhash index; false if the epoch doesn't have the index, or the index doesn't know it.
+func (ser *Epoch) GetPreviousBlockhash(slot uint64) (solana.Hash, bool) {
+	if ser.slotToBlockhashIndex == nil {
+		return solana.Hash{}, false
+	}
+	_, previousBlockhash, err := ser.slotToBlockhashIndex.Get(slot)
+	if err != nil {
+		if !errors.Is(err, compactindexsized.ErrNotFound) {
+			klog.Errorf("failed to get the previous blockhash of slot %d: %v", slot, err)
+		}
+		return solana.Hash{}, false
+	}
+	if previousBlockhash.IsZero() {
+		return solana.Hash{}, false
+	}
+	return previousBlockhash, true
+}
+
+// IsSlotSkipped returns true if the slot (that has no block in the epoch) is known to have been skipped,
+// i.e. it's in the range of the slots covered by the archive; false means that it might not be in the archive
+// (or that the index doesn't have the coverage).
+func (ser *Epoch) IsSlotSkipped(slot uint64) bool {
+	coverage, ok := ser.SlotCoverage()
+	return ok && coverage.Contains(slot)
+}
+
+// SlotCoverage returns the range of the slots of the blocks of the epoch, as stored in its
+// slot-to-cid index (false if the index doesn't have it, or is not ready).
+func (ser *Epoch) SlotCoverage() (indexes.SlotCoverage, bool) {
+	slotToCidIndex, err := ser.getSlotToCidIndex()
+	if err != nil {
+		return indexes.SlotCoverage{}, false
+	}
+	return slotToCidIndex.Coverage()
+}
+
 func (ser *Epoch) FindCidFromSignature(ctx context.Context, sig solana.Signature) (o cid.Cid, e error) {
 	startedAt := time.Now()
 	defer func() {
 		klog.V(4).Infof("Found CID for signature %s in %s: %s", sig, time.Since(startedAt), o)
+		observeDebugTiming(ctx, debugPhaseIndexLookup, startedAt)
 	}()
-	return ser.sigToCidIndex.Get(sig)
+	if err := ctx.Err(); err != nil {
+		return cid.Undef, err
+	}
+	sigToCidIndex, err := ser.getSigToCidIndex()
+	if err != nil {
+		return cid.Undef, err
+	}
+	readAt := time.Now()
+	found, err := sigToCidIndex.Get(sig)
+	ser.observeRead(readAt, err)
+	return found, err
 }
 
 func (ser *Epoch) FindOffsetAndSizeFromCid(ctx context.Context, cid cid.Cid) (os *indexes.OffsetAndSize, e error) {
@@ -772,6 +900,7 @@ func (ser *Epoch) FindOffsetAndSizeFromCid(ctx context.Context, cid cid.Cid) (os
 		} else {
 			klog.V(4).Infof("Offset and size for CID %s in %s: not found", cid, time.Since(startedAt))
 		}
+		observeDebugTiming(ctx, debugPhaseIndexLookup, startedAt)
 	}()
 
 	// try from cache
@@ -780,9 +909,14 @@ func (ser *Epoch) FindOffsetAndSizeFromCid(ctx context.Context, cid cid.Cid) (os
 	} else if has {
 		return osi, nil
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	readAt := time.Now()
 	if ser.config.IsDeprecatedIndexes() {
 		offset, err := ser.deprecated_cidToOffsetIndex.Get(cid)
+		ser.observeRead(readAt, err)
 		if err != nil {
 			return nil, err
 		}
@@ -805,6 +939,7 @@ func (ser *Epoch) FindOffsetAndSizeFromCid(ctx context.Context, cid cid.Cid) (os
 	}
 
 	found, err := ser.cidToOffsetAndSizeIndex.Get(cid)
+	ser.observeRead(readAt, err)
 	if err != nil {
 		return nil, err
 	}
@@ -831,10 +966,12 @@ func (ser *Epoch) GetBlock(ctx context.Context, slot uint64) (*ipldbindcode.Bloc
 		return nil, cid.Cid{}, fmt.Errorf("failed to get node by cid %s: %w", wantedCid, err)
 	}
 	// try parsing the data as a Block node.
+	startedDecodingAt := time.Now()
 	decoded, err := iplddecoders.DecodeBlock(data)
 	if err != nil {
 		return nil, cid.Cid{}, fmt.Errorf("failed to decode block with CID %s: %w", wantedCid, err)
 	}
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
 	return decoded, wantedCid, nil
 }
 
@@ -870,10 +1007,12 @@ func (ser *Epoch) GetDataFrameByCid(ctx context.Context, wantedCid cid.Cid) (*ip
 		return nil, fmt.Errorf("failed to find node by cid %s: %w", wantedCid, err)
 	}
 	// try parsing the data as a DataFrame node.
+	startedDecodingAt := time.Now()
 	decoded, err := iplddecoders.DecodeDataFrame(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode data frame with CID %s: %w", wantedCid, err)
 	}
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
 	return decoded, nil
 }
 
@@ -883,10 +1022,43 @@ func (ser *Epoch) GetRewardsByCid(ctx context.Context, wantedCid cid.Cid) (*ipld
 		return nil, fmt.Errorf("failed to find node by cid %s: %w", wantedCid, err)
 	}
 	// try parsing the data as a Rewards node.
+	startedDecodingAt := time.Now()
 	decoded, err := iplddecoders.DecodeRewards(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode rewards with CID %s: %w", wantedCid, err)
 	}
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+	return decoded, nil
+}
+
+// GetRootCid returns the CID of the Epoch node (the root of the DAG).
+func (ser *Epoch) GetRootCid() cid.Cid {
+	return ser.rootCid
+}
+
+func (ser *Epoch) GetEpochNode(ctx context.Context) (*ipldbindcode.Epoch, error) {
+	data, err := ser.GetNodeByCid(ctx, ser.rootCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find node by cid %s: %w", ser.rootCid, err)
+	}
+	// try parsing the data as an Epoch node.
+	decoded, err := iplddecoders.DecodeEpoch(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode epoch with CID %s: %w", ser.rootCid, err)
+	}
+	return decoded, nil
+}
+
+func (ser *Epoch) GetSubsetByCid(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.Subset, error) {
+	data, err := ser.GetNodeByCid(ctx, wantedCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find node by cid %s: %w", wantedCid, err)
+	}
+	// try parsing the data as a Subset node.
+	decoded, err := iplddecoders.DecodeSubset(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode subset with CID %s: %w", wantedCid, err)
+	}
 	return decoded, nil
 }
 
@@ -913,5 +1085,35 @@ func (ser *Epoch) GetTransaction(ctx context.Context, sig solana.Signature) (*ip
 	if err != nil {
 		return nil, cid.Cid{}, fmt.Errorf("failed to decode transaction with CID %s: %w", wantedCid, err)
 	}
+	if !isTransactionOfSignature(decoded, sig) {
+		return nil, cid.Cid{}, fmt.Errorf("failed to find CID for signature %s: %w", sig, compactindexsized.ErrNotFound)
+	}
 	return decoded, wantedCid, nil
 }
+
+// FindTransactionCidFromSignature returns the CID of the transaction with the given signature:
+// unlike FindCidFromSignature, it reads the transaction of the CID, and checks that it has the
+// signature (see isTransactionOfSignature).
+func (ser *Epoch) FindTransactionCidFromSignature(ctx context.Context, sig solana.Signature) (cid.Cid, error) {
+	wantedCid, err := ser.FindCidFromSignature(ctx, sig)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("failed to find CID for signature %s: %w", sig, err)
+	}
+	decoded, err := ser.GetTransactionByCid(ctx, wantedCid)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !isTransactionOfSignature(decoded, sig) {
+		return cid.Undef, fmt.Errorf("failed to find CID for signature %s: %w", sig, compactindexsized.ErrNotFound)
+	}
+	return wantedCid, nil
+}
+
+// isTransactionOfSignature returns false if the first signature of the transaction is not sig:
+// the sig-to-cid index doesn't store the signatures, so the lookup of a signature that is not in
+// the epoch can return the CID of another transaction (with a hash, or a fingerprint, that matches).
+func isTransactionOfSignature(tx *ipldbindcode.Transaction, sig solana.Signature) bool {
+	first, err := readFirstSignature(tx.Data.Bytes())
+	// a transaction that is split in several frames has its signatures in the first one.
+	return err != nil || first == sig
+}
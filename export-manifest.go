@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ExportManifestSchemaVersion is the version of the schema of the export manifests.
+const ExportManifestSchemaVersion = 1
+
+// ExportManifest describes the output of an export (a transcode run), so that the data pipelines
+// that consume it can check that it's complete. It has no timestamps or local paths: the same
+// export of the same epochs gives the same manifest, byte for byte.
+type ExportManifest struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Command       string `json:"command"`
+	// FromSlot and ToSlot are the slot range of the export (inclusive).
+	FromSlot uint64 `json:"fromSlot"`
+	ToSlot   uint64 `json:"toSlot"`
+	// ResumedFrom is set when the run resumed an interrupted export: the rows are the ones of
+	// the slots from it.
+	ResumedFrom *uint64 `json:"resumedFrom,omitempty"`
+	// Filters select the epoch configs that were exported.
+	Filters ExportManifestFilters `json:"filters"`
+	// Options are the options of the export that change its output (e.g. the compression).
+	Options map[string]string `json:"options,omitempty"`
+	// Epochs are the epochs of the slot range that were exported, and MissingEpochs the ranges
+	// of epochs of the slot range without a config (their slots are not in the export).
+	Epochs        []ExportManifestEpoch `json:"epochs"`
+	MissingEpochs [][2]uint64           `json:"missingEpochs"`
+	// FirstBlock and LastBlock are the slots of the first and last exported blocks.
+	FirstBlock *uint64 `json:"firstBlock,omitempty"`
+	LastBlock  *uint64 `json:"lastBlock,omitempty"`
+	// Rows are the number of exported rows of each kind (e.g. blocks, transactions).
+	Rows  map[string]uint64    `json:"rows"`
+	Files []ExportManifestFile `json:"files"`
+}
+
+type ExportManifestFilters struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+type ExportManifestEpoch struct {
+	Epoch uint64 `json:"epoch"`
+	// RootCid is the root CID of the CAR the epoch was read from.
+	RootCid string `json:"rootCid,omitempty"`
+}
+
+type ExportManifestFile struct {
+	// Name is the base name of the file.
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+func newExportManifest(command string, fromSlot uint64, toSlot uint64, includePatterns []string, excludePatterns []string) *ExportManifest {
+	return &ExportManifest{
+		SchemaVersion: ExportManifestSchemaVersion,
+		Command:       command,
+		FromSlot:      fromSlot,
+		ToSlot:        toSlot,
+		Filters: ExportManifestFilters{
+			Include: append([]string{}, includePatterns...),
+			Exclude: append([]string{}, excludePatterns...),
+		},
+		Epochs:        make([]ExportManifestEpoch, 0),
+		MissingEpochs: make([][2]uint64, 0),
+		Rows:          make(map[string]uint64),
+		Files:         make([]ExportManifestFile, 0),
+	}
+}
+
+// addBlock counts an exported block; the blocks are exported in slot order.
+func (m *ExportManifest) addBlock(slot uint64) {
+	if m.FirstBlock == nil {
+		m.FirstBlock = &slot
+	}
+	m.LastBlock = &slot
+	m.Rows["blocks"]++
+}
+
+// addRows counts exported rows of the given kind.
+func (m *ExportManifest) addRows(kind string, n uint64) {
+	m.Rows[kind] += n
+}
+
+// setEpochs sets the exported epochs, from the configs of the export and the root CIDs of the
+// epochs that were opened (see epochScanner), and the epochs of the range without config.
+func (m *ExportManifest) setEpochs(configs ConfigSlice, rootCids map[uint64]string) {
+	m.Epochs = make([]ExportManifestEpoch, 0, len(configs))
+	for _, config := range configs {
+		m.Epochs = append(m.Epochs, ExportManifestEpoch{Epoch: *config.Epoch, RootCid: rootCids[*config.Epoch]})
+	}
+	sort.Slice(m.Epochs, func(i, j int) bool { return m.Epochs[i].Epoch < m.Epochs[j].Epoch })
+	fromSlot := m.FromSlot
+	if m.ResumedFrom != nil {
+		fromSlot = *m.ResumedFrom
+	}
+	if gaps := missingEpochs(configs, fromSlot, m.ToSlot); len(gaps) > 0 {
+		m.MissingEpochs = gaps
+	}
+}
+
+// Write writes the manifest to the file at the given path, atomically.
+func (m *ExportManifest) Write(path string) error {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(buf, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// hashingWriter computes the sha256 and the size of what is written through it, for the files
+// of the export manifests.
+type hashingWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	size int64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, hash: sha256.New()}
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// manifestFile returns the entry of the export manifest of the file written through w.
+func (w *hashingWriter) manifestFile(path string) ExportManifestFile {
+	return ExportManifestFile{
+		Name:   filepath.Base(path),
+		Size:   w.size,
+		Sha256: hex.EncodeToString(w.hash.Sum(nil)),
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportManifest(t *testing.T) {
+	epoch := func(n uint64) *Config { return &Config{Epoch: &n} }
+	start, _ := CalcEpochLimits(1)
+	_, stop := CalcEpochLimits(4)
+
+	build := func() *ExportManifest {
+		manifest := newExportManifest("transcode entries", start, stop, nil, []string{".git"})
+		var out bytes.Buffer
+		hashed := newHashingWriter(&out)
+		for _, slot := range []uint64{start + 1, start + 2, start + 5} {
+			manifest.addBlock(slot)
+			manifest.addRows("transactions", 3)
+			hashed.Write([]byte{byte(slot)})
+		}
+		manifest.Files = append(manifest.Files, hashed.manifestFile("/data/out/entries.bin"))
+		// epoch 3 has no config.
+		manifest.setEpochs(ConfigSlice{epoch(1), epoch(2), epoch(4)}, map[uint64]string{1: "bafy1", 2: "bafy2", 4: "bafy4"})
+		return manifest
+	}
+
+	manifest := build()
+	require.Equal(t, map[string]uint64{"blocks": 3, "transactions": 9}, manifest.Rows)
+	require.Equal(t, start+1, *manifest.FirstBlock)
+	require.Equal(t, start+5, *manifest.LastBlock)
+	require.Equal(t, [][2]uint64{{3, 3}}, manifest.MissingEpochs)
+	require.Equal(t, []ExportManifestEpoch{{1, "bafy1"}, {2, "bafy2"}, {4, "bafy4"}}, manifest.Epochs)
+	sum := sha256.Sum256([]byte{byte(start + 1), byte(start + 2), byte(start + 5)})
+	require.Equal(t, []ExportManifestFile{{Name: "entries.bin", Size: 3, Sha256: hex.EncodeToString(sum[:])}}, manifest.Files)
+
+	// the same export gives the same manifest.
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	require.NoError(t, manifest.Write(first))
+	require.NoError(t, build().Write(second))
+	firstBuf, err := os.ReadFile(first)
+	require.NoError(t, err)
+	secondBuf, err := os.ReadFile(second)
+	require.NoError(t, err)
+	require.Equal(t, firstBuf, secondBuf)
+
+	var decoded ExportManifest
+	require.NoError(t, json.Unmarshal(firstBuf, &decoded))
+	require.Equal(t, manifest, &decoded)
+}
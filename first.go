@@ -39,7 +39,11 @@ func (w *FirstResponse) Spawn(f func() (any, error)) (ok bool) {
 		return false
 	}
 	w.wg.Go(func() error {
-		result, err := f()
+		var result any
+		err := runRecovered("epoch_search", func() (err error) {
+			result, err = f()
+			return err
+		})
 		if err != nil {
 			return w.send(err) // stop the errgroup
 		} else {
@@ -4,9 +4,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+	metalatest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-latest"
+	metaoldest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-oldest"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
 )
 
 type GetSignaturesForAddressParams struct {
@@ -14,6 +20,8 @@ type GetSignaturesForAddressParams struct {
 	Limit   int
 	Before  *solana.Signature
 	Until   *solana.Signature
+	// Commitment is only validated (nil means the default).
+	Commitment *rpc.CommitmentType
 	// TODO: add more params
 }
 
@@ -55,6 +63,13 @@ func parseGetSignaturesForAddressParams(raw *json.RawMessage) (*GetSignaturesFor
 					out.Before = &sig
 				}
 			}
+			if commitmentRaw, ok := m["commitment"]; ok {
+				commitment, err := parseCommitment(commitmentRaw)
+				if err != nil {
+					return nil, err
+				}
+				out.Commitment = &commitment
+			}
 			if after, ok := m["until"]; ok {
 				if after, ok := after.(string); ok {
 					sig, err := solana.SignatureFromBase58(after)
@@ -73,17 +88,31 @@ func parseGetSignaturesForAddressParams(raw *json.RawMessage) (*GetSignaturesFor
 	return out, nil
 }
 
-func getMemoInstructionDataFromTransaction(tx *solana.Transaction) []byte {
+// formatMemosFromTransaction returns the memos of the transaction formatted like the RPC does
+// (e.g. "[5] hello; [5] world"), or nil if the transaction has no memo instruction.
+func formatMemosFromTransaction(tx *solana.Transaction) []byte {
+	var memos []string
 	for _, instruction := range tx.Message.Instructions {
 		prog, err := tx.ResolveProgramIDIndex(instruction.ProgramIDIndex)
 		if err != nil {
 			continue
 		}
 		if prog.IsAnyOf(memoProgramIDV1, memoProgramIDV2) {
-			return instruction.Data
+			memos = append(memos, formatMemo(instruction.Data))
 		}
 	}
-	return nil
+	if len(memos) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(memos, "; "))
+}
+
+func formatMemo(data []byte) string {
+	parsed := "(unparseable)"
+	if utf8.Valid(data) {
+		parsed = string(data)
+	}
+	return fmt.Sprintf("[%d] %s", len(data), parsed)
 }
 
 var (
@@ -91,8 +120,9 @@ var (
 	memoProgramIDV2 = solana.MPK("MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr")
 )
 
-func parseTransactionError(v any) (map[string]any, error) {
-	// TODO: if any of the following fails, return the original value.
+// parseTransactionError decodes the "err" field (the base64 of the bincode-encoded TransactionError)
+// of the given transaction error object, into the JSON value returned by the RPC.
+func parseTransactionError(v any) (any, error) {
 	// marshal to json
 	b, err := fasterJson.Marshal(v)
 	if err != nil {
@@ -118,66 +148,135 @@ func parseTransactionError(v any) (map[string]any, error) {
 	if err != nil {
 		return nil, err
 	}
-	///
-	{
-		dec := bin.NewBinDecoder(b)
-		transactionErrorType, err := dec.ReadUint32(bin.LE)
+	return decodeTransactionError(b)
+}
+
+// transactionErrorFromMeta returns the error of the transaction with the given meta (in any of the supported formats),
+// as the JSON value returned by the RPC, or nil if the transaction succeeded.
+func transactionErrorFromMeta(meta any) (any, error) {
+	var encoded []byte
+	switch metaValue := meta.(type) {
+	case nil:
+		return nil, nil
+	case *upstreamTransactionMeta:
+		// already the JSON value of the RPC.
+		return metaValue.Err, nil
+	case *confirmed_block.TransactionStatusMeta:
+		if metaValue.Err == nil || len(metaValue.Err.Err) == 0 {
+			return nil, nil
+		}
+		encoded = metaValue.Err.Err
+	case *metalatest.TransactionStatusMeta:
+		status, ok := metaValue.Status.(*metalatest.Result__Err)
+		if !ok {
+			return nil, nil
+		}
+		var err error
+		encoded, err = status.Value.BincodeSerialize()
+		if err != nil {
+			return nil, err
+		}
+	case *metaoldest.TransactionStatusMeta:
+		status, ok := metaValue.Status.(*metaoldest.Result__Err)
+		if !ok {
+			return nil, nil
+		}
+		var err error
+		encoded, err = status.Value.BincodeSerialize()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported transaction meta type: %T", meta)
+	}
+	return decodeTransactionError(encoded)
+}
+
+// decodeTransactionError decodes a bincode-encoded TransactionError into the same JSON value as the RPC,
+// e.g. "AccountInUse", {"InstructionError":[0,{"Custom":1}]} or {"InsufficientFundsForRent":{"account_index":2}}.
+func decodeTransactionError(b []byte) (any, error) {
+	dec := bin.NewBinDecoder(b)
+	transactionErrorType, err := dec.ReadUint32(bin.LE)
+	if err != nil {
+		return nil, err
+	}
+	transactionErrorTypeName, ok := TransactionErrorType_name[int32(transactionErrorType)]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction error type: %d", transactionErrorType)
+	}
+	transactionErrorTypeName = transactionErrorName(transactionErrorTypeName)
+
+	switch TransactionErrorType(transactionErrorType) {
+	case TransactionErrorType_INSTRUCTION_ERROR:
+		instructionIndex, err := dec.ReadUint8()
 		if err != nil {
 			return nil, err
 		}
-		// TODO: is this uint8 or uvarint or something else?
-		errorCode, err := dec.ReadUint8()
+		instructionErrorType, err := dec.ReadUint32(bin.LE)
 		if err != nil {
 			return nil, err
 		}
-		transactionErrorTypeName, ok := TransactionErrorType_name[int32(transactionErrorType)]
+		instructionErrorTypeName, ok := InstructionErrorType_name[int32(instructionErrorType)]
 		if !ok {
-			return nil, fmt.Errorf("unknown transaction error type: %d", transactionErrorType)
+			return nil, fmt.Errorf("unknown instruction error type: %d", instructionErrorType)
 		}
-		transactionErrorTypeName = bin.ToPascalCase(transactionErrorTypeName)
-
-		switch TransactionErrorType(transactionErrorType) {
-		case TransactionErrorType_INSTRUCTION_ERROR:
+		instructionErrorTypeName = bin.ToPascalCase(instructionErrorTypeName)
 
-			instructionErrorType, err := dec.ReadUint32(bin.LE)
+		var instructionError any = instructionErrorTypeName
+		switch InstructionErrorType(instructionErrorType) {
+		case InstructionErrorType_CUSTOM:
+			customErrorType, err := dec.ReadUint32(bin.LE)
 			if err != nil {
 				return nil, err
 			}
-
-			instructionErrorTypeName, ok := InstructionErrorType_name[int32(instructionErrorType)]
-			if !ok {
-				return nil, fmt.Errorf("unknown instruction error type: %d", instructionErrorType)
+			instructionError = map[string]any{
+				instructionErrorTypeName: customErrorType,
 			}
-			instructionErrorTypeName = bin.ToPascalCase(instructionErrorTypeName)
-
-			switch InstructionErrorType(instructionErrorType) {
-			case InstructionErrorType_CUSTOM:
-				customErrorType, err := dec.ReadUint32(bin.LE)
-				if err != nil {
-					return nil, err
-				}
-				return map[string]any{
-					transactionErrorTypeName: []any{
-						errorCode,
-						map[string]any{
-							instructionErrorTypeName: customErrorType,
-						},
-					},
-				}, nil
+		case InstructionErrorType_BORSH_IO_ERROR:
+			message, err := dec.ReadRustString()
+			if err != nil {
+				return nil, err
 			}
-
-			return map[string]any{
-				transactionErrorTypeName: []any{
-					errorCode,
-					instructionErrorTypeName,
-				},
-			}, nil
-		default:
-			return map[string]any{
-				transactionErrorTypeName: []any{
-					errorCode,
-				},
-			}, nil
+			instructionError = map[string]any{
+				instructionErrorTypeName: message,
+			}
+		}
+		return map[string]any{
+			transactionErrorTypeName: []any{
+				instructionIndex,
+				instructionError,
+			},
+		}, nil
+	case TransactionErrorType_DUPLICATE_INSTRUCTION:
+		instructionIndex, err := dec.ReadUint8()
+		if err != nil {
+			return nil, err
 		}
+		return map[string]any{
+			transactionErrorTypeName: instructionIndex,
+		}, nil
+	case TransactionErrorType_INSUFFICIENT_FUNDS_FOR_RENT, TransactionErrorType_PROGRAM_EXECUTION_TEMPORARILY_RESTRICTED:
+		accountIndex, err := dec.ReadUint8()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			transactionErrorTypeName: map[string]any{
+				"account_index": accountIndex,
+			},
+		}, nil
+	default:
+		return transactionErrorTypeName, nil
+	}
+}
+
+// transactionErrorName returns the name of the TransactionError variant (as in the RPC responses).
+func transactionErrorName(protoName string) string {
+	switch protoName {
+	case "ACCOUNT_BORROW_OUTSTANDING_TX":
+		// renamed in the protobuf definition, to avoid a clash with the InstructionError variant.
+		return "AccountBorrowOutstanding"
+	default:
+		return bin.ToPascalCase(protoName)
 	}
 }
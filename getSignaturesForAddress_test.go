@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMemosFromTransaction(t *testing.T) {
+	payer := solana.NewWallet().PublicKey()
+	tx := &solana.Transaction{
+		Message: solana.Message{
+			AccountKeys: solana.PublicKeySlice{payer, memoProgramIDV1, memoProgramIDV2, solana.SystemProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 3, Data: []byte{2, 0, 0, 0}},
+			},
+		},
+	}
+	require.Nil(t, formatMemosFromTransaction(tx))
+
+	tx.Message.Instructions = append(tx.Message.Instructions,
+		solana.CompiledInstruction{ProgramIDIndex: 2, Data: []byte("hello")},
+		solana.CompiledInstruction{ProgramIDIndex: 1, Data: []byte{0xff, 0xfe}},
+	)
+	require.Equal(t, "[5] hello; [2] (unparseable)", string(formatMemosFromTransaction(tx)))
+}
+
+func TestDecodeTransactionError(t *testing.T) {
+	cases := []struct {
+		encoded []byte
+		want    any
+	}{
+		// AccountInUse
+		{[]byte{0, 0, 0, 0}, "AccountInUse"},
+		// AccountBorrowOutstanding
+		{[]byte{16, 0, 0, 0}, "AccountBorrowOutstanding"},
+		// InstructionError(2, InvalidArgument)
+		{[]byte{8, 0, 0, 0, 2, 1, 0, 0, 0}, map[string]any{"InstructionError": []any{uint8(2), "InvalidArgument"}}},
+		// InstructionError(0, Custom(6001))
+		{[]byte{8, 0, 0, 0, 0, 25, 0, 0, 0, 0x71, 0x17, 0, 0}, map[string]any{"InstructionError": []any{uint8(0), map[string]any{"Custom": uint32(6001)}}}},
+		// InstructionError(1, BorshIoError("x"))
+		{[]byte{8, 0, 0, 0, 1, 44, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 'x'}, map[string]any{"InstructionError": []any{uint8(1), map[string]any{"BorshIoError": "x"}}}},
+		// DuplicateInstruction(3)
+		{[]byte{30, 0, 0, 0, 3}, map[string]any{"DuplicateInstruction": uint8(3)}},
+		// InsufficientFundsForRent { account_index: 4 }
+		{[]byte{31, 0, 0, 0, 4}, map[string]any{"InsufficientFundsForRent": map[string]any{"account_index": uint8(4)}}},
+	}
+	for _, c := range cases {
+		got, err := decodeTransactionError(c.encoded)
+		require.NoError(t, err)
+		require.Equal(t, c.want, got)
+	}
+
+	_, err := decodeTransactionError([]byte{200, 0, 0, 0})
+	require.Error(t, err)
+	_, err = decodeTransactionError([]byte{8, 0, 0, 0})
+	require.Error(t, err)
+}
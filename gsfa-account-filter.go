@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// gsfaAccountFilter selects which accounts of a transaction are indexed in the gsfa index;
+// the zero value selects all of them.
+type gsfaAccountFilter struct {
+	// OnlyWritable indexes only the accounts that are writable in the transaction.
+	OnlyWritable bool
+	// OnlySigners indexes only the accounts that signed the transaction.
+	OnlySigners bool
+	// ExcludeVote skips the vote program and the vote accounts of the vote instructions.
+	ExcludeVote bool
+}
+
+func (f gsfaAccountFilter) IsZero() bool {
+	return f == gsfaAccountFilter{}
+}
+
+// String returns the description of the filter, as stored in the index metadata.
+func (f gsfaAccountFilter) String() string {
+	var parts []string
+	if f.OnlyWritable {
+		parts = append(parts, "only-writable")
+	}
+	if f.OnlySigners {
+		parts = append(parts, "only-signers")
+	}
+	if f.ExcludeVote {
+		parts = append(parts, "exclude-vote")
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, ",")
+}
+
+// isSignerIndex returns true if the account at the given index of the (static) account keys is a signer.
+func isSignerIndex(msg *solana.Message, index int) bool {
+	return index < int(msg.Header.NumRequiredSignatures)
+}
+
+// isWritableIndex returns true if the account at the given index of the (static) account keys is writable.
+func isWritableIndex(msg *solana.Message, index int) bool {
+	numSigners := int(msg.Header.NumRequiredSignatures)
+	if index < numSigners {
+		return index < numSigners-int(msg.Header.NumReadonlySignedAccounts)
+	}
+	return index < len(msg.AccountKeys)-int(msg.Header.NumReadonlyUnsignedAccounts)
+}
+
+// voteAccounts returns the vote accounts (the first account) of the vote instructions of the transaction.
+func voteAccounts(tx *solana.Transaction) map[solana.PublicKey]struct{} {
+	out := make(map[solana.PublicKey]struct{})
+	for _, instruction := range tx.Message.Instructions {
+		prog, err := tx.ResolveProgramIDIndex(instruction.ProgramIDIndex)
+		if err != nil || !prog.Equals(solana.VoteProgramID) {
+			continue
+		}
+		if len(instruction.Accounts) == 0 || int(instruction.Accounts[0]) >= len(tx.Message.AccountKeys) {
+			continue
+		}
+		out[tx.Message.AccountKeys[instruction.Accounts[0]]] = struct{}{}
+	}
+	return out
+}
+
+// Keys returns the accounts of the transaction to index.
+func (f gsfaAccountFilter) Keys(tx *solana.Transaction) []solana.PublicKey {
+	if f.IsZero() {
+		return tx.Message.AccountKeys
+	}
+	var votes map[solana.PublicKey]struct{}
+	if f.ExcludeVote {
+		votes = voteAccounts(tx)
+	}
+	out := make([]solana.PublicKey, 0, len(tx.Message.AccountKeys))
+	for i, key := range tx.Message.AccountKeys {
+		if f.OnlyWritable && !isWritableIndex(&tx.Message, i) {
+			continue
+		}
+		if f.OnlySigners && !isSignerIndex(&tx.Message, i) {
+			continue
+		}
+		if f.ExcludeVote {
+			if key.Equals(solana.VoteProgramID) {
+				continue
+			}
+			if _, ok := votes[key]; ok {
+				continue
+			}
+		}
+		out = append(out, key)
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGsfaAccountFilter(t *testing.T) {
+	payer := solana.NewWallet().PublicKey()       // writable signer
+	authority := solana.NewWallet().PublicKey()   // readonly signer
+	voteAccount := solana.NewWallet().PublicKey() // writable
+	destination := solana.NewWallet().PublicKey() // writable
+	clockSysvar := solana.SysVarClockPubkey       // readonly
+	tx := &solana.Transaction{
+		Message: solana.Message{
+			Header: solana.MessageHeader{
+				NumRequiredSignatures:       2,
+				NumReadonlySignedAccounts:   1,
+				NumReadonlyUnsignedAccounts: 2,
+			},
+			AccountKeys: solana.PublicKeySlice{payer, authority, voteAccount, destination, clockSysvar, solana.VoteProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 5, Accounts: []uint16{2, 4, 1}},
+			},
+		},
+	}
+
+	require.Equal(t, "all", gsfaAccountFilter{}.String())
+	require.Equal(t, []solana.PublicKey(tx.Message.AccountKeys), gsfaAccountFilter{}.Keys(tx))
+	require.Equal(t,
+		[]solana.PublicKey{payer, voteAccount, destination},
+		gsfaAccountFilter{OnlyWritable: true}.Keys(tx),
+	)
+	require.Equal(t,
+		[]solana.PublicKey{payer, authority},
+		gsfaAccountFilter{OnlySigners: true}.Keys(tx),
+	)
+	require.Equal(t,
+		[]solana.PublicKey{payer},
+		gsfaAccountFilter{OnlyWritable: true, OnlySigners: true}.Keys(tx),
+	)
+	require.Equal(t,
+		[]solana.PublicKey{payer, authority, destination, clockSysvar},
+		gsfaAccountFilter{ExcludeVote: true}.Keys(tx),
+	)
+	require.Equal(t, "only-writable,exclude-vote", gsfaAccountFilter{OnlyWritable: true, ExcludeVote: true}.String())
+}
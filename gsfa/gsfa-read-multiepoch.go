@@ -7,6 +7,7 @@ import (
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/rpcpool/yellowstone-faithful/gsfa/offsetstore"
+	"github.com/rpcpool/yellowstone-faithful/gsfa/txinfo"
 )
 
 type GsfaReaderMultiepoch struct {
@@ -87,6 +88,10 @@ func (e EpochToSignatures) Count() int {
 	return count
 }
 
+// EpochToInfos has the info of the transactions of an EpochToSignatures, at the same positions
+// (nil where the index of the epoch doesn't have the info).
+type EpochToInfos map[uint64][]*txinfo.Info
+
 func (multi *GsfaReaderMultiepoch) GetBeforeUntil(
 	ctx context.Context,
 	pk solana.PublicKey,
@@ -97,7 +102,26 @@ func (multi *GsfaReaderMultiepoch) GetBeforeUntil(
 	if limit <= 0 {
 		return make(EpochToSignatures), nil
 	}
-	return multi.iterBeforeUntil(ctx, pk, limit, before, until)
+	return multi.iterBeforeUntil(ctx, pk, limit, before, until, nil)
+}
+
+// GetBeforeUntilWithInfo is like GetBeforeUntil, and also returns the info of the transactions (e.g. the memos).
+func (multi *GsfaReaderMultiepoch) GetBeforeUntilWithInfo(
+	ctx context.Context,
+	pk solana.PublicKey,
+	limit int,
+	before *solana.Signature,
+	until *solana.Signature,
+) (EpochToSignatures, EpochToInfos, error) {
+	infos := make(EpochToInfos)
+	if limit <= 0 {
+		return make(EpochToSignatures), infos, nil
+	}
+	sigs, err := multi.iterBeforeUntil(ctx, pk, limit, before, until, infos)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sigs, infos, nil
 }
 
 // GetBeforeUntil gets the signatures for the given public key,
@@ -108,6 +132,7 @@ func (multi *GsfaReaderMultiepoch) iterBeforeUntil(
 	limit int,
 	before *solana.Signature, // Before this signature, exclusive (i.e. get signatures older than this signature, excluding it).
 	until *solana.Signature, // Until this signature, inclusive (i.e. stop at this signature, including it).
+	infos EpochToInfos, // if not nil, filled with the info of the transactions.
 ) (EpochToSignatures, error) {
 	if limit <= 0 {
 		return make(EpochToSignatures), nil
@@ -166,6 +191,13 @@ epochLoop:
 					break epochLoop
 				}
 				sigs[epochNum] = append(sigs[epochNum], sig)
+				if infos != nil {
+					info, err := index.getInfo(sigIndex)
+					if err != nil {
+						return nil, err
+					}
+					infos[epochNum] = append(infos[epochNum], info)
+				}
 				if until != nil && sig == *until {
 					break epochLoop
 				}
@@ -12,6 +12,7 @@ import (
 	"github.com/rpcpool/yellowstone-faithful/gsfa/manifest"
 	"github.com/rpcpool/yellowstone-faithful/gsfa/offsetstore"
 	"github.com/rpcpool/yellowstone-faithful/gsfa/sff"
+	"github.com/rpcpool/yellowstone-faithful/gsfa/txinfo"
 	"github.com/rpcpool/yellowstone-faithful/indexmeta"
 )
 
@@ -20,9 +21,15 @@ type GsfaReader struct {
 	offsets *offsetstore.OffsetStore
 	ll      *linkedlog.LinkedLog
 	sff     *sff.SignaturesFlatFile
+	info    *txinfo.File // nil for the indexes created without it.
 	man     *manifest.Manifest
 }
 
+const (
+	txInfoOffsetsFilename = "tx-info-offsets"
+	txInfoDataFilename    = "tx-info-data"
+)
+
 func isDir(path string) (bool, error) {
 	info, err := os.Stat(path)
 	if err != nil {
@@ -67,6 +74,21 @@ func NewGsfaReader(indexRootDir string) (*GsfaReader, error) {
 		}
 		index.sff = sff
 	}
+	{
+		offsetsPath := filepath.Join(indexRootDir, txInfoOffsetsFilename)
+		dataPath := filepath.Join(indexRootDir, txInfoDataFilename)
+		exists, err := txinfo.Exists(offsetsPath, dataPath)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			info, err := txinfo.Open(offsetsPath, dataPath)
+			if err != nil {
+				return nil, fmt.Errorf("error while opening tx info store: %w", err)
+			}
+			index.info = info
+		}
+	}
 	{
 		man, err := manifest.NewManifest(filepath.Join(indexRootDir, "manifest"), indexmeta.Meta{})
 		if err != nil {
@@ -89,13 +111,35 @@ func (index *GsfaReader) GetEpoch() (uint64, bool) {
 }
 
 func (index *GsfaReader) Close() error {
+	var infoErr error
+	if index.info != nil {
+		infoErr = index.info.Close()
+	}
 	return errors.Join(
 		index.offsets.Close(),
 		index.ll.Close(),
 		index.sff.Close(),
+		infoErr,
 	)
 }
 
+// HasInfo returns true if the index has the info of the transactions (e.g. the memos).
+func (index *GsfaReader) HasInfo() bool {
+	return index.info != nil
+}
+
+// getInfo returns the info of the transaction of the signature at the given index, or nil if the index doesn't have it.
+func (index *GsfaReader) getInfo(sigIndex uint64) (*txinfo.Info, error) {
+	if index.info == nil {
+		return nil, nil
+	}
+	info, err := index.info.Get(sigIndex)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting tx info at index=%d: %w", sigIndex, err)
+	}
+	return &info, nil
+}
+
 func (index *GsfaReader) Meta() indexmeta.Meta {
 	return index.man.Meta()
 }
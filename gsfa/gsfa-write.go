@@ -14,6 +14,7 @@ import (
 	"github.com/rpcpool/yellowstone-faithful/gsfa/manifest"
 	"github.com/rpcpool/yellowstone-faithful/gsfa/offsetstore"
 	"github.com/rpcpool/yellowstone-faithful/gsfa/sff"
+	"github.com/rpcpool/yellowstone-faithful/gsfa/txinfo"
 	"github.com/rpcpool/yellowstone-faithful/indexmeta"
 	"github.com/rpcpool/yellowstone-faithful/store"
 	"k8s.io/klog"
@@ -21,6 +22,7 @@ import (
 
 type GsfaWriter struct {
 	sff                       *sff.SignaturesFlatFile
+	info                      *txinfo.File
 	batch                     map[solana.PublicKey][]uint64
 	numCurrentBatchSignatures uint64
 	optAutoflushAtNumSigs     uint64
@@ -95,6 +97,19 @@ func NewGsfaWriter(
 		}
 		index.sff = sff
 	}
+	{
+		info, err := txinfo.Open(
+			filepath.Join(indexRootDir, txInfoOffsetsFilename),
+			filepath.Join(indexRootDir, txInfoDataFilename),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error while opening tx info store: %w", err)
+		}
+		if info.NumEntries() != index.sff.NumSignatures() {
+			return nil, fmt.Errorf("tx info store has %d entries, but there are %d signatures", info.NumEntries(), index.sff.NumSignatures())
+		}
+		index.info = info
+	}
 	{
 		man, err := manifest.NewManifest(filepath.Join(indexRootDir, "manifest"), meta)
 		if err != nil {
@@ -106,6 +121,11 @@ func NewGsfaWriter(
 }
 
 func (a *GsfaWriter) Push(slot uint64, signature solana.Signature, publicKeys []solana.PublicKey) error {
+	return a.PushWithInfo(slot, signature, publicKeys, txinfo.Info{})
+}
+
+// PushWithInfo is like Push, and also stores the info of the transaction (returned with its signature).
+func (a *GsfaWriter) PushWithInfo(slot uint64, signature solana.Signature, publicKeys []solana.PublicKey, info txinfo.Info) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	if a.numCurrentBatchSignatures >= a.optAutoflushAtNumSigs && slot != a.lastSlot {
@@ -117,6 +137,12 @@ func (a *GsfaWriter) Push(slot uint64, signature solana.Signature, publicKeys []
 		a.firstSlotOfCurrentBatch = slot
 	}
 	index, err := a.sff.Put(signature)
+	if err != nil {
+		return err
+	}
+	if err := a.info.Put(index, info); err != nil {
+		return fmt.Errorf("error while storing tx info: %w", err)
+	}
 	for _, publicKey := range publicKeys {
 		a.batch[publicKey] = append(a.batch[publicKey], index)
 	}
@@ -125,7 +151,7 @@ func (a *GsfaWriter) Push(slot uint64, signature solana.Signature, publicKeys []
 	if a.firstSlotOfCurrentBatch == 0 {
 		a.firstSlotOfCurrentBatch = slot
 	}
-	return err
+	return nil
 }
 
 // Flush forces a flush of the current batch to disk.
@@ -144,6 +170,7 @@ func (a *GsfaWriter) Close() error {
 	}
 	return errors.Join(
 		a.sff.Close(),
+		a.info.Close(),
 		a.offsets.Close(),
 		a.ll.Close(),
 		a.man.Close(),
@@ -154,6 +181,9 @@ func (a *GsfaWriter) flush() error {
 	if err := a.sff.Flush(); err != nil {
 		return err
 	}
+	if err := a.info.Flush(); err != nil {
+		return err
+	}
 	if len(a.batch) == 0 {
 		return nil
 	}
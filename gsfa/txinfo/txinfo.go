@@ -0,0 +1,296 @@
+package txinfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Info is the extra info about a transaction that is returned with its signature
+// by getSignaturesForAddress, so that the transaction doesn't need to be fetched.
+type Info struct {
+	// Memo is the memo of the transaction, formatted like the RPC does (nil if none).
+	Memo []byte
+	// Err is the error of the transaction, as the JSON value returned by the RPC (nil if the transaction succeeded).
+	Err []byte
+	// StatusUnknown is true if the status of the transaction could not be determined when indexing it.
+	StatusUnknown bool
+	// HasStatus is set by Get: true if Err is the status of the transaction, i.e. if a nil Err
+	// means that the transaction succeeded (the stores created by older versions only have the memos).
+	HasStatus bool
+}
+
+// IsEmpty returns true if there is no info to store.
+func (i Info) IsEmpty() bool {
+	return i.Memo == nil && i.Err == nil && !i.StatusUnknown
+}
+
+const (
+	flagMemo          = 1 << 0
+	flagErr           = 1 << 1
+	flagStatusUnknown = 1 << 2
+)
+
+// maxFieldSize bounds the size of the fields read back (a transaction is at most 1232 bytes).
+const maxFieldSize = 1 << 16
+
+// dataMagic is at the start of the data file, so that offset 0 means "no info";
+// the data files with dataMagicNoStatus don't have the errors of the transactions.
+var (
+	dataMagic         = []byte("txi2")
+	dataMagicNoStatus = []byte("txi1")
+)
+
+const (
+	offsetSize   = 8
+	writeBufSize = offsetSize * 1024
+)
+
+// File stores the Info of the transactions, by the index of their signature
+// in the signatures flat file (see package sff). It's made of two files:
+// the offsets file (the offset of the info in the data file, or 0, for each signature),
+// and the data file.
+type File struct {
+	offsets      *os.File
+	data         *os.File
+	offsetsCache *bufio.Writer
+	dataCache    *bufio.Writer
+	mu           sync.Mutex
+	count        uint64
+	dataSize     uint64
+	hasStatus    bool
+}
+
+// Exists returns true if the files of the store exist.
+func Exists(offsetsFilename string, dataFilename string) (bool, error) {
+	for _, name := range []string{offsetsFilename, dataFilename} {
+		if _, err := os.Stat(name); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Open creates or opens the store.
+func Open(offsetsFilename string, dataFilename string) (*File, error) {
+	offsets, err := os.OpenFile(offsetsFilename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.OpenFile(dataFilename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		offsets.Close()
+		return nil, err
+	}
+	f := &File{
+		offsets:      offsets,
+		data:         data,
+		offsetsCache: bufio.NewWriterSize(offsets, writeBufSize),
+		dataCache:    bufio.NewWriterSize(data, writeBufSize),
+	}
+	if err := f.init(); err != nil {
+		offsets.Close()
+		data.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) init() error {
+	offsetsStat, err := f.offsets.Stat()
+	if err != nil {
+		return err
+	}
+	if offsetsStat.Size()%offsetSize != 0 {
+		return fmt.Errorf("offsets file size is not a multiple of %d: %d", offsetSize, offsetsStat.Size())
+	}
+	f.count = uint64(offsetsStat.Size() / offsetSize)
+
+	dataStat, err := f.data.Stat()
+	if err != nil {
+		return err
+	}
+	if dataStat.Size() == 0 {
+		if _, err := f.dataCache.Write(dataMagic); err != nil {
+			return err
+		}
+		f.dataSize = uint64(len(dataMagic))
+		f.hasStatus = true
+		return nil
+	}
+	magic := make([]byte, len(dataMagic))
+	if _, err := f.data.ReadAt(magic, 0); err != nil {
+		return fmt.Errorf("failed to read the magic of the data file: %w", err)
+	}
+	switch {
+	case bytes.Equal(magic, dataMagic):
+		f.hasStatus = true
+	case bytes.Equal(magic, dataMagicNoStatus):
+		f.hasStatus = false
+	default:
+		return fmt.Errorf("invalid magic in data file: %q", magic)
+	}
+	f.dataSize = uint64(dataStat.Size())
+	return nil
+}
+
+// HasStatus returns true if the store has the statuses (errors) of the transactions.
+func (f *File) HasStatus() bool {
+	return f.hasStatus
+}
+
+// NumEntries returns the number of entries (one per signature) in the store.
+func (f *File) NumEntries() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// Put stores the info of the signature at the given index, which must be the next one
+// (i.e. the store is filled alongside the signatures flat file).
+func (f *File) Put(index uint64, info Info) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if index != f.count {
+		return fmt.Errorf("out of order put: expected index %d, got %d", f.count, index)
+	}
+	if (info.Err != nil || info.StatusUnknown) && !f.hasStatus {
+		return fmt.Errorf("the store was created without the statuses of the transactions")
+	}
+	var offset uint64
+	if !info.IsEmpty() {
+		offset = f.dataSize
+		record := encodeInfo(info)
+		if _, err := f.dataCache.Write(record); err != nil {
+			return err
+		}
+		f.dataSize += uint64(len(record))
+	}
+	var buf [offsetSize]byte
+	binary.LittleEndian.PutUint64(buf[:], offset)
+	if _, err := f.offsetsCache.Write(buf[:]); err != nil {
+		return err
+	}
+	f.count++
+	return nil
+}
+
+// Get returns the info of the signature at the given index; the info is empty if nothing was stored.
+// If the index is out of bounds, os.ErrNotExist is returned.
+// NOTE: Just-written entries may not be available until the store is flushed.
+func (f *File) Get(index uint64) (Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if index >= f.count {
+		return Info{}, os.ErrNotExist
+	}
+	var buf [offsetSize]byte
+	if _, err := f.offsets.ReadAt(buf[:], int64(index*offsetSize)); err != nil {
+		return Info{}, err
+	}
+	offset := binary.LittleEndian.Uint64(buf[:])
+	if offset == 0 {
+		return Info{HasStatus: f.hasStatus}, nil
+	}
+	info, err := decodeInfo(io.NewSectionReader(f.data, int64(offset), int64(f.dataSize-offset)))
+	if err != nil {
+		return Info{}, err
+	}
+	info.HasStatus = f.hasStatus && !info.StatusUnknown
+	return info, nil
+}
+
+// Flush flushes the caches to disk.
+func (f *File) Flush() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flush()
+}
+
+func (f *File) flush() error {
+	// the data first, so that the flushed offsets always point to flushed data.
+	if err := f.dataCache.Flush(); err != nil {
+		return err
+	}
+	return f.offsetsCache.Flush()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return errors.Join(
+		f.flush(),
+		f.offsets.Close(),
+		f.data.Close(),
+	)
+}
+
+func encodeInfo(info Info) []byte {
+	var flags byte
+	if info.Memo != nil {
+		flags |= flagMemo
+	}
+	if info.Err != nil {
+		flags |= flagErr
+	}
+	if info.StatusUnknown {
+		flags |= flagStatusUnknown
+	}
+	out := []byte{flags}
+	if info.Memo != nil {
+		out = binary.AppendUvarint(out, uint64(len(info.Memo)))
+		out = append(out, info.Memo...)
+	}
+	if info.Err != nil {
+		out = binary.AppendUvarint(out, uint64(len(info.Err)))
+		out = append(out, info.Err...)
+	}
+	return out
+}
+
+func decodeInfo(r io.Reader) (Info, error) {
+	br := bufio.NewReaderSize(r, 64)
+	flags, err := br.ReadByte()
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to read flags: %w", err)
+	}
+	info := Info{
+		StatusUnknown: flags&flagStatusUnknown != 0,
+	}
+	if flags&flagMemo != 0 {
+		info.Memo, err = readField(br)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to read memo: %w", err)
+		}
+	}
+	if flags&flagErr != 0 {
+		info.Err, err = readField(br)
+		if err != nil {
+			return Info{}, fmt.Errorf("failed to read err: %w", err)
+		}
+	}
+	return info, nil
+}
+
+func readField(br *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxFieldSize {
+		return nil, fmt.Errorf("invalid size: %d", size)
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(br, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,98 @@
+package txinfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	offsetsPath := filepath.Join(dir, "tx-info-offsets")
+	dataPath := filepath.Join(dir, "tx-info-data")
+
+	exists, err := Exists(offsetsPath, dataPath)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	f, err := Open(offsetsPath, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), f.NumEntries())
+
+	require.NoError(t, f.Put(0, Info{Memo: []byte("[5] hello")}))
+	require.NoError(t, f.Put(1, Info{}))
+	require.NoError(t, f.Put(2, Info{Memo: []byte{}, Err: []byte(`{"InstructionError":[0,{"Custom":1}]}`)}))
+	require.Error(t, f.Put(4, Info{}), "out of order")
+	require.NoError(t, f.Flush())
+
+	check := func(f *File) {
+		got, err := f.Get(0)
+		require.NoError(t, err)
+		require.Equal(t, []byte("[5] hello"), got.Memo)
+		require.Nil(t, got.Err)
+		require.True(t, got.HasStatus)
+
+		got, err = f.Get(1)
+		require.NoError(t, err)
+		require.True(t, got.IsEmpty())
+		require.True(t, got.HasStatus)
+
+		got, err = f.Get(2)
+		require.NoError(t, err)
+		require.NotNil(t, got.Memo)
+		require.Empty(t, got.Memo)
+		require.Equal(t, `{"InstructionError":[0,{"Custom":1}]}`, string(got.Err))
+
+		_, err = f.Get(3)
+		require.ErrorIs(t, err, os.ErrNotExist)
+	}
+	check(f)
+	require.NoError(t, f.Close())
+
+	// reopen, and append.
+	exists, err = Exists(offsetsPath, dataPath)
+	require.NoError(t, err)
+	require.True(t, exists)
+	f, err = Open(offsetsPath, dataPath)
+	require.NoError(t, err)
+	defer f.Close()
+	require.Equal(t, uint64(3), f.NumEntries())
+	check(f)
+	require.NoError(t, f.Put(3, Info{Memo: []byte("[3] abc")}))
+	require.NoError(t, f.Put(4, Info{StatusUnknown: true}))
+	require.NoError(t, f.Flush())
+	got, err := f.Get(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("[3] abc"), got.Memo)
+	got, err = f.Get(4)
+	require.NoError(t, err)
+	require.True(t, got.StatusUnknown)
+	require.False(t, got.HasStatus)
+}
+
+func TestFileWithoutStatus(t *testing.T) {
+	dir := t.TempDir()
+	offsetsPath := filepath.Join(dir, "tx-info-offsets")
+	dataPath := filepath.Join(dir, "tx-info-data")
+	// a store created before the statuses were added.
+	require.NoError(t, os.WriteFile(dataPath, append([]byte("txi1"), encodeInfo(Info{Memo: []byte("[1] a")})...), 0o644))
+	require.NoError(t, os.WriteFile(offsetsPath, []byte{0, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0}, 0o644))
+
+	f, err := Open(offsetsPath, dataPath)
+	require.NoError(t, err)
+	defer f.Close()
+	require.False(t, f.HasStatus())
+	require.Equal(t, uint64(2), f.NumEntries())
+
+	got, err := f.Get(0)
+	require.NoError(t, err)
+	require.Equal(t, Info{}, got)
+	got, err = f.Get(1)
+	require.NoError(t, err)
+	require.Equal(t, Info{Memo: []byte("[1] a")}, got)
+
+	require.Error(t, f.Put(2, Info{Err: []byte(`"AccountInUse"`)}))
+	require.NoError(t, f.Put(2, Info{Memo: []byte("[1] b")}))
+}
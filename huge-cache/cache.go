@@ -3,7 +3,10 @@ package hugecache
 import (
 	"context"
 	"errors"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/allegro/bigcache/v3"
 	"github.com/ipfs/go-cid"
@@ -12,6 +15,11 @@ import (
 
 type Cache struct {
 	cache *bigcache.BigCache
+
+	// pinned entries are never evicted; they are checked before the bigcache.
+	pinnedMu    sync.RWMutex
+	pinned      map[string][]byte
+	pinnedSlots map[uint64][]string // slot -> keys pinned for that slot
 }
 
 func NewWithConfig(ctx context.Context, config bigcache.Config) (*Cache, error) {
@@ -20,20 +28,39 @@ func NewWithConfig(ctx context.Context, config bigcache.Config) (*Cache, error)
 		return nil, err
 	}
 	return &Cache{
-		cache: cache,
+		cache:       cache,
+		pinned:      make(map[string][]byte),
+		pinnedSlots: make(map[uint64][]string),
 	}, nil
 }
 
+const (
+	prefixRawCarObject  = "rco-"
+	prefixSlotToCid     = "s2c-"
+	prefixOffsetAndSize = "o&s-"
+)
+
 func formatRawCarObjectKey(c cid.Cid) string {
-	return "rco-" + c.String()
+	return prefixRawCarObject + c.String()
 }
 
 func formatSlotToCidKey(slot uint64) string {
-	return "s2c-" + strconv.FormatUint(slot, 10)
+	return prefixSlotToCid + strconv.FormatUint(slot, 10)
 }
 
 func formatOffsetAndSizeKey(c cid.Cid) string {
-	return "o&s-" + c.String()
+	return prefixOffsetAndSize + c.String()
+}
+
+// get returns the value for the given key, looking first at the pinned entries.
+func (r *Cache) get(key string) ([]byte, error) {
+	r.pinnedMu.RLock()
+	v, ok := r.pinned[key]
+	r.pinnedMu.RUnlock()
+	if ok {
+		return v, nil
+	}
+	return r.cache.Get(key)
 }
 
 // PutRawCarObject stores the raw CAR object data.
@@ -43,7 +70,7 @@ func (r *Cache) PutRawCarObject(c cid.Cid, data []byte) error {
 
 // GetRawCarObject returns the raw CAR object data from the cache if it exists.
 func (r *Cache) GetRawCarObject(c cid.Cid) (v []byte, err error, has bool) {
-	if v, err := r.cache.Get(formatRawCarObjectKey(c)); err == nil {
+	if v, err := r.get(formatRawCarObjectKey(c)); err == nil {
 		return v, nil, true
 	} else {
 		if errors.Is(err, bigcache.ErrEntryNotFound) {
@@ -60,7 +87,7 @@ func (r *Cache) PutSlotToCid(slot uint64, c cid.Cid) error {
 
 // GetSlotToCid returns the CID for the given slot if it exists in the cache.
 func (r *Cache) GetSlotToCid(slot uint64) (cid.Cid, error, bool) {
-	if v, err := r.cache.Get(formatSlotToCidKey(slot)); err == nil {
+	if v, err := r.get(formatSlotToCidKey(slot)); err == nil {
 		_, parsed, err := cid.CidFromBytes(v)
 		if err != nil {
 			return cid.Undef, err, false
@@ -85,7 +112,7 @@ func (r *Cache) PutCidToOffsetAndSize(c cid.Cid, oas *indexes.OffsetAndSize) err
 }
 
 func (r *Cache) GetCidToOffsetAndSize(c cid.Cid) (*indexes.OffsetAndSize, error, bool) {
-	if v, err := r.cache.Get(formatOffsetAndSizeKey(c)); err == nil {
+	if v, err := r.get(formatOffsetAndSizeKey(c)); err == nil {
 		var oas indexes.OffsetAndSize
 		if err := oas.FromBytes(v); err != nil {
 			return nil, err, false
@@ -98,3 +125,177 @@ func (r *Cache) GetCidToOffsetAndSize(c cid.Cid) (*indexes.OffsetAndSize, error,
 		return nil, err, false
 	}
 }
+
+// PinSlot pins the slot-to-CID mapping of the given slot, and the provided
+// raw CAR objects (usually the whole block DAG), so that they are never evicted.
+// Pinning a slot that is already pinned replaces the previous pin.
+func (r *Cache) PinSlot(slot uint64, slotCid cid.Cid, objects map[cid.Cid][]byte) {
+	r.pinnedMu.Lock()
+	defer r.pinnedMu.Unlock()
+	r.unpinSlotLocked(slot)
+
+	keys := make([]string, 0, len(objects)+1)
+	{
+		key := formatSlotToCidKey(slot)
+		r.pinned[key] = slotCid.Bytes()
+		keys = append(keys, key)
+	}
+	for c, data := range objects {
+		key := formatRawCarObjectKey(c)
+		r.pinned[key] = data
+		keys = append(keys, key)
+	}
+	r.pinnedSlots[slot] = keys
+}
+
+// UnpinSlot removes the pin for the given slot; it returns false if the slot was not pinned.
+// The entries are not removed from the (evictable) cache.
+func (r *Cache) UnpinSlot(slot uint64) bool {
+	r.pinnedMu.Lock()
+	defer r.pinnedMu.Unlock()
+	return r.unpinSlotLocked(slot)
+}
+
+func (r *Cache) unpinSlotLocked(slot uint64) bool {
+	keys, ok := r.pinnedSlots[slot]
+	if !ok {
+		return false
+	}
+	delete(r.pinnedSlots, slot)
+	for _, key := range keys {
+		if !r.isPinnedByOtherSlotLocked(key) {
+			delete(r.pinned, key)
+		}
+	}
+	return true
+}
+
+func (r *Cache) isPinnedByOtherSlotLocked(key string) bool {
+	for _, keys := range r.pinnedSlots {
+		for _, k := range keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PinnedSlots returns the list of pinned slots, sorted in ascending order.
+func (r *Cache) PinnedSlots() []uint64 {
+	r.pinnedMu.RLock()
+	defer r.pinnedMu.RUnlock()
+	slots := make([]uint64, 0, len(r.pinnedSlots))
+	for slot := range r.pinnedSlots {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i] < slots[j]
+	})
+	return slots
+}
+
+// InvalidateSlot removes the slot-to-CID mapping for the given slot (including any pin).
+func (r *Cache) InvalidateSlot(slot uint64) int {
+	r.UnpinSlot(slot)
+	return r.deleteKeys(formatSlotToCidKey(slot))
+}
+
+// InvalidateCid removes the raw object and the offset-and-size entries for the given CID.
+// A pinned raw object is removed too (the slots it was pinned for stay pinned, without it).
+func (r *Cache) InvalidateCid(c cid.Cid) int {
+	key := formatRawCarObjectKey(c)
+	r.pinnedMu.Lock()
+	_, wasPinned := r.pinned[key]
+	delete(r.pinned, key)
+	r.pinnedMu.Unlock()
+	deleted := r.deleteKeys(formatOffsetAndSizeKey(c))
+	if r.deleteKeys(key) > 0 || wasPinned {
+		deleted++
+	}
+	return deleted
+}
+
+// InvalidateSlotRange removes every cached entry that might be stale after the
+// CAR (and indexes) for the given slot range have been replaced:
+// the slot-to-CID mappings for the slots in the range (including pins),
+// and all the offset-and-size entries (which depend on the layout of the CAR file).
+// Raw objects are content-addressed and are only removed if they were pinned for a slot in the range.
+func (r *Cache) InvalidateSlotRange(first, last uint64) int {
+	for _, slot := range r.PinnedSlots() {
+		if slot >= first && slot <= last {
+			r.UnpinSlot(slot)
+		}
+	}
+	toDelete := make([]string, 0)
+	iter := r.cache.Iterator()
+	for iter.SetNext() {
+		entry, err := iter.Value()
+		if err != nil {
+			continue
+		}
+		key := entry.Key()
+		switch {
+		case strings.HasPrefix(key, prefixOffsetAndSize):
+			toDelete = append(toDelete, key)
+		case strings.HasPrefix(key, prefixSlotToCid):
+			slot, err := strconv.ParseUint(strings.TrimPrefix(key, prefixSlotToCid), 10, 64)
+			if err == nil && slot >= first && slot <= last {
+				toDelete = append(toDelete, key)
+			}
+		}
+	}
+	return r.deleteKeys(toDelete...)
+}
+
+// Reset removes all the entries from the cache, including the pinned ones.
+func (r *Cache) Reset() error {
+	r.pinnedMu.Lock()
+	r.pinned = make(map[string][]byte)
+	r.pinnedSlots = make(map[uint64][]string)
+	r.pinnedMu.Unlock()
+	return r.cache.Reset()
+}
+
+// deleteKeys deletes the given keys from the cache, and returns how many were actually deleted.
+func (r *Cache) deleteKeys(keys ...string) int {
+	deleted := 0
+	for _, key := range keys {
+		if err := r.cache.Delete(key); err == nil {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Stats contains information about the occupancy and efficiency of the cache.
+type Stats struct {
+	Entries       int   `json:"entries"`
+	CapacityBytes int   `json:"capacityBytes"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Collisions    int64 `json:"collisions"`
+	PinnedSlots   int   `json:"pinnedSlots"`
+	PinnedEntries int   `json:"pinnedEntries"`
+	PinnedBytes   int   `json:"pinnedBytes"`
+}
+
+// Stats returns the current stats of the cache.
+func (r *Cache) Stats() Stats {
+	bs := r.cache.Stats()
+	stats := Stats{
+		Entries:       r.cache.Len(),
+		CapacityBytes: r.cache.Capacity(),
+		Hits:          bs.Hits,
+		Misses:        bs.Misses,
+		Collisions:    bs.Collisions,
+	}
+	r.pinnedMu.RLock()
+	defer r.pinnedMu.RUnlock()
+	stats.PinnedSlots = len(r.pinnedSlots)
+	stats.PinnedEntries = len(r.pinned)
+	for _, v := range r.pinned {
+		stats.PinnedBytes += len(v)
+	}
+	return stats
+}
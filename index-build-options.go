@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+)
+
+// indexBuildOptions are the formats of the indexes built with a context; the zero value is
+// the default formats.
+type indexBuildOptions struct {
+	SigToCidFormat      indexes.Format
+	SlotToCidFormat     indexes.Format
+	CidToOffsetEncoding indexes.ValueEncoding
+}
+
+type indexBuildOptionsKeyType struct{}
+
+var indexBuildOptionsKey indexBuildOptionsKeyType
+
+// withIndexBuildOptions returns a context whose index builds use the given formats.
+func withIndexBuildOptions(ctx context.Context, options indexBuildOptions) context.Context {
+	return context.WithValue(ctx, indexBuildOptionsKey, options)
+}
+
+// indexBuildOptionsOf returns the formats of the indexes built with the context.
+func indexBuildOptionsOf(ctx context.Context) indexBuildOptions {
+	options, _ := ctx.Value(indexBuildOptionsKey).(indexBuildOptions)
+	if options.SigToCidFormat == "" {
+		options.SigToCidFormat = indexes.FormatCompact
+	}
+	if options.SlotToCidFormat == "" {
+		options.SlotToCidFormat = indexes.FormatCompact
+	}
+	if options.CidToOffsetEncoding == "" {
+		options.CidToOffsetEncoding = indexes.ValueEncodingPlain
+	}
+	return options
+}
+
+// newSigToCidFormatFlag returns the flag of the format of the sig-to-cid index.
+func newSigToCidFormatFlag(format *indexes.Format) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "sig-to-cid-format",
+		Usage: "the format of the sig-to-cid index: compact (a 3-byte hash per signature), or mph (a minimal perfect hash, ~3 bits per signature, and a 2-byte fingerprint); the format is detected when the index is opened",
+		Value: string(indexes.FormatCompact),
+		Action: func(c *cli.Context, s string) error {
+			*format = indexes.Format(s)
+			if !indexes.IsValidFormat(*format) {
+				return fmt.Errorf("invalid sig-to-cid index format: %q", s)
+			}
+			return nil
+		},
+	}
+}
+
+// newSlotToCidFormatFlag returns the flag (with the given name) of the format of the slot-to-cid index.
+func newSlotToCidFormatFlag(name string, format *indexes.Format) cli.Flag {
+	return &cli.StringFlag{
+		Name:  name,
+		Usage: "the format of the slot-to-cid index: compact (a 3-byte hash per slot), or ranged (the runs of consecutive slots and the CIDs in order of slot, without their common prefix; smaller, and supports iterating over ranges of slots); the format is detected when the index is opened",
+		Value: string(indexes.FormatCompact),
+		Action: func(c *cli.Context, s string) error {
+			*format = indexes.Format(s)
+			if !indexes.IsValidFormat_SlotToCid(*format) {
+				return fmt.Errorf("invalid slot-to-cid index format: %q", s)
+			}
+			return nil
+		},
+	}
+}
+
+// newCidToOffsetEncodingFlag returns the flag of the encoding of the values of the
+// cid-to-offset-and-size index.
+func newCidToOffsetEncodingFlag(encoding *indexes.ValueEncoding) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "cid-to-offset-encoding",
+		Usage: "the encoding of the offsets and sizes of the cid-to-offset-and-size index: plain (9 bytes each), or packed (bit-packed differences to the minimum of their bucket, ~7 bytes for a CAR of 100 GB); the encoding is read from the index when it's opened",
+		Value: string(indexes.ValueEncodingPlain),
+		Action: func(c *cli.Context, s string) error {
+			*encoding = indexes.ValueEncoding(s)
+			if !indexes.IsValidValueEncoding(*encoding) {
+				return fmt.Errorf("invalid cid-to-offset encoding: %q", s)
+			}
+			return nil
+		},
+	}
+}
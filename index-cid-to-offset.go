@@ -18,6 +18,7 @@ import (
 	carv2 "github.com/ipld/go-car/v2"
 	"github.com/rpcpool/yellowstone-faithful/indexes"
 	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/progress"
 	"k8s.io/klog/v2"
 )
 
@@ -29,7 +30,7 @@ func CreateIndex_cid2offset(
 	tmpDir string,
 	carPath string,
 	indexDir string,
-) (string, error) {
+) (_ string, retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -66,6 +67,13 @@ func CreateIndex_cid2offset(
 		return "", fmt.Errorf("failed to count items in car file: %w", err)
 	}
 	klog.Infof("Found %s items in car file", humanize.Comma(int64(numItems)))
+	if err := checkIndexResources(
+		estimateCompactIndex(numItems, preflightCidSize, indexes.IndexValueSize_CidToOffsetAndSize),
+		tmpDir,
+		indexDir,
+	); err != nil {
+		return "", err
+	}
 
 	tmpDir = filepath.Join(tmpDir, "index-cid-to-offset-"+time.Now().Format("20060102-150405.000000000"))
 	if err = os.MkdirAll(tmpDir, 0o755); err != nil {
@@ -75,12 +83,13 @@ func CreateIndex_cid2offset(
 	rootCid := rd.header.Roots[0]
 
 	klog.Infof("Creating builder with %d items and target file size %d", numItems, targetFileSize)
-	c2o, err := indexes.NewWriter_CidToOffsetAndSize(
+	c2o, err := indexes.NewWriterWithEncoding_CidToOffsetAndSize(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems,
+		indexBuildOptionsOf(ctx).CidToOffsetEncoding,
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to open index store: %w", err)
@@ -95,6 +104,9 @@ func CreateIndex_cid2offset(
 		totalOffset = uint64(buf.Len())
 	}
 	numItemsIndexed := uint64(0)
+	task := progress.Start("index cid-to-offset")
+	task.SetTotal(numItems, 0)
+	defer func() { task.Done(retErr) }()
 	klog.Infof("Indexing...")
 	for {
 		c, sectionLength, err := rd.NextInfo()
@@ -115,9 +127,7 @@ func CreateIndex_cid2offset(
 		totalOffset += sectionLength
 
 		numItemsIndexed++
-		if numItemsIndexed%100_000 == 0 {
-			printToStderr(".")
-		}
+		task.Add(1, 0)
 	}
 
 	klog.Infof("Sealing index...")
@@ -132,7 +142,7 @@ func CreateIndex_cid2offset(
 // VerifyIndex_cid2offset verifies that the index file is correct for the given car file.
 // It does this by reading the car file and comparing the offsets in the index
 // file to the offsets in the car file.
-func VerifyIndex_cid2offset(ctx context.Context, carPath string, indexFilePath string) error {
+func VerifyIndex_cid2offset(ctx context.Context, carPath string, indexFilePath string) (retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -208,6 +218,8 @@ func VerifyIndex_cid2offset(ctx context.Context, carPath string, indexFilePath s
 
 	startedAt := time.Now()
 	numItems := 0
+	task := progress.Start("verify index cid-to-offset")
+	defer func() { task.Done(retErr) }()
 	defer func() {
 		klog.Infof("Finished in %s", time.Since(startedAt))
 		klog.Infof("Read %d nodes", numItems)
@@ -228,9 +240,7 @@ func VerifyIndex_cid2offset(ctx context.Context, carPath string, indexFilePath s
 			break
 		}
 		numItems++
-		if numItems%100000 == 0 {
-			printToStderr(".")
-		}
+		task.Add(1, 0)
 		offset, err := c2o.Get(c)
 		if err != nil {
 			return fmt.Errorf("failed to lookup offset for %s: %w", c, err)
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"k8s.io/klog/v2"
+)
+
+// FleetManifest lists the CARs to index with `index fleet`.
+type FleetManifest struct {
+	Cars []FleetCar `json:"cars" yaml:"cars"`
+}
+
+// FleetCar is a CAR to index.
+type FleetCar struct {
+	Path string `json:"path" yaml:"path"`
+	// IndexDir overrides the index dir of the command for this CAR.
+	IndexDir string `json:"index_dir,omitempty" yaml:"index_dir,omitempty"`
+	// Network overrides the network of the command for this CAR.
+	Network indexes.Network `json:"network,omitempty" yaml:"network,omitempty"`
+	// Priority orders the builds: the CARs with a higher priority are indexed first.
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// loadFleetManifest loads the CARs to index from a manifest file (JSON or YAML), or from a
+// directory (all the CAR files in it, compressed or not, by name).
+func loadFleetManifest(path string) (*FleetManifest, error) {
+	isDir, err := isDirectory(path)
+	if err != nil {
+		return nil, err
+	}
+	if isDir {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var manifest FleetManifest
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !(strings.HasSuffix(name, ".car") || isZstdCarPath(name) && strings.Contains(name, ".car.")) {
+				continue
+			}
+			manifest.Cars = append(manifest.Cars, FleetCar{Path: filepath.Join(path, name)})
+		}
+		if len(manifest.Cars) == 0 {
+			return nil, fmt.Errorf("no CAR files in %q", path)
+		}
+		return &manifest, nil
+	}
+	var manifest FleetManifest
+	if isJSONFile(path) {
+		err = loadFromJSON(path, &manifest)
+	} else if isYAMLFile(path) {
+		err = loadFromYAML(path, &manifest)
+	} else {
+		return nil, fmt.Errorf("manifest %q must be a directory, or a JSON or YAML file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load manifest %q: %w", path, err)
+	}
+	if len(manifest.Cars) == 0 {
+		return nil, fmt.Errorf("no CARs in manifest %q", path)
+	}
+	for i, car := range manifest.Cars {
+		if car.Path == "" {
+			return nil, fmt.Errorf("manifest %q: cars[%d] has no path", path, i)
+		}
+		if car.Network != "" && !indexes.IsValidNetwork(car.Network) {
+			return nil, fmt.Errorf("manifest %q: cars[%d] has an invalid network: %q", path, i, car.Network)
+		}
+	}
+	return &manifest, nil
+}
+
+// memoryBudget limits the memory used by the concurrent index builds.
+type memoryBudget struct {
+	sem  *semaphore.Weighted
+	size int64
+}
+
+func newMemoryBudget(size uint64) *memoryBudget {
+	return &memoryBudget{
+		sem:  semaphore.NewWeighted(int64(size)),
+		size: int64(size),
+	}
+}
+
+// reserve waits until the given memory is available in the budget, and returns the function that
+// releases it; a build that needs more than the whole budget waits until it runs alone.
+func (b *memoryBudget) reserve(ctx context.Context, bytes uint64) (func(), error) {
+	n := min(int64(bytes), b.size)
+	if n <= 0 {
+		return func() {}, nil
+	}
+	if err := b.sem.Acquire(ctx, n); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() { once.Do(func() { b.sem.Release(n) }) }, nil
+}
+
+type memoryBudgetKeyType struct{}
+
+var memoryBudgetKey memoryBudgetKeyType
+
+// withMemoryBudget returns a context whose index builds share the given memory budget.
+func withMemoryBudget(ctx context.Context, budget *memoryBudget) context.Context {
+	return context.WithValue(ctx, memoryBudgetKey, budget)
+}
+
+// reserveIndexMemory reserves the estimated memory of an index build in the memory budget
+// of the context, if any.
+func reserveIndexMemory(ctx context.Context, bytes uint64) (func(), error) {
+	budget, ok := ctx.Value(memoryBudgetKey).(*memoryBudget)
+	if !ok || budget == nil {
+		return func() {}, nil
+	}
+	return budget.reserve(ctx, bytes)
+}
+
+// FleetJobState is the state of the indexing of a CAR of the fleet.
+type FleetJobState string
+
+const (
+	FleetJobPending FleetJobState = "pending"
+	FleetJobRunning FleetJobState = "running"
+	FleetJobDone    FleetJobState = "done"
+	FleetJobFailed  FleetJobState = "failed"
+	// FleetJobSkipped is a CAR indexed by a previous run (according to its report).
+	FleetJobSkipped FleetJobState = "skipped"
+)
+
+// FleetJob is the indexing of a CAR of the fleet, as reported.
+type FleetJob struct {
+	Car             string        `json:"car"`
+	IndexDir        string        `json:"indexDir"`
+	Network         string        `json:"network"`
+	Priority        int           `json:"priority"`
+	State           FleetJobState `json:"state"`
+	Attempts        int           `json:"attempts"`
+	Items           uint64        `json:"items,omitempty"`
+	DurationSeconds float64       `json:"durationSeconds,omitempty"`
+	Error           string        `json:"error,omitempty"`
+	Indexes         *IndexPaths   `json:"indexes,omitempty"`
+}
+
+// FleetReport is the consolidated report of `index fleet`, updated as the builds finish.
+type FleetReport struct {
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Done       int         `json:"done"`
+	Failed     int         `json:"failed"`
+	Skipped    int         `json:"skipped"`
+	Jobs       []*FleetJob `json:"jobs"`
+}
+
+// fleetBuildFunc builds all the indexes of a CAR in the given dir.
+type fleetBuildFunc func(ctx context.Context, job *FleetJob, indexDir string) (*IndexPaths, uint64, error)
+
+// Fleet indexes many CARs concurrently.
+type Fleet struct {
+	Concurrency int
+	// MemoryBudget is the total estimated memory of the concurrent builds (0 for no limit).
+	MemoryBudget uint64
+	// Retries is the number of times a failed build is retried.
+	Retries    int
+	RetryDelay time.Duration
+	// ReportPath is where the report is written (and read from, to skip the CARs already indexed).
+	ReportPath string
+	build      fleetBuildFunc
+
+	mu     sync.Mutex
+	report FleetReport
+}
+
+// newFleetJobs makes the jobs of the manifest, in the order they are started:
+// by decreasing priority, then in the order of the manifest.
+func newFleetJobs(manifest *FleetManifest, indexDir string, network indexes.Network) []*FleetJob {
+	jobs := make([]*FleetJob, 0, len(manifest.Cars))
+	for _, car := range manifest.Cars {
+		job := &FleetJob{
+			Car:      car.Path,
+			IndexDir: car.IndexDir,
+			Network:  string(car.Network),
+			Priority: car.Priority,
+			State:    FleetJobPending,
+		}
+		if job.IndexDir == "" {
+			job.IndexDir = indexDir
+		}
+		if job.Network == "" {
+			job.Network = string(network)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Priority > jobs[j].Priority
+	})
+	return jobs
+}
+
+// skipIndexed marks as skipped the jobs that the previous report has as done,
+// if their index files still exist.
+func (f *Fleet) skipIndexed(jobs []*FleetJob) error {
+	if f.ReportPath == "" {
+		return nil
+	}
+	var previous FleetReport
+	buf, err := os.ReadFile(f.ReportPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(buf, &previous); err != nil {
+		return fmt.Errorf("failed to parse the previous report %q: %w", f.ReportPath, err)
+	}
+	indexed := make(map[string]*FleetJob)
+	for _, job := range previous.Jobs {
+		if (job.State == FleetJobDone || job.State == FleetJobSkipped) && job.Indexes != nil {
+			indexed[job.Car] = job
+		}
+	}
+	for _, job := range jobs {
+		prev, ok := indexed[job.Car]
+		if !ok || prev.IndexDir != job.IndexDir || !indexFilesExist(prev.Indexes) {
+			continue
+		}
+		job.State = FleetJobSkipped
+		job.Items = prev.Items
+		job.Indexes = prev.Indexes
+	}
+	return nil
+}
+
+func indexFilesExist(paths *IndexPaths) bool {
+	for _, path := range []string{paths.CidToOffsetAndSize, paths.SlotToCid, paths.SignatureToCid, paths.SignatureExists} {
+		if ok, err := fileExists(path); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Run indexes the CARs of the jobs, and returns the report; it returns an error only if the
+// fleet couldn't run (the failed builds are in the report).
+func (f *Fleet) Run(ctx context.Context, jobs []*FleetJob) (*FleetReport, error) {
+	f.report = FleetReport{
+		StartedAt: time.Now(),
+		Jobs:      jobs,
+	}
+	if err := f.skipIndexed(jobs); err != nil {
+		return nil, err
+	}
+	if f.MemoryBudget > 0 {
+		ctx = withMemoryBudget(ctx, newMemoryBudget(f.MemoryBudget))
+	}
+	task := progress.Start("index fleet")
+	task.SetTotal(uint64(len(jobs)), 0)
+	defer func() { task.Done(nil) }()
+
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(max(1, f.Concurrency))
+	for _, job := range jobs {
+		if job.State == FleetJobSkipped {
+			klog.Infof("fleet: %s was already indexed, skipping", job.Car)
+			f.finished(job)
+			task.Add(1, 0)
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		job := job
+		group.Go(func() error {
+			f.runJob(ctx, job)
+			f.finished(job)
+			task.Add(1, 0)
+			return nil
+		})
+	}
+	group.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	finishedAt := time.Now()
+	f.report.FinishedAt = &finishedAt
+	if err := f.writeReport(); err != nil {
+		return nil, err
+	}
+	report := f.report
+	return &report, nil
+}
+
+// runJob builds the indexes of a CAR, retrying on failure; each attempt builds the indexes in
+// a staging dir, whose files are moved to the index dir once complete.
+func (f *Fleet) runJob(ctx context.Context, job *FleetJob) {
+	f.mu.Lock()
+	job.State = FleetJobRunning
+	f.mu.Unlock()
+	startedAt := time.Now()
+	var err error
+	for attempt := 1; attempt <= f.Retries+1; attempt++ {
+		if attempt > 1 {
+			klog.Warningf("fleet: retrying %s (attempt %d/%d) in %s", job.Car, attempt, f.Retries+1, f.RetryDelay)
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-time.After(f.RetryDelay):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		f.mu.Lock()
+		job.Attempts = attempt
+		f.mu.Unlock()
+		var paths *IndexPaths
+		var numItems uint64
+		paths, numItems, err = f.attempt(ctx, job, attempt)
+		if err == nil {
+			f.mu.Lock()
+			job.State = FleetJobDone
+			job.Items = numItems
+			job.Indexes = paths
+			job.Error = ""
+			job.DurationSeconds = time.Since(startedAt).Seconds()
+			f.mu.Unlock()
+			klog.Infof("fleet: indexed %s in %s", job.Car, time.Since(startedAt).Truncate(time.Second))
+			return
+		}
+		klog.Errorf("fleet: failed to index %s (attempt %d/%d): %s", job.Car, attempt, f.Retries+1, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	f.mu.Lock()
+	job.State = FleetJobFailed
+	job.Error = err.Error()
+	job.DurationSeconds = time.Since(startedAt).Seconds()
+	f.mu.Unlock()
+}
+
+func (f *Fleet) attempt(ctx context.Context, job *FleetJob, attempt int) (*IndexPaths, uint64, error) {
+	if err := os.MkdirAll(job.IndexDir, 0o755); err != nil {
+		return nil, 0, err
+	}
+	stagingDir, err := os.MkdirTemp(job.IndexDir, fmt.Sprintf(".fleet-%s-%d-", fleetJobName(job.Car), attempt))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create staging dir: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+	paths, numItems, err := f.build(ctx, job, stagingDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	final := &IndexPaths{}
+	for _, move := range []struct {
+		src string
+		dst *string
+	}{
+		{paths.CidToOffsetAndSize, &final.CidToOffsetAndSize},
+		{paths.SlotToCid, &final.SlotToCid},
+		{paths.SignatureToCid, &final.SignatureToCid},
+		{paths.SignatureExists, &final.SignatureExists},
+	} {
+		*move.dst = filepath.Join(job.IndexDir, filepath.Base(move.src))
+		if err := os.Rename(move.src, *move.dst); err != nil {
+			return nil, 0, fmt.Errorf("failed to move index file to the index dir: %w", err)
+		}
+	}
+	return final, numItems, nil
+}
+
+// fleetJobName returns the name of the CAR file without its extensions.
+func fleetJobName(carPath string) string {
+	name := filepath.Base(carPath)
+	if i := strings.Index(name, ".car"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// finished counts the finished job, and updates the report file.
+func (f *Fleet) finished(job *FleetJob) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch job.State {
+	case FleetJobDone:
+		f.report.Done++
+	case FleetJobFailed:
+		f.report.Failed++
+	case FleetJobSkipped:
+		f.report.Skipped++
+	}
+	if err := f.writeReport(); err != nil {
+		klog.Errorf("fleet: failed to write the report: %s", err)
+	}
+}
+
+// writeReport writes the report atomically; f.mu must be held.
+func (f *Fleet) writeReport() error {
+	if f.ReportPath == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(f.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.ReportPath), filepath.Base(f.ReportPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.ReportPath)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFleetManifest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"epoch-1.car", "epoch-0.car.zst", "notes.txt", "epoch-2.car.seektable"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	manifest, err := loadFleetManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, []FleetCar{
+		{Path: filepath.Join(dir, "epoch-0.car.zst")},
+		{Path: filepath.Join(dir, "epoch-1.car")},
+	}, manifest.Cars)
+
+	manifestPath := filepath.Join(t.TempDir(), "fleet.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`
+cars:
+  - path: /data/epoch-1.car
+  - path: /data/epoch-2.car
+    priority: 10
+    network: devnet
+    index_dir: /indexes/devnet
+`), 0o644))
+	manifest, err = loadFleetManifest(manifestPath)
+	require.NoError(t, err)
+	jobs := newFleetJobs(manifest, "/indexes", indexes.NetworkMainnet)
+	require.Len(t, jobs, 2)
+	// the higher priority first.
+	require.Equal(t, "/data/epoch-2.car", jobs[0].Car)
+	require.Equal(t, "/indexes/devnet", jobs[0].IndexDir)
+	require.Equal(t, "devnet", jobs[0].Network)
+	require.Equal(t, "/data/epoch-1.car", jobs[1].Car)
+	require.Equal(t, "/indexes", jobs[1].IndexDir)
+	require.Equal(t, "mainnet", jobs[1].Network)
+
+	require.NoError(t, os.WriteFile(manifestPath, []byte("cars:\n  - network: devnet\n"), 0o644))
+	_, err = loadFleetManifest(manifestPath)
+	require.ErrorContains(t, err, "has no path")
+}
+
+func TestMemoryBudget(t *testing.T) {
+	budget := newMemoryBudget(100)
+	ctx := withMemoryBudget(context.Background(), budget)
+
+	release, err := reserveIndexMemory(ctx, 60)
+	require.NoError(t, err)
+	// 60 + 60 doesn't fit.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = reserveIndexMemory(timeoutCtx, 60)
+	cancel()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	release()
+	// releasing twice is a no-op.
+	release()
+
+	// more than the whole budget runs alone.
+	release, err = reserveIndexMemory(ctx, 1000)
+	require.NoError(t, err)
+	release()
+
+	// no budget in the context.
+	release, err = reserveIndexMemory(context.Background(), 1000)
+	require.NoError(t, err)
+	release()
+}
+
+func TestFleetRun(t *testing.T) {
+	indexDir := t.TempDir()
+	manifest := &FleetManifest{Cars: []FleetCar{
+		{Path: "/data/epoch-1.car"},
+		{Path: "/data/epoch-2.car", Priority: 1},
+		{Path: "/data/epoch-3.car"},
+	}}
+	var mu sync.Mutex
+	var started []string
+	attempts := make(map[string]int)
+	build := func(ctx context.Context, job *FleetJob, dir string) (*IndexPaths, uint64, error) {
+		mu.Lock()
+		started = append(started, job.Car)
+		attempts[job.Car]++
+		attempt := attempts[job.Car]
+		mu.Unlock()
+		name := fleetJobName(job.Car)
+		switch {
+		case name == "epoch-3":
+			return nil, 0, errors.New("corrupted CAR")
+		case name == "epoch-1" && attempt == 1:
+			return nil, 0, errors.New("transient failure")
+		}
+		paths := &IndexPaths{
+			CidToOffsetAndSize: filepath.Join(dir, name+"-cid-to-offset-and-size.index"),
+			SlotToCid:          filepath.Join(dir, name+"-slot-to-cid.index"),
+			SignatureToCid:     filepath.Join(dir, name+"-sig-to-cid.index"),
+			SignatureExists:    filepath.Join(dir, name+"-sig-exists.index"),
+		}
+		for _, path := range []string{paths.CidToOffsetAndSize, paths.SlotToCid, paths.SignatureToCid, paths.SignatureExists} {
+			require.NoError(t, os.WriteFile(path, []byte("index"), 0o644))
+		}
+		return paths, 42, nil
+	}
+	newFleet := func() *Fleet {
+		return &Fleet{
+			Concurrency: 1,
+			Retries:     1,
+			ReportPath:  filepath.Join(indexDir, "fleet-report.json"),
+			build:       build,
+		}
+	}
+
+	report, err := newFleet().Run(context.Background(), newFleetJobs(manifest, indexDir, indexes.NetworkMainnet))
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Done)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, []string{
+		"/data/epoch-2.car",
+		"/data/epoch-1.car", "/data/epoch-1.car",
+		"/data/epoch-3.car", "/data/epoch-3.car",
+	}, started)
+	byCar := make(map[string]*FleetJob)
+	for _, job := range report.Jobs {
+		byCar[job.Car] = job
+	}
+	require.Equal(t, FleetJobDone, byCar["/data/epoch-1.car"].State)
+	require.Equal(t, 2, byCar["/data/epoch-1.car"].Attempts)
+	require.Equal(t, uint64(42), byCar["/data/epoch-1.car"].Items)
+	// the index files were moved from the staging dir to the index dir.
+	require.Equal(t, filepath.Join(indexDir, "epoch-1-slot-to-cid.index"), byCar["/data/epoch-1.car"].Indexes.SlotToCid)
+	require.FileExists(t, byCar["/data/epoch-1.car"].Indexes.SlotToCid)
+	require.Equal(t, FleetJobFailed, byCar["/data/epoch-3.car"].State)
+	require.Equal(t, "corrupted CAR", byCar["/data/epoch-3.car"].Error)
+	entries, err := os.ReadDir(indexDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, entry.IsDir(), "staging dir %s was not removed", entry.Name())
+	}
+
+	// a new run skips the CARs already indexed.
+	started = nil
+	report, err = newFleet().Run(context.Background(), newFleetJobs(manifest, indexDir, indexes.NetworkMainnet))
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Skipped)
+	require.Equal(t, 1, report.Failed)
+	require.Equal(t, []string{"/data/epoch-3.car", "/data/epoch-3.car"}, started)
+}
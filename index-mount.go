@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/mphindex"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"k8s.io/klog/v2"
+)
+
+// IndexMode is how the index files of an epoch are accessed.
+type IndexMode string
+
+const (
+	// IndexModeRemote reads the remote index files with HTTP range requests.
+	IndexModeRemote IndexMode = "remote"
+	// IndexModeDownload downloads the remote index files to the local directory, and mmaps them.
+	IndexModeDownload IndexMode = "download"
+	// IndexModeMmap mmaps the index files from a local path (e.g. a network filesystem mount).
+	IndexModeMmap IndexMode = "mmap"
+	// IndexModePinned reads the remote index files with HTTP range requests, except for
+	// their hot region (header and bucket table, read by every lookup), which is kept in memory.
+	IndexModePinned IndexMode = "pinned"
+)
+
+func (m IndexMode) IsValid() bool {
+	switch m {
+	case IndexModeRemote, IndexModeDownload, IndexModeMmap, IndexModePinned:
+		return true
+	default:
+		return false
+	}
+}
+
+// indexModeFor returns the mode to use for the given index URI: the configured one,
+// or the default one for the kind of URI.
+func indexModeFor(configured IndexMode, uri URI) IndexMode {
+	if uri.IsLocal() {
+		return IndexModeMmap
+	}
+	if configured == "" || configured == IndexModeMmap {
+		return IndexModeRemote
+	}
+	return configured
+}
+
+// indexMount is an index file, accessed according to its mode; the mode can be changed
+// while the index is being used (the readers built on top of it are not affected).
+type indexMount struct {
+	name     string
+	uri      URI
+	localDir string
+
+	mu        sync.RWMutex
+	mode      IndexMode
+	reader    ReaderAtCloser
+	switching IndexMode // the mode being switched to, if any.
+	lastErr   error
+	closed    bool
+}
+
+// IndexMountStatus describes an index mount, for the admin API.
+type IndexMountStatus struct {
+	Name      string    `json:"name"`
+	URI       string    `json:"uri"`
+	Mode      IndexMode `json:"mode"`
+	Switching IndexMode `json:"switching,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+func newIndexMount(ctx context.Context, name string, uri URI, mode IndexMode, localDir string) (*indexMount, error) {
+	m := &indexMount{
+		name:     name,
+		uri:      uri,
+		localDir: localDir,
+	}
+	mode = indexModeFor(mode, uri)
+	reader, err := m.open(ctx, mode)
+	if err != nil {
+		return nil, err
+	}
+	m.mode = mode
+	m.reader = reader
+	return m, nil
+}
+
+func (m *indexMount) ReadAt(p []byte, off int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return 0, fmt.Errorf("index %s is closed", m.name)
+	}
+	return m.reader.ReadAt(p, off)
+}
+
+func (m *indexMount) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	return m.reader.Close()
+}
+
+func (m *indexMount) Mode() IndexMode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mode
+}
+
+func (m *indexMount) Status() IndexMountStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := IndexMountStatus{
+		Name:      m.name,
+		URI:       m.uri.String(),
+		Mode:      m.mode,
+		Switching: m.switching,
+	}
+	if m.lastErr != nil {
+		status.LastError = m.lastErr.Error()
+	}
+	return status
+}
+
+// SetMode opens the index file in the given mode (which can take a while, e.g. to download it),
+// then swaps it in; the index keeps being served in the previous mode in the meantime.
+func (m *indexMount) SetMode(ctx context.Context, mode IndexMode) error {
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid index mode %q", mode)
+	}
+	if m.uri.IsLocal() != (mode == IndexModeMmap) {
+		return fmt.Errorf("index %s is at %q, and can't be accessed in %s mode", m.name, m.uri, mode)
+	}
+	m.mu.Lock()
+	if m.switching != "" {
+		m.mu.Unlock()
+		return fmt.Errorf("index %s is already switching to %s mode", m.name, m.switching)
+	}
+	if m.mode == mode {
+		m.mu.Unlock()
+		return nil
+	}
+	m.switching = mode
+	m.mu.Unlock()
+
+	reader, err := m.open(ctx, mode)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.switching = ""
+	m.lastErr = err
+	if err != nil {
+		return err
+	}
+	if m.closed {
+		return reader.Close()
+	}
+	// the reads in progress hold the read lock, so nothing is using the old reader anymore.
+	old := m.reader
+	m.reader = reader
+	m.mode = mode
+	klog.Infof("index %s (%s) is now accessed in %s mode", m.name, m.uri, mode)
+	return old.Close()
+}
+
+func (m *indexMount) open(ctx context.Context, mode IndexMode) (ReaderAtCloser, error) {
+	switch mode {
+	case IndexModeMmap, IndexModeRemote:
+		return openIndexStorage(ctx, m.uri.String())
+	case IndexModeDownload:
+		path, err := m.download(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return openIndexStorage(ctx, path)
+	case IndexModePinned:
+		remote, err := openIndexStorage(ctx, m.uri.String())
+		if err != nil {
+			return nil, err
+		}
+		pinned, err := newPinnedReaderAt(remote)
+		if err != nil {
+			remote.Close()
+			return nil, fmt.Errorf("failed to pin the hot region of index %s: %w", m.name, err)
+		}
+		return pinned, nil
+	default:
+		return nil, fmt.Errorf("invalid index mode %q", mode)
+	}
+}
+
+// localPath returns where the remote index file is downloaded.
+func (m *indexMount) localPath() string {
+	sum := sha256.Sum256([]byte(m.uri.String()))
+	return filepath.Join(m.localDir, hex.EncodeToString(sum[:8])+"-"+filepath.Base(m.uri.String()))
+}
+
+// download downloads the remote index file to the local directory (unless it's already there),
+// and returns its path.
+func (m *indexMount) download(ctx context.Context) (string, error) {
+	if m.localDir == "" {
+		return "", fmt.Errorf("indexes.local_dir must be set to download index %s", m.name)
+	}
+	remoteSize, err := splitcarfetcher.GetContentSizeWithHeadOrZeroRange(m.uri.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to get the size of %q: %w", m.uri, err)
+	}
+	path := m.localPath()
+	if stat, err := os.Stat(path); err == nil && stat.Size() == remoteSize {
+		klog.Infof("index %s: using the downloaded copy at %q", m.name, path)
+		touchArtifact(path)
+		return path, nil
+	}
+	if err := os.MkdirAll(m.localDir, 0o755); err != nil {
+		return "", err
+	}
+	startedAt := time.Now()
+	klog.Infof("index %s: downloading %q to %q", m.name, m.uri, path)
+	if err := downloadFile(ctx, m.uri.String(), path, remoteSize); err != nil {
+		return "", fmt.Errorf("failed to download %q: %w", m.uri, err)
+	}
+	klog.Infof("index %s: downloaded %d bytes in %s", m.name, remoteSize, time.Since(startedAt))
+	return path, nil
+}
+
+// downloadFile downloads the file at the given URL to the given path; the file appears
+// at the path only once complete.
+func downloadFile(ctx context.Context, url string, path string, expectedSize int64) (retErr error) {
+	task := progress.Start("download " + filepath.Base(path))
+	task.SetTotal(0, uint64(expectedSize))
+	defer func() { task.Done(retErr) }()
+	if err := checkDiskSpace(diskNeed{
+		Dir:   filepath.Dir(path),
+		Bytes: uint64(expectedSize),
+		What:  "download of " + filepath.Base(path),
+	}); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := splitcarfetcher.NewHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, task.Reader(splitcarfetcher.DefaultBandwidth.Reader(ctx, url, splitcarfetcher.TrafficDownload, resp.Body)))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if written != expectedSize {
+		return fmt.Errorf("downloaded %d bytes, expected %d", written, expectedSize)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pinnedReaderAt serves the reads of the hot region of an index from memory,
+// and the others from the underlying reader.
+type pinnedReaderAt struct {
+	ReaderAtCloser
+	hot []byte
+}
+
+// indexHotRegionSize returns the size of the hot region of an index file (its header and
+// bucket table, read by every lookup), or 0 if it's not a compactindex (e.g. a sig-exists
+// index, whose header is loaded in memory anyway).
+func indexHotRegionSize(r io.ReaderAt) (int64, error) {
+	db, err := compactindexsized.Open(r)
+	switch {
+	case err == nil:
+		return db.HotRegionSize(), nil
+	case errors.Is(err, compactindexsized.ErrInvalidMagic):
+		mphDB, err := mphindex.Open(r)
+		if errors.Is(err, mphindex.ErrInvalidMagic) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		return mphDB.HotRegionSize(), nil
+	default:
+		return 0, err
+	}
+}
+
+func newPinnedReaderAt(rac ReaderAtCloser) (*pinnedReaderAt, error) {
+	hotRegionSize, err := indexHotRegionSize(rac)
+	if err != nil {
+		return nil, err
+	}
+	if hotRegionSize == 0 {
+		return &pinnedReaderAt{ReaderAtCloser: rac}, nil
+	}
+	hot := make([]byte, hotRegionSize)
+	if _, err := rac.ReadAt(hot, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return &pinnedReaderAt{
+		ReaderAtCloser: rac,
+		hot:            hot,
+	}, nil
+}
+
+func (r *pinnedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= 0 && off+int64(len(p)) <= int64(len(r.hot)) {
+		return copy(p, r.hot[off:]), nil
+	}
+	return r.ReaderAtCloser.ReadAt(p, off)
+}
+
+// mountIndex opens an index file of the epoch, according to the configured mode; the index file
+// is shared with the other epochs that have it open (so changing its mode affects all of them).
+func (e *Epoch) mountIndex(ctx context.Context, name string, uri URI) (*indexMount, error) {
+	mode, localDir := e.config.Indexes.Mode, e.config.Indexes.LocalDir
+	key := sharedResourceKey("index", uri.String(), indexModeFor(mode, uri), localDir)
+	ref, err := sharedResources.acquire(key, func() (io.Closer, error) {
+		return newIndexMount(ctx, name, uri, mode, localDir)
+	})
+	if err != nil {
+		return nil, err
+	}
+	mount := ref.Value().(*indexMount)
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	if e.indexesClosed {
+		ref.Release()
+		return nil, fmt.Errorf("epoch %d is closed", e.Epoch())
+	}
+	if e.indexMounts == nil {
+		e.indexMounts = make(map[string]*indexMount)
+		e.indexMountRefs = make(map[string]*resourceRef)
+	}
+	if old, ok := e.indexMountRefs[name]; ok {
+		old.Release()
+	}
+	e.indexMounts[name] = mount
+	e.indexMountRefs[name] = ref
+	return mount, nil
+}
+
+// unmountIndex releases an index file of the epoch (closing it, unless other epochs use it).
+func (e *Epoch) unmountIndex(name string) error {
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	ref, ok := e.indexMountRefs[name]
+	if !ok {
+		return nil
+	}
+	delete(e.indexMounts, name)
+	delete(e.indexMountRefs, name)
+	return ref.Release()
+}
+
+// closeIndexMounts releases all the index files of the epoch.
+func (e *Epoch) closeIndexMounts() error {
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.indexesClosed = true
+	var errs []error
+	for _, ref := range e.indexMountRefs {
+		if err := ref.Release(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *Epoch) getIndexMount(name string) (*indexMount, bool) {
+	e.indexMu.RLock()
+	defer e.indexMu.RUnlock()
+	mount, ok := e.indexMounts[name]
+	return mount, ok
+}
+
+// IndexMounts returns the status of the index files of the epoch.
+func (e *Epoch) IndexMounts() []IndexMountStatus {
+	e.indexMu.RLock()
+	defer e.indexMu.RUnlock()
+	out := make([]IndexMountStatus, 0, len(e.indexMounts))
+	for _, mount := range e.indexMounts {
+		out = append(out, mount.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetIndexMode changes the mode of the remote index files of the epoch (or only of the named
+// index, if not empty); the local index files are always mmapped.
+func (e *Epoch) SetIndexMode(ctx context.Context, name string, mode IndexMode) error {
+	if name != "" {
+		mount, ok := e.getIndexMount(name)
+		if !ok {
+			return fmt.Errorf("epoch %d has no index %q", e.Epoch(), name)
+		}
+		return mount.SetMode(ctx, mode)
+	}
+	e.indexMu.RLock()
+	mounts := make([]*indexMount, 0, len(e.indexMounts))
+	for _, mount := range e.indexMounts {
+		mounts = append(mounts, mount)
+	}
+	e.indexMu.RUnlock()
+	var errs []error
+	for _, mount := range mounts {
+		if mount.uri.IsLocal() {
+			continue
+		}
+		if err := mount.SetMode(ctx, mode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
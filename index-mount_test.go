@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingReaderAt struct {
+	*bytes.Reader
+	offsets []int64
+}
+
+func (r *recordingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.offsets = append(r.offsets, off)
+	return r.Reader.ReadAt(p, off)
+}
+
+func (r *recordingReaderAt) Close() error {
+	return nil
+}
+
+func TestIndexModeFor(t *testing.T) {
+	require.Equal(t, IndexModeMmap, indexModeFor("", URI("/data/epoch-0.index")))
+	require.Equal(t, IndexModeMmap, indexModeFor(IndexModeDownload, URI("/data/epoch-0.index")))
+	require.Equal(t, IndexModeRemote, indexModeFor("", URI("https://example.com/epoch-0.index")))
+	require.Equal(t, IndexModeRemote, indexModeFor(IndexModeMmap, URI("https://example.com/epoch-0.index")))
+	require.Equal(t, IndexModePinned, indexModeFor(IndexModePinned, URI("https://example.com/epoch-0.index")))
+	require.False(t, IndexMode("nfs").IsValid())
+}
+
+func TestPinnedReaderAt(t *testing.T) {
+	builder, err := compactindexsized.NewBuilderSized("", 3*10_000, 8)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.NoError(t, builder.Insert([]byte("hello"), []byte{1, 0, 0, 0, 0, 0, 0, 0}))
+	path := filepath.Join(t.TempDir(), "test.index")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, builder.Seal(context.Background(), file))
+	require.NoError(t, file.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	remote := &recordingReaderAt{Reader: bytes.NewReader(data)}
+	pinned, err := newPinnedReaderAt(remote)
+	require.NoError(t, err)
+	require.NotEmpty(t, pinned.hot)
+
+	// the lookups read the bucket table from memory, and only the entries remotely.
+	remote.offsets = nil
+	db, err := compactindexsized.Open(pinned)
+	require.NoError(t, err)
+	value, err := db.Lookup([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 0, 0, 0, 0, 0, 0, 0}, value)
+	require.NotEmpty(t, remote.offsets)
+	for _, off := range remote.offsets {
+		require.GreaterOrEqual(t, off, int64(len(pinned.hot)))
+	}
+
+	// not a compactindex: everything is read remotely.
+	other := &recordingReaderAt{Reader: bytes.NewReader([]byte("not an index"))}
+	pinned, err = newPinnedReaderAt(other)
+	require.NoError(t, err)
+	require.Empty(t, pinned.hot)
+}
+
+func TestIndexMountSetMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.index")
+	require.NoError(t, os.WriteFile(path, []byte("some index data"), 0o644))
+
+	mount, err := newIndexMount(context.Background(), "slot_to_cid", URI(path), IndexModeRemote, "")
+	require.NoError(t, err)
+	defer mount.Close()
+	require.Equal(t, IndexModeMmap, mount.Mode())
+
+	// local index files can only be mmapped.
+	require.Error(t, mount.SetMode(context.Background(), IndexModeDownload))
+	require.Error(t, mount.SetMode(context.Background(), IndexMode("nfs")))
+	require.NoError(t, mount.SetMode(context.Background(), IndexModeMmap))
+
+	got := make([]byte, 4)
+	_, err = mount.ReadAt(got, 5)
+	require.NoError(t, err)
+	require.Equal(t, "inde", string(got))
+
+	require.NoError(t, mount.Close())
+	_, err = mount.ReadAt(got, 0)
+	require.Error(t, err)
+}
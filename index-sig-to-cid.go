@@ -16,6 +16,7 @@ import (
 	"github.com/rpcpool/yellowstone-faithful/indexes"
 	"github.com/rpcpool/yellowstone-faithful/indexmeta"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/progress"
 	"k8s.io/klog/v2"
 )
 
@@ -27,7 +28,7 @@ func CreateIndex_sig2cid(
 	tmpDir string,
 	carPath string,
 	indexDir string,
-) (string, error) {
+) (_ string, retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -68,12 +69,13 @@ func CreateIndex_sig2cid(
 
 	klog.Infof("Creating builder with %d items", numItems)
 
-	sig2c, err := indexes.NewWriter_SigToCid(
+	sig2c, err := indexes.NewWriterWithFormat_SigToCid(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems, // TODO: what if the number of real items is less than this?
+		indexBuildOptionsOf(ctx).SigToCidFormat,
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to open index store: %w", err)
@@ -81,6 +83,8 @@ func CreateIndex_sig2cid(
 	defer sig2c.Close()
 
 	numItemsIndexed := uint64(0)
+	task := progress.Start("index sig-to-cid")
+	defer func() { task.Done(retErr) }()
 	klog.Infof("Indexing...")
 
 	dr, err := cr.DataReader()
@@ -105,9 +109,7 @@ func CreateIndex_sig2cid(
 			}
 
 			numItemsIndexed++
-			if numItemsIndexed%100_000 == 0 {
-				printToStderr(".")
-			}
+			task.Add(1, 0)
 			return nil
 		})
 	if err != nil {
@@ -126,7 +128,7 @@ func CreateIndex_sig2cid(
 // VerifyIndex_sig2cid verifies that the index file is correct for the given car file.
 // It does this by reading the car file and comparing the offsets in the index
 // file to the offsets in the car file.
-func VerifyIndex_sig2cid(ctx context.Context, carPath string, indexFilePath string) error {
+func VerifyIndex_sig2cid(ctx context.Context, carPath string, indexFilePath string) (retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -171,6 +173,8 @@ func VerifyIndex_sig2cid(ctx context.Context, carPath string, indexFilePath stri
 	}
 
 	numItems := uint64(0)
+	task := progress.Start("verify index sig-to-cid")
+	defer func() { task.Done(retErr) }()
 	err = FindTransactions(
 		ctx,
 		dr,
@@ -190,9 +194,7 @@ func VerifyIndex_sig2cid(ctx context.Context, carPath string, indexFilePath stri
 			}
 
 			numItems++
-			if numItems%100_000 == 0 {
-				printToStderr(".")
-			}
+			task.Add(1, 0)
 
 			return nil
 		})
@@ -202,7 +204,7 @@ func VerifyIndex_sig2cid(ctx context.Context, carPath string, indexFilePath stri
 	return nil
 }
 
-func VerifyIndex_sigExists(ctx context.Context, carPath string, indexFilePath string) error {
+func VerifyIndex_sigExists(ctx context.Context, carPath string, indexFilePath string) (retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -257,6 +259,8 @@ func VerifyIndex_sigExists(ctx context.Context, carPath string, indexFilePath st
 	}
 
 	numItems := uint64(0)
+	task := progress.Start("verify index sig-exists")
+	defer func() { task.Done(retErr) }()
 	err = FindTransactions(
 		ctx,
 		dr,
@@ -275,9 +279,7 @@ func VerifyIndex_sigExists(ctx context.Context, carPath string, indexFilePath st
 			}
 
 			numItems++
-			if numItems%100_000 == 0 {
-				printToStderr(".")
-			}
+			task.Add(1, 0)
 
 			return nil
 		})
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"k8s.io/klog/v2"
+)
+
+// blockhashCollector collects the blockhashes of the blocks of a CAR while it's read in order
+// (the entries of a block come before the block), for the slot-to-blockhash index: the blockhash
+// of a block is the hash of its last entry, and its previous blockhash is the blockhash of its parent.
+type blockhashCollector struct {
+	// entryHashes are the hashes of the entries read since the last block.
+	entryHashes map[cid.Cid]solana.Hash
+	blocks      map[uint64]collectedBlockhash
+	// numMissing is the number of blocks whose last entry was not read before them.
+	numMissing uint64
+}
+
+type collectedBlockhash struct {
+	parentSlot uint64
+	blockhash  solana.Hash
+}
+
+func newBlockhashCollector() *blockhashCollector {
+	return &blockhashCollector{
+		entryHashes: make(map[cid.Cid]solana.Hash),
+		blocks:      make(map[uint64]collectedBlockhash),
+	}
+}
+
+func (c *blockhashCollector) addEntry(entryCid cid.Cid, entry *ipldbindcode.Entry) {
+	c.entryHashes[entryCid] = solana.HashFromBytes(entry.Hash)
+}
+
+func (c *blockhashCollector) addBlock(block *ipldbindcode.Block) {
+	defer clear(c.entryHashes)
+	if len(block.Entries) == 0 {
+		c.numMissing++
+		return
+	}
+	lastEntryCid := block.Entries[len(block.Entries)-1].(cidlink.Link).Cid
+	hash, ok := c.entryHashes[lastEntryCid]
+	if !ok {
+		c.numMissing++
+		return
+	}
+	c.blocks[uint64(block.Slot)] = collectedBlockhash{
+		parentSlot: uint64(block.Meta.Parent_slot),
+		blockhash:  hash,
+	}
+}
+
+// numBlocks returns the number of blocks whose blockhash was collected.
+func (c *blockhashCollector) numBlocks() uint64 {
+	return uint64(len(c.blocks))
+}
+
+// writeTo puts the blockhashes in the index, in order of slot; the previous blockhash of a block
+// whose parent is not in the CAR (the first block of the epoch) is left unknown.
+func (c *blockhashCollector) writeTo(index *indexes.SlotToBlockhash_Writer) error {
+	if c.numMissing > 0 {
+		klog.Warningf("The last entry of %d blocks was not found before them; their blockhashes are not indexed", c.numMissing)
+	}
+	slots := make([]uint64, 0, len(c.blocks))
+	for slot := range c.blocks {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	for _, slot := range slots {
+		block := c.blocks[slot]
+		var previousBlockhash solana.Hash
+		if parent, ok := c.blocks[block.parentSlot]; ok && block.parentSlot < slot {
+			previousBlockhash = parent.blockhash
+		}
+		if err := index.Put(slot, block.blockhash, previousBlockhash); err != nil {
+			return fmt.Errorf("failed to index the blockhash of slot %d: %w", slot, err)
+		}
+	}
+	return nil
+}
+
+// verify checks that the index has the collected blockhashes.
+func (c *blockhashCollector) verify(index *indexes.SlotToBlockhash_Reader) error {
+	for slot, block := range c.blocks {
+		blockhash, previousBlockhash, err := index.Get(slot)
+		if err != nil {
+			return fmt.Errorf("failed to get the blockhash of slot %d: %w", slot, err)
+		}
+		if blockhash != block.blockhash {
+			return fmt.Errorf("blockhash mismatch for slot %d: expected %s, got %s", slot, block.blockhash, blockhash)
+		}
+		if parent, ok := c.blocks[block.parentSlot]; ok && block.parentSlot < slot && previousBlockhash != parent.blockhash {
+			return fmt.Errorf("previous blockhash mismatch for slot %d: expected %s, got %s", slot, parent.blockhash, previousBlockhash)
+		}
+	}
+	return nil
+}
+
+func NewBuilder_SlotToBlockhash(
+	epoch uint64,
+	rootCid cid.Cid,
+	network indexes.Network,
+	tmpDir string,
+	numItems uint64,
+) (*indexes.SlotToBlockhash_Writer, error) {
+	tmpDir = filepath.Join(tmpDir, "index-slot-to-blockhash-"+time.Now().Format("20060102-150405.000000000")+fmt.Sprintf("-%d", rand.Int63()))
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create slot_to_blockhash tmp dir: %w", err)
+	}
+	index, err := indexes.NewWriter_SlotToBlockhash(
+		epoch,
+		rootCid,
+		network,
+		tmpDir,
+		numItems,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slot_to_blockhash index: %w", err)
+	}
+	return index, nil
+}
+
+func OpenIndex_SlotToBlockhash(
+	indexFilePath string,
+) (*indexes.SlotToBlockhash_Reader, error) {
+	index, err := indexes.Open_SlotToBlockhash(indexFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open slot_to_blockhash index: %w", err)
+	}
+	return index, nil
+}
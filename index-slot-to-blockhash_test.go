@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockhashCollector(t *testing.T) {
+	collector := newBlockhashCollector()
+	addBlock := func(slot, parentSlot int, entryHashes ...byte) {
+		var entries ipldbindcode.List__Link
+		for _, hash := range entryHashes {
+			entryCid := cid.NewCidV1(cid.DagCBOR, []byte{byte(slot), hash})
+			entryHash := solana.Hash{hash}
+			collector.addEntry(entryCid, &ipldbindcode.Entry{Hash: entryHash[:]})
+			entries = append(entries, datamodel.Link(cidlink.Link{Cid: entryCid}))
+		}
+		collector.addBlock(&ipldbindcode.Block{
+			Slot:    slot,
+			Entries: entries,
+			Meta:    ipldbindcode.SlotMeta{Parent_slot: parentSlot},
+		})
+	}
+	addBlock(100, 99, 1, 2)
+	addBlock(101, 100, 3)
+	addBlock(103, 101, 4, 5, 6)
+	// a block without entries.
+	addBlock(104, 103)
+	require.Equal(t, uint64(3), collector.numBlocks())
+	require.Equal(t, uint64(1), collector.numMissing)
+
+	rootCid := cid.NewCidV1(cid.DagCBOR, []byte("root"))
+	writer, err := indexes.NewWriter_SlotToBlockhash(0, rootCid, indexes.NetworkMainnet, "", collector.numBlocks())
+	require.NoError(t, err)
+	require.NoError(t, collector.writeTo(writer))
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	reader, err := OpenIndex_SlotToBlockhash(writer.GetFilepath())
+	require.NoError(t, err)
+	defer reader.Close()
+	require.NoError(t, collector.verify(reader))
+
+	blockhash, previousBlockhash, err := reader.Get(103)
+	require.NoError(t, err)
+	require.Equal(t, solana.Hash{6}, blockhash)
+	require.Equal(t, solana.Hash{3}, previousBlockhash)
+	// the parent of the first block is not in the epoch.
+	_, previousBlockhash, err = reader.Get(100)
+	require.NoError(t, err)
+	require.True(t, previousBlockhash.IsZero())
+}
@@ -12,6 +12,7 @@ import (
 	carv2 "github.com/ipld/go-car/v2"
 	"github.com/rpcpool/yellowstone-faithful/indexes"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/progress"
 	"k8s.io/klog/v2"
 )
 
@@ -23,7 +24,7 @@ func CreateIndex_slot2cid(
 	tmpDir string,
 	carPath string,
 	indexDir string,
-) (string, error) {
+) (_ string, retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -63,12 +64,13 @@ func CreateIndex_slot2cid(
 	}
 
 	klog.Infof("Creating builder with %d items", numItems)
-	sl2c, err := indexes.NewWriter_SlotToCid(
+	sl2c, err := indexes.NewWriterWithFormat_SlotToCid(
 		epoch,
 		rootCid,
 		network,
 		tmpDir,
 		numItems,
+		indexBuildOptionsOf(ctx).SlotToCidFormat,
 	)
 	if err != nil {
 		return "", fmt.Errorf("failed to open index store: %w", err)
@@ -76,6 +78,8 @@ func CreateIndex_slot2cid(
 	defer sl2c.Close()
 
 	numItemsIndexed := uint64(0)
+	task := progress.Start("index slot-to-cid")
+	defer func() { task.Done(retErr) }()
 	klog.Infof("Indexing...")
 
 	dr, err := cr.DataReader()
@@ -97,9 +101,7 @@ func CreateIndex_slot2cid(
 			}
 
 			numItemsIndexed++
-			if numItemsIndexed%1_000 == 0 {
-				printToStderr(".")
-			}
+			task.Add(1, 0)
 			return nil
 		})
 	if err != nil {
@@ -120,7 +122,7 @@ func CreateIndex_slot2cid(
 // VerifyIndex_slot2cid verifies that the index file is correct for the given car file.
 // It does this by reading the car file and comparing the offsets in the index
 // file to the offsets in the car file.
-func VerifyIndex_slot2cid(ctx context.Context, carPath string, indexFilePath string) error {
+func VerifyIndex_slot2cid(ctx context.Context, carPath string, indexFilePath string) (retErr error) {
 	// Check if the CAR file exists:
 	exists, err := fileExists(carPath)
 	if err != nil {
@@ -165,6 +167,8 @@ func VerifyIndex_slot2cid(ctx context.Context, carPath string, indexFilePath str
 	}
 
 	numItems := uint64(0)
+	task := progress.Start("verify index slot-to-cid")
+	defer func() { task.Done(retErr) }()
 	// Iterate over all blocks in the CAR file and put them into the index,
 	// using the slot number as the key and the CID as the value.
 	err = FindBlocks(
@@ -183,9 +187,7 @@ func VerifyIndex_slot2cid(ctx context.Context, carPath string, indexFilePath str
 			}
 
 			numItems++
-			if numItems%1_000 == 0 {
-				printToStderr(".")
-			}
+			task.Add(1, 0)
 
 			return nil
 		})
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/rpcpool/yellowstone-faithful/bucketteer"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"k8s.io/klog/v2"
+)
+
+// indexSpool is a temporary file with the entries of an index, written while the CAR is streamed:
+// the index writers need the number of items (and the epoch, from the last node of the CAR)
+// before the first entry, so the entries are replayed into them at the end of the stream.
+// The entries are much smaller than the CAR (a CID, a signature, or a slot and an offset per node).
+type indexSpool struct {
+	file  *os.File
+	w     *bufio.Writer
+	count uint64
+}
+
+func newIndexSpool(dir string, name string) (*indexSpool, error) {
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &indexSpool{
+		file: file,
+		w:    bufio.NewWriterSize(file, 1024*1024),
+	}, nil
+}
+
+// write appends an entry made of the given (length-prefixed) parts.
+func (s *indexSpool) write(parts ...[]byte) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, part := range parts {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(part)))
+		if _, err := s.w.Write(lenBuf[:n]); err != nil {
+			return err
+		}
+		if _, err := s.w.Write(part); err != nil {
+			return err
+		}
+	}
+	s.count++
+	return nil
+}
+
+// replay calls fn with each entry, in order.
+func (s *indexSpool) replay(numParts int, fn func(parts [][]byte) error) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(s.file, 1024*1024)
+	parts := make([][]byte, numParts)
+	for i := uint64(0); i < s.count; i++ {
+		for j := range parts {
+			size, err := binary.ReadUvarint(br)
+			if err != nil {
+				return fmt.Errorf("failed to read spooled entry %d: %w", i, err)
+			}
+			if uint64(cap(parts[j])) < size {
+				parts[j] = make([]byte, size)
+			}
+			parts[j] = parts[j][:size]
+			if _, err := io.ReadFull(br, parts[j]); err != nil {
+				return fmt.Errorf("failed to read spooled entry %d: %w", i, err)
+			}
+		}
+		if err := fn(parts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *indexSpool) Close() error {
+	return s.file.Close()
+}
+
+func uint64Bytes(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
+}
+
+// createAllIndexesFromStream is like createAllIndexes, but reads the CAR only once, as a stream
+// (e.g. from stdin), so it doesn't need the CAR on disk.
+func createAllIndexesFromStream(
+	ctx context.Context,
+	network indexes.Network,
+	tmpDir string,
+	r io.Reader,
+	indexDir string,
+) (_ *IndexPaths, _ uint64, retErr error) {
+	rd, err := newCarReader(io.NopCloser(r))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create car reader: %w", err)
+	}
+	if len(rd.header.Roots) != 1 {
+		return nil, 0, fmt.Errorf("car file must have exactly 1 root, but has %d", len(rd.header.Roots))
+	}
+	rootCID := rd.header.Roots[0]
+	klog.Infof("- Root: %s", rootCID)
+
+	spoolDir, err := os.MkdirTemp(tmpDir, "index-stream-")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	defer os.RemoveAll(spoolDir)
+	offsets, err := newIndexSpool(spoolDir, "cid-to-offset-and-size")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer offsets.Close()
+	slots, err := newIndexSpool(spoolDir, "slot-to-cid")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer slots.Close()
+	sigs, err := newIndexSpool(spoolDir, "sig-to-cid")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer sigs.Close()
+
+	totalOffset := uint64(0)
+	{
+		var buf bytes.Buffer
+		if err = carv1.WriteHeader(rd.header, &buf); err != nil {
+			return nil, 0, err
+		}
+		totalOffset = uint64(buf.Len())
+	}
+
+	klog.Infof("Reading the CAR stream...")
+	task := progress.Start("index all")
+	defer func() { task.Done(retErr) }()
+	var epochObject *ipldbindcode.Epoch
+	blockhashes := newBlockhashCollector()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		_cid, sectionLength, block, err := rd.NextNode()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, 0, err
+		}
+		if err := offsets.write(_cid.Bytes(), uint64Bytes(totalOffset), uint64Bytes(sectionLength)); err != nil {
+			return nil, 0, fmt.Errorf("failed to spool cid to offset: %w", err)
+		}
+		switch iplddecoders.Kind(block.RawData()[1]) {
+		case iplddecoders.KindBlock:
+			block, err := iplddecoders.DecodeBlock(block.RawData())
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to decode block: %w", err)
+			}
+			if err := slots.write(uint64Bytes(uint64(block.Slot)), _cid.Bytes()); err != nil {
+				return nil, 0, fmt.Errorf("failed to spool slot to cid: %w", err)
+			}
+			blockhashes.addBlock(block)
+		case iplddecoders.KindEntry:
+			entry, err := iplddecoders.DecodeEntry(block.RawData())
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to decode entry: %w", err)
+			}
+			blockhashes.addEntry(_cid, entry)
+		case iplddecoders.KindTransaction:
+			txNode, err := iplddecoders.DecodeTransaction(block.RawData())
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to decode transaction: %w", err)
+			}
+			sig, err := readFirstSignature(txNode.Data.Bytes())
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to read signature: %w", err)
+			}
+			if err := sigs.write(sig[:], _cid.Bytes()); err != nil {
+				return nil, 0, fmt.Errorf("failed to spool signature to cid: %w", err)
+			}
+		case iplddecoders.KindEpoch:
+			epochObject, err = iplddecoders.DecodeEpoch(block.RawData())
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to decode epoch: %w", err)
+			}
+		}
+		totalOffset += sectionLength
+		task.Add(1, sectionLength)
+	}
+	if epochObject == nil {
+		return nil, 0, fmt.Errorf("failed to find epoch object in the car stream")
+	}
+	epoch := uint64(epochObject.Epoch)
+	klog.Infof("This CAR file is for epoch %d and cluster %s", epoch, network)
+	klog.Infof(
+		"Indexing %s offsets, %s blocks, %s transactions",
+		humanize.Comma(int64(offsets.count)),
+		humanize.Comma(int64(slots.count)),
+		humanize.Comma(int64(sigs.count)),
+	)
+	estimate := estimateAllIndexes(offsets.count, slots.count, sigs.count)
+	release, err := reserveIndexMemory(ctx, estimate.MemoryBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	if err := checkIndexResources(estimate, tmpDir, indexDir); err != nil {
+		return nil, 0, err
+	}
+
+	cid_to_offset_and_size, err := NewBuilder_CidToOffset(epoch, rootCID, network, tmpDir, offsets.count, indexBuildOptionsOf(ctx).CidToOffsetEncoding)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create cid_to_offset_and_size index: %w", err)
+	}
+	defer cid_to_offset_and_size.Close()
+	slot_to_cid, err := NewBuilder_SlotToCid(epoch, rootCID, network, tmpDir, slots.count, indexBuildOptionsOf(ctx).SlotToCidFormat)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create slot_to_cid index: %w", err)
+	}
+	defer slot_to_cid.Close()
+	sig_to_cid, err := NewBuilder_SignatureToCid(epoch, rootCID, network, tmpDir, sigs.count, indexBuildOptionsOf(ctx).SigToCidFormat)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create sig_to_cid index: %w", err)
+	}
+	defer sig_to_cid.Close()
+	slot_to_blockhash, err := NewBuilder_SlotToBlockhash(epoch, rootCID, network, tmpDir, blockhashes.numBlocks())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create slot_to_blockhash index: %w", err)
+	}
+	defer slot_to_blockhash.Close()
+	sigExistsFilepath := formatSigExistsIndexFilePath(indexDir, epoch, rootCID, network)
+	sig_exists, err := bucketteer.NewWriter(sigExistsFilepath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create sig_exists index: %w", err)
+	}
+	defer sig_exists.Close()
+
+	err = offsets.replay(3, func(parts [][]byte) error {
+		_, c, err := cid.CidFromBytes(parts[0])
+		if err != nil {
+			return err
+		}
+		return cid_to_offset_and_size.Put(c, binary.LittleEndian.Uint64(parts[1]), binary.LittleEndian.Uint64(parts[2]))
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to index cid to offset: %w", err)
+	}
+	err = slots.replay(2, func(parts [][]byte) error {
+		_, c, err := cid.CidFromBytes(parts[1])
+		if err != nil {
+			return err
+		}
+		return slot_to_cid.Put(binary.LittleEndian.Uint64(parts[0]), c)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to index slot to cid: %w", err)
+	}
+	err = sigs.replay(2, func(parts [][]byte) error {
+		_, c, err := cid.CidFromBytes(parts[1])
+		if err != nil {
+			return err
+		}
+		sig := solana.SignatureFromBytes(parts[0])
+		sig_exists.Put(sig)
+		return sig_to_cid.Put(sig, c)
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to index signature to cid: %w", err)
+	}
+
+	if err := blockhashes.writeTo(slot_to_blockhash); err != nil {
+		return nil, 0, err
+	}
+
+	paths, err := sealAllIndexes(
+		ctx,
+		epoch,
+		rootCID,
+		network,
+		indexDir,
+		cid_to_offset_and_size,
+		slot_to_cid,
+		sig_to_cid,
+		slot_to_blockhash,
+		sig_exists,
+		sigExistsFilepath,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	return paths, offsets.count, nil
+}
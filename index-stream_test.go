@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexSpool(t *testing.T) {
+	spool, err := newIndexSpool(t.TempDir(), "test")
+	require.NoError(t, err)
+	defer spool.Close()
+
+	require.NoError(t, spool.write([]byte("first"), uint64Bytes(1)))
+	require.NoError(t, spool.write([]byte{}, uint64Bytes(2)))
+	require.NoError(t, spool.write(make([]byte, 300), uint64Bytes(3)))
+	require.Equal(t, uint64(3), spool.count)
+
+	var keys [][]byte
+	var values []uint64
+	for i := 0; i < 2; i++ {
+		// it can be replayed more than once.
+		keys, values = nil, nil
+		require.NoError(t, spool.replay(2, func(parts [][]byte) error {
+			keys = append(keys, append([]byte(nil), parts[0]...))
+			values = append(values, uint64(parts[1][0]))
+			return nil
+		}))
+	}
+	require.Equal(t, [][]byte{[]byte("first"), {}, make([]byte, 300)}, keys)
+	require.Equal(t, []uint64{1, 2, 3}, values)
+}
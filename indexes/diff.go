@@ -0,0 +1,112 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+)
+
+// DiffReport is the comparison of two compact indexes of the same kind.
+type DiffReport struct {
+	MetaA *Metadata
+	MetaB *Metadata
+	// OnlyInA and OnlyInB are the numbers of entries that are in only one of the indexes.
+	OnlyInA uint64
+	OnlyInB uint64
+	// Mismatches is the number of entries with different values.
+	Mismatches uint64
+	// DomainMismatches is the number of buckets whose entries can't be compared, as they have
+	// different keys (see compactindexsized.Difference).
+	DomainMismatches uint64
+	// Differences are the first differences (up to the limit passed to Diff).
+	Differences []compactindexsized.Difference
+}
+
+// Equal returns whether the indexes have the same entries.
+func (r *DiffReport) Equal() bool {
+	return r.OnlyInA == 0 && r.OnlyInB == 0 && r.Mismatches == 0 && r.DomainMismatches == 0
+}
+
+// Diff compares the entries of two compact indexes of the same kind (e.g. a rebuilt index and
+// the original), and keeps up to maxDifferences of the differences in the report. The
+// metadata of the indexes may differ (e.g. a different root CID); it's in the report.
+func Diff(ctx context.Context, a io.ReaderAt, b io.ReaderAt, maxDifferences int) (*DiffReport, error) {
+	indexA, err := openCompact(a)
+	if err != nil {
+		return nil, fmt.Errorf("index a: %w", err)
+	}
+	indexB, err := openCompact(b)
+	if err != nil {
+		return nil, fmt.Errorf("index b: %w", err)
+	}
+	report := &DiffReport{}
+	if report.MetaA, err = getDefaultMetadata(indexA); err != nil {
+		return nil, fmt.Errorf("index a: %w", err)
+	}
+	if report.MetaB, err = getDefaultMetadata(indexB); err != nil {
+		return nil, fmt.Errorf("index b: %w", err)
+	}
+	if !bytes.Equal(report.MetaA.IndexKind, report.MetaB.IndexKind) {
+		return nil, fmt.Errorf("the indexes are of different kinds: %q and %q", report.MetaA.IndexKind, report.MetaB.IndexKind)
+	}
+	err = compactindexsized.Diff(ctx, indexA, indexB, func(diff compactindexsized.Difference) error {
+		switch {
+		case diff.DomainMismatch:
+			report.DomainMismatches++
+		case diff.ValueB == nil:
+			report.OnlyInA++
+		case diff.ValueA == nil:
+			report.OnlyInB++
+		default:
+			report.Mismatches++
+		}
+		if len(report.Differences) < maxDifferences {
+			report.Differences = append(report.Differences, diff)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func openCompact(reader io.ReaderAt) (*compactindexsized.DB, error) {
+	if isMPH, err := IsFileMPHFormat(reader); err != nil {
+		return nil, err
+	} else if isMPH {
+		return nil, fmt.Errorf("indexes in the %s format are not supported", FormatMPH)
+	}
+	if isRanged, err := IsFileRangedFormat(reader); err != nil {
+		return nil, err
+	} else if isRanged {
+		return nil, fmt.Errorf("indexes in the %s format are not supported", FormatRanged)
+	}
+	index, err := compactindexsized.Open(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	return index, nil
+}
+
+// FormatValue returns a readable form of a value of an index of the kind: the offset and size,
+// or the CID, or else the hex-encoded value.
+func FormatValue(kind []byte, value []byte) string {
+	switch {
+	case bytes.Equal(kind, Kind_CidToOffsetAndSize):
+		var oas OffsetAndSize
+		if err := oas.FromBytes(value); err == nil {
+			return fmt.Sprintf("offset=%d size=%d", oas.Offset, oas.Size)
+		}
+	case bytes.Equal(kind, Kind_SlotToCid), bytes.Equal(kind, Kind_SigToCid):
+		if _, c, err := cid.CidFromBytes(value); err == nil {
+			return c.String()
+		}
+	}
+	return hex.EncodeToString(value)
+}
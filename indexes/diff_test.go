@@ -0,0 +1,52 @@
+package indexes_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	build := func(numItems int, sizeOf func(i int) uint64) *os.File {
+		writer, err := indexes.NewWriter_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", uint64(numItems))
+		require.NoError(t, err)
+		for i := 0; i < numItems; i++ {
+			c := cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+			require.NoError(t, writer.Put(c, uint64(i)*100, sizeOf(i)))
+		}
+		require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+		require.NoError(t, writer.Close())
+		file, err := os.Open(writer.GetFilepath())
+		require.NoError(t, err)
+		t.Cleanup(func() { file.Close() })
+		return file
+	}
+	sizeOf := func(i int) uint64 { return 100 }
+	original := build(1000, sizeOf)
+
+	report, err := indexes.Diff(context.TODO(), original, build(1000, sizeOf), 10)
+	require.NoError(t, err)
+	require.True(t, report.Equal())
+	require.Equal(t, uint64(123), report.MetaB.Epoch)
+
+	rebuilt := build(1000, func(i int) uint64 {
+		if i == 7 {
+			return 99
+		}
+		return 100
+	})
+	report, err = indexes.Diff(context.TODO(), original, rebuilt, 10)
+	require.NoError(t, err)
+	require.False(t, report.Equal())
+	require.Equal(t, uint64(1), report.Mismatches)
+	require.Len(t, report.Differences, 1)
+	require.Equal(t, "offset=700 size=100", indexes.FormatValue(indexes.Kind_CidToOffsetAndSize, report.Differences[0].ValueA))
+	require.Equal(t, "offset=700 size=99", indexes.FormatValue(indexes.Kind_CidToOffsetAndSize, report.Differences[0].ValueB))
+}
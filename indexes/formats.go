@@ -0,0 +1,88 @@
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+	"github.com/rpcpool/yellowstone-faithful/mphindex"
+)
+
+// Format is the on-disk format of an index; it's chosen when the index is built, and
+// detected (by its magic) when it's opened.
+type Format string
+
+const (
+	// FormatCompact is the compactindexsized format: a 3-byte hash per key.
+	FormatCompact Format = "compact"
+	// FormatMPH is the mphindex format: a minimal perfect hash function (~3 bits per key),
+	// and a fingerprint of each key.
+	FormatMPH Format = "mph"
+	// FormatRanged is the format of the slot-to-cid index that stores the runs of consecutive
+	// slots, and the CIDs in order of slot (without their common prefix).
+	FormatRanged Format = "ranged"
+)
+
+func IsValidFormat(format Format) bool {
+	switch format {
+	case FormatCompact, FormatMPH:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidFormat_SlotToCid returns whether a slot-to-cid index can be built in the format.
+func IsValidFormat_SlotToCid(format Format) bool {
+	switch format {
+	case FormatCompact, FormatRanged:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValueEncoding is the encoding of the values of a compact index; it's chosen when the index
+// is built, and read from its header when it's opened.
+type ValueEncoding string
+
+const (
+	// ValueEncodingPlain stores the values as they are (e.g. 9 bytes per offset and size).
+	ValueEncodingPlain ValueEncoding = "plain"
+	// ValueEncodingPacked stores each field of the values as the difference to its minimum in
+	// the bucket, with the bit width of the largest difference.
+	ValueEncodingPacked ValueEncoding = "packed"
+)
+
+func IsValidValueEncoding(encoding ValueEncoding) bool {
+	switch encoding {
+	case ValueEncodingPlain, ValueEncodingPacked:
+		return true
+	default:
+		return false
+	}
+}
+
+// MPHFingerprintSize_SigToCid is the size of the fingerprints of a sig-to-cid index in the mph
+// format: the lookup of 1 in 65536 signatures that are not in the index returns the CID of
+// another transaction, so the signature of the transaction must be checked.
+const MPHFingerprintSize_SigToCid = 2
+
+// IsFileMPHFormat returns whether the index is in the mph format.
+func IsFileMPHFormat(file io.ReaderAt) (bool, error) {
+	var magic [8]byte
+	if _, err := file.ReadAt(magic[:], 0); err != nil {
+		return false, fmt.Errorf("failed to read magic: %w", err)
+	}
+	return mphindex.IsMagic(magic), nil
+}
+
+// indexBuilder is the builder of an index, whatever its format.
+type indexBuilder interface {
+	Metadata() *indexmeta.Meta
+	Insert(key []byte, value []byte) error
+	Seal(ctx context.Context, file *os.File) error
+	Close() error
+}
@@ -26,6 +26,9 @@ const (
 	IndexValueSize_CidToOffsetAndSize = 6 + 3
 )
 
+// valueFields_CidToOffsetAndSize are the fields of the values, when they are packed.
+var valueFields_CidToOffsetAndSize = []uint8{6, 3}
+
 func formatFilename_CidToOffsetAndSize(epoch uint64, rootCid cid.Cid, network Network) string {
 	return fmt.Sprintf(
 		"epoch-%d-%s-%s-%s",
@@ -44,6 +47,19 @@ func NewWriter_CidToOffsetAndSize(
 	network Network,
 	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
 	numItems uint64,
+) (*CidToOffsetAndSize_Writer, error) {
+	return NewWriterWithEncoding_CidToOffsetAndSize(epoch, rootCid, network, tmpDir, numItems, ValueEncodingPlain)
+}
+
+// NewWriterWithEncoding_CidToOffsetAndSize creates a writer of a cid-to-offset-and-size index
+// whose values have the given encoding.
+func NewWriterWithEncoding_CidToOffsetAndSize(
+	epoch uint64,
+	rootCid cid.Cid,
+	network Network,
+	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
+	numItems uint64,
+	encoding ValueEncoding,
 ) (*CidToOffsetAndSize_Writer, error) {
 	if !IsValidNetwork(network) {
 		return nil, ErrInvalidNetwork
@@ -59,6 +75,17 @@ func NewWriter_CidToOffsetAndSize(
 	if err != nil {
 		return nil, err
 	}
+	switch encoding {
+	case ValueEncodingPlain:
+	case ValueEncodingPacked:
+		if err := index.SetValueFields(valueFields_CidToOffsetAndSize...); err != nil {
+			index.Close()
+			return nil, err
+		}
+	default:
+		index.Close()
+		return nil, fmt.Errorf("invalid value encoding %q", encoding)
+	}
 	meta := &Metadata{
 		Epoch:     epoch,
 		RootCid:   rootCid,
@@ -224,3 +251,11 @@ func (r *CidToOffsetAndSize_Reader) Meta() *Metadata {
 func (r *CidToOffsetAndSize_Reader) Prefetch(b bool) {
 	r.index.Prefetch(b)
 }
+
+// ValueEncoding returns the encoding of the values of the index.
+func (r *CidToOffsetAndSize_Reader) ValueEncoding() ValueEncoding {
+	if len(r.index.Header.ValueFields) > 0 {
+		return ValueEncodingPacked
+	}
+	return ValueEncodingPlain
+}
@@ -3,6 +3,7 @@ package indexes_test
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -146,3 +147,60 @@ func TestCidToOffsetAndSize(t *testing.T) {
 		require.Equal(t, indexes.Kind_CidToOffsetAndSize, metadata.IndexKind)
 	}
 }
+
+func TestCidToOffsetAndSize_Packed(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	numItems := uint64(1000)
+
+	writer, err := indexes.NewWriterWithEncoding_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", numItems, indexes.ValueEncodingPacked)
+	require.NoError(t, err)
+	cids := make([]cid.Cid, numItems)
+	for i := range cids {
+		cids[i] = cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+		require.NoError(t, writer.Put(cids[i], uint64(i)*1_000_003, uint64(i%700)))
+	}
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	reader, err := indexes.Open_CidToOffsetAndSize(writer.GetFilepath())
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, indexes.ValueEncodingPacked, reader.ValueEncoding())
+	for i, c := range cids {
+		got, err := reader.Get(c)
+		require.NoError(t, err)
+		require.Equal(t, indexes.NewOffsetAndSize(uint64(i)*1_000_003, uint64(i%700)), got)
+	}
+
+	_, err = indexes.NewWriterWithEncoding_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", numItems, "zip")
+	require.Error(t, err)
+}
+
+func TestCidToOffsetAndSize_Sample(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	numItems := uint64(1000)
+
+	writer, err := indexes.NewWriter_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", numItems)
+	require.NoError(t, err)
+	cids := make([]cid.Cid, numItems)
+	for i := range cids {
+		cids[i] = cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+		require.NoError(t, writer.Put(cids[i], uint64(i)*100, 100))
+	}
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	reader, err := indexes.Open_CidToOffsetAndSize(writer.GetFilepath())
+	require.NoError(t, err)
+	defer reader.Close()
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 20; n++ {
+		sample, err := reader.Sample(rng)
+		require.NoError(t, err)
+		i := sample.Value.Offset / 100
+		require.True(t, sample.IsCid(cids[i]))
+		require.False(t, sample.IsCid(cids[(i+1)%numItems]))
+	}
+}
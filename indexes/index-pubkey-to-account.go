@@ -0,0 +1,214 @@
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// The pubkey-to-account index maps the pubkeys of the accounts of an account snapshot CAR
+// to the offset and size of their records in the CAR; the root CID of its metadata is the
+// root of the snapshot CAR, and it stores the slot of the snapshot.
+
+type PubkeyToAccount_Writer struct {
+	sealed    bool
+	tmpDir    string
+	finalPath string
+	meta      *Metadata
+	index     *compactindexsized.Builder
+}
+
+const (
+	// the offset and size of the record, like the cid-to-offset-and-size index.
+	IndexValueSize_PubkeyToAccount = IndexValueSize_CidToOffsetAndSize
+)
+
+func formatFilename_PubkeyToAccount(epoch uint64, rootCid cid.Cid, network Network) string {
+	return fmt.Sprintf(
+		"epoch-%d-%s-%s-%s",
+		epoch,
+		rootCid.String(),
+		network,
+		"pubkey-to-account.index",
+	)
+}
+
+var Kind_PubkeyToAccount = []byte("pubkey-to-account")
+
+func NewWriter_PubkeyToAccount(
+	epoch uint64,
+	rootCid cid.Cid,
+	network Network,
+	snapshotSlot uint64,
+	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
+	numItems uint64,
+) (*PubkeyToAccount_Writer, error) {
+	if !IsValidNetwork(network) {
+		return nil, ErrInvalidNetwork
+	}
+	if rootCid == cid.Undef {
+		return nil, ErrInvalidRootCid
+	}
+	index, err := compactindexsized.NewBuilderSized(
+		tmpDir,
+		uint(numItems),
+		IndexValueSize_PubkeyToAccount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Epoch:     epoch,
+		RootCid:   rootCid,
+		Network:   network,
+		IndexKind: Kind_PubkeyToAccount,
+	}
+	if err := setDefaultMetadata(index, meta); err != nil {
+		return nil, err
+	}
+	if err := index.Metadata().AddUint64(indexmeta.MetadataKey_SnapshotSlot, snapshotSlot); err != nil {
+		return nil, err
+	}
+	return &PubkeyToAccount_Writer{
+		tmpDir: tmpDir,
+		meta:   meta,
+		index:  index,
+	}, nil
+}
+
+// Put adds the offset and size of the record of the account in the snapshot CAR.
+func (w *PubkeyToAccount_Writer) Put(pubkey solana.PublicKey, offset uint64, size uint64) error {
+	if w.sealed {
+		return fmt.Errorf("cannot put to sealed writer")
+	}
+	oas := NewOffsetAndSize(offset, size)
+	if !oas.IsValid() {
+		return fmt.Errorf("invalid offset %d or size %d", offset, size)
+	}
+	return w.index.Insert(pubkey[:], oas.Bytes())
+}
+
+func (w *PubkeyToAccount_Writer) Seal(ctx context.Context, dstDir string) error {
+	if w.sealed {
+		return fmt.Errorf("already sealed")
+	}
+
+	filepath := filepath.Join(dstDir, formatFilename_PubkeyToAccount(w.meta.Epoch, w.meta.RootCid, w.meta.Network))
+	w.finalPath = filepath
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	if err := w.index.Seal(ctx, file); err != nil {
+		return fmt.Errorf("failed to seal index: %w", err)
+	}
+	w.sealed = true
+
+	return nil
+}
+
+func (w *PubkeyToAccount_Writer) Close() error {
+	if !w.sealed {
+		return fmt.Errorf("attempted to close a pubkey-to-account index that was not sealed")
+	}
+	return w.index.Close()
+}
+
+// GetFilepath returns the path to the sealed index file.
+func (w *PubkeyToAccount_Writer) GetFilepath() string {
+	return w.finalPath
+}
+
+type PubkeyToAccount_Reader struct {
+	file         io.Closer
+	meta         *Metadata
+	snapshotSlot uint64
+	index        *compactindexsized.DB
+}
+
+func Open_PubkeyToAccount(filepath string) (*PubkeyToAccount_Reader, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWithReader_PubkeyToAccount(file)
+}
+
+func OpenWithReader_PubkeyToAccount(reader ReaderAtCloser) (*PubkeyToAccount_Reader, error) {
+	index, err := compactindexsized.Open(reader)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := getDefaultMetadata(index)
+	if err != nil {
+		return nil, err
+	}
+	if !IsValidNetwork(meta.Network) {
+		return nil, fmt.Errorf("invalid network")
+	}
+	if meta.RootCid == cid.Undef {
+		return nil, fmt.Errorf("root cid is undefined")
+	}
+	if err := meta.AssertIndexKind(Kind_PubkeyToAccount); err != nil {
+		return nil, err
+	}
+	if index.Header.ValueSize != IndexValueSize_PubkeyToAccount {
+		return nil, fmt.Errorf("expected value size %d, got %d", IndexValueSize_PubkeyToAccount, index.Header.ValueSize)
+	}
+	snapshotSlot, ok := index.Header.Metadata.GetUint64(indexmeta.MetadataKey_SnapshotSlot)
+	if !ok {
+		return nil, fmt.Errorf("the snapshot slot is missing")
+	}
+	return &PubkeyToAccount_Reader{
+		file:         reader,
+		meta:         meta,
+		snapshotSlot: snapshotSlot,
+		index:        index,
+	}, nil
+}
+
+// Get returns the offset and size of the record of the account in the snapshot CAR.
+func (r *PubkeyToAccount_Reader) Get(pubkey solana.PublicKey) (*OffsetAndSize, error) {
+	value, err := r.index.Lookup(pubkey[:])
+	if err != nil {
+		return nil, err
+	}
+	oas := &OffsetAndSize{}
+	if err := oas.FromBytes(value); err != nil {
+		return nil, err
+	}
+	return oas, nil
+}
+
+// SnapshotSlot returns the slot of the account snapshot.
+func (r *PubkeyToAccount_Reader) SnapshotSlot() uint64 {
+	return r.snapshotSlot
+}
+
+func (r *PubkeyToAccount_Reader) Close() error {
+	return r.file.Close()
+}
+
+// Meta returns the metadata for the index.
+func (r *PubkeyToAccount_Reader) Meta() *Metadata {
+	return r.meta
+}
+
+func (r *PubkeyToAccount_Reader) Prefetch(b bool) {
+	r.index.Prefetch(b)
+}
+
+// Stats returns the lookup counters of the index.
+func (r *PubkeyToAccount_Reader) Stats() IndexStats {
+	return statsOf(r.index)
+}
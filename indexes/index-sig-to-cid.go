@@ -11,6 +11,7 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
 	"github.com/rpcpool/yellowstone-faithful/deprecated/compactindex36"
+	"github.com/rpcpool/yellowstone-faithful/mphindex"
 )
 
 type SigToCid_Writer struct {
@@ -18,7 +19,7 @@ type SigToCid_Writer struct {
 	tmpDir    string
 	finalPath string
 	meta      *Metadata
-	index     *compactindexsized.Builder
+	index     indexBuilder
 }
 
 const (
@@ -44,6 +45,18 @@ func NewWriter_SigToCid(
 	network Network,
 	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
 	numItems uint64,
+) (*SigToCid_Writer, error) {
+	return NewWriterWithFormat_SigToCid(epoch, rootCid, network, tmpDir, numItems, FormatCompact)
+}
+
+// NewWriterWithFormat_SigToCid creates a writer of a sig-to-cid index in the given format.
+func NewWriterWithFormat_SigToCid(
+	epoch uint64,
+	rootCid cid.Cid,
+	network Network,
+	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
+	numItems uint64,
+	format Format,
 ) (*SigToCid_Writer, error) {
 	if !IsValidNetwork(network) {
 		return nil, ErrInvalidNetwork
@@ -51,11 +64,25 @@ func NewWriter_SigToCid(
 	if rootCid == cid.Undef {
 		return nil, ErrInvalidRootCid
 	}
-	index, err := compactindexsized.NewBuilderSized(
-		tmpDir,
-		uint(numItems),
-		IndexValueSize_SigToCid,
-	)
+	var index indexBuilder
+	var err error
+	switch format {
+	case FormatCompact:
+		index, err = compactindexsized.NewBuilderSized(
+			tmpDir,
+			uint(numItems),
+			IndexValueSize_SigToCid,
+		)
+	case FormatMPH:
+		index, err = mphindex.NewBuilder(
+			tmpDir,
+			uint(numItems),
+			IndexValueSize_SigToCid,
+			MPHFingerprintSize_SigToCid,
+		)
+	default:
+		return nil, fmt.Errorf("invalid index format %q", format)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -125,6 +152,7 @@ type SigToCid_Reader struct {
 	file            io.Closer
 	meta            *Metadata
 	index           *compactindexsized.DB
+	mphIndex        *mphindex.DB
 	deprecatedIndex *compactindex36.DB
 }
 
@@ -149,6 +177,13 @@ func OpenWithReader_SigToCid(reader ReaderAtCloser) (*SigToCid_Reader, error) {
 	if isOld {
 		return OpenWithReader_SigToCid_Deprecated(reader)
 	}
+	isMPH, err := IsFileMPHFormat(reader)
+	if err != nil {
+		return nil, err
+	}
+	if isMPH {
+		return openWithReader_SigToCid_MPH(reader)
+	}
 	index, err := compactindexsized.Open(reader)
 	if err != nil {
 		return nil, err
@@ -173,6 +208,34 @@ func OpenWithReader_SigToCid(reader ReaderAtCloser) (*SigToCid_Reader, error) {
 	}, nil
 }
 
+func openWithReader_SigToCid_MPH(reader ReaderAtCloser) (*SigToCid_Reader, error) {
+	index, err := mphindex.Open(reader)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := parseDefaultMetadata(index.Header.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if !IsValidNetwork(meta.Network) {
+		return nil, fmt.Errorf("invalid network")
+	}
+	if meta.RootCid == cid.Undef {
+		return nil, fmt.Errorf("root cid is undefined")
+	}
+	if err := meta.AssertIndexKind(Kind_SigToCid); err != nil {
+		return nil, err
+	}
+	if index.Header.ValueSize != IndexValueSize_SigToCid {
+		return nil, fmt.Errorf("expected value size %d, got %d", IndexValueSize_SigToCid, index.Header.ValueSize)
+	}
+	return &SigToCid_Reader{
+		file:     reader,
+		meta:     meta,
+		mphIndex: index,
+	}, nil
+}
+
 func OpenWithReader_SigToCid_Deprecated(reader ReaderAtCloser) (*SigToCid_Reader, error) {
 	index, err := compactindex36.Open(reader)
 	if err != nil {
@@ -188,6 +251,14 @@ func (r *SigToCid_Reader) IsDeprecatedOldVersion() bool {
 	return r.deprecatedIndex != nil
 }
 
+// Format returns the format of the index (the deprecated format is reported as compact).
+func (r *SigToCid_Reader) Format() Format {
+	if r.mphIndex != nil {
+		return FormatMPH
+	}
+	return FormatCompact
+}
+
 func (r *SigToCid_Reader) Get(sig solana.Signature) (cid.Cid, error) {
 	if sig.IsZero() {
 		return cid.Undef, fmt.Errorf("sig is undefined")
@@ -205,7 +276,13 @@ func (r *SigToCid_Reader) Get(sig solana.Signature) (cid.Cid, error) {
 		return c, nil
 	}
 	key := sig[:]
-	value, err := r.index.Lookup(key)
+	var value []byte
+	var err error
+	if r.mphIndex != nil {
+		value, err = r.mphIndex.Lookup(key)
+	} else {
+		value, err = r.index.Lookup(key)
+	}
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -230,5 +307,9 @@ func (r *SigToCid_Reader) Prefetch(b bool) {
 		r.deprecatedIndex.Prefetch(b)
 		return
 	}
+	if r.mphIndex != nil {
+		r.mphIndex.Prefetch(b)
+		return
+	}
 	r.index.Prefetch(b)
 }
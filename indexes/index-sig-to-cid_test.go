@@ -127,3 +127,35 @@ func newRandomSignature() solana.Signature {
 	rand.Read(sig[:])
 	return sig
 }
+
+func TestSigToCid_MPH(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	numItems := uint64(1000)
+
+	writer, err := indexes.NewWriterWithFormat_SigToCid(123, rootCid, indexes.NetworkDevnet, "", numItems, indexes.FormatMPH)
+	require.NoError(t, err)
+	sigs := make([]solana.Signature, numItems)
+	cids := make([]cid.Cid, numItems)
+	for i := range sigs {
+		sigs[i] = newRandomSignature()
+		cids[i] = cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+		require.NoError(t, writer.Put(sigs[i], cids[i]))
+	}
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	// the format is detected when the index is opened.
+	reader, err := indexes.Open_SigToCid(writer.GetFilepath())
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, indexes.FormatMPH, reader.Format())
+	require.Equal(t, uint64(123), reader.Meta().Epoch)
+	require.Equal(t, indexes.Kind_SigToCid, reader.Meta().IndexKind)
+	for i, sig := range sigs {
+		got, err := reader.Get(sig)
+		require.NoError(t, err)
+		require.Equal(t, cids[i], got)
+	}
+	require.Equal(t, uint64(numItems), reader.Stats().Lookups)
+}
@@ -0,0 +1,202 @@
+package indexes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+)
+
+// The slot-to-blockhash index is a sidecar of the slot-to-cid index: it maps the slot of each
+// block of the epoch to its blockhash (the hash of its last entry) and to the blockhash of its
+// parent, so that getBlock doesn't need to read the parent block to return the previousBlockhash.
+
+type SlotToBlockhash_Writer struct {
+	sealed    bool
+	tmpDir    string
+	finalPath string
+	meta      *Metadata
+	index     *compactindexsized.Builder
+}
+
+const (
+	// 32 bytes for the blockhash, and 32 bytes for the previous blockhash.
+	IndexValueSize_SlotToBlockhash = 64
+)
+
+func formatFilename_SlotToBlockhash(epoch uint64, rootCid cid.Cid, network Network) string {
+	return fmt.Sprintf(
+		"epoch-%d-%s-%s-%s",
+		epoch,
+		rootCid.String(),
+		network,
+		"slot-to-blockhash.index",
+	)
+}
+
+var Kind_SlotToBlockhash = []byte("slot-to-blockhash")
+
+func NewWriter_SlotToBlockhash(
+	epoch uint64,
+	rootCid cid.Cid,
+	network Network,
+	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
+	numItems uint64,
+) (*SlotToBlockhash_Writer, error) {
+	if !IsValidNetwork(network) {
+		return nil, ErrInvalidNetwork
+	}
+	if rootCid == cid.Undef {
+		return nil, ErrInvalidRootCid
+	}
+	index, err := compactindexsized.NewBuilderSized(
+		tmpDir,
+		uint(numItems),
+		IndexValueSize_SlotToBlockhash,
+	)
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Epoch:     epoch,
+		RootCid:   rootCid,
+		Network:   network,
+		IndexKind: Kind_SlotToBlockhash,
+	}
+	if err := setDefaultMetadata(index, meta); err != nil {
+		return nil, err
+	}
+	return &SlotToBlockhash_Writer{
+		tmpDir: tmpDir,
+		meta:   meta,
+		index:  index,
+	}, nil
+}
+
+// Put adds the blockhash of the slot, and the blockhash of its parent (the zero hash if it's unknown,
+// e.g. for the first block of the epoch, whose parent is in the previous epoch).
+func (w *SlotToBlockhash_Writer) Put(slot uint64, blockhash solana.Hash, previousBlockhash solana.Hash) error {
+	if w.sealed {
+		return fmt.Errorf("cannot put to sealed writer")
+	}
+	if blockhash.IsZero() {
+		return fmt.Errorf("blockhash is zero")
+	}
+	value := make([]byte, 0, IndexValueSize_SlotToBlockhash)
+	value = append(value, blockhash[:]...)
+	value = append(value, previousBlockhash[:]...)
+	return w.index.Insert(uint64tob(slot), value)
+}
+
+func (w *SlotToBlockhash_Writer) Seal(ctx context.Context, dstDir string) error {
+	if w.sealed {
+		return fmt.Errorf("already sealed")
+	}
+
+	filepath := filepath.Join(dstDir, formatFilename_SlotToBlockhash(w.meta.Epoch, w.meta.RootCid, w.meta.Network))
+	w.finalPath = filepath
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	if err := w.index.Seal(ctx, file); err != nil {
+		return fmt.Errorf("failed to seal index: %w", err)
+	}
+	w.sealed = true
+
+	return nil
+}
+
+func (w *SlotToBlockhash_Writer) Close() error {
+	if !w.sealed {
+		return fmt.Errorf("attempted to close a slot-to-blockhash index that was not sealed")
+	}
+	return w.index.Close()
+}
+
+// GetFilepath returns the path to the sealed index file.
+func (w *SlotToBlockhash_Writer) GetFilepath() string {
+	return w.finalPath
+}
+
+type SlotToBlockhash_Reader struct {
+	file  io.Closer
+	meta  *Metadata
+	index *compactindexsized.DB
+}
+
+func Open_SlotToBlockhash(filepath string) (*SlotToBlockhash_Reader, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return OpenWithReader_SlotToBlockhash(file)
+}
+
+func OpenWithReader_SlotToBlockhash(reader ReaderAtCloser) (*SlotToBlockhash_Reader, error) {
+	index, err := compactindexsized.Open(reader)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := getDefaultMetadata(index)
+	if err != nil {
+		return nil, err
+	}
+	if !IsValidNetwork(meta.Network) {
+		return nil, fmt.Errorf("invalid network")
+	}
+	if meta.RootCid == cid.Undef {
+		return nil, fmt.Errorf("root cid is undefined")
+	}
+	if err := meta.AssertIndexKind(Kind_SlotToBlockhash); err != nil {
+		return nil, err
+	}
+	if index.Header.ValueSize != IndexValueSize_SlotToBlockhash {
+		return nil, fmt.Errorf("expected value size %d, got %d", IndexValueSize_SlotToBlockhash, index.Header.ValueSize)
+	}
+	return &SlotToBlockhash_Reader{
+		file:  reader,
+		meta:  meta,
+		index: index,
+	}, nil
+}
+
+// Get returns the blockhash of the slot, and the blockhash of its parent (the zero hash if it's unknown).
+func (r *SlotToBlockhash_Reader) Get(slot uint64) (blockhash solana.Hash, previousBlockhash solana.Hash, err error) {
+	value, err := r.index.Lookup(uint64tob(slot))
+	if err != nil {
+		return solana.Hash{}, solana.Hash{}, err
+	}
+	if len(value) != IndexValueSize_SlotToBlockhash {
+		return solana.Hash{}, solana.Hash{}, fmt.Errorf("invalid value size %d", len(value))
+	}
+	copy(blockhash[:], value[:32])
+	copy(previousBlockhash[:], value[32:])
+	return blockhash, previousBlockhash, nil
+}
+
+func (r *SlotToBlockhash_Reader) Close() error {
+	return r.file.Close()
+}
+
+// Meta returns the metadata for the index.
+func (r *SlotToBlockhash_Reader) Meta() *Metadata {
+	return r.meta
+}
+
+func (r *SlotToBlockhash_Reader) Prefetch(b bool) {
+	r.index.Prefetch(b)
+}
+
+// Stats returns the lookup counters of the index.
+func (r *SlotToBlockhash_Reader) Stats() IndexStats {
+	return statsOf(r.index)
+}
@@ -0,0 +1,63 @@
+package indexes_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotToBlockhash(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+
+	writer, err := indexes.NewWriter_SlotToBlockhash(123, rootCid, indexes.NetworkMainnet, "", 3)
+	require.NoError(t, err)
+
+	first := solana.Hash{1}
+	second := solana.Hash{2}
+	third := solana.Hash{3}
+	// the parent of the first block is in the previous epoch.
+	require.NoError(t, writer.Put(100, first, solana.Hash{}))
+	require.NoError(t, writer.Put(101, second, first))
+	// slot 102 was skipped.
+	require.NoError(t, writer.Put(103, third, second))
+	require.Error(t, writer.Put(104, solana.Hash{}, third))
+
+	require.Error(t, writer.Close())
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	reader, err := indexes.Open_SlotToBlockhash(writer.GetFilepath())
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, indexes.Kind_SlotToBlockhash, reader.Meta().IndexKind)
+	require.Equal(t, uint64(123), reader.Meta().Epoch)
+	require.Equal(t, rootCid, reader.Meta().RootCid)
+
+	blockhash, previousBlockhash, err := reader.Get(100)
+	require.NoError(t, err)
+	require.Equal(t, first, blockhash)
+	require.True(t, previousBlockhash.IsZero())
+
+	blockhash, previousBlockhash, err = reader.Get(103)
+	require.NoError(t, err)
+	require.Equal(t, third, blockhash)
+	require.Equal(t, second, previousBlockhash)
+
+	_, _, err = reader.Get(102)
+	require.ErrorIs(t, err, compactindexsized.ErrNotFound)
+
+	// the other indexes are not slot-to-blockhash indexes.
+	slotWriter, err := indexes.NewWriter_SlotToCid(123, rootCid, indexes.NetworkMainnet, "", 1)
+	require.NoError(t, err)
+	require.NoError(t, slotWriter.Put(100, rootCid))
+	require.NoError(t, slotWriter.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, slotWriter.Close())
+	_, err = indexes.Open_SlotToBlockhash(slotWriter.GetFilepath())
+	require.Error(t, err)
+}
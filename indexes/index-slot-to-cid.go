@@ -2,8 +2,10 @@ package indexes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 
@@ -17,7 +19,8 @@ type SlotToCid_Writer struct {
 	tmpDir    string
 	finalPath string
 	meta      *Metadata
-	index     *compactindexsized.Builder
+	index     indexBuilder
+	coverage  SlotCoverage
 }
 
 const (
@@ -43,6 +46,19 @@ func NewWriter_SlotToCid(
 	network Network,
 	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
 	numItems uint64,
+) (*SlotToCid_Writer, error) {
+	return NewWriterWithFormat_SlotToCid(epoch, rootCid, network, tmpDir, numItems, FormatCompact)
+}
+
+// NewWriterWithFormat_SlotToCid creates a writer of a slot-to-cid index in the given format
+// (compact or ranged).
+func NewWriterWithFormat_SlotToCid(
+	epoch uint64,
+	rootCid cid.Cid,
+	network Network,
+	tmpDir string, // Where to put the temporary index files; WILL BE DELETED.
+	numItems uint64,
+	format Format,
 ) (*SlotToCid_Writer, error) {
 	if !IsValidNetwork(network) {
 		return nil, ErrInvalidNetwork
@@ -50,11 +66,20 @@ func NewWriter_SlotToCid(
 	if rootCid == cid.Undef {
 		return nil, ErrInvalidRootCid
 	}
-	index, err := compactindexsized.NewBuilderSized(
-		tmpDir,
-		uint(numItems),
-		IndexValueSize_SlotToCid,
-	)
+	var index indexBuilder
+	var err error
+	switch format {
+	case FormatCompact:
+		index, err = compactindexsized.NewBuilderSized(
+			tmpDir,
+			uint(numItems),
+			IndexValueSize_SlotToCid,
+		)
+	case FormatRanged:
+		index = newRangedBuilder(tmpDir, uint(numItems))
+	default:
+		return nil, fmt.Errorf("invalid slot-to-cid index format %q", format)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +108,11 @@ func (w *SlotToCid_Writer) Put(slot uint64, cid_ cid.Cid) error {
 	}
 	key := uint64tob(slot)
 	value := cid_.Bytes()
-	return w.index.Insert(key, value)
+	if err := w.index.Insert(key, value); err != nil {
+		return err
+	}
+	w.coverage.add(slot)
+	return nil
 }
 
 func (w *SlotToCid_Writer) Seal(ctx context.Context, dstDir string) error {
@@ -94,6 +123,12 @@ func (w *SlotToCid_Writer) Seal(ctx context.Context, dstDir string) error {
 	filepath := filepath.Join(dstDir, formatFilename_SlotToCid(w.meta.Epoch, w.meta.RootCid, w.meta.Network))
 	w.finalPath = filepath
 
+	if w.coverage.NumBlocks > 0 {
+		if err := w.coverage.setMetadata(w.index.Metadata()); err != nil {
+			return fmt.Errorf("failed to set slot coverage metadata: %w", err)
+		}
+	}
+
 	file, err := os.Create(filepath)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
@@ -123,7 +158,9 @@ func (w *SlotToCid_Writer) GetFilepath() string {
 type SlotToCid_Reader struct {
 	file            io.Closer
 	meta            *Metadata
+	coverage        *SlotCoverage
 	index           *compactindexsized.DB
+	rangedIndex     *rangedDB
 	deprecatedIndex *compactindex36.DB
 }
 
@@ -143,6 +180,13 @@ func OpenWithReader_SlotToCid(reader ReaderAtCloser) (*SlotToCid_Reader, error)
 	if isOld {
 		return OpenWithReader_SlotToCid_Deprecated(reader)
 	}
+	isRanged, err := IsFileRangedFormat(reader)
+	if err != nil {
+		return nil, err
+	}
+	if isRanged {
+		return openWithReader_SlotToCid_Ranged(reader)
+	}
 	index, err := compactindexsized.Open(reader)
 	if err != nil {
 		return nil, err
@@ -161,9 +205,36 @@ func OpenWithReader_SlotToCid(reader ReaderAtCloser) (*SlotToCid_Reader, error)
 		return nil, err
 	}
 	return &SlotToCid_Reader{
-		file:  reader,
-		meta:  meta,
-		index: index,
+		file:     reader,
+		meta:     meta,
+		coverage: getSlotCoverage(index.Header.Metadata),
+		index:    index,
+	}, nil
+}
+
+func openWithReader_SlotToCid_Ranged(reader ReaderAtCloser) (*SlotToCid_Reader, error) {
+	index, err := openRangedDB(reader)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := parseDefaultMetadata(index.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if !IsValidNetwork(meta.Network) {
+		return nil, fmt.Errorf("invalid network")
+	}
+	if meta.RootCid == cid.Undef {
+		return nil, fmt.Errorf("root cid is undefined")
+	}
+	if err := meta.AssertIndexKind(Kind_SlotToCid); err != nil {
+		return nil, err
+	}
+	return &SlotToCid_Reader{
+		file:        reader,
+		meta:        meta,
+		coverage:    getSlotCoverage(index.Metadata),
+		rangedIndex: index,
 	}, nil
 }
 
@@ -182,6 +253,14 @@ func (r *SlotToCid_Reader) IsDeprecatedOldVersion() bool {
 	return r.deprecatedIndex != nil
 }
 
+// Format returns the format of the index (the deprecated format is reported as compact).
+func (r *SlotToCid_Reader) Format() Format {
+	if r.rangedIndex != nil {
+		return FormatRanged
+	}
+	return FormatCompact
+}
+
 func (r *SlotToCid_Reader) Get(slot uint64) (cid.Cid, error) {
 	if r.IsDeprecatedOldVersion() {
 		key := uint64tob(slot)
@@ -195,6 +274,17 @@ func (r *SlotToCid_Reader) Get(slot uint64) (cid.Cid, error) {
 		}
 		return c, nil
 	}
+	if r.rangedIndex != nil {
+		value, err := r.rangedIndex.Lookup(slot)
+		if err != nil {
+			return cid.Undef, err
+		}
+		_, c, err := cid.CidFromBytes(value)
+		if err != nil {
+			return cid.Undef, err
+		}
+		return c, nil
+	}
 	key := uint64tob(slot)
 	value, err := r.index.Lookup(key)
 	if err != nil {
@@ -207,6 +297,36 @@ func (r *SlotToCid_Reader) Get(slot uint64) (cid.Cid, error) {
 	return c, nil
 }
 
+// Range calls fn with the indexed slots in [from, to], and their CIDs, in order of slot.
+// The ranged format reads the CIDs of consecutive slots at once; the other formats
+// look up each slot of the range.
+func (r *SlotToCid_Reader) Range(from, to uint64, fn func(slot uint64, c cid.Cid) error) error {
+	if r.rangedIndex != nil {
+		return r.rangedIndex.Range(from, to, func(slot uint64, value []byte) error {
+			_, c, err := cid.CidFromBytes(value)
+			if err != nil {
+				return fmt.Errorf("invalid CID of slot %d: %w", slot, err)
+			}
+			return fn(slot, c)
+		})
+	}
+	for slot := from; slot <= to; slot++ {
+		c, err := r.Get(slot)
+		switch {
+		case err == nil:
+			if err := fn(slot, c); err != nil {
+				return err
+			}
+		case !errors.Is(err, compactindexsized.ErrNotFound) && !errors.Is(err, compactindex36.ErrNotFound):
+			return err
+		}
+		if slot == math.MaxUint64 {
+			break
+		}
+	}
+	return nil
+}
+
 func (r *SlotToCid_Reader) Close() error {
 	return r.file.Close()
 }
@@ -216,10 +336,23 @@ func (r *SlotToCid_Reader) Meta() *Metadata {
 	return r.meta
 }
 
+// Coverage returns the slots of the indexed blocks, or false if the index
+// was built before they were stored.
+func (r *SlotToCid_Reader) Coverage() (SlotCoverage, bool) {
+	if r.coverage == nil {
+		return SlotCoverage{}, false
+	}
+	return *r.coverage, true
+}
+
 func (r *SlotToCid_Reader) Prefetch(b bool) {
 	if r.IsDeprecatedOldVersion() {
 		r.deprecatedIndex.Prefetch(b)
 		return
 	}
+	if r.rangedIndex != nil {
+		// the runs are loaded when the index is opened.
+		return
+	}
 	r.index.Prefetch(b)
 }
@@ -114,4 +114,15 @@ func TestSlotToCid(t *testing.T) {
 		require.Equal(t, indexes.NetworkMainnet, metadata.Network)
 		require.Equal(t, indexes.Kind_SlotToCid, metadata.IndexKind)
 	}
+
+	// check the slot coverage
+	{
+		coverage, ok := reader.Coverage()
+		require.True(t, ok)
+		require.Equal(t, indexes.SlotCoverage{FirstSlot: 0, LastSlot: 123456789, NumBlocks: numItems}, coverage)
+		require.True(t, coverage.Contains(0))
+		require.True(t, coverage.Contains(124))
+		require.False(t, coverage.Contains(123456790))
+		require.Equal(t, uint64(123456790)-numItems, coverage.NumSkipped())
+	}
 }
@@ -48,7 +48,7 @@ func (m *Metadata) AssertIndexKind(x []byte) error {
 	return nil
 }
 
-func setDefaultMetadata(index *compactindexsized.Builder, metadata *Metadata) error {
+func setDefaultMetadata(index interface{ Metadata() *indexmeta.Meta }, metadata *Metadata) error {
 	if index == nil {
 		return fmt.Errorf("index is nil")
 	}
@@ -84,8 +84,12 @@ func setDefaultMetadata(index *compactindexsized.Builder, metadata *Metadata) er
 // getDefaultMetadata gets and validates the metadata from the index.
 // Will return an error if some of the metadata is missing.
 func getDefaultMetadata(index *compactindexsized.DB) (*Metadata, error) {
+	return parseDefaultMetadata(index.Header.Metadata)
+}
+
+// parseDefaultMetadata gets and validates the metadata of an index of any format.
+func parseDefaultMetadata(meta *indexmeta.Meta) (*Metadata, error) {
 	out := &Metadata{}
-	meta := index.Header.Metadata
 
 	indexKind, ok := meta.Get(indexmeta.MetadataKey_Kind)
 	if ok {
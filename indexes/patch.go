@@ -0,0 +1,170 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// PatchRecord is the audit record of the patching of entries of an index, kept in the metadata
+// of the index.
+type PatchRecord struct {
+	Time       time.Time
+	NumEntries uint32
+	// Note is why the entries were patched (truncated to fit in the metadata).
+	Note string
+}
+
+const patchRecordFixedLen = 8 + 4
+
+// Bytes returns the record, as stored in the metadata.
+func (r PatchRecord) Bytes() []byte {
+	note := r.Note
+	if len(note) > indexmeta.MaxValueSize-patchRecordFixedLen {
+		note = note[:indexmeta.MaxValueSize-patchRecordFixedLen]
+	}
+	buf := make([]byte, patchRecordFixedLen, patchRecordFixedLen+len(note))
+	binary.LittleEndian.PutUint64(buf[0:8], uint64(r.Time.Unix()))
+	binary.LittleEndian.PutUint32(buf[8:12], r.NumEntries)
+	return append(buf, note...)
+}
+
+// FromBytes parses a record stored in the metadata.
+func (r *PatchRecord) FromBytes(buf []byte) error {
+	if len(buf) < patchRecordFixedLen {
+		return fmt.Errorf("invalid patch record length %d", len(buf))
+	}
+	r.Time = time.Unix(int64(binary.LittleEndian.Uint64(buf[0:8])), 0).UTC()
+	r.NumEntries = binary.LittleEndian.Uint32(buf[8:12])
+	r.Note = string(buf[patchRecordFixedLen:])
+	return nil
+}
+
+// PatchRecordsOf returns the audit records of the patches of the index, oldest first.
+func PatchRecordsOf(meta *indexmeta.Meta) ([]PatchRecord, error) {
+	var records []PatchRecord
+	for _, value := range meta.GetAll(indexmeta.MetadataKey_Patch) {
+		var record PatchRecord
+		if err := record.FromBytes(value); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// ParsePatch parses the key and the new value of an entry of an index of the kind:
+//   - cid-to-offset-and-size: a CID, and "<offset>:<size>";
+//   - slot-to-cid: a slot, and a CID;
+//   - sig-to-cid: a base58 signature, and a CID.
+func ParsePatch(kind []byte, key string, value string) (compactindexsized.Patch, error) {
+	switch {
+	case bytes.Equal(kind, Kind_CidToOffsetAndSize):
+		c, err := cid.Parse(key)
+		if err != nil {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid CID %q: %w", key, err)
+		}
+		offsetStr, sizeStr, ok := strings.Cut(value, ":")
+		if !ok {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid offset and size %q: want <offset>:<size>", value)
+		}
+		offset, err := strconv.ParseUint(offsetStr, 10, 64)
+		if err != nil {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid offset %q: %w", offsetStr, err)
+		}
+		size, err := strconv.ParseUint(sizeStr, 10, 64)
+		if err != nil {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid size %q: %w", sizeStr, err)
+		}
+		oas := NewOffsetAndSize(offset, size)
+		if !oas.IsValid() {
+			return compactindexsized.Patch{}, fmt.Errorf("offset %d or size %d is too large", offset, size)
+		}
+		return compactindexsized.Patch{Key: c.Bytes(), Value: oas.Bytes()}, nil
+	case bytes.Equal(kind, Kind_SlotToCid):
+		slot, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid slot %q: %w", key, err)
+		}
+		c, err := parsePatchCid(value, IndexValueSize_SlotToCid)
+		if err != nil {
+			return compactindexsized.Patch{}, err
+		}
+		return compactindexsized.Patch{Key: uint64tob(slot), Value: c}, nil
+	case bytes.Equal(kind, Kind_SigToCid):
+		sig, err := solana.SignatureFromBase58(key)
+		if err != nil {
+			return compactindexsized.Patch{}, fmt.Errorf("invalid signature %q: %w", key, err)
+		}
+		c, err := parsePatchCid(value, IndexValueSize_SigToCid)
+		if err != nil {
+			return compactindexsized.Patch{}, err
+		}
+		return compactindexsized.Patch{Key: sig[:], Value: c}, nil
+	default:
+		return compactindexsized.Patch{}, fmt.Errorf("the entries of %q indexes can't be patched", kind)
+	}
+}
+
+// parsePatchCid parses a CID value, zero-padded to the value size (as inserted by the writers).
+func parsePatchCid(value string, valueSize int) ([]byte, error) {
+	c, err := cid.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID %q: %w", value, err)
+	}
+	buf := c.Bytes()
+	if len(buf) > valueSize {
+		return nil, fmt.Errorf("CID %s is longer than %d bytes", c, valueSize)
+	}
+	return append(buf, make([]byte, valueSize-len(buf))...), nil
+}
+
+// Patch writes the compact index read from src to dst, with the new values of the entries of
+// the keys, and the record of the patch appended to its metadata. The keys must be keys of the
+// index (see compactindexsized.ApplyPatches). dst should be empty.
+func Patch(ctx context.Context, src io.ReaderAt, dst *os.File, patches []compactindexsized.Patch, record PatchRecord) error {
+	index, meta, err := openForPatch(src, patches, record)
+	if err != nil {
+		return err
+	}
+	return compactindexsized.ApplyPatches(ctx, index, dst, meta, patches)
+}
+
+// PlanPatch returns the size and the number of entries of the index that Patch would write,
+// without writing it; like Patch, it fails if a key is not a key of the index.
+func PlanPatch(ctx context.Context, src io.ReaderAt, patches []compactindexsized.Patch, record PatchRecord) (*compactindexsized.RewriteStats, error) {
+	index, meta, err := openForPatch(src, patches, record)
+	if err != nil {
+		return nil, err
+	}
+	return compactindexsized.PlanPatches(ctx, index, meta, patches)
+}
+
+// openForPatch opens the compact index read from src, and returns its metadata with the record
+// of the patch.
+func openForPatch(src io.ReaderAt, patches []compactindexsized.Patch, record PatchRecord) (*compactindexsized.DB, *indexmeta.Meta, error) {
+	index, err := openCompact(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := getDefaultMetadata(index); err != nil {
+		return nil, nil, err
+	}
+	meta := &indexmeta.Meta{KeyVals: append([]indexmeta.KV(nil), index.Header.Metadata.KeyVals...)}
+	record.NumEntries = uint32(len(patches))
+	if err := meta.Add(indexmeta.MetadataKey_Patch, record.Bytes()); err != nil {
+		return nil, nil, fmt.Errorf("failed to add the patch record: %w", err)
+	}
+	return index, meta, nil
+}
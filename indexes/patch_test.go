@@ -0,0 +1,71 @@
+package indexes_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatch(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	numItems := uint64(1000)
+
+	writer, err := indexes.NewWriter_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", numItems)
+	require.NoError(t, err)
+	cids := make([]cid.Cid, numItems)
+	for i := range cids {
+		cids[i] = cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+		require.NoError(t, writer.Put(cids[i], uint64(i)*100, 100))
+	}
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	patch, err := indexes.ParsePatch(indexes.Kind_CidToOffsetAndSize, cids[42].String(), "123456:789")
+	require.NoError(t, err)
+	_, err = indexes.ParsePatch(indexes.Kind_CidToOffsetAndSize, cids[42].String(), "123456")
+	require.Error(t, err)
+
+	src, err := os.Open(writer.GetFilepath())
+	require.NoError(t, err)
+	defer src.Close()
+	dstPath := filepath.Join(t.TempDir(), "patched.index")
+	dst, err := os.Create(dstPath)
+	require.NoError(t, err)
+	patchedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, indexes.Patch(context.TODO(), src, dst, []compactindexsized.Patch{patch}, indexes.PatchRecord{
+		Time: patchedAt,
+		Note: "block 42 was mis-extracted",
+	}))
+	require.NoError(t, dst.Close())
+
+	reader, err := indexes.Open_CidToOffsetAndSize(dstPath)
+	require.NoError(t, err)
+	defer reader.Close()
+	for i, c := range cids {
+		got, err := reader.Get(c)
+		require.NoError(t, err)
+		if i == 42 {
+			require.Equal(t, indexes.NewOffsetAndSize(123456, 789), got)
+		} else {
+			require.Equal(t, indexes.NewOffsetAndSize(uint64(i)*100, 100), got)
+		}
+	}
+
+	patched, err := os.Open(dstPath)
+	require.NoError(t, err)
+	defer patched.Close()
+	db, err := compactindexsized.Open(patched)
+	require.NoError(t, err)
+	records, err := indexes.PatchRecordsOf(db.Header.Metadata)
+	require.NoError(t, err)
+	require.Equal(t, []indexes.PatchRecord{{Time: patchedAt, NumEntries: 1, Note: "block 42 was mis-extracted"}}, records)
+}
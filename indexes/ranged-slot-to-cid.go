@@ -0,0 +1,363 @@
+package indexes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// The ranged format of the slot-to-cid index exploits the contiguity of the slots of an epoch:
+// instead of hashing each slot, it stores the sorted slots as runs of consecutive slots
+// (a frame of reference: the first slot of the index, and the offset to it of the start of each
+// run, with the length of the run), and the CIDs in the order of the slots, without the prefix
+// that they all share (e.g. the version, codec and multihash type of a CIDv1). The runs are loaded
+// in memory when the index is opened (8 bytes for each skipped range), and a lookup is a binary
+// search of the runs and one read of the CID; a range of slots is read with a single read.
+//
+// Layout (little endian):
+//
+//	magic [8]byte
+//	headerLen uint32 (the size of what follows, up to the runs)
+//	version uint8
+//	baseSlot uint64
+//	numEntries uint64
+//	numRuns uint32
+//	cidPrefixLen uint8, cidPrefix [cidPrefixLen]byte
+//	cidSuffixSize uint8
+//	metadata (indexmeta)
+//	runs [numRuns]{startOffset uint32, length uint32}
+//	cidSuffixes [numEntries][cidSuffixSize]byte
+
+// RangedMagic are the first 8 bytes of a slot-to-cid index in the ranged format.
+var RangedMagic = [8]byte{'r', 'n', 'g', 's', 'l', 'o', 't', 's'}
+
+const rangedVersion = 1
+
+// IsFileRangedFormat returns whether the index is in the ranged format.
+func IsFileRangedFormat(file io.ReaderAt) (bool, error) {
+	var magic [8]byte
+	if _, err := file.ReadAt(magic[:], 0); err != nil {
+		return false, fmt.Errorf("failed to read magic: %w", err)
+	}
+	return magic == RangedMagic, nil
+}
+
+// slotRun is a run of consecutive slots.
+type slotRun struct {
+	start  uint32 // offset to the base slot.
+	length uint32
+	// index is the index of the entry of the first slot of the run (computed when the index is opened).
+	index uint64
+}
+
+type rangedEntry struct {
+	slot uint64
+	cid  []byte
+}
+
+// rangedBuilder builds a ranged slot-to-cid index; the entries are kept in memory
+// (an epoch has at most 432000 slots).
+type rangedBuilder struct {
+	tmpDir   string
+	metadata indexmeta.Meta
+	entries  []rangedEntry
+}
+
+func newRangedBuilder(tmpDir string, numItems uint) *rangedBuilder {
+	return &rangedBuilder{
+		tmpDir:  tmpDir,
+		entries: make([]rangedEntry, 0, numItems),
+	}
+}
+
+func (b *rangedBuilder) Metadata() *indexmeta.Meta {
+	return &b.metadata
+}
+
+func (b *rangedBuilder) Insert(key []byte, value []byte) error {
+	if len(key) != 8 {
+		return fmt.Errorf("expected a slot of 8 bytes, got %d", len(key))
+	}
+	if len(value) == 0 || len(value) > math.MaxUint8 {
+		return fmt.Errorf("invalid CID size %d", len(value))
+	}
+	b.entries = append(b.entries, rangedEntry{
+		slot: btoUint64(key),
+		cid:  bytes.Clone(value),
+	})
+	return nil
+}
+
+func (b *rangedBuilder) Seal(ctx context.Context, file *os.File) error {
+	sort.Slice(b.entries, func(i, j int) bool {
+		return b.entries[i].slot < b.entries[j].slot
+	})
+	var baseSlot uint64
+	var prefix []byte
+	var runs []slotRun
+	for i, entry := range b.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i == 0 {
+			baseSlot = entry.slot
+			prefix = entry.cid
+		} else {
+			if entry.slot == b.entries[i-1].slot {
+				return fmt.Errorf("duplicate slot %d", entry.slot)
+			}
+			if len(entry.cid) != len(b.entries[0].cid) {
+				return fmt.Errorf("the CIDs have different sizes (%d and %d bytes); use the compact format", len(b.entries[0].cid), len(entry.cid))
+			}
+			prefix = prefix[:commonPrefixLen(prefix, entry.cid)]
+		}
+		if entry.slot-baseSlot > math.MaxUint32 {
+			return fmt.Errorf("slot %d is too far from the first slot %d", entry.slot, baseSlot)
+		}
+		offset := uint32(entry.slot - baseSlot)
+		if last := len(runs) - 1; last >= 0 && uint64(runs[last].start)+uint64(runs[last].length) == uint64(offset) {
+			runs[last].length++
+		} else {
+			runs = append(runs, slotRun{start: offset, length: 1})
+		}
+	}
+	if len(b.entries) > 0 && len(prefix) == len(b.entries[0].cid) {
+		// a single entry: keep a suffix of at least one byte.
+		prefix = prefix[:len(prefix)-1]
+	}
+	var suffixSize int
+	if len(b.entries) > 0 {
+		suffixSize = len(b.entries[0].cid) - len(prefix)
+	}
+
+	metadata, err := b.metadata.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	var header bytes.Buffer
+	header.WriteByte(rangedVersion)
+	binary.Write(&header, binary.LittleEndian, baseSlot)
+	binary.Write(&header, binary.LittleEndian, uint64(len(b.entries)))
+	binary.Write(&header, binary.LittleEndian, uint32(len(runs)))
+	header.WriteByte(byte(len(prefix)))
+	header.Write(prefix)
+	header.WriteByte(byte(suffixSize))
+	header.Write(metadata)
+
+	w := bufio.NewWriterSize(file, 1<<20)
+	w.Write(RangedMagic[:])
+	binary.Write(w, binary.LittleEndian, uint32(header.Len()))
+	w.Write(header.Bytes())
+	for _, run := range runs {
+		binary.Write(w, binary.LittleEndian, run.start)
+		binary.Write(w, binary.LittleEndian, run.length)
+	}
+	for _, entry := range b.entries {
+		if _, err := w.Write(entry.cid[len(prefix):]); err != nil {
+			return fmt.Errorf("failed to write CIDs: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+func (b *rangedBuilder) Close() error {
+	b.entries = nil
+	return os.RemoveAll(b.tmpDir)
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// rangedDB is an open ranged slot-to-cid index.
+type rangedDB struct {
+	reader        io.ReaderAt
+	Metadata      *indexmeta.Meta
+	baseSlot      uint64
+	numEntries    uint64
+	runs          []slotRun
+	cidPrefix     []byte
+	cidSuffixSize int
+	cidsOffset    int64
+
+	lookups  atomic.Uint64
+	notFound atomic.Uint64
+	failures atomic.Uint64
+	read     atomic.Uint64
+}
+
+func openRangedDB(reader io.ReaderAt) (*rangedDB, error) {
+	var fixed [12]byte
+	if _, err := reader.ReadAt(fixed[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if *(*[8]byte)(fixed[:8]) != RangedMagic {
+		return nil, errors.New("not a ranged slot-to-cid index")
+	}
+	headerLen := binary.LittleEndian.Uint32(fixed[8:])
+	if headerLen < 23 || headerLen > 1<<20 {
+		return nil, fmt.Errorf("invalid header size %d", headerLen)
+	}
+	header := make([]byte, headerLen)
+	if _, err := reader.ReadAt(header, 12); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if header[0] != rangedVersion {
+		return nil, fmt.Errorf("unsupported ranged index version %d", header[0])
+	}
+	db := &rangedDB{
+		reader:     reader,
+		Metadata:   new(indexmeta.Meta),
+		baseSlot:   binary.LittleEndian.Uint64(header[1:9]),
+		numEntries: binary.LittleEndian.Uint64(header[9:17]),
+	}
+	numRuns := binary.LittleEndian.Uint32(header[17:21])
+	rest := header[21:]
+	prefixLen := int(rest[0])
+	if len(rest) < 2+prefixLen {
+		return nil, errors.New("truncated header")
+	}
+	db.cidPrefix = bytes.Clone(rest[1 : 1+prefixLen])
+	db.cidSuffixSize = int(rest[1+prefixLen])
+	if err := db.Metadata.UnmarshalBinary(rest[2+prefixLen:]); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+
+	runsBuf := make([]byte, 8*int64(numRuns))
+	runsOffset := int64(12) + int64(headerLen)
+	if _, err := reader.ReadAt(runsBuf, runsOffset); err != nil {
+		return nil, fmt.Errorf("failed to read runs: %w", err)
+	}
+	db.runs = make([]slotRun, numRuns)
+	var index uint64
+	for i := range db.runs {
+		db.runs[i] = slotRun{
+			start:  binary.LittleEndian.Uint32(runsBuf[8*i:]),
+			length: binary.LittleEndian.Uint32(runsBuf[8*i+4:]),
+			index:  index,
+		}
+		index += uint64(db.runs[i].length)
+	}
+	if index != db.numEntries {
+		return nil, fmt.Errorf("the runs have %d slots, expected %d", index, db.numEntries)
+	}
+	db.cidsOffset = runsOffset + int64(len(runsBuf))
+	return db, nil
+}
+
+// entryIndex returns the index of the entry of the slot, or false if the slot is not in the index.
+func (db *rangedDB) entryIndex(slot uint64) (uint64, bool) {
+	if slot < db.baseSlot || slot-db.baseSlot > math.MaxUint32 {
+		return 0, false
+	}
+	offset := uint32(slot - db.baseSlot)
+	// the first run that ends after the offset.
+	i := sort.Search(len(db.runs), func(i int) bool {
+		return uint64(db.runs[i].start)+uint64(db.runs[i].length) > uint64(offset)
+	})
+	if i == len(db.runs) || db.runs[i].start > offset {
+		return 0, false
+	}
+	return db.runs[i].index + uint64(offset-db.runs[i].start), true
+}
+
+// readCids reads the CIDs of the entries [first, first+count).
+func (db *rangedDB) readCids(first uint64, count int) ([][]byte, error) {
+	buf := make([]byte, count*db.cidSuffixSize)
+	if _, err := db.reader.ReadAt(buf, db.cidsOffset+int64(first)*int64(db.cidSuffixSize)); err != nil {
+		return nil, err
+	}
+	db.read.Add(uint64(len(buf)))
+	out := make([][]byte, count)
+	for i := range out {
+		out[i] = append(bytes.Clone(db.cidPrefix), buf[i*db.cidSuffixSize:(i+1)*db.cidSuffixSize]...)
+	}
+	return out, nil
+}
+
+// Lookup returns the CID of the slot, or compactindexsized.ErrNotFound.
+func (db *rangedDB) Lookup(slot uint64) ([]byte, error) {
+	db.lookups.Add(1)
+	index, ok := db.entryIndex(slot)
+	if !ok {
+		db.notFound.Add(1)
+		return nil, compactindexsized.ErrNotFound
+	}
+	cids, err := db.readCids(index, 1)
+	if err != nil {
+		db.failures.Add(1)
+		return nil, err
+	}
+	return cids[0], nil
+}
+
+// maxRangeBatch is the largest number of CIDs read at once when iterating over a range.
+const maxRangeBatch = 4096
+
+// Range calls fn with the slots in [from, to] that are in the index, and their CIDs, in order.
+func (db *rangedDB) Range(from, to uint64, fn func(slot uint64, cid []byte) error) error {
+	for _, run := range db.runs {
+		runFirst := db.baseSlot + uint64(run.start)
+		runLast := runFirst + uint64(run.length) - 1
+		if runLast < from {
+			continue
+		}
+		if runFirst > to {
+			return nil
+		}
+		first, last := runFirst, runLast
+		if first < from {
+			first = from
+		}
+		if last > to {
+			last = to
+		}
+		for slot := first; slot <= last; {
+			count := last - slot + 1
+			if count > maxRangeBatch {
+				count = maxRangeBatch
+			}
+			cids, err := db.readCids(run.index+(slot-runFirst), int(count))
+			if err != nil {
+				return err
+			}
+			for i, c := range cids {
+				if err := fn(slot+uint64(i), c); err != nil {
+					return err
+				}
+			}
+			slot += count
+		}
+	}
+	return nil
+}
+
+// Stats returns the lookup counters of the index.
+func (db *rangedDB) Stats() compactindexsized.Stats {
+	return compactindexsized.Stats{
+		Lookups:  db.lookups.Load(),
+		NotFound: db.notFound.Load(),
+		Failures: db.failures.Load(),
+		// the runs are in memory.
+		EntryProbes: db.lookups.Load() - db.notFound.Load(),
+		BytesRead:   db.read.Load(),
+	}
+}
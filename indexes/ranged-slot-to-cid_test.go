@@ -0,0 +1,100 @@
+package indexes_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotToCid_Ranged(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+
+	// an epoch, with some skipped slots.
+	firstSlot := uint64(123 * 432000)
+	cids := make(map[uint64]cid.Cid)
+	for i := uint64(0); i < 10000; i++ {
+		if i%7 == 3 || (i >= 5000 && i < 5100) {
+			continue
+		}
+		cids[firstSlot+i] = cid.NewCidV1(cid.DagCBOR, []byte(fmt.Sprintf("block-%d", i)))
+	}
+
+	build := func(format indexes.Format) string {
+		writer, err := indexes.NewWriterWithFormat_SlotToCid(123, rootCid, indexes.NetworkMainnet, t.TempDir(), uint64(len(cids)), format)
+		require.NoError(t, err)
+		for slot, c := range cids {
+			require.NoError(t, writer.Put(slot, c))
+		}
+		dstDir := t.TempDir()
+		require.NoError(t, writer.Seal(context.TODO(), dstDir))
+		require.NoError(t, writer.Close())
+		return writer.GetFilepath()
+	}
+	compactPath := build(indexes.FormatCompact)
+	rangedPath := build(indexes.FormatRanged)
+
+	compactInfo, err := os.Stat(compactPath)
+	require.NoError(t, err)
+	rangedInfo, err := os.Stat(rangedPath)
+	require.NoError(t, err)
+	require.Less(t, rangedInfo.Size(), compactInfo.Size())
+
+	reader, err := indexes.Open_SlotToCid(rangedPath)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, indexes.FormatRanged, reader.Format())
+	require.Equal(t, indexes.Kind_SlotToCid, reader.Meta().IndexKind)
+	require.Equal(t, uint64(123), reader.Meta().Epoch)
+
+	for slot, c := range cids {
+		got, err := reader.Get(slot)
+		require.NoError(t, err)
+		require.Equal(t, c, got)
+	}
+	for _, slot := range []uint64{0, firstSlot - 1, firstSlot + 3, firstSlot + 5050, firstSlot + 10000} {
+		_, err := reader.Get(slot)
+		require.ErrorIs(t, err, compactindexsized.ErrNotFound)
+	}
+
+	coverage, ok := reader.Coverage()
+	require.True(t, ok)
+	require.Equal(t, uint64(len(cids)), coverage.NumBlocks)
+	require.Equal(t, firstSlot, coverage.FirstSlot)
+
+	// the range iteration returns the same slots, in order, for both formats.
+	compactReader, err := indexes.Open_SlotToCid(compactPath)
+	require.NoError(t, err)
+	defer compactReader.Close()
+	require.Equal(t, indexes.FormatCompact, compactReader.Format())
+	collect := func(r *indexes.SlotToCid_Reader, from, to uint64) []uint64 {
+		var slots []uint64
+		require.NoError(t, r.Range(from, to, func(slot uint64, c cid.Cid) error {
+			require.Equal(t, cids[slot], c)
+			slots = append(slots, slot)
+			return nil
+		}))
+		return slots
+	}
+	for _, r := range [][2]uint64{
+		{firstSlot, firstSlot + 20},
+		{firstSlot + 4990, firstSlot + 5110},
+		{firstSlot - 10, firstSlot + 2},
+		{firstSlot + 9990, firstSlot + 10010},
+	} {
+		ranged := collect(reader, r[0], r[1])
+		require.NotEmpty(t, ranged)
+		require.Equal(t, collect(compactReader, r[0], r[1]), ranged)
+	}
+	require.Len(t, collect(reader, 0, firstSlot+20000), len(cids))
+
+	stats := reader.Stats()
+	require.Equal(t, uint64(len(cids)+5), stats.Lookups)
+	require.Equal(t, uint64(5), stats.NotFound)
+}
@@ -0,0 +1,78 @@
+package indexes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+)
+
+// valueFieldsOfKind returns the fields of the values of the indexes of the kind, if they can be
+// packed.
+func valueFieldsOfKind(kind []byte) ([]uint8, bool) {
+	switch {
+	case bytes.Equal(kind, Kind_CidToOffsetAndSize):
+		return valueFields_CidToOffsetAndSize, true
+	default:
+		return nil, false
+	}
+}
+
+// Repack writes the compact index read from src to dst, with its values in the given encoding;
+// the metadata and the buckets of the index are kept. dst should be empty.
+func Repack(ctx context.Context, src io.ReaderAt, dst *os.File, encoding ValueEncoding) error {
+	index, fields, err := openForRepack(src, encoding)
+	if err != nil {
+		return err
+	}
+	return compactindexsized.Repack(ctx, index, dst, fields)
+}
+
+// PlanRepack returns the size and the number of entries of the index that Repack would write,
+// without writing it.
+func PlanRepack(ctx context.Context, src io.ReaderAt, encoding ValueEncoding) (*compactindexsized.RewriteStats, error) {
+	index, fields, err := openForRepack(src, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return compactindexsized.PlanRepack(ctx, index, fields)
+}
+
+// openForRepack opens the compact index read from src, and returns the value fields of the
+// encoding.
+func openForRepack(src io.ReaderAt, encoding ValueEncoding) (*compactindexsized.DB, []uint8, error) {
+	if isMPH, err := IsFileMPHFormat(src); err != nil {
+		return nil, nil, err
+	} else if isMPH {
+		return nil, nil, fmt.Errorf("indexes in the %s format have no value encoding", FormatMPH)
+	}
+	if isRanged, err := IsFileRangedFormat(src); err != nil {
+		return nil, nil, err
+	} else if isRanged {
+		return nil, nil, fmt.Errorf("indexes in the %s format have no value encoding", FormatRanged)
+	}
+	index, err := compactindexsized.Open(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	meta, err := getDefaultMetadata(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fields []uint8
+	switch encoding {
+	case ValueEncodingPlain:
+	case ValueEncodingPacked:
+		var ok bool
+		fields, ok = valueFieldsOfKind(meta.IndexKind)
+		if !ok {
+			return nil, nil, fmt.Errorf("the values of %q indexes can't be packed", meta.IndexKind)
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid value encoding %q", encoding)
+	}
+	return index, fields, nil
+}
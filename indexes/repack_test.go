@@ -0,0 +1,63 @@
+package indexes_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepack(t *testing.T) {
+	rootCid, err := cid.Parse("bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy")
+	require.NoError(t, err)
+	numItems := uint64(1000)
+
+	writer, err := indexes.NewWriter_CidToOffsetAndSize(123, rootCid, indexes.NetworkMainnet, "", numItems)
+	require.NoError(t, err)
+	cids := make([]cid.Cid, numItems)
+	for i := range cids {
+		cids[i] = cid.NewCidV1(cid.Raw, []byte(fmt.Sprintf("cid-%d", i)))
+		require.NoError(t, writer.Put(cids[i], uint64(i)*1_000_003, uint64(i%700)))
+	}
+	require.NoError(t, writer.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, writer.Close())
+
+	src, err := os.Open(writer.GetFilepath())
+	require.NoError(t, err)
+	defer src.Close()
+	dstPath := filepath.Join(t.TempDir(), "repacked.index")
+	dst, err := os.Create(dstPath)
+	require.NoError(t, err)
+	require.NoError(t, indexes.Repack(context.TODO(), src, dst, indexes.ValueEncodingPacked))
+	require.NoError(t, dst.Close())
+
+	reader, err := indexes.Open_CidToOffsetAndSize(dstPath)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.Equal(t, indexes.ValueEncodingPacked, reader.ValueEncoding())
+	require.Equal(t, uint64(123), reader.Meta().Epoch)
+	for i, c := range cids {
+		got, err := reader.Get(c)
+		require.NoError(t, err)
+		require.Equal(t, indexes.NewOffsetAndSize(uint64(i)*1_000_003, uint64(i%700)), got)
+	}
+
+	// the values of the other kinds of indexes are not made of integers.
+	slotWriter, err := indexes.NewWriter_SlotToCid(123, rootCid, indexes.NetworkMainnet, "", 1)
+	require.NoError(t, err)
+	require.NoError(t, slotWriter.Put(1, rootCid))
+	require.NoError(t, slotWriter.Seal(context.TODO(), t.TempDir()))
+	require.NoError(t, slotWriter.Close())
+	slotIndex, err := os.Open(slotWriter.GetFilepath())
+	require.NoError(t, err)
+	defer slotIndex.Close()
+	dst, err = os.Create(filepath.Join(t.TempDir(), "slot-to-cid.index"))
+	require.NoError(t, err)
+	defer dst.Close()
+	require.Error(t, indexes.Repack(context.TODO(), slotIndex, dst, indexes.ValueEncodingPacked))
+}
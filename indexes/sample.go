@@ -0,0 +1,78 @@
+package indexes
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+)
+
+// ErrSamplingUnsupported is the error of the sampling of an index in a format whose entries
+// can't be matched to their keys (the deprecated formats, mph, and ranged).
+var ErrSamplingUnsupported = errors.New("the entries of the index can't be sampled")
+
+// Sample is an entry of an index picked at random: its value, and whether a key is its key
+// (use the method of the key of the index).
+type Sample[V any] struct {
+	Value V
+	entry *compactindexsized.SampledEntry
+}
+
+// IsCid returns whether the CID is the key of the entry of a cid-to-offset-and-size index.
+func (s *Sample[V]) IsCid(c cid.Cid) bool {
+	return s.entry.IsKey(c.Bytes())
+}
+
+// IsSlot returns whether the slot is the key of the entry of a slot-to-cid index.
+func (s *Sample[V]) IsSlot(slot uint64) bool {
+	return s.entry.IsKey(uint64tob(slot))
+}
+
+// IsSignature returns whether the signature is the key of the entry of a sig-to-cid index.
+func (s *Sample[V]) IsSignature(sig solana.Signature) bool {
+	return s.entry.IsKey(sig[:])
+}
+
+// Sample returns an entry of the index picked at random.
+func (r *CidToOffsetAndSize_Reader) Sample(rng *rand.Rand) (*Sample[*OffsetAndSize], error) {
+	entry, err := r.index.SampleEntry(rng)
+	if err != nil {
+		return nil, err
+	}
+	var oas OffsetAndSize
+	if err := oas.FromBytes(entry.Value); err != nil {
+		return nil, fmt.Errorf("invalid offset and size: %w", err)
+	}
+	return &Sample[*OffsetAndSize]{Value: &oas, entry: entry}, nil
+}
+
+// Sample returns an entry of the index picked at random.
+func (r *SlotToCid_Reader) Sample(rng *rand.Rand) (*Sample[cid.Cid], error) {
+	if r.IsDeprecatedOldVersion() || r.rangedIndex != nil {
+		return nil, ErrSamplingUnsupported
+	}
+	return sampleCid(r.index, rng)
+}
+
+// Sample returns an entry of the index picked at random.
+func (r *SigToCid_Reader) Sample(rng *rand.Rand) (*Sample[cid.Cid], error) {
+	if r.IsDeprecatedOldVersion() || r.mphIndex != nil {
+		return nil, ErrSamplingUnsupported
+	}
+	return sampleCid(r.index, rng)
+}
+
+func sampleCid(index *compactindexsized.DB, rng *rand.Rand) (*Sample[cid.Cid], error) {
+	entry, err := index.SampleEntry(rng)
+	if err != nil {
+		return nil, err
+	}
+	_, c, err := cid.CidFromBytes(entry.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CID: %w", err)
+	}
+	return &Sample[cid.Cid]{Value: c, entry: entry}, nil
+}
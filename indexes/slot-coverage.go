@@ -0,0 +1,69 @@
+package indexes
+
+import (
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// SlotCoverage describes the slots of the blocks of an epoch, as stored in its slot-to-cid index
+// when it's built: a slot between FirstSlot and LastSlot that has no block was skipped
+// (the archive has all the blocks in that range), while a slot outside of it might just
+// not be in the archive.
+type SlotCoverage struct {
+	FirstSlot uint64
+	LastSlot  uint64
+	// NumBlocks is the number of produced slots (i.e. of blocks) in the range.
+	NumBlocks uint64
+}
+
+func (c *SlotCoverage) add(slot uint64) {
+	if c.NumBlocks == 0 || slot < c.FirstSlot {
+		c.FirstSlot = slot
+	}
+	if c.NumBlocks == 0 || slot > c.LastSlot {
+		c.LastSlot = slot
+	}
+	c.NumBlocks++
+}
+
+// Contains returns true if the slot is in the covered range.
+func (c SlotCoverage) Contains(slot uint64) bool {
+	return c.NumBlocks > 0 && slot >= c.FirstSlot && slot <= c.LastSlot
+}
+
+// NumSkipped returns the number of skipped slots in the covered range.
+func (c SlotCoverage) NumSkipped() uint64 {
+	if c.NumBlocks == 0 {
+		return 0
+	}
+	return c.LastSlot - c.FirstSlot + 1 - c.NumBlocks
+}
+
+func (c SlotCoverage) setMetadata(meta *indexmeta.Meta) error {
+	if err := meta.AddUint64(indexmeta.MetadataKey_FirstSlot, c.FirstSlot); err != nil {
+		return err
+	}
+	if err := meta.AddUint64(indexmeta.MetadataKey_LastSlot, c.LastSlot); err != nil {
+		return err
+	}
+	return meta.AddUint64(indexmeta.MetadataKey_NumBlocks, c.NumBlocks)
+}
+
+// getSlotCoverage returns the slot coverage stored in the metadata, or nil if there's none.
+func getSlotCoverage(meta *indexmeta.Meta) *SlotCoverage {
+	if meta == nil {
+		return nil
+	}
+	firstSlot, ok := meta.GetUint64(indexmeta.MetadataKey_FirstSlot)
+	if !ok {
+		return nil
+	}
+	lastSlot, ok := meta.GetUint64(indexmeta.MetadataKey_LastSlot)
+	if !ok {
+		return nil
+	}
+	numBlocks, ok := meta.GetUint64(indexmeta.MetadataKey_NumBlocks)
+	if !ok || numBlocks == 0 || lastSlot < firstSlot || numBlocks > lastSlot-firstSlot+1 {
+		return nil
+	}
+	return &SlotCoverage{FirstSlot: firstSlot, LastSlot: lastSlot, NumBlocks: numBlocks}
+}
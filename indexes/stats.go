@@ -0,0 +1,77 @@
+package indexes
+
+import (
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/deprecated/compactindex"
+	"github.com/rpcpool/yellowstone-faithful/deprecated/compactindex36"
+	"github.com/rpcpool/yellowstone-faithful/mphindex"
+)
+
+// IndexStats are the lookup counters of an index (since it was opened), and its number of buckets.
+type IndexStats struct {
+	compactindexsized.Stats
+	NumBuckets uint32
+}
+
+func statsOf(db *compactindexsized.DB) IndexStats {
+	return IndexStats{
+		Stats:      db.Stats(),
+		NumBuckets: db.Header.NumBuckets,
+	}
+}
+
+func statsOf36(db *compactindex36.DB) IndexStats {
+	return IndexStats{
+		Stats:      compactindexsized.Stats(db.Stats()),
+		NumBuckets: db.NumBuckets,
+	}
+}
+
+func statsOfMPH(db *mphindex.DB) IndexStats {
+	return IndexStats{
+		Stats:      compactindexsized.Stats(db.Stats()),
+		NumBuckets: db.Header.NumPartitions,
+	}
+}
+
+func statsOfDeprecated(db *compactindex.DB) IndexStats {
+	return IndexStats{
+		Stats:      compactindexsized.Stats(db.Stats()),
+		NumBuckets: db.NumBuckets,
+	}
+}
+
+// Stats returns the lookup counters of the index.
+func (r *CidToOffsetAndSize_Reader) Stats() IndexStats {
+	return statsOf(r.index)
+}
+
+// Stats returns the lookup counters of the index.
+func (r *Deprecated_CidToOffset_Reader) Stats() IndexStats {
+	return statsOfDeprecated(r.index)
+}
+
+// Stats returns the lookup counters of the index.
+func (r *SlotToCid_Reader) Stats() IndexStats {
+	if r.IsDeprecatedOldVersion() {
+		return statsOf36(r.deprecatedIndex)
+	}
+	if r.rangedIndex != nil {
+		return IndexStats{
+			Stats:      r.rangedIndex.Stats(),
+			NumBuckets: uint32(len(r.rangedIndex.runs)),
+		}
+	}
+	return statsOf(r.index)
+}
+
+// Stats returns the lookup counters of the index.
+func (r *SigToCid_Reader) Stats() IndexStats {
+	if r.IsDeprecatedOldVersion() {
+		return statsOf36(r.deprecatedIndex)
+	}
+	if r.mphIndex != nil {
+		return statsOfMPH(r.mphIndex)
+	}
+	return statsOf(r.index)
+}
@@ -5,4 +5,16 @@ var (
 	MetadataKey_Epoch   = []byte("epoch")
 	MetadataKey_RootCid = []byte("rootCid")
 	MetadataKey_Network = []byte("network")
+	// MetadataKey_GsfaFilter is the description of the accounts indexed in a gsfa index (absent = all).
+	MetadataKey_GsfaFilter = []byte("gsfaFilter")
+	// MetadataKey_FirstSlot, MetadataKey_LastSlot and MetadataKey_NumBlocks describe the slots
+	// of the blocks indexed in a slot-to-cid index (see indexes.SlotCoverage).
+	MetadataKey_FirstSlot = []byte("firstSlot")
+	MetadataKey_LastSlot  = []byte("lastSlot")
+	MetadataKey_NumBlocks = []byte("numBlocks")
+	// MetadataKey_Patch is a record of the patching of entries of an index (one per patch; see
+	// indexes.PatchRecord).
+	MetadataKey_Patch = []byte("patch")
+	// MetadataKey_SnapshotSlot is the slot of the account snapshot indexed in a pubkey-to-account index.
+	MetadataKey_SnapshotSlot = []byte("snapshotSlot")
 )
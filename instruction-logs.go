@@ -0,0 +1,167 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// InstructionLogs are the log messages of a top-level instruction of a transaction,
+// with the instructions that it invoked (CPIs), as parsed from the logMessages of the meta.
+type InstructionLogs struct {
+	// Index is the index of the instruction in the message.
+	Index     int    `json:"index"`
+	ProgramId string `json:"programId"`
+	// Logs are all the messages logged while the instruction ran (including those of the invoked programs).
+	Logs                 []InstructionLogMessage `json:"logs"`
+	ComputeUnitsConsumed *uint64                 `json:"computeUnitsConsumed"`
+	Failed               bool                    `json:"failed"`
+	// Error is the error of the failed instruction (e.g. "custom program error: 0x1").
+	Error string `json:"error,omitempty"`
+	// Truncated is true if the logs of the transaction were truncated during this instruction.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// InstructionLogMessage is a log message, with the invocation that logged it.
+type InstructionLogMessage struct {
+	Message string `json:"message"`
+	// ProgramId is the program that was running (the invoked one, for an invoke message).
+	ProgramId string `json:"programId"`
+	// StackHeight is 1 for the top-level instruction, and 2+ for the invoked ones.
+	StackHeight int `json:"stackHeight"`
+	// InnerInstructionIndex is the index of the running invocation in the innerInstructions
+	// of the top-level instruction (in the meta); null for the top-level instruction itself.
+	InnerInstructionIndex *int `json:"innerInstructionIndex"`
+}
+
+var (
+	logInvokeRegexp   = regexp.MustCompile(`^Program (\S+) invoke \[(\d+)\]$`)
+	logSuccessRegexp  = regexp.MustCompile(`^Program (\S+) success$`)
+	logFailedRegexp   = regexp.MustCompile(`^Program (\S+) failed: (.*)$`)
+	logConsumedRegexp = regexp.MustCompile(`^Program (\S+) consumed (\d+) of (\d+) compute units$`)
+)
+
+const logTruncatedMessage = "Log truncated"
+
+// parseInstructionLogs associates the log messages of a transaction with its top-level instructions,
+// and the invoked programs with the inner instructions: the runtime logs an invoke message for
+// every instruction and CPI, in the order in which they are recorded in the innerInstructions.
+// If the program IDs of the instructions are known, an invoke message goes to the next instruction
+// of its program (the precompiles, e.g. ed25519, don't log anything); otherwise to the next instruction.
+func parseInstructionLogs(logMessages []string, programIds []string) []*InstructionLogs {
+	type frame struct {
+		programId  string
+		innerIndex *int
+	}
+	out := make([]*InstructionLogs, 0)
+	var current *InstructionLogs
+	var stack []frame
+	var numInner int
+	for _, message := range logMessages {
+		if match := logInvokeRegexp.FindStringSubmatch(message); match != nil {
+			height, _ := strconv.Atoi(match[2])
+			if height <= 1 || current == nil {
+				index := len(out)
+				if current != nil {
+					index = current.Index + 1
+				}
+				if programIds != nil {
+					for index < len(programIds) && programIds[index] != match[1] {
+						index++
+					}
+				}
+				current = &InstructionLogs{
+					Index:     index,
+					ProgramId: match[1],
+					Logs:      make([]InstructionLogMessage, 0),
+				}
+				out = append(out, current)
+				stack = []frame{{programId: match[1]}}
+				numInner = 0
+			} else {
+				innerIndex := numInner
+				numInner++
+				stack = append(stack, frame{programId: match[1], innerIndex: &innerIndex})
+			}
+		}
+		if current == nil {
+			// logged outside of any instruction.
+			continue
+		}
+		if message == logTruncatedMessage {
+			current.Truncated = true
+		}
+		top := stack[len(stack)-1]
+		current.Logs = append(current.Logs, InstructionLogMessage{
+			Message:               message,
+			ProgramId:             top.programId,
+			StackHeight:           len(stack),
+			InnerInstructionIndex: top.innerIndex,
+		})
+		if match := logConsumedRegexp.FindStringSubmatch(message); match != nil && len(stack) == 1 {
+			if consumed, err := strconv.ParseUint(match[2], 10, 64); err == nil {
+				current.ComputeUnitsConsumed = &consumed
+			}
+		}
+		ended := logSuccessRegexp.MatchString(message)
+		if match := logFailedRegexp.FindStringSubmatch(message); match != nil {
+			ended = true
+			if len(stack) == 1 {
+				current.Failed = true
+				current.Error = match[2]
+			}
+		}
+		if ended && len(stack) > 1 {
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return out
+}
+
+// addInstructionLogs adds the logs of the meta of the (adapted) transaction response, by instruction,
+// as the "instructionLogs" field of the meta (a faithful extension of the jsonParsed encoding).
+func addInstructionLogs(m map[string]any) map[string]any {
+	meta, ok := m["meta"].(map[string]any)
+	if !ok {
+		return m
+	}
+	logMessagesAny, ok := meta["logMessages"].([]any)
+	if !ok {
+		return m
+	}
+	logMessages := make([]string, 0, len(logMessagesAny))
+	for _, message := range logMessagesAny {
+		if s, ok := message.(string); ok {
+			logMessages = append(logMessages, s)
+		}
+	}
+	meta["instructionLogs"] = parseInstructionLogs(logMessages, instructionProgramIds(m))
+	return m
+}
+
+// instructionProgramIds returns the program IDs of the (parsed) instructions of the transaction response,
+// or nil if any is missing.
+func instructionProgramIds(m map[string]any) []string {
+	transaction, ok := m["transaction"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	message, ok := transaction["message"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	instructions, ok := message["instructions"].([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]string, len(instructions))
+	for i, instructionAny := range instructions {
+		instruction, ok := instructionAny.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if out[i], ok = instruction["programId"].(string); !ok {
+			return nil
+		}
+	}
+	return out
+}
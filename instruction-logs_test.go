@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInstructionLogs(t *testing.T) {
+	logs := []string{
+		"Program ComputeBudget111111111111111111111111111111 invoke [1]",
+		"Program ComputeBudget111111111111111111111111111111 success",
+		"Program JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4 invoke [1]",
+		"Program log: Instruction: Route",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA invoke [2]",
+		"Program log: Instruction: Transfer",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA consumed 4645 of 180000 compute units",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA success",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA invoke [2]",
+		"Program TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA failed: insufficient funds",
+		"Program JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4 consumed 30000 of 199850 compute units",
+		"Program JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4 failed: custom program error: 0x1",
+	}
+	// the precompile (second instruction) doesn't log.
+	programIds := []string{
+		"ComputeBudget111111111111111111111111111111",
+		"Ed25519SigVerify111111111111111111111111111",
+		"JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4",
+	}
+	parsed := parseInstructionLogs(logs, programIds)
+	require.Len(t, parsed, 2)
+
+	require.Equal(t, 0, parsed[0].Index)
+	require.Len(t, parsed[0].Logs, 2)
+	require.False(t, parsed[0].Failed)
+	require.Nil(t, parsed[0].ComputeUnitsConsumed)
+
+	swap := parsed[1]
+	require.Equal(t, 2, swap.Index)
+	require.Equal(t, "JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4", swap.ProgramId)
+	require.Len(t, swap.Logs, 10)
+	require.True(t, swap.Failed)
+	require.Equal(t, "custom program error: 0x1", swap.Error)
+	require.Equal(t, uint64(30000), *swap.ComputeUnitsConsumed)
+
+	// the logs of the instruction itself.
+	require.Equal(t, 1, swap.Logs[1].StackHeight)
+	require.Nil(t, swap.Logs[1].InnerInstructionIndex)
+	// the logs of the first CPI (the first inner instruction).
+	transfer := swap.Logs[3]
+	require.Equal(t, "Program log: Instruction: Transfer", transfer.Message)
+	require.Equal(t, "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA", transfer.ProgramId)
+	require.Equal(t, 2, transfer.StackHeight)
+	require.Equal(t, 0, *transfer.InnerInstructionIndex)
+	// the second CPI, which failed.
+	require.Equal(t, 1, *swap.Logs[7].InnerInstructionIndex)
+	// back to the instruction.
+	require.Equal(t, 1, swap.Logs[8].StackHeight)
+
+	// without the program IDs, the instructions are in order.
+	parsed = parseInstructionLogs(logs, nil)
+	require.Equal(t, 1, parsed[1].Index)
+
+	parsed = parseInstructionLogs(append(logs[2:5:5], logTruncatedMessage), nil)
+	require.True(t, parsed[0].Truncated)
+}
+
+func TestAddInstructionLogs(t *testing.T) {
+	m := map[string]any{
+		"transaction": map[string]any{
+			"message": map[string]any{
+				"instructions": []any{
+					map[string]any{"programId": "11111111111111111111111111111111"},
+				},
+			},
+		},
+		"meta": map[string]any{
+			"logMessages": []any{
+				"Program 11111111111111111111111111111111 invoke [1]",
+				"Program 11111111111111111111111111111111 success",
+			},
+		},
+	}
+	m = addInstructionLogs(m)
+	parsed := m["meta"].(map[string]any)["instructionLogs"].([]*InstructionLogs)
+	require.Len(t, parsed, 1)
+	require.Equal(t, "11111111111111111111111111111111", parsed[0].ProgramId)
+
+	// no logs (e.g. old metas), no field.
+	noLogs := map[string]any{"meta": map[string]any{}}
+	require.NotContains(t, addInstructionLogs(noLogs)["meta"], "instructionLogs")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// instructionTypeTable maps the discriminator of the instructions of a program to their type,
+// named as in the jsonParsed encoding of the RPC.
+type instructionTypeTable struct {
+	program string
+	// tagSize is the size of the little-endian discriminator at the start of the data
+	// (1 or 4 bytes), or 0 if all the instructions of the program have the same type.
+	tagSize int
+	types   []string
+	// empty is the type of the instructions without data, if any.
+	empty string
+}
+
+var instructionTypeTables = map[solana.PublicKey]instructionTypeTable{
+	solana.MPK("11111111111111111111111111111111"): {
+		program: "system",
+		tagSize: 4,
+		types: []string{
+			"createAccount", "assign", "transfer", "createAccountWithSeed", "advanceNonce",
+			"withdrawFromNonce", "initializeNonce", "authorizeNonce", "allocate", "allocateWithSeed",
+			"assignWithSeed", "transferWithSeed", "upgradeNonce",
+		},
+	},
+	solana.MPK("TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA"): {
+		program: "spl-token",
+		tagSize: 1,
+		types:   splTokenInstructionTypes[:25],
+	},
+	solana.MPK("TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb"): {
+		program: "spl-token-2022",
+		tagSize: 1,
+		types:   splTokenInstructionTypes,
+	},
+	solana.MPK("ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL"): {
+		program: "spl-associated-token-account",
+		tagSize: 1,
+		types:   []string{"create", "createIdempotent", "recoverNested"},
+		empty:   "create",
+	},
+	memoProgramIDV1: {program: "spl-memo", types: []string{"memo"}},
+	memoProgramIDV2: {program: "spl-memo", types: []string{"memo"}},
+	solana.MPK("Vote111111111111111111111111111111111111111"): {
+		program: "vote",
+		tagSize: 4,
+		types: []string{
+			"initialize", "authorize", "vote", "withdraw", "updateValidatorIdentity",
+			"updateCommission", "voteSwitch", "authorizeChecked", "updateVoteState", "updateVoteStateSwitch",
+			"authorizeWithSeed", "authorizeCheckedWithSeed", "compactUpdateVoteState", "compactUpdateVoteStateSwitch",
+			"towerSync", "towerSyncSwitch",
+		},
+	},
+	solana.MPK("Stake11111111111111111111111111111111111111"): {
+		program: "stake",
+		tagSize: 4,
+		types: []string{
+			"initialize", "authorize", "delegate", "split", "withdraw",
+			"deactivate", "setLockup", "merge", "authorizeWithSeed", "initializeChecked",
+			"authorizeChecked", "authorizeCheckedWithSeed", "setLockupChecked", "getMinimumDelegation", "deactivateDelinquent",
+			"redelegate",
+		},
+	},
+	solana.MPK("ComputeBudget111111111111111111111111111111"): {
+		program: "compute-budget",
+		tagSize: 1,
+		types: []string{
+			"requestUnitsDeprecated", "requestHeapFrame", "setComputeUnitLimit", "setComputeUnitPrice", "setLoadedAccountsDataSizeLimit",
+		},
+	},
+	solana.MPK("BPFLoaderUpgradeab1e11111111111111111111111"): {
+		program: "bpf-upgradeable-loader",
+		tagSize: 4,
+		types: []string{
+			"initializeBuffer", "write", "deployWithMaxDataLen", "upgrade", "setAuthority",
+			"close", "extendProgram", "setAuthorityChecked",
+		},
+	},
+	solana.MPK("AddressLookupTab1e1111111111111111111111111"): {
+		program: "address-lookup-table",
+		tagSize: 4,
+		types: []string{
+			"createLookupTable", "freezeLookupTable", "extendLookupTable", "deactivateLookupTable", "closeLookupTable",
+		},
+	},
+}
+
+// splTokenInstructionTypes are the instructions of the Token-2022 program; the first 25
+// are the ones of the SPL Token program.
+var splTokenInstructionTypes = []string{
+	"initializeMint", "initializeAccount", "initializeMultisig", "transfer", "approve",
+	"revoke", "setAuthority", "mintTo", "burn", "closeAccount",
+	"freezeAccount", "thawAccount", "transferChecked", "approveChecked", "mintToChecked",
+	"burnChecked", "initializeAccount2", "syncNative", "initializeAccount3", "initializeMultisig2",
+	"initializeMint2", "getAccountDataSize", "initializeImmutableOwner", "amountToUiAmount", "uiAmountToAmount",
+	"initializeMintCloseAuthority", "transferFeeExtension", "confidentialTransferExtension", "defaultAccountStateExtension", "reallocate",
+	"memoTransferExtension", "createNativeMint", "initializeNonTransferableMint", "interestBearingMintExtension", "cpiGuardExtension",
+	"initializePermanentDelegate", "transferHookExtension", "confidentialTransferFeeExtension", "withdrawExcessLamports", "metadataPointerExtension",
+	"groupPointerExtension", "groupMemberPointerExtension",
+}
+
+// decodeInstructionType returns the name of the program and the type of the instruction with the
+// given data, for the programs whose instructions can be decoded; the type is empty if the program
+// is known but the discriminator isn't, and both are empty if the program is unknown.
+func decodeInstructionType(programID solana.PublicKey, data []byte) (program string, instructionType string) {
+	table, ok := instructionTypeTables[programID]
+	if !ok {
+		return "", ""
+	}
+	if len(data) == 0 && table.empty != "" {
+		return table.program, table.empty
+	}
+	var tag uint64
+	switch table.tagSize {
+	case 0:
+		return table.program, table.types[0]
+	case 1:
+		if len(data) < 1 {
+			return table.program, ""
+		}
+		tag = uint64(data[0])
+	case 4:
+		if len(data) < 4 {
+			return table.program, ""
+		}
+		tag = uint64(binary.LittleEndian.Uint32(data))
+	}
+	if tag >= uint64(len(table.types)) {
+		return table.program, ""
+	}
+	return table.program, table.types[tag]
+}
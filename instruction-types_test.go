@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeInstructionType(t *testing.T) {
+	cases := []struct {
+		programID string
+		data      []byte
+		program   string
+		typ       string
+	}{
+		{"11111111111111111111111111111111", []byte{2, 0, 0, 0, 0x40, 0x42, 0x0f, 0, 0, 0, 0, 0}, "system", "transfer"},
+		{"11111111111111111111111111111111", []byte{2}, "system", ""},
+		{"11111111111111111111111111111111", []byte{99, 0, 0, 0}, "system", ""},
+		{"TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA", []byte{12, 1, 2, 3}, "spl-token", "transferChecked"},
+		{"TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA", []byte{26}, "spl-token", ""},
+		{"TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb", []byte{26}, "spl-token-2022", "transferFeeExtension"},
+		{"ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL", nil, "spl-associated-token-account", "create"},
+		{"ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL", []byte{1}, "spl-associated-token-account", "createIdempotent"},
+		{"MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr", []byte("hello"), "spl-memo", "memo"},
+		{"Vote111111111111111111111111111111111111111", []byte{14, 0, 0, 0}, "vote", "towerSync"},
+		{"ComputeBudget111111111111111111111111111111", []byte{3, 1, 0, 0, 0, 0, 0, 0, 0}, "compute-budget", "setComputeUnitPrice"},
+		{"JUP6LkbZbjS1jKKwapdHNy74zcZ3tLUZoi5QNyVTaV4", []byte{1, 2, 3}, "", ""},
+	}
+	for _, c := range cases {
+		program, typ := decodeInstructionType(solana.MPK(c.programID), c.data)
+		require.Equal(t, c.program, program, c.programID)
+		require.Equal(t, c.typ, typ, c.programID)
+	}
+}
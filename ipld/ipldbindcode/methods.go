@@ -3,6 +3,7 @@ package ipldbindcode
 import (
 	"encoding/json"
 	"fmt"
+	"hash"
 	"hash/crc64"
 	"hash/fnv"
 	"strconv"
@@ -88,6 +89,12 @@ func checksumCrc64(buf []byte) uint64 {
 	return crc64.Checksum(buf, crc64.MakeTable(crc64.ISO))
 }
 
+// Checksum returns the hash of the provided buffer, as stored in the 'Hash' field of the DataFrames
+// written by the latest version of the car creator (see VerifyHash).
+func Checksum(buf []byte) uint64 {
+	return checksumCrc64(buf)
+}
+
 // VerifyHash verifies that the provided data matches the provided hash.
 // In case of DataFrames, the hash is stored in the 'Hash' field, and
 // it is the hash of the concatenated 'Data' fields of all the DataFrames.
@@ -101,6 +108,34 @@ func VerifyHash(data []byte, hash uint64) error {
 	return nil
 }
 
+// HashVerifier verifies the hash of data that is written to it in pieces
+// (e.g. the concatenated 'Data' fields of DataFrames, as they are read); see VerifyHash.
+type HashVerifier struct {
+	crc hash.Hash64
+	fnv hash.Hash64
+}
+
+func NewHashVerifier() *HashVerifier {
+	return &HashVerifier{
+		crc: crc64.New(crc64.MakeTable(crc64.ISO)),
+		fnv: fnv.New64a(),
+	}
+}
+
+func (v *HashVerifier) Write(p []byte) (int, error) {
+	v.crc.Write(p)
+	v.fnv.Write(p)
+	return len(p), nil
+}
+
+// Verify verifies that the data written so far matches the provided hash.
+func (v *HashVerifier) Verify(hash uint64) error {
+	if v.crc.Sum64() != hash && v.fnv.Sum64() != hash {
+		return fmt.Errorf("data hash mismatch")
+	}
+	return nil
+}
+
 // Transaction.HasIndex returns whether the 'Index' field is present.
 func (n Transaction) HasIndex() bool {
 	return n.Index != nil && *n.Index != nil
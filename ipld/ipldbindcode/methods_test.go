@@ -71,3 +71,17 @@ func TestDataFrame(t *testing.T) {
 		}
 	}
 }
+
+func TestHashVerifier(t *testing.T) {
+	data := []byte("the quick brown fox jumps over the lazy dog")
+	for _, hash := range []uint64{checksumCrc64(data), checksumFnv(data)} {
+		v := NewHashVerifier()
+		v.Write(data[:10])
+		v.Write(data[10:])
+		require.NoError(t, v.Verify(hash))
+		require.NoError(t, VerifyHash(data, hash))
+	}
+	v := NewHashVerifier()
+	v.Write(data[1:])
+	require.Error(t, v.Verify(checksumCrc64(data)))
+}
@@ -0,0 +1,176 @@
+package iplddecoders
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+)
+
+// ErrUnknownKind is returned when a node has a kind that this version of the decoders does not know about;
+// it usually means that the node was produced by a newer version of the archive tooling.
+var ErrUnknownKind = errors.New("unknown node kind")
+
+// ErrNotANode is returned when the data does not look like an encoded node at all.
+var ErrNotANode = errors.New("not a valid node")
+
+// NodeHeader is the discriminator of an encoded node.
+// All nodes are encoded as CBOR tuples where the first field is the kind;
+// nodes produced by newer versions of the archive tooling can have more fields
+// than the ones known by the schema (which are appended at the end of the tuple).
+type NodeHeader struct {
+	Kind Kind
+	// NumFields is the number of fields in the encoded tuple.
+	NumFields int
+}
+
+// ReadNodeHeader reads the kind and the number of fields of the given encoded node.
+func ReadNodeHeader(raw []byte) (NodeHeader, error) {
+	if len(raw) < 2 {
+		return NodeHeader{}, fmt.Errorf("%w: too short (%d bytes)", ErrNotANode, len(raw))
+	}
+	// CBOR array (major type 4).
+	if raw[0]>>5 != 4 {
+		return NodeHeader{}, fmt.Errorf("%w: expected a CBOR array, got initial byte 0x%02x", ErrNotANode, raw[0])
+	}
+	var numFields int
+	var pos int
+	switch info := raw[0] & 0x1f; {
+	case info < 24:
+		numFields = int(info)
+		pos = 1
+	case info == 24:
+		if len(raw) < 3 {
+			return NodeHeader{}, fmt.Errorf("%w: too short (%d bytes)", ErrNotANode, len(raw))
+		}
+		numFields = int(raw[1])
+		pos = 2
+	default:
+		return NodeHeader{}, fmt.Errorf("%w: unsupported CBOR array length encoding 0x%02x", ErrNotANode, raw[0])
+	}
+	if numFields == 0 {
+		return NodeHeader{}, fmt.Errorf("%w: empty tuple", ErrNotANode)
+	}
+	// The kind is a small unsigned int (major type 0).
+	if raw[pos] >= 24 {
+		return NodeHeader{}, fmt.Errorf("%w: expected a small int as kind, got 0x%02x", ErrNotANode, raw[pos])
+	}
+	return NodeHeader{
+		Kind:      Kind(raw[pos]),
+		NumFields: numFields,
+	}, nil
+}
+
+// IsKnown returns true if the kind is one of the kinds known by these decoders.
+func (k Kind) IsKnown() bool {
+	return k >= KindTransaction && k <= KindDataFrame
+}
+
+// unmarshal decodes the raw node (which must be of the expected kind) into a new value of type T.
+// If the node has fields that are unknown to the schema (i.e. it was produced
+// by a newer version of the archive tooling), those fields are ignored.
+func unmarshal[T any](raw []byte, expected Kind, typ schema.Type) (*T, error) {
+	header, err := ReadNodeHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	if header.Kind != expected {
+		return nil, fmt.Errorf("expected %s node, got %s", expected, header.Kind)
+	}
+	var v T
+	_, err = ipld.Unmarshal(raw, dagcbor.Decode, &v, typ)
+	if err == nil {
+		return &v, nil
+	}
+	trimmed, ok := trimUnknownFields(raw, typ)
+	if !ok {
+		return nil, err
+	}
+	var compat T
+	if _, errCompat := ipld.Unmarshal(trimmed, dagcbor.Decode, &compat, typ); errCompat != nil {
+		// report the original error; it's the one that describes the actual data.
+		return nil, err
+	}
+	return &compat, nil
+}
+
+// trimUnknownFields re-encodes the raw node dropping the trailing tuple fields that are
+// not known by the schema (recursively); returns false if there was nothing to trim.
+func trimUnknownFields(raw []byte, typ schema.Type) ([]byte, bool) {
+	node, err := ipld.Decode(raw, dagcbor.Decode)
+	if err != nil {
+		return nil, false
+	}
+	trimmed, changed, err := trimNode(node, typ)
+	if err != nil || !changed {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(trimmed, &buf); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func trimNode(node datamodel.Node, typ schema.Type) (datamodel.Node, bool, error) {
+	if node.Kind() != datamodel.Kind_List {
+		return node, false, nil
+	}
+	var numKnown int64
+	var fieldType func(i int64) schema.Type
+	switch t := typ.(type) {
+	case *schema.TypeStruct:
+		fields := t.Fields()
+		numKnown = int64(len(fields))
+		fieldType = func(i int64) schema.Type {
+			return fields[i].Type()
+		}
+	case *schema.TypeList:
+		numKnown = node.Length()
+		fieldType = func(int64) schema.Type {
+			return t.ValueType()
+		}
+	default:
+		return node, false, nil
+	}
+	length := node.Length()
+	changed := length > numKnown
+	if length < numKnown {
+		numKnown = length
+	}
+	children := make([]datamodel.Node, 0, numKnown)
+	for i := int64(0); i < numKnown; i++ {
+		child, err := node.LookupByIndex(i)
+		if err != nil {
+			return nil, false, err
+		}
+		trimmedChild, childChanged, err := trimNode(child, fieldType(i))
+		if err != nil {
+			return nil, false, err
+		}
+		changed = changed || childChanged
+		children = append(children, trimmedChild)
+	}
+	if !changed {
+		return node, false, nil
+	}
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(int64(len(children)))
+	if err != nil {
+		return nil, false, err
+	}
+	for _, child := range children {
+		if err := la.AssembleValue().AssignNode(child); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := la.Finish(); err != nil {
+		return nil, false, err
+	}
+	return nb.Build(), true, nil
+}
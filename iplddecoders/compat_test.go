@@ -0,0 +1,119 @@
+package iplddecoders
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/stretchr/testify/require"
+)
+
+// appendFields returns the given list node with the given extra fields appended.
+func appendFields(t *testing.T, node datamodel.Node, extra ...datamodel.Node) datamodel.Node {
+	out, err := qp.BuildList(basicnode.Prototype.Any, -1, func(la datamodel.ListAssembler) {
+		it := node.ListIterator()
+		for !it.Done() {
+			_, v, err := it.Next()
+			require.NoError(t, err)
+			qp.ListEntry(la, qp.Node(v))
+		}
+		for _, v := range extra {
+			qp.ListEntry(la, qp.Node(v))
+		}
+	})
+	require.NoError(t, err)
+	return out
+}
+
+func encodeNode(t *testing.T, node datamodel.Node) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, dagcbor.Encode(node, &buf))
+	return buf.Bytes()
+}
+
+func TestDecodeBlockWithUnknownFields(t *testing.T) {
+	link := cidlink.Link{Cid: cid.MustParse("bafkqaaa")}
+	blockHeight := 100
+	blockHeightPtr := &blockHeight
+	raw, err := ipld.Marshal(dagcbor.Encode, &ipldbindcode.Block{
+		Kind:      int(KindBlock),
+		Slot:      123,
+		Shredding: ipldbindcode.List__Shredding{},
+		Entries:   ipldbindcode.List__Link{link},
+		Meta: ipldbindcode.SlotMeta{
+			Parent_slot:  122,
+			Blocktime:    1000,
+			Block_height: &blockHeightPtr,
+		},
+		Rewards: link,
+	}, ipldbindcode.Prototypes.Block.Type())
+	require.NoError(t, err)
+
+	node, err := ipld.Decode(raw, dagcbor.Decode)
+	require.NoError(t, err)
+
+	// add an unknown field to the nested SlotMeta, and one to the Block itself.
+	meta, err := node.LookupByIndex(4)
+	require.NoError(t, err)
+	newMeta := appendFields(t, meta, basicnode.NewString("future-meta-field"))
+	withNewMeta, err := qp.BuildList(basicnode.Prototype.Any, -1, func(la datamodel.ListAssembler) {
+		it := node.ListIterator()
+		for !it.Done() {
+			idx, v, err := it.Next()
+			require.NoError(t, err)
+			if idx == 4 {
+				v = newMeta
+			}
+			qp.ListEntry(la, qp.Node(v))
+		}
+	})
+	require.NoError(t, err)
+	future := encodeNode(t, appendFields(t, withNewMeta, basicnode.NewInt(42)))
+
+	header, err := ReadNodeHeader(future)
+	require.NoError(t, err)
+	require.Equal(t, KindBlock, header.Kind)
+	require.Equal(t, 7, header.NumFields)
+
+	block, err := DecodeBlock(future)
+	require.NoError(t, err)
+	require.Equal(t, 123, block.Slot)
+	require.Equal(t, 122, block.Meta.Parent_slot)
+	require.Equal(t, 1000, block.Meta.Blocktime)
+	height, ok := block.GetBlockHeight()
+	require.True(t, ok)
+	require.Equal(t, uint64(100), height)
+	require.Len(t, block.Entries, 1)
+
+	decoded, err := DecodeAny(future)
+	require.NoError(t, err)
+	require.IsType(t, &ipldbindcode.Block{}, decoded)
+}
+
+func TestGetKind(t *testing.T) {
+	{
+		_, err := GetKind(nil)
+		require.ErrorIs(t, err, ErrNotANode)
+	}
+	{
+		// a CBOR map, not an array
+		_, err := GetKind([]byte{0xa1, 0x00, 0x00})
+		require.ErrorIs(t, err, ErrNotANode)
+	}
+	{
+		kind, err := GetKind([]byte{0x82, 0x02, 0x00})
+		require.NoError(t, err)
+		require.Equal(t, KindBlock, kind)
+	}
+	{
+		_, err := DecodeAny([]byte{0x82, 0x10, 0x00})
+		require.ErrorIs(t, err, ErrUnknownKind)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fasthttp"
+)
+
+// preciseJson is fasterJson, except that the numbers decoded into interface values
+// are json.Number instead of float64, so that the u64 values (lamports, slots, etc)
+// above 2^53 survive the conversions of the responses to maps and back.
+var preciseJson = jsoniter.Config{
+	EscapeHTML:             true,
+	SortMapKeys:            true,
+	ValidateJsonRawMessage: true,
+	UseNumber:              true,
+}.Froze()
+
+// maxSafeJSONInteger is the largest integer that a float64 (i.e. a JavaScript number) holds exactly.
+const maxSafeJSONInteger = 1<<53 - 1
+
+// largeIntsAsStringsHeader is the request header with which a client asks for the integers
+// that JavaScript can't represent exactly to be returned as strings (e.g. "X-Large-Ints-As-Strings: true").
+const largeIntsAsStringsHeader = "X-Large-Ints-As-Strings"
+
+// wantsLargeIntsAsStrings returns true if the large integers of the response must be strings:
+// if the server is configured so, unless the request says otherwise with the header.
+func wantsLargeIntsAsStrings(reqCtx *fasthttp.RequestCtx, serverDefault bool) bool {
+	value := strings.TrimSpace(string(reqCtx.Request.Header.Peek(largeIntsAsStringsHeader)))
+	if value == "" {
+		return serverDefault
+	}
+	yes, err := strconv.ParseBool(value)
+	if err != nil {
+		return serverDefault
+	}
+	return yes
+}
+
+// largeIntsAsStrings returns true if the large integers of the response to the request must be strings.
+func (multi *MultiEpoch) largeIntsAsStrings(reqCtx *fasthttp.RequestCtx) bool {
+	return wantsLargeIntsAsStrings(reqCtx, multi.options != nil && multi.options.LargeIntsAsStrings)
+}
+
+// isSafeJSONInteger returns false if the number is an integer outside of [-(2^53-1), 2^53-1];
+// the other numbers (including the non-integers) are safe.
+func isSafeJSONInteger(n json.Number) bool {
+	s := n.String()
+	if strings.ContainsAny(s, ".eE") {
+		return true
+	}
+	if strings.HasPrefix(s, "-") {
+		v, err := strconv.ParseInt(s, 10, 64)
+		return err == nil && v >= -maxSafeJSONInteger
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	return err == nil && v <= maxSafeJSONInteger
+}
+
+// stringifyLargeInts replaces (in place) the integers of the decoded JSON value
+// that JavaScript can't represent exactly with their decimal strings.
+func stringifyLargeInts(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, item := range value {
+			value[k] = stringifyLargeInts(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = stringifyLargeInts(item)
+		}
+	case json.Number:
+		if !isSafeJSONInteger(value) {
+			return value.String()
+		}
+	}
+	return v
+}
+
+// encodeLargeIntsAsStrings rewrites the JSON document with the integers above 2^53-1
+// (in absolute value) as strings; the other values are unchanged.
+func encodeLargeIntsAsStrings(raw []byte) ([]byte, error) {
+	var v any
+	if err := preciseJson.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return preciseJson.Marshal(stringifyLargeInts(v))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestToMapAnyKeepsLargeIntegers(t *testing.T) {
+	type balance struct {
+		Lamports uint64 `json:"lamports"`
+		Delta    int64  `json:"delta"`
+		Ratio    float64
+	}
+	m, err := toMapAny(&balance{Lamports: math.MaxUint64, Delta: math.MinInt64, Ratio: 0.5})
+	require.NoError(t, err)
+	out, err := preciseJson.Marshal(MapToCamelCaseAny(m))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"lamports":18446744073709551615,"delta":-9223372036854775808,"ratio":0.5}`, string(out))
+}
+
+func TestEncodeLargeIntsAsStrings(t *testing.T) {
+	out, err := encodeLargeIntsAsStrings([]byte(`{"slot":250000000,"max":9007199254740991,"lamports":9007199254740992,"nested":[{"postBalance":18446744073709551615,"delta":-9007199254740993}],"commission":1.5,"name":"x","none":null}`))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"slot":250000000,"max":9007199254740991,"lamports":"9007199254740992","nested":[{"postBalance":"18446744073709551615","delta":"-9007199254740993"}],"commission":1.5,"name":"x","none":null}`, string(out))
+
+	var v any
+	require.NoError(t, json.Unmarshal(out, &v))
+}
+
+func TestWantsLargeIntsAsStrings(t *testing.T) {
+	var reqCtx fasthttp.RequestCtx
+	require.False(t, wantsLargeIntsAsStrings(&reqCtx, false))
+	require.True(t, wantsLargeIntsAsStrings(&reqCtx, true))
+	reqCtx.Request.Header.Set(largeIntsAsStringsHeader, "true")
+	require.True(t, wantsLargeIntsAsStrings(&reqCtx, false))
+	reqCtx.Request.Header.Set(largeIntsAsStringsHeader, "false")
+	require.False(t, wantsLargeIntsAsStrings(&reqCtx, true))
+	// an invalid value is ignored.
+	reqCtx.Request.Header.Set(largeIntsAsStringsHeader, "maybe")
+	require.True(t, wantsLargeIntsAsStrings(&reqCtx, true))
+	// no options at all.
+	require.False(t, (&MultiEpoch{}).largeIntsAsStrings(&reqCtx))
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	"github.com/urfave/cli/v2"
 	"k8s.io/klog/v2"
 )
@@ -163,5 +164,35 @@ func NewKlogFlagSet() []cli.Flag {
 				return nil
 			},
 		},
+		&cli.StringFlag{
+			Name:    "log-backend",
+			Usage:   "Backend of the structured logs: klog, json (zap JSON lines to stderr), or journald",
+			EnvVars: []string{"FAITHFUL_LOG_BACKEND"},
+			Value:   "klog",
+			Action: func(cctx *cli.Context, v string) error {
+				backend, err := logging.NewBackend(v)
+				if err != nil {
+					return err
+				}
+				logging.SetBackend(backend)
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:    "log-levels",
+			Usage:   "Levels of the structured logs, as a default level and/or component=level pairs, e.g. 'info,rpc=debug,config=warn'",
+			EnvVars: []string{"FAITHFUL_LOG_LEVELS"},
+			Value:   "info",
+			Action: func(cctx *cli.Context, v string) error {
+				return logging.SetLevels(v)
+			},
+		},
 	}
 }
+
+// Loggers of the components of the RPC server.
+var (
+	rpcLog     = logging.Named("rpc")
+	configLog  = logging.Named("config")
+	storageLog = logging.Named("storage")
+)
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// LeaderSchedule is the leader schedule of an epoch, loaded from its sidecar file: the
+// blocks in the archive don't say who produced them.
+type LeaderSchedule struct {
+	epoch      uint64
+	identities []solana.PublicKey
+	// slotLeaders are the indexes in identities, plus one, of the leaders of the slots of
+	// the epoch (by offset from its first slot); 0 is a slot without leader in the file.
+	slotLeaders []uint32
+}
+
+// parseLeaderSchedule parses a leader schedule in the format of the result of getLeaderSchedule:
+// the identities of the leaders, with the offsets of their slots from the first slot of the epoch.
+func parseLeaderSchedule(epoch uint64, data []byte) (*LeaderSchedule, error) {
+	var bySlotOffsets map[string][]uint64
+	if err := fasterJson.Unmarshal(data, &bySlotOffsets); err != nil {
+		return nil, fmt.Errorf("the leader schedule must be an object of identities with their slot offsets: %w", err)
+	}
+	firstSlot, lastSlot := CalcEpochLimits(epoch)
+	schedule := &LeaderSchedule{
+		epoch:       epoch,
+		identities:  make([]solana.PublicKey, 0, len(bySlotOffsets)),
+		slotLeaders: make([]uint32, lastSlot-firstSlot+1),
+	}
+	for identityString, slotOffsets := range bySlotOffsets {
+		identity, err := solana.PublicKeyFromBase58(identityString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity %q: %w", identityString, err)
+		}
+		schedule.identities = append(schedule.identities, identity)
+		for _, offset := range slotOffsets {
+			if offset >= uint64(len(schedule.slotLeaders)) {
+				return nil, fmt.Errorf("slot offset %d of %s is outside of the epoch", offset, identity)
+			}
+			if previous := schedule.slotLeaders[offset]; previous != 0 {
+				return nil, fmt.Errorf("slot offset %d has two leaders: %s and %s", offset, schedule.identities[previous-1], identity)
+			}
+			schedule.slotLeaders[offset] = uint32(len(schedule.identities))
+		}
+	}
+	return schedule, nil
+}
+
+// Leader returns the leader of the slot.
+func (s *LeaderSchedule) Leader(slot uint64) (solana.PublicKey, bool) {
+	if s == nil || CalcEpochForSlot(slot) != s.epoch {
+		return solana.PublicKey{}, false
+	}
+	firstSlot, _ := CalcEpochLimits(s.epoch)
+	leader := s.slotLeaders[slot-firstSlot]
+	if leader == 0 {
+		return solana.PublicKey{}, false
+	}
+	return s.identities[leader-1], true
+}
+
+// parseStakeWeights parses the stake weights of an epoch: an object of the identities of the
+// validators with their active stake, in lamports.
+func parseStakeWeights(data []byte) (map[solana.PublicKey]uint64, error) {
+	var byIdentity map[string]uint64
+	if err := fasterJson.Unmarshal(data, &byIdentity); err != nil {
+		return nil, fmt.Errorf("the stake weights must be an object of identities with their stake: %w", err)
+	}
+	out := make(map[solana.PublicKey]uint64, len(byIdentity))
+	for identityString, stake := range byIdentity {
+		identity, err := solana.PublicKeyFromBase58(identityString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity %q: %w", identityString, err)
+		}
+		out[identity] = stake
+	}
+	return out, nil
+}
+
+// readSidecarFile reads a local sidecar file of the epoch config.
+func readSidecarFile(uri URI) ([]byte, error) {
+	return os.ReadFile(strings.TrimPrefix(uri.String(), "file://"))
+}
+
+// loadLeaderSidecars loads the leader schedule and the stake weights of the epoch, if configured.
+func (e *Epoch) loadLeaderSidecars(config *Config) error {
+	if !config.LeaderSchedule.URI.IsZero() {
+		data, err := readSidecarFile(config.LeaderSchedule.URI)
+		if err != nil {
+			return fmt.Errorf("failed to read the leader schedule: %w", err)
+		}
+		schedule, err := parseLeaderSchedule(e.Epoch(), data)
+		if err != nil {
+			return fmt.Errorf("failed to parse the leader schedule %q: %w", config.LeaderSchedule.URI, err)
+		}
+		e.leaderSchedule = schedule
+	}
+	if !config.StakeWeights.URI.IsZero() {
+		data, err := readSidecarFile(config.StakeWeights.URI)
+		if err != nil {
+			return fmt.Errorf("failed to read the stake weights: %w", err)
+		}
+		stakeWeights, err := parseStakeWeights(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse the stake weights %q: %w", config.StakeWeights.URI, err)
+		}
+		e.stakeWeights = stakeWeights
+	}
+	return nil
+}
+
+// GetSlotLeader returns the leader of the slot, from the leader schedule sidecar of the epoch.
+func (e *Epoch) GetSlotLeader(slot uint64) (solana.PublicKey, bool) {
+	return e.leaderSchedule.Leader(slot)
+}
+
+// HasLeaderSchedule returns true if the leader schedule sidecar of the epoch is loaded.
+func (e *Epoch) HasLeaderSchedule() bool {
+	return e.leaderSchedule != nil
+}
+
+// GetStakeWeights returns the stake of the validators in the epoch, by identity, from the
+// stake weights sidecar of the epoch (nil if it has none).
+func (e *Epoch) GetStakeWeights() map[solana.PublicKey]uint64 {
+	return e.stakeWeights
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderSchedule(t *testing.T) {
+	alice := solana.PublicKey{1}
+	bob := solana.PublicKey{2}
+	data := fmt.Sprintf(`{%q: [0, 1, 2, 3], %q: [4, 5, 6, 7, 431999]}`, alice, bob)
+	schedule, err := parseLeaderSchedule(2, []byte(data))
+	require.NoError(t, err)
+
+	first, last := CalcEpochLimits(2)
+	for offset, expected := range map[uint64]solana.PublicKey{0: alice, 3: alice, 4: bob, 431999: bob} {
+		leader, ok := schedule.Leader(first + offset)
+		require.True(t, ok)
+		require.Equal(t, expected, leader)
+	}
+	_, ok := schedule.Leader(first + 8)
+	require.False(t, ok)
+	// other epochs.
+	_, ok = schedule.Leader(first - 1)
+	require.False(t, ok)
+	_, ok = schedule.Leader(last + 1)
+	require.False(t, ok)
+	var none *LeaderSchedule
+	_, ok = none.Leader(first)
+	require.False(t, ok)
+
+	for _, invalid := range []string{
+		`[]`,
+		`{"not-a-key": [0]}`,
+		fmt.Sprintf(`{%q: [432000]}`, alice),
+		fmt.Sprintf(`{%q: [0], %q: [0]}`, alice, bob),
+	} {
+		_, err := parseLeaderSchedule(2, []byte(invalid))
+		require.Error(t, err, invalid)
+	}
+
+	stakes, err := parseStakeWeights([]byte(fmt.Sprintf(`{%q: 1000, %q: 5}`, alice, bob)))
+	require.NoError(t, err)
+	require.Equal(t, map[solana.PublicKey]uint64{alice: 1000, bob: 5}, stakes)
+	_, err = parseStakeWeights([]byte(fmt.Sprintf(`{%q: -1}`, alice)))
+	require.Error(t, err)
+
+	// bob skipped the slots 5 and 6.
+	blocks := []uint64{first, first + 1, first + 2, first + 3, first + 4, first + 7}
+	rangeBlocks := func(from, to uint64, fn func(slot uint64, c cid.Cid) error) error {
+		for _, slot := range blocks {
+			if slot >= from && slot <= to {
+				if err := fn(slot, cid.Undef); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	production, err := blockProduction(schedule, first, first+9, nil, rangeBlocks)
+	require.NoError(t, err)
+	require.Equal(t, map[string][2]uint64{alice.String(): {4, 4}, bob.String(): {4, 2}}, production)
+	production, err = blockProduction(schedule, first+2, first+5, &bob, rangeBlocks)
+	require.NoError(t, err)
+	require.Equal(t, map[string][2]uint64{bob.String(): {2, 1}}, production)
+}
+
+func TestParseGetBlockProductionRequest(t *testing.T) {
+	parse := func(params string) (*GetBlockProductionRequest, error) {
+		raw := json.RawMessage(params)
+		return parseGetBlockProductionRequest(&raw)
+	}
+	req, err := parse(`[]`)
+	require.NoError(t, err)
+	require.Nil(t, req.FirstSlot)
+
+	identity := solana.PublicKey{1}
+	req, err = parse(fmt.Sprintf(`[{"identity": %q, "range": {"firstSlot": 10, "lastSlot": 20}, "commitment": "finalized"}]`, identity))
+	require.NoError(t, err)
+	require.Equal(t, identity, *req.Identity)
+	require.Equal(t, uint64(10), *req.FirstSlot)
+	require.Equal(t, uint64(20), *req.LastSlot)
+
+	for _, invalid := range []string{
+		`[{"identity": "not-a-key"}]`,
+		`[{"range": {"lastSlot": 20}}]`,
+		`[{"range": {"firstSlot": 20, "lastSlot": 10}}]`,
+		`[{"range": {"firstSlot": 10, "lastSlot": 432000}}]`,
+	} {
+		_, err := parse(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	raw := json.RawMessage(`[100, 10]`)
+	leadersReq, err := parseGetSlotLeadersRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, &GetSlotLeadersRequest{StartSlot: 100, Limit: 10}, leadersReq)
+	for _, invalid := range []string{`[100]`, `[100, 0]`, `[100, 5001]`} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetSlotLeadersRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// latencyTracker is an exponentially-weighted moving average of latencies,
+// which decays toward zero when no latencies are observed (i.e. when the storage is idle).
+type latencyTracker struct {
+	tau time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	value float64 // seconds
+	last  time.Time
+}
+
+func newLatencyTracker(tau time.Duration) *latencyTracker {
+	return &latencyTracker{
+		tau: tau,
+		now: time.Now,
+	}
+}
+
+// decay returns how much of the current average is kept for a new observation.
+func (l *latencyTracker) decay(now time.Time) float64 {
+	if l.last.IsZero() {
+		return 0
+	}
+	return math.Exp(-float64(now.Sub(l.last)) / float64(l.tau))
+}
+
+func (l *latencyTracker) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	weight := 1 - l.decay(now)
+	if weight < 0.05 {
+		// many observations at the same time must still move the average.
+		weight = 0.05
+	}
+	l.value += weight * (d.Seconds() - l.value)
+	l.last = now
+}
+
+// Value returns the average latency.
+func (l *latencyTracker) Value() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.last.IsZero() {
+		return 0
+	}
+	// decay since the last observation, with a grace period of tau.
+	idle := l.now().Sub(l.last) - l.tau
+	value := l.value
+	if idle > 0 {
+		value *= math.Exp(-float64(idle) / float64(l.tau))
+	}
+	return time.Duration(value * float64(time.Second))
+}
+
+// carReadLatency tracks the latency of the reads from the CAR files (local or remote).
+var carReadLatency = newLatencyTracker(5 * time.Second)
+
+func observeCarRead(ctx context.Context, startedAt time.Time) {
+	carReadLatency.Observe(time.Since(startedAt))
+	observeDebugTiming(ctx, debugPhaseCarRead, startedAt)
+}
+
+type LoadShedderConfig struct {
+	// MaxReadLatency is the average CAR read latency above which low priority requests are rejected (0 = no limit).
+	MaxReadLatency time.Duration
+	// MaxQueueDepth is the number of tasks waiting for a DAG fetch worker above which low priority requests are rejected (0 = no limit).
+	MaxQueueDepth int
+}
+
+// LoadShedder rejects low priority requests when the storage is saturated, to protect the latency of the others.
+type LoadShedder struct {
+	conf       LoadShedderConfig
+	latency    func() time.Duration
+	queueDepth func() int
+}
+
+func NewLoadShedder(conf LoadShedderConfig) *LoadShedder {
+	return &LoadShedder{
+		conf:       conf,
+		latency:    carReadLatency.Value,
+		queueDepth: func() int { return dagFetchPool.Waiting() },
+	}
+}
+
+const (
+	minRetryAfter = time.Second
+	maxRetryAfter = 30 * time.Second
+)
+
+// shouldShed returns true if a request with the given priority must be rejected,
+// and how long the client should wait before retrying.
+func (s *LoadShedder) shouldShed(priority requestPriority) (bool, time.Duration) {
+	if priority > priorityLow {
+		return false, 0
+	}
+	// how far over the limits we are.
+	overload := 0.0
+	if s.conf.MaxReadLatency > 0 {
+		if ratio := float64(s.latency()) / float64(s.conf.MaxReadLatency); ratio > 1 {
+			overload = math.Max(overload, ratio)
+		}
+	}
+	if s.conf.MaxQueueDepth > 0 {
+		if ratio := float64(s.queueDepth()) / float64(s.conf.MaxQueueDepth); ratio > 1 {
+			overload = math.Max(overload, ratio)
+		}
+	}
+	if overload == 0 {
+		return false, 0
+	}
+	retryAfter := time.Duration(overload * float64(minRetryAfter))
+	if retryAfter > maxRetryAfter {
+		retryAfter = maxRetryAfter
+	}
+	return true, retryAfter.Round(time.Second)
+}
+
+// replyOverloaded tells the client that the request was rejected, and when to retry.
+func replyOverloaded(reqCtx *fasthttp.RequestCtx, id jsonrpc2.ID, retryAfter time.Duration) {
+	seconds := int(retryAfter / time.Second)
+	reqCtx.Response.Header.Set("Retry-After", strconv.Itoa(seconds))
+	rpcErr := &jsonrpc2.Error{
+		Code:    CodeServerOverloaded,
+		Message: "Server is overloaded, retry later",
+	}
+	rpcErr.SetError(map[string]any{
+		"reason":     ReasonOverloaded,
+		"retryAfter": seconds,
+	})
+	replyJSON(reqCtx, http.StatusServiceUnavailable, jsonrpc2.Response{
+		ID:    id,
+		Error: rpcErr,
+	})
+}
+
+// reject replies with an error (and returns true) if the request must be shed; a nil LoadShedder never sheds.
+// The id is the one of the JSON-RPC request, or nil for the GET API.
+func (s *LoadShedder) reject(reqCtx *fasthttp.RequestCtx, method string, priority requestPriority, id *jsonrpc2.ID) bool {
+	if s == nil {
+		return false
+	}
+	shed, retryAfter := s.shouldShed(priority)
+	if !shed {
+		return false
+	}
+	metrics_loadShed.WithLabelValues(sanitizeMethod(method)).Inc()
+	if id == nil {
+		replyRestError(reqCtx, http.StatusServiceUnavailable, "server is overloaded, retry later")
+		reqCtx.Response.Header.Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+		return true
+	}
+	replyOverloaded(reqCtx, *id, retryAfter)
+	return true
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newLatencyTracker(time.Second)
+	tracker.now = func() time.Time { return now }
+	require.Equal(t, time.Duration(0), tracker.Value())
+
+	// the first observation is taken as is.
+	tracker.Observe(100 * time.Millisecond)
+	require.Equal(t, 100*time.Millisecond, tracker.Value())
+
+	// a burst of slow reads moves the average up.
+	for i := 0; i < 100; i++ {
+		tracker.Observe(time.Second)
+	}
+	require.Greater(t, tracker.Value(), 900*time.Millisecond)
+
+	// when the storage is idle, the average decays (after a grace period).
+	now = now.Add(time.Second)
+	require.Greater(t, tracker.Value(), 900*time.Millisecond)
+	now = now.Add(5 * time.Second)
+	require.Less(t, tracker.Value(), 10*time.Millisecond)
+}
+
+func TestLoadShedder(t *testing.T) {
+	latency := 10 * time.Millisecond
+	queueDepth := 0
+	shedder := &LoadShedder{
+		conf: LoadShedderConfig{
+			MaxReadLatency: 50 * time.Millisecond,
+			MaxQueueDepth:  100,
+		},
+		latency:    func() time.Duration { return latency },
+		queueDepth: func() int { return queueDepth },
+	}
+	shed, _ := shedder.shouldShed(methodPriority("getBlock"))
+	require.False(t, shed)
+
+	latency = 100 * time.Millisecond
+	shed, retryAfter := shedder.shouldShed(methodPriority("getBlock"))
+	require.True(t, shed)
+	require.Equal(t, 2*time.Second, retryAfter)
+	// normal priority requests are still served.
+	shed, _ = shedder.shouldShed(methodPriority("getTransaction"))
+	require.False(t, shed)
+
+	latency = 10 * time.Millisecond
+	queueDepth = 10_000
+	shed, retryAfter = shedder.shouldShed(methodPriority("GET /block/"))
+	require.True(t, shed)
+	require.Equal(t, maxRetryAfter, retryAfter)
+}
+
+func TestWorkerPoolWaiting(t *testing.T) {
+	pool := newWorkerPool(1)
+	release := make(chan struct{})
+	wg, _ := pool.Group(context.Background())
+	wg.Go(func() error {
+		<-release
+		return nil
+	})
+	submitted := make(chan struct{})
+	go func() {
+		wg.Go(func() error { return nil })
+		close(submitted)
+	}()
+	require.Eventually(t, func() bool { return pool.Waiting() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	<-submitted
+	require.NoError(t, wg.Wait())
+	require.Equal(t, 0, pool.Waiting())
+}
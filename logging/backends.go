@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+// NewBackend returns the backend with the given name: klog, json (zap JSON to stderr), or journald.
+func NewBackend(name string) (Backend, error) {
+	switch name {
+	case "", "klog":
+		return KlogBackend{}, nil
+	case "json", "zap":
+		return NewZapBackend(zapcore.Lock(os.Stderr)), nil
+	case "journald":
+		return NewJournaldBackend(DefaultJournaldSocket)
+	default:
+		return nil, fmt.Errorf("unknown log backend %q (supported: klog, json, journald)", name)
+	}
+}
+
+// callerDepth is the depth of the caller of the Logger methods, as seen from Backend.Write.
+const callerDepth = 3
+
+// KlogBackend writes the entries to klog, as `[component] message key=value ...`.
+type KlogBackend struct{}
+
+func (KlogBackend) Write(entry *Entry) {
+	line := formatText(entry)
+	switch entry.Level {
+	case ErrorLevel:
+		klog.ErrorDepth(callerDepth, line)
+	case WarnLevel:
+		klog.WarningDepth(callerDepth, line)
+	default:
+		klog.InfoDepth(callerDepth, line)
+	}
+}
+
+func (KlogBackend) Sync() error {
+	klog.Flush()
+	return nil
+}
+
+func formatText(entry *Entry) string {
+	var b strings.Builder
+	if entry.Component != "" {
+		b.WriteString("[")
+		b.WriteString(entry.Component)
+		b.WriteString("] ")
+	}
+	b.WriteString(entry.Message)
+	for _, field := range entry.Fields {
+		b.WriteString(" ")
+		b.WriteString(field.Key)
+		b.WriteString("=")
+		value := formatValue(field.Value)
+		if strings.ContainsAny(value, " \t\n\"=") || value == "" {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		if v == nil {
+			return "<nil>"
+		}
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ZapBackend writes the entries as JSON lines, using zap.
+type ZapBackend struct {
+	logger *zap.Logger
+}
+
+// NewZapBackend returns a backend that writes JSON lines to the given writer.
+func NewZapBackend(out zapcore.WriteSyncer) *ZapBackend {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "time"
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), out, zapcore.DebugLevel)
+	return &ZapBackend{
+		logger: zap.New(core, zap.AddCaller(), zap.AddCallerSkip(callerDepth)),
+	}
+}
+
+func (z *ZapBackend) Write(entry *Entry) {
+	fields := make([]zap.Field, 0, len(entry.Fields)+1)
+	if entry.Component != "" {
+		fields = append(fields, zap.String("component", entry.Component))
+	}
+	for _, field := range entry.Fields {
+		if err, ok := field.Value.(error); ok {
+			fields = append(fields, zap.NamedError(field.Key, err))
+			continue
+		}
+		fields = append(fields, zap.Any(field.Key, field.Value))
+	}
+	if ce := z.logger.Check(zapLevel(entry.Level), entry.Message); ce != nil {
+		ce.Time = entry.Time
+		ce.Write(fields...)
+	}
+}
+
+func (z *ZapBackend) Sync() error {
+	return z.logger.Sync()
+}
+
+func zapLevel(level Level) zapcore.Level {
+	switch level {
+	case DebugLevel:
+		return zapcore.DebugLevel
+	case WarnLevel:
+		return zapcore.WarnLevel
+	case ErrorLevel:
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
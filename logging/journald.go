@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultJournaldSocket is the socket of the journald native protocol.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldBackend sends the entries to journald using its native protocol,
+// with the fields as journal fields (e.g. slot=123 becomes SLOT=123).
+type JournaldBackend struct {
+	conn       *net.UnixConn
+	addr       *net.UnixAddr
+	identifier string
+	mu         sync.Mutex
+}
+
+func NewJournaldBackend(socketPath string) (*JournaldBackend, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journald socket: %w", err)
+	}
+	addr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+	if _, err := os.Stat(socketPath); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("journald socket not available: %w", err)
+	}
+	return &JournaldBackend{
+		conn:       conn,
+		addr:       addr,
+		identifier: filepath.Base(os.Args[0]),
+	}, nil
+}
+
+func (j *JournaldBackend) Write(entry *Entry) {
+	msg := encodeJournaldEntry(entry, j.identifier)
+	j.mu.Lock()
+	_, err := j.conn.WriteToUnix(msg, j.addr)
+	j.mu.Unlock()
+	if err != nil {
+		// don't lose the entry.
+		fmt.Fprintf(os.Stderr, "%s (journald error: %v)\n", formatText(entry), err)
+	}
+}
+
+func (j *JournaldBackend) Sync() error {
+	return nil
+}
+
+func (j *JournaldBackend) Close() error {
+	return j.conn.Close()
+}
+
+// journaldPriority returns the syslog priority of the level.
+func journaldPriority(level Level) int {
+	switch level {
+	case DebugLevel:
+		return 7
+	case WarnLevel:
+		return 4
+	case ErrorLevel:
+		return 3
+	default:
+		return 6
+	}
+}
+
+func encodeJournaldEntry(entry *Entry, identifier string) []byte {
+	var buf bytes.Buffer
+	writeJournaldField(&buf, "MESSAGE", entry.Message)
+	writeJournaldField(&buf, "PRIORITY", fmt.Sprint(journaldPriority(entry.Level)))
+	if identifier != "" {
+		writeJournaldField(&buf, "SYSLOG_IDENTIFIER", identifier)
+	}
+	if entry.Component != "" {
+		writeJournaldField(&buf, "COMPONENT", entry.Component)
+	}
+	for _, field := range entry.Fields {
+		name := journaldFieldName(field.Key)
+		if name == "" {
+			continue
+		}
+		writeJournaldField(&buf, name, formatValue(field.Value))
+	}
+	return buf.Bytes()
+}
+
+// writeJournaldField writes a field; values with newlines use the binary format
+// (name, newline, little-endian uint64 size, value, newline).
+func writeJournaldField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName converts a field key to a valid journal field name
+// (uppercase letters, digits and underscores, not starting with an underscore or a digit).
+func journaldFieldName(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(unicode.ToUpper(r))
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimLeft(b.String(), "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,282 @@
+// Package logging is a small structured logging facade with pluggable backends
+// (klog, zap JSON, journald) and per-component levels.
+//
+// Loggers are created once per component (logging.Named("rpc")) and log
+// messages with structured fields (slot, cid, signature, request ID, ...);
+// the backend and the levels can be changed at any time.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Level int8
+
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return fmt.Sprintf("Level(%d)", l)
+	}
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (supported: debug, info, warn, error)", s)
+	}
+}
+
+// Field is a structured key-value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value any
+}
+
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Uint64(key string, value uint64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+func Slot(slot uint64) Field {
+	return Field{Key: "slot", Value: slot}
+}
+
+func Epoch(epoch uint64) Field {
+	return Field{Key: "epoch", Value: epoch}
+}
+
+func Cid(c fmt.Stringer) Field {
+	return Field{Key: "cid", Value: c.String()}
+}
+
+func Signature(sig fmt.Stringer) Field {
+	return Field{Key: "sig", Value: sig.String()}
+}
+
+func RequestID(id string) Field {
+	return Field{Key: "requestId", Value: id}
+}
+
+// Entry is a log entry, as passed to the backend.
+type Entry struct {
+	Time      time.Time
+	Level     Level
+	Component string
+	Message   string
+	Fields    []Field
+}
+
+// Backend writes log entries somewhere.
+type Backend interface {
+	Write(entry *Entry)
+	Sync() error
+}
+
+type config struct {
+	backend      Backend
+	defaultLevel Level
+	levels       map[string]Level
+}
+
+var current atomic.Pointer[config]
+
+func init() {
+	current.Store(&config{
+		backend:      KlogBackend{},
+		defaultLevel: InfoLevel,
+	})
+}
+
+// SetBackend replaces the backend used by all the loggers.
+func SetBackend(backend Backend) {
+	for {
+		old := current.Load()
+		updated := *old
+		updated.backend = backend
+		if current.CompareAndSwap(old, &updated) {
+			return
+		}
+	}
+}
+
+// SetLevels sets the levels from a spec like "info,rpc=debug,index=warn":
+// a bare level sets the default level, component=level sets the level of a component.
+func SetLevels(spec string) error {
+	defaultLevel := InfoLevel
+	levels := make(map[string]Level)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		component, levelName, ok := strings.Cut(part, "=")
+		if !ok {
+			level, err := ParseLevel(part)
+			if err != nil {
+				return err
+			}
+			defaultLevel = level
+			continue
+		}
+		level, err := ParseLevel(levelName)
+		if err != nil {
+			return fmt.Errorf("invalid level for component %q: %w", component, err)
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	for {
+		old := current.Load()
+		updated := *old
+		updated.defaultLevel = defaultLevel
+		updated.levels = levels
+		if current.CompareAndSwap(old, &updated) {
+			return nil
+		}
+	}
+}
+
+// Levels returns the current levels, in the format accepted by SetLevels.
+func Levels() string {
+	conf := current.Load()
+	parts := []string{conf.defaultLevel.String()}
+	components := make([]string, 0, len(conf.levels))
+	for component := range conf.levels {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		parts = append(parts, component+"="+conf.levels[component].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Sync flushes the backend.
+func Sync() error {
+	return current.Load().backend.Sync()
+}
+
+func (c *config) levelOf(component string) Level {
+	if level, ok := c.levels[component]; ok {
+		return level
+	}
+	return c.defaultLevel
+}
+
+// Logger is the logger of a component.
+type Logger struct {
+	component string
+	fields    []Field
+}
+
+// Named returns the logger for the given component.
+func Named(component string) *Logger {
+	return &Logger{component: component}
+}
+
+// With returns a logger that adds the given fields to every entry.
+func (l *Logger) With(fields ...Field) *Logger {
+	return &Logger{
+		component: l.component,
+		fields:    append(append([]Field(nil), l.fields...), fields...),
+	}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= current.Load().levelOf(l.component)
+}
+
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(DebugLevel, msg, fields)
+}
+
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(InfoLevel, msg, fields)
+}
+
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.log(WarnLevel, msg, fields)
+}
+
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	conf := current.Load()
+	if level < conf.levelOf(l.component) {
+		return
+	}
+	if len(l.fields) > 0 {
+		fields = append(append([]Field(nil), l.fields...), fields...)
+	}
+	conf.backend.Write(&Entry{
+		Time:      time.Now(),
+		Level:     level,
+		Component: l.component,
+		Message:   msg,
+		Fields:    fields,
+	})
+}
+
+type contextKey struct{}
+
+// ContextWithFields returns a context carrying the given fields (in addition to the ones
+// already in the context), which are added to the entries of the loggers returned by Logger.Ctx.
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing := FieldsFromContext(ctx)
+	return context.WithValue(ctx, contextKey{}, append(append([]Field(nil), existing...), fields...))
+}
+
+// FieldsFromContext returns the fields carried by the context.
+func FieldsFromContext(ctx context.Context) []Field {
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+// Ctx returns a logger that adds the fields carried by the context (e.g. the request ID) to every entry.
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+type recordingBackend struct {
+	mu      sync.Mutex
+	entries []*Entry
+}
+
+func (r *recordingBackend) Write(entry *Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+func (r *recordingBackend) Sync() error {
+	return nil
+}
+
+func withBackend(t *testing.T, backend Backend) {
+	old := current.Load()
+	t.Cleanup(func() { current.Store(old) })
+	SetBackend(backend)
+}
+
+func TestLevels(t *testing.T) {
+	rec := &recordingBackend{}
+	withBackend(t, rec)
+	require.NoError(t, SetLevels("warn,rpc=debug"))
+	require.Equal(t, "warn,rpc=debug", Levels())
+
+	rpc := Named("rpc")
+	other := Named("index")
+	rpc.Debug("rpc debug")
+	other.Info("index info")
+	other.Warn("index warn")
+	require.Len(t, rec.entries, 2)
+	require.Equal(t, "rpc debug", rec.entries[0].Message)
+	require.Equal(t, DebugLevel, rec.entries[0].Level)
+	require.Equal(t, "index", rec.entries[1].Component)
+	require.True(t, rpc.Enabled(DebugLevel))
+	require.False(t, other.Enabled(InfoLevel))
+
+	require.Error(t, SetLevels("rpc=loud"))
+	require.Error(t, SetLevels("verbose"))
+}
+
+func TestWith(t *testing.T) {
+	rec := &recordingBackend{}
+	withBackend(t, rec)
+
+	logger := Named("rpc").With(RequestID("abc"))
+	logger.Error("failed", Slot(123), Err(errors.New("boom")))
+	require.Len(t, rec.entries, 1)
+	require.Equal(t, []Field{
+		{Key: "requestId", Value: "abc"},
+		{Key: "slot", Value: uint64(123)},
+		{Key: "error", Value: errors.New("boom")},
+	}, rec.entries[0].Fields)
+}
+
+func TestFormatText(t *testing.T) {
+	line := formatText(&Entry{
+		Component: "rpc",
+		Message:   "failed to get block",
+		Fields:    []Field{Slot(7), Err(errors.New("not found")), String("empty", "")},
+	})
+	require.Equal(t, `[rpc] failed to get block slot=7 error="not found" empty=""`, line)
+}
+
+type bufferSyncer struct {
+	bytes.Buffer
+}
+
+func (b *bufferSyncer) Sync() error {
+	return nil
+}
+
+func TestZapBackend(t *testing.T) {
+	var buf bufferSyncer
+	withBackend(t, NewZapBackend(zapcore.AddSync(&buf)))
+
+	Named("rpc").Warn("slow", Slot(1), String("sig", "abc"), Err(errors.New("boom")))
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "warn", line["level"])
+	require.Equal(t, "slow", line["msg"])
+	require.Equal(t, "rpc", line["component"])
+	require.Equal(t, float64(1), line["slot"])
+	require.Equal(t, "abc", line["sig"])
+	require.Equal(t, "boom", line["error"])
+	require.Contains(t, line["caller"], "logging_test.go")
+}
+
+func TestJournaldBackend(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "journal.sock")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer server.Close()
+
+	backend, err := NewJournaldBackend(socketPath)
+	require.NoError(t, err)
+	defer backend.Close()
+	backend.identifier = "faithful"
+	withBackend(t, backend)
+
+	Named("rpc").Error("failed", Slot(42), String("requestId", "a-b"), String("details", "line1\nline2"))
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+
+	var binaryValue bytes.Buffer
+	binaryValue.WriteString("DETAILS\n")
+	binary.Write(&binaryValue, binary.LittleEndian, uint64(len("line1\nline2")))
+	binaryValue.WriteString("line1\nline2\n")
+
+	expected := "MESSAGE=failed\nPRIORITY=3\nSYSLOG_IDENTIFIER=faithful\nCOMPONENT=rpc\nSLOT=42\nREQUESTID=a-b\n" + binaryValue.String()
+	require.Equal(t, expected, string(buf[:n]))
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	require.Equal(t, "REQUEST_ID", journaldFieldName("request-id"))
+	require.Equal(t, "SIG", journaldFieldName("sig"))
+	require.Equal(t, "X", journaldFieldName("_1x"))
+}
+
+func TestContextFields(t *testing.T) {
+	rec := &recordingBackend{}
+	withBackend(t, rec)
+
+	ctx := ContextWithFields(context.Background(), RequestID("abc"))
+	ctx = ContextWithFields(ctx, Slot(1))
+	Named("rpc").Ctx(ctx).Info("hello", Err(nil))
+	Named("rpc").Ctx(context.Background()).Info("no fields")
+	require.Len(t, rec.entries, 2)
+	require.Equal(t, []Field{RequestID("abc"), Slot(1), Err(nil)}, rec.entries[0].Fields)
+	require.Empty(t, rec.entries[1].Fields)
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 
 	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	"github.com/urfave/cli/v2"
 	"k8s.io/klog/v2"
 )
@@ -17,6 +18,7 @@ var gitCommitSHA = ""
 
 func main() {
 	defer klog.Flush()
+	defer logging.Sync()
 
 	// set up a context that is canceled when a command is interrupted
 	ctx, cancel := context.WithCancel(context.Background())
@@ -43,20 +45,26 @@ func main() {
 		Name:        "faithful CLI",
 		Version:     gitCommitSHA,
 		Description: "CLI to get, manage and interact with the Solana blockchain data stored in a CAR file or on Filecoin/IPFS.",
-		Flags:       NewKlogFlagSet(),
+		Flags:       append(append(append(NewKlogFlagSet(), newProgressFlags()...), newPreflightFlags()...), newBandwidthFlags()...),
 		Before: func(cctx *cli.Context) error {
 			return nil
 		},
 		Action: nil,
 		Commands: []*cli.Command{
 			newCmd_DumpCar(),
+			newCmd_Car(),
+			newCmd_Transcode(),
+			newCmd_Replay(),
 			fetchCmd,
 			newCmd_Index(),
 			newCmd_VerifyIndex(),
 			newCmd_XTraverse(),
+			newCmd_XSigPrefix(),
 			newCmd_Version(),
 			newCmd_rpc(),
+			newCmd_preheat(),
 			newCmd_check_deals(),
+			newCmd_Bench(),
 		},
 	}
 
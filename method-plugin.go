@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"k8s.io/klog/v2"
+)
+
+// A method plugin is an executable that serves custom methods (e.g. private analytics queries) of
+// the RPC server, started by the server as a subprocess. They talk with JSON lines over the stdin
+// and stdout of the plugin (its stderr goes to the logs of the server):
+//
+//   - the plugin first writes its methods: {"methods": [{"name": "...", "summary": "...",
+//     "cost": "light" or "heavy", "cacheable": <bool>, "params": [<MethodParam>, ...]}, ...]};
+//   - the server writes the requests of these methods: {"id": <n>, "method": "...", "params": <params>};
+//   - the plugin writes the responses, in any order: {"id": <n>, "result": <result>}, or
+//     {"id": <n>, "error": {"code": <code>, "message": "..."}}.
+//
+// The plugin reads the archive with the RPC of the server, whose URL is in its FAITHFUL_RPC_URL env.
+
+// pluginHandshakeTimeout is how long the server waits for the methods of a plugin.
+const pluginHandshakeTimeout = 10 * time.Second
+
+type pluginMethod struct {
+	Name    string `json:"name"`
+	Summary string `json:"summary"`
+	Cost    string `json:"cost"`
+	// Cacheable makes the results of the method cached by their params (with the response cache).
+	Cacheable bool `json:"cacheable"`
+	Params    []struct {
+		Name     string         `json:"name"`
+		Summary  string         `json:"summary"`
+		Required bool           `json:"required"`
+		Schema   map[string]any `json:"schema"`
+	} `json:"params"`
+}
+
+type pluginRequest struct {
+	ID     uint64           `json:"id"`
+	Method string           `json:"method"`
+	Params *json.RawMessage `json:"params,omitempty"`
+}
+
+type pluginResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int64  `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// methodPlugin is a running plugin.
+type methodPlugin struct {
+	path string
+	cmd  *exec.Cmd
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *pluginResponse
+	// exitErr is set when the plugin is gone; the calls fail from then on.
+	exitErr error
+}
+
+// startMethodPlugin starts the plugin, and reads its methods.
+func startMethodPlugin(path string, rpcURL string) (*methodPlugin, []pluginMethod, error) {
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), "FAITHFUL_RPC_URL="+rpcURL)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start plugin %q: %w", path, err)
+	}
+	plugin := &methodPlugin{
+		path:    path,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[uint64]chan *pluginResponse),
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	handshake := make(chan error, 1)
+	var methods []pluginMethod
+	go func() {
+		if !scanner.Scan() {
+			handshake <- fmt.Errorf("the plugin exited before writing its methods: %v", scanner.Err())
+			return
+		}
+		var hello struct {
+			Methods []pluginMethod `json:"methods"`
+		}
+		if err := fasterJson.Unmarshal(scanner.Bytes(), &hello); err != nil {
+			handshake <- fmt.Errorf("invalid methods: %w", err)
+			return
+		}
+		methods = hello.Methods
+		handshake <- nil
+		plugin.readResponses(scanner)
+	}()
+	select {
+	case err = <-handshake:
+	case <-time.After(pluginHandshakeTimeout):
+		err = fmt.Errorf("the plugin didn't write its methods in %s", pluginHandshakeTimeout)
+	}
+	if err != nil {
+		plugin.Close()
+		return nil, nil, fmt.Errorf("plugin %q: %w", path, err)
+	}
+	return plugin, methods, nil
+}
+
+func (p *methodPlugin) readResponses(scanner *bufio.Scanner) {
+	for scanner.Scan() {
+		var resp pluginResponse
+		if err := fasterJson.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			klog.Errorf("plugin %q: invalid response: %s", p.path, err)
+			continue
+		}
+		p.mu.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mu.Unlock()
+		if ok {
+			ch <- &resp
+		}
+	}
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	klog.Errorf("plugin %q is gone: %s", p.path, err)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exitErr = fmt.Errorf("plugin %q is gone: %w", p.path, err)
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+}
+
+// call sends the request to the plugin, and waits for its response.
+func (p *methodPlugin) call(ctx context.Context, method string, params *json.RawMessage) (*pluginResponse, error) {
+	p.mu.Lock()
+	if p.exitErr != nil {
+		p.mu.Unlock()
+		return nil, p.exitErr
+	}
+	p.nextID++
+	id := p.nextID
+	ch := make(chan *pluginResponse, 1)
+	p.pending[id] = ch
+	p.mu.Unlock()
+
+	line, err := fasterJson.Marshal(&pluginRequest{ID: id, Method: method, Params: params})
+	if err != nil {
+		p.forget(id)
+		return nil, err
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(line, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		p.forget(id)
+		return nil, fmt.Errorf("failed to write to plugin %q: %w", p.path, err)
+	}
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("plugin %q exited during the request", p.path)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		p.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (p *methodPlugin) forget(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// Close stops the plugin.
+func (p *methodPlugin) Close() error {
+	p.stdin.Close()
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+	}
+	return p.cmd.Wait()
+}
+
+// handler returns the handler of a method of the plugin.
+func (p *methodPlugin) handler() MethodHandler {
+	return func(multi *MultiEpoch, ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+		resp, err := p.call(ctx, req.Method, req.Params)
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to call the plugin method %q: %w", req.Method, err))
+		}
+		if resp.Error != nil {
+			return &jsonrpc2.Error{
+				Code:    resp.Error.Code,
+				Message: resp.Error.Message,
+			}, fmt.Errorf("plugin method %q failed: %s", req.Method, resp.Error.Message)
+		}
+		result := resp.Result
+		if len(result) == 0 {
+			result = json.RawMessage("null")
+		}
+		if err := conn.ReplyRaw(ctx, req.ID, result); err != nil {
+			return nil, fmt.Errorf("failed to reply: %w", err)
+		}
+		return nil, nil
+	}
+}
+
+// spec returns the spec of a method of the plugin.
+func (p *methodPlugin) spec(method pluginMethod) (*MethodSpec, error) {
+	spec := &MethodSpec{
+		Name:    method.Name,
+		Summary: method.Summary,
+		Handler: p.handler(),
+	}
+	switch method.Cost {
+	case "", "light":
+	case "heavy":
+		spec.Cost = MethodCostHeavy
+	default:
+		return nil, fmt.Errorf("method %q has an unknown cost %q (supported: light, heavy)", method.Name, method.Cost)
+	}
+	for _, param := range method.Params {
+		spec.Params = append(spec.Params, MethodParam{
+			Name:     param.Name,
+			Summary:  param.Summary,
+			Required: param.Required,
+			Schema:   param.Schema,
+		})
+	}
+	if method.Cacheable {
+		spec.CacheKey = func(req *jsonrpc2.Request) (any, bool) {
+			return req.Params, true
+		}
+	}
+	return spec, nil
+}
+
+// StartMethodPlugins starts the plugins, and registers their methods; the methods of the
+// plugins can't replace the ones of the server (or of another plugin).
+func StartMethodPlugins(paths []string, listenOn string) ([]*methodPlugin, error) {
+	rpcURL := localRPCURL(listenOn)
+	var plugins []*methodPlugin
+	closeAll := func() {
+		for _, plugin := range plugins {
+			plugin.Close()
+		}
+	}
+	for _, path := range paths {
+		plugin, methods, err := startMethodPlugin(path, rpcURL)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		plugins = append(plugins, plugin)
+		names := make([]string, 0, len(methods))
+		for _, method := range methods {
+			spec, err := plugin.spec(method)
+			if err == nil {
+				err = RegisterMethod(spec)
+			}
+			if err != nil {
+				closeAll()
+				return nil, fmt.Errorf("plugin %q: %w", path, err)
+			}
+			names = append(names, method.Name)
+		}
+		klog.Infof("Plugin %q serves: %s", path, strings.Join(names, ", "))
+	}
+	return plugins, nil
+}
+
+// localRPCURL returns the URL with which the plugins reach the RPC server listening on the given address.
+func localRPCURL(listenOn string) string {
+	host, port, err := net.SplitHostPort(listenOn)
+	if err != nil {
+		return "http://" + listenOn
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMethodPluginProcess is the plugin of TestMethodPlugin (a subprocess of the test binary).
+func TestMethodPluginProcess(t *testing.T) {
+	if os.Getenv("FAITHFUL_TEST_PLUGIN") != "1" {
+		return
+	}
+	fmt.Println(`{"methods": [{"name": "x_echo", "summary": "Echoes its params.", "cost": "heavy", "cacheable": true, "params": [{"name": "value", "required": true, "schema": {"type": "string"}}]}, {"name": "x_fail"}]}`)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req pluginRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(1)
+		}
+		if req.Method == "x_fail" {
+			fmt.Printf(`{"id": %d, "error": {"code": -32602, "message": "nope"}}`+"\n", req.ID)
+			continue
+		}
+		fmt.Printf(`{"id": %d, "result": {"params": %s, "rpc": %q}}`+"\n", req.ID, *req.Params, os.Getenv("FAITHFUL_RPC_URL"))
+	}
+	os.Exit(0)
+}
+
+func TestMethodPlugin(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "plugin.sh")
+	require.NoError(t, os.WriteFile(script, []byte(fmt.Sprintf("#!/bin/sh\nFAITHFUL_TEST_PLUGIN=1 exec %q -test.run=^TestMethodPluginProcess$\n", os.Args[0])), 0o755))
+
+	plugin, methods, err := startMethodPlugin(script, localRPCURL(":8899"))
+	require.NoError(t, err)
+	defer plugin.Close()
+	require.Len(t, methods, 2)
+
+	spec, err := plugin.spec(methods[0])
+	require.NoError(t, err)
+	require.Equal(t, "x_echo", spec.Name)
+	require.Equal(t, MethodCostHeavy, spec.Cost)
+	require.NotNil(t, spec.CacheKey)
+	require.Len(t, spec.Params, 1)
+
+	params := json.RawMessage(`["hello"]`)
+	resp, err := plugin.call(context.Background(), "x_echo", &params)
+	require.NoError(t, err)
+	require.Nil(t, resp.Error)
+	require.JSONEq(t, `{"params": ["hello"], "rpc": "http://127.0.0.1:8899"}`, string(resp.Result))
+
+	resp, err = plugin.call(context.Background(), "x_fail", &params)
+	require.NoError(t, err)
+	require.Equal(t, "nope", resp.Error.Message)
+
+	_, err = plugin.spec(pluginMethod{Name: "x_bad", Cost: "expensive"})
+	require.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// MethodHandler handles the requests of a JSON-RPC method.
+type MethodHandler func(multi *MultiEpoch, ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error)
+
+// MethodCost is the cost class of a method: how much data its requests read.
+type MethodCost int
+
+const (
+	// MethodCostLight methods read a few nodes (normal priority).
+	MethodCostLight MethodCost = iota
+	// MethodCostHeavy methods read a lot of data, e.g. whole blocks or many transactions (low priority).
+	MethodCostHeavy
+)
+
+func (c MethodCost) String() string {
+	if c == MethodCostHeavy {
+		return "heavy"
+	}
+	return "light"
+}
+
+// MethodParam is a param of a method.
+type MethodParam struct {
+	Name     string
+	Summary  string
+	Required bool
+	// Schema is the JSON schema of the param.
+	Schema map[string]any
+}
+
+// MethodSpec is a JSON-RPC method served by the server, with its metadata: the single
+// source of the routing, the cache and priority policies, and the OpenRPC document.
+type MethodSpec struct {
+	Name    string
+	Summary string
+	Params  []MethodParam
+	Cost    MethodCost
+	// CacheKey (optional) returns the normalized params of a request, to cache its result with
+	// (see normalizeRequest), and false if the request is not cacheable. The methods without
+	// it are never cached.
+	CacheKey func(req *jsonrpc2.Request) (any, bool)
+	Handler  MethodHandler
+}
+
+// methodRegistry has the methods of the server, by name; the methods register themselves
+// (see mustRegisterMethod) next to their handler.
+var methodRegistry = struct {
+	mu      sync.RWMutex
+	methods map[string]*MethodSpec
+}{
+	methods: make(map[string]*MethodSpec),
+}
+
+// RegisterMethod adds a method to the server.
+func RegisterMethod(spec *MethodSpec) error {
+	if spec == nil || spec.Name == "" || spec.Handler == nil {
+		return fmt.Errorf("a method must have a name and a handler")
+	}
+	methodRegistry.mu.Lock()
+	defer methodRegistry.mu.Unlock()
+	if _, ok := methodRegistry.methods[spec.Name]; ok {
+		return fmt.Errorf("method %q is already registered", spec.Name)
+	}
+	methodRegistry.methods[spec.Name] = spec
+	return nil
+}
+
+func mustRegisterMethod(spec *MethodSpec) {
+	if err := RegisterMethod(spec); err != nil {
+		panic(err)
+	}
+}
+
+// lookupMethod returns the registered method with the given name.
+func lookupMethod(name string) (*MethodSpec, bool) {
+	methodRegistry.mu.RLock()
+	defer methodRegistry.mu.RUnlock()
+	spec, ok := methodRegistry.methods[name]
+	return spec, ok
+}
+
+// registeredMethods returns the registered methods, sorted by name.
+func registeredMethods() []*MethodSpec {
+	methodRegistry.mu.RLock()
+	defer methodRegistry.mu.RUnlock()
+	out := make([]*MethodSpec, 0, len(methodRegistry.methods))
+	for _, spec := range methodRegistry.methods {
+		out = append(out, spec)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// The params shared by many methods.
+
+func uintParam(name string, summary string) MethodParam {
+	return MethodParam{Name: name, Summary: summary, Required: true, Schema: map[string]any{"type": "integer", "minimum": 0}}
+}
+
+func stringParam(name string, summary string) MethodParam {
+	return MethodParam{Name: name, Summary: summary, Required: true, Schema: map[string]any{"type": "string"}}
+}
+
+func configParam(summary string) MethodParam {
+	return MethodParam{Name: "config", Summary: summary, Schema: map[string]any{"type": "object"}}
+}
+
+// openRPCDocument returns the OpenRPC document of the registered methods.
+func openRPCDocument(version string) map[string]any {
+	specs := registeredMethods()
+	methods := make([]any, 0, len(specs))
+	for _, spec := range specs {
+		params := make([]any, 0, len(spec.Params))
+		for _, param := range spec.Params {
+			params = append(params, map[string]any{
+				"name":     param.Name,
+				"summary":  param.Summary,
+				"required": param.Required,
+				"schema":   param.Schema,
+			})
+		}
+		methods = append(methods, map[string]any{
+			"name":    spec.Name,
+			"summary": spec.Summary,
+			"params":  params,
+			"result": map[string]any{
+				"name":   "result",
+				"schema": map[string]any{},
+			},
+			"x-cost-class": spec.Cost.String(),
+			"x-cacheable":  spec.CacheKey != nil,
+		})
+	}
+	return map[string]any{
+		"openrpc": "1.2.6",
+		"info": map[string]any{
+			"title":   "Old Faithful RPC",
+			"version": version,
+		},
+		"methods": methods,
+	}
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "rpc.discover",
+		Summary: "Returns the OpenRPC document of the methods of the server.",
+		Handler: (*MultiEpoch).handleDiscover,
+	})
+}
+
+func (multi *MultiEpoch) handleDiscover(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	err := conn.ReplyRaw(
+		ctx,
+		req.ID,
+		openRPCDocument(GitTag),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMethodRegistry(t *testing.T) {
+	for _, method := range []string{
+		"getBlock", "getTransaction", "getSignaturesForAddress", "getBlockTime", "getGenesisHash",
+		"getFirstAvailableBlock", "getSlot", "faithful_getEpochRoot", "faithful_getRawNode",
+		"faithful_getTransactions", "getSignatureStatuses", "faithful_getSlotCoverage", "faithful_getEntries",
+		"getSlotLeaders", "getBlockProduction", "faithful_getAccountAtEpochBoundary", "faithful_getBlockHash256", "getBlocks", "getBlocksWithLimit",
+		"rpc.discover",
+	} {
+		require.True(t, isValidLocalMethod(method), method)
+	}
+	require.False(t, isValidLocalMethod("getAccountInfo"))
+
+	require.Equal(t, priorityLow, methodPriority("getBlock"))
+	require.Equal(t, priorityNormal, methodPriority("getBlockTime"))
+	require.Equal(t, priorityNormal, methodPriority("getAccountInfo"))
+
+	handler := func(multi *MultiEpoch, ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+		return nil, nil
+	}
+	require.Error(t, RegisterMethod(&MethodSpec{Name: "getBlock", Handler: handler}))
+	require.Error(t, RegisterMethod(&MethodSpec{Name: "faithful_noHandler"}))
+
+	doc := openRPCDocument("v1.0.0")
+	methods := doc["methods"].([]any)
+	require.Len(t, methods, len(registeredMethods()))
+	var getBlock map[string]any
+	for _, method := range methods {
+		if method.(map[string]any)["name"] == "getBlock" {
+			getBlock = method.(map[string]any)
+		}
+	}
+	require.NotNil(t, getBlock)
+	require.Equal(t, "heavy", getBlock["x-cost-class"])
+	require.Equal(t, true, getBlock["x-cacheable"])
+	require.Len(t, getBlock["params"], 2)
+}
@@ -1,6 +1,11 @@
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+)
 
 // - RPC requests by method (counter)
 // - Epochs available epoch_available{epoch="200"} = 1
@@ -17,6 +22,31 @@ func init() {
 	prometheus.MustRegister(metrics_methodToSuccessOrFailure)
 	prometheus.MustRegister(metrics_methodToNumProxied)
 	prometheus.MustRegister(metrics_responseTimeHistogram)
+	prometheus.MustRegister(metrics_cacheInvalidations)
+	prometheus.MustRegister(metrics_cacheInvalidatedEntries)
+	prometheus.MustRegister(metrics_cachePinOperations)
+	prometheus.MustRegister(metrics_responseCache)
+	prometheus.MustRegister(metrics_blockAssemblyCache)
+	prometheus.MustRegister(metrics_panicsRecovered)
+	prometheus.MustRegister(metrics_loadShed)
+	prometheus.MustRegister(metrics_requestsByPriority)
+	prometheus.MustRegister(metrics_indexRebuilds)
+	prometheus.MustRegister(metrics_epochSearchCandidates)
+	prometheus.MustRegister(metrics_indexRebuildsInProgress)
+	prometheus.MustRegister(metrics_carReadLatency)
+	prometheus.MustRegister(metrics_indexSampleMismatchRate)
+	prometheus.MustRegister(metrics_sharedResourcesOpen)
+	prometheus.MustRegister(metrics_integrityCheckFailing)
+	prometheus.MustRegister(metrics_artifactCacheBytes)
+	prometheus.MustRegister(metrics_artifactCacheFiles)
+	prometheus.MustRegister(metrics_artifactCacheEvictions)
+	prometheus.MustRegister(metrics_artifactCacheEvictedBytes)
+	prometheus.MustRegister(metrics_readAmplification)
+	prometheus.MustRegister(metrics_nodesTouched)
+	prometheus.MustRegister(metrics_storageBytesRead)
+	prometheus.MustRegister(metrics_epochStandbyServing)
+	prometheus.MustRegister(metrics_epochStandbyFailovers)
+	prometheus.MustRegister(metrics_nodeCidMismatches)
 }
 
 var metrics_RpcRequestByMethod = prometheus.NewCounterVec(
@@ -74,3 +104,315 @@ var metrics_responseTimeHistogram = prometheus.NewHistogramVec(
 	},
 	[]string{"method"},
 )
+
+var metrics_readAmplification = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "read_amplification",
+		Help:    "Bytes of the DAG nodes touched by a request per byte of its response, by method",
+		Buckets: prometheus.ExponentialBuckets(0.125, 2, 14),
+	},
+	[]string{"method"},
+)
+
+var metrics_nodesTouched = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "request_nodes_touched",
+		Help:    "DAG nodes touched by a request (from the cache or the storage), by method",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	},
+	[]string{"method"},
+)
+
+var metrics_storageBytesRead = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "request_storage_bytes_read",
+		Help:    "Bytes read from the storage (CAR files, Filecoin) by a request, by method",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 10),
+	},
+	[]string{"method"},
+)
+
+var metrics_cacheInvalidations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cache_invalidations",
+		Help: "Cache invalidations by kind (slot, cid, epoch, all)",
+	},
+	[]string{"kind"},
+)
+
+var metrics_cacheInvalidatedEntries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cache_invalidated_entries",
+		Help: "Cache entries removed by invalidations, by kind",
+	},
+	[]string{"kind"},
+)
+
+var metrics_cachePinOperations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "cache_pin_operations",
+		Help: "Cache pin/unpin operations",
+	},
+	[]string{"operation"},
+)
+
+var metrics_responseCache = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "response_cache",
+		Help: "Response cache lookups and stores",
+	},
+	[]string{"result"},
+)
+
+var metrics_blockAssemblyCache = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "block_assembly_cache",
+		Help: "Block assembly cache lookups, stores and evictions",
+	},
+	[]string{"result"},
+)
+
+var metrics_panicsRecovered = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "panics_recovered",
+		Help: "Panics recovered while serving requests, by where they happened",
+	},
+	[]string{"where"},
+)
+
+var metrics_loadShed = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "load_shed_requests",
+		Help: "Requests rejected because the storage was saturated, by method",
+	},
+	[]string{"method"},
+)
+
+var metrics_epochSearchCandidates = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "epoch_search_candidates",
+		Help:    "Number of epochs whose sig-to-cid index is looked up when searching for a signature",
+		Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64, 128, 256},
+	},
+)
+
+var metrics_indexRebuilds = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "index_rebuilds",
+		Help: "Regenerations of missing or stale index files, by index and result",
+	},
+	[]string{"index", "result"},
+)
+
+var metrics_indexRebuildsInProgress = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "index_rebuilds_in_progress",
+		Help: "Regenerations of index files in progress",
+	},
+)
+
+var metrics_integrityCheckFailing = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "integrity_check_failing",
+		Help: "Files of the epochs failing their integrity check (1) or passing it (0)",
+	},
+	[]string{"epoch", "artifact"},
+)
+
+var metrics_artifactCacheBytes = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "artifact_cache_bytes",
+		Help: "Total size of the files of the managed cache directory, after the last garbage collection",
+	},
+)
+
+var metrics_artifactCacheFiles = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "artifact_cache_files",
+		Help: "Files of the managed cache directory, after the last garbage collection",
+	},
+)
+
+var metrics_artifactCacheEvictions = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "artifact_cache_evictions",
+		Help: "Files removed from the managed cache directory by its retention policy",
+	},
+)
+
+var metrics_artifactCacheEvictedBytes = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "artifact_cache_evicted_bytes",
+		Help: "Bytes removed from the managed cache directory by its retention policy",
+	},
+)
+
+var metrics_sharedResourcesOpen = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "shared_resources_open",
+		Help: "CAR files and index files open, shared by the epochs using them",
+	},
+)
+
+var metrics_indexSampleMismatchRate = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "index_sample_mismatch_rate",
+		Help: "Share of the sampled entries of an index that don't match the CAR file, when the epoch was loaded",
+	},
+	[]string{"epoch", "index"},
+)
+
+var metrics_epochStandbyServing = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "epoch_standby_serving",
+		Help: "Epochs served by their standby (1) or by themselves (0), for the epochs that have a standby",
+	},
+	[]string{"epoch"},
+)
+
+var metrics_epochStandbyFailovers = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "epoch_standby_failovers",
+		Help: "Promotions of the standby of an epoch, after the reads of the epoch failed or were too slow",
+	},
+	[]string{"epoch"},
+)
+
+var metrics_nodeCidMismatches = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "node_cid_mismatches",
+		Help: "Nodes read from a CAR that didn't match their CID, by whether an alternate source had them (repaired) or not (unrepaired)",
+	},
+	[]string{"epoch", "outcome"},
+)
+
+var metrics_requestsByPriority = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "requests_by_priority",
+		Help: "Requests by priority class",
+	},
+	[]string{"priority"},
+)
+
+var metrics_carReadLatency = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "car_read_latency_avg_seconds",
+		Help: "Moving average of the latency of the reads from the CAR files",
+	},
+	func() float64 {
+		return carReadLatency.Value().Seconds()
+	},
+)
+
+// registerCacheMetrics registers gauges that report the occupancy of the given cache.
+func registerCacheMetrics(cache *hugecache.Cache) {
+	gauge := func(name string, help string, fn func(hugecache.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: name,
+				Help: help,
+			},
+			func() float64 {
+				return fn(cache.Stats())
+			},
+		)
+	}
+	prometheus.MustRegister(
+		gauge("cache_entries", "Number of entries in the cache", func(s hugecache.Stats) float64 { return float64(s.Entries) }),
+		gauge("cache_capacity_bytes", "Capacity of the cache in bytes", func(s hugecache.Stats) float64 { return float64(s.CapacityBytes) }),
+		gauge("cache_hits", "Cache hits", func(s hugecache.Stats) float64 { return float64(s.Hits) }),
+		gauge("cache_misses", "Cache misses", func(s hugecache.Stats) float64 { return float64(s.Misses) }),
+		gauge("cache_pinned_slots", "Number of slots pinned in the cache", func(s hugecache.Stats) float64 { return float64(s.PinnedSlots) }),
+		gauge("cache_pinned_bytes", "Size of the pinned entries in bytes", func(s hugecache.Stats) float64 { return float64(s.PinnedBytes) }),
+	)
+}
+
+// registerWorkerPoolMetrics registers gauges that report the usage of the DAG fetch pool.
+func registerWorkerPoolMetrics(pool *workerPool) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "dag_fetch_pool_size",
+				Help: "Max number of concurrent DAG fetches",
+			},
+			func() float64 {
+				return float64(pool.Size())
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "dag_fetch_pool_in_use",
+				Help: "Number of DAG fetches in progress",
+			},
+			func() float64 {
+				return float64(pool.InUse())
+			},
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name: "dag_fetch_pool_waiting",
+				Help: "Number of DAG fetches waiting for a free worker",
+			},
+			func() float64 {
+				return float64(pool.Waiting())
+			},
+		),
+	)
+}
+
+// indexStatsCollector reports the lookup counters of the indexes of all the loaded epochs,
+// to tell whether the latency comes from the indexes or from the CAR.
+type indexStatsCollector struct {
+	multi        *MultiEpoch
+	lookups      *prometheus.Desc
+	notFound     *prometheus.Desc
+	failures     *prometheus.Desc
+	bucketProbes *prometheus.Desc
+	entryProbes  *prometheus.Desc
+	bytesRead    *prometheus.Desc
+	buckets      *prometheus.Desc
+}
+
+// registerIndexMetrics registers the index lookup metrics for the epochs of the given MultiEpoch.
+func registerIndexMetrics(multi *MultiEpoch) {
+	labels := []string{"epoch", "index"}
+	prometheus.MustRegister(&indexStatsCollector{
+		multi:        multi,
+		lookups:      prometheus.NewDesc("index_lookups_total", "Index lookups", labels, nil),
+		notFound:     prometheus.NewDesc("index_lookups_not_found_total", "Index lookups of keys not in the index", labels, nil),
+		failures:     prometheus.NewDesc("index_lookup_failures_total", "Index lookups that failed with an error", labels, nil),
+		bucketProbes: prometheus.NewDesc("index_bucket_probes_total", "Index bucket headers read", labels, nil),
+		entryProbes:  prometheus.NewDesc("index_entry_probes_total", "Index hashtable entries read", labels, nil),
+		bytesRead:    prometheus.NewDesc("index_read_bytes_total", "Bytes read from the index", labels, nil),
+		buckets:      prometheus.NewDesc("index_buckets", "Number of buckets in the index", labels, nil),
+	})
+}
+
+func (c *indexStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lookups
+	ch <- c.notFound
+	ch <- c.failures
+	ch <- c.bucketProbes
+	ch <- c.entryProbes
+	ch <- c.bytesRead
+	ch <- c.buckets
+}
+
+func (c *indexStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, epochNumber := range c.multi.GetEpochNumbers() {
+		epoch, err := c.multi.getLoadedEpoch(epochNumber)
+		if err != nil {
+			continue
+		}
+		epochLabel := strconv.FormatUint(epochNumber, 10)
+		for kind, stats := range epoch.IndexStats() {
+			ch <- prometheus.MustNewConstMetric(c.lookups, prometheus.CounterValue, float64(stats.Lookups), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.notFound, prometheus.CounterValue, float64(stats.NotFound), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.failures, prometheus.CounterValue, float64(stats.Failures), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.bucketProbes, prometheus.CounterValue, float64(stats.BucketProbes), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.entryProbes, prometheus.CounterValue, float64(stats.EntryProbes), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.bytesRead, prometheus.CounterValue, float64(stats.BytesRead), epochLabel, kind)
+			ch <- prometheus.MustNewConstMetric(c.buckets, prometheus.GaugeValue, float64(stats.NumBuckets), epochLabel, kind)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package mphindex
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// targetKeysPerPartition is the average number of keys of a partition.
+const targetKeysPerPartition = 100_000
+
+const (
+	// keysPerBucket is the average number of keys of a bucket (λ of PTHash).
+	keysPerBucket = 4
+	// loadFactor is the ratio of keys to slots of the table (α of PTHash).
+	loadFactor = 0.98
+	// maxPilot is the largest pilot searched for a bucket before a new seed is tried.
+	maxPilot = 1 << 24
+	// seedAttempts is the number of seeds tried for a partition.
+	seedAttempts = 16
+)
+
+// ErrCollision is returned when no hash function is found for a partition, most probably
+// because a key was inserted twice.
+var ErrCollision = errors.New("no perfect hash function found (duplicate key?)")
+
+// Builder creates new mph index files.
+type Builder struct {
+	Header     Header
+	tmpDir     string
+	closers    []io.Closer
+	partitions []tempPartition
+}
+
+// NewBuilder creates a new index builder.
+//
+// If dir is an empty string, a random temporary directory is used.
+//
+// numItems refers to the number of items in the index.
+//
+// valueSize is the size of each value in bytes. It must be > 0 and <= 256.
+// All values must be of the same size.
+//
+// fingerprintSize is the number of bytes of the fingerprint of each key (0 to 8).
+func NewBuilder(
+	tmpDir string,
+	numItems uint,
+	valueSize uint,
+	fingerprintSize uint,
+) (*Builder, error) {
+	if tmpDir == "" {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "mphindex-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp dir: %w", err)
+		}
+	}
+	if valueSize == 0 {
+		return nil, fmt.Errorf("valueSize must be > 0")
+	}
+	if valueSize > 256 {
+		return nil, fmt.Errorf("valueSize must be <= 256")
+	}
+	if fingerprintSize > MaxFingerprintSize {
+		return nil, fmt.Errorf("fingerprintSize must be <= %d", MaxFingerprintSize)
+	}
+	if numItems == 0 {
+		return nil, fmt.Errorf("numItems must be > 0")
+	}
+
+	numPartitions := (numItems + targetKeysPerPartition - 1) / targetKeysPerPartition
+	partitions := make([]tempPartition, numPartitions)
+	closers := make([]io.Closer, 0, numPartitions)
+	for i := range partitions {
+		name := filepath.Join(tmpDir, fmt.Sprintf("keys-%d", i))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o666)
+		if err != nil {
+			for _, c := range closers {
+				c.Close()
+			}
+			return nil, err
+		}
+		closers = append(closers, f)
+		partitions[i].file = f
+		partitions[i].writer = bufio.NewWriter(f)
+		partitions[i].valueSize = valueSize
+	}
+
+	return &Builder{
+		Header: Header{
+			ValueSize:       uint64(valueSize),
+			NumPartitions:   uint32(numPartitions),
+			FingerprintSize: uint8(fingerprintSize),
+			Metadata:        &indexmeta.Meta{},
+		},
+		closers:    closers,
+		partitions: partitions,
+		tmpDir:     tmpDir,
+	}, nil
+}
+
+// SetKind sets the kind of the index.
+// If the kind is already set, it is overwritten.
+func (b *Builder) SetKind(kind []byte) error {
+	if len(kind) > indexmeta.MaxKeySize {
+		return fmt.Errorf("kind is too long")
+	}
+	if len(kind) == 0 {
+		return fmt.Errorf("kind is empty")
+	}
+	if b.Header.Metadata.Count(indexmeta.MetadataKey_Kind) > 0 {
+		b.Header.Metadata.Remove(indexmeta.MetadataKey_Kind)
+	}
+	b.Header.Metadata.Add(indexmeta.MetadataKey_Kind, kind)
+	return nil
+}
+
+func (b *Builder) Metadata() *indexmeta.Meta {
+	return b.Header.Metadata
+}
+
+// Insert writes a key-value mapping to the index.
+//
+// Index generation will fail if the same key is inserted twice.
+// A value shorter than the value size is padded with zeros.
+func (b *Builder) Insert(key []byte, value []byte) error {
+	if len(value) > int(b.Header.ValueSize) {
+		return fmt.Errorf("value size is %d, expected at most %d", len(value), b.Header.ValueSize)
+	}
+	return b.partitions[b.Header.PartitionOf(key)].writeTuple(key, value)
+}
+
+// Seal writes the final index to the provided file.
+// This process is CPU-intensive, use context to abort prematurely.
+//
+// Passing a non-empty file will result in a corrupted index.
+func (b *Builder) Seal(ctx context.Context, file *os.File) (err error) {
+	defer func() {
+		file.Sync()
+	}()
+	headerBuf := b.Header.Bytes()
+	wr := bufio.NewWriter(file)
+	if _, err := wr.Write(headerBuf); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	// The table of partition headers is written at the end, once the partitions are sealed.
+	tableOffset := int64(len(headerBuf))
+	offset := tableOffset + int64(len(b.partitions))*partitionHdrLen
+	if _, err := wr.Write(make([]byte, int64(len(b.partitions))*partitionHdrLen)); err != nil {
+		return fmt.Errorf("failed to write partition table: %w", err)
+	}
+	table := make([]byte, 0, len(b.partitions)*partitionHdrLen)
+	for i := range b.partitions {
+		hdr, data, err := b.sealPartition(ctx, i)
+		if err != nil {
+			return fmt.Errorf("failed to seal partition %d: %w", i, err)
+		}
+		hdr.FileOffset = uint64(offset)
+		if _, err := wr.Write(data); err != nil {
+			return fmt.Errorf("failed to write partition %d: %w", i, err)
+		}
+		offset += int64(len(data))
+		var hdrBuf [partitionHdrLen]byte
+		hdr.Store(&hdrBuf)
+		table = append(table, hdrBuf[:]...)
+	}
+	if err := wr.Flush(); err != nil {
+		return fmt.Errorf("failed to flush index: %w", err)
+	}
+	if _, err := file.WriteAt(table, tableOffset); err != nil {
+		return fmt.Errorf("failed to write partition table: %w", err)
+	}
+	return nil
+}
+
+// sealPartition finds the hash function of a partition, and returns its header (without the
+// offset) and its data.
+func (b *Builder) sealPartition(ctx context.Context, i int) (*PartitionHeader, []byte, error) {
+	partition := &b.partitions[i]
+	keys, values, err := partition.load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load keys: %w", err)
+	}
+	for seed := uint32(0); seed < seedAttempts; seed++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		hdr, table, ok := buildPartition(keys, seed)
+		if !ok {
+			continue
+		}
+		return hdr, b.marshalPartition(hdr, keys, values, table), nil
+	}
+	return nil, nil, ErrCollision
+}
+
+// partitionTable is the hash function of a partition.
+type partitionTable struct {
+	// positions is the slot of each key in [0, TableSize).
+	positions []uint32
+	pilots    []uint64
+	// taken are the slots of the keys.
+	taken []bool
+}
+
+// buildPartition searches the pilots of the buckets of the keys, and returns the header and the
+// table of the partition, or false if the seed doesn't work.
+func buildPartition(keys [][]byte, seed uint32) (*PartitionHeader, *partitionTable, bool) {
+	n := len(keys)
+	hdr := &PartitionHeader{
+		NumKeys: uint32(n),
+		Seed:    seed,
+	}
+	if n == 0 {
+		return hdr, &partitionTable{}, true
+	}
+	hdr.NumBuckets = uint32((n + keysPerBucket - 1) / keysPerBucket)
+	hdr.TableSize = max(uint32(float64(n)/loadFactor), uint32(n))
+
+	hashes := make([]uint64, n)
+	for i, key := range keys {
+		hashes[i] = keyHash(seed, key)
+	}
+	// two keys with the same hash can't be separated by any pilot.
+	sorted := append([]uint64(nil), hashes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return nil, nil, false
+		}
+	}
+	// keys of the same bucket, with the largest buckets first.
+	buckets := make([][]int, hdr.NumBuckets)
+	for i, hash := range hashes {
+		bucket := hdr.bucketOf(hash)
+		buckets[bucket] = append(buckets[bucket], i)
+	}
+	order := make([]uint32, len(buckets))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(buckets[order[i]]) > len(buckets[order[j]])
+	})
+
+	taken := make([]bool, hdr.TableSize)
+	pilots := make([]uint64, hdr.NumBuckets)
+	positions := make([]uint32, n)
+	bucketPositions := make([]uint32, 0, 16)
+	for _, bucket := range order {
+		keysOfBucket := buckets[bucket]
+		if len(keysOfBucket) == 0 {
+			break
+		}
+		found := false
+	pilots:
+		for pilot := uint64(0); pilot < maxPilot; pilot++ {
+			bucketPositions = bucketPositions[:0]
+			for _, key := range keysOfBucket {
+				pos := hdr.position(hashes[key], pilot)
+				if taken[pos] {
+					continue pilots
+				}
+				for _, other := range bucketPositions {
+					if other == pos {
+						// two keys of the bucket in the same slot (or the same hash).
+						continue pilots
+					}
+				}
+				bucketPositions = append(bucketPositions, pos)
+			}
+			for k, key := range keysOfBucket {
+				taken[bucketPositions[k]] = true
+				positions[key] = bucketPositions[k]
+			}
+			pilots[bucket] = pilot
+			found = true
+			break
+		}
+		if !found {
+			return nil, nil, false
+		}
+	}
+	var maxPilotFound uint64
+	for _, pilot := range pilots {
+		maxPilotFound = max(maxPilotFound, pilot)
+	}
+	hdr.PilotWidth = uint8(bits.Len64(maxPilotFound))
+	hdr.RemapWidth = uint8(bits.Len32(uint32(n - 1)))
+	return hdr, &partitionTable{positions: positions, pilots: pilots, taken: taken}, true
+}
+
+// marshalPartition returns the data of a partition: its pilots, its remap table, and its entries.
+func (b *Builder) marshalPartition(hdr *PartitionHeader, keys [][]byte, values [][]byte, table *partitionTable) []byte {
+	n := int(hdr.NumKeys)
+	if n == 0 {
+		return nil
+	}
+	pilotsLen := hdr.pilotsLen()
+	remapLen := hdr.remapLen()
+	stride := b.Header.entryStride()
+	data := make([]byte, pilotsLen+remapLen+int64(n*stride))
+	pilots := data[:pilotsLen]
+	for i, pilot := range table.pilots {
+		putBits(pilots, uint64(i)*uint64(hdr.PilotWidth), hdr.PilotWidth, pilot)
+	}
+	// the keys in the slots >= n are moved to the free slots of [0, n).
+	remap := data[pilotsLen : pilotsLen+remapLen]
+	free := 0
+	for slot := n; slot < int(hdr.TableSize); slot++ {
+		if !table.taken[slot] {
+			continue
+		}
+		for table.taken[free] {
+			free++
+		}
+		table.taken[free] = true
+		putBits(remap, uint64(slot-n)*uint64(hdr.RemapWidth), hdr.RemapWidth, uint64(free))
+	}
+	entries := data[pilotsLen+remapLen:]
+	var fp [8]byte
+	for i, key := range keys {
+		slot := table.positions[i]
+		if slot >= uint32(n) {
+			slot = uint32(getBits(remap, uint64(slot-uint32(n))*uint64(hdr.RemapWidth), hdr.RemapWidth))
+		}
+		entry := entries[int(slot)*stride : int(slot+1)*stride]
+		binary.LittleEndian.PutUint64(fp[:], fingerprint(keyHash(hdr.Seed, key)))
+		copy(entry, fp[:b.Header.FingerprintSize])
+		copy(entry[b.Header.FingerprintSize:], values[i])
+	}
+	return data
+}
+
+func (b *Builder) Close() error {
+	for _, c := range b.closers {
+		c.Close()
+	}
+	return os.RemoveAll(b.tmpDir)
+}
+
+// tempPartition is the temporary file of the key-value tuples of a partition.
+type tempPartition struct {
+	records   uint
+	valueSize uint
+	file      *os.File
+	writer    *bufio.Writer
+}
+
+// writeTuple performs a buffered write of a KV-tuple.
+func (p *tempPartition) writeTuple(key []byte, value []byte) (err error) {
+	p.records++
+	static := make([]byte, 2+p.valueSize)
+	binary.LittleEndian.PutUint16(static[0:2], uint16(len(key)))
+	copy(static[2:], value)
+	if _, err = p.writer.Write(static); err != nil {
+		return err
+	}
+	_, err = p.writer.Write(key)
+	return
+}
+
+// load flushes the partition, and reads its keys and values.
+func (p *tempPartition) load() (keys [][]byte, values [][]byte, err error) {
+	if err := p.writer.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("failed to flush writer: %w", err)
+	}
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	rd := bufio.NewReader(p.file)
+	keys = make([][]byte, p.records)
+	values = make([][]byte, p.records)
+	static := make([]byte, 2+p.valueSize)
+	for i := range keys {
+		if _, err := io.ReadFull(rd, static); err != nil {
+			return nil, nil, err
+		}
+		values[i] = append([]byte(nil), static[2:]...)
+		keys[i] = make([]byte, binary.LittleEndian.Uint16(static[0:2]))
+		if _, err := io.ReadFull(rd, keys[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return keys, values, nil
+}
@@ -0,0 +1,260 @@
+// Package mphindex is an immutable key-value index format based on a minimal perfect hash
+// function (PTHash), an alternative to compactindexsized for very large sets of keys.
+//
+// # Design
+//
+// Like compactindexsized, the index maps keys to fixed-size values and doesn't store the keys.
+// But instead of a table of 3-byte hashes that is searched for the key, a minimal perfect
+// hash function maps each of the n keys of the index to a distinct slot in [0, n), where the
+// value is stored: the hash function costs ~3 bits per key, and a lookup reads a constant
+// number of small ranges of the file, without a search.
+//
+// As the keys are not stored, the lookup of a key that is not in the index would return the
+// value of another key; each slot therefore also has a fingerprint of its key (FingerprintSize
+// bytes, possibly 0), which rejects most of the absent keys: the probability of a false
+// positive is 2^-(8*FingerprintSize).
+//
+// # Partitions
+//
+// The keys are split into partitions of ~100k keys (by xxHash64 of the key), each with its own
+// hash function, so that the index is built with a bounded amount of memory.
+//
+// # Hash function
+//
+// In a partition of n keys, each key is hashed (xxHash64 with the seed of the partition) and
+// assigned to one of ~n/4 buckets; the buckets are sorted by size, and for each of them, a
+// pilot is searched so that the positions hash(key, pilot) of its keys land in free slots of a
+// table of m = n/0.98 slots. The pilots are stored with the minimal bit width of the partition.
+// The m-n positions outside of [0, n) are remapped to the free slots of [0, n).
+//
+// # File format
+//
+//	header:     magic (8 bytes), header size (uint32), value size (uint64),
+//	            number of partitions (uint32), fingerprint size (uint8), version (uint8), metadata
+//	partitions: a table of partition headers (32 bytes each)
+//	then, for each partition: the pilots, the remap table, and the n entries
+//	            (fingerprint + value)
+package mphindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// Magic are the first 8 bytes of an index.
+var Magic = [8]byte{'c', 'o', 'm', 'p', 'i', 'm', 'p', 'h'}
+
+const Version = uint8(1)
+
+// ErrNotFound is the error of the lookup of a key that is not in the index; it's the error of
+// compactindexsized, so that callers handle both formats the same.
+var ErrNotFound = compactindexsized.ErrNotFound
+
+// MaxFingerprintSize is the largest fingerprint size, in bytes.
+const MaxFingerprintSize = 8
+
+// Header is the header of an index.
+type Header struct {
+	ValueSize       uint64
+	NumPartitions   uint32
+	FingerprintSize uint8
+	Metadata        *indexmeta.Meta
+}
+
+// Load parses the header from buf, which starts with the magic.
+func (h *Header) Load(buf []byte) error {
+	if len(buf) < 12 || *(*[8]byte)(buf[:8]) != Magic {
+		return fmt.Errorf("not a mph index file")
+	}
+	lenWithoutMagicAndLen := binary.LittleEndian.Uint32(buf[8:12])
+	if lenWithoutMagicAndLen < 14 || uint64(lenWithoutMagicAndLen)+12 > uint64(len(buf)) {
+		return fmt.Errorf("invalid header length")
+	}
+	*h = Header{
+		ValueSize:       binary.LittleEndian.Uint64(buf[12:20]),
+		NumPartitions:   binary.LittleEndian.Uint32(buf[20:24]),
+		FingerprintSize: buf[24],
+		Metadata:        new(indexmeta.Meta),
+	}
+	if buf[25] != Version {
+		return fmt.Errorf("unsupported index version: want %d, got %d", Version, buf[25])
+	}
+	if err := h.Metadata.UnmarshalBinary(buf[26 : 12+lenWithoutMagicAndLen]); err != nil {
+		return fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+	if h.ValueSize == 0 {
+		return fmt.Errorf("value size not set")
+	}
+	if h.NumPartitions == 0 {
+		return fmt.Errorf("number of partitions not set")
+	}
+	if h.FingerprintSize > MaxFingerprintSize {
+		return fmt.Errorf("invalid fingerprint size %d", h.FingerprintSize)
+	}
+	return nil
+}
+
+// Bytes returns the header, as written at the start of the index.
+func (h *Header) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	binary.Write(buf, binary.LittleEndian, h.ValueSize)
+	binary.Write(buf, binary.LittleEndian, h.NumPartitions)
+	buf.WriteByte(h.FingerprintSize)
+	buf.WriteByte(Version)
+	if h.Metadata == nil {
+		h.Metadata = new(indexmeta.Meta)
+	}
+	buf.Write(h.Metadata.Bytes())
+
+	finalBuf := new(bytes.Buffer)
+	finalBuf.Write(Magic[:])
+	binary.Write(finalBuf, binary.LittleEndian, uint32(buf.Len()))
+	finalBuf.Write(buf.Bytes())
+	return finalBuf.Bytes()
+}
+
+// PartitionOf returns the partition of the key.
+func (h *Header) PartitionOf(key []byte) uint32 {
+	return uint32(fastRange(xxhash.Sum64(key), uint64(h.NumPartitions)))
+}
+
+func (h *Header) entryStride() int {
+	return int(h.FingerprintSize) + int(h.ValueSize)
+}
+
+// PartitionHeader describes a partition of the index.
+type PartitionHeader struct {
+	// FileOffset is the offset of the pilots of the partition.
+	FileOffset uint64
+	NumKeys    uint32
+	NumBuckets uint32
+	// TableSize is the number of slots the keys are hashed to (>= NumKeys).
+	TableSize  uint32
+	Seed       uint32
+	PilotWidth uint8
+	RemapWidth uint8
+}
+
+const partitionHdrLen = 32
+
+func (p *PartitionHeader) Store(buf *[partitionHdrLen]byte) {
+	*buf = [partitionHdrLen]byte{}
+	binary.LittleEndian.PutUint64(buf[0:8], p.FileOffset)
+	binary.LittleEndian.PutUint32(buf[8:12], p.NumKeys)
+	binary.LittleEndian.PutUint32(buf[12:16], p.NumBuckets)
+	binary.LittleEndian.PutUint32(buf[16:20], p.TableSize)
+	binary.LittleEndian.PutUint32(buf[20:24], p.Seed)
+	buf[24] = p.PilotWidth
+	buf[25] = p.RemapWidth
+}
+
+func (p *PartitionHeader) Load(buf *[partitionHdrLen]byte) {
+	p.FileOffset = binary.LittleEndian.Uint64(buf[0:8])
+	p.NumKeys = binary.LittleEndian.Uint32(buf[8:12])
+	p.NumBuckets = binary.LittleEndian.Uint32(buf[12:16])
+	p.TableSize = binary.LittleEndian.Uint32(buf[16:20])
+	p.Seed = binary.LittleEndian.Uint32(buf[20:24])
+	p.PilotWidth = buf[24]
+	p.RemapWidth = buf[25]
+}
+
+func (p *PartitionHeader) pilotsLen() int64 {
+	return bitsToBytes(uint64(p.NumBuckets) * uint64(p.PilotWidth))
+}
+
+func (p *PartitionHeader) remapLen() int64 {
+	return bitsToBytes(uint64(p.TableSize-p.NumKeys) * uint64(p.RemapWidth))
+}
+
+func (p *PartitionHeader) entriesOffset() int64 {
+	return int64(p.FileOffset) + p.pilotsLen() + p.remapLen()
+}
+
+// bucketOf returns the bucket of a key hash: as in PTHash, 60% of the keys go to 30% of the
+// buckets, so that the search of the pilots of the (large) first buckets is easy while the table
+// is still empty.
+func (p *PartitionHeader) bucketOf(hash uint64) uint32 {
+	dense := uint64(p.NumBuckets) * 3 / 10
+	if dense == 0 || dense == uint64(p.NumBuckets) {
+		return uint32(fastRange(hash, uint64(p.NumBuckets)))
+	}
+	mixed := hashUint64(hash)
+	if mixed < denseThreshold {
+		return uint32(fastRange(hash, dense))
+	}
+	return uint32(dense + fastRange(hash, uint64(p.NumBuckets)-dense))
+}
+
+// denseThreshold is 60% of the 64-bit range.
+const denseThreshold = ^uint64(0) / 10 * 6
+
+// position returns the slot of a key hash in the table, for a pilot.
+func (p *PartitionHeader) position(hash uint64, pilot uint64) uint32 {
+	return uint32(fastRange(hashUint64(hash^hashUint64(pilot+1)), uint64(p.TableSize)))
+}
+
+// keyHash is the hash of a key in its partition.
+func keyHash(seed uint32, key []byte) uint64 {
+	return compactindexsized.EntryHash64(seed, key)
+}
+
+// fingerprint returns the fingerprint of a key hash, little-endian.
+func fingerprint(hash uint64) uint64 {
+	return hashUint64(hash + 0x9e3779b97f4a7c15)
+}
+
+// fastRange maps x to [0, n) without a division (Lemire).
+func fastRange(x uint64, n uint64) uint64 {
+	hi, _ := bits.Mul64(x, n)
+	return hi
+}
+
+func hashUint64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func bitsToBytes(n uint64) int64 {
+	return int64((n + 7) / 8)
+}
+
+// getBits returns the width-bit integer at bit offset off of a little-endian bit array that
+// starts at the first byte of buf.
+func getBits(buf []byte, off uint64, width uint8) uint64 {
+	var full [16]byte
+	copy(full[:], buf[off/8:])
+	lo := binary.LittleEndian.Uint64(full[0:8])
+	hi := binary.LittleEndian.Uint64(full[8:16])
+	shift := off % 8
+	v := lo >> shift
+	if shift > 0 {
+		v |= hi << (64 - shift)
+	}
+	if width < 64 {
+		v &= (1 << width) - 1
+	}
+	return v
+}
+
+// putBits sets the width-bit integer at bit offset off of a little-endian bit array.
+func putBits(buf []byte, off uint64, width uint8, v uint64) {
+	for i := uint8(0); i < width; i++ {
+		if v&(1<<i) != 0 {
+			bit := off + uint64(i)
+			buf[bit/8] |= 1 << (bit % 8)
+		}
+	}
+}
+
+var errCorrupted = errors.New("corrupted mph index")
@@ -0,0 +1,149 @@
+package mphindex
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestIndex(t *testing.T, keys [][]byte, valueOf func(int) []byte, valueSize uint, fingerprintSize uint) *DB {
+	t.Helper()
+	builder, err := NewBuilder(t.TempDir(), uint(len(keys)), valueSize, fingerprintSize)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.NoError(t, builder.SetKind([]byte("test")))
+	for i, key := range keys {
+		require.NoError(t, builder.Insert(key, valueOf(i)))
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.index"))
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	require.NoError(t, builder.Seal(context.Background(), file))
+
+	db, err := Open(file)
+	require.NoError(t, err)
+	return db
+}
+
+func TestBuildAndLookup(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 250_000)
+	for i := range keys {
+		keys[i] = make([]byte, 64)
+		rng.Read(keys[i])
+	}
+	valueOf := func(i int) []byte {
+		value := make([]byte, 36)
+		binary.LittleEndian.PutUint64(value, uint64(i))
+		return value
+	}
+	db := buildTestIndex(t, keys, valueOf, 36, 2)
+	require.Equal(t, uint32(3), db.Header.NumPartitions)
+	require.True(t, db.KindIs([]byte("test")))
+	kind, ok := db.GetKind()
+	require.True(t, ok)
+	require.Equal(t, []byte("test"), kind)
+
+	for i, key := range keys {
+		value, err := db.Lookup(key)
+		require.NoError(t, err)
+		require.Equal(t, valueOf(i), value)
+	}
+
+	// the unknown keys are (almost all) rejected by the fingerprint.
+	db.Prefetch(true)
+	falsePositives := 0
+	for i := 0; i < 10_000; i++ {
+		key := make([]byte, 64)
+		rng.Read(key)
+		_, err := db.Lookup(key)
+		if err == nil {
+			falsePositives++
+			continue
+		}
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+	require.Less(t, falsePositives, 5)
+	stats := db.Stats()
+	require.Equal(t, uint64(260_000), stats.Lookups)
+	require.Equal(t, uint64(10_000-falsePositives), stats.NotFound)
+	require.Zero(t, stats.Failures)
+
+	// the hash functions cost less than 4 bits per key.
+	var functionBits int64
+	for i := uint32(0); i < db.Header.NumPartitions; i++ {
+		partition, err := db.GetPartition(i)
+		require.NoError(t, err)
+		functionBits += 8 * (partition.pilotsLen() + partition.remapLen())
+	}
+	require.Less(t, float64(functionBits)/float64(len(keys)), 4.0)
+}
+
+func TestSmallIndexes(t *testing.T) {
+	for _, numKeys := range []int{1, 2, 3, 7, 100} {
+		keys := make([][]byte, numKeys)
+		for i := range keys {
+			keys[i] = []byte{byte(i), 'k'}
+		}
+		valueOf := func(i int) []byte { return []byte{byte(i)} }
+		db := buildTestIndex(t, keys, valueOf, 1, 0)
+		for i, key := range keys {
+			value, err := db.Lookup(key)
+			require.NoError(t, err)
+			require.Equal(t, valueOf(i), value)
+		}
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	builder, err := NewBuilder(t.TempDir(), 2, 1, 1)
+	require.NoError(t, err)
+	defer builder.Close()
+	require.NoError(t, builder.Insert([]byte("a"), []byte{1}))
+	require.NoError(t, builder.Insert([]byte("a"), []byte{2}))
+	require.Error(t, builder.Insert([]byte("b"), []byte{1, 2}))
+	file, err := os.Create(filepath.Join(t.TempDir(), "test.index"))
+	require.NoError(t, err)
+	defer file.Close()
+	require.True(t, errors.Is(builder.Seal(context.Background(), file), ErrCollision))
+}
+
+func TestHeader(t *testing.T) {
+	header := Header{
+		ValueSize:       36,
+		NumPartitions:   42,
+		FingerprintSize: 3,
+		Metadata:        &indexmeta.Meta{},
+	}
+	require.NoError(t, header.Metadata.Add(indexmeta.MetadataKey_Kind, []byte("sig-to-cid")))
+	var loaded Header
+	require.NoError(t, loaded.Load(header.Bytes()))
+	require.Equal(t, header.ValueSize, loaded.ValueSize)
+	require.Equal(t, header.NumPartitions, loaded.NumPartitions)
+	require.Equal(t, header.FingerprintSize, loaded.FingerprintSize)
+	kind, ok := loaded.Metadata.Get(indexmeta.MetadataKey_Kind)
+	require.True(t, ok)
+	require.Equal(t, []byte("sig-to-cid"), kind)
+
+	buf := header.Bytes()
+	buf[0] = 'x'
+	require.Error(t, loaded.Load(buf))
+}
+
+func TestBits(t *testing.T) {
+	buf := make([]byte, 16)
+	values := []uint64{5, 0, 31, 17, 1}
+	for i, v := range values {
+		putBits(buf, uint64(i)*5+3, 5, v)
+	}
+	for i, v := range values {
+		require.Equal(t, v, getBits(buf, uint64(i)*5+3, 5))
+	}
+}
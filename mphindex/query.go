@@ -0,0 +1,181 @@
+package mphindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/rpcpool/yellowstone-faithful/indexmeta"
+)
+
+// DB is a mph index handle.
+type DB struct {
+	Header     *Header
+	headerSize int64
+	Stream     io.ReaderAt
+	prefetch   bool
+	stats      stats
+	// partitions is the table of partition headers, once loaded by a prefetching lookup.
+	partitions atomic.Pointer[[]byte]
+}
+
+var ErrInvalidMagic = errors.New("invalid magic")
+
+// IsMagic returns whether the first bytes of a file are those of a mph index.
+func IsMagic(magic [8]byte) bool {
+	return magic == Magic
+}
+
+// Open returns a handle to access a mph index.
+//
+// The provided stream must start with the Magic byte sequence.
+func Open(stream io.ReaderAt) (*DB, error) {
+	var magicAndSize [8 + 4]byte
+	n, readErr := stream.ReadAt(magicAndSize[:], 0)
+	if n < len(magicAndSize) {
+		// ReadAt must return non-nil error here.
+		return nil, readErr
+	}
+	if !bytes.Equal(magicAndSize[:8], Magic[:]) {
+		return nil, ErrInvalidMagic
+	}
+	size := binary.LittleEndian.Uint32(magicAndSize[8:])
+	fileHeaderBuf := make([]byte, 8+4+size)
+	n, readErr = stream.ReadAt(fileHeaderBuf, 0)
+	if n < len(fileHeaderBuf) {
+		return nil, readErr
+	}
+	db := &DB{
+		Header:     new(Header),
+		headerSize: int64(8 + 4 + size),
+		Stream:     stream,
+	}
+	if err := db.Header.Load(fileHeaderBuf); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Prefetch makes the lookups keep the table of partition headers in memory (32 bytes per
+// 100k keys) after its first read, so that a lookup only reads the partition.
+func (db *DB) Prefetch(yes bool) {
+	db.prefetch = yes
+}
+
+// HotRegionSize returns the size of the region at the start of the index (the header and
+// the table of partition headers) that is read by every lookup.
+func (db *DB) HotRegionSize() int64 {
+	return db.headerSize + int64(db.Header.NumPartitions)*partitionHdrLen
+}
+
+// GetKind returns the kind of the index.
+func (db *DB) GetKind() ([]byte, bool) {
+	return db.Header.Metadata.Get(indexmeta.MetadataKey_Kind)
+}
+
+// KindIs returns whether the index is of the given kind.
+func (db *DB) KindIs(kind []byte) bool {
+	got, ok := db.Header.Metadata.Get(indexmeta.MetadataKey_Kind)
+	return ok && bytes.Equal(got, kind)
+}
+
+func (db *DB) GetValueSize() uint64 {
+	return db.Header.ValueSize
+}
+
+// Lookup queries for a key in the index and returns the value, if any.
+//
+// Returns ErrNotFound if the key is unknown; with a fingerprint of FingerprintSize bytes, the
+// value of another key is returned for a fraction 2^-(8*FingerprintSize) of the unknown keys.
+func (db *DB) Lookup(key []byte) (value []byte, err error) {
+	defer func() {
+		db.stats.lookupDone(err)
+	}()
+	partition, err := db.GetPartition(db.Header.PartitionOf(key))
+	if err != nil {
+		return nil, err
+	}
+	return db.lookupInPartition(partition, key)
+}
+
+// GetPartition returns the header of the i-th partition.
+func (db *DB) GetPartition(i uint32) (*PartitionHeader, error) {
+	if i >= db.Header.NumPartitions {
+		return nil, fmt.Errorf("partition %d out of range", i)
+	}
+	var buf [partitionHdrLen]byte
+	if table := db.partitions.Load(); table != nil {
+		copy(buf[:], (*table)[int(i)*partitionHdrLen:])
+	} else if db.prefetch {
+		table := make([]byte, int(db.Header.NumPartitions)*partitionHdrLen)
+		if _, err := db.Stream.ReadAt(table, db.headerSize); err != nil {
+			return nil, fmt.Errorf("failed to read partition table: %w", err)
+		}
+		db.stats.partitionRead(len(table))
+		db.partitions.Store(&table)
+		copy(buf[:], table[int(i)*partitionHdrLen:])
+	} else {
+		if _, err := db.Stream.ReadAt(buf[:], db.headerSize+int64(i)*partitionHdrLen); err != nil {
+			return nil, fmt.Errorf("failed to read partition %d: %w", i, err)
+		}
+		db.stats.partitionRead(len(buf))
+	}
+	partition := new(PartitionHeader)
+	partition.Load(&buf)
+	return partition, nil
+}
+
+func (db *DB) lookupInPartition(p *PartitionHeader, key []byte) ([]byte, error) {
+	if p.NumKeys == 0 {
+		return nil, ErrNotFound
+	}
+	if p.TableSize < p.NumKeys || p.PilotWidth > 32 || p.RemapWidth > 32 {
+		return nil, errCorrupted
+	}
+	hash := keyHash(p.Seed, key)
+	pilot, err := db.readBits(int64(p.FileOffset), uint64(p.bucketOf(hash))*uint64(p.PilotWidth), p.PilotWidth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pilot: %w", err)
+	}
+	slot := p.position(hash, pilot)
+	if slot >= p.NumKeys {
+		remapped, err := db.readBits(int64(p.FileOffset)+p.pilotsLen(), uint64(slot-p.NumKeys)*uint64(p.RemapWidth), p.RemapWidth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remap table: %w", err)
+		}
+		if remapped >= uint64(p.NumKeys) {
+			return nil, errCorrupted
+		}
+		slot = uint32(remapped)
+	}
+	stride := db.Header.entryStride()
+	entry := make([]byte, stride)
+	if _, err := db.Stream.ReadAt(entry, p.entriesOffset()+int64(slot)*int64(stride)); err != nil {
+		return nil, fmt.Errorf("failed to read entry: %w", err)
+	}
+	db.stats.entryRead(stride)
+	var fp [8]byte
+	binary.LittleEndian.PutUint64(fp[:], fingerprint(hash))
+	if !bytes.Equal(entry[:db.Header.FingerprintSize], fp[:db.Header.FingerprintSize]) {
+		return nil, ErrNotFound
+	}
+	return entry[db.Header.FingerprintSize:], nil
+}
+
+// readBits reads the width-bit integer at bit offset off of the bit array at offset base.
+func (db *DB) readBits(base int64, off uint64, width uint8) (uint64, error) {
+	if width == 0 {
+		return 0, nil
+	}
+	first := off / 8
+	last := (off + uint64(width) - 1) / 8
+	buf := make([]byte, last-first+1)
+	if _, err := db.Stream.ReadAt(buf, base+int64(first)); err != nil {
+		return 0, err
+	}
+	db.stats.bytesRead.Add(uint64(len(buf)))
+	return getBits(buf, off%8, width), nil
+}
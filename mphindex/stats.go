@@ -0,0 +1,62 @@
+package mphindex
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Stats are the counters of the lookups done on a DB since it was opened; the fields are those
+// of compactindexsized.Stats, a partition being the equivalent of a bucket.
+type Stats struct {
+	Lookups  uint64 // calls to Lookup
+	NotFound uint64 // lookups of keys that are not in the index
+	Failures uint64 // lookups that failed with an error other than ErrNotFound
+	// BucketProbes is the number of partition headers read.
+	BucketProbes uint64
+	// EntryProbes is the number of entries read (one per lookup of a non-empty partition).
+	EntryProbes uint64
+	// BytesRead is the number of bytes read from the index (partition headers, pilots and entries).
+	BytesRead uint64
+}
+
+type stats struct {
+	lookups         atomic.Uint64
+	notFound        atomic.Uint64
+	failures        atomic.Uint64
+	partitionProbes atomic.Uint64
+	entryProbes     atomic.Uint64
+	bytesRead       atomic.Uint64
+}
+
+// Stats returns the lookup counters of the DB.
+func (db *DB) Stats() Stats {
+	return Stats{
+		Lookups:      db.stats.lookups.Load(),
+		NotFound:     db.stats.notFound.Load(),
+		Failures:     db.stats.failures.Load(),
+		BucketProbes: db.stats.partitionProbes.Load(),
+		EntryProbes:  db.stats.entryProbes.Load(),
+		BytesRead:    db.stats.bytesRead.Load(),
+	}
+}
+
+func (s *stats) lookupDone(err error) {
+	s.lookups.Add(1)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		s.notFound.Add(1)
+	default:
+		s.failures.Add(1)
+	}
+}
+
+func (s *stats) partitionRead(size int) {
+	s.partitionProbes.Add(1)
+	s.bytesRead.Add(uint64(size))
+}
+
+func (s *stats) entryRead(size int) {
+	s.entryProbes.Add(1)
+	s.bytesRead.Add(uint64(size))
+}
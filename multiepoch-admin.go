@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"github.com/valyala/fasthttp"
+	"k8s.io/klog/v2"
+)
+
+// AdminConfig is the configuration of the admin API.
+type AdminConfig struct {
+	Cache *hugecache.Cache
+	// ArtifactCache (optional) is the garbage collection of the managed cache directory.
+	ArtifactCache *artifactCache
+	// LoadEpoch (optional) loads an epoch from its config, for POST /epochs/attach.
+	LoadEpoch func(config *Config) (*Epoch, error)
+}
+
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// ListenAndServeAdmin starts the admin API on the given address.
+// The admin API is meant to be reachable only by operators, and MUST NOT be exposed publicly.
+func (m *MultiEpoch) ListenAndServeAdmin(ctx context.Context, listenOn string, conf *AdminConfig) error {
+	handler := newAdminHandler(ctx, m, conf)
+
+	klog.Infof("Admin API listening on %s", listenOn)
+
+	s := &fasthttp.Server{
+		Handler:            handler,
+		MaxRequestBodySize: 1024 * 1024,
+	}
+	go func() {
+		<-ctx.Done()
+		klog.Info("Admin API shutting down...")
+		if err := s.ShutdownWithContext(ctx); err != nil {
+			klog.Errorf("Error while shutting down admin API: %s", err)
+		}
+	}()
+	return s.ListenAndServe(listenOn)
+}
+
+func newAdminHandler(ctx context.Context, m *MultiEpoch, conf *AdminConfig) func(ctx *fasthttp.RequestCtx) {
+	return func(reqCtx *fasthttp.RequestCtx) {
+		startedAt := time.Now()
+		path := string(reqCtx.Path())
+		defer func() {
+			klog.V(2).Infof("admin: %s %s -> %d (took %s)", reqCtx.Method(), path, reqCtx.Response.StatusCode(), time.Since(startedAt))
+		}()
+		switch path {
+		case "/indexes":
+			m.handleAdminIndexes(reqCtx)
+			return
+		case "/indexes/mode":
+			m.handleAdminIndexMode(ctx, reqCtx)
+			return
+		case "/epochs/attach":
+			m.handleAdminAttach(ctx, reqCtx, conf)
+			return
+		case "/discrepancies":
+			if !reqCtx.IsGet() {
+				replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+				return
+			}
+			replyJSON(reqCtx, http.StatusOK, map[string]any{
+				"discrepancies": nodeDiscrepancies.Recent(),
+			})
+			return
+		case "/progress":
+			if !reqCtx.IsGet() {
+				replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+				return
+			}
+			replyJSON(reqCtx, http.StatusOK, map[string]any{
+				"tasks": progress.Default.Snapshots(),
+			})
+			return
+		case "/artifact-cache", "/artifact-cache/gc", "/artifact-cache/pin":
+			if conf == nil || conf.ArtifactCache == nil {
+				replyJSON(reqCtx, http.StatusServiceUnavailable, adminError{Error: "artifact cache not configured"})
+				return
+			}
+			handleAdminArtifactCache(reqCtx, path, conf.ArtifactCache)
+			return
+		}
+		if conf == nil || conf.Cache == nil {
+			replyJSON(reqCtx, http.StatusServiceUnavailable, adminError{Error: "cache not configured"})
+			return
+		}
+		switch path {
+		case "/cache/stats":
+			if !reqCtx.IsGet() {
+				replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+				return
+			}
+			replyJSON(reqCtx, http.StatusOK, conf.Cache.Stats())
+		case "/cache/pins":
+			if !reqCtx.IsGet() {
+				replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+				return
+			}
+			replyJSON(reqCtx, http.StatusOK, map[string]any{
+				"slots": conf.Cache.PinnedSlots(),
+			})
+		case "/cache/pin":
+			m.handleAdminPin(reqCtx, conf.Cache)
+		case "/cache/invalidate":
+			m.handleAdminInvalidate(reqCtx, conf.Cache)
+		case "/preheat":
+			m.handleAdminPreheat(reqCtx)
+		default:
+			replyJSON(reqCtx, http.StatusNotFound, adminError{Error: "not found"})
+		}
+	}
+}
+
+// handleAdminPin pins (POST) or unpins (DELETE) the block at the `slot` query param.
+func (m *MultiEpoch) handleAdminPin(reqCtx *fasthttp.RequestCtx, cache *hugecache.Cache) {
+	slot, err := reqCtx.QueryArgs().GetUint("slot")
+	if err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing or invalid slot"})
+		return
+	}
+	switch {
+	case reqCtx.IsPost():
+		epochNumber := CalcEpochForSlot(uint64(slot))
+		epochHandler, err := m.GetEpoch(epochNumber)
+		if err != nil {
+			replyJSON(reqCtx, http.StatusNotFound, adminError{Error: fmt.Sprintf("epoch %d is not available", epochNumber)})
+			return
+		}
+		blockCid, objects, err := epochHandler.CollectBlockObjects(reqCtx, uint64(slot))
+		if err != nil {
+			replyJSON(reqCtx, http.StatusInternalServerError, adminError{Error: err.Error()})
+			return
+		}
+		cache.PinSlot(uint64(slot), blockCid, objects)
+		metrics_cachePinOperations.WithLabelValues("pin").Inc()
+		replyJSON(reqCtx, http.StatusOK, map[string]any{
+			"slot":    slot,
+			"cid":     blockCid.String(),
+			"objects": len(objects),
+		})
+	case reqCtx.IsDelete():
+		unpinned := cache.UnpinSlot(uint64(slot))
+		metrics_cachePinOperations.WithLabelValues("unpin").Inc()
+		replyJSON(reqCtx, http.StatusOK, map[string]any{
+			"slot":     slot,
+			"unpinned": unpinned,
+		})
+	default:
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+	}
+}
+
+// handleAdminInvalidate removes entries from the cache; exactly one of the
+// `slot`, `cid`, `epoch`, or `all=true` query params must be provided.
+// Invalidating an epoch is what you want after replacing a corrupted CAR file or index.
+func (m *MultiEpoch) handleAdminInvalidate(reqCtx *fasthttp.RequestCtx, cache *hugecache.Cache) {
+	if !reqCtx.IsPost() {
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+	args := reqCtx.QueryArgs()
+	var kind string
+	var deleted int
+	switch {
+	case args.Has("slot"):
+		slot, err := args.GetUint("slot")
+		if err != nil {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "invalid slot"})
+			return
+		}
+		kind = "slot"
+		deleted = cache.InvalidateSlot(uint64(slot))
+	case args.Has("cid"):
+		parsed, err := cid.Parse(string(args.Peek("cid")))
+		if err != nil {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: fmt.Sprintf("invalid cid: %s", err)})
+			return
+		}
+		kind = "cid"
+		deleted = cache.InvalidateCid(parsed)
+	case args.Has("epoch"):
+		epochNumber, err := strconv.ParseUint(string(args.Peek("epoch")), 10, 64)
+		if err != nil {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "invalid epoch"})
+			return
+		}
+		kind = "epoch"
+		start, stop := CalcEpochLimits(epochNumber)
+		deleted = cache.InvalidateSlotRange(start, stop)
+	case string(args.Peek("all")) == "true":
+		kind = "all"
+		if err := cache.Reset(); err != nil {
+			replyJSON(reqCtx, http.StatusInternalServerError, adminError{Error: err.Error()})
+			return
+		}
+	default:
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "one of slot, cid, epoch, or all=true is required"})
+		return
+	}
+	metrics_cacheInvalidations.WithLabelValues(kind).Inc()
+	metrics_cacheInvalidatedEntries.WithLabelValues(kind).Add(float64(deleted))
+	klog.Infof("admin: invalidated cache (%s): %d entries removed", kind, deleted)
+	replyJSON(reqCtx, http.StatusOK, map[string]any{
+		"kind":    kind,
+		"deleted": deleted,
+	})
+}
+
+// handleAdminPreheat reads the CAR byte ranges for the `from`-`to` slot range, to warm the OS page cache.
+func (m *MultiEpoch) handleAdminPreheat(reqCtx *fasthttp.RequestCtx) {
+	if !reqCtx.IsPost() {
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+	from, err := reqCtx.QueryArgs().GetUint("from")
+	if err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing or invalid from"})
+		return
+	}
+	to, err := reqCtx.QueryArgs().GetUint("to")
+	if err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing or invalid to"})
+		return
+	}
+	results, err := m.Preheat(reqCtx, uint64(from), uint64(to))
+	if err != nil {
+		replyJSON(reqCtx, http.StatusInternalServerError, adminError{Error: err.Error()})
+		return
+	}
+	replyJSON(reqCtx, http.StatusOK, results)
+}
+
+// handleAdminAttach loads the epoch of the `config` query param (the path of its config file),
+// and adds it to the served epochs once prepared: with `warm=true`, the hot region of its index
+// files is read first, and with `sample=<K>`, K random entries of each of its indexes are
+// verified against its CAR (see AttachOptions). The attach happens in the background: its
+// progress is visible with GET /progress.
+func (m *MultiEpoch) handleAdminAttach(ctx context.Context, reqCtx *fasthttp.RequestCtx, conf *AdminConfig) {
+	if !reqCtx.IsPost() {
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+	if conf == nil || conf.LoadEpoch == nil {
+		replyJSON(reqCtx, http.StatusServiceUnavailable, adminError{Error: "epoch loading not configured"})
+		return
+	}
+	args := reqCtx.QueryArgs()
+	configPath := string(args.Peek("config"))
+	if configPath == "" {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing config"})
+		return
+	}
+	opts := AttachOptions{Warm: args.GetBool("warm")}
+	if args.Has("sample") {
+		numSamples, err := args.GetUint("sample")
+		if err != nil {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "invalid sample"})
+			return
+		}
+		opts.NumSamples = numSamples
+	}
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: err.Error()})
+		return
+	}
+	if err := config.Validate(); err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: err.Error()})
+		return
+	}
+	if _, err := m.GetEpoch(*config.Epoch); err == nil {
+		replyJSON(reqCtx, http.StatusConflict, adminError{Error: fmt.Sprintf("epoch %d is already served", *config.Epoch)})
+		return
+	}
+	go func() {
+		task := progress.Start(fmt.Sprintf("attach epoch %d", *config.Epoch))
+		epoch, err := conf.LoadEpoch(config)
+		if err == nil {
+			_, err = m.AttachEpoch(ctx, epoch, opts)
+		}
+		task.Done(err)
+		if err != nil {
+			klog.Errorf("admin: failed to attach the epoch of %q: %s", configPath, err)
+		}
+	}()
+	replyJSON(reqCtx, http.StatusAccepted, map[string]any{
+		"epoch":  *config.Epoch,
+		"config": configPath,
+		"warm":   opts.Warm,
+		"sample": opts.NumSamples,
+	})
+}
+
+// handleAdminIndexes lists the index files of the epochs (or of the `epoch` query param), and how they are accessed.
+func (m *MultiEpoch) handleAdminIndexes(reqCtx *fasthttp.RequestCtx) {
+	if !reqCtx.IsGet() {
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+	epochNumbers := m.GetEpochNumbers()
+	if reqCtx.QueryArgs().Has("epoch") {
+		epochNumber, err := strconv.ParseUint(string(reqCtx.QueryArgs().Peek("epoch")), 10, 64)
+		if err != nil {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "invalid epoch"})
+			return
+		}
+		epochNumbers = []uint64{epochNumber}
+	}
+	out := make(map[string][]IndexMountStatus, len(epochNumbers))
+	for _, epochNumber := range epochNumbers {
+		epochHandler, err := m.getLoadedEpoch(epochNumber)
+		if err != nil {
+			replyJSON(reqCtx, http.StatusNotFound, adminError{Error: fmt.Sprintf("epoch %d is not available", epochNumber)})
+			return
+		}
+		out[strconv.FormatUint(epochNumber, 10)] = epochHandler.IndexMounts()
+	}
+	replyJSON(reqCtx, http.StatusOK, out)
+}
+
+// handleAdminIndexMode changes how the remote index files of the `epoch` query param are accessed
+// (to the `mode` query param); the optional `index` query param restricts the change to one index.
+// The switch happens in the background (downloading an index can take a while): the indexes are
+// served in the previous mode until done, and the progress is visible with GET /indexes.
+func (m *MultiEpoch) handleAdminIndexMode(ctx context.Context, reqCtx *fasthttp.RequestCtx) {
+	if !reqCtx.IsPost() {
+		replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+	args := reqCtx.QueryArgs()
+	epochNumber, err := strconv.ParseUint(string(args.Peek("epoch")), 10, 64)
+	if err != nil {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing or invalid epoch"})
+		return
+	}
+	mode := IndexMode(args.Peek("mode"))
+	if !mode.IsValid() {
+		replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: fmt.Sprintf("invalid mode %q (supported: remote, download, mmap, pinned)", mode)})
+		return
+	}
+	epochHandler, err := m.getLoadedEpoch(epochNumber)
+	if err != nil {
+		replyJSON(reqCtx, http.StatusNotFound, adminError{Error: fmt.Sprintf("epoch %d is not available", epochNumber)})
+		return
+	}
+	name := string(args.Peek("index"))
+	if _, ok := epochHandler.getIndexMount(name); name != "" && !ok {
+		replyJSON(reqCtx, http.StatusNotFound, adminError{Error: fmt.Sprintf("epoch %d has no index %q", epochNumber, name)})
+		return
+	}
+	go func() {
+		if err := epochHandler.SetIndexMode(ctx, name, mode); err != nil {
+			klog.Errorf("admin: failed to switch the indexes of epoch %d to %s mode: %s", epochNumber, mode, err)
+		}
+	}()
+	replyJSON(reqCtx, http.StatusAccepted, map[string]any{
+		"epoch": epochNumber,
+		"mode":  mode,
+	})
+}
+
+// handleAdminArtifactCache serves the managed cache directory:
+//
+//	GET /artifact-cache                       -> its files, pins and last garbage collection
+//	POST /artifact-cache/gc                   -> runs a garbage collection now
+//	POST|DELETE /artifact-cache/pin?pattern=  -> adds or removes a pattern of the pin list
+func handleAdminArtifactCache(reqCtx *fasthttp.RequestCtx, path string, cache *artifactCache) {
+	switch path {
+	case "/artifact-cache":
+		if !reqCtx.IsGet() {
+			replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+			return
+		}
+		status, err := cache.Status()
+		if err != nil {
+			replyJSON(reqCtx, http.StatusInternalServerError, adminError{Error: err.Error()})
+			return
+		}
+		replyJSON(reqCtx, http.StatusOK, status)
+	case "/artifact-cache/gc":
+		if !reqCtx.IsPost() {
+			replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+			return
+		}
+		replyJSON(reqCtx, http.StatusOK, cache.Collect())
+	case "/artifact-cache/pin":
+		pattern := string(reqCtx.QueryArgs().Peek("pattern"))
+		if pattern == "" {
+			replyJSON(reqCtx, http.StatusBadRequest, adminError{Error: "missing pattern"})
+			return
+		}
+		switch {
+		case reqCtx.IsPost():
+			cache.Pin(pattern)
+			klog.Infof("admin: pinned %q in the artifact cache", pattern)
+			replyJSON(reqCtx, http.StatusOK, map[string]any{
+				"pattern": pattern,
+				"pinned":  true,
+			})
+		case reqCtx.IsDelete():
+			unpinned := cache.Unpin(pattern)
+			klog.Infof("admin: unpinned %q in the artifact cache", pattern)
+			replyJSON(reqCtx, http.StatusOK, map[string]any{
+				"pattern":  pattern,
+				"unpinned": unpinned,
+			})
+		default:
+			replyJSON(reqCtx, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		}
+	}
+}
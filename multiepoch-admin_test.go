@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAdminCachePinAndInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	// the objects of the CAR files; they are read from the cache by the epoch.
+	objects := make(map[cid.Cid][]byte)
+	put := func(v any, typ schema.Type) cid.Cid {
+		data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+		require.NoError(t, err)
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+		require.NoError(t, err)
+		require.NoError(t, cache.PutRawCarObject(c, data))
+		objects[c] = data
+		return c
+	}
+	putEntry := func(hash byte) cid.Cid {
+		return put(&ipldbindcode.Entry{
+			Kind:         int(iplddecoders.KindEntry),
+			Hash:         []byte{31: hash},
+			Transactions: ipldbindcode.List__Link{},
+		}, ipldbindcode.Prototypes.Entry.Type())
+	}
+	putBlock := func(slot uint64, entryCid cid.Cid) cid.Cid {
+		return put(&ipldbindcode.Block{
+			Kind:      int(iplddecoders.KindBlock),
+			Slot:      int(slot),
+			Shredding: ipldbindcode.List__Shredding{},
+			Entries:   ipldbindcode.List__Link{cidlink.Link{Cid: entryCid}},
+			Rewards:   cidlink.Link{Cid: DummyCID},
+		}, ipldbindcode.Prototypes.Block.Type())
+	}
+	newEpoch := func(blocks map[uint64]cid.Cid) *Epoch {
+		dir := t.TempDir()
+		writer, err := indexes.NewWriter_SlotToCid(0, DummyCID, indexes.NetworkMainnet, dir, uint64(len(blocks)))
+		require.NoError(t, err)
+		for slot, blockCid := range blocks {
+			require.NoError(t, writer.Put(slot, blockCid))
+		}
+		require.NoError(t, writer.Seal(ctx, dir))
+		slotToCid, err := indexes.Open_SlotToCid(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+		require.NoError(t, err)
+		t.Cleanup(func() { slotToCid.Close() })
+		return &Epoch{epoch: 0, config: &Config{}, allCache: cache, slotToCidIndex: slotToCid}
+	}
+
+	entryCid := putEntry(1)
+	block10 := putBlock(10, entryCid)
+	block11 := putBlock(11, entryCid)
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(0, newEpoch(map[uint64]cid.Cid{10: block10, 11: block11})))
+	handler := newAdminHandler(ctx, multi, &AdminConfig{Cache: cache})
+
+	request := func(method string, uri string, wantStatus int, result any) {
+		var req fasthttp.Request
+		req.Header.SetMethod(method)
+		req.SetRequestURI(uri)
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Init(&req, nil, nil)
+		handler(reqCtx)
+		require.Equal(t, wantStatus, reqCtx.Response.StatusCode(), "%s %s: %s", method, uri, reqCtx.Response.Body())
+		if result != nil {
+			require.NoError(t, json.Unmarshal(reqCtx.Response.Body(), result))
+		}
+	}
+	pinnedSlots := func() []uint64 {
+		var pins struct {
+			Slots []uint64 `json:"slots"`
+		}
+		request("GET", "/cache/pins", 200, &pins)
+		return pins.Slots
+	}
+	stats := func() hugecache.Stats {
+		var stats hugecache.Stats
+		request("GET", "/cache/stats", 200, &stats)
+		return stats
+	}
+	// the bytes of the slot-to-CID mappings and of the objects pinned for the blocks.
+	pinnedBytes := func(blockCids ...cid.Cid) int {
+		size := len(objects[entryCid])
+		for _, blockCid := range blockCids {
+			size += len(blockCid.Bytes()) + len(objects[blockCid])
+		}
+		return size
+	}
+
+	t.Run("pin", func(t *testing.T) {
+		require.Empty(t, pinnedSlots())
+		for _, slot := range []uint64{10, 11} {
+			var pinned struct {
+				Slot    uint64 `json:"slot"`
+				Cid     string `json:"cid"`
+				Objects int    `json:"objects"`
+			}
+			request("POST", fmt.Sprintf("/cache/pin?slot=%d", slot), 200, &pinned)
+			require.Equal(t, slot, pinned.Slot)
+			// the block and its entry.
+			require.Equal(t, 2, pinned.Objects)
+		}
+		require.Equal(t, []uint64{10, 11}, pinnedSlots())
+		got := stats()
+		require.Equal(t, 2, got.PinnedSlots)
+		// the 2 slot-to-CID mappings, the 2 blocks, and their (shared) entry.
+		require.Equal(t, 5, got.PinnedEntries)
+		require.Equal(t, pinnedBytes(block10, block11), got.PinnedBytes)
+
+		var unpinned struct {
+			Unpinned bool `json:"unpinned"`
+		}
+		request("DELETE", "/cache/pin?slot=11", 200, &unpinned)
+		require.True(t, unpinned.Unpinned)
+		request("DELETE", "/cache/pin?slot=11", 200, &unpinned)
+		require.False(t, unpinned.Unpinned)
+		require.Equal(t, []uint64{10}, pinnedSlots())
+		got = stats()
+		require.Equal(t, 1, got.PinnedSlots)
+		// the entry is still pinned for slot 10.
+		require.Equal(t, 3, got.PinnedEntries)
+		require.Equal(t, pinnedBytes(block10), got.PinnedBytes)
+
+		// a slot of an epoch that is not served.
+		request("POST", fmt.Sprintf("/cache/pin?slot=%d", EpochLen+10), 404, nil)
+		request("POST", "/cache/pin", 400, nil)
+		request("GET", "/cache/pin?slot=10", 405, nil)
+	})
+
+	t.Run("invalidate after replacing the epoch", func(t *testing.T) {
+		require.NoError(t, cache.PutCidToOffsetAndSize(block10, &indexes.OffsetAndSize{Offset: 100, Size: 10}))
+		require.NoError(t, cache.PutCidToOffsetAndSize(block11, &indexes.OffsetAndSize{Offset: 200, Size: 10}))
+
+		// the CAR of the epoch is replaced: slot 10 now has another block.
+		newBlock10 := putBlock(10, putEntry(2))
+		require.NoError(t, multi.ReplaceEpoch(0, newEpoch(map[uint64]cid.Cid{10: newBlock10, 11: block11})))
+		// until the cache is invalidated, the pinned (stale) block is served.
+		epoch, err := multi.GetEpoch(0)
+		require.NoError(t, err)
+		got, err := epoch.FindCidFromSlot(ctx, 10)
+		require.NoError(t, err)
+		require.Equal(t, block10, got)
+
+		var invalidated struct {
+			Kind    string `json:"kind"`
+			Deleted int    `json:"deleted"`
+		}
+		request("POST", "/cache/invalidate?epoch=0", 200, &invalidated)
+		require.Equal(t, "epoch", invalidated.Kind)
+		// the slot-to-CID mappings of the 2 slots (cached when they were pinned), and the 2
+		// offset-and-size entries.
+		require.Equal(t, 4, invalidated.Deleted)
+		require.Empty(t, pinnedSlots())
+		require.Zero(t, stats().PinnedEntries)
+		_, _, has := cache.GetCidToOffsetAndSize(block10)
+		require.False(t, has)
+
+		got, err = epoch.FindCidFromSlot(ctx, 10)
+		require.NoError(t, err)
+		require.Equal(t, newBlock10, got)
+		var pinned struct {
+			Cid string `json:"cid"`
+		}
+		request("POST", "/cache/pin?slot=10", 200, &pinned)
+		require.Equal(t, newBlock10.String(), pinned.Cid)
+
+		request("POST", "/cache/invalidate?slot=10", 200, &invalidated)
+		require.Equal(t, "slot", invalidated.Kind)
+		require.Empty(t, pinnedSlots())
+		request("POST", "/cache/invalidate", 400, nil)
+		request("POST", "/cache/invalidate?epoch=x", 400, nil)
+		request("GET", "/cache/invalidate?epoch=0", 405, nil)
+	})
+
+	t.Run("invalidate a pinned object", func(t *testing.T) {
+		request("POST", "/cache/pin?slot=11", 200, nil)
+		_, _, has := cache.GetRawCarObject(entryCid)
+		require.True(t, has)
+
+		var invalidated struct {
+			Kind    string `json:"kind"`
+			Deleted int    `json:"deleted"`
+		}
+		request("POST", "/cache/invalidate?cid="+entryCid.String(), 200, &invalidated)
+		require.Equal(t, "cid", invalidated.Kind)
+		require.Equal(t, 1, invalidated.Deleted)
+		// the object is not served anymore, even though its slot is still pinned.
+		_, _, has = cache.GetRawCarObject(entryCid)
+		require.False(t, has)
+		require.Equal(t, []uint64{11}, pinnedSlots())
+		got := stats()
+		// the slot-to-CID mapping and the block.
+		require.Equal(t, 2, got.PinnedEntries)
+		require.Equal(t, len(block11.Bytes())+len(objects[block11]), got.PinnedBytes)
+		request("POST", "/cache/invalidate?cid=x", 400, nil)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		handler := newAdminHandler(ctx, multi, &AdminConfig{})
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Request.Header.SetMethod("GET")
+		reqCtx.Request.SetRequestURI("/cache/stats")
+		handler(reqCtx)
+		require.Equal(t, 503, reqCtx.Response.StatusCode())
+	})
+}
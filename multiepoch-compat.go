@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// The compatibility methods (enabled with --compat-methods) answer some of the methods
+// that generic solana clients call during a session, even if they are not about the archive,
+// so that the clients don't fail on them: the answers are the ones that make sense for
+// an archive of finalized blocks.
+const (
+	compatGetBlockCommitment = "getBlockCommitment"
+	compatGetSlotLeader      = "getSlotLeader"
+	compatMinimumLedgerSlot  = "minimumLedgerSlot"
+	// compatUnsupported enables the clean errors for the methods about the live state of the chain.
+	compatUnsupported = "unsupported"
+)
+
+var compatMethodNames = []string{
+	compatGetBlockCommitment,
+	compatGetSlotLeader,
+	compatMinimumLedgerSlot,
+	compatUnsupported,
+}
+
+// unsupportedLiveMethods are the methods about the live state of the chain, that the archive
+// can't answer: with the compat methods enabled (and no proxy), they get a clean error
+// that says so, instead of "Method not found".
+var unsupportedLiveMethods = map[string]bool{
+	"getAccountInfo":          true,
+	"getBalance":              true,
+	"getFeeForMessage":        true,
+	"getLatestBlockhash":      true,
+	"getMultipleAccounts":     true,
+	"getProgramAccounts":      true,
+	"getRecentBlockhash":      true,
+	"getTokenAccountBalance":  true,
+	"getTokenAccountsByOwner": true,
+	"isBlockhashValid":        true,
+	"requestAirdrop":          true,
+	"sendTransaction":         true,
+	"simulateTransaction":     true,
+}
+
+// ParseCompatMethods parses the value of --compat-methods: a list of compatibility methods, or "all".
+func ParseCompatMethods(values []string) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "":
+				continue
+			case name == "all":
+				for _, name := range compatMethodNames {
+					enabled[name] = true
+				}
+			case isCompatMethodName(name):
+				enabled[name] = true
+			default:
+				return nil, fmt.Errorf("unknown compat method %q, expected one of %s or all", name, strings.Join(compatMethodNames, ", "))
+			}
+		}
+	}
+	return enabled, nil
+}
+
+func isCompatMethodName(name string) bool {
+	for _, v := range compatMethodNames {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isCompatMethod returns true if the method is answered by the enabled compatibility methods
+// (and so is not proxied).
+func (multi *MultiEpoch) isCompatMethod(method string) bool {
+	return multi.options != nil && method != compatUnsupported && multi.options.CompatMethods[method]
+}
+
+// isUnsupportedLiveMethod returns true if the method gets the clean unsupported error.
+func (multi *MultiEpoch) isUnsupportedLiveMethod(method string) bool {
+	return multi.options != nil && multi.options.CompatMethods[compatUnsupported] && unsupportedLiveMethods[method]
+}
+
+// EnabledCompatMethods returns the names of the enabled compatibility methods.
+func (multi *MultiEpoch) EnabledCompatMethods() []string {
+	if multi.options == nil {
+		return nil
+	}
+	names := make([]string, 0, len(multi.options.CompatMethods))
+	for name, enabled := range multi.options.CompatMethods {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (multi *MultiEpoch) handleCompatMethod(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	switch req.Method {
+	case compatGetBlockCommitment:
+		return multi.handleGetBlockCommitment(ctx, conn, req)
+	case compatGetSlotLeader:
+		return multi.handleGetSlotLeader(ctx, conn, req)
+	case compatMinimumLedgerSlot:
+		return multi.handleMinimumLedgerSlot(ctx, conn, req)
+	default:
+		return errMethodUnsupported(req.Method, fmt.Errorf("not a compat method"))
+	}
+}
+
+// handleGetBlockCommitment answers like the RPC does for the finalized blocks that are no longer
+// in its commitment cache: without commitment (and the archive doesn't know the stake).
+func (multi *MultiEpoch) handleGetBlockCommitment(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	if req.Params == nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("params are required"))
+	}
+	if _, err := parseGetBlockTimeRequest(req.Params); err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	err := conn.ReplyRaw(
+		ctx,
+		req.ID,
+		map[string]any{
+			"commitment": nil,
+			"totalStake": 0,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
+
+// handleMinimumLedgerSlot answers with the first slot in the archive.
+func (multi *MultiEpoch) handleMinimumLedgerSlot(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	firstBlock, err := multi.GetFirstAvailableBlock(ctx)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get first available block: %w", err))
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		uint64(firstBlock.Slot),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
+
+// handleGetSlotLeader answers with the leader of the most recent slot in the archive, from the leader
+// schedule sidecar of its epoch: the blocks in the archive don't say who produced them.
+func (multi *MultiEpoch) handleGetSlotLeader(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	lastBlock, err := multi.GetMostRecentAvailableBlock(ctx)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get the most recent block: %w", err))
+	}
+	slot := uint64(lastBlock.Slot)
+	epochHandler, err := multi.GetEpoch(CalcEpochForSlot(slot))
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get the epoch of slot %d: %w", slot, err))
+	}
+	leader, ok := epochHandler.GetSlotLeader(slot)
+	if !ok {
+		return errMethodUnsupported(req.Method, fmt.Errorf("no leader schedule for slot %d", slot))
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		leader.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompatMethods(t *testing.T) {
+	enabled, err := ParseCompatMethods(nil)
+	require.NoError(t, err)
+	require.Empty(t, enabled)
+
+	enabled, err = ParseCompatMethods([]string{"getBlockCommitment, minimumLedgerSlot"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"getBlockCommitment": true, "minimumLedgerSlot": true}, enabled)
+
+	enabled, err = ParseCompatMethods([]string{"all"})
+	require.NoError(t, err)
+	require.Len(t, enabled, len(compatMethodNames))
+
+	_, err = ParseCompatMethods([]string{"getBalance"})
+	require.Error(t, err)
+}
+
+func TestCompatMethodsRouting(t *testing.T) {
+	enabled, err := ParseCompatMethods([]string{"minimumLedgerSlot", "unsupported"})
+	require.NoError(t, err)
+	multi := NewMultiEpoch(&Options{CompatMethods: enabled})
+	require.Equal(t, []string{"minimumLedgerSlot", "unsupported"}, multi.EnabledCompatMethods())
+
+	require.True(t, multi.isCompatMethod("minimumLedgerSlot"))
+	require.False(t, multi.isCompatMethod("getBlockCommitment"))
+	require.False(t, multi.isCompatMethod("unsupported"))
+	require.True(t, multi.isUnsupportedLiveMethod("sendTransaction"))
+	require.False(t, multi.isUnsupportedLiveMethod("getBlock"))
+
+	// disabled by default.
+	multi = NewMultiEpoch(&Options{})
+	require.False(t, multi.isCompatMethod("minimumLedgerSlot"))
+	require.False(t, multi.isUnsupportedLiveMethod("sendTransaction"))
+
+	rpcErr, _ := errMethodUnsupported("getSlotLeader", nil)
+	require.Equal(t, map[string]any{"reason": ReasonMethodUnsupported, "method": "getSlotLeader"}, errorData(t, rpcErr))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+type GetAccountAtEpochBoundaryRequest struct {
+	Pubkey solana.PublicKey `json:"pubkey"`
+	Epoch  uint64           `json:"epoch"`
+}
+
+func parseGetAccountAtEpochBoundaryRequest(raw *json.RawMessage) (*GetAccountAtEpochBoundaryRequest, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("params must be [pubkey, epoch]")
+	}
+	var params []json.RawMessage
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 2 || len(params) > 3 {
+		return nil, fmt.Errorf("params must be [pubkey, epoch, {encoding}], got %d arguments", len(params))
+	}
+	var pubkeyString string
+	if err := fasterJson.Unmarshal(params[0], &pubkeyString); err != nil {
+		return nil, fmt.Errorf("first argument must be a pubkey string: %w", err)
+	}
+	pubkey, err := solana.PublicKeyFromBase58(pubkeyString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubkey %q: %w", pubkeyString, err)
+	}
+	out := &GetAccountAtEpochBoundaryRequest{Pubkey: pubkey}
+	if err := fasterJson.Unmarshal(params[1], &out.Epoch); err != nil {
+		return nil, fmt.Errorf("second argument must be an epoch number: %w", err)
+	}
+	if len(params) == 3 {
+		var config struct {
+			Encoding string `json:"encoding"`
+		}
+		if err := fasterJson.Unmarshal(params[2], &config); err != nil {
+			return nil, fmt.Errorf("third argument must be an object: %w", err)
+		}
+		// the data of the accounts is opaque to the archive: it's only returned as base64.
+		if config.Encoding != "" && config.Encoding != "base64" {
+			return nil, fmt.Errorf("unsupported encoding %q, only base64 is supported", config.Encoding)
+		}
+	}
+	return out, nil
+}
+
+// AccountAtEpochBoundary is an account in the format of the getAccountInfo results.
+type AccountAtEpochBoundary struct {
+	Lamports   uint64    `json:"lamports"`
+	Owner      string    `json:"owner"`
+	Data       [2]string `json:"data"`
+	Executable bool      `json:"executable"`
+	RentEpoch  uint64    `json:"rentEpoch"`
+	Space      uint64    `json:"space"`
+}
+
+func accountAtEpochBoundary(record *AccountRecord) *AccountAtEpochBoundary {
+	return &AccountAtEpochBoundary{
+		Lamports:   record.Lamports,
+		Owner:      record.Owner.String(),
+		Data:       [2]string{base64.StdEncoding.EncodeToString(record.Data), "base64"},
+		Executable: record.Executable,
+		RentEpoch:  record.RentEpoch,
+		Space:      uint64(len(record.Data)),
+	}
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getAccountAtEpochBoundary",
+		Summary: "Returns the state of an account at the start of an epoch, from the account snapshot of the epoch.",
+		Params: []MethodParam{
+			stringParam("pubkey", "the base58 pubkey of the account"),
+			uintParam("epoch", "the epoch"),
+			configParam("encoding (only base64)"),
+		},
+		CacheKey: func(req *jsonrpc2.Request) (any, bool) {
+			params, err := parseGetAccountAtEpochBoundaryRequest(req.Params)
+			if err != nil {
+				return nil, false
+			}
+			return params, true
+		},
+		Handler: (*MultiEpoch).handleGetAccountAtEpochBoundary,
+	})
+}
+
+// handleGetAccountAtEpochBoundary answers with the state of an account at the start of an epoch,
+// from the account snapshot of the epoch; the value is null if the account is not in the snapshot.
+func (multi *MultiEpoch) handleGetAccountAtEpochBoundary(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetAccountAtEpochBoundaryRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	epochHandler, err := multi.GetEpoch(params.Epoch)
+	if err != nil {
+		return errEpochNotAvailable(params.Epoch, fmt.Errorf("failed to get epoch %d: %w", params.Epoch, err))
+	}
+	snapshot := epochHandler.GetAccountSnapshot()
+	if snapshot == nil {
+		return errInvalidParams(
+			fmt.Sprintf("Account snapshot for epoch %d is unavailable", params.Epoch),
+			fmt.Errorf("no account snapshot for epoch %d", params.Epoch),
+		)
+	}
+	var value *AccountAtEpochBoundary
+	record, err := snapshot.GetAccount(params.Pubkey)
+	if err != nil && !errors.Is(err, compactindexsized.ErrNotFound) {
+		return errInternal(fmt.Errorf("failed to get account %s from the snapshot of epoch %d: %w", params.Pubkey, params.Epoch, err))
+	}
+	if record != nil {
+		value = accountAtEpochBoundary(record)
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		map[string]any{
+			"context": map[string]any{
+				"slot": snapshot.Slot(),
+			},
+			"value": value,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -4,12 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"runtime"
 	"sort"
-	"sync"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/ipfs/go-cid"
@@ -17,7 +17,7 @@ import (
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
-	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	solanablockrewards "github.com/rpcpool/yellowstone-faithful/solana-block-rewards"
 	"github.com/sourcegraph/jsonrpc2"
 	"golang.org/x/sync/errgroup"
@@ -42,46 +42,51 @@ func getRequestIDFromContext(ctx context.Context) string {
 	return id
 }
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getBlock",
+		Summary: "Returns the block of a slot.",
+		Params: []MethodParam{
+			uintParam("slot", "the slot of the block"),
+			configParam("encoding, transactionDetails, rewards, maxSupportedTransactionVersion, commitment and withDebugTiming"),
+		},
+		Cost:     MethodCostHeavy,
+		CacheKey: cacheKeyGetBlock,
+		Handler:  (*MultiEpoch).handleGetBlock,
+	})
+}
+
 func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
-	tim := newTimer(getRequestIDFromContext(ctx))
+	tim := newTimer(ctx)
 	params, err := parseGetBlockRequest(req.Params)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: "Invalid params",
-		}, fmt.Errorf("failed to parse params: %w", err)
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
 	}
 	if err := params.Validate(); err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: err.Error(),
-		}, fmt.Errorf("failed to validate params: %w", err)
+		return errInvalidParams(err.Error(), fmt.Errorf("failed to validate params: %w", err))
 	}
 	tim.time("parseGetBlockRequest")
+	if params.Options.WithDebugTiming && !conn.strict() {
+		ctx = withDebugTiming(ctx)
+	}
 	slot := params.Slot
 
 	// find the epoch that contains the requested slot
 	epochNumber := CalcEpochForSlot(slot)
 	epochHandler, err := multi.GetEpoch(epochNumber)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    CodeNotFound,
-			Message: fmt.Sprintf("Epoch %d is not available", epochNumber),
-		}, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
 	}
 
 	block, blockCid, err := epochHandler.GetBlock(WithSubrapghPrefetch(ctx, true), slot)
 	if err != nil {
 		if errors.Is(err, compactindexsized.ErrNotFound) {
-			return &jsonrpc2.Error{
-				Code:    CodeNotFound,
-				Message: fmt.Sprintf("Slot %d was skipped, or missing in long-term storage", slot),
-			}, err
+			if epochHandler.IsSlotSkipped(slot) {
+				return errSlotSkipped(slot, err)
+			}
+			return errSlotNotInArchive(slot, err)
 		} else {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Failed to get block",
-			}, fmt.Errorf("failed to get block: %w", err)
+			return errInternal(fmt.Errorf("failed to get block: %w", err))
 		}
 	}
 	// set the headers:
@@ -103,6 +108,7 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 			var blockCid, parentBlockCid cid.Cid
 			wg := new(errgroup.Group)
 			wg.Go(func() (err error) {
+				defer recoverPanic("dag_worker", &err)
 				blockCid, err = epochHandler.FindCidFromSlot(ctx, slot)
 				if err != nil {
 					return err
@@ -110,6 +116,7 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 				return nil
 			})
 			wg.Go(func() (err error) {
+				defer recoverPanic("dag_worker", &err)
 				if parentIsInPreviousEpoch {
 					return nil
 				}
@@ -138,6 +145,7 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 				var blockOffset, parentOffset uint64
 				wg := new(errgroup.Group)
 				wg.Go(func() (err error) {
+					defer recoverPanic("dag_worker", &err)
 					offsetAndSize, err := epochHandler.FindOffsetAndSizeFromCid(ctx, blockCid)
 					if err != nil {
 						return err
@@ -146,6 +154,7 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 					return nil
 				})
 				wg.Go(func() (err error) {
+					defer recoverPanic("dag_worker", &err)
 					if parentIsInPreviousEpoch {
 						// get car file header size
 						parentOffset = epochHandler.carHeaderSize
@@ -205,173 +214,48 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 			}
 			return nil
 		}
-		if epochHandler.lassieFetcher == nil {
+		if epochHandler.lassieFetcher == nil && !multi.isBlockAssembled(blockCid, *params.Options.Rewards) {
 			err := prefetcherFromCar()
 			if err != nil {
-				klog.Errorf("failed to prefetch from car: %v", err)
+				rpcLog.Ctx(ctx).Error("failed to prefetch from car", logging.Slot(slot), logging.Cid(blockCid), logging.Err(err))
 			}
 		}
 	}
-	blocktime := uint64(block.Meta.Blocktime)
-
-	allTransactionNodes := make([][]*ipldbindcode.Transaction, len(block.Entries))
-	mu := &sync.Mutex{}
-	var lastEntryHash solana.Hash
-	{
-		wg := new(errgroup.Group)
-		wg.SetLimit(runtime.NumCPU() * 2)
-		// get entries from the block
-		for entryIndex, entry := range block.Entries {
-			entryIndex := entryIndex
-			entryCid := entry.(cidlink.Link).Cid
-			wg.Go(func() error {
-				// get the entry by CID
-				entryNode, err := epochHandler.GetEntryByCid(ctx, entryCid)
-				if err != nil {
-					klog.Errorf("failed to decode Entry: %v", err)
-					return err
-				}
-
-				if entryIndex == len(block.Entries)-1 {
-					lastEntryHash = solana.HashFromBytes(entryNode.Hash)
-				}
-
-				twg := new(errgroup.Group)
-				twg.SetLimit(runtime.NumCPU())
-				// get the transactions from the entry
-				allTransactionNodes[entryIndex] = make([]*ipldbindcode.Transaction, len(entryNode.Transactions))
-				for txI := range entryNode.Transactions {
-					txI := txI
-					tx := entryNode.Transactions[txI]
-					twg.Go(func() error {
-						// get the transaction by CID
-						tcid := tx.(cidlink.Link).Cid
-						txNode, err := epochHandler.GetTransactionByCid(ctx, tcid)
-						if err != nil {
-							klog.Errorf("failed to decode Transaction %s: %v", tcid, err)
-							return nil
-						}
-						mu.Lock()
-						allTransactionNodes[entryIndex][txI] = txNode
-						mu.Unlock()
-						return nil
-					})
-				}
-				return twg.Wait()
-			})
-		}
-		err = wg.Wait()
+	if multi.options != nil && multi.options.MaxBlockTransactions > 0 && withTransactionBodies(*params.Options.TransactionDetails) {
+		// the transactions are counted from the entries (prefetched above), before they're read,
+		// so that a huge block doesn't end up in a huge response.
+		numTransactions, err := multi.countBlockTransactions(ctx, epochHandler, block, blockCid)
 		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to get entries: %v", err)
+			return errInternal(fmt.Errorf("failed to count the transactions of the block: %w", err))
 		}
+		if numTransactions > multi.options.MaxBlockTransactions {
+			return errBlockTooLarge(slot, numTransactions, multi.options.MaxBlockTransactions)
+		}
+	}
+	blocktime := uint64(block.Meta.Blocktime)
+
+	assembled, err := multi.getAssembledBlock(ctx, epochHandler, block, blockCid, *params.Options.Rewards)
+	if err != nil {
+		return errInternal(err)
 	}
+	lastEntryHash := assembled.lastEntryHash
 	tim.time("get entries")
 
 	var allTransactions []GetTransactionResponse
 	var rewards any
-	hasRewards := !block.Rewards.(cidlink.Link).Cid.Equals(DummyCID)
-	if *params.Options.Rewards && hasRewards {
-		rewardsNode, err := epochHandler.GetRewardsByCid(ctx, block.Rewards.(cidlink.Link).Cid)
-		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to decode Rewards: %v", err)
-		}
-		rewardsBuf, err := loadDataFromDataFrames(&rewardsNode.Data, epochHandler.GetDataFrameByCid)
-		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to load Rewards dataFrames: %v", err)
-		}
-
-		uncompressedRewards, err := decompressZstd(rewardsBuf)
-		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to decompress Rewards: %v", err)
-		}
-		// try decoding as protobuf
-		actualRewards, err := solanablockrewards.ParseRewards(uncompressedRewards)
-		if err != nil {
-			// TODO: add support for legacy rewards format
-			fmt.Println("Rewards are not protobuf: " + err.Error())
-		} else {
-			{
-				// encode rewards as JSON, then decode it as a map
-				buf, err := fasterJson.Marshal(actualRewards)
-				if err != nil {
-					return &jsonrpc2.Error{
-						Code:    jsonrpc2.CodeInternalError,
-						Message: "Internal error",
-					}, fmt.Errorf("failed to encode rewards: %v", err)
-				}
-				var m map[string]any
-				err = fasterJson.Unmarshal(buf, &m)
-				if err != nil {
-					return &jsonrpc2.Error{
-						Code:    jsonrpc2.CodeInternalError,
-						Message: "Internal error",
-					}, fmt.Errorf("failed to decode rewards: %v", err)
-				}
-				if _, ok := m["rewards"]; ok {
-					// iter over rewards as an array of maps, and add a "commission" field to each = nil
-					rewardsAsArray := m["rewards"].([]any)
-					for _, reward := range rewardsAsArray {
-						rewardAsMap := reward.(map[string]any)
-						if _, ok := rewardAsMap["commission"]; !ok {
-							rewardAsMap["commission"] = nil
-						}
-						// if the commission field is a string, convert it to a float
-						if asString, ok := rewardAsMap["commission"].(string); ok {
-							rewardAsMap["commission"] = asFloat(asString)
-						}
-						// if no lamports field, add it and set it to 0
-						if _, ok := rewardAsMap["lamports"]; !ok {
-							rewardAsMap["lamports"] = uint64(0)
-						}
-
-						// if it has a post_balance field, convert it to postBalance
-						if _, ok := rewardAsMap["post_balance"]; ok {
-							rewardAsMap["postBalance"] = rewardAsMap["post_balance"]
-							delete(rewardAsMap, "post_balance")
-						}
-						// if it has a reward_type field, convert it to rewardType
-						if _, ok := rewardAsMap["reward_type"]; ok {
-							rewardAsMap["rewardType"] = rewardAsMap["reward_type"]
-							delete(rewardAsMap, "reward_type")
-
-							// if it's a float, convert to int and use rentTypeToString
-							if asFloat, ok := rewardAsMap["rewardType"].(float64); ok {
-								rewardAsMap["rewardType"] = rewardTypeToString(int(asFloat))
-							}
-						}
-					}
-					rewards = rewardsAsArray
-					// sort.Slice(rewardsAsArray, func(i, j int) bool {
-					// 	// sort by rewardType, then by pubkey
-					// 	if rewardTypeStringToInt(rewardsAsArray[i].(map[string]any)["rewardType"].(string)) != rewardTypeStringToInt(rewardsAsArray[j].(map[string]any)["rewardType"].(string)) {
-					// 		return rewardTypeStringToInt(rewardsAsArray[i].(map[string]any)["rewardType"].(string)) > rewardTypeStringToInt(rewardsAsArray[j].(map[string]any)["rewardType"].(string))
-					// 	}
-					// 	return bytes.Compare(solana.MPK(rewardsAsArray[i].(map[string]any)["pubkey"].(string)).Bytes(), solana.MPK(rewardsAsArray[j].(map[string]any)["pubkey"].(string)).Bytes()) < 0
-					// })
-				} else {
-					klog.Errorf("did not find rewards field in rewards")
-					rewards = make([]any, 0)
-				}
-			}
-		}
+	// the rewards are rendered while the transactions are.
+	rewardsGroup := new(errgroup.Group)
+	if *params.Options.Rewards && assembled.rewards != nil {
+		rewardsGroup.Go(func() (err error) {
+			defer recoverPanic("dag_worker", &err)
+			rewards, err = renderBlockRewards(ctx, slot, assembled.rewards)
+			return err
+		})
 	} else {
 		rewards = make([]any, 0)
 	}
-	tim.time("get rewards")
-	{
-		for _, transactionNode := range mergeTxNodeSlices(allTransactionNodes) {
+	if *params.Options.TransactionDetails != transactionDetailsNone {
+		for _, transactionNode := range assembled.transactionNodes {
 			var txResp GetTransactionResponse
 
 			// response.Slot = uint64(transactionNode.Slot)
@@ -384,31 +268,74 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 				if ok {
 					txResp.Position = uint64(pos)
 				}
-				tx, meta, err := parseTransactionAndMetaFromNode(transactionNode, epochHandler.GetDataFrameByCid)
-				if err != nil {
-					return &jsonrpc2.Error{
-						Code:    jsonrpc2.CodeInternalError,
-						Message: "Internal error",
-					}, fmt.Errorf("failed to decode transaction: %v", err)
-				}
-				txResp.Signatures = tx.Signatures
-				if tx.Message.IsVersioned() {
-					txResp.Version = tx.Message.GetVersion() - 1
-				} else {
-					txResp.Version = "legacy"
-				}
-				txResp.Meta = meta
+				if *params.Options.TransactionDetails == transactionDetailsSignatures {
+					// only the signature: the meta is not read.
+					txBuf, err := loadDataFromDataFrames(ctx, &transactionNode.Data, epochHandler.GetDataFrameByCid)
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to load transaction: %v", err))
+					}
+					sig, _, err := parseRawTransactionHeader(txBuf)
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to decode transaction: %v", err))
+					}
+					txResp.Signatures = []solana.Signature{sig}
+				} else if *params.Options.TransactionDetails != transactionDetailsAccounts && isBinaryEncoding(*params.Options.Encoding) {
+					// fast path: the stored bytes of the transaction are encoded as they are.
+					startedDecodingAt := time.Now()
+					txBuf, meta, err := parseRawTransactionAndMetaFromNode(ctx, transactionNode, epochHandler.GetDataFrameByCid)
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to decode transaction: %v", err))
+					}
+					_, txResp.Version, err = parseRawTransactionHeader(txBuf)
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to decode transaction: %v", err))
+					}
+					observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+					txResp.Meta = meta
 
-				encodedTx, err := encodeTransactionResponseBasedOnWantedEncoding(*params.Options.Encoding, tx, meta)
-				if err != nil {
-					return &jsonrpc2.Error{
-						Code:    jsonrpc2.CodeInternalError,
-						Message: "Internal error",
-					}, fmt.Errorf("failed to encode transaction: %v", err)
+					startedEncodingAt := time.Now()
+					encodedTx, err := encodeRawTransactionBasedOnWantedEncoding(*params.Options.Encoding, txBuf)
+					if errors.Is(err, errBase58TooLarge) {
+						return errInvalidParams(err.Error(), err)
+					}
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to encode transaction: %v", err))
+					}
+					observeDebugTiming(ctx, debugPhaseEncode, startedEncodingAt)
+					txResp.Transaction = encodedTx
+				} else {
+					startedDecodingAt := time.Now()
+					tx, meta, err := parseTransactionAndMetaFromNode(ctx, transactionNode, epochHandler.GetDataFrameByCid)
+					if err != nil {
+						return errInternal(fmt.Errorf("failed to decode transaction: %v", err))
+					}
+					observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+					txResp.Signatures = tx.Signatures
+					if tx.Message.IsVersioned() {
+						txResp.Version = tx.Message.GetVersion() - 1
+					} else {
+						txResp.Version = "legacy"
+					}
+					txResp.Meta = meta
+
+					startedEncodingAt := time.Now()
+					if *params.Options.TransactionDetails == transactionDetailsAccounts {
+						txResp.Transaction = encodeTransactionAccounts(tx, meta)
+					} else {
+						encodedTx, err := encodeTransactionResponseBasedOnWantedEncoding(*params.Options.Encoding, tx, meta)
+						if errors.Is(err, errBase58TooLarge) {
+							return errInvalidParams(err.Error(), err)
+						}
+						if err != nil {
+							return errInternal(fmt.Errorf("failed to encode transaction: %v", err))
+						}
+						txResp.Transaction = encodedTx
+					}
+					observeDebugTiming(ctx, debugPhaseEncode, startedEncodingAt)
 				}
-				txResp.Transaction = encodedTx
 			}
 
+			txResp.mapMetaDirectly()
 			allTransactions = append(allTransactions, txResp)
 		}
 	}
@@ -416,7 +343,18 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 	sort.Slice(allTransactions, func(i, j int) bool {
 		return allTransactions[i].Position < allTransactions[j].Position
 	})
+	var signatures []string
+	if *params.Options.TransactionDetails == transactionDetailsSignatures {
+		signatures = make([]string, 0, len(allTransactions))
+		for _, txResp := range allTransactions {
+			signatures = append(signatures, txResp.Signatures[0].String())
+		}
+	}
 	tim.time("get transactions")
+	if err := rewardsGroup.Wait(); err != nil {
+		return errInternal(err)
+	}
+	tim.time("get rewards")
 	var blockResp GetBlockResponse
 	blockResp.Transactions = allTransactions
 	if blocktime != 0 {
@@ -450,25 +388,23 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 	{
 		// get parent slot
 		parentSlot := uint64(block.Meta.Parent_slot)
-		if (parentSlot != 0 || slot == 1) && CalcEpochForSlot(parentSlot) == epochNumber {
+		if previousBlockhash, ok := epochHandler.GetPreviousBlockhash(slot); ok && slot != 0 {
+			// from the slot-to-blockhash index, without reading the parent block.
+			previousBlockhashString := previousBlockhash.String()
+			blockResp.PreviousBlockhash = &previousBlockhashString
+		} else if (parentSlot != 0 || slot == 1) && CalcEpochForSlot(parentSlot) == epochNumber {
 			// NOTE: if the parent is in the same epoch, we can get it from the same epoch handler as the block;
 			// otherwise, we need to get it from the previous epoch (TODO: implement this)
 			parentBlock, _, err := epochHandler.GetBlock(WithSubrapghPrefetch(ctx, false), parentSlot)
 			if err != nil {
-				return &jsonrpc2.Error{
-					Code:    jsonrpc2.CodeInternalError,
-					Message: "Internal error",
-				}, fmt.Errorf("failed to get/decode block: %v", err)
+				return errInternal(fmt.Errorf("failed to get/decode block: %v", err))
 			}
 
 			if len(parentBlock.Entries) > 0 {
 				lastEntryCidOfParent := parentBlock.Entries[len(parentBlock.Entries)-1]
 				parentEntryNode, err := epochHandler.GetEntryByCid(ctx, lastEntryCidOfParent.(cidlink.Link).Cid)
 				if err != nil {
-					return &jsonrpc2.Error{
-						Code:    jsonrpc2.CodeInternalError,
-						Message: "Internal error",
-					}, fmt.Errorf("failed to decode Entry: %v", err)
+					return errInternal(fmt.Errorf("failed to decode Entry: %v", err))
 				}
 				parentEntryHash := solana.HashFromBytes(parentEntryNode.Hash).String()
 				blockResp.PreviousBlockhash = &parentEntryHash
@@ -480,6 +416,10 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 		}
 	}
 	tim.time("get parent block")
+	if leader, ok := epochHandler.GetSlotLeader(slot); ok && !conn.strict() {
+		leaderString := leader.String()
+		blockResp.Leader = &leaderString
+	}
 
 	{
 		if len(blockResp.Transactions) == 0 {
@@ -495,6 +435,15 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 		req.ID,
 		blockResp,
 		func(m map[string]any) map[string]any {
+			switch *params.Options.TransactionDetails {
+			case transactionDetailsSignatures:
+				delete(m, "transactions")
+				m["signatures"] = signatures
+				return m
+			case transactionDetailsNone:
+				delete(m, "transactions")
+				return m
+			}
 			transactions, ok := m["transactions"].([]any)
 			if !ok {
 				return m
@@ -504,7 +453,14 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 				if !ok {
 					continue
 				}
-				transactions[i] = adaptTransactionMetaToExpectedOutput(transaction)
+				transaction = allTransactions[i].withMetaResponse(adaptTransactionMetaToExpectedOutput(transaction))
+				if *params.Options.Encoding == solana.EncodingJSONParsed && *params.Options.TransactionDetails == transactionDetailsFull && !conn.strict() {
+					transaction = addInstructionLogs(transaction)
+				}
+				if *params.Options.TransactionDetails == transactionDetailsAccounts {
+					transaction = adaptTransactionMetaToAccountsMode(transaction, *params.Options.Rewards)
+				}
+				transactions[i] = transaction
 			}
 
 			return m
@@ -517,19 +473,85 @@ func (multi *MultiEpoch) handleGetBlock(ctx context.Context, conn *requestContex
 	return nil, nil
 }
 
-func asFloat(s string) float64 {
-	var f float64
-	_, err := fmt.Sscanf(s, "%f", &f)
+// renderBlockRewards returns the rewards of the block (as decompressed from its DAG) in the format of the
+// getBlock results; nil if they're not in the protobuf format.
+func renderBlockRewards(ctx context.Context, slot uint64, rewardsBuf []byte) (any, error) {
+	startedDecodingAt := time.Now()
+	// try decoding as protobuf
+	actualRewards, err := solanablockrewards.ParseRewards(rewardsBuf)
+	observeDebugTiming(ctx, debugPhaseDecode, startedDecodingAt)
+	if err != nil {
+		// TODO: add support for legacy rewards format
+		fmt.Println("Rewards are not protobuf: " + err.Error())
+		return nil, nil
+	}
+	// encode rewards as JSON, then decode it as a map (with exact lamports and balances)
+	buf, err := preciseJson.Marshal(actualRewards)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to encode rewards: %v", err)
 	}
-	return f
+	var m map[string]any
+	err = preciseJson.Unmarshal(buf, &m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rewards: %v", err)
+	}
+	if _, ok := m["rewards"]; !ok {
+		rpcLog.Ctx(ctx).Error("did not find rewards field in rewards", logging.Slot(slot))
+		return make([]any, 0), nil
+	}
+	// iter over rewards as an array of maps, and add a "commission" field to each = nil
+	rewardsAsArray := m["rewards"].([]any)
+	for _, reward := range rewardsAsArray {
+		rewardAsMap := reward.(map[string]any)
+		if _, ok := rewardAsMap["commission"]; !ok {
+			rewardAsMap["commission"] = nil
+		}
+		// if the commission field is a string, convert it to a float
+		if asString, ok := rewardAsMap["commission"].(string); ok {
+			commission, err := asFloat(asString)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse commission %q: %w", asString, err)
+			}
+			rewardAsMap["commission"] = commission
+		}
+		// if no lamports field, add it and set it to 0
+		if _, ok := rewardAsMap["lamports"]; !ok {
+			rewardAsMap["lamports"] = uint64(0)
+		}
+
+		// if it has a post_balance field, convert it to postBalance
+		if _, ok := rewardAsMap["post_balance"]; ok {
+			rewardAsMap["postBalance"] = rewardAsMap["post_balance"]
+			delete(rewardAsMap, "post_balance")
+		}
+		// if it has a reward_type field, convert it to rewardType
+		if _, ok := rewardAsMap["reward_type"]; ok {
+			rewardAsMap["rewardType"] = rewardAsMap["reward_type"]
+			delete(rewardAsMap, "reward_type")
+
+			// if it's a number, convert to int and use rentTypeToString
+			if asNumber, ok := rewardAsMap["rewardType"].(json.Number); ok {
+				if asInt, err := asNumber.Int64(); err == nil {
+					rewardAsMap["rewardType"] = rewardTypeToString(int(asInt))
+				}
+			}
+		}
+	}
+	// sort.Slice(rewardsAsArray, func(i, j int) bool {
+	// 	// sort by rewardType, then by pubkey
+	// 	if rewardTypeStringToInt(rewardsAsArray[i].(map[string]any)["rewardType"].(string)) != rewardTypeStringToInt(rewardsAsArray[j].(map[string]any)["rewardType"].(string)) {
+	// 		return rewardTypeStringToInt(rewardsAsArray[i].(map[string]any)["rewardType"].(string)) > rewardTypeStringToInt(rewardsAsArray[j].(map[string]any)["rewardType"].(string))
+	// 	}
+	// 	return bytes.Compare(solana.MPK(rewardsAsArray[i].(map[string]any)["pubkey"].(string)).Bytes(), solana.MPK(rewardsAsArray[j].(map[string]any)["pubkey"].(string)).Bytes()) < 0
+	// })
+	return rewardsAsArray, nil
 }
 
-func mergeTxNodeSlices(slices [][]*ipldbindcode.Transaction) []*ipldbindcode.Transaction {
-	var out []*ipldbindcode.Transaction
-	for _, slice := range slices {
-		out = append(out, slice...)
+func asFloat(s string) (float64, error) {
+	var f float64
+	_, err := fmt.Sscanf(s, "%f", &f)
+	if err != nil {
+		return 0, err
 	}
-	return out
+	return f, nil
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+type GetBlockHash256Response struct {
+	Slot uint64 `json:"slot"`
+	// BlockCid is the CID of the block in the archive.
+	BlockCid string `json:"blockCid"`
+	// Hash is the hex-encoded sha256 of the result of getBlock with the same params.
+	Hash string `json:"hash"`
+	// Size is the size of the result, in bytes.
+	Size int `json:"size"`
+}
+
+// blockHash256 hashes the rendered result of a getBlock request.
+func blockHash256(slot uint64, blockCid string, result json.RawMessage) *GetBlockHash256Response {
+	sum := sha256.Sum256(result)
+	return &GetBlockHash256Response{
+		Slot:     slot,
+		BlockCid: blockCid,
+		Hash:     hex.EncodeToString(sum[:]),
+		Size:     len(result),
+	}
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getBlockHash256",
+		Summary: "Returns the sha256 of the result of getBlock with the same params.",
+		Params: []MethodParam{
+			uintParam("slot", "the slot of the block"),
+			configParam("the options of getBlock"),
+		},
+		Cost:     MethodCostHeavy,
+		CacheKey: cacheKeyGetBlock,
+		Handler:  (*MultiEpoch).handleGetBlockHash256,
+	})
+}
+
+// handleGetBlockHash256 renders the block like getBlock with the same params, and answers with
+// the sha256 of the result, so that mirrors can check that they serve byte-identical blocks without
+// transferring them. The result is always rendered with the integers as numbers, regardless of
+// the large-ints-as-strings setting of the request.
+func (multi *MultiEpoch) handleGetBlockHash256(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetBlockRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if params.Options.WithDebugTiming {
+		// the timings are specific to each request.
+		return errInvalidParams("withDebugTiming is not supported by faithful_getBlockHash256", fmt.Errorf("withDebugTiming is not deterministic"))
+	}
+	rendered := &requestContext{ctx: &fasthttp.RequestCtx{}, apiVersion: conn.apiVersion}
+	errorResp, err := multi.handleGetBlock(ctx, rendered, &jsonrpc2.Request{
+		Method: "getBlock",
+		Params: req.Params,
+		ID:     req.ID,
+	})
+	if errorResp != nil || err != nil {
+		return errorResp, err
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		blockHash256(params.Slot, string(rendered.ctx.Response.Header.Peek("DAG-Root-CID")), rendered.result),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
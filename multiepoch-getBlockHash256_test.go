@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockHash256(t *testing.T) {
+	result := json.RawMessage(`{"blockHeight":1,"blockTime":null}`)
+	got := blockHash256(1, "bafyreids2hw6eynl4vag3cdp535sxz6zp6tedhuv6xu3k3rze3fskqy4yy", result)
+	require.Equal(t, uint64(1), got.Slot)
+	require.Equal(t, len(result), got.Size)
+	require.Len(t, got.Hash, 64)
+	require.Equal(t, got, blockHash256(1, got.BlockCid, json.RawMessage(`{"blockHeight":1,"blockTime":null}`)))
+	// any difference in the rendering changes the hash.
+	require.NotEqual(t, got.Hash, blockHash256(1, got.BlockCid, json.RawMessage(`{"blockHeight":1, "blockTime":null}`)).Hash)
+}
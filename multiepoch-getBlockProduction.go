@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+type GetBlockProductionRequest struct {
+	// Identity (optional) restricts the results to this validator identity.
+	Identity *solana.PublicKey
+	// FirstSlot and LastSlot are the range of slots, inside of one epoch; without FirstSlot,
+	// the range is the most recent epoch.
+	FirstSlot *uint64
+	LastSlot  *uint64
+}
+
+func parseGetBlockProductionRequest(raw *json.RawMessage) (*GetBlockProductionRequest, error) {
+	out := &GetBlockProductionRequest{}
+	if raw == nil {
+		return out, nil
+	}
+	var params []*struct {
+		Identity string `json:"identity"`
+		Range    *struct {
+			FirstSlot *uint64 `json:"firstSlot"`
+			LastSlot  *uint64 `json:"lastSlot"`
+		} `json:"range"`
+	}
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) == 0 || params[0] == nil {
+		return out, nil
+	}
+	config := params[0]
+	if config.Identity != "" {
+		identity, err := solana.PublicKeyFromBase58(config.Identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity %q: %w", config.Identity, err)
+		}
+		out.Identity = &identity
+	}
+	if config.Range != nil {
+		if config.Range.FirstSlot == nil {
+			return nil, fmt.Errorf("range.firstSlot is required")
+		}
+		out.FirstSlot, out.LastSlot = config.Range.FirstSlot, config.Range.LastSlot
+		if out.LastSlot != nil && *out.LastSlot < *out.FirstSlot {
+			return nil, fmt.Errorf("lastSlot (%d) must not be before firstSlot (%d)", *out.LastSlot, *out.FirstSlot)
+		}
+		if out.LastSlot != nil && CalcEpochForSlot(*out.LastSlot) != CalcEpochForSlot(*out.FirstSlot) {
+			return nil, fmt.Errorf("the range must be inside of one epoch")
+		}
+	}
+	return out, nil
+}
+
+type BlockProductionRange struct {
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+}
+
+type GetBlockProductionResult struct {
+	// ByIdentity has the number of leader slots and of blocks produced of each validator identity.
+	ByIdentity map[string][2]uint64 `json:"byIdentity"`
+	Range      BlockProductionRange `json:"range"`
+	// StakeByIdentity (faithful extension) is the stake of the validators in the epoch,
+	// from its stake weights sidecar.
+	StakeByIdentity map[string]uint64 `json:"stakeByIdentity,omitempty"`
+}
+
+// blockProduction counts the leader slots of the range in the schedule, and the ones with a block
+// (the slots given by rangeBlocks, e.g. the Range of the slot-to-cid index).
+func blockProduction(
+	schedule *LeaderSchedule,
+	firstSlot uint64,
+	lastSlot uint64,
+	identity *solana.PublicKey,
+	rangeBlocks func(from, to uint64, fn func(slot uint64, c cid.Cid) error) error,
+) (map[string][2]uint64, error) {
+	counts := make(map[solana.PublicKey]*[2]uint64)
+	countOf := func(slot uint64) *[2]uint64 {
+		leader, ok := schedule.Leader(slot)
+		if !ok || (identity != nil && leader != *identity) {
+			return nil
+		}
+		count, ok := counts[leader]
+		if !ok {
+			count = new([2]uint64)
+			counts[leader] = count
+		}
+		return count
+	}
+	for slot := firstSlot; slot <= lastSlot; slot++ {
+		if count := countOf(slot); count != nil {
+			count[0]++
+		}
+	}
+	err := rangeBlocks(firstSlot, lastSlot, func(slot uint64, _ cid.Cid) error {
+		if count := countOf(slot); count != nil {
+			count[1]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][2]uint64, len(counts))
+	for leader, count := range counts {
+		out[leader.String()] = *count
+	}
+	return out, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getBlockProduction",
+		Summary: "Returns the leader slots and the blocks produced by the validators in a range of slots of an epoch.",
+		Params: []MethodParam{
+			configParam("identity, range and commitment"),
+		},
+		Cost:    MethodCostHeavy,
+		Handler: (*MultiEpoch).handleGetBlockProduction,
+	})
+}
+
+// handleGetBlockProduction answers from the leader schedule sidecar of the epoch of the range, and
+// the blocks of the archive; the range is restricted to the slots covered by the archive.
+func (multi *MultiEpoch) handleGetBlockProduction(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	// the commitment is only validated: all the slots in the archive are finalized.
+	if _, err := parseCommitmentConfig(req.Params, 0); err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	params, err := parseGetBlockProductionRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	var epochNumber uint64
+	if params.FirstSlot != nil {
+		epochNumber = CalcEpochForSlot(*params.FirstSlot)
+	} else {
+		epochNumber, err = multi.GetMostRecentAvailableEpochNumber()
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to get the most recent epoch: %w", err))
+		}
+	}
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
+	}
+	if !epochHandler.HasLeaderSchedule() {
+		return errInvalidParams(
+			fmt.Sprintf("Invalid slot range: leader schedule for epoch %d is unavailable", epochNumber),
+			fmt.Errorf("no leader schedule for epoch %d", epochNumber),
+		)
+	}
+	slotToCidIndex, err := epochHandler.getSlotToCidIndex()
+	if err != nil {
+		return errInternal(err)
+	}
+
+	firstSlot, lastSlot := CalcEpochLimits(epochNumber)
+	if params.FirstSlot != nil {
+		firstSlot = *params.FirstSlot
+	}
+	if params.LastSlot != nil {
+		lastSlot = *params.LastSlot
+	}
+	if coverage, ok := slotToCidIndex.Coverage(); ok {
+		firstSlot = max(firstSlot, coverage.FirstSlot)
+		lastSlot = min(lastSlot, coverage.LastSlot)
+	}
+	if firstSlot > lastSlot {
+		return errInvalidParams("Invalid params", fmt.Errorf("the range is outside of the slots of epoch %d in the archive", epochNumber))
+	}
+
+	byIdentity, err := blockProduction(epochHandler.leaderSchedule, firstSlot, lastSlot, params.Identity, func(from, to uint64, fn func(slot uint64, c cid.Cid) error) error {
+		return slotToCidIndex.Range(from, to, func(slot uint64, c cid.Cid) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(slot, c)
+		})
+	})
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to count the blocks produced: %w", err))
+	}
+	result := &GetBlockProductionResult{
+		ByIdentity: byIdentity,
+		Range:      BlockProductionRange{FirstSlot: firstSlot, LastSlot: lastSlot},
+	}
+	if stakeWeights := epochHandler.GetStakeWeights(); stakeWeights != nil && !conn.strict() {
+		result.StakeByIdentity = make(map[string]uint64)
+		for identity, stake := range stakeWeights {
+			if params.Identity == nil || identity == *params.Identity {
+				result.StakeByIdentity[identity.String()] = stake
+			}
+		}
+	}
+
+	var contextSlot uint64
+	if lastBlock, err := multi.GetMostRecentAvailableBlock(ctx); err == nil {
+		contextSlot = uint64(lastBlock.Slot)
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		map[string]any{
+			"context": map[string]any{
+				"slot": contextSlot,
+			},
+			"value": result,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
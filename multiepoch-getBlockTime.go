@@ -9,37 +9,40 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getBlockTime",
+		Summary: "Returns the estimated production time of the block of a slot.",
+		Params: []MethodParam{
+			uintParam("slot", "the slot of the block"),
+		},
+		CacheKey: cacheKeySlot,
+		Handler:  (*MultiEpoch).handleGetBlockTime,
+	})
+}
+
 func (multi *MultiEpoch) handleGetBlockTime(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
 	blockNum, err := parseGetBlockTimeRequest(req.Params)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: "Invalid params",
-		}, fmt.Errorf("failed to parse params: %w", err)
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
 	}
 
 	// find the epoch that contains the requested slot
 	epochNumber := CalcEpochForSlot(blockNum)
 	epochHandler, err := multi.GetEpoch(epochNumber)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    CodeNotFound,
-			Message: fmt.Sprintf("Epoch %d is not available", epochNumber),
-		}, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
 	}
 
 	block, _, err := epochHandler.GetBlock(WithSubrapghPrefetch(ctx, false), blockNum)
 	if err != nil {
 		if errors.Is(err, compactindexsized.ErrNotFound) {
-			return &jsonrpc2.Error{
-				Code:    CodeNotFound,
-				Message: fmt.Sprintf("Slot %d was skipped, or missing in long-term storage", blockNum),
-			}, err
+			if epochHandler.IsSlotSkipped(blockNum) {
+				return errSlotSkipped(blockNum, err)
+			}
+			return errSlotNotInArchive(blockNum, err)
 		} else {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Failed to get block",
-			}, fmt.Errorf("failed to get block: %w", err)
+			return errInternal(fmt.Errorf("failed to get block: %w", err))
 		}
 	}
 	blockTime := uint64(block.Meta.Blocktime)
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/klauspost/compress/zstd"
+	"github.com/multiformats/go-multihash"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetBlockRewards(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	// put puts the node in the cache, where the epoch reads it from.
+	put := func(v any, typ schema.Type) cid.Cid {
+		data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+		require.NoError(t, err)
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+		require.NoError(t, err)
+		require.NoError(t, cache.PutRawCarObject(c, data))
+		return c
+	}
+	entryCid := put(&ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	putBlock := func(slot uint64, rewardsCid cid.Cid) cid.Cid {
+		blockCid := put(&ipldbindcode.Block{
+			Kind:      int(iplddecoders.KindBlock),
+			Slot:      int(slot),
+			Shredding: ipldbindcode.List__Shredding{},
+			Entries:   ipldbindcode.List__Link{cidlink.Link{Cid: entryCid}},
+			Rewards:   cidlink.Link{Cid: rewardsCid},
+		}, ipldbindcode.Prototypes.Block.Type())
+		require.NoError(t, cache.PutSlotToCid(slot, blockCid))
+		require.NoError(t, cache.PutCidToOffsetAndSize(blockCid, &indexes.OffsetAndSize{Offset: 100, Size: 10}))
+		return blockCid
+	}
+
+	pubkeys := []string{
+		"Vote111111111111111111111111111111111111111",
+		"Stake11111111111111111111111111111111111111",
+		"Config1111111111111111111111111111111111111",
+	}
+	rewards := &confirmed_block.Rewards{}
+	for i, pubkey := range pubkeys {
+		rewards.Rewards = append(rewards.Rewards, &confirmed_block.Reward{
+			Pubkey:      pubkey,
+			Lamports:    int64(i + 1),
+			PostBalance: 1000,
+			RewardType:  confirmed_block.RewardType_Voting,
+		})
+	}
+	rewardsBuf, err := proto.Marshal(rewards)
+	require.NoError(t, err)
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	rewardsCid := put(&ipldbindcode.Rewards{
+		Kind: int(iplddecoders.KindRewards),
+		Slot: 10,
+		Data: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: encoder.EncodeAll(rewardsBuf, nil)},
+	}, ipldbindcode.Prototypes.Rewards.Type())
+	withRewards := putBlock(10, rewardsCid)
+	// the rewards of this block are not a Rewards node.
+	withBadRewards := putBlock(11, entryCid)
+
+	getBlock := func(multi *MultiEpoch, slot uint64, rewards bool) ([]string, error) {
+		params := json.RawMessage(fmt.Sprintf(`[%d, {"transactionDetails": "none", "rewards": %t}]`, slot, rewards))
+		conn := &requestContext{ctx: &fasthttp.RequestCtx{}}
+		rpcErr, err := multi.handleGetBlock(ctx, conn, &jsonrpc2.Request{Method: "getBlock", Params: &params})
+		if err != nil {
+			require.NotNil(t, rpcErr)
+			return nil, err
+		}
+		require.Nil(t, rpcErr)
+		var result struct {
+			Rewards []struct {
+				Pubkey string `json:"pubkey"`
+			} `json:"rewards"`
+		}
+		require.NoError(t, json.Unmarshal(conn.result, &result))
+		got := make([]string, 0)
+		for _, reward := range result.Rewards {
+			got = append(got, reward.Pubkey)
+		}
+		return got, nil
+	}
+
+	for _, withCache := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cache=%t", withCache), func(t *testing.T) {
+			newMultiEpoch := func() *MultiEpoch {
+				options := &Options{}
+				if withCache {
+					options.BlockAssemblyCache, err = NewBlockAssemblyCache(1)
+					require.NoError(t, err)
+				}
+				multi := NewMultiEpoch(options)
+				require.NoError(t, multi.AddEpoch(0, &Epoch{epoch: 0, config: &Config{}, allCache: cache}))
+				return multi
+			}
+
+			// a miss, with the rewards.
+			multi := newMultiEpoch()
+			got, err := getBlock(multi, 10, true)
+			require.NoError(t, err)
+			require.Equal(t, pubkeys, got)
+
+			// a miss without the rewards, then a hit without the rewards (that reads them), and a
+			// hit with them.
+			multi = newMultiEpoch()
+			got, err = getBlock(multi, 10, false)
+			require.NoError(t, err)
+			require.Empty(t, got)
+			require.Equal(t, withCache, multi.isBlockAssembled(withRewards, false))
+			require.False(t, multi.isBlockAssembled(withRewards, true))
+			for i := 0; i < 2; i++ {
+				got, err = getBlock(multi, 10, true)
+				require.NoError(t, err)
+				require.Equal(t, pubkeys, got)
+			}
+			require.Equal(t, withCache, multi.isBlockAssembled(withRewards, true))
+
+			// the rewards that can't be decoded fail the request, on a miss and on a hit
+			// without the rewards.
+			_, err = getBlock(multi, 11, true)
+			require.ErrorContains(t, err, "failed to decode Rewards")
+			_, err = getBlock(multi, 11, false)
+			require.NoError(t, err)
+			require.Equal(t, withCache, multi.isBlockAssembled(withBadRewards, false))
+			_, err = getBlock(multi, 11, true)
+			require.ErrorContains(t, err, "failed to decode Rewards")
+			require.False(t, multi.isBlockAssembled(withBadRewards, true))
+		})
+	}
+}
+
+func TestGetBlockSkipsUnreadableTransactions(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	sig := solana.Signature{1}
+	txBuf, err := (&solana.Transaction{
+		Signatures: []solana.Signature{sig},
+		Message: solana.Message{
+			AccountKeys:     []solana.PublicKey{{2}},
+			RecentBlockhash: solana.Hash{3},
+		},
+	}).MarshalBinary()
+	require.NoError(t, err)
+	readable, _ := cacheTestNode(t, cache, &ipldbindcode.Transaction{
+		Kind:     int(iplddecoders.KindTransaction),
+		Data:     ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: txBuf},
+		Metadata: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame)},
+		Slot:     10,
+	}, ipldbindcode.Prototypes.Transaction.Type())
+	// in the index, but the epoch has no CAR to read it from.
+	unreadable := DummyCID
+	require.NoError(t, cache.PutCidToOffsetAndSize(unreadable, &indexes.OffsetAndSize{Offset: 100, Size: 10}))
+	entryCid, _ := cacheTestNode(t, cache, &ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{cidlink.Link{Cid: unreadable}, cidlink.Link{Cid: readable}},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	blockCid, _ := cacheTestNode(t, cache, &ipldbindcode.Block{
+		Kind:      int(iplddecoders.KindBlock),
+		Slot:      10,
+		Shredding: ipldbindcode.List__Shredding{},
+		Entries:   ipldbindcode.List__Link{cidlink.Link{Cid: entryCid}},
+		Rewards:   cidlink.Link{Cid: DummyCID},
+	}, ipldbindcode.Prototypes.Block.Type())
+	require.NoError(t, cache.PutSlotToCid(10, blockCid))
+	require.NoError(t, cache.PutCidToOffsetAndSize(blockCid, &indexes.OffsetAndSize{Offset: 200, Size: 10}))
+
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(0, &Epoch{epoch: 0, config: &Config{}, allCache: cache}))
+	rpcErr, result := callTestMethod(t, multi, (*MultiEpoch).handleGetBlock, `[10, {"transactionDetails": "signatures", "rewards": false}]`)
+	require.Nil(t, rpcErr)
+	var block struct {
+		Signatures []string `json:"signatures"`
+	}
+	require.NoError(t, json.Unmarshal(result, &block))
+	// the transaction that can't be read is left out.
+	require.Equal(t, []string{sig.String()}, block.Signatures)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/ipfs/go-cid"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+type GetBlocksRequest struct {
+	StartSlot uint64
+	// EndSlot (optional) is the last slot of the range (inclusive).
+	EndSlot    *uint64
+	Commitment *rpc.CommitmentType
+}
+
+// parseGetBlocksRequest parses the params of getBlocks: [startSlot, endSlot, config], where
+// endSlot and config are optional, and the config can be in place of endSlot (like solana).
+func parseGetBlocksRequest(raw *json.RawMessage) (*GetBlocksRequest, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("params must be [startSlot, endSlot, config]")
+	}
+	var params []json.RawMessage
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 1 || len(params) > 3 {
+		return nil, fmt.Errorf("params must be [startSlot, endSlot, config], got %d arguments", len(params))
+	}
+	out := &GetBlocksRequest{}
+	if err := fasterJson.Unmarshal(params[0], &out.StartSlot); err != nil {
+		return nil, fmt.Errorf("startSlot must be an unsigned integer: %w", err)
+	}
+	var config json.RawMessage
+	if len(params) > 1 && string(params[1]) != "null" {
+		if params[1][0] == '{' {
+			config = params[1]
+		} else if err := fasterJson.Unmarshal(params[1], &out.EndSlot); err != nil {
+			return nil, fmt.Errorf("endSlot must be an unsigned integer: %w", err)
+		}
+	}
+	if len(params) > 2 && string(params[2]) != "null" {
+		if config != nil {
+			return nil, fmt.Errorf("the config must be given once")
+		}
+		config = params[2]
+	}
+	if config != nil {
+		var options struct {
+			Commitment any `json:"commitment"`
+		}
+		if err := fasterJson.Unmarshal(config, &options); err != nil {
+			return nil, fmt.Errorf("config must be an object: %w", err)
+		}
+		if options.Commitment != nil {
+			commitment, err := parseCommitment(options.Commitment)
+			if err != nil {
+				return nil, err
+			}
+			out.Commitment = &commitment
+		}
+	}
+	return out, nil
+}
+
+// errStopBlocks stops the iteration of the blocks of GetBlocks at its limit.
+var errStopBlocks = errors.New("stop")
+
+// GetBlocks returns the slots with a block in the archive from startSlot to endSlot (inclusive),
+// lowest first, up to limit of them (no limit if 0). The slots of the epochs that are not loaded
+// are left out.
+func (multi *MultiEpoch) GetBlocks(ctx context.Context, startSlot uint64, endSlot uint64, limit int) ([]uint64, error) {
+	slots := make([]uint64, 0)
+	if endSlot < startSlot {
+		return slots, nil
+	}
+	numbers := multi.GetEpochNumbers()
+	// oldest first.
+	for i := len(numbers) - 1; i >= 0; i-- {
+		epochNumber := numbers[i]
+		if epochNumber < CalcEpochForSlot(startSlot) || epochNumber > CalcEpochForSlot(endSlot) {
+			continue
+		}
+		epoch, err := multi.GetEpoch(epochNumber)
+		if err != nil {
+			continue
+		}
+		slotToCidIndex, err := epoch.getSlotToCidIndex()
+		if err != nil {
+			return nil, err
+		}
+		first, last := CalcEpochLimits(epochNumber)
+		first, last = max(first, startSlot), min(last, endSlot)
+		if coverage, ok := slotToCidIndex.Coverage(); ok {
+			first, last = max(first, coverage.FirstSlot), min(last, coverage.LastSlot)
+		}
+		if first > last {
+			continue
+		}
+		err = slotToCidIndex.Range(first, last, func(slot uint64, _ cid.Cid) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			slots = append(slots, slot)
+			if limit > 0 && len(slots) >= limit {
+				return errStopBlocks
+			}
+			return nil
+		})
+		if errors.Is(err, errStopBlocks) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the blocks of epoch %d: %w", epochNumber, err)
+		}
+	}
+	return slots, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getBlocks",
+		Summary: "Returns the slots with a block in the archive, in a range of slots.",
+		Params: []MethodParam{
+			uintParam("startSlot", "the first slot of the range"),
+			{Name: "endSlot", Summary: "the last slot of the range (inclusive); the most recent slot in the archive by default", Schema: map[string]any{"type": "integer", "minimum": 0}},
+			configParam("commitment"),
+		},
+		Cost:    MethodCostHeavy,
+		Handler: (*MultiEpoch).handleGetBlocks,
+	})
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getBlocksWithLimit",
+		Summary: "Returns the slots with a block in the archive, from a slot, up to a number of them.",
+		Params: []MethodParam{
+			uintParam("startSlot", "the first slot"),
+			uintParam("limit", "the max number of slots to return"),
+			configParam("commitment"),
+		},
+		Cost:    MethodCostHeavy,
+		Handler: (*MultiEpoch).handleGetBlocksWithLimit,
+	})
+}
+
+// handleGetBlocks lists the slots of the range from the slot-to-cid indexes of their epochs; like
+// solana, the range ends at the most recent slot in the archive, and has at most 500,000 slots.
+func (multi *MultiEpoch) handleGetBlocks(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetBlocksRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if err := checkIsAtLeastConfirmed(params.Commitment); err != nil {
+		return errInvalidParams(err.Error(), err)
+	}
+	endSlot := uint64(math.MaxUint64)
+	if params.StartSlot <= math.MaxUint64-maxGetBlocksRange {
+		endSlot = params.StartSlot + maxGetBlocksRange
+	}
+	if params.EndSlot != nil {
+		endSlot = *params.EndSlot
+	}
+	if lastBlock, err := multi.GetMostRecentAvailableBlock(ctx); err == nil {
+		endSlot = min(endSlot, uint64(lastBlock.Slot))
+	}
+	if endSlot >= params.StartSlot && endSlot-params.StartSlot > maxGetBlocksRange {
+		msg := fmt.Sprintf("Slot range too large; max %d", maxGetBlocksRange)
+		return errInvalidParams(msg, errors.New(msg))
+	}
+	slots, err := multi.GetBlocks(ctx, params.StartSlot, endSlot, 0)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get the blocks: %w", err))
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		slots,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
+
+type GetBlocksWithLimitRequest struct {
+	StartSlot  uint64
+	Limit      uint64
+	Commitment *rpc.CommitmentType
+}
+
+// parseGetBlocksWithLimitRequest parses the params of getBlocksWithLimit: [startSlot, limit, config].
+func parseGetBlocksWithLimitRequest(raw *json.RawMessage) (*GetBlocksWithLimitRequest, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("params must be [startSlot, limit, config]")
+	}
+	var params []json.RawMessage
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 2 || len(params) > 3 {
+		return nil, fmt.Errorf("params must be [startSlot, limit, config], got %d arguments", len(params))
+	}
+	out := &GetBlocksWithLimitRequest{}
+	if err := fasterJson.Unmarshal(params[0], &out.StartSlot); err != nil {
+		return nil, fmt.Errorf("startSlot must be an unsigned integer: %w", err)
+	}
+	if err := fasterJson.Unmarshal(params[1], &out.Limit); err != nil {
+		return nil, fmt.Errorf("limit must be an unsigned integer: %w", err)
+	}
+	commitment, err := parseCommitmentConfig(raw, 2)
+	if err != nil {
+		return nil, err
+	}
+	out.Commitment = commitment
+	return out, nil
+}
+
+// handleGetBlocksWithLimit lists the slots from the slot-to-cid indexes of their epochs, like
+// handleGetBlocks; like solana, the limit is at most 500,000, and the slots end at the most
+// recent slot in the archive.
+func (multi *MultiEpoch) handleGetBlocksWithLimit(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetBlocksWithLimitRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if err := checkIsAtLeastConfirmed(params.Commitment); err != nil {
+		return errInvalidParams(err.Error(), err)
+	}
+	if params.Limit > maxGetBlocksRange {
+		msg := fmt.Sprintf("Limit too large; max %d", maxGetBlocksRange)
+		return errInvalidParams(msg, errors.New(msg))
+	}
+	slots := make([]uint64, 0)
+	if params.Limit > 0 {
+		endSlot := uint64(math.MaxUint64)
+		if lastBlock, err := multi.GetMostRecentAvailableBlock(ctx); err == nil {
+			endSlot = uint64(lastBlock.Slot)
+		}
+		slots, err = multi.GetBlocks(ctx, params.StartSlot, endSlot, int(params.Limit))
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to get the blocks: %w", err))
+		}
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		slots,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
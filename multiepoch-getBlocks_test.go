@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetBlocksRequest(t *testing.T) {
+	raw := json.RawMessage(`[10]`)
+	req, err := parseGetBlocksRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, &GetBlocksRequest{StartSlot: 10}, req)
+
+	raw = json.RawMessage(`[10, 20, {"commitment": "confirmed"}]`)
+	req, err = parseGetBlocksRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), *req.EndSlot)
+	require.Equal(t, rpc.CommitmentConfirmed, *req.Commitment)
+
+	// the config can be in place of the end slot.
+	raw = json.RawMessage(`[10, {"commitment": "finalized"}]`)
+	req, err = parseGetBlocksRequest(&raw)
+	require.NoError(t, err)
+	require.Nil(t, req.EndSlot)
+	require.Equal(t, rpc.CommitmentFinalized, *req.Commitment)
+
+	for _, invalid := range []string{`[]`, `["10"]`, `[10, "20"]`, `[10, {}, {}]`, `[10, 20, {"commitment": "recent"}]`, `[1, 2, null, 4]`} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetBlocksRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestParseGetBlocksWithLimitRequest(t *testing.T) {
+	raw := json.RawMessage(`[10, 5, {"commitment": "finalized"}]`)
+	req, err := parseGetBlocksWithLimitRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), req.StartSlot)
+	require.Equal(t, uint64(5), req.Limit)
+	require.Equal(t, rpc.CommitmentFinalized, *req.Commitment)
+
+	for _, invalid := range []string{`[10]`, `[10, -1]`, `[10, "5"]`, `[10, 5, "finalized"]`, `[10, 5, {}, 1]`} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetBlocksWithLimitRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestGetBlocks(t *testing.T) {
+	rootCid := cid.MustParse("bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+	start, _ := CalcEpochLimits(1)
+	dir := t.TempDir()
+	writer, err := indexes.NewWriter_SlotToCid(1, rootCid, indexes.NetworkMainnet, dir, 4)
+	require.NoError(t, err)
+	for _, offset := range []uint64{10, 11, 13, 15} {
+		require.NoError(t, writer.Put(start+offset, rootCid))
+	}
+	require.NoError(t, writer.Seal(context.Background(), dir))
+	slotToCid, err := indexes.Open_SlotToCid(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+	require.NoError(t, err)
+	defer slotToCid.Close()
+
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(1, &Epoch{epoch: 1, config: &Config{}, slotToCidIndex: slotToCid}))
+
+	// from the end of epoch 0 (not loaded) to epoch 1.
+	slots, err := multi.GetBlocks(context.Background(), start-2, start+20, 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{start + 10, start + 11, start + 13, start + 15}, slots)
+
+	slots, err = multi.GetBlocks(context.Background(), start+11, start+14, 0)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{start + 11, start + 13}, slots)
+
+	slots, err = multi.GetBlocks(context.Background(), start, start+20, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{start + 10, start + 11}, slots)
+
+	// with a limit, up to the end of the archive.
+	slots, err = multi.GetBlocks(context.Background(), start+11, math.MaxUint64, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{start + 11, start + 13}, slots)
+
+	slots, err = multi.GetBlocks(context.Background(), start+20, start+10, 0)
+	require.NoError(t, err)
+	require.Empty(t, slots)
+}
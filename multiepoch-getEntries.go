@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// EntrySummary is a PoH entry of a block, without its transactions.
+type EntrySummary struct {
+	Index     int    `json:"index"`
+	Hash      string `json:"hash"`
+	NumHashes int    `json:"numHashes"`
+	// NumTransactions is the number of transactions of the entry (0 for a tick).
+	NumTransactions int `json:"numTransactions"`
+	// StartingTransactionIndex is the index, in the block, of the first transaction of the entry.
+	StartingTransactionIndex int `json:"startingTransactionIndex"`
+}
+
+type GetEntriesResponse struct {
+	Slot       uint64 `json:"slot"`
+	ParentSlot uint64 `json:"parentSlot"`
+	// Blockhash is the hash of the last entry of the block.
+	Blockhash       string         `json:"blockhash"`
+	NumHashes       int            `json:"numHashes"`
+	NumTransactions int            `json:"numTransactions"`
+	Entries         []EntrySummary `json:"entries"`
+}
+
+// summarizeEntries returns the summaries of the entries of the block (in order), and its blockhash.
+func summarizeEntries(slot uint64, parentSlot uint64, entryNodes []*ipldbindcode.Entry) *GetEntriesResponse {
+	resp := &GetEntriesResponse{
+		Slot:       slot,
+		ParentSlot: parentSlot,
+		Entries:    make([]EntrySummary, 0, len(entryNodes)),
+	}
+	for index, entryNode := range entryNodes {
+		hash := solana.HashFromBytes(entryNode.Hash)
+		resp.Entries = append(resp.Entries, EntrySummary{
+			Index:                    index,
+			Hash:                     hash.String(),
+			NumHashes:                entryNode.NumHashes,
+			NumTransactions:          len(entryNode.Transactions),
+			StartingTransactionIndex: resp.NumTransactions,
+		})
+		resp.NumHashes += entryNode.NumHashes
+		resp.NumTransactions += len(entryNode.Transactions)
+		resp.Blockhash = hash.String()
+	}
+	return resp
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getEntries",
+		Summary: "Returns the PoH entries of a block, without its transactions.",
+		Params: []MethodParam{
+			uintParam("slot", "the slot of the block"),
+		},
+		CacheKey: cacheKeySlot,
+		Handler:  (*MultiEpoch).handleGetEntries,
+	})
+}
+
+// handleGetEntries returns the PoH entries of a block (their hashes, hash counts and transaction
+// counts) without reading its transactions, for the PoH and timing research that would otherwise
+// need to fetch the full block.
+func (multi *MultiEpoch) handleGetEntries(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	slot, err := parseGetBlockTimeRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+
+	// find the epoch that contains the requested slot
+	epochNumber := CalcEpochForSlot(slot)
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
+	}
+
+	block, _, err := epochHandler.GetBlock(WithSubrapghPrefetch(ctx, false), slot)
+	if err != nil {
+		if errors.Is(err, compactindexsized.ErrNotFound) {
+			if epochHandler.IsSlotSkipped(slot) {
+				return errSlotSkipped(slot, err)
+			}
+			return errSlotNotInArchive(slot, err)
+		} else {
+			return errInternal(fmt.Errorf("failed to get block: %w", err))
+		}
+	}
+	entryCids := make([]cid.Cid, len(block.Entries))
+	for entryIndex, entry := range block.Entries {
+		entryCids[entryIndex] = entry.(cidlink.Link).Cid
+	}
+	entryNodes, err := epochHandler.GetEntriesByCids(ctx, entryCids)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get entries: %w", err))
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		summarizeEntries(slot, uint64(block.Meta.Parent_slot), entryNodes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeEntries(t *testing.T) {
+	txLink := cidlink.Link{Cid: cid.NewCidV1(cid.DagCBOR, []byte("tx"))}
+	entry := func(hash byte, numHashes int, numTransactions int) *ipldbindcode.Entry {
+		e := &ipldbindcode.Entry{
+			NumHashes: numHashes,
+			Hash:      make([]byte, 32),
+		}
+		e.Hash[0] = hash
+		for i := 0; i < numTransactions; i++ {
+			e.Transactions = append(e.Transactions, txLink)
+		}
+		return e
+	}
+	entries := []*ipldbindcode.Entry{
+		entry(1, 12500, 0),
+		entry(2, 300, 3),
+		entry(3, 1, 2),
+		entry(4, 12199, 0),
+	}
+	resp := summarizeEntries(100, 99, entries)
+	require.Equal(t, uint64(100), resp.Slot)
+	require.Equal(t, uint64(99), resp.ParentSlot)
+	require.Equal(t, 25000, resp.NumHashes)
+	require.Equal(t, 5, resp.NumTransactions)
+	require.Len(t, resp.Entries, 4)
+	require.Equal(t, solana.HashFromBytes(entries[3].Hash).String(), resp.Blockhash)
+	require.Equal(t, EntrySummary{
+		Index:                    2,
+		Hash:                     solana.HashFromBytes(entries[2].Hash).String(),
+		NumHashes:                1,
+		NumTransactions:          2,
+		StartingTransactionIndex: 3,
+	}, resp.Entries[2])
+
+	empty := summarizeEntries(100, 99, nil)
+	require.Empty(t, empty.Blockhash)
+	require.NotNil(t, empty.Entries)
+}
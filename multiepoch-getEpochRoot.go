@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+type GetEpochRootResponse struct {
+	Epoch   uint64               `json:"epoch"`
+	Cid     string               `json:"cid"`
+	Subsets []EpochSubsetSummary `json:"subsets"`
+}
+
+type EpochSubsetSummary struct {
+	Cid       string   `json:"cid"`
+	FirstSlot uint64   `json:"firstSlot"`
+	LastSlot  uint64   `json:"lastSlot"`
+	NumBlocks int      `json:"numBlocks"`
+	Blocks    []string `json:"blocks,omitempty"`
+}
+
+type GetEpochRootRequest struct {
+	Epoch uint64
+	// WithBlocks includes the CIDs of the blocks of each subset.
+	WithBlocks bool
+}
+
+func parseGetEpochRootRequest(raw *json.RawMessage) (*GetEpochRootRequest, error) {
+	var params []any
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 1 {
+		return nil, fmt.Errorf("params must have at least one argument")
+	}
+	epochRaw, ok := params[0].(float64)
+	if !ok {
+		return nil, fmt.Errorf("first argument must be a number, got %T", params[0])
+	}
+	out := &GetEpochRootRequest{
+		Epoch: uint64(epochRaw),
+	}
+	if len(params) > 1 {
+		optionsRaw, ok := params[1].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be an object, got %T", params[1])
+		}
+		if withBlocksRaw, ok := optionsRaw["withBlocks"]; ok {
+			withBlocks, ok := withBlocksRaw.(bool)
+			if !ok {
+				return nil, fmt.Errorf("withBlocks must be a boolean, got %T", withBlocksRaw)
+			}
+			out.WithBlocks = withBlocks
+		}
+	}
+	return out, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getEpochRoot",
+		Summary: "Returns the CID of the Epoch root node of the DAG of an epoch, and its subsets.",
+		Params: []MethodParam{
+			uintParam("epoch", "the epoch"),
+			configParam("withBlocks"),
+		},
+		Handler: (*MultiEpoch).handleGetEpochRoot,
+	})
+}
+
+// handleGetEpochRoot returns the root of the DAG for the requested epoch (the Epoch node),
+// and the summary of its subsets, so that clients can navigate (and verify) the DAG by CID.
+func (multi *MultiEpoch) handleGetEpochRoot(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetEpochRootRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+
+	epochHandler, err := multi.GetEpoch(params.Epoch)
+	if err != nil {
+		return errEpochNotAvailable(params.Epoch, fmt.Errorf("failed to get epoch %d: %w", params.Epoch, err))
+	}
+
+	epochNode, err := epochHandler.GetEpochNode(ctx)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get epoch node: %w", err))
+	}
+
+	resp := GetEpochRootResponse{
+		Epoch:   uint64(epochNode.Epoch),
+		Cid:     epochHandler.GetRootCid().String(),
+		Subsets: make([]EpochSubsetSummary, 0, len(epochNode.Subsets)),
+	}
+	for _, subsetLink := range epochNode.Subsets {
+		subsetCid := subsetLink.(cidlink.Link).Cid
+		subset, err := epochHandler.GetSubsetByCid(ctx, subsetCid)
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to get subset: %w", err))
+		}
+		summary := EpochSubsetSummary{
+			Cid:       subsetCid.String(),
+			FirstSlot: uint64(subset.First),
+			LastSlot:  uint64(subset.Last),
+			NumBlocks: len(subset.Blocks),
+		}
+		if params.WithBlocks {
+			summary.Blocks = make([]string, 0, len(subset.Blocks))
+			for _, blockLink := range subset.Blocks {
+				summary.Blocks = append(summary.Blocks, blockLink.(cidlink.Link).Cid.String())
+			}
+		}
+		resp.Subsets = append(resp.Subsets, summary)
+	}
+
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		resp,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
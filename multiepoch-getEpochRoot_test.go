@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetEpochRootRequest(t *testing.T) {
+	raw := json.RawMessage(`[5]`)
+	req, err := parseGetEpochRootRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, &GetEpochRootRequest{Epoch: 5}, req)
+
+	raw = json.RawMessage(`[5, {"withBlocks": true}]`)
+	req, err = parseGetEpochRootRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, &GetEpochRootRequest{Epoch: 5, WithBlocks: true}, req)
+
+	for _, invalid := range []string{`[]`, `["5"]`, `[5, true]`, `[5, {"withBlocks": 1}]`, `{}`} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetEpochRootRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestGetEpochRoot(t *testing.T) {
+	cache, err := hugecache.NewWithConfig(context.Background(), bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	blocks := make(ipldbindcode.List__Link, 0)
+	for _, slot := range []int{10, 12} {
+		blockCid, _ := cacheTestNode(t, cache, &ipldbindcode.Block{
+			Kind:      int(iplddecoders.KindBlock),
+			Slot:      slot,
+			Shredding: ipldbindcode.List__Shredding{},
+			Entries:   ipldbindcode.List__Link{},
+			Rewards:   cidlink.Link{Cid: DummyCID},
+		}, ipldbindcode.Prototypes.Block.Type())
+		blocks = append(blocks, cidlink.Link{Cid: blockCid})
+	}
+	subsetCid, _ := cacheTestNode(t, cache, &ipldbindcode.Subset{
+		Kind:   int(iplddecoders.KindSubset),
+		First:  10,
+		Last:   12,
+		Blocks: blocks,
+	}, ipldbindcode.Prototypes.Subset.Type())
+	rootCid, _ := cacheTestNode(t, cache, &ipldbindcode.Epoch{
+		Kind:    int(iplddecoders.KindEpoch),
+		Epoch:   0,
+		Subsets: ipldbindcode.List__Link{cidlink.Link{Cid: subsetCid}},
+	}, ipldbindcode.Prototypes.Epoch.Type())
+
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(0, &Epoch{epoch: 0, config: &Config{}, allCache: cache, rootCid: rootCid}))
+	getEpochRoot := func(params string) (*jsonrpc2.Error, *GetEpochRootResponse) {
+		rpcErr, result := callTestMethod(t, multi, (*MultiEpoch).handleGetEpochRoot, params)
+		if rpcErr != nil {
+			return rpcErr, nil
+		}
+		var resp GetEpochRootResponse
+		require.NoError(t, json.Unmarshal(result, &resp))
+		return nil, &resp
+	}
+
+	rpcErr, resp := getEpochRoot(`[0]`)
+	require.Nil(t, rpcErr)
+	require.Equal(t, &GetEpochRootResponse{
+		Epoch: 0,
+		Cid:   rootCid.String(),
+		Subsets: []EpochSubsetSummary{
+			{Cid: subsetCid.String(), FirstSlot: 10, LastSlot: 12, NumBlocks: 2},
+		},
+	}, resp)
+
+	rpcErr, resp = getEpochRoot(`[0, {"withBlocks": true}]`)
+	require.Nil(t, rpcErr)
+	require.Len(t, resp.Subsets, 1)
+	require.Equal(t, []string{blocks[0].(cidlink.Link).Cid.String(), blocks[1].(cidlink.Link).Cid.String()}, resp.Subsets[0].Blocks)
+
+	rpcErr, _ = getEpochRoot(`[1]`)
+	require.Equal(t, int64(CodeNotFound), rpcErr.Code)
+	rpcErr, _ = getEpochRoot(`["0"]`)
+	require.Equal(t, int64(jsonrpc2.CodeInvalidParams), rpcErr.Code)
+}
@@ -7,6 +7,14 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getFirstAvailableBlock",
+		Summary: "Returns the first slot with a block in the archive.",
+		Handler: (*MultiEpoch).handleGetFirstAvailableBlock,
+	})
+}
+
 func (multi *MultiEpoch) handleGetFirstAvailableBlock(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
 	firstBlock, err := multi.GetFirstAvailableBlock(ctx)
 	if err != nil {
@@ -7,16 +7,21 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getGenesisHash",
+		Summary: "Returns the genesis hash (with epoch 0).",
+		Handler: (*MultiEpoch).handleGetGenesisHash,
+	})
+}
+
 func (multi *MultiEpoch) handleGetGenesisHash(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
 	// Epoch 0 contains the genesis config.
 	epochNumber := uint64(0)
 	epochHandler, err := multi.GetEpoch(epochNumber)
 	if err != nil {
 		// If epoch 0 is not available, then the genesis config is not available.
-		return &jsonrpc2.Error{
-			Code:    CodeNotFound,
-			Message: fmt.Sprintf("Epoch %d is not available", epochNumber),
-		}, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
 	}
 
 	genesis := epochHandler.GetGenesis()
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// maxRawNodeSize is the maximum size of a node that can be fetched via faithful_getRawNode.
+const maxRawNodeSize = 8 * 1024 * 1024
+
+type GetRawNodeRequest struct {
+	Cid cid.Cid
+	// Epoch is an optional hint about the epoch that contains the node;
+	// if not provided, all the epochs are searched.
+	Epoch *uint64
+}
+
+type GetRawNodeResponse struct {
+	Cid   string `json:"cid"`
+	Epoch uint64 `json:"epoch"`
+	Kind  string `json:"kind,omitempty"`
+	Size  int    `json:"size"`
+	Data  string `json:"data"` // base64
+}
+
+func parseGetRawNodeRequest(raw *json.RawMessage) (*GetRawNodeRequest, error) {
+	var params []any
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 1 {
+		return nil, fmt.Errorf("params must have at least one argument")
+	}
+	cidRaw, ok := params[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("first argument must be a string, got %T", params[0])
+	}
+	parsed, err := cid.Parse(cidRaw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CID %q: %w", cidRaw, err)
+	}
+	out := &GetRawNodeRequest{
+		Cid: parsed,
+	}
+	if len(params) > 1 {
+		optionsRaw, ok := params[1].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("second argument must be an object, got %T", params[1])
+		}
+		if epochRaw, ok := optionsRaw["epoch"]; ok {
+			epoch, ok := epochRaw.(float64)
+			if !ok {
+				return nil, fmt.Errorf("epoch must be a number, got %T", epochRaw)
+			}
+			epochNumber := uint64(epoch)
+			out.Epoch = &epochNumber
+		}
+	}
+	return out, nil
+}
+
+// findEpochNumberFromCid returns the number of the epoch whose CAR contains the given CID.
+// Only the epochs that have a CID-to-offset index are searched.
+func (multi *MultiEpoch) findEpochNumberFromCid(ctx context.Context, c cid.Cid) (uint64, error) {
+	numbers := multi.GetEpochNumbers()
+	wg := NewFirstResponse(ctx, multi.options.EpochSearchConcurrency)
+	for i := range numbers {
+		epochNumber := numbers[i]
+		wg.Spawn(func() (any, error) {
+			epoch, err := multi.GetEpoch(epochNumber)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
+			}
+			if epoch.IsFilecoinMode() {
+				return nil, nil
+			}
+			if _, err := epoch.FindOffsetAndSizeFromCid(ctx, c); err == nil {
+				return epochNumber, nil
+			}
+			// Not found in this epoch.
+			return nil, nil
+		})
+	}
+	switch result := wg.Wait().(type) {
+	case nil:
+		// All epochs were searched, but the CID was not found.
+		return 0, ErrNotFound
+	case error:
+		// An error occurred while searching one of the epochs.
+		return 0, result
+	case uint64:
+		// The CID was found in one of the epochs.
+		return result, nil
+	default:
+		return 0, fmt.Errorf("unexpected result: (%T) %v", result, result)
+	}
+}
+
+// getRawNode returns the raw bytes of the node with the given CID, refusing nodes bigger than maxSize.
+func (ser *Epoch) getRawNode(ctx context.Context, c cid.Cid, maxSize uint64) ([]byte, error) {
+	if !ser.IsFilecoinMode() {
+		oas, err := ser.FindOffsetAndSizeFromCid(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find offset for CID %s: %w", c, err)
+		}
+		if oas.Size > maxSize {
+			return nil, fmt.Errorf("node %s is too large: %d bytes (max %d)", c, oas.Size, maxSize)
+		}
+	}
+	data, err := ser.GetNodeByCid(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) > maxSize {
+		return nil, fmt.Errorf("node %s is too large: %d bytes (max %d)", c, len(data), maxSize)
+	}
+	return data, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getRawNode",
+		Summary: "Returns the base64-encoded bytes of a node of the DAG.",
+		Params: []MethodParam{
+			stringParam("cid", "the CID of the node"),
+			configParam("epoch (a hint of the epoch of the node)"),
+		},
+		Handler: (*MultiEpoch).handleGetRawNode,
+	})
+}
+
+func (multi *MultiEpoch) handleGetRawNode(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetRawNodeRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+
+	var epochNumber uint64
+	if params.Epoch != nil {
+		epochNumber = *params.Epoch
+	} else {
+		epochNumber, err = multi.findEpochNumberFromCid(ctx, params.Cid)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return errNodeNotFound("Node not found", fmt.Errorf("failed to find epoch for CID %s: %w", params.Cid, err))
+			}
+			return errInternal(fmt.Errorf("failed to find epoch for CID %s: %w", params.Cid, err))
+		}
+	}
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		return errEpochNotAvailable(epochNumber, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err))
+	}
+
+	data, err := epochHandler.getRawNode(ctx, params.Cid, maxRawNodeSize)
+	if err != nil {
+		return errNodeNotFound("Node not found, or too large", fmt.Errorf("failed to get node %s: %w", params.Cid, err))
+	}
+
+	conn.ctx.Response.Header.Set("DAG-Root-CID", params.Cid.String())
+
+	resp := GetRawNodeResponse{
+		Cid:   params.Cid.String(),
+		Epoch: epochNumber,
+		Size:  len(data),
+		Data:  base64.StdEncoding.EncodeToString(data),
+	}
+	if kind, err := iplddecoders.GetKind(data); err == nil && kind.IsKnown() {
+		resp.Kind = kind.String()
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		resp,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
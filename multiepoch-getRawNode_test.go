@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetRawNodeRequest(t *testing.T) {
+	raw := json.RawMessage(fmt.Sprintf(`[%q]`, DummyCID))
+	req, err := parseGetRawNodeRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, DummyCID, req.Cid)
+	require.Nil(t, req.Epoch)
+
+	raw = json.RawMessage(fmt.Sprintf(`[%q, {"epoch": 3}]`, DummyCID))
+	req, err = parseGetRawNodeRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), *req.Epoch)
+
+	for _, invalid := range []string{`[]`, `[1]`, `["not-a-cid"]`, fmt.Sprintf(`[%q, 3]`, DummyCID), fmt.Sprintf(`[%q, {"epoch": "3"}]`, DummyCID)} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetRawNodeRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestGetRawNode(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+	entryCid, entryData := cacheTestNode(t, cache, &ipldbindcode.Entry{
+		Kind:         int(iplddecoders.KindEntry),
+		Hash:         make([]byte, 32),
+		Transactions: ipldbindcode.List__Link{},
+	}, ipldbindcode.Prototypes.Entry.Type())
+	// a node too large to be returned, that is never read.
+	largeCid, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum([]byte("large"))
+	require.NoError(t, err)
+	missingCid, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum([]byte("missing"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	writer, err := indexes.NewWriter_CidToOffsetAndSize(0, DummyCID, indexes.NetworkMainnet, dir, 2)
+	require.NoError(t, err)
+	require.NoError(t, writer.Put(entryCid, 100, uint64(len(entryData))))
+	require.NoError(t, writer.Put(largeCid, 200, maxRawNodeSize+1))
+	require.NoError(t, writer.Seal(ctx, dir))
+	cidToOffsetAndSize, err := indexes.Open_CidToOffsetAndSize(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+	require.NoError(t, err)
+	defer cidToOffsetAndSize.Close()
+
+	multi := NewMultiEpoch(&Options{})
+	epoch := &Epoch{epoch: 0, config: &Config{}, allCache: cache, cidToOffsetAndSizeIndex: cidToOffsetAndSize}
+	require.NoError(t, multi.AddEpoch(0, epoch))
+	getRawNode := func(params string) (*jsonrpc2.Error, *GetRawNodeResponse) {
+		rpcErr, result := callTestMethod(t, multi, (*MultiEpoch).handleGetRawNode, params)
+		if rpcErr != nil {
+			return rpcErr, nil
+		}
+		var resp GetRawNodeResponse
+		require.NoError(t, json.Unmarshal(result, &resp))
+		return nil, &resp
+	}
+
+	// with and without the epoch hint.
+	for _, params := range []string{fmt.Sprintf(`[%q]`, entryCid), fmt.Sprintf(`[%q, {"epoch": 0}]`, entryCid)} {
+		rpcErr, resp := getRawNode(params)
+		require.Nil(t, rpcErr, params)
+		require.Equal(t, &GetRawNodeResponse{
+			Cid:   entryCid.String(),
+			Epoch: 0,
+			Kind:  "Entry",
+			Size:  len(entryData),
+			Data:  base64.StdEncoding.EncodeToString(entryData),
+		}, resp)
+	}
+
+	rpcErr, _ := getRawNode(fmt.Sprintf(`[%q]`, largeCid))
+	require.Equal(t, int64(CodeNotFound), rpcErr.Code)
+	require.Equal(t, "Node not found, or too large", rpcErr.Message)
+	_, err = epoch.getRawNode(ctx, entryCid, uint64(len(entryData)-1))
+	require.ErrorContains(t, err, "too large")
+
+	rpcErr, _ = getRawNode(fmt.Sprintf(`[%q]`, missingCid))
+	require.Equal(t, int64(CodeNotFound), rpcErr.Code)
+	require.Equal(t, "Node not found", rpcErr.Message)
+
+	rpcErr, _ = getRawNode(fmt.Sprintf(`[%q, {"epoch": 7}]`, entryCid))
+	require.Equal(t, int64(CodeNotFound), rpcErr.Code)
+	require.Equal(t, "Epoch 7 is not available", rpcErr.Message)
+
+	rpcErr, _ = getRawNode(`["not-a-cid"]`)
+	require.Equal(t, int64(jsonrpc2.CodeInvalidParams), rpcErr.Code)
+}
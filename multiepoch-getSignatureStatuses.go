@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/logging"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// maxSignaturesPerGetSignatureStatuses is the maximum number of signatures in a getSignatureStatuses call (same as solana).
+const maxSignaturesPerGetSignatureStatuses = 256
+
+type GetSignatureStatusesRequest struct {
+	Signatures []solana.Signature
+}
+
+// Validate validates the request.
+func (req *GetSignatureStatusesRequest) Validate() error {
+	if len(req.Signatures) == 0 {
+		return fmt.Errorf("at least one signature is required")
+	}
+	if len(req.Signatures) > maxSignaturesPerGetSignatureStatuses {
+		return fmt.Errorf("too many signatures: %d (max %d)", len(req.Signatures), maxSignaturesPerGetSignatureStatuses)
+	}
+	for i, sig := range req.Signatures {
+		if sig.IsZero() {
+			return fmt.Errorf("signature #%d is zero", i)
+		}
+	}
+	return nil
+}
+
+// parseGetSignatureStatusesRequest parses the params of getSignatureStatuses; the options
+// (searchTransactionHistory) are ignored, because the whole history is always searched.
+func parseGetSignatureStatusesRequest(raw *json.RawMessage) (*GetSignatureStatusesRequest, error) {
+	var params []any
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 1 {
+		return nil, fmt.Errorf("params must have at least one argument")
+	}
+	sigsRaw, ok := params[0].([]any)
+	if !ok {
+		return nil, fmt.Errorf("first argument must be an array of signatures, got %T", params[0])
+	}
+	out := &GetSignatureStatusesRequest{
+		Signatures: make([]solana.Signature, 0, len(sigsRaw)),
+	}
+	for i, sigRaw := range sigsRaw {
+		sigString, ok := sigRaw.(string)
+		if !ok {
+			return nil, fmt.Errorf("signature #%d must be a string, got %T", i, sigRaw)
+		}
+		sig, err := solana.SignatureFromBase58(sigString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signature #%d from base58: %w", i, err)
+		}
+		out.Signatures = append(out.Signatures, sig)
+	}
+	return out, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getSignatureStatuses",
+		Summary: "Returns the statuses of transactions by their signatures.",
+		Params: []MethodParam{
+			{Name: "signatures", Summary: "the base58 signatures of the transactions", Required: true, Schema: map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+			configParam("searchTransactionHistory"),
+		},
+		Handler: (*MultiEpoch).handleGetSignatureStatuses,
+	})
+}
+
+// handleGetSignatureStatuses returns the status of each requested transaction (in the requested order),
+// or null for the transactions that are not in the archive.
+func (multi *MultiEpoch) handleGetSignatureStatuses(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	if multi.CountEpochs() == 0 {
+		return errInternal(fmt.Errorf("no epochs available"))
+	}
+
+	params, err := parseGetSignatureStatusesRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if err := params.Validate(); err != nil {
+		return errInvalidParams(err.Error(), fmt.Errorf("failed to validate params: %w", err))
+	}
+
+	statuses := make([]any, len(params.Signatures))
+	wg, _ := dagFetchPool.Group(ctx)
+	for i, sig := range params.Signatures {
+		i, sig := i, sig
+		wg.Go(func() error {
+			status, err := multi.getSignatureStatus(ctx, sig)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) || errors.Is(err, compactindexsized.ErrNotFound) {
+					return nil
+				}
+				return err
+			}
+			statuses[i] = status
+			return nil
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return errInternal(fmt.Errorf("failed to get signature statuses: %w", err))
+	}
+
+	var contextSlot uint64
+	if lastBlock, err := multi.GetMostRecentAvailableBlock(ctx); err == nil {
+		contextSlot = uint64(lastBlock.Slot)
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		map[string]any{
+			"context": map[string]any{
+				"slot": contextSlot,
+			},
+			"value": statuses,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
+
+// getSignatureStatus returns the status of the transaction, in the getSignatureStatuses format.
+func (multi *MultiEpoch) getSignatureStatus(ctx context.Context, sig solana.Signature) (map[string]any, error) {
+	epochNumber, err := multi.findEpochNumberFromSignature(ctx, sig, nil)
+	if err != nil {
+		return nil, err
+	}
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get handler for epoch %d: %w", epochNumber, err)
+	}
+	transactionNode, _, err := epochHandler.GetTransaction(ctx, sig)
+	if err != nil {
+		return nil, err
+	}
+	_, meta, err := parseTransactionAndMetaFromNode(ctx, transactionNode, epochHandler.GetDataFrameByCid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode transaction %s: %w", sig, err)
+	}
+	txErr, err := transactionErrorFromMeta(meta)
+	if err != nil {
+		rpcLog.Ctx(ctx).Error("failed to parse transaction error", logging.Signature(sig), logging.Err(err))
+	}
+	status := map[string]any{"Ok": nil}
+	if txErr != nil {
+		status = map[string]any{"Err": txErr}
+	}
+	return map[string]any{
+		"slot":               uint64(transactionNode.Slot),
+		"confirmations":      nil,
+		"err":                txErr,
+		"status":             status,
+		"confirmationStatus": "finalized",
+	}, nil
+}
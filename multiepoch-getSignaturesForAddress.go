@@ -2,19 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"runtime"
 	"sort"
 	"sync"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/rpcpool/yellowstone-faithful/gsfa"
-	metalatest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-latest"
-	metaoldest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-oldest"
-	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	"github.com/sourcegraph/jsonrpc2"
-	"golang.org/x/sync/errgroup"
-	"k8s.io/klog/v2"
 )
 
 // getGsfaReadersInEpochDescendingOrder returns a list of gsfa readers in epoch order (from most recent to oldest).
@@ -52,6 +48,19 @@ func countSignatures(v map[uint64][]solana.Signature) int {
 	return count
 }
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getSignaturesForAddress",
+		Summary: "Returns the signatures of the transactions that involve an address, newest first.",
+		Params: []MethodParam{
+			stringParam("address", "the base58 address"),
+			configParam("limit, before, until and commitment"),
+		},
+		Cost:    MethodCostHeavy,
+		Handler: (*MultiEpoch).handleGetSignaturesForAddress,
+	})
+}
+
 func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
 	// - parse and validate request
 	// - get list of epochs (from most recent to oldest)
@@ -61,32 +70,26 @@ func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn
 
 	params, err := parseGetSignaturesForAddressParams(req.Params)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: "Invalid params",
-		}, fmt.Errorf("failed to parse params: %v", err)
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if err := checkIsAtLeastConfirmed(params.Commitment); err != nil {
+		return errInvalidParams(err.Error(), err)
 	}
 	pk := params.Address
 	limit := params.Limit
 
 	gsfaIndexes, _ := multi.getGsfaReadersInEpochDescendingOrder()
 	if len(gsfaIndexes) == 0 {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "getSignaturesForAddress method is not enabled",
-		}, fmt.Errorf("no gsfa indexes found")
+		return errMethodDisabled("getSignaturesForAddress", fmt.Errorf("no gsfa indexes found"))
 	}
 
 	gsfaMulti, err := gsfa.NewGsfaReaderMultiepoch(gsfaIndexes)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "Internal error",
-		}, fmt.Errorf("failed to create gsfa multiepoch reader: %w", err)
+		return errInternal(fmt.Errorf("failed to create gsfa multiepoch reader: %w", err))
 	}
 
-	// Get the signatures:
-	foundSignatures, err := gsfaMulti.GetBeforeUntil(
+	// Get the signatures (and the memos, if the indexes have them):
+	foundSignatures, foundInfos, err := gsfaMulti.GetBeforeUntilWithInfo(
 		ctx,
 		pk,
 		limit,
@@ -94,10 +97,7 @@ func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn
 		params.Until,
 	)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "Internal error",
-		}, fmt.Errorf("failed to get signatures: %w", err)
+		return errInternal(fmt.Errorf("failed to get signatures: %w", err))
 	}
 
 	if len(foundSignatures) == 0 {
@@ -125,15 +125,14 @@ func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn
 		}
 		block, _, err := ser.GetBlock(ctx, slot)
 		if err != nil {
-			klog.Errorf("failed to get block time for slot %d: %v", slot, err)
+			rpcLog.Ctx(ctx).Error("failed to get block time", logging.Slot(slot), logging.Err(err))
 			return 0
 		}
 		blockTimeCache.m[slot] = uint64(block.Meta.Blocktime)
 		return uint64(block.Meta.Blocktime)
 	}
 
-	wg := new(errgroup.Group)
-	wg.SetLimit(runtime.NumCPU() * 2)
+	wg, _ := dagFetchPool.Group(ctx)
 	// The response is an array of objects: [{signature: string}]
 	response := make([]map[string]any, countSignatures(foundSignatures))
 	numBefore := 0
@@ -141,48 +140,59 @@ func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn
 		epoch := ei
 		ser, err := multi.GetEpoch(epoch)
 		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to get epoch %d: %w", epoch, err)
+			return errInternal(fmt.Errorf("failed to get epoch %d: %w", epoch, err))
 		}
 
 		sigs := foundSignatures[ei]
+		infos := foundInfos[ei]
 		for i := range sigs {
 			ii := numBefore + i
 			sig := sigs[i]
+			info := infos[i]
 			wg.Go(func() error {
 				response[ii] = map[string]any{
 					"signature": sig.String(),
 				}
+				if info != nil {
+					if info.Memo != nil {
+						response[ii]["memo"] = string(info.Memo)
+					} else {
+						response[ii]["memo"] = nil
+					}
+					if info.HasStatus {
+						if info.Err != nil {
+							response[ii]["err"] = json.RawMessage(info.Err)
+						} else {
+							response[ii]["err"] = nil
+						}
+						response[ii]["confirmationStatus"] = "finalized"
+					}
+				}
 				if signaturesOnly {
 					return nil
 				}
 				transactionNode, _, err := ser.GetTransaction(ctx, sig)
 				if err != nil {
-					klog.Errorf("failed to get tx %s: %v", sig, err)
+					rpcLog.Ctx(ctx).Error("failed to get transaction", logging.Signature(sig), logging.Err(err))
 					return nil
 				}
 				if transactionNode != nil {
 					{
-						tx, meta, err := parseTransactionAndMetaFromNode(transactionNode, ser.GetDataFrameByCid)
+						tx, meta, err := parseTransactionAndMetaFromNode(ctx, transactionNode, ser.GetDataFrameByCid)
 						if err == nil {
-							switch metaValue := meta.(type) {
-							case *confirmed_block.TransactionStatusMeta:
-								response[ii]["err"] = metaValue.Err
-							case *metalatest.TransactionStatusMeta:
-								response[ii]["err"] = metaValue.Status
-							case *metaoldest.TransactionStatusMeta:
-								response[ii]["err"] = metaValue.Status
-							}
-
-							if _, ok := response[ii]["err"]; ok {
-								response[ii]["err"], _ = parseTransactionError(response[ii]["err"])
+							if info == nil || !info.HasStatus {
+								txErr, err := transactionErrorFromMeta(meta)
+								if err != nil {
+									rpcLog.Ctx(ctx).Error("failed to parse transaction error", logging.Signature(sig), logging.Err(err))
+								}
+								response[ii]["err"] = txErr
 							}
 
-							memoData := getMemoInstructionDataFromTransaction(&tx)
-							if memoData != nil {
-								response[ii]["memo"] = string(memoData)
+							if info == nil {
+								memo := formatMemosFromTransaction(&tx)
+								if memo != nil {
+									response[ii]["memo"] = string(memo)
+								}
 							}
 						}
 
@@ -208,10 +218,7 @@ func (multi *MultiEpoch) handleGetSignaturesForAddress(ctx context.Context, conn
 		numBefore += len(sigs)
 	}
 	if err := wg.Wait(); err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "Internal error",
-		}, fmt.Errorf("failed to get tx data: %w", err)
+		return errInternal(fmt.Errorf("failed to get tx data: %w", err))
 	}
 
 	// reply with the data
@@ -7,8 +7,22 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 )
 
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getSlot",
+		Summary: "Returns the most recent slot with a block in the archive.",
+		Params: []MethodParam{
+			configParam("commitment"),
+		},
+		Handler: (*MultiEpoch).handleGetSlot,
+	})
+}
+
 func (multi *MultiEpoch) handleGetSlot(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
-	// TODO: parse params?
+	// the commitment is only validated: all the slots in the archive are finalized.
+	if _, err := parseCommitmentConfig(req.Params, 0); err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
 	lastBlock, err := multi.GetMostRecentAvailableBlock(ctx)
 	if err != nil {
 		return &jsonrpc2.Error{
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// maxSlotCoverageRange is the largest range of slots of a faithful_getSlotCoverage request;
+// every slot in the covered range of an epoch is looked up in its slot-to-cid index.
+const maxSlotCoverageRange = 100_000
+
+// The statuses of the slots of faithful_getSlotCoverage.
+const (
+	// SlotStatusPresent is a slot whose block is in the archive.
+	SlotStatusPresent = "present"
+	// SlotStatusSkipped is a slot without block, in the range covered by the archive: it was skipped.
+	SlotStatusSkipped = "skipped"
+	// SlotStatusMissing is a slot that is not in the archive (its epoch is not loaded, or it's outside
+	// of the range covered by its epoch); it may or may not have a block.
+	SlotStatusMissing = "missing"
+)
+
+// SlotRun is a range of consecutive slots with the same status.
+type SlotRun struct {
+	Status string `json:"status"`
+	First  uint64 `json:"first"`
+	Last   uint64 `json:"last"`
+}
+
+type GetSlotCoverageResponse struct {
+	From uint64    `json:"from"`
+	To   uint64    `json:"to"`
+	Runs []SlotRun `json:"runs"`
+	// The number of slots of each status.
+	NumPresent uint64 `json:"numPresent"`
+	NumSkipped uint64 `json:"numSkipped"`
+	NumMissing uint64 `json:"numMissing"`
+}
+
+// add adds the slots from first to last (after the previous ones), merged with the previous run if it has the same status.
+func (r *GetSlotCoverageResponse) add(status string, first uint64, last uint64) {
+	switch status {
+	case SlotStatusPresent:
+		r.NumPresent += last - first + 1
+	case SlotStatusSkipped:
+		r.NumSkipped += last - first + 1
+	default:
+		r.NumMissing += last - first + 1
+	}
+	if n := len(r.Runs); n > 0 && r.Runs[n-1].Status == status && r.Runs[n-1].Last+1 == first {
+		r.Runs[n-1].Last = last
+		return
+	}
+	r.Runs = append(r.Runs, SlotRun{Status: status, First: first, Last: last})
+}
+
+type GetSlotCoverageRequest struct {
+	From uint64
+	To   uint64
+}
+
+func parseGetSlotCoverageRequest(raw *json.RawMessage) (*GetSlotCoverageRequest, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("params must be [from, to]")
+	}
+	var params []uint64
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("params must be [from, to]: %w", err)
+	}
+	if len(params) != 2 {
+		return nil, fmt.Errorf("params must be [from, to], got %d arguments", len(params))
+	}
+	out := &GetSlotCoverageRequest{From: params[0], To: params[1]}
+	if out.From > out.To {
+		return nil, fmt.Errorf("from (%d) must not be after to (%d)", out.From, out.To)
+	}
+	if out.To-out.From >= maxSlotCoverageRange {
+		return nil, fmt.Errorf("the range must have at most %d slots", maxSlotCoverageRange)
+	}
+	return out, nil
+}
+
+// GetSlotCoverage returns the status of the slots from `from` to `to` (inclusive), as runs
+// of consecutive slots with the same status.
+func (multi *MultiEpoch) GetSlotCoverage(ctx context.Context, from uint64, to uint64) (*GetSlotCoverageResponse, error) {
+	resp := &GetSlotCoverageResponse{
+		From: from,
+		To:   to,
+		Runs: make([]SlotRun, 0),
+	}
+	for epochNumber := CalcEpochForSlot(from); epochNumber <= CalcEpochForSlot(to); epochNumber++ {
+		first, last := CalcEpochLimits(epochNumber)
+		if first < from {
+			first = from
+		}
+		if last > to {
+			last = to
+		}
+		epoch, err := multi.GetEpoch(epochNumber)
+		if err != nil {
+			resp.add(SlotStatusMissing, first, last)
+			continue
+		}
+		slotToCidIndex, err := epoch.getSlotToCidIndex()
+		if err != nil {
+			return nil, err
+		}
+		coverage, ok := slotToCidIndex.Coverage()
+		if !ok {
+			// without the covered range, a slot without block can't be told skipped.
+			coverage.FirstSlot, coverage.LastSlot = first, last
+		}
+		for slot := first; slot <= last; slot++ {
+			if slot < coverage.FirstSlot || slot > coverage.LastSlot {
+				resp.add(SlotStatusMissing, slot, slot)
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			_, err := slotToCidIndex.Get(slot)
+			switch {
+			case err == nil:
+				resp.add(SlotStatusPresent, slot, slot)
+			case errors.Is(err, compactindexsized.ErrNotFound):
+				if ok {
+					resp.add(SlotStatusSkipped, slot, slot)
+				} else {
+					resp.add(SlotStatusMissing, slot, slot)
+				}
+			default:
+				return nil, fmt.Errorf("failed to look up slot %d: %w", slot, err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getSlotCoverage",
+		Summary: "Returns the status of the slots of a range: present, skipped or missing.",
+		Params: []MethodParam{
+			uintParam("fromSlot", "the first slot of the range"),
+			uintParam("toSlot", "the last slot of the range (inclusive)"),
+		},
+		Handler: (*MultiEpoch).handleGetSlotCoverage,
+	})
+}
+
+// handleGetSlotCoverage tells, for a range of slots, which ones have a block in the archive,
+// which ones were skipped and which ones are not in the archive, so that backfill tools can
+// plan which slots to fetch from where.
+func (multi *MultiEpoch) handleGetSlotCoverage(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetSlotCoverageRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	resp, err := multi.GetSlotCoverage(ctx, params.From, params.To)
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get the slot coverage: %w", err))
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		resp,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetSlotCoverageRequest(t *testing.T) {
+	raw := json.RawMessage(`[10, 20]`)
+	req, err := parseGetSlotCoverageRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, &GetSlotCoverageRequest{From: 10, To: 20}, req)
+
+	for _, invalid := range []string{`[10]`, `[20, 10]`, `["10", 20]`, `[0, 100000]`} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetSlotCoverageRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestGetSlotCoverage(t *testing.T) {
+	rootCid := cid.MustParse("bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+	start, _ := CalcEpochLimits(1)
+	dir := t.TempDir()
+	writer, err := indexes.NewWriter_SlotToCid(1, rootCid, indexes.NetworkMainnet, dir, 4)
+	require.NoError(t, err)
+	// blocks at +10, +11, +13 and +15: +12 and +14 were skipped, and the archive starts at +10.
+	for _, offset := range []uint64{10, 11, 13, 15} {
+		require.NoError(t, writer.Put(start+offset, rootCid))
+	}
+	require.NoError(t, writer.Seal(context.Background(), dir))
+	slotToCid, err := indexes.Open_SlotToCid(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+	require.NoError(t, err)
+	defer slotToCid.Close()
+
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(1, &Epoch{epoch: 1, config: &Config{}, slotToCidIndex: slotToCid}))
+
+	// from the end of epoch 0 (not loaded) to epoch 1.
+	resp, err := multi.GetSlotCoverage(context.Background(), start-2, start+16)
+	require.NoError(t, err)
+	require.Equal(t, []SlotRun{
+		{Status: SlotStatusMissing, First: start - 2, Last: start + 9},
+		{Status: SlotStatusPresent, First: start + 10, Last: start + 11},
+		{Status: SlotStatusSkipped, First: start + 12, Last: start + 12},
+		{Status: SlotStatusPresent, First: start + 13, Last: start + 13},
+		{Status: SlotStatusSkipped, First: start + 14, Last: start + 14},
+		{Status: SlotStatusPresent, First: start + 15, Last: start + 15},
+		{Status: SlotStatusMissing, First: start + 16, Last: start + 16},
+	}, resp.Runs)
+	require.Equal(t, uint64(4), resp.NumPresent)
+	require.Equal(t, uint64(2), resp.NumSkipped)
+	require.Equal(t, uint64(13), resp.NumMissing)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// maxSlotLeadersLimit is the largest limit of a getSlotLeaders request (the same as the RPC).
+const maxSlotLeadersLimit = 5000
+
+type GetSlotLeadersRequest struct {
+	StartSlot uint64
+	Limit     uint64
+}
+
+func parseGetSlotLeadersRequest(raw *json.RawMessage) (*GetSlotLeadersRequest, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("params must be [startSlot, limit]")
+	}
+	var params []uint64
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("params must be [startSlot, limit]: %w", err)
+	}
+	if len(params) != 2 {
+		return nil, fmt.Errorf("params must be [startSlot, limit], got %d arguments", len(params))
+	}
+	out := &GetSlotLeadersRequest{StartSlot: params[0], Limit: params[1]}
+	if out.Limit < 1 || out.Limit > maxSlotLeadersLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxSlotLeadersLimit)
+	}
+	return out, nil
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getSlotLeaders",
+		Summary: "Returns the leaders of a range of slots, from the leader schedules of the epochs.",
+		Params: []MethodParam{
+			uintParam("startSlot", "the first slot"),
+			uintParam("limit", "the number of slots (up to 5000)"),
+		},
+		Handler: (*MultiEpoch).handleGetSlotLeaders,
+	})
+}
+
+// handleGetSlotLeaders answers from the leader schedule sidecars of the epochs.
+func (multi *MultiEpoch) handleGetSlotLeaders(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	params, err := parseGetSlotLeadersRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	leaders := make([]string, 0, params.Limit)
+	var epochHandler *Epoch
+	for slot := params.StartSlot; slot < params.StartSlot+params.Limit; slot++ {
+		epochNumber := CalcEpochForSlot(slot)
+		if epochHandler == nil || epochHandler.Epoch() != epochNumber {
+			epochHandler, err = multi.GetEpoch(epochNumber)
+			if err != nil || !epochHandler.HasLeaderSchedule() {
+				return errInvalidParams(
+					fmt.Sprintf("Invalid slot range: leader schedule for epoch %d is unavailable", epochNumber),
+					fmt.Errorf("no leader schedule for epoch %d", epochNumber),
+				)
+			}
+		}
+		leader, ok := epochHandler.GetSlotLeader(slot)
+		if !ok {
+			return errInvalidParams(
+				fmt.Sprintf("Invalid slot range: the leader schedule of epoch %d has no leader for slot %d", epochNumber, slot),
+				fmt.Errorf("no leader for slot %d", slot),
+			)
+		}
+		leaders = append(leaders, leader.String())
+	}
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		leaders,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
@@ -4,11 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sort"
 	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
 	"github.com/sourcegraph/jsonrpc2"
 	"k8s.io/klog/v2"
 )
@@ -22,6 +22,7 @@ func (multi *MultiEpoch) getAllBucketteers() map[uint64]SigExistsIndex {
 	defer multi.mu.RUnlock()
 	bucketteers := make(map[uint64]SigExistsIndex)
 	for _, epoch := range multi.epochs {
+		epoch = epoch.serving()
 		if epoch.sigExists != nil {
 			bucketteers[epoch.Epoch()] = epoch.sigExists
 		}
@@ -29,174 +30,161 @@ func (multi *MultiEpoch) getAllBucketteers() map[uint64]SigExistsIndex {
 	return bucketteers
 }
 
-func (multi *MultiEpoch) findEpochNumberFromSignature(ctx context.Context, sig solana.Signature) (uint64, error) {
-	// FLOW:
-	// - if one epoch, just return that epoch
-	// - if multiple epochs, use sigToEpoch to find the epoch number
-	// - if sigToEpoch is not available, linear search through all epochs
-
-	if epochs := multi.GetEpochNumbers(); len(epochs) == 1 {
-		return epochs[0], nil
-	}
-
-	// Linear search:
-	numbers := multi.GetEpochNumbers()
-	// sort from highest to lowest:
-	sort.Slice(numbers, func(i, j int) bool {
-		return numbers[i] > numbers[j]
-	})
-
-	buckets := multi.getAllBucketteers()
-
-	found := make([]uint64, 0)
-	startedSearchingCandidatesAt := time.Now()
-	for _, epochNumber := range numbers {
-		bucket, ok := buckets[epochNumber]
-		if !ok {
-			continue
-		}
-		if has, err := bucket.Has(sig); err != nil {
-			return 0, fmt.Errorf("failed to check if signature exists in bucket: %w", err)
-		} else if has {
-			found = append(found, epochNumber)
-		}
-	}
-	klog.V(4).Infof(
-		"Searched %d epochs in %s, and found %d candidate epochs for signature %s: %v",
-		len(numbers),
-		time.Since(startedSearchingCandidatesAt),
-		len(found),
-		sig,
-		found,
-	)
-
-	if len(found) == 0 {
-		return 0, ErrNotFound
-	}
-
-	// Search all epochs in parallel:
-	wg := NewFirstResponse(ctx, multi.options.EpochSearchConcurrency)
-	for i := range numbers {
-		epochNumber := numbers[i]
-		wg.Spawn(func() (any, error) {
-			epoch, err := multi.GetEpoch(epochNumber)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get epoch %d: %w", epochNumber, err)
-			}
-			if _, err := epoch.FindCidFromSignature(ctx, sig); err == nil {
-				return epochNumber, nil
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "getTransaction",
+		Summary: "Returns a transaction by its signature.",
+		Params: []MethodParam{
+			stringParam("signature", "the base58 signature of the transaction"),
+			configParam("encoding, maxSupportedTransactionVersion, commitment, minSlot and maxSlot"),
+		},
+		CacheKey: func(req *jsonrpc2.Request) (any, bool) {
+			params, err := parseGetTransactionRequest(req.Params)
+			if err != nil || params.Validate() != nil {
+				return nil, false
 			}
-			// Not found in this epoch.
-			return nil, nil
-		})
-	}
-	switch result := wg.Wait().(type) {
-	case nil:
-		// All epochs were searched, but the signature was not found.
-		return 0, ErrNotFound
-	case error:
-		// An error occurred while searching one of the epochs.
-		return 0, result
-	case uint64:
-		// The signature was found in one of the epochs.
-		return result, nil
-	default:
-		return 0, fmt.Errorf("unexpected result: (%T) %v", result, result)
-	}
+			return params, true
+		},
+		Handler: (*MultiEpoch).handleGetTransaction,
+	})
 }
 
 func (multi *MultiEpoch) handleGetTransaction(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
 	if multi.CountEpochs() == 0 {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "no epochs available",
-		}, fmt.Errorf("no epochs available")
+		return errInternal(fmt.Errorf("no epochs available"))
 	}
 
 	params, err := parseGetTransactionRequest(req.Params)
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: "Invalid params",
-		}, fmt.Errorf("failed to parse params: %w", err)
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
 	}
 	if err := params.Validate(); err != nil {
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInvalidParams,
-			Message: err.Error(),
-		}, fmt.Errorf("failed to validate params: %w", err)
+		return errInvalidParams(err.Error(), fmt.Errorf("failed to validate params: %w", err))
 	}
 
 	sig := params.Signature
 
 	startedEpochLookupAt := time.Now()
-	epochNumber, err := multi.findEpochNumberFromSignature(ctx, sig)
+	var searchHint *epochSearchHint
+	if !conn.strict() {
+		searchHint = params.Options.searchHint()
+	}
+	epochNumber, err := multi.findEpochNumberFromSignature(ctx, sig, searchHint)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
 			// solana just returns null here in case of transaction not found: {"jsonrpc":"2.0","result":null,"id":1}
-			return &jsonrpc2.Error{
-				Code:    CodeNotFound,
-				Message: "Transaction not found",
-			}, fmt.Errorf("failed to find epoch number from signature %s: %w", sig, err)
+			return errTransactionNotFound(sig, fmt.Errorf("failed to find epoch number from signature %s: %w", sig, err))
 		}
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "Internal error",
-		}, fmt.Errorf("failed to get epoch for signature %s: %w", sig, err)
+		return errInternal(fmt.Errorf("failed to get epoch for signature %s: %w", sig, err))
 	}
 	klog.V(4).Infof("Found signature %s in epoch %d in %s", sig, epochNumber, time.Since(startedEpochLookupAt))
 
 	epochHandler, err := multi.GetEpoch(uint64(epochNumber))
 	if err != nil {
-		return &jsonrpc2.Error{
-			Code:    CodeNotFound,
-			Message: fmt.Sprintf("Epoch %d is not available from this RPC", epochNumber),
-		}, fmt.Errorf("failed to get handler for epoch %d: %w", epochNumber, err)
+		return errEpochNotAvailable(uint64(epochNumber), fmt.Errorf("failed to get handler for epoch %d: %w", epochNumber, err))
 	}
 
 	transactionNode, transactionCid, err := epochHandler.GetTransaction(WithSubrapghPrefetch(ctx, true), sig)
 	if err != nil {
 		if errors.Is(err, compactindexsized.ErrNotFound) {
 			// NOTE: solana just returns null here in case of transaction not found: {"jsonrpc":"2.0","result":null,"id":1}
-			return &jsonrpc2.Error{
-				Code:    CodeNotFound,
-				Message: "Transaction not found",
-			}, fmt.Errorf("transaction %s not found", sig)
+			return errTransactionNotFound(sig, fmt.Errorf("transaction %s not found: %w", sig, err))
 		}
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeInternalError,
-			Message: "Internal error",
-		}, fmt.Errorf("failed to get Transaction: %w", err)
+		return errInternal(fmt.Errorf("failed to get Transaction: %w", err))
 	}
 	{
 		conn.ctx.Response.Header.Set("DAG-Root-CID", transactionCid.String())
 	}
 
+	blocktime, err := epochHandler.getBlocktime(ctx, uint64(transactionNode.Slot))
+	if err != nil {
+		return errInternal(fmt.Errorf("failed to get block: %w", err))
+	}
+	response, jsonErr, err := epochHandler.buildGetTransactionResponse(ctx, transactionNode, blocktime, *params.Options.Encoding)
+	if jsonErr != nil {
+		return jsonErr, err
+	}
+
+	// reply with the data
+	err = conn.Reply(
+		ctx,
+		req.ID,
+		response,
+		func(m map[string]any) map[string]any {
+			m = response.withMetaResponse(adaptTransactionMetaToExpectedOutput(m))
+			if *params.Options.Encoding == solana.EncodingJSONParsed && !conn.strict() {
+				m = addInstructionLogs(m)
+			}
+			return m
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
+
+// getBlocktime returns the blocktime of the block of the slot, or nil if it's unknown.
+func (ser *Epoch) getBlocktime(ctx context.Context, slot uint64) (*uint64, error) {
+	block, _, err := ser.GetBlock(ctx, slot)
+	if err != nil {
+		return nil, err
+	}
+	blocktime := uint64(block.Meta.Blocktime)
+	if blocktime == 0 {
+		return nil, nil
+	}
+	return &blocktime, nil
+}
+
+// buildGetTransactionResponse builds the getTransaction response for the given transaction node
+// (in the block with the given blocktime).
+func (ser *Epoch) buildGetTransactionResponse(
+	ctx context.Context,
+	transactionNode *ipldbindcode.Transaction,
+	blocktime *uint64,
+	encoding solana.EncodingType,
+) (*GetTransactionResponse, *jsonrpc2.Error, error) {
 	var response GetTransactionResponse
 
 	response.Slot = ptrToUint64(uint64(transactionNode.Slot))
-	{
-		block, _, err := epochHandler.GetBlock(ctx, uint64(transactionNode.Slot))
-		if err != nil {
-			return &jsonrpc2.Error{
-				Code:    jsonrpc2.CodeInternalError,
-				Message: "Internal error",
-			}, fmt.Errorf("failed to get block: %w", err)
-		}
-		blocktime := uint64(block.Meta.Blocktime)
-		if blocktime != 0 {
-			response.Blocktime = &blocktime
-		}
-	}
+	response.Blocktime = blocktime
 
 	{
 		pos, ok := transactionNode.GetPositionIndex()
 		if ok {
 			response.Position = uint64(pos)
 		}
-		tx, meta, err := parseTransactionAndMetaFromNode(transactionNode, epochHandler.GetDataFrameByCid)
+		if isBinaryEncoding(encoding) {
+			// fast path: the stored bytes of the transaction are encoded as they are.
+			txBuf, meta, err := parseRawTransactionAndMetaFromNode(ctx, transactionNode, ser.GetDataFrameByCid)
+			if err == nil {
+				_, response.Version, err = parseRawTransactionHeader(txBuf)
+			}
+			if err != nil {
+				return nil, &jsonrpc2.Error{
+					Code:    jsonrpc2.CodeInternalError,
+					Message: "Internal error",
+				}, fmt.Errorf("failed to decode transaction: %w", err)
+			}
+			response.Meta = meta
+			response.Transaction, err = encodeRawTransactionBasedOnWantedEncoding(encoding, txBuf)
+			if errors.Is(err, errBase58TooLarge) {
+				jsonErr, err := errInvalidParams(err.Error(), err)
+				return nil, jsonErr, err
+			}
+			if err != nil {
+				return nil, &jsonrpc2.Error{
+					Code:    jsonrpc2.CodeInternalError,
+					Message: "Internal error",
+				}, fmt.Errorf("failed to encode transaction: %w", err)
+			}
+			response.mapMetaDirectly()
+			return &response, nil, nil
+		}
+		tx, meta, err := parseTransactionAndMetaFromNode(ctx, transactionNode, ser.GetDataFrameByCid)
 		if err != nil {
-			return &jsonrpc2.Error{
+			return nil, &jsonrpc2.Error{
 				Code:    jsonrpc2.CodeInternalError,
 				Message: "Internal error",
 			}, fmt.Errorf("failed to decode transaction: %w", err)
@@ -209,27 +197,20 @@ func (multi *MultiEpoch) handleGetTransaction(ctx context.Context, conn *request
 		}
 		response.Meta = meta
 
-		encodedTx, err := encodeTransactionResponseBasedOnWantedEncoding(*params.Options.Encoding, tx, meta)
+		encodedTx, err := encodeTransactionResponseBasedOnWantedEncoding(encoding, tx, meta)
+		if errors.Is(err, errBase58TooLarge) {
+			jsonErr, err := errInvalidParams(err.Error(), err)
+			return nil, jsonErr, err
+		}
 		if err != nil {
-			return &jsonrpc2.Error{
+			return nil, &jsonrpc2.Error{
 				Code:    jsonrpc2.CodeInternalError,
 				Message: "Internal error",
 			}, fmt.Errorf("failed to encode transaction: %w", err)
 		}
 		response.Transaction = encodedTx
+		response.mapMetaDirectly()
 	}
 
-	// reply with the data
-	err = conn.Reply(
-		ctx,
-		req.ID,
-		response,
-		func(m map[string]any) map[string]any {
-			return adaptTransactionMetaToExpectedOutput(m)
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to reply: %w", err)
-	}
-	return nil, nil
+	return &response, nil, nil
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/sourcegraph/jsonrpc2"
+	"k8s.io/klog/v2"
+)
+
+// maxSignaturesPerGetTransactions is the maximum number of signatures that can be requested
+// in a single faithful_getTransactions call.
+const maxSignaturesPerGetTransactions = 100
+
+type GetTransactionsRequest struct {
+	Signatures []solana.Signature
+	Options    GetTransactionOptions
+}
+
+// Validate validates the request.
+func (req *GetTransactionsRequest) Validate() error {
+	if len(req.Signatures) == 0 {
+		return fmt.Errorf("at least one signature is required")
+	}
+	if len(req.Signatures) > maxSignaturesPerGetTransactions {
+		return fmt.Errorf("too many signatures: %d (max %d)", len(req.Signatures), maxSignaturesPerGetTransactions)
+	}
+	for i, sig := range req.Signatures {
+		if sig.IsZero() {
+			return fmt.Errorf("signature #%d is zero", i)
+		}
+	}
+	return req.Options.Validate()
+}
+
+func parseGetTransactionsRequest(raw *json.RawMessage) (*GetTransactionsRequest, error) {
+	var params []any
+	if err := fasterJson.Unmarshal(*raw, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal params: %w", err)
+	}
+	if len(params) < 1 {
+		return nil, fmt.Errorf("params must have at least one argument")
+	}
+	sigsRaw, ok := params[0].([]any)
+	if !ok {
+		return nil, fmt.Errorf("first argument must be an array of signatures, got %T", params[0])
+	}
+	out := &GetTransactionsRequest{
+		Signatures: make([]solana.Signature, 0, len(sigsRaw)),
+	}
+	for i, sigRaw := range sigsRaw {
+		sigString, ok := sigRaw.(string)
+		if !ok {
+			return nil, fmt.Errorf("signature #%d must be a string, got %T", i, sigRaw)
+		}
+		sig, err := solana.SignatureFromBase58(sigString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signature #%d from base58: %w", i, err)
+		}
+		out.Signatures = append(out.Signatures, sig)
+	}
+	var optionsParam any
+	if len(params) > 1 {
+		optionsParam = params[1]
+	}
+	options, err := parseGetTransactionOptions(optionsParam)
+	if err != nil {
+		return nil, err
+	}
+	out.Options = options
+	return out, nil
+}
+
+// transactionLocation is where a requested transaction might be in the archive.
+type transactionLocation struct {
+	index int // position in the request
+	rank  int // position of the epoch in the search order of the signature
+	cid   cid.Cid
+}
+
+func init() {
+	mustRegisterMethod(&MethodSpec{
+		Name:    "faithful_getTransactions",
+		Summary: "Returns up to 100 transactions by their signatures, in the requested order.",
+		Params: []MethodParam{
+			{Name: "signatures", Summary: "the base58 signatures of the transactions", Required: true, Schema: map[string]any{"type": "array", "items": map[string]any{"type": "string"}}},
+			configParam("the options of getTransaction"),
+		},
+		Cost: MethodCostHeavy,
+		CacheKey: func(req *jsonrpc2.Request) (any, bool) {
+			params, err := parseGetTransactionsRequest(req.Params)
+			if err != nil || params.Validate() != nil {
+				return nil, false
+			}
+			return params, true
+		},
+		Handler: (*MultiEpoch).handleGetTransactions,
+	})
+}
+
+// handleGetTransactions resolves many signatures in one call: the signatures are looked up in
+// their candidate epochs in parallel, then the transactions of each epoch are fetched with a
+// single batch (see GetNodesByCids), and returned in the requested order, with null for the
+// transactions that were not found.
+func (multi *MultiEpoch) handleGetTransactions(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
+	if multi.CountEpochs() == 0 {
+		return errInternal(fmt.Errorf("no epochs available"))
+	}
+
+	params, err := parseGetTransactionsRequest(req.Params)
+	if err != nil {
+		return errInvalidParams("Invalid params", fmt.Errorf("failed to parse params: %w", err))
+	}
+	if err := params.Validate(); err != nil {
+		return errInvalidParams(err.Error(), fmt.Errorf("failed to validate params: %w", err))
+	}
+
+	// Look up each signature in its candidate epochs, grouped by epoch. A lookup can match
+	// another signature (see findEpochNumberFromSignature): all the matches are kept, and
+	// checked once the transactions are fetched.
+	locationsByEpoch := make(map[uint64][]transactionLocation)
+	{
+		numbers := orderEpochsForSearch(multi.GetEpochNumbers(), multi.options.EpochSearchOrder, params.Options.searchHint())
+		mu := &sync.Mutex{}
+		wg, ctx := dagFetchPool.Group(ctx)
+		for i, sig := range params.Signatures {
+			i, sig := i, sig
+			wg.Go(func() error {
+				candidates, err := multi.filterEpochsForSignature(ctx, numbers, sig)
+				if err != nil {
+					return fmt.Errorf("failed to get the epochs for signature %s: %w", sig, err)
+				}
+				for rank, epochNumber := range candidates {
+					epochHandler, err := multi.GetEpoch(epochNumber)
+					if err != nil {
+						continue
+					}
+					transactionCid, err := epochHandler.FindCidFromSignature(ctx, sig)
+					if err != nil {
+						klog.V(4).Infof("signature %s not found in epoch %d: %v", sig, epochNumber, err)
+						continue
+					}
+					mu.Lock()
+					locationsByEpoch[epochNumber] = append(locationsByEpoch[epochNumber], transactionLocation{
+						index: i,
+						rank:  rank,
+						cid:   transactionCid,
+					})
+					mu.Unlock()
+				}
+				return nil
+			})
+		}
+		if err := wg.Wait(); err != nil {
+			return errInternal(err)
+		}
+	}
+	epochNumbers := make([]uint64, 0, len(locationsByEpoch))
+	for epochNumber := range locationsByEpoch {
+		epochNumbers = append(epochNumbers, epochNumber)
+	}
+	sort.Slice(epochNumbers, func(i, j int) bool {
+		return epochNumbers[i] < epochNumbers[j]
+	})
+
+	// Fetch the transactions, and keep the one of each signature in the first epoch of its search order.
+	type foundTransaction struct {
+		transactionLocation
+		epochHandler *Epoch
+		node         *ipldbindcode.Transaction
+	}
+	found := make([]*foundTransaction, len(params.Signatures))
+	for _, epochNumber := range epochNumbers {
+		epochHandler, err := multi.GetEpoch(epochNumber)
+		if err != nil {
+			continue
+		}
+		locations := locationsByEpoch[epochNumber]
+		cids := make([]cid.Cid, len(locations))
+		for i, loc := range locations {
+			cids[i] = loc.cid
+		}
+		transactionNodes, err := epochHandler.GetTransactionsByCids(ctx, cids)
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to get transactions from epoch %d: %w", epochNumber, err))
+		}
+		for i, loc := range locations {
+			if transactionNodes[i] == nil || !isTransactionOfSignature(transactionNodes[i], params.Signatures[loc.index]) {
+				// not found (or not readable).
+				continue
+			}
+			if previous := found[loc.index]; previous == nil || loc.rank < previous.rank {
+				found[loc.index] = &foundTransaction{transactionLocation: loc, epochHandler: epochHandler, node: transactionNodes[i]}
+			}
+		}
+	}
+
+	results := make([]any, len(params.Signatures))
+	rootCids := make([]string, 0, len(params.Signatures))
+	// the blocktimes, by epoch and slot: the transactions of a block share its blocktime.
+	blocktimes := make(map[*Epoch]map[uint64]*uint64)
+	for _, tx := range found {
+		if tx == nil {
+			continue
+		}
+		slot := uint64(tx.node.Slot)
+		if blocktimes[tx.epochHandler] == nil {
+			blocktimes[tx.epochHandler] = make(map[uint64]*uint64)
+		}
+		blocktime, ok := blocktimes[tx.epochHandler][slot]
+		if !ok {
+			blocktime, err = tx.epochHandler.getBlocktime(ctx, slot)
+			if err != nil {
+				return errInternal(fmt.Errorf("failed to get block: %w", err))
+			}
+			blocktimes[tx.epochHandler][slot] = blocktime
+		}
+		response, jsonErr, err := tx.epochHandler.buildGetTransactionResponse(ctx, tx.node, blocktime, *params.Options.Encoding)
+		if jsonErr != nil {
+			return jsonErr, err
+		}
+		mm, err := toMapAny(response)
+		if err != nil {
+			return errInternal(fmt.Errorf("failed to convert response: %w", err))
+		}
+		result := response.withMetaResponse(adaptTransactionMetaToExpectedOutput(MapToCamelCase(mm)))
+		if *params.Options.Encoding == solana.EncodingJSONParsed {
+			result = addInstructionLogs(result)
+		}
+		results[tx.index] = result
+		rootCids = append(rootCids, tx.cid.String())
+	}
+	if len(rootCids) > 0 {
+		conn.ctx.Response.Header.Set("DAG-Root-CID", strings.Join(rootCids, ","))
+	}
+
+	err = conn.ReplyRaw(
+		ctx,
+		req.ID,
+		results,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reply: %w", err)
+	}
+	return nil, nil
+}
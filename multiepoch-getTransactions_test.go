@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/gagliardetto/solana-go"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGetTransactionsRequest(t *testing.T) {
+	sig := solana.Signature{1}
+	raw := json.RawMessage(fmt.Sprintf(`[[%q, %q], {"encoding": "base64"}]`, sig, solana.Signature{2}))
+	req, err := parseGetTransactionsRequest(&raw)
+	require.NoError(t, err)
+	require.Equal(t, []solana.Signature{sig, {2}}, req.Signatures)
+	require.Equal(t, solana.EncodingBase64, *req.Options.Encoding)
+	require.NoError(t, req.Validate())
+
+	for _, invalid := range []string{`[]`, fmt.Sprintf(`[%q]`, sig), `[[1]]`, `[["not-a-signature"]]`, fmt.Sprintf(`[[%q], "base64"]`, sig)} {
+		raw := json.RawMessage(invalid)
+		_, err := parseGetTransactionsRequest(&raw)
+		require.Error(t, err, invalid)
+	}
+
+	for _, invalid := range []*GetTransactionsRequest{
+		{},
+		{Signatures: make([]solana.Signature, maxSignaturesPerGetTransactions+1)},
+		{Signatures: []solana.Signature{sig, {}}},
+	} {
+		invalid.Options = req.Options
+		require.Error(t, invalid.Validate())
+	}
+}
+
+func TestGetTransactions(t *testing.T) {
+	ctx := context.Background()
+	cache, err := hugecache.NewWithConfig(ctx, bigcache.DefaultConfig(time.Minute))
+	require.NoError(t, err)
+
+	// putTransaction puts the transaction of the signature, and its block, in the cache; it
+	// returns the bytes of the transaction.
+	putTransaction := func(writer *indexes.SigToCid_Writer, sig solana.Signature, slot uint64) []byte {
+		tx := solana.Transaction{
+			Signatures: []solana.Signature{sig},
+			Message: solana.Message{
+				AccountKeys:     []solana.PublicKey{{2}},
+				RecentBlockhash: solana.Hash{3},
+			},
+		}
+		txBuf, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		txCid, _ := cacheTestNode(t, cache, &ipldbindcode.Transaction{
+			Kind:     int(iplddecoders.KindTransaction),
+			Data:     ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame), Data: txBuf},
+			Metadata: ipldbindcode.DataFrame{Kind: int(iplddecoders.KindDataFrame)},
+			Slot:     int(slot),
+		}, ipldbindcode.Prototypes.Transaction.Type())
+		require.NoError(t, writer.Put(sig, txCid))
+		blockCid, _ := cacheTestNode(t, cache, &ipldbindcode.Block{
+			Kind:      int(iplddecoders.KindBlock),
+			Slot:      int(slot),
+			Shredding: ipldbindcode.List__Shredding{},
+			Entries:   ipldbindcode.List__Link{},
+			Meta:      ipldbindcode.SlotMeta{Blocktime: int(1700000000 + slot)},
+			Rewards:   cidlink.Link{Cid: DummyCID},
+		}, ipldbindcode.Prototypes.Block.Type())
+		require.NoError(t, cache.PutSlotToCid(slot, blockCid))
+		return txBuf
+	}
+	multi := NewMultiEpoch(&Options{})
+	// addEpoch adds an epoch with the transactions of the signatures, in the slot 10 of the epoch.
+	addEpoch := func(epoch uint64, sigs ...solana.Signature) map[solana.Signature][]byte {
+		dir := t.TempDir()
+		writer, err := indexes.NewWriter_SigToCid(epoch, DummyCID, indexes.NetworkMainnet, dir, uint64(len(sigs)))
+		require.NoError(t, err)
+		txs := make(map[solana.Signature][]byte)
+		for _, sig := range sigs {
+			txs[sig] = putTransaction(writer, sig, epoch*EpochLen+10)
+		}
+		require.NoError(t, writer.Seal(ctx, dir))
+		sigToCid, err := indexes.Open_SigToCid(filepath.Join(dir, filepath.Base(writer.GetFilepath())))
+		require.NoError(t, err)
+		t.Cleanup(func() { sigToCid.Close() })
+		require.NoError(t, multi.AddEpoch(epoch, &Epoch{epoch: epoch, config: &Config{}, allCache: cache, sigToCidIndex: sigToCid}))
+		return txs
+	}
+	txs := addEpoch(0, solana.Signature{1}, solana.Signature{2})
+	for sig, txBuf := range addEpoch(1, solana.Signature{3}) {
+		txs[sig] = txBuf
+	}
+
+	type transaction struct {
+		Slot        uint64   `json:"slot"`
+		BlockTime   uint64   `json:"blockTime"`
+		Transaction []string `json:"transaction"`
+	}
+	getTransactions := func(options string, sigs ...solana.Signature) (*jsonrpc2.Error, []*transaction) {
+		quoted := make([]string, len(sigs))
+		for i, sig := range sigs {
+			quoted[i] = fmt.Sprintf("%q", sig)
+		}
+		rpcErr, result := callTestMethod(t, multi, (*MultiEpoch).handleGetTransactions, fmt.Sprintf(`[[%s], %s]`, strings.Join(quoted, ","), options))
+		if rpcErr != nil {
+			return rpcErr, nil
+		}
+		var out []*transaction
+		require.NoError(t, json.Unmarshal(result, &out))
+		return nil, out
+	}
+	expected := func(sig solana.Signature, slot uint64) *transaction {
+		return &transaction{
+			Slot:        slot,
+			BlockTime:   1700000000 + slot,
+			Transaction: []string{base64.StdEncoding.EncodeToString(txs[sig]), "base64"},
+		}
+	}
+
+	// in the requested order, with null for the signature that is not found.
+	rpcErr, got := getTransactions(`{"encoding": "base64"}`, solana.Signature{3}, solana.Signature{4}, solana.Signature{1}, solana.Signature{2})
+	require.Nil(t, rpcErr)
+	require.Equal(t, []*transaction{
+		expected(solana.Signature{3}, EpochLen+10),
+		nil,
+		expected(solana.Signature{1}, 10),
+		expected(solana.Signature{2}, 10),
+	}, got)
+
+	// the hint restricts the search to epoch 1.
+	rpcErr, got = getTransactions(fmt.Sprintf(`{"encoding": "base64", "minSlot": %d}`, EpochLen), solana.Signature{1}, solana.Signature{3})
+	require.Nil(t, rpcErr)
+	require.Equal(t, []*transaction{nil, expected(solana.Signature{3}, EpochLen+10)}, got)
+	// an epoch that is not served.
+	rpcErr, got = getTransactions(fmt.Sprintf(`{"encoding": "base64", "minSlot": %d}`, 5*EpochLen), solana.Signature{3})
+	require.Nil(t, rpcErr)
+	require.Equal(t, []*transaction{nil}, got)
+
+	tooMany := make([]solana.Signature, maxSignaturesPerGetTransactions+1)
+	for i := range tooMany {
+		tooMany[i] = solana.Signature{1}
+	}
+	rpcErr, _ = getTransactions(`{}`, tooMany...)
+	require.Equal(t, int64(jsonrpc2.CodeInvalidParams), rpcErr.Code)
+	require.Contains(t, rpcErr.Message, "too many signatures")
+	rpcErr, _ = getTransactions(`{"commitment": "processed"}`, solana.Signature{1})
+	require.Equal(t, int64(jsonrpc2.CodeInvalidParams), rpcErr.Code)
+}
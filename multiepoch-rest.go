@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/logging"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// The GET API serves archived data that never changes, so its responses carry
+// strong ETags (derived from the CIDs of the served nodes) and an immutable Cache-Control,
+// which lets clients and CDNs revalidate with If-None-Match (304) or not at all.
+//
+//	GET /block/{slot}?encoding=&transactionDetails=&rewards=&maxSupportedTransactionVersion=
+//	  -> same result as getBlock
+//	GET /node/{cid}
+//	  -> the raw bytes of the node (like faithful_getRawNode)
+const (
+	restPathBlock = "/block/"
+	restPathNode  = "/node/"
+
+	immutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+type restError struct {
+	Error string `json:"error"`
+}
+
+// replyRestError replies with the given error; errors must not be cached.
+func replyRestError(reqCtx *fasthttp.RequestCtx, status int, message string) {
+	reqCtx.Response.Header.Del("ETag")
+	reqCtx.Response.Header.Del("Cache-Control")
+	replyJSON(reqCtx, status, restError{Error: message})
+}
+
+// restRoute returns the route of the GET API request (used as the method in logs and metrics),
+// or an empty string if the request is not for the GET API.
+func restRoute(reqCtx *fasthttp.RequestCtx) string {
+	if !reqCtx.IsGet() && !reqCtx.IsHead() {
+		return ""
+	}
+	path := string(reqCtx.Path())
+	switch {
+	case strings.HasPrefix(path, restPathBlock):
+		return "GET " + restPathBlock
+	case strings.HasPrefix(path, restPathNode):
+		return "GET " + restPathNode
+	default:
+		return ""
+	}
+}
+
+func (multi *MultiEpoch) handleRestRequest(ctx context.Context, reqCtx *fasthttp.RequestCtx) {
+	path := string(reqCtx.Path())
+	switch {
+	case strings.HasPrefix(path, restPathBlock):
+		multi.handleRestGetBlock(ctx, reqCtx, strings.TrimPrefix(path, restPathBlock))
+	case strings.HasPrefix(path, restPathNode):
+		multi.handleRestGetNode(ctx, reqCtx, strings.TrimPrefix(path, restPathNode))
+	default:
+		replyRestError(reqCtx, http.StatusNotFound, "not found")
+	}
+}
+
+// formatETag returns a strong ETag for the given node CID, and (optionally) the rendering options.
+func formatETag(c cid.Cid, normalizedOptions []byte) string {
+	if len(normalizedOptions) == 0 {
+		return strconv.Quote(c.String())
+	}
+	sum := sha256.Sum256(normalizedOptions)
+	return strconv.Quote(c.String() + "." + hex.EncodeToString(sum[:8]))
+}
+
+// etagMatches returns true if the If-None-Match header matches the given ETag.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match uses the weak comparison.
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// replyNotModifiedIfMatches sets the caching headers, and replies with 304 if the client already has the content.
+func replyNotModifiedIfMatches(reqCtx *fasthttp.RequestCtx, etag string) bool {
+	reqCtx.Response.Header.Set("ETag", etag)
+	reqCtx.Response.Header.Set("Cache-Control", immutableCacheControl)
+	if etagMatches(string(reqCtx.Request.Header.Peek("If-None-Match")), etag) {
+		reqCtx.SetStatusCode(http.StatusNotModified)
+		reqCtx.Response.SkipBody = true
+		return true
+	}
+	return false
+}
+
+// blockRequestFromQuery converts the query args of a GET /block/{slot} request to getBlock params.
+func blockRequestFromQuery(slot uint64, args *fasthttp.Args) (json.RawMessage, error) {
+	options := make(map[string]any)
+	if v := args.Peek("encoding"); len(v) > 0 {
+		options["encoding"] = string(v)
+	}
+	if v := args.Peek("transactionDetails"); len(v) > 0 {
+		options["transactionDetails"] = string(v)
+	}
+	if v := args.Peek("rewards"); len(v) > 0 {
+		rewards, err := strconv.ParseBool(string(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewards: %w", err)
+		}
+		options["rewards"] = rewards
+	}
+	if v := args.Peek("maxSupportedTransactionVersion"); len(v) > 0 {
+		version, err := strconv.ParseUint(string(v), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxSupportedTransactionVersion: %w", err)
+		}
+		options["maxSupportedTransactionVersion"] = version
+	}
+	return fasterJson.Marshal([]any{slot, options})
+}
+
+func (multi *MultiEpoch) handleRestGetBlock(ctx context.Context, reqCtx *fasthttp.RequestCtx, slotString string) {
+	slot, err := strconv.ParseUint(slotString, 10, 64)
+	if err != nil {
+		replyRestError(reqCtx, http.StatusBadRequest, "invalid slot")
+		return
+	}
+	rawParams, err := blockRequestFromQuery(slot, reqCtx.QueryArgs())
+	if err != nil {
+		replyRestError(reqCtx, http.StatusBadRequest, err.Error())
+		return
+	}
+	rpcRequest := &jsonrpc2.Request{
+		Method: "getBlock",
+		Params: (*json.RawMessage)(&rawParams),
+	}
+	params, err := parseGetBlockRequest(rpcRequest.Params)
+	if err == nil {
+		err = params.Validate()
+	}
+	if err != nil {
+		replyRestError(reqCtx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	epochNumber := CalcEpochForSlot(slot)
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		replyRestError(reqCtx, http.StatusNotFound, fmt.Sprintf("epoch %d is not available", epochNumber))
+		return
+	}
+	blockCid, err := epochHandler.FindCidFromSlot(ctx, slot)
+	if err != nil {
+		if timedOut(ctx) {
+			replyRestError(reqCtx, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+		var notReady *IndexNotReadyError
+		if errors.As(err, &notReady) {
+			replyRestError(reqCtx, http.StatusServiceUnavailable, notReady.Error())
+			return
+		}
+		replyRestError(reqCtx, http.StatusNotFound, fmt.Sprintf("slot %d was skipped, or missing in long-term storage", slot))
+		return
+	}
+	normalizedOptions, err := fasterJson.Marshal(params.Options)
+	if err != nil {
+		replyRestError(reqCtx, http.StatusInternalServerError, "internal error")
+		return
+	}
+	largeIntsAsStrings := multi.largeIntsAsStrings(reqCtx)
+	if largeIntsAsStrings {
+		// a different rendering of the same block.
+		normalizedOptions = append(normalizedOptions, ";large-ints-as-strings"...)
+	}
+	apiVersion := multi.apiVersion(reqCtx)
+	if apiVersion == ApiVersionStrict {
+		normalizedOptions = append(normalizedOptions, ";"+string(apiVersion)...)
+	}
+	if replyNotModifiedIfMatches(reqCtx, formatETag(blockCid, normalizedOptions)) {
+		return
+	}
+
+	rqCtx := &requestContext{ctx: reqCtx, largeIntsAsStrings: largeIntsAsStrings, apiVersion: apiVersion}
+	errorResp, err := multi.handleRequest(ctx, rqCtx, rpcRequest)
+	errorResp, err = timeoutAware(ctx, errorResp, err)
+	if err != nil {
+		rpcLog.Ctx(ctx).Error("failed to handle GET request", append([]logging.Field{logging.String("path", string(reqCtx.Path()))}, errorLogFields(err)...)...)
+	}
+	if errorResp != nil {
+		errorResp = publicError(errorResp, getRequestIDFromContext(ctx))
+		status := http.StatusInternalServerError
+		if errorResp.Code == CodeNotFound || errors.Is(err, ErrNotFound) {
+			status = http.StatusNotFound
+		} else if errorResp.Code == CodeRequestTimeout {
+			status = http.StatusGatewayTimeout
+		} else if errorResp.Code == CodeBlockTooLarge {
+			status = http.StatusUnprocessableEntity
+		}
+		replyRestError(reqCtx, status, errorResp.Message)
+		return
+	}
+	// the handler replied with a JSON-RPC response; serve just the result.
+	reqCtx.Response.SetBodyRaw(rqCtx.result)
+}
+
+func (multi *MultiEpoch) handleRestGetNode(ctx context.Context, reqCtx *fasthttp.RequestCtx, cidString string) {
+	c, err := cid.Parse(cidString)
+	if err != nil {
+		replyRestError(reqCtx, http.StatusBadRequest, "invalid CID")
+		return
+	}
+	// the content of a node is identified by its CID, so the client can be answered without a lookup.
+	if replyNotModifiedIfMatches(reqCtx, formatETag(c, nil)) {
+		return
+	}
+	epochNumber, err := multi.findEpochNumberFromCid(ctx, c)
+	if err != nil {
+		if timedOut(ctx) {
+			replyRestError(reqCtx, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+		if errors.Is(err, ErrNotFound) {
+			replyRestError(reqCtx, http.StatusNotFound, "node not found")
+			return
+		}
+		replyRestError(reqCtx, http.StatusInternalServerError, "internal error")
+		return
+	}
+	epochHandler, err := multi.GetEpoch(epochNumber)
+	if err != nil {
+		replyRestError(reqCtx, http.StatusNotFound, fmt.Sprintf("epoch %d is not available", epochNumber))
+		return
+	}
+	data, err := epochHandler.getRawNode(ctx, c, maxRawNodeSize)
+	if err != nil {
+		if timedOut(ctx) {
+			replyRestError(reqCtx, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+		replyRestError(reqCtx, http.StatusNotFound, "node not found, or too large")
+		return
+	}
+	reqCtx.Response.Header.Set("DAG-Root-CID", c.String())
+	reqCtx.SetContentType("application/vnd.ipld.raw")
+	reqCtx.Response.Header.Set("X-Epoch", strconv.FormatUint(epochNumber, 10))
+	reqCtx.SetStatusCode(http.StatusOK)
+	reqCtx.SetBody(data)
+}
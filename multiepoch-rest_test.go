@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	c := cid.MustParse("bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa")
+	etag := formatETag(c, nil)
+	require.Equal(t, `"bafyreigf3w3cvbhn6lylvbcd6xo5xkl2wtgcmxx2ih6o4bnt5kppzbzywa"`, etag)
+
+	withOptions := formatETag(c, []byte(`{"encoding":"json"}`))
+	require.NotEqual(t, etag, withOptions)
+	require.Equal(t, withOptions, formatETag(c, []byte(`{"encoding":"json"}`)))
+	require.NotEqual(t, withOptions, formatETag(c, []byte(`{"encoding":"base64"}`)))
+
+	require.False(t, etagMatches("", etag))
+	require.True(t, etagMatches(etag, etag))
+	require.True(t, etagMatches("*", etag))
+	require.True(t, etagMatches(`"foo", W/`+etag, etag))
+	require.False(t, etagMatches(`"foo"`, etag))
+}
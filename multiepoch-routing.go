@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+	"k8s.io/klog/v2"
+)
+
+// The routing metadata, for the external load balancers (e.g. Envoy, nginx+lua) that route the
+// requests to the servers by slot:
+//
+//	GET /v1/routing  -> JSON (see Routing)
+//
+// The schema is stable: fields may be added to it, but the existing ones don't change within a
+// schema version.
+const routingPath = "/v1/routing"
+
+// RoutingSchemaVersion is the version of the schema of the routing metadata.
+const RoutingSchemaVersion = 1
+
+// Routing is the routing metadata: the slots served by the server.
+type Routing struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Epochs are the loaded epochs, oldest first.
+	Epochs []RoutingEpoch `json:"epochs"`
+	// SlotRanges are the slots of the epochs, with the contiguous epochs merged, lowest first.
+	SlotRanges []RoutingSlotRange `json:"slotRanges"`
+}
+
+// RoutingEpoch is a loaded epoch.
+type RoutingEpoch struct {
+	Epoch     uint64 `json:"epoch"`
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+	// Version identifies the data of the epoch (the root CID of its CAR): two servers with the
+	// same version of an epoch return the same results for it.
+	Version string `json:"version"`
+	// HasGsfa is true if getSignaturesForAddress is served for the epoch.
+	HasGsfa bool `json:"hasGsfa"`
+}
+
+// RoutingSlotRange is a range of slots, inclusive.
+type RoutingSlotRange struct {
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+}
+
+// Routing returns the routing metadata.
+func (m *MultiEpoch) Routing() *Routing {
+	routing := &Routing{
+		SchemaVersion: RoutingSchemaVersion,
+		Epochs:        make([]RoutingEpoch, 0),
+		SlotRanges:    make([]RoutingSlotRange, 0),
+	}
+	numbers := m.GetEpochNumbers()
+	// oldest first.
+	for i := len(numbers) - 1; i >= 0; i-- {
+		epoch, err := m.GetEpoch(numbers[i])
+		if err != nil {
+			continue
+		}
+		firstSlot, lastSlot := CalcEpochLimits(epoch.Epoch())
+		routingEpoch := RoutingEpoch{
+			Epoch:     epoch.Epoch(),
+			FirstSlot: firstSlot,
+			LastSlot:  lastSlot,
+			HasGsfa:   epoch.gsfaReader != nil,
+		}
+		if rootCid := epoch.GetRootCid(); rootCid.Defined() {
+			routingEpoch.Version = rootCid.String()
+		}
+		routing.Epochs = append(routing.Epochs, routingEpoch)
+		if last := len(routing.SlotRanges) - 1; last >= 0 && routing.SlotRanges[last].LastSlot+1 == firstSlot {
+			routing.SlotRanges[last].LastSlot = lastSlot
+			continue
+		}
+		routing.SlotRanges = append(routing.SlotRanges, RoutingSlotRange{FirstSlot: firstSlot, LastSlot: lastSlot})
+	}
+	return routing
+}
+
+// isRoutingRequest returns true if the request is for the routing metadata.
+func isRoutingRequest(reqCtx *fasthttp.RequestCtx) bool {
+	return (reqCtx.IsGet() || reqCtx.IsHead()) && string(reqCtx.Path()) == routingPath
+}
+
+// handleRoutingRequest replies with the routing metadata; its ETag changes only when the
+// metadata do, so that the load balancers can poll it with If-None-Match.
+func (m *MultiEpoch) handleRoutingRequest(reqCtx *fasthttp.RequestCtx) {
+	body, err := fasterJson.Marshal(m.Routing())
+	if err != nil {
+		klog.Errorf("failed to encode the routing metadata: %v", err)
+		reqCtx.Error("Internal error", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	reqCtx.Response.Header.Set("Cache-Control", "no-cache")
+	reqCtx.Response.Header.Set("ETag", etag)
+	if string(reqCtx.Request.Header.Peek("If-None-Match")) == etag {
+		reqCtx.SetStatusCode(http.StatusNotModified)
+		return
+	}
+	reqCtx.SetContentType("application/json")
+	reqCtx.SetStatusCode(http.StatusOK)
+	reqCtx.SetBody(body)
+}
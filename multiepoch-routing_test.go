@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRouting(t *testing.T) {
+	multi := NewMultiEpoch(&Options{})
+	for _, epoch := range []uint64{2, 3, 5} {
+		require.NoError(t, multi.AddEpoch(epoch, &Epoch{epoch: epoch, config: &Config{}}))
+	}
+
+	request := func(etag string) *fasthttp.RequestCtx {
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Request.Header.SetMethod("GET")
+		reqCtx.Request.SetRequestURI(routingPath)
+		if etag != "" {
+			reqCtx.Request.Header.Set("If-None-Match", etag)
+		}
+		require.True(t, isRoutingRequest(reqCtx))
+		multi.handleRoutingRequest(reqCtx)
+		return reqCtx
+	}
+
+	resp := request("")
+	require.Equal(t, 200, resp.Response.StatusCode())
+	var routing Routing
+	require.NoError(t, json.Unmarshal(resp.Response.Body(), &routing))
+	require.Equal(t, RoutingSchemaVersion, routing.SchemaVersion)
+	require.Len(t, routing.Epochs, 3)
+	require.Equal(t, uint64(2), routing.Epochs[0].Epoch)
+	require.Equal(t, uint64(5*432000), routing.Epochs[2].FirstSlot)
+	// epochs 2 and 3 are contiguous.
+	require.Equal(t, []RoutingSlotRange{
+		{FirstSlot: 2 * 432000, LastSlot: 4*432000 - 1},
+		{FirstSlot: 5 * 432000, LastSlot: 6*432000 - 1},
+	}, routing.SlotRanges)
+
+	// the ETag changes only with the metadata.
+	etag := string(resp.Response.Header.Peek("ETag"))
+	require.NotEmpty(t, etag)
+	require.Equal(t, 304, request(etag).Response.StatusCode())
+	require.NoError(t, multi.AddEpoch(4, &Epoch{epoch: 4, config: &Config{}}))
+	resp = request(etag)
+	require.Equal(t, 200, resp.Response.StatusCode())
+	require.NoError(t, json.Unmarshal(resp.Response.Body(), &routing))
+	require.Equal(t, []RoutingSlotRange{{FirstSlot: 2 * 432000, LastSlot: 6*432000 - 1}}, routing.SlotRanges)
+
+	post := &fasthttp.RequestCtx{}
+	post.Request.Header.SetMethod("POST")
+	post.Request.SetRequestURI(routingPath)
+	require.False(t, isRoutingRequest(post))
+}
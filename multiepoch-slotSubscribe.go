@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rpcpool/yellowstone-faithful/compactindexsized"
+	"github.com/sourcegraph/jsonrpc2"
+	"k8s.io/klog/v2"
+)
+
+// The faithful subscriptions emulate slotSubscribe over WebSocket with the archived slots:
+// they are emitted in sequence at a configurable rate, so that real-time consumers can be
+// tested against deterministic historical data.
+
+const (
+	defaultSlotSubscribeSlotsPerSecond = 2.5
+	maxSlotSubscribeSlotsPerSecond     = 1000
+	maxSlotSubscriptionsPerConnection  = 16
+)
+
+// archivedSlot is a slot with a block in the archive.
+type archivedSlot struct {
+	Slot      uint64
+	Parent    uint64
+	BlockTime int64
+}
+
+// slotNotification is the result of faithful_slotNotification, like the one of slotNotification
+// (everything in the archive is rooted, so root is the slot itself).
+type slotNotification struct {
+	Slot   uint64 `json:"slot"`
+	Parent uint64 `json:"parent"`
+	Root   uint64 `json:"root"`
+}
+
+type slotSubscribeParams struct {
+	// StartSlot and EndSlot (included) default to the first and last available slots.
+	StartSlot *uint64 `json:"startSlot"`
+	EndSlot   *uint64 `json:"endSlot"`
+	// SlotsPerSecond is the rate of the notifications, unless RealTime is set: then the slots
+	// are emitted at the pace of their block times, accelerated by Speed.
+	SlotsPerSecond *float64 `json:"slotsPerSecond"`
+	RealTime       bool     `json:"realTime"`
+	Speed          *float64 `json:"speed"`
+}
+
+func parseSlotSubscribeParams(raw json.RawMessage) (*slotSubscribeParams, error) {
+	params := &slotSubscribeParams{}
+	if len(raw) == 0 || string(raw) == "null" {
+		return params, nil
+	}
+	var list []slotSubscribeParams
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("expected params [{\"startSlot\": ..., \"endSlot\": ..., \"slotsPerSecond\": ...}]: %w", err)
+	}
+	if len(list) > 1 {
+		return nil, fmt.Errorf("expected at most 1 param, got %d", len(list))
+	}
+	if len(list) == 1 {
+		params = &list[0]
+	}
+	return params, nil
+}
+
+// pacing returns the pacing of the notifications.
+func (p *slotSubscribeParams) pacing() (replayPacing, error) {
+	pacing := replayPacing{
+		SlotsPerSecond: defaultSlotSubscribeSlotsPerSecond,
+		RealTime:       p.RealTime,
+		Speed:          1,
+	}
+	if p.SlotsPerSecond != nil {
+		pacing.SlotsPerSecond = *p.SlotsPerSecond
+		if pacing.SlotsPerSecond <= 0 || pacing.SlotsPerSecond > maxSlotSubscribeSlotsPerSecond {
+			return pacing, fmt.Errorf("slotsPerSecond must be in (0, %d]", maxSlotSubscribeSlotsPerSecond)
+		}
+	}
+	if p.Speed != nil {
+		pacing.Speed = *p.Speed
+		if pacing.Speed <= 0 {
+			return pacing, fmt.Errorf("speed must be positive")
+		}
+	}
+	if p.RealTime {
+		pacing.SlotsPerSecond = 0
+	}
+	return pacing, nil
+}
+
+// nextArchivedSlot returns the first slot of [from, to] that has a block in the archive,
+// skipping the epochs that are not loaded.
+func (multi *MultiEpoch) nextArchivedSlot(ctx context.Context, from uint64, to uint64) (archivedSlot, bool, error) {
+	for slot := from; slot <= to; slot++ {
+		if err := ctx.Err(); err != nil {
+			return archivedSlot{}, false, err
+		}
+		epochNumber := CalcEpochForSlot(slot)
+		epochHandler, err := multi.GetEpoch(epochNumber)
+		if err != nil {
+			next, ok := multi.nextEpochNumber(epochNumber)
+			if !ok {
+				return archivedSlot{}, false, nil
+			}
+			start, _ := CalcEpochLimits(next)
+			slot = start - 1
+			continue
+		}
+		block, _, err := epochHandler.GetBlock(ctx, slot)
+		if err != nil {
+			if errors.Is(err, compactindexsized.ErrNotFound) {
+				// skipped, or missing in the archive: either way there's no slot to emit.
+				continue
+			}
+			return archivedSlot{}, false, fmt.Errorf("failed to get block %d: %w", slot, err)
+		}
+		return archivedSlot{
+			Slot:      slot,
+			Parent:    uint64(block.Meta.Parent_slot),
+			BlockTime: int64(block.Meta.Blocktime),
+		}, true, nil
+	}
+	return archivedSlot{}, false, nil
+}
+
+// nextEpochNumber returns the first loaded epoch after the given one.
+func (multi *MultiEpoch) nextEpochNumber(epoch uint64) (uint64, bool) {
+	numbers := multi.GetEpochNumbers()
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers {
+		if number > epoch {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+// availableSlots returns the first and last slots of the archive.
+func (multi *MultiEpoch) availableSlots(ctx context.Context) (uint64, uint64, error) {
+	first, err := multi.GetFirstAvailableBlock(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get the first available block: %w", err)
+	}
+	last, err := multi.GetMostRecentAvailableBlock(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get the most recent available block: %w", err)
+	}
+	return uint64(first.Slot), uint64(last.Slot), nil
+}
+
+// serveSlotSubscriptions serves the faithful subscriptions of a WebSocket connection.
+func (multi *MultiEpoch) serveSlotSubscriptions(conn *wsConn) {
+	session := &slotSubscriptionSession{
+		conn:           conn,
+		nextSlot:       multi.nextArchivedSlot,
+		availableSlots: multi.availableSlots,
+	}
+	session.serve(context.Background())
+}
+
+// slotSubscriptionSession is the state of the subscriptions of a connection.
+type slotSubscriptionSession struct {
+	conn           *wsConn
+	nextSlot       func(ctx context.Context, from uint64, to uint64) (archivedSlot, bool, error)
+	availableSlots func(ctx context.Context) (uint64, uint64, error)
+
+	mu            sync.Mutex
+	lastID        uint64
+	subscriptions map[uint64]context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+type wsRequest struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type wsResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result,omitempty"`
+	Error   *jsonrpc2.Error  `json:"error,omitempty"`
+}
+
+type wsNotification struct {
+	JSONRPC string                   `json:"jsonrpc"`
+	Method  string                   `json:"method"`
+	Params  wsNotificationParameters `json:"params"`
+}
+
+type wsNotificationParameters struct {
+	Result       *slotNotification `json:"result"`
+	Subscription uint64            `json:"subscription"`
+}
+
+// serve handles the requests of the connection, until it's closed.
+func (s *slotSubscriptionSession) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		// stop the subscriptions with the connection.
+		cancel()
+		s.wg.Wait()
+	}()
+	s.subscriptions = make(map[uint64]context.CancelFunc)
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, errWebSocketClosed) {
+				klog.V(2).Infof("websocket: %v", err)
+			}
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			s.reply(nil, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeParseError, Message: "Parse error"})
+			continue
+		}
+		switch req.Method {
+		case "faithful_slotSubscribe":
+			id, run, rpcErr := s.subscribe(ctx, req.Params)
+			if rpcErr != nil {
+				s.reply(req.ID, nil, rpcErr)
+				continue
+			}
+			// the notifications start after the subscription id is sent.
+			s.reply(req.ID, id, nil)
+			go run()
+		case "faithful_slotUnsubscribe":
+			var ids []uint64
+			if err := json.Unmarshal(req.Params, &ids); err != nil || len(ids) != 1 {
+				s.reply(req.ID, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "Invalid params: expected [<subscription id>]"})
+				continue
+			}
+			s.reply(req.ID, s.unsubscribe(ids[0]), nil)
+		default:
+			s.reply(req.ID, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: fmt.Sprintf("Method not found: %q", req.Method)})
+		}
+	}
+}
+
+func (s *slotSubscriptionSession) reply(id *json.RawMessage, result any, rpcErr *jsonrpc2.Error) {
+	buf, err := json.Marshal(wsResponse{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+	if err != nil {
+		klog.Errorf("websocket: failed to encode the response: %v", err)
+		return
+	}
+	if err := s.conn.WriteMessage(buf); err != nil {
+		klog.V(2).Infof("websocket: failed to reply: %v", err)
+	}
+}
+
+// subscribe registers a subscription, whose notifications are sent by run.
+func (s *slotSubscriptionSession) subscribe(ctx context.Context, rawParams json.RawMessage) (uint64, func(), *jsonrpc2.Error) {
+	params, err := parseSlotSubscribeParams(rawParams)
+	if err != nil {
+		return 0, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	pacing, err := params.pacing()
+	if err != nil {
+		return 0, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: "Invalid params: " + err.Error()}
+	}
+	startSlot, endSlot := params.StartSlot, params.EndSlot
+	if startSlot == nil || endSlot == nil {
+		first, last, err := s.availableSlots(ctx)
+		if err != nil {
+			klog.Errorf("websocket: %v", err)
+			return 0, nil, newInternalJSONRPCError()
+		}
+		if startSlot == nil {
+			startSlot = &first
+		}
+		if endSlot == nil {
+			endSlot = &last
+		}
+	}
+	if *startSlot > *endSlot {
+		return 0, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidParams, Message: fmt.Sprintf("Invalid params: startSlot %d is after endSlot %d", *startSlot, *endSlot)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subscriptions) >= maxSlotSubscriptionsPerConnection {
+		return 0, nil, &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: fmt.Sprintf("Too many subscriptions (max %d per connection)", maxSlotSubscriptionsPerConnection)}
+	}
+	s.lastID++
+	id := s.lastID
+	subCtx, cancel := context.WithCancel(ctx)
+	s.subscriptions[id] = cancel
+	s.wg.Add(1)
+	run := func() {
+		defer s.wg.Done()
+		defer s.unsubscribe(id)
+		if err := s.run(subCtx, id, *startSlot, *endSlot, newReplayPacer(pacing)); err != nil && !errors.Is(err, context.Canceled) {
+			klog.Errorf("websocket: subscription %d: %v", id, err)
+		}
+	}
+	return id, run, nil
+}
+
+func (s *slotSubscriptionSession) unsubscribe(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.subscriptions[id]
+	if ok {
+		cancel()
+		delete(s.subscriptions, id)
+	}
+	return ok
+}
+
+// run emits the archived slots of [startSlot, endSlot], then a notification with a null result.
+func (s *slotSubscriptionSession) run(ctx context.Context, id uint64, startSlot uint64, endSlot uint64, pacer *replayPacer) error {
+	next := startSlot
+	for next <= endSlot {
+		slot, ok, err := s.nextSlot(ctx, next, endSlot)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if err := pacer.waitBlock(ctx, slot.Slot, slot.BlockTime); err != nil {
+			return err
+		}
+		if err := s.notify(id, &slotNotification{Slot: slot.Slot, Parent: slot.Parent, Root: slot.Slot}); err != nil {
+			return err
+		}
+		next = slot.Slot + 1
+	}
+	return s.notify(id, nil)
+}
+
+func (s *slotSubscriptionSession) notify(id uint64, result *slotNotification) error {
+	buf, err := json.Marshal(wsNotification{
+		JSONRPC: "2.0",
+		Method:  "faithful_slotNotification",
+		Params:  wsNotificationParameters{Result: result, Subscription: id},
+	})
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteMessage(buf)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlotSubscribeParams(t *testing.T) {
+	params, err := parseSlotSubscribeParams(nil)
+	require.NoError(t, err)
+	pacing, err := params.pacing()
+	require.NoError(t, err)
+	require.Equal(t, defaultSlotSubscribeSlotsPerSecond, pacing.SlotsPerSecond)
+
+	params, err = parseSlotSubscribeParams([]byte(`[{"startSlot": 10, "endSlot": 20, "realTime": true, "speed": 2}]`))
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), *params.StartSlot)
+	require.Equal(t, uint64(20), *params.EndSlot)
+	pacing, err = params.pacing()
+	require.NoError(t, err)
+	require.True(t, pacing.RealTime)
+	require.Equal(t, 2.0, pacing.Speed)
+	require.Zero(t, pacing.SlotsPerSecond)
+
+	params, err = parseSlotSubscribeParams([]byte(`[{"slotsPerSecond": 5000}]`))
+	require.NoError(t, err)
+	_, err = params.pacing()
+	require.Error(t, err)
+
+	_, err = parseSlotSubscribeParams([]byte(`[{}, {}]`))
+	require.Error(t, err)
+}
+
+func TestSlotSubscriptionSession(t *testing.T) {
+	server, client := newWSTestPair()
+	archived := map[uint64]uint64{10: 9, 12: 10, 13: 12, 20: 13}
+	session := &slotSubscriptionSession{
+		conn: server,
+		nextSlot: func(ctx context.Context, from uint64, to uint64) (archivedSlot, bool, error) {
+			for slot := from; slot <= to; slot++ {
+				if parent, ok := archived[slot]; ok {
+					return archivedSlot{Slot: slot, Parent: parent}, true, nil
+				}
+			}
+			return archivedSlot{}, false, nil
+		},
+		availableSlots: func(ctx context.Context) (uint64, uint64, error) {
+			return 10, 20, nil
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		session.serve(context.Background())
+	}()
+
+	response := client.call(t, `{"jsonrpc":"2.0","id":1,"method":"faithful_slotSubscribe","params":[{"endSlot":13,"slotsPerSecond":1000}]}`)
+	require.Equal(t, float64(1), response["id"])
+	subscription := response["result"]
+	require.Equal(t, float64(1), subscription)
+
+	// the skipped slots are not emitted; root is the slot itself.
+	for _, expected := range []struct{ slot, parent float64 }{{10, 9}, {12, 10}, {13, 12}} {
+		notification := client.readMessage(t)
+		require.Equal(t, "faithful_slotNotification", notification["method"])
+		params := notification["params"].(map[string]any)
+		require.Equal(t, subscription, params["subscription"])
+		require.Equal(t, map[string]any{"slot": expected.slot, "parent": expected.parent, "root": expected.slot}, params["result"])
+	}
+	// the end of the range.
+	notification := client.readMessage(t)
+	require.Nil(t, notification["params"].(map[string]any)["result"])
+
+	// a slow subscription, stopped after its first slot.
+	response = client.call(t, `{"jsonrpc":"2.0","id":2,"method":"faithful_slotSubscribe","params":[{"startSlot":12,"slotsPerSecond":0.001}]}`)
+	require.Equal(t, float64(2), response["result"])
+	notification = client.readMessage(t)
+	require.Equal(t, float64(12), notification["params"].(map[string]any)["result"].(map[string]any)["slot"])
+	response = client.call(t, `{"jsonrpc":"2.0","id":3,"method":"faithful_slotUnsubscribe","params":[2]}`)
+	require.Equal(t, true, response["result"])
+	response = client.call(t, `{"jsonrpc":"2.0","id":4,"method":"faithful_slotUnsubscribe","params":[99]}`)
+	require.Equal(t, false, response["result"])
+
+	response = client.call(t, `{"jsonrpc":"2.0","id":5,"method":"faithful_slotSubscribe","params":[{"startSlot":20,"endSlot":10}]}`)
+	require.NotNil(t, response["error"])
+
+	response = client.call(t, `{"jsonrpc":"2.0","id":6,"method":"getSlot"}`)
+	require.NotNil(t, response["error"])
+
+	client.conn.Close()
+	<-done
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"k8s.io/klog/v2"
+)
+
+// The read-only status page, for the users of a public endpoint to check what the archive serves:
+//
+//	GET /status       -> HTML
+//	GET /status.json  -> JSON
+const (
+	statusPathHTML = "/status"
+	statusPathJSON = "/status.json"
+)
+
+// processStartedAt is when the server started, for the uptime of the status page.
+var processStartedAt = time.Now()
+
+// statusWindows are the windows of the recent error rates of the status page.
+var statusWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Status is the content of the status page.
+type Status struct {
+	Version       string         `json:"version"`
+	Commit        string         `json:"commit"`
+	StartedAt     time.Time      `json:"startedAt"`
+	UptimeSeconds int64          `json:"uptimeSeconds"`
+	Epochs        []EpochStatus  `json:"epochs"`
+	ErrorRates    []RecentErrors `json:"errorRates"`
+}
+
+// EpochStatus is a loaded epoch, with the slots it covers.
+type EpochStatus struct {
+	Epoch uint64 `json:"epoch"`
+	// FirstSlot and LastSlot are the slots of the epoch.
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+	// Coverage is the range of the slots of the blocks in the archive (nil if unknown): the slots
+	// in the range that have no block were skipped, the ones outside of it are not in the archive.
+	Coverage *SlotCoverageStatus `json:"coverage"`
+	// HasGsfa is true if getSignaturesForAddress is served for the epoch.
+	HasGsfa bool `json:"hasGsfa"`
+}
+
+// SlotCoverageStatus is the slot coverage of an epoch.
+type SlotCoverageStatus struct {
+	FirstSlot  uint64 `json:"firstSlot"`
+	LastSlot   uint64 `json:"lastSlot"`
+	NumBlocks  uint64 `json:"numBlocks"`
+	NumSkipped uint64 `json:"numSkipped"`
+}
+
+// RecentErrors is the share of the requests that failed during a recent window.
+type RecentErrors struct {
+	Window   string  `json:"window"`
+	Requests uint64  `json:"requests"`
+	Failures uint64  `json:"failures"`
+	Rate     float64 `json:"rate"`
+}
+
+// Status returns the content of the status page.
+func (m *MultiEpoch) Status() *Status {
+	now := time.Now()
+	status := &Status{
+		Version:       GitTag,
+		Commit:        GitCommit,
+		StartedAt:     processStartedAt.UTC(),
+		UptimeSeconds: int64(now.Sub(processStartedAt).Seconds()),
+		Epochs:        make([]EpochStatus, 0),
+	}
+	numbers := m.GetEpochNumbers()
+	// oldest first.
+	for i := len(numbers) - 1; i >= 0; i-- {
+		epoch, err := m.GetEpoch(numbers[i])
+		if err != nil {
+			continue
+		}
+		firstSlot, lastSlot := CalcEpochLimits(epoch.Epoch())
+		epochStatus := EpochStatus{
+			Epoch:     epoch.Epoch(),
+			FirstSlot: firstSlot,
+			LastSlot:  lastSlot,
+			HasGsfa:   epoch.gsfaReader != nil,
+		}
+		if coverage, ok := epoch.SlotCoverage(); ok {
+			epochStatus.Coverage = &SlotCoverageStatus{
+				FirstSlot:  coverage.FirstSlot,
+				LastSlot:   coverage.LastSlot,
+				NumBlocks:  coverage.NumBlocks,
+				NumSkipped: coverage.NumSkipped(),
+			}
+		}
+		status.Epochs = append(status.Epochs, epochStatus)
+	}
+	for _, window := range statusWindows {
+		requests, failures := m.recentRequests.window(window)
+		recent := RecentErrors{
+			Window:   window.String(),
+			Requests: requests,
+			Failures: failures,
+		}
+		if requests > 0 {
+			recent.Rate = float64(failures) / float64(requests)
+		}
+		status.ErrorRates = append(status.ErrorRates, recent)
+	}
+	return status
+}
+
+// isStatusRequest returns true if the request is for the status page.
+func isStatusRequest(reqCtx *fasthttp.RequestCtx) bool {
+	if !reqCtx.IsGet() && !reqCtx.IsHead() {
+		return false
+	}
+	path := string(reqCtx.Path())
+	return path == statusPathHTML || path == statusPathJSON
+}
+
+func (m *MultiEpoch) handleStatusRequest(reqCtx *fasthttp.RequestCtx) {
+	status := m.Status()
+	reqCtx.Response.Header.Set("Cache-Control", "no-cache")
+	if string(reqCtx.Path()) == statusPathJSON {
+		replyJSON(reqCtx, http.StatusOK, status)
+		return
+	}
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, status); err != nil {
+		klog.Errorf("failed to render the status page: %v", err)
+		reqCtx.Error("Internal error", http.StatusInternalServerError)
+		return
+	}
+	reqCtx.SetContentType("text/html; charset=utf-8")
+	reqCtx.SetStatusCode(http.StatusOK)
+	reqCtx.SetBody(buf.Bytes())
+}
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"percent": func(rate float64) string {
+		return fmt.Sprintf("%.2f%%", rate*100)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Old Faithful status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Old Faithful status</h1>
+<p>Version {{.Version}} ({{.Commit}}), up since {{.StartedAt.Format "2006-01-02 15:04:05 MST"}} ({{.UptimeSeconds}}s). Also available as <a href="/status.json">JSON</a>.</p>
+<h2>Epochs</h2>
+<p>A slot in the covered range that has no block was skipped; a slot outside of it is not in this archive.</p>
+<table>
+<tr><th>Epoch</th><th>Slots</th><th>Covered slots</th><th>Blocks</th><th>Skipped</th><th>getSignaturesForAddress</th></tr>
+{{range .Epochs}}<tr><td>{{.Epoch}}</td><td>{{.FirstSlot}} - {{.LastSlot}}</td>{{with .Coverage}}<td>{{.FirstSlot}} - {{.LastSlot}}</td><td>{{.NumBlocks}}</td><td>{{.NumSkipped}}</td>{{else}}<td colspan="3">unknown</td>{{end}}<td>{{if .HasGsfa}}yes{{else}}no{{end}}</td></tr>
+{{else}}<tr><td colspan="6">no epochs loaded</td></tr>
+{{end}}</table>
+<h2>Recent errors</h2>
+<table>
+<tr><th>Window</th><th>Requests</th><th>Failures</th><th>Error rate</th></tr>
+{{range .ErrorRates}}<tr><td>{{.Window}}</td><td>{{.Requests}}</td><td>{{.Failures}}</td><td>{{percent .Rate}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// recentRequestStats counts the requests and their failures by minute, over the last recentStatsMinutes minutes.
+type recentRequestStats struct {
+	mu      sync.Mutex
+	buckets [recentStatsMinutes]recentStatsBucket
+	now     func() time.Time
+}
+
+const recentStatsMinutes = 15
+
+type recentStatsBucket struct {
+	minute   int64
+	requests uint64
+	failures uint64
+}
+
+func newRecentRequestStats() *recentRequestStats {
+	return &recentRequestStats{now: time.Now}
+}
+
+// record counts a request.
+func (s *recentRequestStats) record(failed bool) {
+	minute := s.now().Unix() / 60
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := &s.buckets[minute%recentStatsMinutes]
+	if bucket.minute != minute {
+		*bucket = recentStatsBucket{minute: minute}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+}
+
+// window returns the requests and failures of the last d (rounded up to minutes, at most recentStatsMinutes).
+func (s *recentRequestStats) window(d time.Duration) (requests uint64, failures uint64) {
+	minutes := int64((d + time.Minute - 1) / time.Minute)
+	now := s.now().Unix() / 60
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bucket := range s.buckets {
+		if bucket.minute > now-minutes && bucket.minute <= now {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRecentRequestStats(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	stats := newRecentRequestStats()
+	stats.now = func() time.Time { return now }
+
+	stats.record(false)
+	stats.record(true)
+	now = now.Add(3 * time.Minute)
+	stats.record(false)
+
+	requests, failures := stats.window(time.Minute)
+	require.Equal(t, uint64(1), requests)
+	require.Equal(t, uint64(0), failures)
+	requests, failures = stats.window(5 * time.Minute)
+	require.Equal(t, uint64(3), requests)
+	require.Equal(t, uint64(1), failures)
+
+	// the buckets older than the window are reused.
+	now = now.Add(recentStatsMinutes * time.Minute)
+	stats.record(true)
+	requests, failures = stats.window(recentStatsMinutes * time.Minute)
+	require.Equal(t, uint64(1), requests)
+	require.Equal(t, uint64(1), failures)
+}
+
+func TestStatusPage(t *testing.T) {
+	multi := NewMultiEpoch(&Options{})
+	require.NoError(t, multi.AddEpoch(2, &Epoch{epoch: 2, config: &Config{}}))
+	multi.recentRequests.record(false)
+	multi.recentRequests.record(true)
+
+	request := func(path string) *fasthttp.RequestCtx {
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Request.Header.SetMethod("GET")
+		reqCtx.Request.SetRequestURI(path)
+		require.True(t, isStatusRequest(reqCtx))
+		multi.handleStatusRequest(reqCtx)
+		require.Equal(t, 200, reqCtx.Response.StatusCode())
+		return reqCtx
+	}
+
+	var status Status
+	require.NoError(t, json.Unmarshal(request("/status.json").Response.Body(), &status))
+	require.Len(t, status.Epochs, 1)
+	require.Equal(t, uint64(2), status.Epochs[0].Epoch)
+	require.Equal(t, uint64(2*432000), status.Epochs[0].FirstSlot)
+	require.Equal(t, uint64(3*432000-1), status.Epochs[0].LastSlot)
+	// no slot-to-cid index, no coverage.
+	require.Nil(t, status.Epochs[0].Coverage)
+	require.Equal(t, "1m0s", status.ErrorRates[0].Window)
+	require.Equal(t, uint64(2), status.ErrorRates[0].Requests)
+	require.Equal(t, 0.5, status.ErrorRates[0].Rate)
+
+	html := request("/status")
+	require.True(t, strings.HasPrefix(string(html.Response.Header.ContentType()), "text/html"))
+	require.Contains(t, string(html.Response.Body()), "<td>2</td><td>864000 - 1295999</td><td colspan=\"3\">unknown</td>")
+	require.Contains(t, string(html.Response.Body()), "50.00%")
+
+	post := &fasthttp.RequestCtx{}
+	post.Request.Header.SetMethod("POST")
+	post.Request.SetRequestURI("/status")
+	require.False(t, isStatusRequest(post))
+}
@@ -10,11 +10,12 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/goware/urlx"
 	"github.com/libp2p/go-reuseport"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	"github.com/sourcegraph/jsonrpc2"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
@@ -24,22 +25,58 @@ import (
 type Options struct {
 	GsfaOnlySignatures     bool
 	EpochSearchConcurrency int
+	EpochSearchOrder       EpochSearchOrder
+	// CompatMethods are the enabled compatibility methods (see ParseCompatMethods).
+	CompatMethods map[string]bool
+	// LargeIntsAsStrings makes the responses return the integers above 2^53-1 as strings
+	// (unless the request says otherwise, see wantsLargeIntsAsStrings).
+	LargeIntsAsStrings bool
+	// ApiVersion is the API version of the requests that don't select one (see requestApiVersion).
+	ApiVersion ApiVersion
+	// RequestTimeout is the deadline of the requests (shortened by their X-Timeout-Ms header,
+	// see requestTimeout); no deadline if 0.
+	RequestTimeout time.Duration
+	// MaxBlockTransactions is the max number of transactions of the blocks that getBlock returns
+	// in full (with transactionDetails full or accounts); no limit if 0.
+	MaxBlockTransactions int
+	// BlockAssemblyCache (optional) caches the blocks read by getBlock, whatever the encoding.
+	BlockAssemblyCache *BlockAssemblyCache
 }
 
 type MultiEpoch struct {
 	mu      sync.RWMutex
 	options *Options
 	epochs  map[uint64]*Epoch
+	// leases keeps the removed and replaced epochs open until the requests using them are done.
+	leases *epochLeases
+	// recentRequests counts the recent requests and failures, for the status page.
+	recentRequests *recentRequestStats
 }
 
 func NewMultiEpoch(options *Options) *MultiEpoch {
 	return &MultiEpoch{
-		options: options,
-		epochs:  make(map[uint64]*Epoch),
+		options:        options,
+		epochs:         make(map[uint64]*Epoch),
+		leases:         newEpochLeases(),
+		recentRequests: newRecentRequestStats(),
 	}
 }
 
+// GetEpoch returns the epoch that serves the requests for the given epoch: the epoch, or its
+// standby while the standby is promoted.
 func (m *MultiEpoch) GetEpoch(epoch uint64) (*Epoch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ep, ok := m.epochs[epoch]
+	if !ok {
+		return nil, fmt.Errorf("epoch %d not found", epoch)
+	}
+	return ep.serving(), nil
+}
+
+// getLoadedEpoch returns the epoch itself, even while its standby serves it (see GetEpoch); it's for
+// the maintenance of its files.
+func (m *MultiEpoch) getLoadedEpoch(epoch uint64) (*Epoch, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	ep, ok := m.epochs[epoch]
@@ -81,7 +118,7 @@ func (m *MultiEpoch) RemoveEpochByConfigFilepath(configFilepath string) (uint64,
 	defer m.mu.Unlock()
 	for epoch, ep := range m.epochs {
 		if ep.config.ConfigFilepath() == configFilepath {
-			ep.Close()
+			m.leases.detach(ep)
 			delete(m.epochs, epoch)
 			return epoch, nil
 		}
@@ -102,9 +139,9 @@ func (m *MultiEpoch) ReplaceEpoch(epoch uint64, ep *Epoch) error {
 func (m *MultiEpoch) ReplaceOrAddEpoch(epoch uint64, ep *Epoch) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	// if the epoch already exists, close it
-	if oldEp, ok := m.epochs[epoch]; ok {
-		oldEp.Close()
+	// if the epoch already exists, close it once the requests in flight are done with it.
+	if oldEp, ok := m.epochs[epoch]; ok && oldEp != ep {
+		m.leases.detach(oldEp)
 	}
 	m.epochs[epoch] = ep
 	return nil
@@ -146,7 +183,7 @@ func (m *MultiEpoch) GetMostRecentAvailableEpoch() (*Epoch, error) {
 	defer m.mu.RUnlock()
 	numbers := m.GetEpochNumbers()
 	if len(numbers) > 0 {
-		return m.epochs[numbers[0]], nil
+		return m.epochs[numbers[0]].serving(), nil
 	}
 	return nil, fmt.Errorf("no epochs available")
 }
@@ -156,7 +193,7 @@ func (m *MultiEpoch) GetOldestAvailableEpoch() (*Epoch, error) {
 	defer m.mu.RUnlock()
 	numbers := m.GetEpochNumbers()
 	if len(numbers) > 0 {
-		return m.epochs[numbers[len(numbers)-1]], nil
+		return m.epochs[numbers[len(numbers)-1]].serving(), nil
 	}
 	return nil, fmt.Errorf("no epochs available")
 }
@@ -192,11 +229,25 @@ func (m *MultiEpoch) Close() error {
 	for _, ep := range m.epochs {
 		ep.Close()
 	}
+	m.leases.closeAll()
 	return nil
 }
 
 type ListenerConfig struct {
 	ProxyConfig *ProxyConfig
+	// ResponseCache (optional) caches the results of cacheable requests.
+	ResponseCache *ResponseCache
+	// AuditLog (optional) records the data served to the clients.
+	AuditLog *AuditLog
+	// SlowQueryLog (optional) records the requests that took too long.
+	SlowQueryLog *SlowQueryLog
+	// LoadShedder (optional) rejects low priority requests when the storage is saturated.
+	LoadShedder *LoadShedder
+	// Priorities (optional) assigns priority classes to methods and clients.
+	Priorities *PriorityConfig
+	// Middlewares (optional) is the pipeline of the JSON-RPC requests, with the steps of the
+	// embedders; by default, only the built-in steps (see NewMiddlewareChain).
+	Middlewares *MiddlewareChain
 }
 
 type ProxyConfig struct {
@@ -250,10 +301,9 @@ func (m *MultiEpoch) ListenAndServe(ctx context.Context, listenOn string, lsConf
 	return s.Serve(ln)
 }
 
-func randomRequestID() string {
-	id := uuid.New().String()
-	return id
-}
+// maxRequestBodySize is the maximum size of a JSON-RPC request body;
+// it must fit a faithful_getTransactions request with the max number of signatures.
+const maxRequestBodySize = 16 * 1024
 
 func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx *fasthttp.RequestCtx) {
 	// create a transparent reverse proxy
@@ -274,23 +324,162 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 		}
 		klog.Infof("Will proxy unhandled RPC methods to %q", addr)
 	}
+	var responseCache *ResponseCache
+	var auditLog *AuditLog
+	var slowQueryLog *SlowQueryLog
+	var loadShedder *LoadShedder
+	var priorities *PriorityConfig
+	if lsConf != nil {
+		responseCache = lsConf.ResponseCache
+		auditLog = lsConf.AuditLog
+		slowQueryLog = lsConf.SlowQueryLog
+		loadShedder = lsConf.LoadShedder
+		priorities = lsConf.Priorities
+	}
+	middlewares := NewMiddlewareChain()
+	if lsConf != nil && lsConf.Middlewares != nil {
+		middlewares = lsConf.Middlewares
+	}
+	builtinMiddlewares := map[string]RPCMiddleware{
+		MiddlewareRateLimit: rateLimitMiddleware(priorities, loadShedder),
+		MiddlewareMetrics:   metricsMiddleware,
+	}
+	if responseCache != nil {
+		builtinMiddlewares[MiddlewareCache] = cacheMiddleware(responseCache)
+	}
+	serveRPC := middlewares.then(builtinMiddlewares, func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		if call.Request.Method == "getVersion" {
+			versionInfo := make(map[string]any)
+			faithfulVersion := handler.GetFaithfulVersionInfo()
+			versionInfo["faithful"] = faithfulVersion
+
+			solanaVersion := handler.GetSolanaVersionInfo()
+			for k, v := range solanaVersion {
+				versionInfo[k] = v
+			}
+
+			if err := call.Reply(ctx, versionInfo); err != nil {
+				return nil, fmt.Errorf("failed to reply to getVersion: %w", err)
+			}
+			return nil, nil
+		}
+		return handler.handleRequest(ctx, call.conn, call.Request)
+	})
+	metricsHandler := fasthttpadaptor.NewFastHTTPHandler(
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			// needed for the exemplars.
+			EnableOpenMetrics: true,
+		}),
+	)
 	return func(reqCtx *fasthttp.RequestCtx) {
 		startedAt := time.Now()
-		reqID := randomRequestID()
+		reqID := requestIDFromRequest(reqCtx)
+		reqCtx.Response.Header.Set("X-Request-ID", reqID)
+		traceID := traceIDFromRequest(reqCtx)
+		timings := &requestTimings{}
+		// reads counts what the request touched, once it's served.
+		var reads *readAmplification
 		var method string = "<unknown>"
+		// failed is set when the request gets an error response.
+		var failed bool
+		// parsedRequest is the JSON-RPC request, once parsed.
+		var parsedRequest *jsonrpc2.Request
 		defer func() {
-			klog.V(2).Infof("[%s] request %q took %s", reqID, sanitizeMethod(method), time.Since(startedAt))
+			took := time.Since(startedAt)
+			if method != "/metrics" && method != statusPathHTML {
+				handler.recentRequests.record(failed || reqCtx.Response.StatusCode() >= 400)
+			}
+			klog.V(2).Infof("[%s] request %q took %s", reqID, sanitizeMethod(method), took)
 			metrics_statusCode.WithLabelValues(fmt.Sprint(reqCtx.Response.StatusCode())).Inc()
-			metrics_responseTimeHistogram.WithLabelValues(sanitizeMethod(method)).Observe(time.Since(startedAt).Seconds())
+			observeWithTraceID(metrics_responseTimeHistogram.WithLabelValues(sanitizeMethod(method)), took.Seconds(), traceID)
+			var readReport *ReadAmplificationReport
+			if reads != nil && !reqCtx.Response.IsBodyStream() {
+				readReport = reads.report(len(reqCtx.Response.Body()))
+				readReport.observe(sanitizeMethod(method), traceID)
+			}
+			if slowQueryLog != nil && slowQueryLog.IsSlow(took) {
+				entry := &SlowQueryEntry{
+					Time:      startedAt.UTC(),
+					RequestID: reqID,
+					TraceID:   traceID,
+					Method:    sanitizeMethod(method),
+					Duration:  took,
+					Status:    reqCtx.Response.StatusCode(),
+					Phases:    timings.get(),
+					Reads:     readReport,
+				}
+				if parsedRequest != nil && parsedRequest.Params != nil {
+					entry.Params = string(*parsedRequest.Params)
+				} else if method != "/metrics" {
+					entry.Params = string(reqCtx.URI().QueryString())
+				}
+				if err := slowQueryLog.Write(entry); err != nil {
+					rpcLog.Error("failed to write slow-query log", logging.RequestID(reqID), logging.Err(err))
+				}
+			}
 		}()
 		{
 			// handle the /metrics endpoint
 			if string(reqCtx.Path()) == "/metrics" {
 				method = "/metrics"
-				handler := fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
-				handler(reqCtx)
+				metricsHandler(reqCtx)
+				return
+			}
+		}
+		if isStatusRequest(reqCtx) {
+			method = statusPathHTML
+			handler.handleStatusRequest(reqCtx)
+			return
+		}
+		if isRoutingRequest(reqCtx) {
+			method = routingPath
+			handler.handleRoutingRequest(reqCtx)
+			return
+		}
+		if isWebSocketUpgrade(reqCtx) {
+			// the faithful subscriptions (faithful_slotSubscribe), served after the handshake.
+			method = "websocket"
+			upgradeWebSocket(reqCtx, handler.serveSlotSubscriptions)
+			return
+		}
+		if auditLog != nil {
+			defer func() {
+				auditLog.record(reqCtx, reqID, method, parsedRequest)
+			}()
+		}
+		// deferred after the logs and metrics, so that they see the error response.
+		defer func() {
+			if r := recover(); r != nil {
+				err := newPanicError("http", r)
+				rpcLog.Error("recovered from panic while handling request",
+					logging.RequestID(reqID),
+					logging.String("method", sanitizeMethod(method)),
+					logging.Err(err),
+					logging.String("stack", string(err.stack)),
+				)
+				replyPanic(reqCtx, reqID, parsedRequest)
+			}
+		}()
+		reqCtx.Response.Header.Set("X-Trace-ID", traceID)
+		ctx := setRequestTimingsToContext(setRequestIDToContext(reqCtx, reqID), timings)
+		ctx, reads = withReadAmplification(ctx)
+		ctx = logging.ContextWithFields(ctx, logging.RequestID(reqID))
+		if timeout := handler.requestTimeout(reqCtx); timeout > 0 {
+			// the index lookups and node reads give up once the deadline is exceeded.
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if route := restRoute(reqCtx); route != "" {
+			method = route
+			priority := priorities.priorityOf(reqCtx, method)
+			metrics_requestsByPriority.WithLabelValues(priority.String()).Inc()
+			if loadShedder.reject(reqCtx, method, priority, nil) {
 				return
 			}
+			ctx = setRequestPriorityToContext(ctx, priority)
+			handler.handleRestRequest(ctx, reqCtx)
+			return
 		}
 		{
 			// make sure the method is POST
@@ -305,7 +494,7 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 			}
 
 			// limit request body size
-			if reqCtx.Request.Header.ContentLength() > 1024 {
+			if reqCtx.Request.Header.ContentLength() > maxRequestBodySize {
 				replyJSON(reqCtx, http.StatusRequestEntityTooLarge, jsonrpc2.Response{
 					Error: &jsonrpc2.Error{
 						Code:    jsonrpc2.CodeInvalidRequest,
@@ -318,12 +507,10 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 		// read request body
 		body := reqCtx.Request.Body()
 
-		reqCtx.Response.Header.Set("X-Request-ID", reqID)
-
 		// parse request
 		var rpcRequest jsonrpc2.Request
 		if err := fasterJson.Unmarshal(body, &rpcRequest); err != nil {
-			klog.Errorf("[%s] failed to parse request body: %v", err)
+			rpcLog.Error("failed to parse request body", logging.RequestID(reqID), logging.Err(err))
 			replyJSON(reqCtx, http.StatusBadRequest, jsonrpc2.Response{
 				Error: &jsonrpc2.Error{
 					Code:    jsonrpc2.CodeParseError,
@@ -333,6 +520,7 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 			return
 		}
 		method = rpcRequest.Method
+		parsedRequest = &rpcRequest
 		metrics_RpcRequestByMethod.WithLabelValues(sanitizeMethod(method)).Inc()
 		defer func() {
 			metrics_methodToCode.WithLabelValues(sanitizeMethod(method), fmt.Sprint(reqCtx.Response.StatusCode())).Inc()
@@ -341,7 +529,7 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 		klog.V(2).Infof("[%s] method=%q", reqID, sanitizeMethod(method))
 		klog.V(3).Infof("[%s] received request with body: %q", reqID, strings.TrimSpace(string(body)))
 
-		if proxy != nil && !isValidLocalMethod(rpcRequest.Method) {
+		if proxy != nil && !isValidLocalMethod(rpcRequest.Method) && !handler.isCompatMethod(rpcRequest.Method) {
 			klog.V(2).Infof("[%s] Unhandled method %q, proxying to %q", reqID, rpcRequest.Method, proxy.Addr)
 			// proxy the request to the target
 			proxyToAlternativeRPCServer(
@@ -357,36 +545,27 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 			return
 		}
 
-		rqCtx := &requestContext{ctx: reqCtx}
-
-		if method == "getVersion" {
-			versionInfo := make(map[string]any)
-			faithfulVersion := handler.GetFaithfulVersionInfo()
-			versionInfo["faithful"] = faithfulVersion
-
-			solanaVersion := handler.GetSolanaVersionInfo()
-			for k, v := range solanaVersion {
-				versionInfo[k] = v
-			}
-
-			err := rqCtx.ReplyRaw(
-				reqCtx,
-				rpcRequest.ID,
-				versionInfo,
-			)
-			if err != nil {
-				klog.Errorf("[%s] failed to reply to getVersion: %v", reqID, err)
-			}
-			return
+		rqCtx := &requestContext{
+			ctx:                reqCtx,
+			largeIntsAsStrings: handler.largeIntsAsStrings(reqCtx),
+			apiVersion:         handler.apiVersion(reqCtx),
 		}
+		reqCtx.Response.Header.Set(apiVersionHeader, string(rqCtx.apiVersion))
 
 		// errorResp is the error response to be sent to the client.
-		errorResp, err := handler.handleRequest(setRequestIDToContext(reqCtx, reqID), rqCtx, &rpcRequest)
+		errorResp, err := serveRPC(ctx, &RPCCall{
+			Request:   &rpcRequest,
+			HTTP:      reqCtx,
+			RequestID: reqID,
+			conn:      rqCtx,
+		})
+		errorResp, err = timeoutAware(ctx, errorResp, err)
 		if err != nil {
-			klog.Errorf("[%s] failed to handle %q: %v", reqID, sanitizeMethod(method), err)
+			rpcLog.Ctx(ctx).Error("failed to handle request", append([]logging.Field{logging.String("method", sanitizeMethod(method))}, errorLogFields(err)...)...)
 		}
 		if errorResp != nil {
-			metrics_methodToSuccessOrFailure.WithLabelValues(sanitizeMethod(method), "failure").Inc()
+			failed = true
+			errorResp = publicError(errorResp, reqID)
 			if proxy != nil && lsConf.ProxyConfig.ProxyFailedRequests {
 				klog.Warningf("[%s] Failed local method %q, proxying to %q", reqID, rpcRequest.Method, proxy.Addr)
 				// proxy the request to the target
@@ -419,7 +598,6 @@ func newMultiEpochHandler(handler *MultiEpoch, lsConf *ListenerConfig) func(ctx
 			}
 			return
 		}
-		metrics_methodToSuccessOrFailure.WithLabelValues(sanitizeMethod(method), "success").Inc()
 	}
 }
 
@@ -441,13 +619,18 @@ func proxyToAlternativeRPCServer(
 		}
 	}
 	proxyReq.Header.SetMethod("POST")
+	// propagate the request ID (and the trace context) to the downstream RPC server.
+	proxyReq.Header.Set("X-Request-ID", reqID)
+	if traceparent := reqCtx.Request.Header.Peek("traceparent"); len(traceparent) > 0 {
+		proxyReq.Header.SetBytesV("traceparent", traceparent)
+	}
 	proxyReq.Header.SetContentType("application/json")
 	proxyReq.SetRequestURI(lsConf.ProxyConfig.Target)
 	proxyReq.SetBody(body)
 	proxyResp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(proxyResp)
 	if err := proxy.Do(proxyReq, proxyResp); err != nil {
-		klog.Errorf("[%s] failed to proxy request: %v", reqID, err)
+		rpcLog.Error("failed to proxy request", logging.RequestID(reqID), logging.Err(err))
 		replyJSON(reqCtx, http.StatusInternalServerError, jsonrpc2.Response{
 			Error: &jsonrpc2.Error{
 				Code:    jsonrpc2.CodeInternalError,
@@ -457,11 +640,13 @@ func proxyToAlternativeRPCServer(
 		return
 	}
 	reqCtx.Response.Header.Set("Content-Type", "application/json")
+	// the response doesn't come from the archive.
+	reqCtx.Response.Header.Set("X-Faithful-Source", "upstream")
 	reqCtx.Response.SetStatusCode(proxyResp.StatusCode())
 	if rpcRequest.Method == "getVersion" {
 		enriched, err := handler.tryEnrichGetVersion(proxyResp.Body())
 		if err != nil {
-			klog.Errorf("[%s] failed to enrich getVersion response: %v", reqID, err)
+			rpcLog.Error("failed to enrich getVersion response", logging.RequestID(reqID), logging.Err(err))
 			reqCtx.Response.SetBody(proxyResp.Body())
 		} else {
 			reqCtx.Response.SetBody(enriched)
@@ -489,36 +674,28 @@ func allowOnlyAsciiPrintable(s string) string {
 	}, s)
 }
 
+// isValidLocalMethod returns true if the method is registered (see RegisterMethod).
 func isValidLocalMethod(method string) bool {
-	switch method {
-	case "getBlock", "getTransaction", "getSignaturesForAddress", "getBlockTime", "getGenesisHash", "getFirstAvailableBlock", "getSlot":
-		return true
-	default:
-		return false
-	}
+	_, ok := lookupMethod(method)
+	return ok
 }
 
 // jsonrpc2.RequestHandler interface
 func (ser *MultiEpoch) handleRequest(ctx context.Context, conn *requestContext, req *jsonrpc2.Request) (*jsonrpc2.Error, error) {
-	switch req.Method {
-	case "getBlock":
-		return ser.handleGetBlock(ctx, conn, req)
-	case "getTransaction":
-		return ser.handleGetTransaction(ctx, conn, req)
-	case "getSignaturesForAddress":
-		return ser.handleGetSignaturesForAddress(ctx, conn, req)
-	case "getBlockTime":
-		return ser.handleGetBlockTime(ctx, conn, req)
-	case "getGenesisHash":
-		return ser.handleGetGenesisHash(ctx, conn, req)
-	case "getFirstAvailableBlock":
-		return ser.handleGetFirstAvailableBlock(ctx, conn, req)
-	case "getSlot":
-		return ser.handleGetSlot(ctx, conn, req)
-	default:
-		return &jsonrpc2.Error{
-			Code:    jsonrpc2.CodeMethodNotFound,
-			Message: "Method not found",
-		}, fmt.Errorf("method not found")
+	// the epochs detached while the request is handled are kept open until it's done.
+	lease := ser.leases.begin()
+	defer ser.leases.end(lease)
+	if spec, ok := lookupMethod(req.Method); ok {
+		return spec.Handler(ser, ctx, conn, req)
+	}
+	if ser.isCompatMethod(req.Method) {
+		return ser.handleCompatMethod(ctx, conn, req)
+	}
+	if ser.isUnsupportedLiveMethod(req.Method) {
+		return errMethodUnsupported(req.Method, fmt.Errorf("the archive has no live state"))
 	}
+	return &jsonrpc2.Error{
+		Code:    jsonrpc2.CodeMethodNotFound,
+		Message: "Method not found",
+	}, fmt.Errorf("method not found")
 }
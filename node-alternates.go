@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/util"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+)
+
+// errNodeCidMismatch marks a node read from a CAR that is not the wanted one: the CAR has another
+// CID at the offset, or the data of the node don't hash to its CID.
+var errNodeCidMismatch = errors.New("CID mismatch")
+
+// verifyNodeCid checks that the data of a node hash to its CID.
+func verifyNodeCid(wantedCid cid.Cid, data []byte) error {
+	sum, err := wantedCid.Prefix().Sum(data)
+	if err != nil {
+		return fmt.Errorf("failed to hash the node %s: %w", wantedCid, err)
+	}
+	if !sum.Equals(wantedCid) {
+		return fmt.Errorf("%w: the data of %s hash to %s", errNodeCidMismatch, wantedCid, sum)
+	}
+	return nil
+}
+
+// alternateNodeSource is another source of the nodes of the CAR of an epoch (see AlternateSource).
+type alternateNodeSource interface {
+	Name() string
+	ReadNode(ctx context.Context, wantedCid cid.Cid, offsetAndSize *indexes.OffsetAndSize) ([]byte, error)
+	Close() error
+}
+
+func newAlternateNodeSource(source AlternateSource) alternateNodeSource {
+	if source.IPFSGateway != "" {
+		return &ipfsGatewaySource{
+			gateway:    strings.TrimSuffix(source.IPFSGateway, "/"),
+			httpClient: &http.Client{Timeout: 30 * time.Second},
+		}
+	}
+	return &carCopySource{uri: source.Car}
+}
+
+// carCopySource reads the nodes from a copy of the CAR, opened on first use.
+type carCopySource struct {
+	uri URI
+
+	mu      sync.Mutex
+	storage *carStorage
+	ref     *resourceRef
+}
+
+func (s *carCopySource) Name() string {
+	return redactURL(s.uri.String())
+}
+
+func (s *carCopySource) open(ctx context.Context) (*carStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.storage == nil {
+		storage, ref, err := acquireCarStorage(ctx, s.uri.String())
+		if err != nil {
+			return nil, err
+		}
+		s.storage, s.ref = storage, ref
+	}
+	return s.storage, nil
+}
+
+func (s *carCopySource) ReadNode(ctx context.Context, wantedCid cid.Cid, offsetAndSize *indexes.OffsetAndSize) ([]byte, error) {
+	storage, err := s.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if storage.remote != nil {
+		return readNodeFromReaderAtWithOffsetAndSize(storage.remote, wantedCid, offsetAndSize.Offset, offsetAndSize.Size)
+	}
+	dr, err := storage.local.DataReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local CAR data reader: %w", err)
+	}
+	section := make([]byte, offsetAndSize.Size)
+	if _, err := dr.ReadAt(section, int64(offsetAndSize.Offset)); err != nil {
+		return nil, err
+	}
+	return parseNodeFromSection(section, wantedCid)
+}
+
+func (s *carCopySource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ref == nil {
+		return nil
+	}
+	err := s.ref.Release()
+	s.storage, s.ref = nil, nil
+	return err
+}
+
+// ipfsGatewaySource fetches the nodes by CID from a trustless IPFS gateway, as raw blocks.
+type ipfsGatewaySource struct {
+	gateway    string
+	httpClient *http.Client
+}
+
+func (s *ipfsGatewaySource) Name() string {
+	return redactURL(s.gateway)
+}
+
+func (s *ipfsGatewaySource) ReadNode(ctx context.Context, wantedCid cid.Cid, _ *indexes.OffsetAndSize) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.gateway+"/ipfs/"+wantedCid.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the gateway returned %s for %s", resp.Status, wantedCid)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(util.MaxAllowedSectionSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) > uint64(util.MaxAllowedSectionSize) {
+		return nil, fmt.Errorf("the node %s from the gateway is bigger than util.MaxAllowedSectionSize", wantedCid)
+	}
+	return data, nil
+}
+
+func (s *ipfsGatewaySource) Close() error {
+	return nil
+}
+
+// openAlternates sets up the alternate sources of the CAR of the epoch (they're opened on first use).
+func (e *Epoch) openAlternates() {
+	if e.config.Data.Car == nil {
+		return
+	}
+	for _, source := range e.config.Data.Car.Alternates {
+		alternate := newAlternateNodeSource(source)
+		e.alternates = append(e.alternates, alternate)
+		e.onClose = append(e.onClose, alternate.Close)
+	}
+}
+
+// verifyNode checks that the node read from the CAR of the epoch (data, or readErr) is the wanted
+// one; when it's not, the node is read from the alternate sources of the CAR instead, and the
+// discrepancy is recorded. The data are hashed only if the epoch has alternate sources: without
+// them, only the CID of the CAR section is checked (by the read).
+func (e *Epoch) verifyNode(ctx context.Context, wantedCid cid.Cid, offsetAndSize *indexes.OffsetAndSize, data []byte, readErr error) ([]byte, error) {
+	err := readErr
+	if err == nil && len(e.alternates) > 0 {
+		err = verifyNodeCid(wantedCid, data)
+	}
+	if !errors.Is(err, errNodeCidMismatch) {
+		return data, err
+	}
+	discrepancy := NodeDiscrepancy{
+		FirstSeen: time.Now(),
+		Epoch:     e.Epoch(),
+		Cid:       wantedCid.String(),
+		Offset:    offsetAndSize.Offset,
+		Size:      offsetAndSize.Size,
+		Error:     err.Error(),
+	}
+	if car := e.config.Data.Car; car != nil {
+		discrepancy.Car = redactURL(car.URI.String())
+	}
+	defer func() {
+		discrepancy.LastSeen = time.Now()
+		nodeDiscrepancies.record(discrepancy)
+	}()
+	for _, alternate := range e.alternates {
+		alternateData, alternateErr := alternate.ReadNode(ctx, wantedCid, offsetAndSize)
+		if alternateErr == nil {
+			alternateErr = verifyNodeCid(wantedCid, alternateData)
+		}
+		if alternateErr != nil {
+			err = fmt.Errorf("%w; alternate %q: %v", err, alternate.Name(), alternateErr)
+			continue
+		}
+		discrepancy.RepairedFrom = alternate.Name()
+		return alternateData, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/stretchr/testify/require"
+)
+
+type failingNodeSource struct{}
+
+func (failingNodeSource) Name() string { return "failing" }
+func (failingNodeSource) ReadNode(context.Context, cid.Cid, *indexes.OffsetAndSize) ([]byte, error) {
+	return nil, errors.New("unavailable")
+}
+func (failingNodeSource) Close() error { return nil }
+
+func TestVerifyNodeFromAlternates(t *testing.T) {
+	data := []byte("the node")
+	nodeCid, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+	require.NoError(t, err)
+	require.NoError(t, verifyNodeCid(nodeCid, data))
+	require.ErrorIs(t, verifyNodeCid(nodeCid, []byte("the nodf")), errNodeCidMismatch)
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ipfs/"+nodeCid.String() || r.URL.Query().Get("format") != "raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer gateway.Close()
+
+	previous := nodeDiscrepancies
+	nodeDiscrepancies = &discrepancyLog{recent: make(map[string]*NodeDiscrepancy)}
+	defer func() { nodeDiscrepancies = previous }()
+
+	epoch := &Epoch{
+		epoch:  3,
+		config: &Config{},
+		alternates: []alternateNodeSource{
+			failingNodeSource{},
+			newAlternateNodeSource(AlternateSource{IPFSGateway: gateway.URL + "/"}),
+		},
+	}
+	oas := &indexes.OffsetAndSize{Offset: 100, Size: 50}
+
+	// the nodes that match their CID, and the other errors, are returned as they are.
+	got, err := epoch.verifyNode(context.Background(), nodeCid, oas, data, nil)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	_, err = epoch.verifyNode(context.Background(), nodeCid, oas, nil, errors.New("i/o error"))
+	require.EqualError(t, err, "i/o error")
+	require.Empty(t, nodeDiscrepancies.Recent())
+
+	// a corrupted node is read from the first alternate that has it.
+	for i := 0; i < 2; i++ {
+		got, err = epoch.verifyNode(context.Background(), nodeCid, oas, []byte("the nodf"), nil)
+		require.NoError(t, err)
+		require.Equal(t, data, got)
+	}
+	recent := nodeDiscrepancies.Recent()
+	require.Len(t, recent, 1)
+	require.Equal(t, nodeCid.String(), recent[0].Cid)
+	require.Equal(t, uint64(3), recent[0].Epoch)
+	require.Equal(t, uint64(100), recent[0].Offset)
+	require.Equal(t, gateway.URL, recent[0].RepairedFrom)
+	require.Equal(t, uint64(2), recent[0].Count)
+
+	// without an alternate that has it, the mismatch is surfaced.
+	epoch.alternates = epoch.alternates[:1]
+	otherCid, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum([]byte("other"))
+	require.NoError(t, err)
+	_, err = epoch.verifyNode(context.Background(), otherCid, oas, data, nil)
+	require.ErrorIs(t, err, errNodeCidMismatch)
+	require.ErrorContains(t, err, `alternate "failing": unavailable`)
+	recent = nodeDiscrepancies.Recent()
+	require.Len(t, recent, 2)
+	require.Equal(t, otherCid.String(), recent[0].Cid)
+	require.Empty(t, recent[0].RepairedFrom)
+
+	// without alternates, the data are not hashed: only a read error is a mismatch.
+	epoch.alternates = nil
+	got, err = epoch.verifyNode(context.Background(), nodeCid, oas, []byte("the nodf"), nil)
+	require.NoError(t, err)
+	require.Equal(t, []byte("the nodf"), got)
+	require.Len(t, nodeDiscrepancies.Recent(), 2)
+	_, err = epoch.verifyNode(context.Background(), nodeCid, oas, nil, fmt.Errorf("%w: expected %s, got %s", errNodeCidMismatch, nodeCid, otherCid))
+	require.ErrorIs(t, err, errNodeCidMismatch)
+	require.Len(t, nodeDiscrepancies.Recent(), 3)
+}
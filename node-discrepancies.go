@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// maxRecentDiscrepancies is the number of discrepancies kept in memory (for the admin API).
+const maxRecentDiscrepancies = 1000
+
+// NodeDiscrepancy is a node of a CAR that doesn't match its CID: the CAR (or its index) is
+// corrupted there, and must be repaired (e.g. by a scrubber, with the node from RepairedFrom).
+type NodeDiscrepancy struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     uint64    `json:"count"`
+	Epoch     uint64    `json:"epoch"`
+	Car       string    `json:"car"`
+	Cid       string    `json:"cid"`
+	Offset    uint64    `json:"offset"`
+	Size      uint64    `json:"size"`
+	Error     string    `json:"error"`
+	// RepairedFrom is the alternate source the node was read from (empty if none has it).
+	RepairedFrom string `json:"repairedFrom,omitempty"`
+}
+
+// discrepancyLog records the nodes that failed their CID verification; each node is
+// recorded once (then counted), in memory and in the (optional) JSONL file.
+type discrepancyLog struct {
+	mu     sync.Mutex
+	file   *os.File
+	recent map[string]*NodeDiscrepancy
+}
+
+// nodeDiscrepancies is where the epochs record their discrepancies.
+var nodeDiscrepancies = &discrepancyLog{recent: make(map[string]*NodeDiscrepancy)}
+
+// setDiscrepancyLogFile makes the discrepancies also appended (as JSON lines) to the file at
+// the given path; must be called before loading the epochs.
+func setDiscrepancyLogFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open discrepancy log: %w", err)
+	}
+	nodeDiscrepancies.mu.Lock()
+	defer nodeDiscrepancies.mu.Unlock()
+	nodeDiscrepancies.file = file
+	return nil
+}
+
+// record records the discrepancy.
+func (l *discrepancyLog) record(d NodeDiscrepancy) {
+	outcome := "unrepaired"
+	if d.RepairedFrom != "" {
+		outcome = "repaired"
+	}
+	metrics_nodeCidMismatches.WithLabelValues(strconv.FormatUint(d.Epoch, 10), outcome).Inc()
+
+	key := fmt.Sprintf("%d/%s", d.Epoch, d.Cid)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seen, ok := l.recent[key]; ok {
+		seen.Count++
+		seen.LastSeen = d.LastSeen
+		if seen.RepairedFrom == "" {
+			seen.RepairedFrom = d.RepairedFrom
+		}
+		return
+	}
+	klog.Warningf("Epoch %d: node %s at offset %d of %q doesn't match its CID (%s); repaired from: %q", d.Epoch, d.Cid, d.Offset, d.Car, d.Error, d.RepairedFrom)
+	if len(l.recent) >= maxRecentDiscrepancies {
+		l.evictOldestLocked()
+	}
+	d.Count = 1
+	l.recent[key] = &d
+	if l.file == nil {
+		return
+	}
+	line, err := fasterJson.Marshal(&d)
+	if err != nil {
+		return
+	}
+	// a single write per entry, so that lines are never interleaved.
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		klog.Errorf("failed to write to the discrepancy log: %v", err)
+	}
+}
+
+func (l *discrepancyLog) evictOldestLocked() {
+	var oldestKey string
+	var oldest time.Time
+	for key, d := range l.recent {
+		if oldestKey == "" || d.LastSeen.Before(oldest) {
+			oldestKey, oldest = key, d.LastSeen
+		}
+	}
+	delete(l.recent, oldestKey)
+}
+
+// Recent returns the recent discrepancies, the most recently seen first.
+func (l *discrepancyLog) Recent() []NodeDiscrepancy {
+	l.mu.Lock()
+	out := make([]NodeDiscrepancy, 0, len(l.recent))
+	for _, d := range l.recent {
+		out = append(out, *d)
+	}
+	l.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].LastSeen.After(out[j].LastSeen)
+	})
+	return out
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// panicError is the error that replaces a recovered panic.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("recovered from panic: %v", e.value)
+}
+
+// newPanicError is to be called with the value returned by recover();
+// it counts the panic in the metrics.
+func newPanicError(where string, value any) *panicError {
+	metrics_panicsRecovered.WithLabelValues(where).Inc()
+	return &panicError{
+		value: value,
+		stack: debug.Stack(),
+	}
+}
+
+// recoverPanic must be deferred; it converts a panic into an error, stored in *errp.
+func recoverPanic(where string, errp *error) {
+	if r := recover(); r != nil {
+		*errp = newPanicError(where, r)
+	}
+}
+
+// runRecovered runs fn, converting a panic into an error.
+func runRecovered(where string, fn func() error) (err error) {
+	defer recoverPanic(where, &err)
+	return fn()
+}
+
+// replyPanic replaces whatever was written of the response with an internal error.
+func replyPanic(reqCtx *fasthttp.RequestCtx, reqID string, req *jsonrpc2.Request) {
+	reqCtx.Response.Reset()
+	reqCtx.Response.Header.Set("X-Request-ID", reqID)
+	resp := jsonrpc2.Response{
+		Error: publicError(&jsonrpc2.Error{Code: jsonrpc2.CodeInternalError}, reqID),
+	}
+	if req != nil {
+		resp.ID = req.ID
+	}
+	replyJSON(reqCtx, http.StatusInternalServerError, resp)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRunRecovered(t *testing.T) {
+	err := runRecovered("test", func() error {
+		var m map[string]int
+		m["boom"] = 1
+		return nil
+	})
+	var perr *panicError
+	require.ErrorAs(t, err, &perr)
+	require.Contains(t, err.Error(), "assignment to entry in nil map")
+	require.NotEmpty(t, perr.stack)
+
+	expected := errors.New("plain")
+	require.Equal(t, expected, runRecovered("test", func() error { return expected }))
+}
+
+func TestPoolGroupRecoversPanics(t *testing.T) {
+	pool := newWorkerPool(2)
+	wg, _ := pool.Group(context.Background())
+	wg.Go(func() error {
+		panic("task failed")
+	})
+	wg.Go(func() error {
+		return nil
+	})
+	err := wg.Wait()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "task failed")
+	require.Equal(t, 0, pool.InUse())
+}
+
+func TestReplyPanic(t *testing.T) {
+	reqCtx := &fasthttp.RequestCtx{}
+	reqCtx.Response.Header.Set("DAG-Root-CID", "bafy")
+	reqCtx.SetBodyString(`{"partial":`)
+
+	id := jsonrpc2.ID{Num: 7}
+	replyPanic(reqCtx, "req-1", &jsonrpc2.Request{ID: id})
+
+	require.Equal(t, http.StatusInternalServerError, reqCtx.Response.StatusCode())
+	require.Empty(t, reqCtx.Response.Header.Peek("DAG-Root-CID"))
+	require.Equal(t, "req-1", string(reqCtx.Response.Header.Peek("X-Request-ID")))
+	var resp jsonrpc2.Response
+	require.NoError(t, json.Unmarshal(reqCtx.Response.Body(), &resp))
+	require.Equal(t, id, resp.ID)
+	require.Equal(t, "Internal error", resp.Error.Message)
+	require.Contains(t, string(*resp.Error.Data), "req-1")
+}
@@ -0,0 +1,588 @@
+// Package parquet writes Parquet files with a flat schema (required, optional and repeated
+// columns of primitive types), for the exports of the faithful data to analytics tools.
+//
+// The values are PLAIN-encoded, and each column chunk of a row group is a single data page
+// (format v1), compressed with one of the supported codecs.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Type is the type of the values of a column.
+type Type int
+
+const (
+	Boolean Type = iota
+	Int32
+	Int64
+	// Uint32 and Uint64 are stored as INT32 and INT64, annotated as unsigned.
+	Uint32
+	Uint64
+	// String is a UTF-8 BYTE_ARRAY.
+	String
+	Bytes
+)
+
+// Repetition is the repetition of a column.
+type Repetition int
+
+const (
+	Required Repetition = iota
+	// Optional columns can have nil values.
+	Optional
+	// Repeated columns have a list of values (possibly empty) in each row.
+	Repeated
+)
+
+// Column is a column of the schema.
+type Column struct {
+	Name       string
+	Type       Type
+	Repetition Repetition
+}
+
+// Codec is the compression of the pages.
+type Codec int
+
+// The values are the ones of the Parquet format.
+const (
+	Uncompressed Codec = 0
+	Gzip         Codec = 2
+	Zstd         Codec = 6
+)
+
+// The enums of the Parquet format.
+const (
+	physicalBoolean   = 0
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalByteArray = 6
+
+	convertedUTF8   = 0
+	convertedUint32 = 13
+	convertedUint64 = 14
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageTypeData = 0
+)
+
+var magic = []byte("PAR1")
+
+const (
+	// DefaultRowGroupRows is the default maximum number of rows of a row group.
+	DefaultRowGroupRows = 100_000
+	// DefaultRowGroupBytes is the default maximum (uncompressed) size of the values of a row group.
+	DefaultRowGroupBytes = 128 * 1024 * 1024
+)
+
+// Options are the options of a Writer.
+type Options struct {
+	Codec Codec
+	// RowGroupRows and RowGroupBytes limit the size of the row groups (which are buffered in memory);
+	// they default to DefaultRowGroupRows and DefaultRowGroupBytes.
+	RowGroupRows  int
+	RowGroupBytes int
+	// CreatedBy is recorded in the metadata of the file.
+	CreatedBy string
+}
+
+// Writer writes rows to a Parquet file.
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	columns []*columnBuffer
+	opts    Options
+	// rows in the current row group.
+	rows      int
+	numRows   int64
+	rowGroups []rowGroup
+	closed    bool
+}
+
+type columnChunk struct {
+	numValues        int64
+	uncompressedSize int64
+	compressedSize   int64
+	dataPageOffset   int64
+}
+
+type rowGroup struct {
+	chunks        []columnChunk
+	numRows       int64
+	totalByteSize int64
+}
+
+// NewWriter returns a writer of a Parquet file with the given columns to w.
+func NewWriter(w io.Writer, columns []Column, opts *Options) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("no columns")
+	}
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.RowGroupRows <= 0 {
+		o.RowGroupRows = DefaultRowGroupRows
+	}
+	if o.RowGroupBytes <= 0 {
+		o.RowGroupBytes = DefaultRowGroupBytes
+	}
+	switch o.Codec {
+	case Uncompressed, Gzip, Zstd:
+	default:
+		return nil, fmt.Errorf("unsupported codec %d", o.Codec)
+	}
+	names := make(map[string]bool)
+	pw := &Writer{w: w, opts: o}
+	for _, col := range columns {
+		if col.Name == "" || names[col.Name] {
+			return nil, fmt.Errorf("invalid or duplicate column name %q", col.Name)
+		}
+		names[col.Name] = true
+		if col.Type < Boolean || col.Type > Bytes {
+			return nil, fmt.Errorf("column %q: invalid type %d", col.Name, col.Type)
+		}
+		pw.columns = append(pw.columns, &columnBuffer{col: col})
+	}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+// Write appends a row, with a value for each column, in order: the Go type of the values
+// must match the type of the column (bool, int32, int64, uint32, uint64, string, []byte);
+// nil for the null values of the optional columns, and a slice of them (e.g. []string)
+// for the repeated columns.
+func (w *Writer) Write(row ...any) error {
+	if w.closed {
+		return errors.New("writer is closed")
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row has %d values, but there are %d columns", len(row), len(w.columns))
+	}
+	// validate the whole row before appending it, so that a bad row leaves the columns aligned.
+	for i, col := range w.columns {
+		if err := col.check(row[i]); err != nil {
+			return err
+		}
+	}
+	size := 0
+	for i, col := range w.columns {
+		col.append(row[i])
+		size += col.values.Len()
+	}
+	w.rows++
+	if w.rows >= w.opts.RowGroupRows || size >= w.opts.RowGroupBytes {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes the buffered rows as a row group.
+func (w *Writer) Flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	group := rowGroup{numRows: int64(w.rows)}
+	for _, col := range w.columns {
+		chunk, err := w.writeColumnChunk(col)
+		if err != nil {
+			return fmt.Errorf("failed to write column %q: %w", col.col.Name, err)
+		}
+		group.chunks = append(group.chunks, chunk)
+		group.totalByteSize += chunk.uncompressedSize
+		col.reset()
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += int64(w.rows)
+	w.rows = 0
+	return nil
+}
+
+// Close flushes the buffered rows, and writes the metadata of the file; it doesn't close
+// the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.closed = true
+	footer := w.encodeFileMetaData()
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	return w.write(magic)
+}
+
+// NumRows returns the number of rows written (and flushed).
+func (w *Writer) NumRows() int64 {
+	return w.numRows + int64(w.rows)
+}
+
+func (w *Writer) writeColumnChunk(col *columnBuffer) (columnChunk, error) {
+	var page bytes.Buffer
+	if col.col.Repetition == Repeated {
+		writeLevels(&page, col.repLevels)
+	}
+	if col.col.Repetition != Required {
+		writeLevels(&page, col.defLevels)
+	}
+	if col.col.Type == Boolean {
+		page.Write(packBools(col.bools))
+	} else {
+		page.Write(col.values.Bytes())
+	}
+	compressed, err := compress(w.opts.Codec, page.Bytes())
+	if err != nil {
+		return columnChunk{}, err
+	}
+	numValues := col.numValues()
+	var header thriftWriter
+	header.structBegin()
+	header.i32Field(1, pageTypeData)
+	header.i32Field(2, int32(page.Len()))
+	header.i32Field(3, int32(len(compressed)))
+	header.structFieldBegin(5) // data_page_header
+	header.i32Field(1, int32(numValues))
+	header.i32Field(2, encodingPlain)
+	header.i32Field(3, encodingRLE)
+	header.i32Field(4, encodingRLE)
+	header.structEnd()
+	header.structEnd()
+
+	chunk := columnChunk{
+		numValues:        int64(numValues),
+		uncompressedSize: int64(len(header.buf) + page.Len()),
+		compressedSize:   int64(len(header.buf) + len(compressed)),
+		dataPageOffset:   w.offset,
+	}
+	if err := w.write(header.buf); err != nil {
+		return columnChunk{}, err
+	}
+	if err := w.write(compressed); err != nil {
+		return columnChunk{}, err
+	}
+	return chunk, nil
+}
+
+func (w *Writer) encodeFileMetaData() []byte {
+	var t thriftWriter
+	t.structBegin()
+	t.i32Field(1, 1) // version
+	t.listBegin(2, thriftStruct, len(w.columns)+1)
+	{
+		// the root of the schema.
+		t.structBegin()
+		t.stringField(4, "schema")
+		t.i32Field(5, int32(len(w.columns)))
+		t.structEnd()
+	}
+	for _, col := range w.columns {
+		t.structBegin()
+		t.i32Field(1, int32(col.col.physicalType()))
+		t.i32Field(3, int32(col.col.Repetition))
+		t.stringField(4, col.col.Name)
+		if converted, ok := col.col.convertedType(); ok {
+			t.i32Field(6, int32(converted))
+		}
+		t.structEnd()
+	}
+	t.i64Field(3, w.numRows)
+	t.listBegin(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		t.structBegin()
+		t.listBegin(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			col := w.columns[i].col
+			t.structBegin()
+			t.i64Field(2, chunk.dataPageOffset) // file_offset
+			t.structFieldBegin(3)               // meta_data
+			t.i32Field(1, int32(col.physicalType()))
+			t.listBegin(2, thriftI32, 2)
+			t.varint(encodingPlain)
+			t.varint(encodingRLE)
+			t.listBegin(3, thriftBinary, 1)
+			t.binary([]byte(col.Name))
+			t.i32Field(4, int32(w.opts.Codec))
+			t.i64Field(5, chunk.numValues)
+			t.i64Field(6, chunk.uncompressedSize)
+			t.i64Field(7, chunk.compressedSize)
+			t.i64Field(9, chunk.dataPageOffset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64Field(2, group.totalByteSize)
+		t.i64Field(3, group.numRows)
+		t.structEnd()
+	}
+	createdBy := w.opts.CreatedBy
+	if createdBy == "" {
+		createdBy = "yellowstone-faithful"
+	}
+	t.stringField(6, createdBy)
+	t.structEnd()
+	return t.buf
+}
+
+func (c Column) physicalType() int {
+	switch c.Type {
+	case Boolean:
+		return physicalBoolean
+	case Int32, Uint32:
+		return physicalInt32
+	case Int64, Uint64:
+		return physicalInt64
+	default:
+		return physicalByteArray
+	}
+}
+
+func (c Column) convertedType() (int, bool) {
+	switch c.Type {
+	case String:
+		return convertedUTF8, true
+	case Uint32:
+		return convertedUint32, true
+	case Uint64:
+		return convertedUint64, true
+	default:
+		return 0, false
+	}
+}
+
+// columnBuffer has the values and levels of a column in the current row group.
+type columnBuffer struct {
+	col       Column
+	values    bytes.Buffer
+	bools     []bool
+	defLevels []uint8
+	repLevels []uint8
+	numRows   int
+}
+
+func (b *columnBuffer) reset() {
+	b.values.Reset()
+	b.bools = b.bools[:0]
+	b.defLevels = b.defLevels[:0]
+	b.repLevels = b.repLevels[:0]
+	b.numRows = 0
+}
+
+// numValues returns the number of values of the page, including the nulls and the empty lists.
+func (b *columnBuffer) numValues() int {
+	if b.col.Repetition == Required {
+		return b.numRows
+	}
+	return len(b.defLevels)
+}
+
+func (b *columnBuffer) check(v any) error {
+	switch b.col.Repetition {
+	case Optional:
+		if v == nil {
+			return nil
+		}
+	case Repeated:
+		list, ok := toList(v)
+		if !ok {
+			return fmt.Errorf("column %q: expected a slice, got %T", b.col.Name, v)
+		}
+		for _, elem := range list {
+			if err := b.checkValue(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return b.checkValue(v)
+}
+
+func (b *columnBuffer) checkValue(v any) error {
+	ok := false
+	switch v.(type) {
+	case bool:
+		ok = b.col.Type == Boolean
+	case int32:
+		ok = b.col.Type == Int32
+	case int64:
+		ok = b.col.Type == Int64
+	case uint32:
+		ok = b.col.Type == Uint32
+	case uint64:
+		ok = b.col.Type == Uint64
+	case string:
+		ok = b.col.Type == String || b.col.Type == Bytes
+	case []byte:
+		ok = b.col.Type == String || b.col.Type == Bytes
+	}
+	if !ok {
+		return fmt.Errorf("column %q: unexpected value of type %T", b.col.Name, v)
+	}
+	return nil
+}
+
+func (b *columnBuffer) append(v any) {
+	b.numRows++
+	switch b.col.Repetition {
+	case Required:
+		b.appendValue(v)
+	case Optional:
+		if v == nil {
+			b.defLevels = append(b.defLevels, 0)
+			return
+		}
+		b.defLevels = append(b.defLevels, 1)
+		b.appendValue(v)
+	case Repeated:
+		list, _ := toList(v)
+		if len(list) == 0 {
+			b.repLevels = append(b.repLevels, 0)
+			b.defLevels = append(b.defLevels, 0)
+			return
+		}
+		for i, elem := range list {
+			if i == 0 {
+				b.repLevels = append(b.repLevels, 0)
+			} else {
+				b.repLevels = append(b.repLevels, 1)
+			}
+			b.defLevels = append(b.defLevels, 1)
+			b.appendValue(elem)
+		}
+	}
+}
+
+func (b *columnBuffer) appendValue(v any) {
+	var scratch [8]byte
+	switch v := v.(type) {
+	case bool:
+		b.bools = append(b.bools, v)
+	case int32:
+		binary.LittleEndian.PutUint32(scratch[:], uint32(v))
+		b.values.Write(scratch[:4])
+	case uint32:
+		binary.LittleEndian.PutUint32(scratch[:], v)
+		b.values.Write(scratch[:4])
+	case int64:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+		b.values.Write(scratch[:])
+	case uint64:
+		binary.LittleEndian.PutUint64(scratch[:], v)
+		b.values.Write(scratch[:])
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(v)))
+		b.values.Write(scratch[:4])
+		b.values.WriteString(v)
+	case []byte:
+		binary.LittleEndian.PutUint32(scratch[:], uint32(len(v)))
+		b.values.Write(scratch[:4])
+		b.values.Write(v)
+	}
+}
+
+// toList converts the value of a repeated column to a list of values.
+func toList(v any) ([]any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case []any:
+		return v, true
+	case []string:
+		return listOf(v), true
+	case [][]byte:
+		return listOf(v), true
+	case []bool:
+		return listOf(v), true
+	case []int32:
+		return listOf(v), true
+	case []int64:
+		return listOf(v), true
+	case []uint32:
+		return listOf(v), true
+	case []uint64:
+		return listOf(v), true
+	default:
+		return nil, false
+	}
+}
+
+func listOf[T any](values []T) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+// writeLevels writes the levels (all 0 or 1) with the RLE/bit-packed hybrid encoding,
+// as runs only, prefixed by their length.
+func writeLevels(w *bytes.Buffer, levels []uint8) {
+	var data []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		// the run header is the count shifted left by 1 (the low bit 0 means RLE),
+		// followed by the value in ceil(bitWidth/8) = 1 byte.
+		data = binary.AppendUvarint(data, uint64(j-i)<<1)
+		data = append(data, levels[i])
+		i = j
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(data)))
+	w.Write(length[:])
+	w.Write(data)
+}
+
+// packBools bit-packs the booleans, least significant bit first.
+func packBools(values []bool) []byte {
+	out := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+func compress(codec Codec, data []byte) ([]byte, error) {
+	switch codec {
+	case Uncompressed:
+		return data, nil
+	case Gzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return compressZstd(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported codec %d", codec)
+	}
+}
@@ -0,0 +1,238 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes Thrift compact structs into maps of field id to value,
+// to check the metadata written without a Parquet library.
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		v := string(r.buf[r.pos : r.pos+n])
+		r.pos += n
+		return v
+	case thriftList:
+		header := r.byte()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		panic("unexpected thrift type")
+	}
+}
+
+func (r *thriftReader) readStruct() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+		last = id
+	}
+}
+
+type readColumn struct {
+	values    []any
+	defLevels []int
+	repLevels []int
+}
+
+// readFile reads back the columns of a file written by Writer (with the encodings it uses).
+func readFile(t *testing.T, data []byte) (map[int16]any, map[string]*readColumn) {
+	require.Equal(t, magic, data[:4])
+	require.Equal(t, magic, data[len(data)-4:])
+	footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := &thriftReader{buf: data[len(data)-8-footerLen : len(data)-8]}
+	meta := footer.readStruct()
+	require.Equal(t, footerLen, footer.pos)
+
+	schema := meta[2].([]any)
+	columns := make(map[string]*readColumn)
+	for _, group := range meta[4].([]any) {
+		for i, chunk := range group.(map[int16]any)[1].([]any) {
+			element := schema[i+1].(map[int16]any)
+			chunkMeta := chunk.(map[int16]any)[3].(map[int16]any)
+			name := chunkMeta[3].([]any)[0].(string)
+			require.Equal(t, element[4], name)
+			col := columns[name]
+			if col == nil {
+				col = &readColumn{}
+				columns[name] = col
+			}
+
+			offset := int(chunkMeta[9].(int64))
+			header := &thriftReader{buf: data[offset:]}
+			pageHeader := header.readStruct()
+			compressedSize := int(pageHeader[3].(int64))
+			page := data[offset+header.pos : offset+header.pos+compressedSize]
+			switch chunkMeta[4].(int64) {
+			case int64(Gzip):
+				gz, err := gzip.NewReader(bytes.NewReader(page))
+				require.NoError(t, err)
+				page, err = io.ReadAll(gz)
+				require.NoError(t, err)
+			case int64(Uncompressed):
+			default:
+				t.Fatalf("unexpected codec %d", chunkMeta[4])
+			}
+			require.Equal(t, int(pageHeader[2].(int64)), len(page))
+			numValues := int(pageHeader[5].(map[int16]any)[1].(int64))
+			require.Equal(t, chunkMeta[5], int64(numValues))
+
+			repetition := element[3].(int64)
+			repLevels := make([]int, numValues)
+			defLevels := make([]int, numValues)
+			for i := range defLevels {
+				defLevels[i] = 1
+			}
+			if repetition == int64(Repeated) {
+				page = readLevels(t, page, repLevels)
+			}
+			if repetition != int64(Required) {
+				page = readLevels(t, page, defLevels)
+			}
+			col.repLevels = append(col.repLevels, repLevels...)
+			col.defLevels = append(col.defLevels, defLevels...)
+			nonNull := 0
+			for _, level := range defLevels {
+				nonNull += level
+			}
+			for i := 0; i < nonNull; i++ {
+				switch element[1].(int64) {
+				case physicalBoolean:
+					col.values = append(col.values, page[i/8]&(1<<(i%8)) != 0)
+				case physicalInt32:
+					col.values = append(col.values, int32(binary.LittleEndian.Uint32(page)))
+					page = page[4:]
+				case physicalInt64:
+					col.values = append(col.values, int64(binary.LittleEndian.Uint64(page)))
+					page = page[8:]
+				case physicalByteArray:
+					n := int(binary.LittleEndian.Uint32(page))
+					col.values = append(col.values, string(page[4:4+n]))
+					page = page[4+n:]
+				}
+			}
+		}
+	}
+	return meta, columns
+}
+
+func readLevels(t *testing.T, page []byte, levels []int) []byte {
+	length := int(binary.LittleEndian.Uint32(page))
+	data := page[4 : 4+length]
+	i := 0
+	for len(data) > 0 {
+		header, n := binary.Uvarint(data)
+		require.Zero(t, header&1, "expected RLE runs only")
+		for j := 0; j < int(header>>1); j++ {
+			levels[i] = int(data[n])
+			i++
+		}
+		data = data[n+1:]
+	}
+	require.Equal(t, len(levels), i)
+	return page[4+length:]
+}
+
+func TestWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "slot", Type: Uint64},
+		{Name: "index", Type: Int32},
+		{Name: "ok", Type: Boolean},
+		{Name: "name", Type: String, Repetition: Optional},
+		{Name: "accounts", Type: String, Repetition: Repeated},
+	}
+	for _, codec := range []Codec{Uncompressed, Gzip} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, columns, &Options{Codec: codec, RowGroupRows: 2})
+		require.NoError(t, err)
+		require.NoError(t, w.Write(uint64(10), int32(0), true, "transfer", []string{"a", "b"}))
+		require.NoError(t, w.Write(uint64(10), int32(1), false, nil, []string{}))
+		require.NoError(t, w.Write(uint64(11), int32(0), true, "vote", []string{"c"}))
+		require.Equal(t, int64(3), w.NumRows())
+		require.NoError(t, w.Close())
+
+		meta, read := readFile(t, buf.Bytes())
+		require.Equal(t, int64(3), meta[3])
+		require.Len(t, meta[4], 2)
+		require.Len(t, meta[2], len(columns)+1)
+
+		require.Equal(t, []any{int64(10), int64(10), int64(11)}, read["slot"].values)
+		require.Equal(t, []any{int32(0), int32(1), int32(0)}, read["index"].values)
+		require.Equal(t, []any{true, false, true}, read["ok"].values)
+		require.Equal(t, []any{"transfer", "vote"}, read["name"].values)
+		require.Equal(t, []int{1, 0, 1}, read["name"].defLevels)
+		require.Equal(t, []any{"a", "b", "c"}, read["accounts"].values)
+		require.Equal(t, []int{0, 1, 0, 0}, read["accounts"].repLevels)
+		require.Equal(t, []int{1, 1, 0, 1}, read["accounts"].defLevels)
+	}
+}
+
+func TestWriterRejectsBadRows(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{
+		{Name: "slot", Type: Uint64},
+		{Name: "name", Type: String},
+	}, nil)
+	require.NoError(t, err)
+	require.Error(t, w.Write(uint64(1)))
+	require.Error(t, w.Write(int64(1), "a"))
+	require.Error(t, w.Write(uint64(1), nil))
+	require.NoError(t, w.Write(uint64(1), "a"))
+	require.NoError(t, w.Close())
+
+	_, read := readFile(t, buf.Bytes())
+	require.Equal(t, []any{int64(1)}, read["slot"].values)
+	require.Equal(t, []any{"a"}, read["name"].values)
+
+	_, err = NewWriter(&buf, []Column{{Name: "a"}, {Name: "a"}}, nil)
+	require.Error(t, err)
+}
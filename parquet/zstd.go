@@ -0,0 +1,21 @@
+package parquet
+
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+)
+
+// compressZstd compresses the data with a shared encoder (EncodeAll is safe for concurrent use).
+func compressZstd(data []byte) []byte {
+	zstdEncoderOnce.Do(func() {
+		// NewWriter only fails with invalid options.
+		zstdEncoder, _ = zstd.NewWriter(nil)
+	})
+	return zstdEncoder.EncodeAll(data, nil)
+}
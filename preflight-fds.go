@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// fdBaseline is the file descriptors used regardless of the epochs: listeners, the clients
+	// of the RPC server, log files, the config watcher, etc.
+	fdBaseline = 256
+	// fdGsfaFiles is the file descriptors of a gsfa index (the index, manifest and logs).
+	fdGsfaFiles = 4
+	// minConnsPerRemoteFile is the smallest pool of HTTP connections a remote file is given
+	// when the pools are shrunk to fit the file descriptor limit.
+	minConnsPerRemoteFile = 4
+)
+
+// fdBudget is the file descriptors needed to serve a set of epochs; the files shared by
+// several epochs are counted once.
+type fdBudget struct {
+	// LocalFiles is the number of files read from disk (including the downloaded index files).
+	LocalFiles int
+	// RemoteFiles is the number of remote files (CAR files, pieces and index files), each
+	// with its own pool of HTTP connections.
+	RemoteFiles int
+	// ConnsPerRemoteFile is the size of the pools of HTTP connections of the remote files.
+	ConnsPerRemoteFile int
+}
+
+// Need returns the number of file descriptors needed.
+func (b fdBudget) Need() int {
+	return fdBaseline + b.LocalFiles + b.RemoteFiles*b.ConnsPerRemoteFile
+}
+
+func (b fdBudget) String() string {
+	return fmt.Sprintf(
+		"%d file descriptors (%d local files, %d remote files with up to %d connections each, and %d for the server)",
+		b.Need(),
+		b.LocalFiles,
+		b.RemoteFiles,
+		b.ConnsPerRemoteFile,
+		fdBaseline,
+	)
+}
+
+// fdBudgetOf returns the file descriptors needed to serve the epochs of the given configs.
+func fdBudgetOf(configs ConfigSlice, connsPerRemoteFile int) fdBudget {
+	budget := fdBudget{ConnsPerRemoteFile: connsPerRemoteFile}
+	seen := make(map[string]bool)
+	add := func(uri URI, remote bool) {
+		if uri.IsZero() || seen[uri.String()] {
+			return
+		}
+		seen[uri.String()] = true
+		if remote {
+			budget.RemoteFiles++
+		} else {
+			budget.LocalFiles++
+		}
+	}
+	for _, config := range configs.withStandbys() {
+		if !config.IsFilecoinMode() {
+			switch {
+			case config.IsCarFromPieces():
+				// every piece is a remote file.
+				if metadata, err := splitcarfetcher.MetadataFromYaml(string(config.Data.Car.FromPieces.Metadata.URI)); err == nil && metadata.CarPieces != nil {
+					budget.RemoteFiles += len(metadata.CarPieces.CarPieces)
+				} else {
+					budget.RemoteFiles++
+				}
+			default:
+				add(config.Data.Car.URI, !config.Data.Car.URI.IsLocal())
+			}
+		}
+		for _, uri := range []URI{
+			config.Indexes.CidToOffsetAndSize.URI,
+			config.Indexes.CidToOffset.URI,
+			config.Indexes.SlotToCid.URI,
+			config.Indexes.SigToCid.URI,
+			config.Indexes.SigExists.URI,
+			config.Indexes.SlotToBlockhash.URI,
+			config.AccountSnapshot.Index.URI,
+		} {
+			mode := indexModeFor(config.Indexes.Mode, uri)
+			add(uri, mode == IndexModeRemote || mode == IndexModePinned)
+		}
+		if !config.AccountSnapshot.Car.URI.IsZero() {
+			add(config.AccountSnapshot.Car.URI, !config.AccountSnapshot.Car.URI.IsLocal())
+		}
+		if !config.Indexes.Gsfa.URI.IsZero() && !seen[config.Indexes.Gsfa.URI.String()] {
+			seen[config.Indexes.Gsfa.URI.String()] = true
+			budget.LocalFiles += fdGsfaFiles
+		}
+	}
+	return budget
+}
+
+// fitFdBudget returns the budget with the pools of HTTP connections of the remote files shrunk
+// so that it fits in the given limit, or an error if it can't fit.
+func fitFdBudget(budget fdBudget, limit int) (fdBudget, error) {
+	if budget.Need() <= limit {
+		return budget, nil
+	}
+	if budget.RemoteFiles > 0 {
+		fitted := budget
+		fitted.ConnsPerRemoteFile = (limit - fdBaseline - budget.LocalFiles) / budget.RemoteFiles
+		if fitted.ConnsPerRemoteFile >= minConnsPerRemoteFile {
+			return fitted, nil
+		}
+		budget.ConnsPerRemoteFile = minConnsPerRemoteFile
+	}
+	return budget, fmt.Errorf(
+		"the open file limit (%d) is too low: serving the configured epochs needs at least %s; raise it (e.g. with `ulimit -n`, or LimitNOFILE= in a systemd unit), or serve fewer epochs (use --skip-preflight to try anyway)",
+		limit,
+		budget,
+	)
+}
+
+// checkFileDescriptorLimit checks that the open file limit is high enough to serve the epochs
+// of the given configs, shrinking the pools of HTTP connections of the remote files if needed,
+// instead of failing later with "too many open files" under load.
+func checkFileDescriptorLimit(configs ConfigSlice) error {
+	if skipPreflight {
+		return nil
+	}
+	limit, err := fileDescriptorLimit()
+	if err != nil {
+		if errors.Is(err, errPreflightUnsupported) {
+			klog.Warningf("Can't check the open file limit on this platform; skipping the check")
+			return nil
+		}
+		return fmt.Errorf("failed to get the open file limit: %w", err)
+	}
+	budget := fdBudgetOf(configs, splitcarfetcher.DefaultMaxIdleConnsPerHost)
+	fitted, err := fitFdBudget(budget, limit)
+	if err != nil {
+		return err
+	}
+	if fitted.ConnsPerRemoteFile < budget.ConnsPerRemoteFile {
+		klog.Warningf(
+			"The open file limit (%d) is lower than the %s needed; limiting the connections to %d per remote file (raise the limit to avoid this)",
+			limit,
+			budget,
+			fitted.ConnsPerRemoteFile,
+		)
+		splitcarfetcher.DefaultMaxIdleConnsPerHost = fitted.ConnsPerRemoteFile
+		return nil
+	}
+	klog.Infof("Open file limit: %d; the epochs need up to %s", limit, budget)
+	return nil
+}
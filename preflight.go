@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/rpcpool/yellowstone-faithful/indexes"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+// errPreflightUnsupported is returned by the checks that are not implemented on this platform.
+var errPreflightUnsupported = errors.New("unsupported platform")
+
+// skipPreflight disables the disk space and memory checks made before the index builds and downloads.
+var skipPreflight bool
+
+func newPreflightFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "skip-preflight",
+			Usage:       "don't check the free disk space and memory before building indexes or downloading files",
+			EnvVars:     []string{"FAITHFUL_SKIP_PREFLIGHT"},
+			Destination: &skipPreflight,
+		},
+	}
+}
+
+// The sizes used by the estimates; the CIDs of the nodes of a CAR are CIDv1 dag-cbor sha256.
+const (
+	preflightCidSize       = 36
+	preflightSlotSize      = 8
+	preflightSignatureSize = 64
+	// entries per bucket, hash size and bucket header size of the compactindexsized indexes.
+	preflightEntriesPerBucket = 10_000
+	preflightHashSize         = 3
+	preflightBucketHeaderSize = 16
+	// the builders keep a buffered writer (4 KiB) per bucket, and a bucket in memory while sealing.
+	preflightBucketBufferSize = 4096
+	// the metadata headers of the indexes (an upper bound).
+	preflightIndexHeaderSize = 64 * 1024
+	// the sig-exists index has 65536 prefixes, each with an offset in the header and a length.
+	preflightSigExistsPrefixes = 1 << 16
+)
+
+// resourceEstimate is an estimate of the resources needed by an index build.
+type resourceEstimate struct {
+	// TmpBytes is the space used in the tmp dir until the indexes are sealed.
+	TmpBytes uint64
+	// FinalBytes is the size of the indexes, in the index dir.
+	FinalBytes uint64
+	// MemoryBytes is the memory used by the builders.
+	MemoryBytes uint64
+}
+
+func (e resourceEstimate) add(other resourceEstimate) resourceEstimate {
+	return resourceEstimate{
+		TmpBytes:    e.TmpBytes + other.TmpBytes,
+		FinalBytes:  e.FinalBytes + other.FinalBytes,
+		MemoryBytes: e.MemoryBytes + other.MemoryBytes,
+	}
+}
+
+func (e resourceEstimate) String() string {
+	return fmt.Sprintf(
+		"%s of temporary files, %s of indexes, %s of memory",
+		humanize.IBytes(e.TmpBytes),
+		humanize.IBytes(e.FinalBytes),
+		humanize.IBytes(e.MemoryBytes),
+	)
+}
+
+// estimateCompactIndex estimates the resources needed to build a compactindexsized index
+// of numItems keys of keySize bytes and values of valueSize bytes.
+func estimateCompactIndex(numItems uint64, keySize uint64, valueSize uint64) resourceEstimate {
+	if numItems == 0 {
+		return resourceEstimate{}
+	}
+	numBuckets := (numItems + preflightEntriesPerBucket - 1) / preflightEntriesPerBucket
+	return resourceEstimate{
+		// each temporary record is a 2-byte key length, the value and the key.
+		TmpBytes:   numItems * (2 + valueSize + keySize),
+		FinalBytes: preflightIndexHeaderSize + numBuckets*preflightBucketHeaderSize + numItems*(preflightHashSize+valueSize),
+		MemoryBytes: numBuckets*preflightBucketBufferSize +
+			// the records of the bucket being mined, and its entries.
+			2*preflightEntriesPerBucket*(2+valueSize+keySize+8),
+	}
+}
+
+// estimateSigExists estimates the resources needed to build a sig-exists index of numSignatures
+// signatures, whose 8-byte hashes are all kept in memory until the index is written.
+func estimateSigExists(numSignatures uint64) resourceEstimate {
+	return resourceEstimate{
+		FinalBytes: preflightIndexHeaderSize + preflightSigExistsPrefixes*(2+8+4) + numSignatures*8,
+		// the slices of hashes grow by doubling, so they can use up to twice the space of the hashes.
+		MemoryBytes: numSignatures * 8 * 2,
+	}
+}
+
+// estimateAllIndexes estimates the resources needed by `index all` for a CAR with the given
+// number of nodes, blocks and transactions.
+func estimateAllIndexes(numNodes uint64, numBlocks uint64, numTransactions uint64) resourceEstimate {
+	return estimateCompactIndex(numNodes, preflightCidSize, indexes.IndexValueSize_CidToOffsetAndSize).
+		add(estimateCompactIndex(numBlocks, preflightSlotSize, indexes.IndexValueSize_SlotToCid)).
+		add(estimateCompactIndex(numTransactions, preflightSignatureSize, indexes.IndexValueSize_SigToCid)).
+		add(estimateSigExists(numTransactions))
+}
+
+// checkIndexResources checks that there is enough free space in the tmp and index dirs,
+// and enough available memory, for the estimated index build.
+func checkIndexResources(estimate resourceEstimate, tmpDir string, indexDir string) error {
+	klog.Infof("Estimated resources for the index build: %s", estimate)
+	if skipPreflight {
+		return nil
+	}
+	if tmpDir == "" {
+		// the builders use the default tmp dir.
+		tmpDir = os.TempDir()
+	}
+	if err := checkDiskSpace(
+		diskNeed{Dir: tmpDir, Bytes: estimate.TmpBytes, What: "temporary files"},
+		diskNeed{Dir: indexDir, Bytes: estimate.FinalBytes, What: "indexes"},
+	); err != nil {
+		return err
+	}
+	return checkMemory(estimate.MemoryBytes)
+}
+
+// diskNeed is the space needed in a directory, for a purpose.
+type diskNeed struct {
+	Dir   string
+	Bytes uint64
+	What  string
+}
+
+// checkDiskSpace checks that the filesystems of the given directories have enough free space
+// for the needs (summed up when directories share a filesystem).
+func checkDiskSpace(needs ...diskNeed) error {
+	if skipPreflight {
+		return nil
+	}
+	type filesystem struct {
+		dirs  []string
+		whats []string
+		free  uint64
+		need  uint64
+	}
+	var order []uint64
+	byID := make(map[uint64]*filesystem)
+	for _, need := range needs {
+		if need.Bytes == 0 {
+			continue
+		}
+		dir := need.Dir
+		if dir == "" {
+			dir = "."
+		}
+		free, id, err := diskFreeSpace(dir)
+		if err != nil {
+			if errors.Is(err, errPreflightUnsupported) {
+				klog.Warningf("Can't check the free disk space on this platform; skipping the check")
+				return nil
+			}
+			return fmt.Errorf("failed to get the free disk space of %q: %w", dir, err)
+		}
+		fs, ok := byID[id]
+		if !ok {
+			fs = &filesystem{free: free}
+			byID[id] = fs
+			order = append(order, id)
+		}
+		fs.dirs = append(fs.dirs, dir)
+		fs.whats = append(fs.whats, need.What)
+		fs.need += need.Bytes
+	}
+	for _, id := range order {
+		fs := byID[id]
+		if fs.need > fs.free {
+			return fmt.Errorf(
+				"not enough disk space for the %s in %s: about %s is needed, but only %s is free (use --skip-preflight to try anyway)",
+				strings.Join(fs.whats, " and "),
+				strings.Join(uniqueAbs(fs.dirs), ", "),
+				humanize.IBytes(fs.need),
+				humanize.IBytes(fs.free),
+			)
+		}
+	}
+	return nil
+}
+
+// checkMemory checks that the given amount of memory is available.
+func checkMemory(need uint64) error {
+	if skipPreflight || need == 0 {
+		return nil
+	}
+	available, err := availableMemory()
+	if err != nil {
+		if errors.Is(err, errPreflightUnsupported) {
+			klog.Warningf("Can't check the available memory on this platform; skipping the check")
+			return nil
+		}
+		return fmt.Errorf("failed to get the available memory: %w", err)
+	}
+	if need > available {
+		return fmt.Errorf(
+			"not enough memory: about %s is needed, but only %s is available (use --skip-preflight to try anyway)",
+			humanize.IBytes(need),
+			humanize.IBytes(available),
+		)
+	}
+	return nil
+}
+
+func uniqueAbs(dirs []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if !seen[dir] {
+			seen[dir] = true
+			out = append(out, dir)
+		}
+	}
+	return out
+}
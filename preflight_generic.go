@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+func diskFreeSpace(dir string) (uint64, uint64, error) {
+	return 0, 0, errPreflightUnsupported
+}
+
+func availableMemory() (uint64, error) {
+	return 0, errPreflightUnsupported
+}
+
+func fileDescriptorLimit() (int, error) {
+	return 0, errPreflightUnsupported
+}
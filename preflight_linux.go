@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// diskFreeSpace returns the space available to unprivileged users on the filesystem of dir,
+// and an identifier of the filesystem.
+func diskFreeSpace(dir string) (uint64, uint64, error) {
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &statfs); err != nil {
+		return 0, 0, err
+	}
+	var stat syscall.Stat_t
+	if err := syscall.Stat(dir, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(statfs.Bavail) * uint64(statfs.Bsize), uint64(stat.Dev), nil
+}
+
+// availableMemory returns the MemAvailable of /proc/meminfo.
+func availableMemory() (uint64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// e.g. "MemAvailable:   12345678 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kib, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable: %w", err)
+		}
+		return kib * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errPreflightUnsupported
+}
+
+// fileDescriptorLimit returns the soft limit of open files (which the Go runtime raises
+// to the hard limit at startup).
+func fileDescriptorLimit() (int, error) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, err
+	}
+	if rlimit.Cur > math.MaxInt32 { // including RLIM_INFINITY.
+		return math.MaxInt32, nil
+	}
+	return int(rlimit.Cur), nil
+}
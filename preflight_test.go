@@ -0,0 +1,70 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateCompactIndex(t *testing.T) {
+	require.Equal(t, resourceEstimate{}, estimateCompactIndex(0, 36, 9))
+
+	// 25,000 items: 3 buckets.
+	e := estimateCompactIndex(25_000, 36, 9)
+	require.Equal(t, uint64(25_000*(2+9+36)), e.TmpBytes)
+	require.Equal(t, uint64(64*1024+3*16+25_000*(3+9)), e.FinalBytes)
+	require.Equal(t, uint64(3*4096+2*10_000*(2+9+36+8)), e.MemoryBytes)
+
+	all := estimateAllIndexes(1_000, 10, 100)
+	require.Equal(t, uint64(1_000*(2+9+36)+10*(2+36+8)+100*(2+36+64)), all.TmpBytes)
+	// the sig-exists index keeps the hashes of the signatures in memory.
+	require.Greater(t, all.MemoryBytes, estimateSigExists(100).MemoryBytes)
+	require.Equal(t, uint64(100*8*2), estimateSigExists(100).MemoryBytes)
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the free disk space is only checked on linux")
+	}
+	dir := t.TempDir()
+	require.NoError(t, checkDiskSpace(diskNeed{Dir: dir, Bytes: 1, What: "indexes"}))
+
+	// the needs of directories on the same filesystem add up.
+	free, _, err := diskFreeSpace(dir)
+	require.NoError(t, err)
+	err = checkDiskSpace(
+		diskNeed{Dir: dir, Bytes: free/2 + 1, What: "temporary files"},
+		diskNeed{Dir: dir, Bytes: free/2 + 1, What: "indexes"},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not enough disk space for the temporary files and indexes")
+
+	skipPreflight = true
+	defer func() { skipPreflight = false }()
+	require.NoError(t, checkDiskSpace(diskNeed{Dir: dir, Bytes: free + 1, What: "indexes"}))
+}
+
+func TestFitFdBudget(t *testing.T) {
+	budget := fdBudget{LocalFiles: 100, RemoteFiles: 10, ConnsPerRemoteFile: 100}
+	require.Equal(t, fdBaseline+100+10*100, budget.Need())
+
+	fitted, err := fitFdBudget(budget, 1_000_000)
+	require.NoError(t, err)
+	require.Equal(t, budget, fitted)
+
+	// the pools of connections of the remote files are shrunk to fit.
+	fitted, err = fitFdBudget(budget, fdBaseline+100+10*20+5)
+	require.NoError(t, err)
+	require.Equal(t, 20, fitted.ConnsPerRemoteFile)
+	require.LessOrEqual(t, fitted.Need(), fdBaseline+100+10*20+5)
+
+	// but not below the minimum.
+	_, err = fitFdBudget(budget, fdBaseline+100+10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the open file limit (366) is too low")
+
+	// without remote files, there is nothing to shrink.
+	_, err = fitFdBudget(fdBudget{LocalFiles: 1000}, 1024)
+	require.Error(t, err)
+}
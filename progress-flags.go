@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+
+	"github.com/rpcpool/yellowstone-faithful/progress"
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+// newProgressFlags returns the global flags that expose the progress of the long-running commands
+// (index builds, verifications, downloads, CAR rewrites) to orchestration systems.
+func newProgressFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "progress-file",
+			Usage:   "write the progress of the long-running tasks as JSON to this file (replaced atomically every second)",
+			EnvVars: []string{"FAITHFUL_PROGRESS_FILE"},
+			Action: func(cctx *cli.Context, v string) error {
+				progress.Default.SetFile(v)
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:    "progress-listen",
+			Usage:   "serve the progress of the long-running tasks as JSON over HTTP on this address (e.g. :9090)",
+			EnvVars: []string{"FAITHFUL_PROGRESS_LISTEN"},
+			Action: func(cctx *cli.Context, v string) error {
+				if v == "" {
+					return nil
+				}
+				go func() {
+					if err := progress.Default.ListenAndServe(v); err != nil {
+						klog.Errorf("failed to serve progress on %s: %s", v, err)
+					}
+				}()
+				return nil
+			},
+		},
+	}
+}
+
+// startCarProgress starts tracking the progress of a task that reads the CAR at the given path
+// (or - for stdin) from r, and returns the reader that counts the bytes.
+func startCarProgress(name string, carPath string, r io.Reader) (*progress.Task, io.Reader) {
+	task := progress.Start(name)
+	if carPath != "-" && !isZstdCarPath(carPath) {
+		if size, err := getFileSize(carPath); err == nil {
+			task.SetTotal(0, size)
+		}
+	}
+	return task, task.Reader(r)
+}
@@ -0,0 +1,392 @@
+// Package progress tracks the progress of long-running tasks (index builds, verifications,
+// downloads, CAR rewrites), and reports it: as a status line on a terminal (or a periodic
+// log line otherwise), and as JSON in a file and/or over HTTP, for orchestration systems.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"k8s.io/klog/v2"
+)
+
+// State is the state of a task.
+type State string
+
+const (
+	StateRunning State = "running"
+	StateDone    State = "done"
+	StateFailed  State = "failed"
+)
+
+// Task is a long-running task; its counters can be updated concurrently.
+type Task struct {
+	registry   *Registry
+	name       string
+	startedAt  time.Time
+	items      atomic.Uint64
+	bytes      atomic.Uint64
+	totalItems atomic.Uint64
+	totalBytes atomic.Uint64
+
+	mu         sync.Mutex
+	state      State
+	err        error
+	finishedAt time.Time
+}
+
+// Add adds the processed items (e.g. the CAR nodes) and bytes.
+func (t *Task) Add(items uint64, bytes uint64) {
+	t.items.Add(items)
+	t.bytes.Add(bytes)
+}
+
+// SetTotal sets the expected total of items and bytes (zero means unknown), for the ETA.
+func (t *Task) SetTotal(items uint64, bytes uint64) {
+	t.totalItems.Store(items)
+	t.totalBytes.Store(bytes)
+}
+
+// Done marks the task as finished, with the given error (if any), and reports it.
+func (t *Task) Done(err error) {
+	t.mu.Lock()
+	if t.state != StateRunning {
+		t.mu.Unlock()
+		return
+	}
+	t.state = StateDone
+	if err != nil {
+		t.state = StateFailed
+		t.err = err
+	}
+	t.finishedAt = time.Now()
+	t.mu.Unlock()
+	t.registry.finished(t)
+}
+
+// Reader returns a reader that counts the bytes read from r.
+func (t *Task) Reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, task: t}
+}
+
+type countingReader struct {
+	r    io.Reader
+	task *Task
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.task.bytes.Add(uint64(n))
+	return n, err
+}
+
+// Snapshot is the progress of a task at a point in time.
+type Snapshot struct {
+	Name           string    `json:"name"`
+	State          State     `json:"state"`
+	Error          string    `json:"error,omitempty"`
+	Items          uint64    `json:"items"`
+	TotalItems     uint64    `json:"totalItems,omitempty"`
+	Bytes          uint64    `json:"bytes"`
+	TotalBytes     uint64    `json:"totalBytes,omitempty"`
+	ItemsPerSecond float64   `json:"itemsPerSecond"`
+	BytesPerSecond float64   `json:"bytesPerSecond"`
+	Percent        *float64  `json:"percent,omitempty"`
+	ETASeconds     *float64  `json:"etaSeconds,omitempty"`
+	ElapsedSeconds float64   `json:"elapsedSeconds"`
+	StartedAt      time.Time `json:"startedAt"`
+}
+
+// Snapshot returns the current progress of the task.
+func (t *Task) Snapshot() Snapshot {
+	t.mu.Lock()
+	state, err, finishedAt := t.state, t.err, t.finishedAt
+	t.mu.Unlock()
+	now := time.Now()
+	if !finishedAt.IsZero() {
+		now = finishedAt
+	}
+	s := Snapshot{
+		Name:           t.name,
+		State:          state,
+		Items:          t.items.Load(),
+		TotalItems:     t.totalItems.Load(),
+		Bytes:          t.bytes.Load(),
+		TotalBytes:     t.totalBytes.Load(),
+		ElapsedSeconds: now.Sub(t.startedAt).Seconds(),
+		StartedAt:      t.startedAt,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	if s.ElapsedSeconds > 0 {
+		s.ItemsPerSecond = float64(s.Items) / s.ElapsedSeconds
+		s.BytesPerSecond = float64(s.Bytes) / s.ElapsedSeconds
+	}
+	// the bytes are a better measure of the work left than the items (whose sizes vary).
+	done, total, rate := s.Items, s.TotalItems, s.ItemsPerSecond
+	if s.TotalBytes > 0 {
+		done, total, rate = s.Bytes, s.TotalBytes, s.BytesPerSecond
+	}
+	if total > 0 {
+		percent := min(100, float64(done)/float64(total)*100)
+		s.Percent = &percent
+		if state == StateRunning && rate > 0 && done <= total {
+			eta := float64(total-done) / rate
+			s.ETASeconds = &eta
+		}
+	}
+	return s
+}
+
+// String formats the snapshot for humans, e.g.
+// "index all: 1,200,000/3,000,000 items [40.00%] (25,000 items/s), 12 GB (250 MB/s), ETA: 1m12s".
+func (s Snapshot) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	b.WriteString(": ")
+	if s.TotalItems > 0 {
+		fmt.Fprintf(&b, "%s/%s items", humanize.Comma(int64(s.Items)), humanize.Comma(int64(s.TotalItems)))
+	} else {
+		fmt.Fprintf(&b, "%s items", humanize.Comma(int64(s.Items)))
+	}
+	if s.Percent != nil {
+		fmt.Fprintf(&b, " [%.2f%%]", *s.Percent)
+	}
+	fmt.Fprintf(&b, " (%s items/s)", humanize.Comma(int64(s.ItemsPerSecond)))
+	if s.Bytes > 0 || s.TotalBytes > 0 {
+		if s.TotalBytes > 0 {
+			fmt.Fprintf(&b, ", %s/%s", humanize.Bytes(s.Bytes), humanize.Bytes(s.TotalBytes))
+		} else {
+			fmt.Fprintf(&b, ", %s", humanize.Bytes(s.Bytes))
+		}
+		fmt.Fprintf(&b, " (%s/s)", humanize.Bytes(uint64(s.BytesPerSecond)))
+	}
+	switch s.State {
+	case StateRunning:
+		if s.ETASeconds != nil {
+			fmt.Fprintf(&b, ", ETA: %s", (time.Duration(*s.ETASeconds) * time.Second).Truncate(time.Second))
+		} else {
+			b.WriteString(", ETA: ---")
+		}
+	case StateDone:
+		fmt.Fprintf(&b, ", done in %s", (time.Duration(s.ElapsedSeconds * float64(time.Second))).Truncate(time.Second))
+	case StateFailed:
+		fmt.Fprintf(&b, ", failed after %s: %s", (time.Duration(s.ElapsedSeconds * float64(time.Second))).Truncate(time.Second), s.Error)
+	}
+	return b.String()
+}
+
+// Registry has the tasks of the process, and reports their progress.
+type Registry struct {
+	mu    sync.Mutex
+	tasks []*Task
+	// out is where the human-readable progress is written; if it's a terminal,
+	// a status line is rewritten every TTYInterval, else a line is logged every LogInterval.
+	out         io.Writer
+	isTTY       bool
+	file        string
+	TTYInterval time.Duration
+	LogInterval time.Duration
+	running     bool
+	stop        chan struct{}
+	lastLineLen int
+}
+
+// NewRegistry returns a registry that writes the human-readable progress to out.
+func NewRegistry(out io.Writer) *Registry {
+	return &Registry{
+		out:         out,
+		isTTY:       isTerminal(out),
+		TTYInterval: time.Second,
+		LogInterval: 30 * time.Second,
+	}
+}
+
+// Default is the registry of the process, which writes to stderr.
+var Default = NewRegistry(os.Stderr)
+
+// Start starts tracking a new task in the default registry.
+func Start(name string) *Task {
+	return Default.Start(name)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// SetFile sets the path of the JSON file where the progress of the tasks is written
+// (atomically, so that it can be read at any time).
+func (r *Registry) SetFile(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.file = path
+}
+
+// Start starts tracking a new task; Done must be called when it finishes.
+func (r *Registry) Start(name string) *Task {
+	t := &Task{
+		registry:  r,
+		name:      name,
+		startedAt: time.Now(),
+		state:     StateRunning,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tasks = append(r.tasks, t)
+	if !r.running {
+		r.running = true
+		r.stop = make(chan struct{})
+		go r.run(r.stop)
+	}
+	return t
+}
+
+// Snapshots returns the progress of all the tasks (the finished ones too), in start order.
+func (r *Registry) Snapshots() []Snapshot {
+	r.mu.Lock()
+	tasks := append([]*Task(nil), r.tasks...)
+	r.mu.Unlock()
+	snapshots := make([]Snapshot, len(tasks))
+	for i, t := range tasks {
+		snapshots[i] = t.Snapshot()
+	}
+	return snapshots
+}
+
+// ServeHTTP serves the progress of the tasks as JSON.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"tasks": r.Snapshots()})
+}
+
+// ListenAndServe serves the progress of the tasks as JSON over HTTP, on any path.
+func (r *Registry) ListenAndServe(listenOn string) error {
+	return http.ListenAndServe(listenOn, r)
+}
+
+func (r *Registry) run(stop chan struct{}) {
+	ticker := time.NewTicker(r.TTYInterval)
+	defer ticker.Stop()
+	lastLog := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		r.writeFile()
+		if r.isTTY {
+			r.printStatusLine()
+		} else if time.Since(lastLog) >= r.LogInterval {
+			lastLog = time.Now()
+			for _, s := range r.runningSnapshots() {
+				klog.Info(s.String())
+			}
+		}
+	}
+}
+
+func (r *Registry) runningSnapshots() []Snapshot {
+	var running []Snapshot
+	for _, s := range r.Snapshots() {
+		if s.State == StateRunning {
+			running = append(running, s)
+		}
+	}
+	return running
+}
+
+func (r *Registry) printStatusLine() {
+	var parts []string
+	for _, s := range r.runningSnapshots() {
+		parts = append(parts, s.String())
+	}
+	line := strings.Join(parts, " | ")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// pad with spaces to erase the end of a longer previous line.
+	padding := max(0, r.lastLineLen-len(line))
+	fmt.Fprintf(r.out, "\r%s%s", line, strings.Repeat(" ", padding))
+	r.lastLineLen = len(line)
+}
+
+// finished reports the final progress of the task, and stops reporting if no task is running.
+func (r *Registry) finished(t *Task) {
+	s := t.Snapshot()
+	r.mu.Lock()
+	if r.isTTY && r.lastLineLen > 0 {
+		// end the status line.
+		fmt.Fprintf(r.out, "\r%s\r", strings.Repeat(" ", r.lastLineLen))
+		r.lastLineLen = 0
+	}
+	stillRunning := false
+	for _, other := range r.tasks {
+		if other != t && other.Snapshot().State == StateRunning {
+			stillRunning = true
+		}
+	}
+	if !stillRunning && r.running {
+		r.running = false
+		close(r.stop)
+	}
+	r.mu.Unlock()
+	if s.State == StateFailed {
+		klog.Error(s.String())
+	} else {
+		klog.Info(s.String())
+	}
+	r.writeFile()
+}
+
+func (r *Registry) writeFile() {
+	r.mu.Lock()
+	path := r.file
+	r.mu.Unlock()
+	if path == "" {
+		return
+	}
+	if err := writeFileAtomically(path, map[string]any{
+		"updatedAt": time.Now(),
+		"tasks":     r.Snapshots(),
+	}); err != nil {
+		klog.Errorf("failed to write progress file %q: %s", path, err)
+	}
+}
+
+func writeFileAtomically(path string, v any) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,103 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := NewRegistry(io.Discard)
+	task := r.Start("index all")
+	task.startedAt = time.Now().Add(-10 * time.Second)
+
+	s := task.Snapshot()
+	require.Equal(t, StateRunning, s.State)
+	require.Nil(t, s.Percent)
+	require.Nil(t, s.ETASeconds)
+	require.Contains(t, s.String(), "ETA: ---")
+
+	task.SetTotal(1000, 0)
+	task.Add(250, 0)
+	s = task.Snapshot()
+	require.InDelta(t, 25, *s.Percent, 0.01)
+	require.InDelta(t, 25, s.ItemsPerSecond, 0.1)
+	// 750 items left at 25 items/s.
+	require.InDelta(t, 30, *s.ETASeconds, 0.5)
+	require.True(t, strings.HasPrefix(s.String(), "index all: 250/1,000 items [25.00%]"), s.String())
+
+	// the bytes are used for the ETA when their total is known.
+	task.SetTotal(1000, 4000)
+	task.Add(0, 2000)
+	s = task.Snapshot()
+	require.InDelta(t, 50, *s.Percent, 0.01)
+	require.InDelta(t, 10, *s.ETASeconds, 0.5)
+
+	task.Done(nil)
+	s = task.Snapshot()
+	require.Equal(t, StateDone, s.State)
+	require.Nil(t, s.ETASeconds)
+	require.Contains(t, s.String(), "done in")
+
+	failed := r.Start("verify")
+	failed.Done(errors.New("boom"))
+	// Done is idempotent.
+	failed.Done(nil)
+	s = failed.Snapshot()
+	require.Equal(t, StateFailed, s.State)
+	require.Equal(t, "boom", s.Error)
+
+	require.Len(t, r.Snapshots(), 2)
+}
+
+func TestReader(t *testing.T) {
+	r := NewRegistry(io.Discard)
+	task := r.Start("download")
+	defer task.Done(nil)
+	n, err := io.Copy(io.Discard, task.Reader(bytes.NewReader(make([]byte, 12345))))
+	require.NoError(t, err)
+	require.Equal(t, int64(12345), n)
+	require.Equal(t, uint64(12345), task.Snapshot().Bytes)
+}
+
+func TestFileAndHTTP(t *testing.T) {
+	r := NewRegistry(io.Discard)
+	path := filepath.Join(t.TempDir(), "progress.json")
+	r.SetFile(path)
+	task := r.Start("compress")
+	task.SetTotal(0, 100)
+	task.Add(1, 40)
+
+	{
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		var got struct {
+			Tasks []Snapshot `json:"tasks"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		require.Len(t, got.Tasks, 1)
+		require.Equal(t, "compress", got.Tasks[0].Name)
+		require.Equal(t, uint64(40), got.Tasks[0].Bytes)
+		require.Equal(t, StateRunning, got.Tasks[0].State)
+	}
+
+	task.Done(nil)
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got struct {
+		Tasks []Snapshot `json:"tasks"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &got))
+	require.Len(t, got.Tasks, 1)
+	require.Equal(t, StateDone, got.Tasks[0].State)
+	require.InDelta(t, 40, *got.Tasks[0].Percent, 0.01)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// readAmplification counts the DAG nodes that a request touched (from the cache or the storage)
+// and the bytes it read from the storage, across all the goroutines that serve it, to compare
+// them with the size of its response.
+type readAmplification struct {
+	nodes        atomic.Int64
+	nodeBytes    atomic.Int64
+	cachedNodes  atomic.Int64
+	storageReads atomic.Int64
+	storageBytes atomic.Int64
+}
+
+const readAmplificationKey = MyContextKey("readAmplification")
+
+// withReadAmplification returns a context that counts the reads of the request.
+func withReadAmplification(ctx context.Context) (context.Context, *readAmplification) {
+	ra := &readAmplification{}
+	return context.WithValue(ctx, readAmplificationKey, ra), ra
+}
+
+func getReadAmplificationFromContext(ctx context.Context) *readAmplification {
+	ra, _ := ctx.Value(readAmplificationKey).(*readAmplification)
+	return ra
+}
+
+// observeNodeRead records that the request touched a node of the given size.
+func observeNodeRead(ctx context.Context, size int, cached bool) {
+	ra := getReadAmplificationFromContext(ctx)
+	if ra == nil {
+		return
+	}
+	ra.nodes.Add(1)
+	ra.nodeBytes.Add(int64(size))
+	if cached {
+		ra.cachedNodes.Add(1)
+	}
+}
+
+// observeStorageRead records that the request read the given number of bytes from the storage
+// (a CAR file, or the retrieval from Filecoin).
+func observeStorageRead(ctx context.Context, size uint64) {
+	ra := getReadAmplificationFromContext(ctx)
+	if ra == nil {
+		return
+	}
+	ra.storageReads.Add(1)
+	ra.storageBytes.Add(int64(size))
+}
+
+// ReadAmplificationReport is what a request touched, compared with the size of its response.
+type ReadAmplificationReport struct {
+	// Nodes is the number of DAG nodes touched, of which CachedNodes were in the cache.
+	Nodes       int64 `json:"nodes"`
+	CachedNodes int64 `json:"cachedNodes"`
+	// NodeBytes is the size of the nodes touched.
+	NodeBytes int64 `json:"nodeBytes"`
+	// StorageReads and StorageBytes are the reads from the storage (including the prefetched ranges).
+	StorageReads  int64 `json:"storageReads"`
+	StorageBytes  int64 `json:"storageBytes"`
+	ResponseBytes int64 `json:"responseBytes"`
+	// Factor is NodeBytes / ResponseBytes (0 if the response is empty).
+	Factor float64 `json:"factor"`
+}
+
+func (ra *readAmplification) report(responseBytes int) *ReadAmplificationReport {
+	report := &ReadAmplificationReport{
+		Nodes:         ra.nodes.Load(),
+		CachedNodes:   ra.cachedNodes.Load(),
+		NodeBytes:     ra.nodeBytes.Load(),
+		StorageReads:  ra.storageReads.Load(),
+		StorageBytes:  ra.storageBytes.Load(),
+		ResponseBytes: int64(responseBytes),
+	}
+	if responseBytes > 0 {
+		report.Factor = float64(report.NodeBytes) / float64(responseBytes)
+	}
+	return report
+}
+
+// observe records the report in the metrics of the method (if the request touched any node).
+func (r *ReadAmplificationReport) observe(method string, traceID string) {
+	if r.Nodes == 0 && r.StorageReads == 0 {
+		return
+	}
+	observeWithTraceID(metrics_nodesTouched.WithLabelValues(method), float64(r.Nodes), traceID)
+	observeWithTraceID(metrics_storageBytesRead.WithLabelValues(method), float64(r.StorageBytes), traceID)
+	if r.ResponseBytes > 0 {
+		observeWithTraceID(metrics_readAmplification.WithLabelValues(method), r.Factor, traceID)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAmplification(t *testing.T) {
+	// no-op if the request doesn't count its reads.
+	observeNodeRead(context.Background(), 100, true)
+	observeStorageRead(context.Background(), 100)
+
+	ctx, ra := withReadAmplification(context.Background())
+	require.Same(t, ra, getReadAmplificationFromContext(ctx))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			observeNodeRead(ctx, 100, i%2 == 0)
+		}(i)
+	}
+	wg.Wait()
+	// a prefetched range, read once.
+	observeStorageRead(ctx, 4096)
+
+	report := ra.report(250)
+	require.Equal(t, &ReadAmplificationReport{
+		Nodes:         10,
+		CachedNodes:   5,
+		NodeBytes:     1000,
+		StorageReads:  1,
+		StorageBytes:  4096,
+		ResponseBytes: 250,
+		Factor:        4,
+	}, report)
+
+	// an empty response has no factor.
+	require.Zero(t, ra.report(0).Factor)
+
+	// it's in the slow-query log entries.
+	line, err := json.Marshal(&SlowQueryEntry{Method: "getBlock", Reads: report})
+	require.NoError(t, err)
+	var entry SlowQueryEntry
+	require.NoError(t, json.Unmarshal(line, &entry))
+	require.Equal(t, report, entry.Reads)
+}
@@ -7,9 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/ipfs/go-libipfs/blocks"
@@ -17,6 +15,7 @@ import (
 	"github.com/ipld/go-car/util"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
 	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"github.com/rpcpool/yellowstone-faithful/progress"
 	"github.com/rpcpool/yellowstone-faithful/readahead"
 )
 
@@ -187,7 +186,7 @@ func getFileSize(path string) (uint64, error) {
 }
 
 func carCountItems(carPath string) (uint64, error) {
-	file, err := os.Open(carPath)
+	file, err := openCarFile(carPath)
 	if err != nil {
 		return 0, err
 	}
@@ -213,8 +212,8 @@ func carCountItems(carPath string) (uint64, error) {
 	return count, nil
 }
 
-func carCountItemsByFirstByte(carPath string) (map[byte]uint64, *ipldbindcode.Epoch, error) {
-	file, err := os.Open(carPath)
+func carCountItemsByFirstByte(carPath string) (_ map[byte]uint64, _ *ipldbindcode.Epoch, retErr error) {
+	file, err := openCarFile(carPath)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -227,10 +226,16 @@ func carCountItemsByFirstByte(carPath string) (map[byte]uint64, *ipldbindcode.Ep
 
 	numTotalItems := uint64(0)
 	counts := make(map[byte]uint64)
-	startedCountAt := time.Now()
+	task := progress.Start("count items")
+	if !isZstdCarPath(carPath) {
+		if size, err := getFileSize(carPath); err == nil {
+			task.SetTotal(0, size)
+		}
+	}
+	defer func() { task.Done(retErr) }()
 	var epochObject *ipldbindcode.Epoch
 	for {
-		_, _, block, err := rd.NextNode()
+		_, sectionLength, block, err := rd.NextNode()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
@@ -241,12 +246,7 @@ func carCountItemsByFirstByte(carPath string) (map[byte]uint64, *ipldbindcode.Ep
 		firstDataByte := block.RawData()[1]
 		counts[firstDataByte]++
 		numTotalItems++
-
-		if numTotalItems%1_000_000 == 0 {
-			printToStderr(
-				fmt.Sprintf("\rCounted %s items", humanize.Comma(int64(numTotalItems))),
-			)
-		}
+		task.Add(1, sectionLength)
 
 		if iplddecoders.Kind(firstDataByte) == iplddecoders.KindEpoch {
 			epochObject, err = iplddecoders.DecodeEpoch(block.RawData())
@@ -256,13 +256,5 @@ func carCountItemsByFirstByte(carPath string) (map[byte]uint64, *ipldbindcode.Ep
 		}
 	}
 
-	printToStderr(
-		fmt.Sprintf("\rCounted %s items in %s\n", humanize.Comma(int64(numTotalItems)), time.Since(startedCountAt).Truncate(time.Second)),
-	)
-
 	return counts, epochObject, err
 }
-
-func printToStderr(msg string) {
-	fmt.Fprint(os.Stderr, msg)
-}
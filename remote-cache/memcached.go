@@ -0,0 +1,122 @@
+package remotecache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMemcachedRelativeExpiration is the max expiration that memcached interprets
+// as relative to now (bigger values are interpreted as unix timestamps).
+const maxMemcachedRelativeExpiration = 30 * 24 * time.Hour
+
+// Memcached is a minimal memcached client (text protocol) supporting get and set.
+type Memcached struct {
+	pool *pool
+}
+
+var _ Cache = (*Memcached)(nil)
+
+func newMemcached(u *url.URL) *Memcached {
+	return &Memcached{
+		pool: &pool{
+			addr: u.Host,
+		},
+	}
+}
+
+func (m *Memcached) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if err := validateMemcachedKey(key); err != nil {
+		return nil, false, err
+	}
+	var value []byte
+	var found bool
+	err := m.pool.do(ctx, func(c *conn) error {
+		fmt.Fprintf(c.w, "get %s\r\n", key)
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(c)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) > 0 && strings.HasSuffix(fields[0], "ERROR") {
+				return serverError("memcached: " + line)
+			}
+			if len(fields) != 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("memcached: unexpected reply %q", line)
+			}
+			size, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("memcached: invalid value length %q", line)
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(c.r, buf); err != nil {
+				return err
+			}
+			value = buf[:size]
+			found = true
+		}
+	})
+	return value, found, err
+}
+
+func (m *Memcached) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := validateMemcachedKey(key); err != nil {
+		return err
+	}
+	if ttl > maxMemcachedRelativeExpiration {
+		ttl = maxMemcachedRelativeExpiration
+	}
+	exptime := int64(ttl / time.Second)
+	if exptime == 0 && ttl > 0 {
+		exptime = 1
+	}
+	return m.pool.do(ctx, func(c *conn) error {
+		fmt.Fprintf(c.w, "set %s 0 %d %d\r\n", key, exptime, len(value))
+		c.w.Write(value)
+		c.w.WriteString("\r\n")
+		if err := c.w.Flush(); err != nil {
+			return err
+		}
+		line, err := readLine(c)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "STORED":
+			return nil
+		case strings.HasSuffix(line, "ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+			// e.g. SERVER_ERROR object too large for cache
+			return serverError("memcached: " + line)
+		default:
+			return fmt.Errorf("memcached: unexpected reply %q", line)
+		}
+	})
+}
+
+func (m *Memcached) Close() error {
+	return m.pool.close()
+}
+
+func validateMemcachedKey(key string) error {
+	if len(key) == 0 || len(key) > 250 {
+		return fmt.Errorf("memcached: invalid key length %d", len(key))
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return fmt.Errorf("memcached: invalid character in key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package remotecache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redis is a minimal Redis client (RESP2) supporting GET and SET with expiration.
+type Redis struct {
+	pool *pool
+}
+
+var _ Cache = (*Redis)(nil)
+
+func newRedis(u *url.URL) (*Redis, error) {
+	var password string
+	if u.User != nil {
+		password, _ = u.User.Password()
+	}
+	var db int
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		var err error
+		db, err = strconv.Atoi(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %w", path, err)
+		}
+	}
+	return &Redis{
+		pool: &pool{
+			addr: u.Host,
+			init: func(c *conn) error {
+				if password != "" {
+					if _, _, err := redisCommand(c, "AUTH", []byte(password)); err != nil {
+						return fmt.Errorf("redis AUTH failed: %w", err)
+					}
+				}
+				if db != 0 {
+					if _, _, err := redisCommand(c, "SELECT", []byte(strconv.Itoa(db))); err != nil {
+						return fmt.Errorf("redis SELECT failed: %w", err)
+					}
+				}
+				return nil
+			},
+		},
+	}, nil
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	var found bool
+	err := r.pool.do(ctx, func(c *conn) error {
+		var err error
+		value, found, err = redisCommand(c, "GET", []byte(key))
+		return err
+	})
+	return value, found, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.pool.do(ctx, func(c *conn) error {
+		_, _, err := redisCommand(c, "SET", []byte(key), value, []byte("PX"), []byte(strconv.FormatInt(ttl.Milliseconds(), 10)))
+		return err
+	})
+}
+
+func (r *Redis) Close() error {
+	return r.pool.close()
+}
+
+// redisCommand sends a command and reads its reply; the bool is false for nil replies.
+func redisCommand(c *conn, name string, args ...[]byte) ([]byte, bool, error) {
+	fmt.Fprintf(c.w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(name), name)
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n", len(arg))
+		c.w.Write(arg)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, false, err
+	}
+	return readRedisReply(c)
+}
+
+func readRedisReply(c *conn) ([]byte, bool, error) {
+	line, err := readLine(c)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(line) == 0 {
+		return nil, false, fmt.Errorf("redis: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), true, nil
+	case '-':
+		return nil, false, serverError("redis: " + line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, false, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if size < 0 {
+			return nil, false, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, false, err
+		}
+		return buf[:size], true, nil
+	default:
+		return nil, false, fmt.Errorf("redis: unsupported reply %q", line)
+	}
+}
+
+// readLine reads a \r\n terminated line (without the terminator).
+func readLine(c *conn) (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(line, "\r\n"), nil
+}
@@ -0,0 +1,156 @@
+// Package remotecache implements minimal clients for shared caches (Redis and memcached),
+// used to share rendered responses between the replicas of a fleet.
+package remotecache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Cache is a shared key-value cache.
+type Cache interface {
+	// Get returns the value for the given key; the bool is false if the key is not in the cache.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for the given key, for the given TTL.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Close() error
+}
+
+const (
+	defaultDialTimeout = 2 * time.Second
+	defaultIOTimeout   = 2 * time.Second
+	defaultMaxIdle     = 16
+)
+
+// New returns a client for the cache at the given URL, e.g.
+//
+//	redis://:password@localhost:6379/0
+//	memcached://localhost:11211
+func New(rawURL string) (Cache, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache URL: %w", err)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid cache URL %q: missing host", rawURL)
+	}
+	switch parsed.Scheme {
+	case "redis":
+		return newRedis(parsed)
+	case "memcached", "memcache":
+		return newMemcached(parsed), nil
+	default:
+		return nil, fmt.Errorf("unsupported cache URL scheme %q (supported: redis, memcached)", parsed.Scheme)
+	}
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// pool is a pool of connections to the same address.
+type pool struct {
+	addr string
+	// init (optional) is called on every new connection (e.g. to authenticate).
+	init func(*conn) error
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errors.New("cache client is closed")
+	}
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, nil
+	}
+	p.mu.Unlock()
+
+	dialer := net.Dialer{Timeout: defaultDialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", p.addr, err)
+	}
+	c := &conn{
+		Conn: nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+	}
+	if p.init != nil {
+		c.SetDeadline(time.Now().Add(defaultIOTimeout))
+		if err := p.init(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// put returns the connection to the pool; connections that had an error must be closed instead.
+func (p *pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle) >= defaultMaxIdle {
+		c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+}
+
+// do runs fn on a pooled connection, with a deadline.
+func (p *pool) do(ctx context.Context, fn func(*conn) error) error {
+	c, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(defaultIOTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	c.SetDeadline(deadline)
+	if err := fn(c); err != nil {
+		var protoErr serverError
+		if errors.As(err, &protoErr) {
+			// the connection is still in a consistent state.
+			p.put(c)
+		} else {
+			c.Close()
+		}
+		return err
+	}
+	p.put(c)
+	return nil
+}
+
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+// serverError is an error reported by the server (as opposed to a network or protocol error).
+type serverError string
+
+func (e serverError) Error() string {
+	return string(e)
+}
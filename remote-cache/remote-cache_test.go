@@ -0,0 +1,187 @@
+package remotecache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer serves a tiny subset of the Redis or memcached protocol from a map.
+type fakeServer struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]string
+}
+
+func newFakeServer(t *testing.T, serve func(*fakeServer, *bufio.Reader, *bufio.Writer) error) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &fakeServer{
+		ln:   ln,
+		data: make(map[string][]byte),
+		ttls: make(map[string]string),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r, w := bufio.NewReader(c), bufio.NewWriter(c)
+				for {
+					if err := serve(srv, r, w); err != nil {
+						return
+					}
+					if err := w.Flush(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return srv
+}
+
+func readFakeLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	return strings.TrimSuffix(line, "\r\n"), err
+}
+
+func serveRedis(srv *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := readFakeLine(r)
+	if err != nil {
+		return err
+	}
+	n, _ := strconv.Atoi(line[1:])
+	args := make([]string, n)
+	for i := range args {
+		line, err := readFakeLine(r)
+		if err != nil {
+			return err
+		}
+		size, _ := strconv.Atoi(line[1:])
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		args[i] = string(buf[:size])
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		v, ok := srv.data[args[1]]
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return nil
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		srv.data[args[1]] = []byte(args[2])
+		srv.ttls[args[1]] = strings.Join(args[3:], " ")
+		w.WriteString("+OK\r\n")
+	default:
+		w.WriteString("-ERR unknown command\r\n")
+	}
+	return nil
+}
+
+func serveMemcached(srv *fakeServer, r *bufio.Reader, w *bufio.Writer) error {
+	line, err := readFakeLine(r)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(line)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	switch fields[0] {
+	case "get":
+		if v, ok := srv.data[fields[1]]; ok {
+			fmt.Fprintf(w, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(v), v)
+		}
+		w.WriteString("END\r\n")
+	case "set":
+		size, _ := strconv.Atoi(fields[4])
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		srv.data[fields[1]] = buf[:size]
+		srv.ttls[fields[1]] = fields[3]
+		w.WriteString("STORED\r\n")
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+func testCache(t *testing.T, cache Cache) {
+	ctx := context.Background()
+	_, found, err := cache.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	value := []byte("hello\r\nworld")
+	require.NoError(t, cache.Set(ctx, "key", value, time.Minute))
+	got, found, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, value, got)
+
+	// concurrent use of the pool.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			require.NoError(t, cache.Set(ctx, key, []byte(key), time.Minute))
+			got, found, err := cache.Get(ctx, key)
+			require.NoError(t, err)
+			require.True(t, found)
+			require.Equal(t, key, string(got))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, cache.Close())
+}
+
+func TestRedis(t *testing.T) {
+	srv := newFakeServer(t, serveRedis)
+	cache, err := New("redis://" + srv.ln.Addr().String())
+	require.NoError(t, err)
+	testCache(t, cache)
+	require.Equal(t, "PX 60000", srv.ttls["key"])
+}
+
+func TestMemcached(t *testing.T) {
+	srv := newFakeServer(t, serveMemcached)
+	cache, err := New("memcached://" + srv.ln.Addr().String())
+	require.NoError(t, err)
+	testCache(t, cache)
+	require.Equal(t, "60", srv.ttls["key"])
+
+	require.Error(t, cache.Set(context.Background(), "with space", nil, time.Minute))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("http://localhost:1234")
+	require.Error(t, err)
+	_, err = New("redis://")
+	require.Error(t, err)
+	_, err = New("redis://localhost:6379/abc")
+	require.Error(t, err)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"k8s.io/klog/v2"
+)
+
+// replayCursor is the progress of the replay of a consumer: all the transactions of the
+// slots up to Slot (included) were acknowledged by the consumer.
+type replayCursor struct {
+	Slot      uint64    `json:"slot"`
+	Delivered uint64    `json:"delivered"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// replayCursorFile stores the cursors of the consumers, by id, in a JSON file:
+// {"consumers": {"<id>": {"slot": ..., "delivered": ..., "updatedAt": ...}}}.
+// The file is rewritten atomically, so an interrupted replay leaves the last saved cursors.
+type replayCursorFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+type replayCursorFileContent struct {
+	Consumers map[string]replayCursor `json:"consumers"`
+}
+
+func newReplayCursorFile(path string) *replayCursorFile {
+	return &replayCursorFile{path: path}
+}
+
+func (f *replayCursorFile) read() (replayCursorFileContent, error) {
+	content := replayCursorFileContent{Consumers: make(map[string]replayCursor)}
+	buf, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return content, nil
+	}
+	if err != nil {
+		return content, err
+	}
+	if err := json.Unmarshal(buf, &content); err != nil {
+		return content, fmt.Errorf("failed to parse the cursor file %q: %w", f.path, err)
+	}
+	if content.Consumers == nil {
+		content.Consumers = make(map[string]replayCursor)
+	}
+	return content, nil
+}
+
+// Load returns the cursor of the consumer, if any.
+func (f *replayCursorFile) Load(consumerID string) (replayCursor, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, err := f.read()
+	if err != nil {
+		return replayCursor{}, false, err
+	}
+	cursor, ok := content.Consumers[consumerID]
+	return cursor, ok, nil
+}
+
+// Save saves the cursor of the consumer, keeping the ones of the other consumers.
+func (f *replayCursorFile) Save(consumerID string, cursor replayCursor) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	content, err := f.read()
+	if err != nil {
+		return err
+	}
+	cursor.UpdatedAt = time.Now().UTC()
+	content.Consumers[consumerID] = cursor
+	buf, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// resumeSlot returns the first slot to replay for the range, after the cursor (false if the
+// range was already replayed).
+func (c replayCursor) resumeSlot(fromSlot uint64, toSlot uint64) (uint64, bool) {
+	if c.Slot < fromSlot {
+		return fromSlot, true
+	}
+	if c.Slot >= toSlot {
+		return 0, false
+	}
+	return c.Slot + 1, true
+}
+
+// replayCursorTracker advances the cursor of a consumer as its deliveries are acknowledged,
+// and saves it at most every interval (and when the replay stops); a nil tracker does nothing.
+type replayCursorTracker struct {
+	file       *replayCursorFile
+	consumerID string
+	interval   time.Duration
+	cursor     replayCursor
+	// previouslyDelivered is the number of transactions delivered before this replay.
+	previouslyDelivered uint64
+	dirty               bool
+	savedAt             time.Time
+}
+
+func newReplayCursorTracker(file *replayCursorFile, consumerID string, interval time.Duration, cursor replayCursor) *replayCursorTracker {
+	return &replayCursorTracker{
+		file:       file,
+		consumerID: consumerID,
+		interval:   interval,
+		cursor:     cursor,
+		savedAt:    time.Now(),
+
+		previouslyDelivered: cursor.Delivered,
+	}
+}
+
+// ack records that all the transactions of the slots up to slot were acknowledged, and that
+// delivered transactions were delivered since the start of this replay.
+func (t *replayCursorTracker) ack(slot uint64, delivered uint64) error {
+	if t == nil || slot < t.cursor.Slot {
+		return nil
+	}
+	t.cursor.Slot = slot
+	t.cursor.Delivered = t.previouslyDelivered + delivered
+	t.dirty = true
+	if time.Since(t.savedAt) >= t.interval {
+		return t.save()
+	}
+	return nil
+}
+
+// save saves the cursor, if it changed since the last save.
+func (t *replayCursorTracker) save() error {
+	if t == nil || !t.dirty {
+		return nil
+	}
+	if err := t.file.Save(t.consumerID, t.cursor); err != nil {
+		return fmt.Errorf("failed to save the cursor of %q: %w", t.consumerID, err)
+	}
+	t.dirty = false
+	t.savedAt = time.Now()
+	return nil
+}
+
+// replayCursorFlags are the flags of the cursors of the replays.
+type replayCursorFlags struct {
+	consumerID   string
+	cursorFile   string
+	saveInterval time.Duration
+	reset        bool
+	file         *replayCursorFile
+}
+
+func newReplayCursorFlags(flags *replayCursorFlags) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "consumer-id",
+			Usage:       "id of the consumer, whose progress is saved in the cursor file so that an interrupted replay resumes after the last acknowledged slot (the consumers of --consumers always have one)",
+			Destination: &flags.consumerID,
+		},
+		&cli.StringFlag{
+			Name:        "cursor-file",
+			Usage:       "path of the file of the cursors of the consumers",
+			Value:       "replay-cursors.json",
+			Destination: &flags.cursorFile,
+		},
+		&cli.DurationFlag{
+			Name:        "cursor-save-interval",
+			Usage:       "how often the cursor is saved",
+			Value:       5 * time.Second,
+			Destination: &flags.saveInterval,
+		},
+		&cli.BoolFlag{
+			Name:        "reset-cursor",
+			Usage:       "ignore the saved cursors of the consumers, and replay the whole slot range",
+			Destination: &flags.reset,
+		},
+	}
+}
+
+// open returns the tracker of the cursor of the consumer (nil if consumerID is empty), and the
+// first slot to replay of the range (false if the consumer already replayed it).
+func (flags *replayCursorFlags) open(consumerID string, fromSlot uint64, toSlot uint64) (*replayCursorTracker, uint64, bool, error) {
+	if consumerID == "" {
+		return nil, fromSlot, true, nil
+	}
+	if flags.file == nil {
+		// shared by the trackers of the consumers, which save their cursors concurrently.
+		flags.file = newReplayCursorFile(flags.cursorFile)
+	}
+	cursor, found, err := flags.file.Load(consumerID)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !found || flags.reset {
+		return newReplayCursorTracker(flags.file, consumerID, flags.saveInterval, replayCursor{}), fromSlot, true, nil
+	}
+	resumeFrom, ok := cursor.resumeSlot(fromSlot, toSlot)
+	if ok && resumeFrom > fromSlot {
+		klog.Infof("Consumer %q: resuming after slot %d (%d transactions delivered)", consumerID, cursor.Slot, cursor.Delivered)
+	}
+	return newReplayCursorTracker(flags.file, consumerID, flags.saveInterval, cursor), resumeFrom, ok, nil
+}
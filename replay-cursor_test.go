@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayCursorFile(t *testing.T) {
+	file := newReplayCursorFile(filepath.Join(t.TempDir(), "cursors.json"))
+	_, found, err := file.Load("a")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, file.Save("a", replayCursor{Slot: 10, Delivered: 3}))
+	require.NoError(t, file.Save("b", replayCursor{Slot: 20}))
+	require.NoError(t, file.Save("a", replayCursor{Slot: 11, Delivered: 4}))
+
+	cursor, found, err := file.Load("a")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(11), cursor.Slot)
+	require.Equal(t, uint64(4), cursor.Delivered)
+	require.False(t, cursor.UpdatedAt.IsZero())
+	cursor, found, err = file.Load("b")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, uint64(20), cursor.Slot)
+}
+
+func TestReplayCursorResume(t *testing.T) {
+	flags := &replayCursorFlags{
+		cursorFile: filepath.Join(t.TempDir(), "cursors.json"),
+	}
+	tracker, from, ok, err := flags.open("a", 100, 200)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), from)
+
+	require.NoError(t, tracker.ack(150, 7))
+	// never moves backwards.
+	require.NoError(t, tracker.ack(120, 8))
+	require.NoError(t, tracker.save())
+
+	tracker, from, ok, err = flags.open("a", 100, 200)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(151), from)
+	// the count of delivered transactions carries over.
+	require.NoError(t, tracker.ack(200, 2))
+	require.NoError(t, tracker.save())
+	cursor, _, err := newReplayCursorFile(flags.cursorFile).Load("a")
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), cursor.Delivered)
+
+	_, _, ok, err = flags.open("a", 100, 200)
+	require.NoError(t, err)
+	require.False(t, ok)
+	// a later range starts at its first slot.
+	_, from, ok, err = flags.open("a", 300, 400)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(300), from)
+
+	flags.reset = true
+	_, from, ok, err = flags.open("a", 100, 200)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), from)
+
+	// without a consumer id, there's no cursor.
+	tracker, from, ok, err = (&replayCursorFlags{}).open("", 100, 200)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(100), from)
+	require.NoError(t, tracker.ack(150, 1))
+	require.NoError(t, tracker.save())
+}
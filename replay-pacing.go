@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// replayPacing limits the speed of a replay, so that the downstream systems aren't overwhelmed;
+// the zero value replays at full speed.
+type replayPacing struct {
+	// SlotsPerSecond limits the rate of the slots (counting the skipped ones, like the chain).
+	SlotsPerSecond float64
+	// RealTime replays the blocks at the pace of their block times, divided by Speed (when > 0).
+	RealTime bool
+	Speed    float64
+	// MaxBytesPerSecond limits the bandwidth of the deliveries.
+	MaxBytesPerSecond int64
+}
+
+func newReplayPacingFlags(pacing *replayPacing) []cli.Flag {
+	return []cli.Flag{
+		&cli.Float64Flag{
+			Name:        "slots-per-second",
+			Usage:       "maximum number of slots replayed per second (0 means no limit)",
+			Destination: &pacing.SlotsPerSecond,
+		},
+		&cli.BoolFlag{
+			Name:        "real-time",
+			Usage:       "replay the blocks at the pace of their block times (the original wall-clock pace)",
+			Destination: &pacing.RealTime,
+		},
+		&cli.Float64Flag{
+			Name:        "speed",
+			Usage:       "with --real-time, the speed relative to the original pace (e.g. 2 is twice as fast)",
+			Value:       1,
+			Destination: &pacing.Speed,
+		},
+		&cli.Int64Flag{
+			Name:        "max-bytes-per-second",
+			Usage:       "maximum number of bytes delivered per second (0 means no limit)",
+			Destination: &pacing.MaxBytesPerSecond,
+		},
+	}
+}
+
+func (p replayPacing) Validate() error {
+	if p.SlotsPerSecond < 0 {
+		return fmt.Errorf("--slots-per-second must not be negative")
+	}
+	if p.RealTime && p.Speed <= 0 {
+		return fmt.Errorf("--speed must be positive")
+	}
+	if p.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("--max-bytes-per-second must not be negative")
+	}
+	return nil
+}
+
+// String returns the description of the pacing, for the logs.
+func (p replayPacing) String() string {
+	s := "full speed"
+	switch {
+	case p.RealTime:
+		s = fmt.Sprintf("real time x%g", p.Speed)
+	case p.SlotsPerSecond > 0:
+		s = fmt.Sprintf("%g slots/s", p.SlotsPerSecond)
+	}
+	if p.MaxBytesPerSecond > 0 {
+		s += fmt.Sprintf(", max %d bytes/s", p.MaxBytesPerSecond)
+	}
+	return s
+}
+
+// replayPacer waits before each block and delivery, to keep the replay to the pace: the time
+// at which each one is due is computed from the start of the replay, so the waits don't drift.
+type replayPacer struct {
+	pacing replayPacing
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+
+	started        bool
+	startedAt      time.Time
+	firstSlot      uint64
+	firstBlockTime int64
+	bytesStartedAt time.Time
+	bytes          int64
+}
+
+func newReplayPacer(pacing replayPacing) *replayPacer {
+	return &replayPacer{
+		pacing: pacing,
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p *replayPacer) waitUntil(ctx context.Context, due time.Time) error {
+	if wait := due.Sub(p.now()); wait > 0 {
+		return p.sleep(ctx, wait)
+	}
+	return nil
+}
+
+// waitBlock waits until the block with the given slot and block time (unix seconds, 0 if unknown) is due.
+func (p *replayPacer) waitBlock(ctx context.Context, slot uint64, blockTime int64) error {
+	if !p.pacing.RealTime && p.pacing.SlotsPerSecond <= 0 {
+		return nil
+	}
+	if !p.started {
+		p.started = true
+		p.startedAt = p.now()
+		p.firstSlot = slot
+		p.firstBlockTime = blockTime
+		return nil
+	}
+	var offset time.Duration
+	switch {
+	case p.pacing.RealTime:
+		if blockTime == 0 || p.firstBlockTime == 0 {
+			// no block time to pace by; the first block with one restarts the clock.
+			if p.firstBlockTime == 0 && blockTime != 0 {
+				p.startedAt = p.now()
+				p.firstBlockTime = blockTime
+			}
+			return nil
+		}
+		offset = time.Duration(float64(time.Duration(blockTime-p.firstBlockTime)*time.Second) / p.pacing.Speed)
+	default:
+		offset = time.Duration(float64(slot-p.firstSlot) / p.pacing.SlotsPerSecond * float64(time.Second))
+	}
+	return p.waitUntil(ctx, p.startedAt.Add(offset))
+}
+
+// waitBytes waits until the delivery of n more bytes is allowed.
+func (p *replayPacer) waitBytes(ctx context.Context, n int) error {
+	if p.pacing.MaxBytesPerSecond <= 0 {
+		return nil
+	}
+	if p.bytesStartedAt.IsZero() {
+		p.bytesStartedAt = p.now()
+	}
+	// the bytes delivered so far are due after bytes/rate seconds; the new ones are sent when they are.
+	due := p.bytesStartedAt.Add(time.Duration(float64(p.bytes) / float64(p.pacing.MaxBytesPerSecond) * float64(time.Second)))
+	if now := p.now(); now.Sub(due) > time.Second {
+		// idle for a while (e.g. no transaction selected): don't allow a burst to catch up.
+		p.bytesStartedAt = now
+		p.bytes = 0
+		due = now
+	}
+	p.bytes += int64(n)
+	return p.waitUntil(ctx, due)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReplayPacer returns a pacer with a fake clock, which records the waits.
+func newTestReplayPacer(pacing replayPacing) (*replayPacer, *[]time.Duration) {
+	var waits []time.Duration
+	now := time.Unix(1700000000, 0)
+	p := newReplayPacer(pacing)
+	p.now = func() time.Time { return now }
+	p.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	return p, &waits
+}
+
+func TestReplayPacerSlotsPerSecond(t *testing.T) {
+	ctx := context.Background()
+	p, waits := newTestReplayPacer(replayPacing{SlotsPerSecond: 10})
+	require.NoError(t, p.waitBlock(ctx, 100, 0))
+	require.NoError(t, p.waitBlock(ctx, 101, 0))
+	// skipped slots are paced too.
+	require.NoError(t, p.waitBlock(ctx, 105, 0))
+	require.Equal(t, []time.Duration{100 * time.Millisecond, 400 * time.Millisecond}, *waits)
+}
+
+func TestReplayPacerRealTime(t *testing.T) {
+	ctx := context.Background()
+	p, waits := newTestReplayPacer(replayPacing{RealTime: true, Speed: 2})
+	// the first block with a block time starts the clock.
+	require.NoError(t, p.waitBlock(ctx, 99, 0))
+	require.NoError(t, p.waitBlock(ctx, 100, 1000))
+	require.NoError(t, p.waitBlock(ctx, 101, 1000))
+	require.NoError(t, p.waitBlock(ctx, 102, 0))
+	require.NoError(t, p.waitBlock(ctx, 103, 1004))
+	require.Equal(t, []time.Duration{2 * time.Second}, *waits)
+}
+
+func TestReplayPacerBytes(t *testing.T) {
+	ctx := context.Background()
+	p, waits := newTestReplayPacer(replayPacing{MaxBytesPerSecond: 1000})
+	require.NoError(t, p.waitBytes(ctx, 500))
+	require.NoError(t, p.waitBytes(ctx, 1000))
+	require.NoError(t, p.waitBytes(ctx, 10))
+	require.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, *waits)
+
+	// full speed.
+	p, waits = newTestReplayPacer(replayPacing{})
+	require.NoError(t, p.waitBlock(ctx, 1, 1))
+	require.NoError(t, p.waitBlock(ctx, 1000, 100000))
+	require.NoError(t, p.waitBytes(ctx, 1<<30))
+	require.Empty(t, *waits)
+}
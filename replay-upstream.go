@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	bin "github.com/gagliardetto/binary"
+	"github.com/gagliardetto/solana-go"
+	"k8s.io/klog/v2"
+)
+
+// blockSourceUpstream is the source of the blocks fetched from the upstream RPC server,
+// instead of the CARs of the archive.
+const blockSourceUpstream = "upstream"
+
+// maxGetBlocksRange is the largest slot range of a getBlocks request accepted by the RPC.
+const maxGetBlocksRange = 500_000
+
+// codeBlockNotAvailable is the code of solana for a block that is not available (yet) for the slot.
+const codeBlockNotAvailable = -32004
+
+// upstreamTransactionMeta is the meta of a transaction fetched from the upstream RPC server:
+// it's already in the format of the RPC responses.
+type upstreamTransactionMeta struct {
+	Raw             json.RawMessage `json:"-"`
+	Err             any             `json:"err"`
+	Fee             uint64          `json:"fee"`
+	LoadedAddresses struct {
+		Writable []solana.PublicKey `json:"writable"`
+		Readonly []solana.PublicKey `json:"readonly"`
+	} `json:"loadedAddresses"`
+}
+
+// upstreamBlockSource fetches the blocks that the archive lacks from the target of a proxy config.
+type upstreamBlockSource struct {
+	config     *ProxyConfig
+	httpClient *http.Client
+}
+
+func newUpstreamBlockSource(config *ProxyConfig, httpClient *http.Client) *upstreamBlockSource {
+	return &upstreamBlockSource{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+type upstreamRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *upstreamRPCError) Error() string {
+	return fmt.Sprintf("upstream RPC error %d: %s", e.Code, e.Message)
+}
+
+func (u *upstreamBlockSource) call(ctx context.Context, method string, params []any, result any) error {
+	body, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.config.Target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range u.config.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to call %s: status %d", method, resp.StatusCode)
+	}
+	var response struct {
+		Result json.RawMessage   `json:"result"`
+		Error  *upstreamRPCError `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode the response of %s: %w", method, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// getBlocks returns the slots of the range (inclusive) that have a block.
+func (u *upstreamBlockSource) getBlocks(ctx context.Context, fromSlot uint64, toSlot uint64) ([]uint64, error) {
+	var slots []uint64
+	for start := fromSlot; start <= toSlot; start += maxGetBlocksRange {
+		end := min(toSlot, start+maxGetBlocksRange-1)
+		var chunk []uint64
+		if err := u.call(ctx, "getBlocks", []any{start, end, map[string]any{"commitment": "finalized"}}, &chunk); err != nil {
+			return nil, err
+		}
+		slots = append(slots, chunk...)
+		if end == toSlot {
+			break
+		}
+	}
+	return slots, nil
+}
+
+// getBlock returns the block of the slot, or nil if the upstream doesn't have it.
+func (u *upstreamBlockSource) getBlock(ctx context.Context, slot uint64) (*transcodeBlock, error) {
+	var result *struct {
+		Blockhash    solana.Hash `json:"blockhash"`
+		ParentSlot   uint64      `json:"parentSlot"`
+		BlockTime    *int64      `json:"blockTime"`
+		BlockHeight  *uint64     `json:"blockHeight"`
+		Transactions []struct {
+			Transaction [2]string       `json:"transaction"`
+			Meta        json.RawMessage `json:"meta"`
+		} `json:"transactions"`
+	}
+	err := u.call(ctx, "getBlock", []any{slot, map[string]any{
+		"encoding":                       solana.EncodingBase64,
+		"transactionDetails":             "full",
+		"rewards":                        false,
+		"maxSupportedTransactionVersion": 0,
+		"commitment":                     "finalized",
+	}}, &result)
+	if rpcErr, ok := err.(*upstreamRPCError); ok && (rpcErr.Code == CodeSlotSkipped || rpcErr.Code == CodeNotFound || rpcErr.Code == codeBlockNotAvailable) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, nil
+	}
+	block := &transcodeBlock{
+		Slot:        slot,
+		ParentSlot:  result.ParentSlot,
+		BlockHeight: result.BlockHeight,
+		Blockhash:   result.Blockhash,
+		Source:      blockSourceUpstream,
+	}
+	if result.BlockTime != nil {
+		block.BlockTime = *result.BlockTime
+	}
+	for index, encoded := range result.Transactions {
+		buf, err := base64.StdEncoding.DecodeString(encoded.Transaction[0])
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d of block %d: %w", index, slot, err)
+		}
+		var tx solana.Transaction
+		if err := bin.UnmarshalBin(&tx, buf); err != nil {
+			return nil, fmt.Errorf("transaction %d of block %d: %w", index, slot, err)
+		}
+		var meta *upstreamTransactionMeta
+		if len(encoded.Meta) > 0 && string(encoded.Meta) != "null" {
+			meta = &upstreamTransactionMeta{Raw: encoded.Meta}
+			if err := json.Unmarshal(encoded.Meta, meta); err != nil {
+				return nil, fmt.Errorf("meta of transaction %d of block %d: %w", index, slot, err)
+			}
+		}
+		block.Transactions = append(block.Transactions, transcodeTransaction{
+			Index:       index,
+			Transaction: tx,
+			Meta:        meta,
+		})
+	}
+	return block, nil
+}
+
+// upstreamGaps returns the slot ranges (inclusive) of the range that no config covers: the epochs
+// without config, and, if the range has an upper limit, the slots after the last epoch.
+func upstreamGaps(configs ConfigSlice, fromSlot uint64, toSlot uint64) [][2]uint64 {
+	var gaps [][2]uint64
+	for _, epochs := range missingEpochs(configs, fromSlot, toSlot) {
+		start, _ := CalcEpochLimits(epochs[0])
+		_, stop := CalcEpochLimits(epochs[1])
+		gaps = append(gaps, [2]uint64{max(start, fromSlot), min(stop, toSlot)})
+	}
+	if len(configs) > 0 && toSlot != ^uint64(0) {
+		_, lastStop := CalcEpochLimits(*configs[len(configs)-1].Epoch)
+		if toSlot > lastStop {
+			gaps = append(gaps, [2]uint64{max(lastStop+1, fromSlot), toSlot})
+		}
+	}
+	return gaps
+}
+
+// upstreamGapFiller fills the gaps of a stream of blocks with the blocks of the upstream;
+// a nil filler does nothing.
+type upstreamGapFiller struct {
+	source *upstreamBlockSource
+	gaps   [][2]uint64
+	filled uint64
+}
+
+// fillBefore calls fn with the upstream blocks of the gaps before slot, in slot order.
+func (f *upstreamGapFiller) fillBefore(ctx context.Context, slot uint64, fn func(*transcodeBlock) error) error {
+	if f == nil {
+		return nil
+	}
+	for len(f.gaps) > 0 && f.gaps[0][0] < slot {
+		gap := f.gaps[0]
+		end := min(gap[1], slot-1)
+		if end == gap[1] {
+			f.gaps = f.gaps[1:]
+		} else {
+			f.gaps[0][0] = end + 1
+		}
+		slots, err := f.source.getBlocks(ctx, gap[0], end)
+		if err != nil {
+			return fmt.Errorf("failed to list the upstream blocks of the slots %d-%d: %w", gap[0], end, err)
+		}
+		klog.Infof("Filling the slots %d-%d from the upstream (%d blocks)", gap[0], end, len(slots))
+		for _, blockSlot := range slots {
+			block, err := f.source.getBlock(ctx, blockSlot)
+			if err != nil {
+				return fmt.Errorf("failed to get the upstream block %d: %w", blockSlot, err)
+			}
+			if block == nil {
+				continue
+			}
+			f.filled++
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
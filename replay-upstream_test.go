@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamGapFiller(t *testing.T) {
+	payer := solana.NewWallet().PublicKey()
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			Header:          solana.MessageHeader{NumRequiredSignatures: 1, NumReadonlyUnsignedAccounts: 1},
+			AccountKeys:     []solana.PublicKey{payer, solana.MemoProgramID},
+			RecentBlockhash: solana.Hash{2},
+			Instructions:    []solana.CompiledInstruction{{ProgramIDIndex: 1, Data: []byte("hi")}},
+		},
+	}
+	txBuf, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "secret", r.Header.Get("Authorization"))
+		var req struct {
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.Method {
+		case "getBlocks":
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"result":[5,7,8]}`)
+		case "getBlock":
+			switch string(req.Params[0]) {
+			case "7":
+				fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32007,"message":"Slot 7 was skipped"}}`)
+			default:
+				fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":{"blockhash":%q,"parentSlot":4,"blockTime":1700000000,"blockHeight":3,"transactions":[{"transaction":[%q,"base64"],"meta":{"err":{"InstructionError":[0,"InvalidArgument"]},"fee":5000,"loadedAddresses":{"writable":[],"readonly":[]}}}]}}`,
+					solana.Hash{3}.String(), base64.StdEncoding.EncodeToString(txBuf))
+			}
+		default:
+			t.Errorf("unexpected method %q", req.Method)
+		}
+	}))
+	defer server.Close()
+
+	filler := &upstreamGapFiller{
+		source: newUpstreamBlockSource(&ProxyConfig{Target: server.URL, Headers: map[string]string{"Authorization": "secret"}}, server.Client()),
+		gaps:   [][2]uint64{{5, 9}},
+	}
+	var blocks []*transcodeBlock
+	collect := func(block *transcodeBlock) error {
+		blocks = append(blocks, block)
+		return nil
+	}
+	ctx := context.Background()
+	// nothing before the gap.
+	require.NoError(t, filler.fillBefore(ctx, 5, collect))
+	require.Empty(t, blocks)
+	// the skipped slot has no block.
+	require.NoError(t, filler.fillBefore(ctx, 10, collect))
+	require.Len(t, blocks, 2)
+	require.Empty(t, filler.gaps)
+	require.Equal(t, uint64(2), filler.filled)
+
+	block := blocks[0]
+	require.Equal(t, uint64(5), block.Slot)
+	require.Equal(t, uint64(4), block.ParentSlot)
+	require.Equal(t, int64(1700000000), block.BlockTime)
+	require.Equal(t, solana.Hash{3}, block.Blockhash)
+	require.Equal(t, blockSourceUpstream, block.Source)
+	require.Len(t, block.Transactions, 1)
+	require.Equal(t, tx.Signatures, block.Transactions[0].Transaction.Signatures)
+	meta := block.Transactions[0].Meta
+	require.Equal(t, uint64(5000), transactionFeeFromMeta(meta))
+	txErr, err := transactionErrorFromMeta(meta)
+	require.NoError(t, err)
+	require.NotNil(t, txErr)
+
+	// the source and the meta of the upstream are in the encoded transaction.
+	encoded, err := encodeReplayTransaction(block, &block.Transactions[0], solana.EncodingBase64)
+	require.NoError(t, err)
+	var result map[string]any
+	require.NoError(t, json.Unmarshal(encoded, &result))
+	require.Equal(t, "upstream", result["source"])
+	require.Equal(t, float64(5000), result["meta"].(map[string]any)["fee"])
+	require.Equal(t, []any{base64.StdEncoding.EncodeToString(txBuf), "base64"}, result["transaction"])
+}
+
+func TestUpstreamGaps(t *testing.T) {
+	configsOf := func(epochs ...uint64) ConfigSlice {
+		configs := make(ConfigSlice, 0, len(epochs))
+		for _, epoch := range epochs {
+			epoch := epoch
+			configs = append(configs, &Config{Epoch: &epoch})
+		}
+		return configs
+	}
+	_, stop1 := CalcEpochLimits(1)
+	start3, stop3 := CalcEpochLimits(3)
+	_, stop4 := CalcEpochLimits(4)
+	start5, _ := CalcEpochLimits(5)
+
+	require.Equal(t, [][2]uint64{{start3 + 10, stop3}}, upstreamGaps(configsOf(2, 4), start3+10, ^uint64(0)))
+	// after the last epoch, only with an upper limit.
+	require.Equal(t, [][2]uint64{{0, stop1}, {start3, stop3}, {stop4 + 1, start5 + 10}}, upstreamGaps(configsOf(2, 4), 0, start5+10))
+}
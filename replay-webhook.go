@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/klog/v2"
+)
+
+// The headers of the webhook deliveries.
+const (
+	// webhookSignatureHeader is "sha256=" followed by the hex of the HMAC-SHA256, keyed with the
+	// secret, of the timestamp header, a dot, and the body.
+	webhookSignatureHeader = "X-Faithful-Signature"
+	webhookTimestampHeader = "X-Faithful-Timestamp"
+	// webhookDeliveryHeader identifies the content of a delivery (the same for its retries, and
+	// for the same batch replayed again), so that the consumers can deduplicate them.
+	webhookDeliveryHeader = "X-Faithful-Delivery"
+)
+
+// webhook POSTs batches of transactions to a URL, with retries.
+type webhook struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+	// retries is the number of retries of a failed delivery, with an exponential backoff starting at retryDelay.
+	retries    int
+	retryDelay time.Duration
+}
+
+// signWebhookBody returns the signature of the body sent at the given timestamp.
+func signWebhookBody(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver POSTs the body, retrying on the network errors, the 5xx and the 429 responses.
+func (w *webhook) deliver(ctx context.Context, body []byte) error {
+	sum := sha256.Sum256(body)
+	deliveryID := hex.EncodeToString(sum[:16])
+	delay := w.retryDelay
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := w.post(ctx, body, deliveryID)
+		if err == nil {
+			return nil
+		}
+		if retryAfter < 0 || attempt >= w.retries {
+			return fmt.Errorf("failed to deliver to %s after %d attempts: %w", w.url, attempt+1, err)
+		}
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		klog.Warningf("Delivery %s to %s failed (attempt %d): %v; retrying in %s", deliveryID, w.url, attempt+1, err, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
+
+// post sends the body once; on failure, it returns how long to wait before retrying
+// (0 for the default backoff), or a negative duration if the error is permanent.
+func (w *webhook) post(ctx context.Context, body []byte, deliveryID string) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookDeliveryHeader, deliveryID)
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, timestamp)
+		req.Header.Set(webhookSignatureHeader, signWebhookBody(w.secret, timestamp, body))
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return -1, err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	err = fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if seconds, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second, err
+		}
+		return 0, err
+	case resp.StatusCode >= 500:
+		return 0, err
+	default:
+		return -1, err
+	}
+}
+
+// webhookBatcher delivers the transactions to the webhooks, as JSON arrays of up to batchSize of them.
+type webhookBatcher struct {
+	webhooks  []*webhook
+	batchSize int
+	// pacer limits the bandwidth of the deliveries, if set.
+	pacer     *replayPacer
+	batch     []json.RawMessage
+	delivered uint64
+}
+
+func (b *webhookBatcher) add(ctx context.Context, tx json.RawMessage) error {
+	b.batch = append(b.batch, tx)
+	if len(b.batch) >= b.batchSize {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+// flush delivers the batch to all the webhooks, in parallel.
+func (b *webhookBatcher) flush(ctx context.Context) error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(b.batch)
+	if err != nil {
+		return err
+	}
+	if b.pacer != nil {
+		if err := b.pacer.waitBytes(ctx, len(body)); err != nil {
+			return err
+		}
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for _, w := range b.webhooks {
+		w := w
+		g.Go(func() error {
+			return w.deliver(ctx, body)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	b.delivered += uint64(len(b.batch))
+	b.batch = b.batch[:0]
+	return nil
+}
+
+// webhookConsumer delivers the transactions selected by its filter to its webhooks.
+type webhookConsumer struct {
+	name     string
+	filter   transactionFilter
+	encoding solana.EncodingType
+	batcher  *webhookBatcher
+	// tracker saves the cursor of the consumer, if it has one.
+	tracker *replayCursorTracker
+	from    uint64
+	// batchSlot is the first slot of the transactions in the batch; lastSlot is the last block replayed.
+	batchSlot uint64
+	lastSlot  uint64
+	// onDelivered is called with the size of each encoded transaction (for the progress).
+	onDelivered func(size int)
+}
+
+func (c *webhookConsumer) id() string {
+	return c.name
+}
+
+func (c *webhookConsumer) fromSlot() uint64 {
+	return c.from
+}
+
+func (c *webhookConsumer) replayBlock(ctx context.Context, block *transcodeBlock) error {
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		if !c.filter.Matches(&tx.Transaction, tx.Meta) {
+			continue
+		}
+		encoded, err := encodeReplayTransaction(block, tx, c.encoding)
+		if err != nil {
+			return fmt.Errorf("slot %d: %w", block.Slot, err)
+		}
+		if len(c.batcher.batch) == 0 {
+			c.batchSlot = block.Slot
+		}
+		if c.onDelivered != nil {
+			c.onDelivered(len(encoded))
+		}
+		if err := c.batcher.add(ctx, encoded); err != nil {
+			return c.restartHint(err)
+		}
+	}
+	c.lastSlot = block.Slot
+	// the slots before the first one with transactions still in the batch are acknowledged.
+	if len(c.batcher.batch) == 0 {
+		return c.tracker.ack(block.Slot, c.batcher.delivered)
+	}
+	if c.batchSlot > c.from {
+		return c.tracker.ack(c.batchSlot-1, c.batcher.delivered)
+	}
+	return nil
+}
+
+// restartHint adds the slot to restart from to the error of a delivery.
+func (c *webhookConsumer) restartHint(err error) error {
+	if c.tracker != nil {
+		return err
+	}
+	return fmt.Errorf("%w (restart with --from=%d)", err, c.batchSlot)
+}
+
+func (c *webhookConsumer) finish(ctx context.Context) error {
+	if err := c.batcher.flush(ctx); err != nil {
+		return c.restartHint(err)
+	}
+	if c.lastSlot > 0 {
+		if err := c.tracker.ack(c.lastSlot, c.batcher.delivered); err != nil {
+			return err
+		}
+	}
+	return c.tracker.save()
+}
+
+func (c *webhookConsumer) abort() {
+	if err := c.tracker.save(); err != nil {
+		klog.Errorf("%s", err)
+	}
+}
+
+// webhookConsumersFile lists the consumers of `replay webhook --consumers`, each with its own
+// webhooks, filter and cursor.
+type webhookConsumersFile struct {
+	Consumers []webhookConsumerConfig `json:"consumers" yaml:"consumers"`
+}
+
+type webhookConsumerConfig struct {
+	// ID identifies the consumer, and its cursor in the cursor file.
+	ID   string   `json:"id" yaml:"id"`
+	URLs []string `json:"urls" yaml:"urls"`
+	// Secret signs the requests; SecretEnv is the name of an environment variable with it.
+	Secret    string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	SecretEnv string `json:"secret_env,omitempty" yaml:"secret_env,omitempty"`
+	// Encoding and BatchSize override the ones of the command.
+	Encoding  string                  `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	BatchSize int                     `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`
+	Filter    transactionFilterConfig `json:"filter,omitempty" yaml:"filter,omitempty"`
+}
+
+// transactionFilterConfig is a transactionFilter in a config file.
+type transactionFilterConfig struct {
+	Accounts      []string `json:"accounts,omitempty" yaml:"accounts,omitempty"`
+	Programs      []string `json:"programs,omitempty" yaml:"programs,omitempty"`
+	IncludeVote   bool     `json:"include_vote,omitempty" yaml:"include_vote,omitempty"`
+	IncludeFailed bool     `json:"include_failed,omitempty" yaml:"include_failed,omitempty"`
+}
+
+func (c transactionFilterConfig) filter() (transactionFilter, error) {
+	f := transactionFilter{
+		IncludeVote:   c.IncludeVote,
+		IncludeFailed: c.IncludeFailed,
+	}
+	var err error
+	if f.Accounts, err = parsePublicKeys("account", c.Accounts); err != nil {
+		return f, err
+	}
+	if f.Programs, err = parsePublicKeys("program", c.Programs); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// loadWebhookConsumers loads and validates the consumers of a JSON or YAML file.
+func loadWebhookConsumers(path string) ([]webhookConsumerConfig, error) {
+	var file webhookConsumersFile
+	var err error
+	if isJSONFile(path) {
+		err = loadFromJSON(path, &file)
+	} else if isYAMLFile(path) {
+		err = loadFromYAML(path, &file)
+	} else {
+		return nil, fmt.Errorf("consumers file %q must be a JSON or YAML file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consumers file %q: %w", path, err)
+	}
+	if len(file.Consumers) == 0 {
+		return nil, fmt.Errorf("consumers file %q has no consumers", path)
+	}
+	ids := make(map[string]bool)
+	for i, consumer := range file.Consumers {
+		if consumer.ID == "" {
+			return nil, fmt.Errorf("consumer #%d has no id", i)
+		}
+		if ids[consumer.ID] {
+			return nil, fmt.Errorf("duplicate consumer id %q", consumer.ID)
+		}
+		ids[consumer.ID] = true
+		if len(consumer.URLs) == 0 {
+			return nil, fmt.Errorf("consumer %q has no urls", consumer.ID)
+		}
+		if consumer.SecretEnv != "" {
+			file.Consumers[i].Secret = os.Getenv(consumer.SecretEnv)
+			if file.Consumers[i].Secret == "" {
+				return nil, fmt.Errorf("consumer %q: the environment variable %s is not set", consumer.ID, consumer.SecretEnv)
+			}
+		}
+		if _, err := consumer.Filter.filter(); err != nil {
+			return nil, fmt.Errorf("consumer %q: %w", consumer.ID, err)
+		}
+	}
+	return file.Consumers, nil
+}
+
+// newWebhookConsumer returns the consumer of the config (without its webhooks), starting after
+// its cursor; false if it already replayed the slot range.
+func newWebhookConsumer(
+	config webhookConsumerConfig,
+	defaultEncoding string,
+	defaultBatchSize int,
+	fromSlot uint64,
+	toSlot uint64,
+	cursorFlags *replayCursorFlags,
+) (*webhookConsumer, bool, error) {
+	name := config.ID
+	if name == "" {
+		name = "default"
+	}
+	encoding := solana.EncodingType(defaultEncoding)
+	if config.Encoding != "" {
+		encoding = solana.EncodingType(config.Encoding)
+	}
+	if !isAnyEncodingOf(
+		encoding,
+		solana.EncodingBase58,
+		solana.EncodingBase64,
+		solana.EncodingBase64Zstd,
+		solana.EncodingJSON,
+		solana.EncodingJSONParsed,
+	) {
+		return nil, false, fmt.Errorf("consumer %q: unsupported encoding %q", name, encoding)
+	}
+	batchSize := defaultBatchSize
+	if config.BatchSize != 0 {
+		batchSize = config.BatchSize
+	}
+	if batchSize < 1 {
+		return nil, false, fmt.Errorf("consumer %q: the batch size must be at least 1", name)
+	}
+	filter, err := config.Filter.filter()
+	if err != nil {
+		return nil, false, fmt.Errorf("consumer %q: %w", name, err)
+	}
+	tracker, from, ok, err := cursorFlags.open(config.ID, fromSlot, toSlot)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return &webhookConsumer{
+		name:     name,
+		filter:   filter,
+		encoding: encoding,
+		batcher:  &webhookBatcher{batchSize: batchSize},
+		tracker:  tracker,
+		from:     from,
+	}, true, nil
+}
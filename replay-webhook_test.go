@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookBatcher(t *testing.T) {
+	var calls atomic.Int32
+	var bodies [][]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		timestamp := r.Header.Get(webhookTimestampHeader)
+		require.Equal(t, signWebhookBody("secret", timestamp, body), r.Header.Get(webhookSignatureHeader))
+		require.NotEmpty(t, r.Header.Get(webhookDeliveryHeader))
+		// the first attempt of each delivery fails.
+		if calls.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []json.RawMessage
+		require.NoError(t, json.Unmarshal(body, &batch))
+		bodies = append(bodies, batch)
+	}))
+	defer server.Close()
+
+	batcher := &webhookBatcher{
+		webhooks: []*webhook{{
+			url:        server.URL,
+			secret:     "secret",
+			httpClient: server.Client(),
+			retries:    1,
+			retryDelay: time.Millisecond,
+		}},
+		batchSize: 2,
+	}
+	ctx := context.Background()
+	for _, tx := range []string{`{"a":1}`, `{"b":2}`, `{"c":3}`} {
+		require.NoError(t, batcher.add(ctx, json.RawMessage(tx)))
+	}
+	require.NoError(t, batcher.flush(ctx))
+	require.Equal(t, uint64(3), batcher.delivered)
+	require.Equal(t, [][]json.RawMessage{
+		{json.RawMessage(`{"a":1}`), json.RawMessage(`{"b":2}`)},
+		{json.RawMessage(`{"c":3}`)},
+	}, bodies)
+	require.Equal(t, int32(4), calls.Load())
+}
+
+func TestWebhookDeliverFailures(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	hook := &webhook{url: server.URL, httpClient: server.Client(), retries: 2, retryDelay: time.Millisecond}
+
+	// retried, then given up.
+	require.Error(t, hook.deliver(context.Background(), []byte(`[]`)))
+	require.Equal(t, int32(3), calls.Load())
+
+	// client errors are not retried.
+	calls.Store(0)
+	status = http.StatusBadRequest
+	require.Error(t, hook.deliver(context.Background(), []byte(`[]`)))
+	require.Equal(t, int32(1), calls.Load())
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gagliardetto/solana-go"
+	jsoniter "github.com/json-iterator/go"
+	"k8s.io/klog/v2"
+)
+
+// replayConsumer receives the blocks of a replay: it selects and delivers their transactions,
+// and tracks its own cursor, independently of the other consumers of the same replay.
+type replayConsumer interface {
+	id() string
+	// fromSlot is the first slot to deliver to the consumer (e.g. after its cursor).
+	fromSlot() uint64
+	// replayBlock delivers the transactions of the block selected by the consumer.
+	replayBlock(ctx context.Context, block *transcodeBlock) error
+	// finish delivers the pending transactions at the end of the replay, and saves the cursor.
+	finish(ctx context.Context) error
+	// abort saves the cursor when the consumer is stopped after a failure.
+	abort()
+}
+
+// replayFanOut feeds the blocks of a single read of the CARs to several consumers, in parallel;
+// a consumer that fails is stopped, and the others go on.
+type replayFanOut struct {
+	active []replayConsumer
+	errs   []error
+}
+
+func newReplayFanOut(consumers []replayConsumer) *replayFanOut {
+	return &replayFanOut{active: append([]replayConsumer(nil), consumers...)}
+}
+
+// fromSlot returns the first slot needed by any of the consumers.
+func (f *replayFanOut) fromSlot() uint64 {
+	from := ^uint64(0)
+	for _, consumer := range f.active {
+		from = min(from, consumer.fromSlot())
+	}
+	return from
+}
+
+func (f *replayFanOut) fail(consumer replayConsumer, err error) {
+	klog.Errorf("Replay consumer %q stopped: %s", consumer.id(), err)
+	consumer.abort()
+	f.errs = append(f.errs, fmt.Errorf("consumer %q: %w", consumer.id(), err))
+}
+
+// replayBlock feeds the block to the consumers that need it; it fails only when all the consumers have failed.
+func (f *replayFanOut) replayBlock(ctx context.Context, block *transcodeBlock) error {
+	errs := make([]error, len(f.active))
+	var wg sync.WaitGroup
+	for i, consumer := range f.active {
+		if block.Slot < consumer.fromSlot() {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, consumer replayConsumer) {
+			defer wg.Done()
+			errs[i] = consumer.replayBlock(ctx, block)
+		}(i, consumer)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	active := f.active[:0]
+	for i, consumer := range f.active {
+		if errs[i] != nil {
+			f.fail(consumer, errs[i])
+			continue
+		}
+		active = append(active, consumer)
+	}
+	f.active = active
+	if len(f.active) == 0 {
+		return errors.Join(f.errs...)
+	}
+	return nil
+}
+
+// finish finishes the replay of the consumers, and returns the errors of the ones that failed;
+// after an error of the replay itself (err), the consumers are only stopped.
+func (f *replayFanOut) finish(ctx context.Context, err error) error {
+	if err != nil {
+		for _, consumer := range f.active {
+			consumer.abort()
+		}
+		f.active = nil
+		return errors.Join(append([]error{err}, f.errs...)...)
+	}
+	for _, consumer := range f.active {
+		if err := consumer.finish(ctx); err != nil {
+			f.fail(consumer, err)
+		}
+	}
+	f.active = nil
+	return errors.Join(f.errs...)
+}
+
+// replayToConsumers reads the blocks of the slot range (from the first slot needed by any of the
+// consumers), at the pace of the pacer, and feeds them to the consumers; the gaps of the archive
+// are filled by the filler, if not nil.
+func replayToConsumers(
+	ctx context.Context,
+	scanner *epochScanner,
+	configs ConfigSlice,
+	toSlot uint64,
+	pacer *replayPacer,
+	filler *upstreamGapFiller,
+	consumers []replayConsumer,
+) error {
+	fanOut := newReplayFanOut(consumers)
+	deliver := func(block *transcodeBlock) error {
+		if err := pacer.waitBlock(ctx, block.Slot, block.BlockTime); err != nil {
+			return err
+		}
+		return fanOut.replayBlock(ctx, block)
+	}
+	err := transcodeSlotRange(ctx, scanner, configs, fanOut.fromSlot(), toSlot, func(block *transcodeBlock) error {
+		if err := filler.fillBefore(ctx, block.Slot, deliver); err != nil {
+			return err
+		}
+		return deliver(block)
+	})
+	if err == nil {
+		err = filler.fillBefore(ctx, ^uint64(0), deliver)
+	}
+	if len(fanOut.active) == 0 {
+		// all the consumers failed: err is the join of their errors.
+		return err
+	}
+	return fanOut.finish(ctx, err)
+}
+
+// encodeReplayTransaction encodes the transaction as the result of getTransaction with the given encoding.
+func encodeReplayTransaction(block *transcodeBlock, tx *transcodeTransaction, encoding solana.EncodingType) (json.RawMessage, error) {
+	upstreamMeta, isUpstream := tx.Meta.(*upstreamTransactionMeta)
+	response := GetTransactionResponse{
+		Slot:     ptrToUint64(block.Slot),
+		Meta:     tx.Meta,
+		Version:  transactionVersion(&tx.Transaction),
+		Position: uint64(tx.Index),
+	}
+	if block.BlockTime != 0 {
+		response.Blocktime = ptrToUint64(uint64(block.BlockTime))
+	}
+	encoded, err := encodeTransactionResponseBasedOnWantedEncoding(encoding, tx.Transaction, tx.Meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transaction: %w", err)
+	}
+	response.Transaction = encoded
+	response.mapMetaDirectly()
+	if isUpstream {
+		// set after the conversions, which are for the metas of the CARs.
+		response.Meta = nil
+	}
+	m, err := toMapAny(response)
+	if err != nil {
+		return nil, err
+	}
+	result := MapToCamelCaseAny(m)
+	if mp, ok := result.(map[string]any); ok {
+		result = response.withMetaResponse(adaptTransactionMetaToExpectedOutput(mp))
+		if isUpstream {
+			mp["meta"] = upstreamMeta.Raw
+		}
+		if block.Source != "" {
+			mp["source"] = block.Source
+		}
+	}
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(result)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReplayConsumer struct {
+	name     string
+	from     uint64
+	failAt   uint64
+	slots    []uint64
+	finished bool
+	aborted  bool
+}
+
+func (c *fakeReplayConsumer) id() string       { return c.name }
+func (c *fakeReplayConsumer) fromSlot() uint64 { return c.from }
+
+func (c *fakeReplayConsumer) replayBlock(ctx context.Context, block *transcodeBlock) error {
+	if c.failAt != 0 && block.Slot >= c.failAt {
+		return errors.New("delivery failed")
+	}
+	c.slots = append(c.slots, block.Slot)
+	return nil
+}
+
+func (c *fakeReplayConsumer) finish(ctx context.Context) error {
+	c.finished = true
+	return nil
+}
+
+func (c *fakeReplayConsumer) abort() {
+	c.aborted = true
+}
+
+func TestReplayFanOut(t *testing.T) {
+	ctx := context.Background()
+	a := &fakeReplayConsumer{name: "a", from: 10}
+	b := &fakeReplayConsumer{name: "b", from: 12}
+	failing := &fakeReplayConsumer{name: "c", from: 10, failAt: 11}
+	fanOut := newReplayFanOut([]replayConsumer{a, b, failing})
+	require.Equal(t, uint64(10), fanOut.fromSlot())
+
+	for slot := uint64(10); slot <= 13; slot++ {
+		require.NoError(t, fanOut.replayBlock(ctx, &transcodeBlock{Slot: slot}))
+	}
+	err := fanOut.finish(ctx, nil)
+	require.ErrorContains(t, err, `consumer "c"`)
+
+	// each consumer gets the blocks from its own first slot; the failed one is stopped.
+	require.Equal(t, []uint64{10, 11, 12, 13}, a.slots)
+	require.Equal(t, []uint64{12, 13}, b.slots)
+	require.Equal(t, []uint64{10}, failing.slots)
+	require.True(t, a.finished)
+	require.True(t, b.finished)
+	require.False(t, failing.finished)
+	require.True(t, failing.aborted)
+}
+
+func TestReplayFanOutAllFailed(t *testing.T) {
+	ctx := context.Background()
+	a := &fakeReplayConsumer{name: "a", from: 10, failAt: 10}
+	fanOut := newReplayFanOut([]replayConsumer{a})
+	require.Error(t, fanOut.replayBlock(ctx, &transcodeBlock{Slot: 10}))
+	require.True(t, a.aborted)
+
+	// an error of the replay itself stops the consumers.
+	b := &fakeReplayConsumer{name: "b", from: 10}
+	fanOut = newReplayFanOut([]replayConsumer{b})
+	require.NoError(t, fanOut.replayBlock(ctx, &transcodeBlock{Slot: 10}))
+	require.ErrorIs(t, fanOut.finish(ctx, context.Canceled), context.Canceled)
+	require.True(t, b.aborted)
+	require.False(t, b.finished)
+}
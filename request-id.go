@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+// maxRequestIDLength is the max length of a request ID accepted from a client.
+const maxRequestIDLength = 128
+
+func randomRequestID() string {
+	id := uuid.New().String()
+	return id
+}
+
+// requestIDFromRequest returns the request ID provided by the client in the X-Request-ID header
+// (e.g. by an upstream service, so that its logs can be correlated with ours),
+// or a new random one if the header is missing or invalid.
+func requestIDFromRequest(reqCtx *fasthttp.RequestCtx) string {
+	id := reqCtx.Request.Header.Peek("X-Request-ID")
+	if isValidRequestID(id) {
+		return string(id)
+	}
+	return randomRequestID()
+}
+
+// isValidRequestID returns true if the ID is safe to be echoed back and written to the logs.
+func isValidRequestID(id []byte) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
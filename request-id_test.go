@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestIDFromRequest(t *testing.T) {
+	withHeader := func(value string) *fasthttp.RequestCtx {
+		reqCtx := &fasthttp.RequestCtx{}
+		if value != "" {
+			reqCtx.Request.Header.Set("X-Request-ID", value)
+		}
+		return reqCtx
+	}
+	require.Equal(t, "gateway-1234:abc", requestIDFromRequest(withHeader("gateway-1234:abc")))
+
+	for _, invalid := range []string{"", "has space", "new\nline", "<script>", strings.Repeat("a", maxRequestIDLength+1)} {
+		id := requestIDFromRequest(withHeader(invalid))
+		require.NotEqual(t, invalid, id)
+		require.Len(t, id, 36, "expected a generated UUID for %q", invalid)
+	}
+}
+
+func TestRequestIDThroughHandler(t *testing.T) {
+	handler := newMultiEpochHandler(NewMultiEpoch(&Options{}), nil)
+	reqID := strings.Repeat("a", maxRequestIDLength)
+	var req fasthttp.Request
+	req.Header.SetMethod("GET")
+	req.SetRequestURI("/")
+	req.Header.Set("X-Request-ID", reqID)
+	reqCtx := &fasthttp.RequestCtx{}
+	reqCtx.Init(&req, nil, nil)
+	// the trace ID is observed as an exemplar, which must not exceed the limit of its labels.
+	require.NotPanics(t, func() { handler(reqCtx) })
+	require.Equal(t, reqID, string(reqCtx.Response.Header.Peek("X-Request-ID")))
+	traceID := string(reqCtx.Response.Header.Peek("X-Trace-ID"))
+	require.True(t, isValidTraceID(traceID), traceID)
+}
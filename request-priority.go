@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// requestPriority is the priority class of a request: it decides how the request's DAG fetches
+// are scheduled on the shared worker pool, and low priority requests are the first to be shed.
+type requestPriority int
+
+const (
+	priorityLow requestPriority = iota
+	priorityNormal
+	priorityHigh
+
+	numPriorities = 3
+)
+
+// defaultPriorityWeights are the shares of the workers that each class gets when all are busy.
+var defaultPriorityWeights = [numPriorities]int{
+	priorityLow:    1,
+	priorityNormal: 4,
+	priorityHigh:   16,
+}
+
+func (p requestPriority) String() string {
+	switch p {
+	case priorityLow:
+		return "low"
+	case priorityNormal:
+		return "normal"
+	case priorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+}
+
+func parseRequestPriority(s string) (requestPriority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low", "bulk":
+		return priorityLow, nil
+	case "normal":
+		return priorityNormal, nil
+	case "high", "interactive":
+		return priorityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q (supported: low, normal, high)", s)
+	}
+}
+
+// methodPriority returns the default priority of the given method: the methods that read a lot of data
+// (whole blocks, many transactions; see MethodCostHeavy) are low priority.
+func methodPriority(method string) requestPriority {
+	if method == "GET "+restPathBlock {
+		return priorityLow
+	}
+	if spec, ok := lookupMethod(method); ok && spec.Cost == MethodCostHeavy {
+		return priorityLow
+	}
+	return priorityNormal
+}
+
+// PriorityConfig assigns priority classes to methods and to clients, e.g.:
+//
+//	weights:
+//	  high: 16
+//	  normal: 4
+//	  low: 1
+//	methods:
+//	  getTransaction: high
+//	  getBlock: low
+//	tokens:
+//	  # the fingerprint of the client's credentials, as written in the audit log.
+//	  "sha256:0123456789abcdef": low
+type PriorityConfig struct {
+	Weights map[string]int    `json:"weights" yaml:"weights"`
+	Methods map[string]string `json:"methods" yaml:"methods"`
+	Tokens  map[string]string `json:"tokens" yaml:"tokens"`
+
+	weights [numPriorities]int
+	methods map[string]requestPriority
+	tokens  map[string]requestPriority
+}
+
+func LoadPriorityConfig(configFilepath string) (*PriorityConfig, error) {
+	var conf PriorityConfig
+	if isJSONFile(configFilepath) {
+		if err := loadFromJSON(configFilepath, &conf); err != nil {
+			return nil, err
+		}
+	} else if isYAMLFile(configFilepath) {
+		if err := loadFromYAML(configFilepath, &conf); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("config file %q must be JSON or YAML", configFilepath)
+	}
+	if err := conf.init(); err != nil {
+		return nil, fmt.Errorf("invalid priority config %q: %w", configFilepath, err)
+	}
+	return &conf, nil
+}
+
+func (c *PriorityConfig) init() error {
+	c.weights = defaultPriorityWeights
+	for name, weight := range c.Weights {
+		priority, err := parseRequestPriority(name)
+		if err != nil {
+			return err
+		}
+		if weight <= 0 {
+			return fmt.Errorf("weight of %q must be positive", name)
+		}
+		c.weights[priority] = weight
+	}
+	c.methods = make(map[string]requestPriority, len(c.Methods))
+	for method, name := range c.Methods {
+		priority, err := parseRequestPriority(name)
+		if err != nil {
+			return fmt.Errorf("method %q: %w", method, err)
+		}
+		c.methods[method] = priority
+	}
+	c.tokens = make(map[string]requestPriority, len(c.Tokens))
+	for token, name := range c.Tokens {
+		priority, err := parseRequestPriority(name)
+		if err != nil {
+			return fmt.Errorf("token %q: %w", token, err)
+		}
+		c.tokens[token] = priority
+	}
+	return nil
+}
+
+// PoolWeights returns the weights of the priority classes.
+func (c *PriorityConfig) PoolWeights() [numPriorities]int {
+	return c.weights
+}
+
+// priorityOf returns the priority of a request: the one of the client (if configured),
+// or else the one of the method.
+func (c *PriorityConfig) priorityOf(reqCtx *fasthttp.RequestCtx, method string) requestPriority {
+	if c != nil {
+		if len(c.tokens) > 0 {
+			if priority, ok := c.tokens[tokenFingerprint(reqCtx)]; ok {
+				return priority
+			}
+		}
+		if priority, ok := c.methods[method]; ok {
+			return priority
+		}
+	}
+	return methodPriority(method)
+}
+
+const requestPriorityKey = MyContextKey("requestPriority")
+
+func setRequestPriorityToContext(ctx context.Context, priority requestPriority) context.Context {
+	return context.WithValue(ctx, requestPriorityKey, priority)
+}
+
+func getRequestPriorityFromContext(ctx context.Context) requestPriority {
+	priority, ok := ctx.Value(requestPriorityKey).(requestPriority)
+	if !ok {
+		return priorityNormal
+	}
+	return priority
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestPriority(t *testing.T) {
+	for s, expected := range map[string]requestPriority{
+		"low":         priorityLow,
+		"bulk":        priorityLow,
+		"Normal":      priorityNormal,
+		"high":        priorityHigh,
+		"interactive": priorityHigh,
+	} {
+		priority, err := parseRequestPriority(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expected, priority, s)
+	}
+	_, err := parseRequestPriority("urgent")
+	require.Error(t, err)
+}
+
+func TestLoadPriorityConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "priorities.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+weights:
+  high: 10
+methods:
+  getTransaction: high
+  getBlock: bulk
+tokens:
+  "sha256:0123456789abcdef": low
+`), 0o644))
+	conf, err := LoadPriorityConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, [numPriorities]int{priorityLow: 1, priorityNormal: 4, priorityHigh: 10}, conf.PoolWeights())
+	require.Equal(t, priorityHigh, conf.methods["getTransaction"])
+	require.Equal(t, priorityLow, conf.methods["getBlock"])
+	require.Equal(t, priorityLow, conf.tokens["sha256:0123456789abcdef"])
+
+	require.NoError(t, os.WriteFile(path, []byte("methods:\n  getBlock: urgent\n"), 0o644))
+	_, err = LoadPriorityConfig(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("weights:\n  low: 0\n"), 0o644))
+	_, err = LoadPriorityConfig(path)
+	require.Error(t, err)
+}
+
+func TestPriorityOf(t *testing.T) {
+	var conf *PriorityConfig
+	require.Equal(t, priorityLow, conf.priorityOf(nil, "getBlock"))
+	require.Equal(t, priorityNormal, conf.priorityOf(nil, "getTransaction"))
+
+	conf = &PriorityConfig{Methods: map[string]string{"getTransaction": "high"}}
+	require.NoError(t, conf.init())
+	require.Equal(t, priorityHigh, conf.priorityOf(nil, "getTransaction"))
+	require.Equal(t, priorityLow, conf.priorityOf(nil, "getBlock"))
+}
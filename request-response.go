@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	bin "github.com/gagliardetto/binary"
 	"github.com/gagliardetto/solana-go"
@@ -14,7 +16,6 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/mostynb/zstdpool-freelist"
 	"github.com/mr-tron/base58"
-	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
 	"github.com/rpcpool/yellowstone-faithful/txstatus"
 	"github.com/sourcegraph/jsonrpc2"
 	"github.com/valyala/fasthttp"
@@ -22,6 +23,12 @@ import (
 
 type requestContext struct {
 	ctx *fasthttp.RequestCtx
+	// result is the rendered result of the last successful reply (if any).
+	result json.RawMessage
+	// largeIntsAsStrings makes the replies return the integers above 2^53-1 as strings.
+	largeIntsAsStrings bool
+	// apiVersion is the API version of the request (see ApiVersion).
+	apiVersion ApiVersion
 }
 
 // ReplyWithError(ctx context.Context, id ID, respErr *Error) error {
@@ -34,13 +41,15 @@ func (c *requestContext) ReplyWithError(ctx context.Context, id jsonrpc2.ID, res
 	return nil
 }
 
+// toMapAny converts the value to its JSON object; the numbers are json.Number, to keep
+// the u64 values exact.
 func toMapAny(v any) (map[string]any, error) {
-	b, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(v)
+	b, err := preciseJson.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
 	var m map[string]any
-	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(b, &m); err != nil {
+	if err := preciseJson.Unmarshal(b, &m); err != nil {
 		return nil, err
 	}
 	return m, nil
@@ -85,12 +94,15 @@ func toLowerCamelCase(v string) string {
 // Reply sends a response to the client with the given result.
 // The result fields keys are converted to camelCase.
 // If remapCallback is not nil, it is called with the result map[string]interface{}.
+// If the request collects debug timings (see withDebugTiming), they are added to the result.
+// The integers are exact; they are strings above 2^53-1 if the request wants them so.
 func (c *requestContext) Reply(
 	ctx context.Context,
 	id jsonrpc2.ID,
 	result interface{},
 	remapCallback func(map[string]any) map[string]any,
 ) error {
+	startedEncodingAt := time.Now()
 	mm, err := toMapAny(result)
 	if err != nil {
 		return err
@@ -101,11 +113,25 @@ func (c *requestContext) Reply(
 			result = remapCallback(mp)
 		}
 	}
-	resRaw, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(result)
+	resRaw, err := preciseJson.Marshal(result)
 	if err != nil {
 		return err
 	}
+	if dt := getDebugTimingFromContext(ctx); dt != nil {
+		observeDebugTiming(ctx, debugPhaseEncode, startedEncodingAt)
+		resRaw, err = appendDebugTiming(resRaw, dt)
+		if err != nil {
+			return err
+		}
+	}
+	if c.largeIntsAsStrings {
+		resRaw, err = encodeLargeIntsAsStrings(resRaw)
+		if err != nil {
+			return err
+		}
+	}
 	raw := json.RawMessage(resRaw)
+	c.result = raw
 	resp := &jsonrpc2.Response{
 		ID:     id,
 		Result: &raw,
@@ -114,17 +140,25 @@ func (c *requestContext) Reply(
 	return err
 }
 
-// ReplyRaw sends a raw response without any processing (no camelCase conversion, etc).
+// ReplyRaw sends a raw response without any processing (no camelCase conversion, etc),
+// except for the large integers as strings if the request wants them.
 func (c *requestContext) ReplyRaw(
 	ctx context.Context,
 	id jsonrpc2.ID,
 	result interface{},
 ) error {
-	resRaw, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(result)
+	resRaw, err := preciseJson.Marshal(result)
 	if err != nil {
 		return err
 	}
+	if c.largeIntsAsStrings && result != nil {
+		resRaw, err = encodeLargeIntsAsStrings(resRaw)
+		if err != nil {
+			return err
+		}
+	}
 	raw := json.RawMessage(resRaw)
+	c.result = raw
 	resp := &jsonrpc2.Response{
 		ID:     id,
 		Result: &raw,
@@ -155,6 +189,7 @@ type GetBlockRequest struct {
 		MaxSupportedTransactionVersion *uint64              `json:"maxSupportedTransactionVersion,omitempty"`
 		TransactionDetails             *string              `json:"transactionDetails,omitempty"` // default: "full"
 		Rewards                        *bool                `json:"rewards,omitempty"`
+		WithDebugTiming                bool                 `json:"withDebugTiming,omitempty"` // extension: include the timings of the phases in the response
 	} `json:"options,omitempty"`
 }
 
@@ -170,7 +205,10 @@ func (req *GetBlockRequest) Validate() error {
 	) {
 		return fmt.Errorf("unsupported encoding")
 	}
-	return nil
+	if req.Options.TransactionDetails != nil && !isValidTransactionDetails(*req.Options.TransactionDetails) {
+		return fmt.Errorf("unsupported transactionDetails %q (supported: full, accounts, signatures, none)", *req.Options.TransactionDetails)
+	}
+	return checkIsAtLeastConfirmed(req.Options.Commitment)
 }
 
 func parseGetBlockRequest(raw *json.RawMessage) (*GetBlockRequest, error) {
@@ -196,11 +234,10 @@ func parseGetBlockRequest(raw *json.RawMessage) (*GetBlockRequest, error) {
 			return nil, fmt.Errorf("second argument must be an object, got %T", params[1])
 		}
 		if commitmentRaw, ok := optionsRaw["commitment"]; ok {
-			commitment, ok := commitmentRaw.(string)
-			if !ok {
-				return nil, fmt.Errorf("commitment must be a string, got %T", commitmentRaw)
+			commitmentType, err := parseCommitment(commitmentRaw)
+			if err != nil {
+				return nil, err
 			}
-			commitmentType := rpc.CommitmentType(commitment)
 			out.Options.Commitment = &commitmentType
 		} else {
 			commitmentType := defaultCommitment()
@@ -227,7 +264,6 @@ func parseGetBlockRequest(raw *json.RawMessage) (*GetBlockRequest, error) {
 			out.Options.MaxSupportedTransactionVersion = &maxSupportedTransactionVersionUint64
 		}
 		if transactionDetailsRaw, ok := optionsRaw["transactionDetails"]; ok {
-			// TODO: add support for this, and validate the value.
 			transactionDetails, ok := transactionDetailsRaw.(string)
 			if !ok {
 				return nil, fmt.Errorf("transactionDetails must be a string, got %T", transactionDetailsRaw)
@@ -247,6 +283,13 @@ func parseGetBlockRequest(raw *json.RawMessage) (*GetBlockRequest, error) {
 			rewards := true
 			out.Options.Rewards = &rewards
 		}
+		if withDebugTimingRaw, ok := optionsRaw["withDebugTiming"]; ok {
+			withDebugTiming, ok := withDebugTimingRaw.(bool)
+			if !ok {
+				return nil, fmt.Errorf("withDebugTiming must be a boolean, got %T", withDebugTimingRaw)
+			}
+			out.Options.WithDebugTiming = withDebugTiming
+		}
 	} else {
 		// set defaults:
 		commitmentType := defaultCommitment()
@@ -271,16 +314,22 @@ func defaultEncoding() solana.EncodingType {
 }
 
 func defaultTransactionDetails() string {
-	return "full"
+	return transactionDetailsFull
 }
 
 type GetTransactionRequest struct {
-	Signature solana.Signature `json:"signature"`
-	Options   struct {
-		Encoding                       *solana.EncodingType `json:"encoding,omitempty"` // default: "json"
-		MaxSupportedTransactionVersion *uint64              `json:"maxSupportedTransactionVersion,omitempty"`
-		Commitment                     *rpc.CommitmentType  `json:"commitment,omitempty"`
-	} `json:"options,omitempty"`
+	Signature solana.Signature      `json:"signature"`
+	Options   GetTransactionOptions `json:"options,omitempty"`
+}
+
+type GetTransactionOptions struct {
+	Encoding                       *solana.EncodingType `json:"encoding,omitempty"` // default: "json"
+	MaxSupportedTransactionVersion *uint64              `json:"maxSupportedTransactionVersion,omitempty"`
+	Commitment                     *rpc.CommitmentType  `json:"commitment,omitempty"`
+	// MinSlot and MaxSlot (faithful extension) restrict the search of the transaction to the epochs
+	// that contain these slots; the transaction is not found if it's outside of them.
+	MinSlot *uint64 `json:"minSlot,omitempty"`
+	MaxSlot *uint64 `json:"maxSlot,omitempty"`
 }
 
 // Validate validates the request.
@@ -288,8 +337,13 @@ func (req *GetTransactionRequest) Validate() error {
 	if req.Signature.IsZero() {
 		return fmt.Errorf("signature is required")
 	}
-	if req.Options.Encoding != nil && !isAnyEncodingOf(
-		*req.Options.Encoding,
+	return req.Options.Validate()
+}
+
+// Validate validates the options.
+func (opts *GetTransactionOptions) Validate() error {
+	if opts.Encoding != nil && !isAnyEncodingOf(
+		*opts.Encoding,
 		solana.EncodingBase58,
 		solana.EncodingBase64,
 		solana.EncodingBase64Zstd,
@@ -298,7 +352,21 @@ func (req *GetTransactionRequest) Validate() error {
 	) {
 		return fmt.Errorf("unsupported encoding")
 	}
-	return nil
+	if opts.MinSlot != nil && opts.MaxSlot != nil && *opts.MinSlot > *opts.MaxSlot {
+		return fmt.Errorf("minSlot must be less than or equal to maxSlot")
+	}
+	return checkIsAtLeastConfirmed(opts.Commitment)
+}
+
+// searchHint returns the hint for the search of the epochs, or nil if there's none.
+func (opts *GetTransactionOptions) searchHint() *epochSearchHint {
+	if opts.MinSlot == nil && opts.MaxSlot == nil {
+		return nil
+	}
+	return &epochSearchHint{
+		MinSlot: opts.MinSlot,
+		MaxSlot: opts.MaxSlot,
+	}
 }
 
 func isAnyEncodingOf(s solana.EncodingType, anyOf ...solana.EncodingType) bool {
@@ -333,49 +401,116 @@ func parseGetTransactionRequest(raw *json.RawMessage) (*GetTransactionRequest, e
 	}
 
 	if len(params) > 1 {
-		optionsRaw, ok := params[1].(map[string]any)
+		out.Options, err = parseGetTransactionOptions(params[1])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		out.Options, _ = parseGetTransactionOptions(nil)
+	}
+
+	return out, nil
+}
+
+// parseGetTransactionOptions parses the options object of getTransaction (and similar methods);
+// if optionsParam is nil, the defaults are returned.
+func parseGetTransactionOptions(optionsParam any) (GetTransactionOptions, error) {
+	var out GetTransactionOptions
+	if optionsParam == nil {
+		// set defaults:
+		encodingType := defaultEncoding()
+		out.Encoding = &encodingType
+		return out, nil
+	}
+	optionsRaw, ok := optionsParam.(map[string]any)
+	if !ok {
+		return out, fmt.Errorf("second argument must be an object, got %T", optionsParam)
+	}
+	if encodingRaw, ok := optionsRaw["encoding"]; ok {
+		encoding, ok := encodingRaw.(string)
 		if !ok {
-			return nil, fmt.Errorf("second argument must be an object, got %T", params[1])
+			return out, fmt.Errorf("encoding must be a string, got %T", encodingRaw)
 		}
-		if encodingRaw, ok := optionsRaw["encoding"]; ok {
-			encoding, ok := encodingRaw.(string)
-			if !ok {
-				return nil, fmt.Errorf("encoding must be a string, got %T", encodingRaw)
-			}
-			encodingType := solana.EncodingType(encoding)
-			out.Options.Encoding = &encodingType
-		} else {
-			encodingType := defaultEncoding()
-			out.Options.Encoding = &encodingType
+		encodingType := solana.EncodingType(encoding)
+		out.Encoding = &encodingType
+	} else {
+		encodingType := defaultEncoding()
+		out.Encoding = &encodingType
+	}
+	if maxSupportedTransactionVersionRaw, ok := optionsRaw["maxSupportedTransactionVersion"]; ok {
+		// TODO: add support for this, and validate the value.
+		maxSupportedTransactionVersion, ok := maxSupportedTransactionVersionRaw.(float64)
+		if !ok {
+			return out, fmt.Errorf("maxSupportedTransactionVersion must be a number, got %T", maxSupportedTransactionVersionRaw)
 		}
-		if maxSupportedTransactionVersionRaw, ok := optionsRaw["maxSupportedTransactionVersion"]; ok {
-			// TODO: add support for this, and validate the value.
-			maxSupportedTransactionVersion, ok := maxSupportedTransactionVersionRaw.(float64)
-			if !ok {
-				return nil, fmt.Errorf("maxSupportedTransactionVersion must be a number, got %T", maxSupportedTransactionVersionRaw)
-			}
-			maxSupportedTransactionVersionUint64 := uint64(maxSupportedTransactionVersion)
-			out.Options.MaxSupportedTransactionVersion = &maxSupportedTransactionVersionUint64
+		maxSupportedTransactionVersionUint64 := uint64(maxSupportedTransactionVersion)
+		out.MaxSupportedTransactionVersion = &maxSupportedTransactionVersionUint64
+	}
+	if commitmentRaw, ok := optionsRaw["commitment"]; ok {
+		commitmentType, err := parseCommitment(commitmentRaw)
+		if err != nil {
+			return out, err
 		}
-		if commitmentRaw, ok := optionsRaw["commitment"]; ok {
-			commitment, ok := commitmentRaw.(string)
-			if !ok {
-				return nil, fmt.Errorf("commitment must be a string, got %T", commitmentRaw)
-			}
-			commitmentType := rpc.CommitmentType(commitment)
-			out.Options.Commitment = &commitmentType
+		out.Commitment = &commitmentType
+	}
+	if minSlotRaw, ok := optionsRaw["minSlot"]; ok {
+		minSlot, ok := minSlotRaw.(float64)
+		if !ok || minSlot < 0 {
+			return out, fmt.Errorf("minSlot must be a non-negative number, got %v", minSlotRaw)
 		}
-	} else {
-		// set defaults:
-		encodingType := defaultEncoding()
-		out.Options.Encoding = &encodingType
+		minSlotUint64 := uint64(minSlot)
+		out.MinSlot = &minSlotUint64
+	}
+	if maxSlotRaw, ok := optionsRaw["maxSlot"]; ok {
+		maxSlot, ok := maxSlotRaw.(float64)
+		if !ok || maxSlot < 0 {
+			return out, fmt.Errorf("maxSlot must be a non-negative number, got %v", maxSlotRaw)
+		}
+		maxSlotUint64 := uint64(maxSlot)
+		out.MaxSlot = &maxSlotUint64
 	}
-
 	return out, nil
 }
 
 var zstdEncoderPool = zstdpool.NewEncoderPool()
 
+const (
+	// maxBase58TransactionSize is the max size of a transaction that can be encoded as base58 (PACKET_DATA_SIZE in solana).
+	maxBase58TransactionSize = 1232
+	// maxBase58EncodedTransactionSize is the max size of the base58 encoding of a transaction (MAX_BASE58_SIZE in solana).
+	maxBase58EncodedTransactionSize = 1683
+)
+
+// errBase58TooLarge is returned when a transaction is too large to be encoded as base58;
+// base64 must be used instead.
+var errBase58TooLarge = errors.New("base58 encoded transaction too large")
+
+// isBinaryEncoding returns true if the transactions are returned in their wire format with the given encoding.
+func isBinaryEncoding(encoding solana.EncodingType) bool {
+	return isAnyEncodingOf(encoding, solana.EncodingBase58, solana.EncodingBase64, solana.EncodingBase64Zstd)
+}
+
+// encodeRawTransactionBasedOnWantedEncoding encodes the transaction in its wire format with the given binary encoding.
+func encodeRawTransactionBasedOnWantedEncoding(encoding solana.EncodingType, txBuf []byte) ([]any, error) {
+	encoded, err := encodeBytesResponseBasedOnWantedEncoding(encoding, txBuf)
+	if err != nil {
+		return nil, err
+	}
+	if encoding != solana.EncodingBase58 {
+		return encoded, nil
+	}
+	if encodedSize := len(encoded[0].(string)); len(txBuf) > maxBase58TransactionSize || encodedSize > maxBase58EncodedTransactionSize {
+		return nil, fmt.Errorf(
+			"%w: %d bytes (max: encoded/raw %d/%d)",
+			errBase58TooLarge,
+			encodedSize,
+			maxBase58EncodedTransactionSize,
+			maxBase58TransactionSize,
+		)
+	}
+	return encoded, nil
+}
+
 func encodeTransactionResponseBasedOnWantedEncoding(
 	encoding solana.EncodingType,
 	tx solana.Transaction,
@@ -387,12 +522,24 @@ func encodeTransactionResponseBasedOnWantedEncoding(
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal transaction: %w", err)
 		}
-		return encodeBytesResponseBasedOnWantedEncoding(encoding, txBuf)
+		return encodeRawTransactionBasedOnWantedEncoding(encoding, txBuf)
 	case solana.EncodingJSONParsed:
 		if !txstatus.IsEnabled() {
 			return nil, fmt.Errorf("unsupported encoding")
 		}
 
+		// the instructions of a versioned transaction index the static keys, followed by
+		// the addresses loaded from the lookup tables (in the meta).
+		var loaded *txstatus.LoadedAddresses
+		writable, readonly := loadedAddressesFromMeta(meta)
+		if tx.Message.IsVersioned() || len(writable) > 0 || len(readonly) > 0 {
+			loaded = &txstatus.LoadedAddresses{
+				Writable: writable,
+				Readonly: readonly,
+			}
+		}
+		allKeys := allAccountKeys(tx.Message.AccountKeys, writable, readonly)
+
 		parsedInstructions := make([]json.RawMessage, 0)
 
 		for _, inst := range tx.Message.Instructions {
@@ -411,31 +558,8 @@ func encodeTransactionResponseBasedOnWantedEncoding(
 					Data: inst.Data,
 				},
 				AccountKeys: txstatus.AccountKeys{
-					StaticKeys: tx.Message.AccountKeys,
-					// TODO: test this:
-					DynamicKeys: func() *txstatus.LoadedAddresses {
-						switch v := meta.(type) {
-						case *confirmed_block.TransactionStatusMeta:
-							return &txstatus.LoadedAddresses{
-								Writable: func() []solana.PublicKey {
-									out := make([]solana.PublicKey, len(v.LoadedWritableAddresses))
-									for i, v := range v.LoadedWritableAddresses {
-										out[i] = solana.PublicKeyFromBytes(v)
-									}
-									return out
-								}(),
-								Readonly: func() []solana.PublicKey {
-									out := make([]solana.PublicKey, len(v.LoadedReadonlyAddresses))
-									for i, v := range v.LoadedReadonlyAddresses {
-										out[i] = solana.PublicKeyFromBytes(v)
-									}
-									return out
-								}(),
-							}
-						default:
-							return nil
-						}
-					}(),
+					StaticKeys:  tx.Message.AccountKeys,
+					DynamicKeys: loaded,
 				},
 				StackHeight: nil,
 			}
@@ -443,26 +567,7 @@ func encodeTransactionResponseBasedOnWantedEncoding(
 			parsedInstructionJSON, err := instrParams.ParseInstruction()
 			if err != nil || parsedInstructionJSON == nil || !strings.HasPrefix(strings.TrimSpace(string(parsedInstructionJSON)), "{") {
 				nonParseadInstructionJSON := map[string]any{
-					"accounts": func() []string {
-						out := make([]string, len(inst.Accounts))
-						for i, v := range inst.Accounts {
-							if v >= uint16(len(tx.Message.AccountKeys)) {
-								continue
-							}
-							out[i] = tx.Message.AccountKeys[v].String()
-						}
-						// TODO: validate that the order is correct
-						switch v := meta.(type) {
-						case *confirmed_block.TransactionStatusMeta:
-							for _, wr := range v.LoadedWritableAddresses {
-								out = append(out, solana.PublicKeyFromBytes(wr).String())
-							}
-							for _, ro := range v.LoadedReadonlyAddresses {
-								out = append(out, solana.PublicKeyFromBytes(ro).String())
-							}
-						}
-						return out
-					}(),
+					"accounts":    instructionAccountKeys(allKeys, inst.Accounts),
 					"data":        base58.Encode(inst.Data),
 					"programId":   programId.String(),
 					"stackHeight": nil,
@@ -474,7 +579,7 @@ func encodeTransactionResponseBasedOnWantedEncoding(
 			}
 		}
 
-		resp, err := txstatus.FromTransaction(tx)
+		resp, err := txstatus.FromTransactionWithLoadedAddresses(tx, loaded)
 		if err != nil {
 			return nil, fmt.Errorf("failed to convert transaction to txstatus.Transaction: %w", err)
 		}
@@ -488,6 +593,27 @@ func encodeTransactionResponseBasedOnWantedEncoding(
 	}
 }
 
+// allAccountKeys returns the account keys that the instructions of the transaction index:
+// the static keys, then the loaded writable and readonly addresses.
+func allAccountKeys(static, writable, readonly []solana.PublicKey) []solana.PublicKey {
+	out := make([]solana.PublicKey, 0, len(static)+len(writable)+len(readonly))
+	out = append(out, static...)
+	out = append(out, writable...)
+	return append(out, readonly...)
+}
+
+// instructionAccountKeys returns the keys of the accounts of an instruction;
+// an index out of the keys (an invalid transaction) is an empty string.
+func instructionAccountKeys(keys []solana.PublicKey, indexes []uint16) []string {
+	out := make([]string, len(indexes))
+	for i, index := range indexes {
+		if int(index) < len(keys) {
+			out[i] = keys[index].String()
+		}
+	}
+	return out
+}
+
 func encodeBytesResponseBasedOnWantedEncoding(
 	encoding solana.EncodingType,
 	buf []byte,
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/mr-tron/base58"
+	"github.com/rpcpool/yellowstone-faithful/txstatus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeTransactionBase58(t *testing.T) {
+	newTx := func(dataSize int) solana.Transaction {
+		return solana.Transaction{
+			Signatures: []solana.Signature{{1}},
+			Message: solana.Message{
+				Header: solana.MessageHeader{
+					NumRequiredSignatures: 1,
+				},
+				AccountKeys: []solana.PublicKey{solana.SystemProgramID},
+				Instructions: []solana.CompiledInstruction{
+					{ProgramIDIndex: 0, Data: make([]byte, dataSize)},
+				},
+			},
+		}
+	}
+
+	tx := newTx(100)
+	encoded, err := encodeTransactionResponseBasedOnWantedEncoding(solana.EncodingBase58, tx, nil)
+	require.NoError(t, err)
+	raw, err := tx.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, []any{base58.Encode(raw), solana.EncodingBase58}, encoded)
+
+	_, err = encodeTransactionResponseBasedOnWantedEncoding(solana.EncodingBase58, newTx(maxBase58TransactionSize), nil)
+	require.ErrorIs(t, err, errBase58TooLarge)
+
+	// no limit for base64.
+	_, err = encodeTransactionResponseBasedOnWantedEncoding(solana.EncodingBase64, newTx(maxBase58TransactionSize), nil)
+	require.NoError(t, err)
+}
+
+func TestRawTransactionFastPath(t *testing.T) {
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1}, {2}},
+		Message: solana.Message{
+			Header: solana.MessageHeader{
+				NumRequiredSignatures: 2,
+			},
+			AccountKeys: []solana.PublicKey{{3}, {4}, solana.SystemProgramID},
+			Instructions: []solana.CompiledInstruction{
+				{ProgramIDIndex: 2, Accounts: []uint16{0, 1}, Data: []byte{1, 2, 3}},
+			},
+		},
+	}
+	raw, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	sig, version, err := parseRawTransactionHeader(raw)
+	require.NoError(t, err)
+	require.Equal(t, solana.Signature{1}, sig)
+	require.Equal(t, "legacy", version)
+
+	for _, encoding := range []solana.EncodingType{solana.EncodingBase58, solana.EncodingBase64, solana.EncodingBase64Zstd} {
+		want, err := encodeTransactionResponseBasedOnWantedEncoding(encoding, tx, nil)
+		require.NoError(t, err)
+		got, err := encodeRawTransactionBasedOnWantedEncoding(encoding, raw)
+		require.NoError(t, err)
+		require.Equal(t, want, got, encoding)
+	}
+
+	// a v0 message starts with 0x80.
+	versioned := append([]byte{1}, make([]byte, solana.SignatureLength)...)
+	versioned = append(versioned, 0x80, 1, 0, 0)
+	_, version, err = parseRawTransactionHeader(versioned)
+	require.NoError(t, err)
+	require.Equal(t, 0, version)
+
+	_, _, err = parseRawTransactionHeader([]byte{0})
+	require.Error(t, err)
+	_, _, err = parseRawTransactionHeader(versioned[:10])
+	require.Error(t, err)
+}
+
+func TestDecodeCompactU16(t *testing.T) {
+	for _, tc := range []struct {
+		buf   []byte
+		value int
+		size  int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f}, 0x7f, 1},
+		{[]byte{0x80, 0x01}, 0x80, 2},
+		{[]byte{0xff, 0xff, 0x03}, 0xffff, 3},
+	} {
+		value, size, err := decodeCompactU16(tc.buf)
+		require.NoError(t, err)
+		require.Equal(t, tc.value, value)
+		require.Equal(t, tc.size, size)
+	}
+	_, _, err := decodeCompactU16([]byte{0x80})
+	require.Error(t, err)
+	_, _, err = decodeCompactU16([]byte{0x80, 0x80, 0x80})
+	require.Error(t, err)
+}
+
+func TestParsedAccountKeysWithLookupTables(t *testing.T) {
+	payer, program, table := solana.PublicKey{1}, solana.PublicKey{2}, solana.PublicKey{3}
+	loadedWritable, loadedReadonly := solana.PublicKey{4}, solana.PublicKey{5}
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			Header: solana.MessageHeader{
+				NumRequiredSignatures:       1,
+				NumReadonlyUnsignedAccounts: 1,
+			},
+			AccountKeys: []solana.PublicKey{payer, program},
+			Instructions: []solana.CompiledInstruction{
+				// the payer, then the loaded accounts.
+				{ProgramIDIndex: 1, Accounts: []uint16{0, 2, 3}},
+			},
+			AddressTableLookups: []solana.MessageAddressTableLookup{
+				{AccountKey: table, WritableIndexes: []uint8{7}, ReadonlyIndexes: []uint8{9}},
+			},
+		},
+	}
+	loaded := &txstatus.LoadedAddresses{
+		Writable: []solana.PublicKey{loadedWritable},
+		Readonly: []solana.PublicKey{loadedReadonly},
+	}
+
+	allKeys := allAccountKeys(tx.Message.AccountKeys, loaded.Writable, loaded.Readonly)
+	require.Equal(t,
+		[]string{payer.String(), loadedWritable.String(), loadedReadonly.String()},
+		instructionAccountKeys(allKeys, tx.Message.Instructions[0].Accounts),
+	)
+	// an invalid index doesn't resolve.
+	require.Equal(t, []string{""}, instructionAccountKeys(allKeys, []uint16{4}))
+
+	resp, err := txstatus.FromTransactionWithLoadedAddresses(tx, loaded)
+	require.NoError(t, err)
+	require.Equal(t, []txstatus.AccountKey{
+		{Pubkey: payer.String(), Signer: true, Writable: true, Source: txstatus.SourceTransaction},
+		{Pubkey: program.String(), Source: txstatus.SourceTransaction},
+		{Pubkey: loadedWritable.String(), Writable: true, Source: txstatus.SourceLookupTable},
+		{Pubkey: loadedReadonly.String(), Source: txstatus.SourceLookupTable},
+	}, resp.Message.AccountKeys)
+	require.Equal(t, []txstatus.AddressTableLookup{
+		{AccountKey: table.String(), WritableIndexes: []int{7}, ReadonlyIndexes: []int{9}},
+	}, resp.Message.AddressTableLookups)
+
+	// without the loaded addresses, only the static keys.
+	resp, err = txstatus.FromTransaction(tx)
+	require.NoError(t, err)
+	require.Len(t, resp.Message.AccountKeys, 2)
+}
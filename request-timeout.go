@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// requestTimeoutHeader is the request header with which a client gives its time budget, in
+// milliseconds (e.g. "X-Timeout-Ms: 500"); it can only shorten the timeout of the server.
+const requestTimeoutHeader = "X-Timeout-Ms"
+
+// DefaultRequestTimeout is the timeout of the requests, unless configured otherwise.
+const DefaultRequestTimeout = 60 * time.Second
+
+// requestTimeout returns the timeout of the request: the one of its header if it's shorter than
+// the server timeout, else the server timeout; 0 means no timeout.
+func requestTimeout(reqCtx *fasthttp.RequestCtx, serverTimeout time.Duration) time.Duration {
+	value := strings.TrimSpace(string(reqCtx.Request.Header.Peek(requestTimeoutHeader)))
+	if value == "" {
+		return serverTimeout
+	}
+	ms, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || ms == 0 {
+		return serverTimeout
+	}
+	timeout := time.Duration(ms) * time.Millisecond
+	if serverTimeout > 0 && timeout > serverTimeout {
+		return serverTimeout
+	}
+	return timeout
+}
+
+// requestTimeout returns the timeout of the request.
+func (multi *MultiEpoch) requestTimeout(reqCtx *fasthttp.RequestCtx) time.Duration {
+	var serverTimeout time.Duration
+	if multi.options != nil {
+		serverTimeout = multi.options.RequestTimeout
+	}
+	return requestTimeout(reqCtx, serverTimeout)
+}
+
+// timedOut returns true if the deadline of the request is exceeded.
+func timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// timeoutAware returns the timeout error if the request failed because its deadline was
+// exceeded (whatever the handler made of the failed lookup), else the given errors.
+func timeoutAware(ctx context.Context, errorResp *jsonrpc2.Error, err error) (*jsonrpc2.Error, error) {
+	if errorResp == nil || errorResp.Code == CodeRequestTimeout || !timedOut(ctx) {
+		return errorResp, err
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return errRequestTimeout(err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	var reqCtx fasthttp.RequestCtx
+	require.Equal(t, DefaultRequestTimeout, requestTimeout(&reqCtx, DefaultRequestTimeout))
+	require.Equal(t, time.Duration(0), requestTimeout(&reqCtx, 0))
+
+	// the header can only shorten the server timeout.
+	reqCtx.Request.Header.Set(requestTimeoutHeader, "250")
+	require.Equal(t, 250*time.Millisecond, requestTimeout(&reqCtx, DefaultRequestTimeout))
+	require.Equal(t, 250*time.Millisecond, requestTimeout(&reqCtx, 0))
+	reqCtx.Request.Header.Set(requestTimeoutHeader, "120000")
+	require.Equal(t, DefaultRequestTimeout, requestTimeout(&reqCtx, DefaultRequestTimeout))
+
+	// an invalid one is ignored.
+	for _, value := range []string{"0", "-5", "1.5", "soon"} {
+		reqCtx.Request.Header.Set(requestTimeoutHeader, value)
+		require.Equal(t, DefaultRequestTimeout, requestTimeout(&reqCtx, DefaultRequestTimeout), value)
+	}
+}
+
+func TestTimeoutAware(t *testing.T) {
+	notFound, cause := errNodeNotFound("Node not found", errors.New("lookup failed"))
+
+	errorResp, err := timeoutAware(context.Background(), notFound, cause)
+	require.Equal(t, notFound, errorResp)
+	require.Equal(t, cause, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	errorResp, err = timeoutAware(ctx, notFound, cause)
+	require.Equal(t, int64(CodeRequestTimeout), errorResp.Code)
+	require.ErrorIs(t, err, cause)
+
+	// the successful requests are left as they are.
+	errorResp, err = timeoutAware(ctx, nil, nil)
+	require.Nil(t, errorResp)
+	require.NoError(t, err)
+}
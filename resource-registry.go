@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	carv2 "github.com/ipld/go-car/v2"
+	"k8s.io/klog/v2"
+)
+
+// sharedResources holds the CAR files and index files opened by the epochs; an epoch that is
+// reloaded (or another epoch pointing at the same files) reuses the open files instead of
+// opening them again.
+var sharedResources = newResourceRegistry()
+
+// resourceRegistry shares open resources by key, with reference counting: a resource is
+// opened by its first user, and closed when its last user releases it.
+type resourceRegistry struct {
+	mu        sync.Mutex
+	resources map[string]*sharedResource
+}
+
+type sharedResource struct {
+	key   string
+	refs  int
+	ready chan struct{} // closed once opened (or failed to open).
+	value io.Closer
+	err   error
+}
+
+func newResourceRegistry() *resourceRegistry {
+	return &resourceRegistry{
+		resources: make(map[string]*sharedResource),
+	}
+}
+
+// resourceRef is a reference to a shared resource, to be released once it's no longer used.
+type resourceRef struct {
+	registry *resourceRegistry
+	res      *sharedResource
+	once     sync.Once
+}
+
+// Value returns the shared resource.
+func (ref *resourceRef) Value() io.Closer {
+	return ref.res.value
+}
+
+// Release releases the reference, closing the resource if it was the last one; releasing
+// the same reference more than once is a no-op.
+func (ref *resourceRef) Release() error {
+	var err error
+	ref.once.Do(func() {
+		err = ref.registry.release(ref.res)
+	})
+	return err
+}
+
+// acquire returns a reference to the resource with the given key, opening it with open
+// if it's not already open; the concurrent acquirers of a resource being opened wait for it.
+func (r *resourceRegistry) acquire(key string, open func() (io.Closer, error)) (*resourceRef, error) {
+	r.mu.Lock()
+	res, ok := r.resources[key]
+	if ok {
+		res.refs++
+		r.mu.Unlock()
+		<-res.ready
+		if res.err != nil {
+			r.release(res)
+			return nil, res.err
+		}
+		return &resourceRef{registry: r, res: res}, nil
+	}
+	res = &sharedResource{
+		key:   key,
+		refs:  1,
+		ready: make(chan struct{}),
+	}
+	r.resources[key] = res
+	r.mu.Unlock()
+
+	res.value, res.err = open()
+	if res.err == nil && res.value == nil {
+		res.err = fmt.Errorf("opening %q returned nothing", key)
+	}
+	close(res.ready)
+	if res.err != nil {
+		r.release(res)
+		return nil, res.err
+	}
+	metrics_sharedResourcesOpen.Inc()
+	return &resourceRef{registry: r, res: res}, nil
+}
+
+func (r *resourceRegistry) release(res *sharedResource) error {
+	r.mu.Lock()
+	res.refs--
+	if res.refs > 0 {
+		r.mu.Unlock()
+		return nil
+	}
+	if r.resources[res.key] == res {
+		delete(r.resources, res.key)
+	}
+	r.mu.Unlock()
+	if res.err != nil {
+		return nil
+	}
+	metrics_sharedResourcesOpen.Dec()
+	klog.V(3).Infof("closing shared resource %s", res.key)
+	return res.value.Close()
+}
+
+// Refs returns the number of references to the resource with the given key (0 if it's not open).
+func (r *resourceRegistry) Refs(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if res, ok := r.resources[key]; ok {
+		return res.refs
+	}
+	return 0
+}
+
+// Len returns the number of open resources.
+func (r *resourceRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.resources)
+}
+
+// sharedResourceKey returns the registry key of the file at the given location; local files
+// are keyed by their size and modification time too, so that a replaced file (e.g. a rebuilt
+// index) is opened again instead of reusing the handle on the old one.
+func sharedResourceKey(kind string, where string, parts ...any) string {
+	key := kind + " " + where
+	for _, part := range parts {
+		key += fmt.Sprintf(" %v", part)
+	}
+	if stat, err := os.Stat(where); err == nil {
+		key += fmt.Sprintf(" (%d bytes, modified %d)", stat.Size(), stat.ModTime().UnixNano())
+	}
+	return key
+}
+
+// carStorage is the open CAR file of an epoch: either a local CARv2 reader, or a reader
+// at the offsets of the indexes (remote or decompressed).
+type carStorage struct {
+	local  *carv2.Reader
+	remote ReaderAtCloser
+}
+
+func (s *carStorage) Close() error {
+	if s.local != nil {
+		return s.local.Close()
+	}
+	if s.remote != nil {
+		return s.remote.Close()
+	}
+	return nil
+}
+
+// acquireCarStorage opens the CAR file at the given location, or reuses it if another epoch
+// already has it open; the returned reference must be released when the epoch is closed.
+func acquireCarStorage(ctx context.Context, where string) (*carStorage, *resourceRef, error) {
+	ref, err := sharedResources.acquire(sharedResourceKey("car", where), func() (io.Closer, error) {
+		local, remote, err := openCarStorage(ctx, where)
+		if err != nil {
+			return nil, err
+		}
+		return &carStorage{local: local, remote: remote}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return ref.Value().(*carStorage), ref, nil
+}
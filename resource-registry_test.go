@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type countingCloser struct {
+	closed atomic.Int32
+}
+
+func (c *countingCloser) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func TestResourceRegistry(t *testing.T) {
+	registry := newResourceRegistry()
+	var opened int
+	closer := &countingCloser{}
+	open := func() (io.Closer, error) {
+		opened++
+		return closer, nil
+	}
+
+	first, err := registry.acquire("car a", open)
+	require.NoError(t, err)
+	second, err := registry.acquire("car a", open)
+	require.NoError(t, err)
+	require.Equal(t, 1, opened)
+	require.Same(t, first.Value(), second.Value())
+	require.Equal(t, 2, registry.Refs("car a"))
+
+	require.NoError(t, first.Release())
+	require.NoError(t, first.Release()) // releasing twice is a no-op.
+	require.Equal(t, 1, registry.Refs("car a"))
+	require.Equal(t, int32(0), closer.closed.Load())
+
+	require.NoError(t, second.Release())
+	require.Equal(t, int32(1), closer.closed.Load())
+	require.Equal(t, 0, registry.Len())
+
+	// once closed, the resource is opened again.
+	third, err := registry.acquire("car a", open)
+	require.NoError(t, err)
+	require.Equal(t, 2, opened)
+	require.NoError(t, third.Release())
+
+	// failures are not kept.
+	_, err = registry.acquire("car b", func() (io.Closer, error) {
+		return nil, errors.New("no such file")
+	})
+	require.EqualError(t, err, "no such file")
+	require.Equal(t, 0, registry.Len())
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	remotecache "github.com/rpcpool/yellowstone-faithful/remote-cache"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+	"k8s.io/klog/v2"
+)
+
+// ResponseCache caches the rendered results of JSON-RPC requests, keyed by the normalized request
+// (i.e. method and params with the defaults filled in), so that identical requests
+// (e.g. for a popular slot) are served without touching the archive.
+type ResponseCache struct {
+	cache        *bigcache.BigCache
+	maxEntrySize int
+	ttl          time.Duration
+	remote       remotecache.Cache
+}
+
+type ResponseCacheConfig struct {
+	// TTL is how long a response stays in the cache.
+	TTL time.Duration
+	// MaxSizeMB is the max size of the cache; 0 means no limit.
+	MaxSizeMB int
+	// MaxEntrySize is the max size of a single cached result; bigger results are not cached.
+	MaxEntrySize int
+	// Remote (optional) is a cache shared with the other replicas (Redis, memcached);
+	// it's looked up when a response is not in the local cache.
+	Remote remotecache.Cache
+}
+
+// remoteResponseCacheTimeout is the max time spent waiting for the remote cache;
+// a slow remote cache must not be slower than rendering the response again.
+const remoteResponseCacheTimeout = 100 * time.Millisecond
+
+// defaultResponseCacheMaxEntrySize is the default max size of a cached result.
+const defaultResponseCacheMaxEntrySize = 4 * 1024 * 1024
+
+func NewResponseCache(ctx context.Context, conf ResponseCacheConfig) (*ResponseCache, error) {
+	if conf.TTL <= 0 {
+		return nil, fmt.Errorf("response cache TTL must be positive")
+	}
+	bigConf := bigcache.DefaultConfig(conf.TTL)
+	bigConf.CleanWindow = conf.TTL
+	bigConf.HardMaxCacheSize = conf.MaxSizeMB
+	cache, err := bigcache.New(ctx, bigConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create response cache: %w", err)
+	}
+	maxEntrySize := conf.MaxEntrySize
+	if maxEntrySize <= 0 {
+		maxEntrySize = defaultResponseCacheMaxEntrySize
+	}
+	return &ResponseCache{
+		cache:        cache,
+		maxEntrySize: maxEntrySize,
+		ttl:          conf.TTL,
+		remote:       conf.Remote,
+	}, nil
+}
+
+// remoteKey returns the key used in the remote cache; keys are hashed because the normalized
+// requests can be long, and memcached keys are limited to 250 chars without whitespace.
+// The prefix is versioned with the format of the cached responses.
+func remoteKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "faithful:rc2:" + hex.EncodeToString(sum[:])
+}
+
+// CachedResponse is a response of the ResponseCache: the rendered result, and the headers the
+// handler set on the response (see cachedResponseHeaders), that are sent again with it.
+type CachedResponse struct {
+	Result  json.RawMessage   `json:"result"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// cachedResponseHeaders are the headers set by the method handlers that are cached with
+// the result (e.g. the CIDs the response was read from).
+var cachedResponseHeaders = []string{"DAG-Root-CID"}
+
+// newCachedResponse returns the response to cache for the given result, with the headers
+// of the response that the handler set.
+func newCachedResponse(result json.RawMessage, resp *fasthttp.Response) *CachedResponse {
+	cached := &CachedResponse{Result: result}
+	for _, name := range cachedResponseHeaders {
+		if v := resp.Header.Peek(name); len(v) > 0 {
+			if cached.Headers == nil {
+				cached.Headers = make(map[string]string)
+			}
+			cached.Headers[name] = string(v)
+		}
+	}
+	return cached
+}
+
+// setHeaders sets the cached headers on the response.
+func (r *CachedResponse) setHeaders(resp *fasthttp.Response) {
+	for name, v := range r.Headers {
+		resp.Header.Set(name, v)
+	}
+}
+
+// Get returns the cached response for the given key.
+func (c *ResponseCache) Get(ctx context.Context, key string) (*CachedResponse, bool) {
+	v, err := c.cache.Get(key)
+	if err == nil {
+		if cached, ok := decodeCachedResponse(v); ok {
+			metrics_responseCache.WithLabelValues("hit").Inc()
+			return cached, true
+		}
+	}
+	if c.remote != nil {
+		ctx, cancel := context.WithTimeout(ctx, remoteResponseCacheTimeout)
+		defer cancel()
+		v, found, err := c.remote.Get(ctx, remoteKey(key))
+		if err != nil {
+			klog.V(3).Infof("response cache: remote get failed: %v", err)
+			metrics_responseCache.WithLabelValues("remote_error").Inc()
+		} else if found {
+			if cached, ok := decodeCachedResponse(v); ok {
+				metrics_responseCache.WithLabelValues("remote_hit").Inc()
+				c.cache.Set(key, v)
+				return cached, true
+			}
+		}
+	}
+	metrics_responseCache.WithLabelValues("miss").Inc()
+	return nil, false
+}
+
+// decodeCachedResponse decodes a cached response; a response that can't be decoded is a miss.
+func decodeCachedResponse(v []byte) (*CachedResponse, bool) {
+	var cached CachedResponse
+	if err := fasterJson.Unmarshal(v, &cached); err != nil || cached.Result == nil {
+		metrics_responseCache.WithLabelValues("decode_error").Inc()
+		return nil, false
+	}
+	return &cached, true
+}
+
+// Set caches the given response; responses with a result that is too big are ignored.
+func (c *ResponseCache) Set(key string, response *CachedResponse) {
+	if len(response.Result) > c.maxEntrySize {
+		metrics_responseCache.WithLabelValues("too_big").Inc()
+		return
+	}
+	v, err := fasterJson.Marshal(response)
+	if err != nil {
+		metrics_responseCache.WithLabelValues("set_error").Inc()
+		return
+	}
+	if err := c.cache.Set(key, v); err != nil {
+		metrics_responseCache.WithLabelValues("set_error").Inc()
+	}
+	if c.remote != nil {
+		// don't make the client wait for the remote cache.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), remoteResponseCacheTimeout)
+			defer cancel()
+			if err := c.remote.Set(ctx, remoteKey(key), v, c.ttl); err != nil {
+				klog.V(3).Infof("response cache: remote set failed: %v", err)
+				metrics_responseCache.WithLabelValues("remote_error").Inc()
+			}
+		}()
+	}
+}
+
+// Reset removes all the locally cached responses (e.g. after epochs were replaced).
+func (c *ResponseCache) Reset() error {
+	return c.cache.Reset()
+}
+
+// Len returns the number of cached responses.
+func (c *ResponseCache) Len() int {
+	return c.cache.Len()
+}
+
+// normalizeRequest returns the cache key for the given request, and false if the request is not cacheable
+// (see MethodSpec.CacheKey). The params are parsed with the same parsers used by the handlers (which fill in
+// the defaults) and re-encoded, so that requests that only differ in the order of the options,
+// or in options set to their default values, share the same key.
+func normalizeRequest(req *jsonrpc2.Request) (string, bool) {
+	if req.Params == nil {
+		return "", false
+	}
+	spec, ok := lookupMethod(req.Method)
+	if !ok || spec.CacheKey == nil {
+		return "", false
+	}
+	normalized, ok := spec.CacheKey(req)
+	if !ok {
+		return "", false
+	}
+	buf, err := fasterJson.Marshal(normalized)
+	if err != nil {
+		return "", false
+	}
+	return req.Method + ":" + string(buf), true
+}
+
+// cacheKeyGetBlock is the cache key of the methods with the params of getBlock.
+func cacheKeyGetBlock(req *jsonrpc2.Request) (any, bool) {
+	params, err := parseGetBlockRequest(req.Params)
+	if err != nil || params.Validate() != nil {
+		return nil, false
+	}
+	if params.Options.WithDebugTiming {
+		// the timings are specific to each request.
+		return nil, false
+	}
+	return params, true
+}
+
+// cacheKeySlot is the cache key of the methods with only a slot param.
+func cacheKeySlot(req *jsonrpc2.Request) (any, bool) {
+	slot, err := parseGetBlockTimeRequest(req.Params)
+	if err != nil {
+		return nil, false
+	}
+	return slot, true
+}
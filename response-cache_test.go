@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestRequest(t *testing.T, method string, params string) *jsonrpc2.Request {
+	raw := json.RawMessage(params)
+	return &jsonrpc2.Request{
+		Method: method,
+		Params: &raw,
+	}
+}
+
+func TestNormalizeRequest(t *testing.T) {
+	key := func(method string, params string) string {
+		k, ok := normalizeRequest(newTestRequest(t, method, params))
+		require.True(t, ok, "%s %s", method, params)
+		return k
+	}
+	{
+		withDefaults := key("getBlock", `[123]`)
+		require.Equal(t, withDefaults, key("getBlock", `[123, {}]`))
+		require.Equal(t, withDefaults, key("getBlock", `[123, {"rewards": true, "encoding": "json"}]`))
+		require.Equal(t, withDefaults, key("getBlock", `[123, {"encoding": "json", "rewards": true}]`))
+		require.NotEqual(t, withDefaults, key("getBlock", `[123, {"encoding": "base64"}]`))
+		require.NotEqual(t, withDefaults, key("getBlock", `[124]`))
+		require.NotEqual(t, withDefaults, key("getBlockTime", `[123]`))
+	}
+	{
+		_, ok := normalizeRequest(newTestRequest(t, "getBlock", `[123, {"encoding": "foo"}]`))
+		require.False(t, ok)
+	}
+	{
+		_, ok := normalizeRequest(newTestRequest(t, "getSlot", `[]`))
+		require.False(t, ok)
+	}
+}
+
+func TestResponseCacheHeaders(t *testing.T) {
+	responseCache, err := NewResponseCache(context.Background(), ResponseCacheConfig{TTL: time.Minute})
+	require.NoError(t, err)
+	calls := 0
+	handler := cacheMiddleware(responseCache)(func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		calls++
+		call.HTTP.Response.Header.Set("DAG-Root-CID", DummyCID.String())
+		return nil, call.Reply(ctx, map[string]int{"blockTime": 123})
+	})
+	getBlockTime := func() *fasthttp.Response {
+		var req fasthttp.Request
+		reqCtx := &fasthttp.RequestCtx{}
+		reqCtx.Init(&req, nil, nil)
+		call := &RPCCall{
+			Request: newTestRequest(t, "getBlockTime", `[123]`),
+			HTTP:    reqCtx,
+			conn:    &requestContext{ctx: reqCtx},
+		}
+		errorResp, err := handler(context.Background(), call)
+		require.NoError(t, err)
+		require.Nil(t, errorResp)
+		return &reqCtx.Response
+	}
+
+	miss := getBlockTime()
+	require.Equal(t, "MISS", string(miss.Header.Peek("X-Cache")))
+	hit := getBlockTime()
+	require.Equal(t, 1, calls)
+	require.Equal(t, "HIT", string(hit.Header.Peek("X-Cache")))
+	// the hit has the headers set by the handler on the miss.
+	require.Equal(t, DummyCID.String(), string(hit.Header.Peek("DAG-Root-CID")))
+	var missResp, hitResp jsonrpc2.Response
+	require.NoError(t, json.Unmarshal(miss.Body(), &missResp))
+	require.NoError(t, json.Unmarshal(hit.Body(), &hitResp))
+	require.JSONEq(t, `{"blockTime": 123}`, string(*hitResp.Result))
+	require.Equal(t, *missResp.Result, *hitResp.Result)
+
+	// a cached response that can't be decoded is a miss.
+	require.NoError(t, responseCache.cache.Set("bad", []byte("[")))
+	_, ok := responseCache.Get(context.Background(), "bad")
+	require.False(t, ok)
+}
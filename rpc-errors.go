@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/logging"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Reasons of the errors, sent to the clients in the `data.reason` field of JSON-RPC errors,
+// so that they don't have to parse the messages.
+const (
+	ReasonInvalidParams       = "invalid_params"
+	ReasonEpochNotAvailable   = "epoch_not_available"
+	ReasonNotInArchive        = "not_in_archive"
+	ReasonSlotSkipped         = "slot_skipped"
+	ReasonTransactionNotFound = "transaction_not_found"
+	ReasonNodeNotFound        = "node_not_found"
+	ReasonMethodDisabled      = "method_disabled"
+	ReasonMethodUnsupported   = "method_unsupported"
+	ReasonOverloaded          = "overloaded"
+	ReasonIndexNotReady       = "index_not_ready"
+	ReasonTimeout             = "timeout"
+	ReasonBlockTooLarge       = "block_too_large"
+	ReasonInternal            = "internal"
+)
+
+// CodeSlotSkipped is the code of the requests for a slot that was skipped (same as solana).
+const CodeSlotSkipped = -32007
+
+// CodeServerOverloaded is the code of the requests rejected because the server is overloaded.
+const CodeServerOverloaded = -32011
+
+// CodeIndexNotReady is the code of the requests that need an index that is being rebuilt.
+const CodeIndexNotReady = -32012
+
+// CodeRequestTimeout is the code of the requests that exceeded their deadline (see requestTimeout).
+const CodeRequestTimeout = -32013
+
+// CodeBlockTooLarge is the code of the getBlock requests for a block with more transactions than
+// the server returns in full (see Options.MaxBlockTransactions).
+const CodeBlockTooLarge = -32014
+
+// InternalError is an error of a request handler: the message, reason and data are what
+// the client gets (if the error is public), while the cause is only logged.
+type InternalError struct {
+	Code    int64
+	Message string
+	Reason  string
+	Data    map[string]any
+	Cause   error
+}
+
+func (e *InternalError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+func (e *InternalError) Unwrap() error {
+	return e.Cause
+}
+
+// IsPublic returns true if the message and data of the error can be sent to the client;
+// for internal errors the client only gets a generic message.
+func (e *InternalError) IsPublic() bool {
+	return e.Code != jsonrpc2.CodeInternalError
+}
+
+// JSONRPCError returns the error to send to the client.
+func (e *InternalError) JSONRPCError() *jsonrpc2.Error {
+	if !e.IsPublic() {
+		return newInternalJSONRPCError()
+	}
+	data := map[string]any{
+		"reason": e.Reason,
+	}
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	rpcErr := &jsonrpc2.Error{
+		Code:    e.Code,
+		Message: e.Message,
+	}
+	rpcErr.SetError(data)
+	return rpcErr
+}
+
+// reply returns the values expected from the request handlers.
+func (e *InternalError) reply() (*jsonrpc2.Error, error) {
+	return e.JSONRPCError(), e
+}
+
+// logFields returns the fields to log along with the error.
+func (e *InternalError) logFields() []logging.Field {
+	fields := []logging.Field{logging.String("reason", e.Reason)}
+	for k, v := range e.Data {
+		fields = append(fields, logging.Any(k, v))
+	}
+	return fields
+}
+
+func newInternalJSONRPCError() *jsonrpc2.Error {
+	rpcErr := &jsonrpc2.Error{
+		Code:    jsonrpc2.CodeInternalError,
+		Message: "Internal error",
+	}
+	rpcErr.SetError(map[string]any{"reason": ReasonInternal})
+	return rpcErr
+}
+
+func errInvalidParams(message string, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    jsonrpc2.CodeInvalidParams,
+		Message: message,
+		Reason:  ReasonInvalidParams,
+		Cause:   cause,
+	}).reply()
+}
+
+func errEpochNotAvailable(epoch uint64, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeNotFound,
+		Message: fmt.Sprintf("Epoch %d is not available", epoch),
+		Reason:  ReasonEpochNotAvailable,
+		Data:    map[string]any{"epoch": epoch},
+		Cause:   cause,
+	}).reply()
+}
+
+func errSlotNotInArchive(slot uint64, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeNotFound,
+		Message: fmt.Sprintf("Slot %d was skipped, or missing in long-term storage", slot),
+		Reason:  ReasonNotInArchive,
+		Data:    map[string]any{"slot": slot},
+		Cause:   cause,
+	}).reply()
+}
+
+func errSlotSkipped(slot uint64, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeSlotSkipped,
+		Message: fmt.Sprintf("Slot %d was skipped, or missing due to ledger jump to recent snapshot", slot),
+		Reason:  ReasonSlotSkipped,
+		Data:    map[string]any{"slot": slot},
+		Cause:   cause,
+	}).reply()
+}
+
+func errTransactionNotFound(sig solana.Signature, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeNotFound,
+		Message: "Transaction not found",
+		Reason:  ReasonTransactionNotFound,
+		Data:    map[string]any{"signature": sig.String()},
+		Cause:   cause,
+	}).reply()
+}
+
+func errNodeNotFound(message string, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeNotFound,
+		Message: message,
+		Reason:  ReasonNodeNotFound,
+		Cause:   cause,
+	}).reply()
+}
+
+func errMethodDisabled(method string, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    jsonrpc2.CodeMethodNotFound,
+		Message: method + " method is not enabled",
+		Reason:  ReasonMethodDisabled,
+		Data:    map[string]any{"method": method},
+		Cause:   cause,
+	}).reply()
+}
+
+func errMethodUnsupported(method string, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    jsonrpc2.CodeMethodNotFound,
+		Message: method + " is not supported by this archive",
+		Reason:  ReasonMethodUnsupported,
+		Data:    map[string]any{"method": method},
+		Cause:   cause,
+	}).reply()
+}
+
+func errIndexNotReady(notReady *IndexNotReadyError, cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeIndexNotReady,
+		Message: fmt.Sprintf("Epoch %d is being re-indexed, retry later", notReady.Epoch),
+		Reason:  ReasonIndexNotReady,
+		Data:    map[string]any{"epoch": notReady.Epoch, "index": notReady.Index},
+		Cause:   cause,
+	}).reply()
+}
+
+func errRequestTimeout(cause error) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code:    CodeRequestTimeout,
+		Message: "Request timed out",
+		Reason:  ReasonTimeout,
+		Cause:   cause,
+	}).reply()
+}
+
+func errBlockTooLarge(slot uint64, numTransactions int, maxTransactions int) (*jsonrpc2.Error, error) {
+	return (&InternalError{
+		Code: CodeBlockTooLarge,
+		Message: fmt.Sprintf(
+			"Block %d has %d transactions, more than the %d returned in full by this server: use transactionDetails \"signatures\" or \"none\", then faithful_getTransactions",
+			slot, numTransactions, maxTransactions,
+		),
+		Reason: ReasonBlockTooLarge,
+		Data:   map[string]any{"slot": slot, "numTransactions": numTransactions, "maxTransactions": maxTransactions},
+	}).reply()
+}
+
+// errInternal returns an internal error, unless the cause is an index being rebuilt
+// (which is not a failure of the server, and which the client can retry).
+func errInternal(cause error) (*jsonrpc2.Error, error) {
+	var notReady *IndexNotReadyError
+	if errors.As(cause, &notReady) {
+		return errIndexNotReady(notReady, cause)
+	}
+	return (&InternalError{
+		Code:    jsonrpc2.CodeInternalError,
+		Message: "Internal error",
+		Reason:  ReasonInternal,
+		Cause:   cause,
+	}).reply()
+}
+
+// publicError returns the error to send to the client: the details of internal errors
+// are replaced by a generic message and the request ID, to be reported by the client.
+func publicError(rpcErr *jsonrpc2.Error, reqID string) *jsonrpc2.Error {
+	if rpcErr == nil || rpcErr.Code != jsonrpc2.CodeInternalError {
+		return rpcErr
+	}
+	public := &jsonrpc2.Error{
+		Code:    jsonrpc2.CodeInternalError,
+		Message: "Internal error",
+	}
+	public.SetError(map[string]any{
+		"reason":    ReasonInternal,
+		"requestId": reqID,
+	})
+	return public
+}
+
+// errorLogFields returns the fields describing the error, for the logs.
+func errorLogFields(err error) []logging.Field {
+	fields := []logging.Field{logging.Err(err)}
+	var internalErr *InternalError
+	if errors.As(err, &internalErr) {
+		fields = append(fields, internalErr.logFields()...)
+	}
+	return fields
+}
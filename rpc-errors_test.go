@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func errorData(t *testing.T, rpcErr *jsonrpc2.Error) map[string]any {
+	require.NotNil(t, rpcErr.Data)
+	var data map[string]any
+	require.NoError(t, json.Unmarshal(*rpcErr.Data, &data))
+	return data
+}
+
+func TestPublicErrors(t *testing.T) {
+	cause := errors.New("index lookup failed")
+	rpcErr, err := errSlotNotInArchive(123, fmt.Errorf("wrapped: %w", cause))
+	require.Equal(t, int64(CodeNotFound), rpcErr.Code)
+	require.Equal(t, "Slot 123 was skipped, or missing in long-term storage", rpcErr.Message)
+	require.Equal(t, map[string]any{"reason": ReasonNotInArchive, "slot": float64(123)}, errorData(t, rpcErr))
+	require.ErrorIs(t, err, cause)
+
+	var internalErr *InternalError
+	require.ErrorAs(t, err, &internalErr)
+	require.True(t, internalErr.IsPublic())
+
+	// public errors are sent as they are.
+	require.Same(t, rpcErr, publicError(rpcErr, "req-1"))
+}
+
+func TestSlotSkippedError(t *testing.T) {
+	rpcErr, err := errSlotSkipped(123, errors.New("not found"))
+	require.Equal(t, int64(CodeSlotSkipped), rpcErr.Code)
+	require.Equal(t, "Slot 123 was skipped, or missing due to ledger jump to recent snapshot", rpcErr.Message)
+	require.Equal(t, map[string]any{"reason": ReasonSlotSkipped, "slot": float64(123)}, errorData(t, rpcErr))
+
+	var internalErr *InternalError
+	require.ErrorAs(t, err, &internalErr)
+	require.True(t, internalErr.IsPublic())
+}
+
+func TestInternalErrorsAreNotLeaked(t *testing.T) {
+	rpcErr, err := errInternal(errors.New("open /secret/path/epoch-1.car: no such file"))
+	require.Equal(t, "Internal error", rpcErr.Message)
+	require.NotContains(t, string(*rpcErr.Data), "secret")
+	require.Contains(t, err.Error(), "/secret/path")
+
+	var internalErr *InternalError
+	require.ErrorAs(t, err, &internalErr)
+	require.False(t, internalErr.IsPublic())
+
+	// internal errors built by hand are sanitized too, and get the request ID.
+	public := publicError(&jsonrpc2.Error{Code: jsonrpc2.CodeInternalError, Message: "failed to read /secret/path"}, "req-1")
+	require.Equal(t, "Internal error", public.Message)
+	require.Equal(t, map[string]any{"reason": ReasonInternal, "requestId": "req-1"}, errorData(t, public))
+}
+
+func TestErrorLogFields(t *testing.T) {
+	_, err := errEpochNotAvailable(7, errors.New("not loaded"))
+	fields := errorLogFields(fmt.Errorf("handler: %w", err))
+	require.Len(t, fields, 3)
+	require.Equal(t, "error", fields[0].Key)
+	require.Equal(t, "reason", fields[1].Key)
+	require.Equal(t, ReasonEpochNotAvailable, fields[1].Value)
+	require.Equal(t, "epoch", fields[2].Key)
+
+	require.Len(t, errorLogFields(errors.New("plain")), 1)
+}
+
+func TestBlockTooLargeError(t *testing.T) {
+	rpcErr, err := errBlockTooLarge(123, 9000, 5000)
+	require.Equal(t, int64(CodeBlockTooLarge), rpcErr.Code)
+	require.Contains(t, rpcErr.Message, "transactionDetails \"signatures\"")
+	require.Equal(t, map[string]any{
+		"reason":          ReasonBlockTooLarge,
+		"slot":            float64(123),
+		"numTransactions": float64(9000),
+		"maxTransactions": float64(5000),
+	}, errorData(t, rpcErr))
+	require.Error(t, err)
+}
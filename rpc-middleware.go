@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/valyala/fasthttp"
+)
+
+// RPCCall is a JSON-RPC request going through the middleware chain.
+type RPCCall struct {
+	Request   *jsonrpc2.Request
+	HTTP      *fasthttp.RequestCtx
+	RequestID string
+	conn      *requestContext
+}
+
+// Reply answers the request with the given result; a middleware that answers the request
+// itself returns nil, nil after it, without calling the next step.
+func (c *RPCCall) Reply(ctx context.Context, result any) error {
+	return c.conn.ReplyRaw(ctx, c.Request.ID, result)
+}
+
+// Result returns the rendered result of the reply, once the request is answered successfully.
+func (c *RPCCall) Result() json.RawMessage {
+	return c.conn.result
+}
+
+// RPCHandler handles a JSON-RPC request; like the method handlers, it returns the error to send
+// to the client (if any), and the error to log.
+type RPCHandler func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error)
+
+// RPCMiddleware wraps a step of the handling of the JSON-RPC requests around the next ones.
+type RPCMiddleware func(next RPCHandler) RPCHandler
+
+// The built-in steps of the chain, in order, before the method handler.
+const (
+	// MiddlewareAuth is where the authentication steps go; the server has none of its own.
+	MiddlewareAuth = "auth"
+	// MiddlewareRateLimit assigns the priority of the request, and sheds it when the storage is saturated.
+	MiddlewareRateLimit = "rate_limit"
+	// MiddlewareCache answers from the response cache, and fills it.
+	MiddlewareCache = "cache"
+	// MiddlewareMetrics counts the successes and failures of the methods.
+	MiddlewareMetrics = "metrics"
+)
+
+type middlewareStep struct {
+	name string
+	// middleware is nil for the built-in steps, which are bound when the server starts.
+	middleware RPCMiddleware
+}
+
+// MiddlewareChain is the pipeline of the JSON-RPC requests (auth → rate limit → cache → metrics →
+// method handler), in which the embedders of the server insert their own steps (e.g. billing),
+// relative to the built-in ones. The requests proxied to another RPC server don't go through it.
+type MiddlewareChain struct {
+	steps []middlewareStep
+}
+
+// NewMiddlewareChain returns the chain with only the built-in steps.
+func NewMiddlewareChain() *MiddlewareChain {
+	return &MiddlewareChain{
+		steps: []middlewareStep{
+			{name: MiddlewareAuth},
+			{name: MiddlewareRateLimit},
+			{name: MiddlewareCache},
+			{name: MiddlewareMetrics},
+		},
+	}
+}
+
+// InsertBefore inserts the middleware right before the named step.
+func (c *MiddlewareChain) InsertBefore(step string, name string, middleware RPCMiddleware) error {
+	return c.insert(step, 0, name, middleware)
+}
+
+// InsertAfter inserts the middleware right after the named step.
+func (c *MiddlewareChain) InsertAfter(step string, name string, middleware RPCMiddleware) error {
+	return c.insert(step, 1, name, middleware)
+}
+
+func (c *MiddlewareChain) insert(step string, offset int, name string, middleware RPCMiddleware) error {
+	if name == "" || middleware == nil {
+		return fmt.Errorf("a middleware must have a name and a function")
+	}
+	if c.index(name) >= 0 {
+		return fmt.Errorf("the chain already has a %q step", name)
+	}
+	at := c.index(step)
+	if at < 0 {
+		return fmt.Errorf("the chain has no %q step", step)
+	}
+	at += offset
+	c.steps = append(c.steps[:at], append([]middlewareStep{{name: name, middleware: middleware}}, c.steps[at:]...)...)
+	return nil
+}
+
+func (c *MiddlewareChain) index(name string) int {
+	for i, step := range c.steps {
+		if step.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Names returns the names of the steps of the chain, in order.
+func (c *MiddlewareChain) Names() []string {
+	names := make([]string, len(c.steps))
+	for i, step := range c.steps {
+		names[i] = step.name
+	}
+	return names
+}
+
+// then returns the handler that runs the steps of the chain, then the given handler; the
+// built-in steps are the given ones (a built-in step without one is skipped).
+func (c *MiddlewareChain) then(builtins map[string]RPCMiddleware, handler RPCHandler) RPCHandler {
+	for i := len(c.steps) - 1; i >= 0; i-- {
+		middleware := c.steps[i].middleware
+		if middleware == nil {
+			middleware = builtins[c.steps[i].name]
+		}
+		if middleware != nil {
+			handler = middleware(handler)
+		}
+	}
+	return handler
+}
+
+// rateLimitMiddleware assigns the priority of the request, and sheds it if the storage is saturated.
+func rateLimitMiddleware(priorities *PriorityConfig, loadShedder *LoadShedder) RPCMiddleware {
+	return func(next RPCHandler) RPCHandler {
+		return func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+			priority := priorities.priorityOf(call.HTTP, call.Request.Method)
+			metrics_requestsByPriority.WithLabelValues(priority.String()).Inc()
+			if loadShedder.reject(call.HTTP, call.Request.Method, priority, &call.Request.ID) {
+				// already answered.
+				return nil, nil
+			}
+			return next(setRequestPriorityToContext(ctx, priority), call)
+		}
+	}
+}
+
+// cacheMiddleware answers the cacheable requests from the response cache, and caches the
+// results of the others.
+func cacheMiddleware(responseCache *ResponseCache) RPCMiddleware {
+	return func(next RPCHandler) RPCHandler {
+		return func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+			key, ok := normalizeRequest(call.Request)
+			if !ok {
+				return next(ctx, call)
+			}
+			if call.conn.strict() {
+				// a different rendering of the same request.
+				key += ";" + string(ApiVersionStrict)
+			}
+			if cached, ok := responseCache.Get(call.HTTP, key); ok {
+				result := cached.Result
+				if call.conn.largeIntsAsStrings {
+					// the cache has the responses with the integers as numbers.
+					if converted, err := encodeLargeIntsAsStrings(result); err == nil {
+						result = converted
+					}
+				}
+				cached.setHeaders(&call.HTTP.Response)
+				call.HTTP.Response.Header.Set("X-Cache", "HIT")
+				replyJSON(call.HTTP, http.StatusOK, jsonrpc2.Response{
+					ID:     call.Request.ID,
+					Result: &result,
+				})
+				metrics_methodToSuccessOrFailure.WithLabelValues(sanitizeMethod(call.Request.Method), "success").Inc()
+				return nil, nil
+			}
+			call.HTTP.Response.Header.Set("X-Cache", "MISS")
+			errorResp, err := next(ctx, call)
+			if errorResp == nil && call.conn.result != nil && !call.conn.largeIntsAsStrings {
+				responseCache.Set(key, newCachedResponse(call.conn.result, &call.HTTP.Response))
+			}
+			return errorResp, err
+		}
+	}
+}
+
+// metricsMiddleware counts the successes and failures of the methods.
+func metricsMiddleware(next RPCHandler) RPCHandler {
+	return func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		errorResp, err := next(ctx, call)
+		outcome := "success"
+		if errorResp != nil {
+			outcome = "failure"
+		}
+		metrics_methodToSuccessOrFailure.WithLabelValues(sanitizeMethod(call.Request.Method), outcome).Inc()
+		return errorResp, err
+	}
+}
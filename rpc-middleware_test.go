@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	var trace []string
+	step := func(name string) RPCMiddleware {
+		return func(next RPCHandler) RPCHandler {
+			return func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+				trace = append(trace, name)
+				return next(ctx, call)
+			}
+		}
+	}
+	chain := NewMiddlewareChain()
+	require.Equal(t, []string{MiddlewareAuth, MiddlewareRateLimit, MiddlewareCache, MiddlewareMetrics}, chain.Names())
+
+	require.NoError(t, chain.InsertAfter(MiddlewareAuth, "api-key", step("api-key")))
+	require.NoError(t, chain.InsertBefore(MiddlewareCache, "billing", step("billing")))
+	require.NoError(t, chain.InsertAfter(MiddlewareMetrics, "audit", step("audit")))
+	require.Error(t, chain.InsertAfter(MiddlewareMetrics, "billing", step("billing")))
+	require.Error(t, chain.InsertBefore("unknown", "other", step("other")))
+	require.Equal(t, []string{MiddlewareAuth, "api-key", MiddlewareRateLimit, "billing", MiddlewareCache, MiddlewareMetrics, "audit"}, chain.Names())
+
+	// the built-in steps without a middleware (auth, cache) are skipped.
+	handler := chain.then(map[string]RPCMiddleware{
+		MiddlewareRateLimit: step(MiddlewareRateLimit),
+		MiddlewareMetrics:   step(MiddlewareMetrics),
+	}, func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		trace = append(trace, "handler")
+		return nil, nil
+	})
+	errorResp, err := handler(context.Background(), &RPCCall{Request: &jsonrpc2.Request{Method: "getSlot"}})
+	require.NoError(t, err)
+	require.Nil(t, errorResp)
+	require.Equal(t, []string{"api-key", MiddlewareRateLimit, "billing", MiddlewareMetrics, "audit", "handler"}, trace)
+
+	// a step can answer the request without calling the next ones.
+	trace = nil
+	require.NoError(t, chain.InsertBefore(MiddlewareRateLimit, "deny", func(next RPCHandler) RPCHandler {
+		return func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+			trace = append(trace, "deny")
+			return &jsonrpc2.Error{Code: jsonrpc2.CodeInvalidRequest, Message: "unauthorized"}, nil
+		}
+	}))
+	handler = chain.then(nil, func(ctx context.Context, call *RPCCall) (*jsonrpc2.Error, error) {
+		trace = append(trace, "handler")
+		return nil, nil
+	})
+	errorResp, _ = handler(context.Background(), &RPCCall{Request: &jsonrpc2.Request{Method: "getSlot"}})
+	require.Equal(t, "unauthorized", errorResp.Message)
+	require.Equal(t, []string{"api-key", "deny"}, trace)
+}
@@ -0,0 +1,175 @@
+package seekablezstd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCacheFrames is the default number of decompressed frames that are kept in memory.
+const DefaultCacheFrames = 16
+
+// Reader reads the decompressed data of a seekable zstd file at any offset.
+// It's safe for concurrent use.
+type Reader struct {
+	r     io.ReaderAt
+	table *SeekTable
+	// compressedOffsets and decompressedOffsets are the start offsets of the frames;
+	// they have one more element than the frames, with the end offsets.
+	compressedOffsets   []int64
+	decompressedOffsets []int64
+	decoder             *zstd.Decoder
+
+	mu sync.Mutex
+	// cache has the last decompressed frames, most recently used last.
+	cache       []cachedFrame
+	cacheFrames int
+}
+
+type cachedFrame struct {
+	index int
+	data  []byte
+}
+
+// Open returns a reader of the seekable zstd data of the given (compressed) size,
+// using the seek table at its end.
+func Open(r io.ReaderAt, size int64) (*Reader, error) {
+	table, err := ReadSeekTable(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(r, size, table)
+}
+
+// NewReader returns a reader of the zstd data of the given (compressed) size, made of the frames
+// of the given seek table (e.g. read from a sidecar file).
+func NewReader(r io.ReaderAt, size int64, table *SeekTable) (*Reader, error) {
+	if compressedSize := table.CompressedSize(); compressedSize > size {
+		return nil, fmt.Errorf("the frames of the seek table add up to %d bytes, but the data has %d bytes", compressedSize, size)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	rd := &Reader{
+		r:                   r,
+		table:               table,
+		compressedOffsets:   make([]int64, len(table.Frames)+1),
+		decompressedOffsets: make([]int64, len(table.Frames)+1),
+		decoder:             decoder,
+		cacheFrames:         DefaultCacheFrames,
+	}
+	for i, frame := range table.Frames {
+		rd.compressedOffsets[i+1] = rd.compressedOffsets[i] + int64(frame.CompressedSize)
+		rd.decompressedOffsets[i+1] = rd.decompressedOffsets[i] + int64(frame.DecompressedSize)
+	}
+	return rd, nil
+}
+
+// SetCacheFrames sets the number of decompressed frames that are kept in memory.
+func (rd *Reader) SetCacheFrames(n int) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.cacheFrames = n
+	if len(rd.cache) > n {
+		rd.cache = append(rd.cache[:0], rd.cache[len(rd.cache)-n:]...)
+	}
+}
+
+// Size returns the size of the decompressed data.
+func (rd *Reader) Size() int64 {
+	return rd.decompressedOffsets[len(rd.decompressedOffsets)-1]
+}
+
+// NumFrames returns the number of frames.
+func (rd *Reader) NumFrames() int {
+	return len(rd.table.Frames)
+}
+
+// ReadAt reads the decompressed data at the given offset.
+func (rd *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+	if off >= rd.Size() {
+		return 0, io.EOF
+	}
+	// the last frame that starts at or before the offset (skipping the empty frames).
+	index := sort.Search(len(rd.table.Frames), func(i int) bool {
+		return rd.decompressedOffsets[i+1] > off
+	})
+	n := 0
+	for n < len(p) && index < len(rd.table.Frames) {
+		data, err := rd.frame(index)
+		if err != nil {
+			return n, err
+		}
+		start := off + int64(n) - rd.decompressedOffsets[index]
+		n += copy(p[n:], data[start:])
+		index++
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// frame returns the decompressed data of the frame with the given index.
+func (rd *Reader) frame(index int) ([]byte, error) {
+	rd.mu.Lock()
+	for i, cached := range rd.cache {
+		if cached.index == index {
+			// move it to the end.
+			rd.cache = append(append(rd.cache[:i], rd.cache[i+1:]...), cached)
+			rd.mu.Unlock()
+			return cached.data, nil
+		}
+	}
+	rd.mu.Unlock()
+
+	data, err := rd.decompressFrame(index)
+	if err != nil {
+		return nil, err
+	}
+
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if rd.cacheFrames > 0 {
+		if len(rd.cache) >= rd.cacheFrames {
+			rd.cache = append(rd.cache[:0], rd.cache[len(rd.cache)-rd.cacheFrames+1:]...)
+		}
+		rd.cache = append(rd.cache, cachedFrame{index: index, data: data})
+	}
+	return data, nil
+}
+
+func (rd *Reader) decompressFrame(index int) ([]byte, error) {
+	frame := rd.table.Frames[index]
+	compressed := make([]byte, frame.CompressedSize)
+	if _, err := rd.r.ReadAt(compressed, rd.compressedOffsets[index]); err != nil {
+		return nil, fmt.Errorf("failed to read frame %d: %w", index, err)
+	}
+	data, err := rd.decoder.DecodeAll(compressed, make([]byte, 0, frame.DecompressedSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress frame %d: %w", index, err)
+	}
+	if len(data) != int(frame.DecompressedSize) {
+		return nil, fmt.Errorf("frame %d has %d bytes, expected %d", index, len(data), frame.DecompressedSize)
+	}
+	if rd.table.HasChecksums {
+		if checksum := uint32(xxhash.Sum64(data)); checksum != frame.Checksum {
+			return nil, fmt.Errorf("frame %d has the wrong checksum: %#x, expected %#x", index, checksum, frame.Checksum)
+		}
+	}
+	return data, nil
+}
+
+// Close releases the resources of the reader; it doesn't close the underlying reader.
+func (rd *Reader) Close() error {
+	rd.decoder.Close()
+	return nil
+}
@@ -0,0 +1,149 @@
+package seekablezstd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	frameMagic = 0xFD2FB528
+	// skippable frames have a magic number in [0x184D2A50, 0x184D2A5F].
+	skippableMagicMask = 0xFFFFFFF0
+
+	// MaxScanFrameSize is the max size (compressed or not) of the frames of the files that can be
+	// made seekable with a sidecar: the frames are decompressed as a whole to serve a read.
+	MaxScanFrameSize = 64 << 20
+)
+
+// ErrFrameTooLarge is returned by ScanFrames when a frame is too large to be decompressed for each read
+// (e.g. a file compressed as a single frame), so the file must be recompressed instead.
+var ErrFrameTooLarge = errors.New("frame is too large")
+
+// ScanFrames reads a zstd file made of multiple frames, and returns the seek table of its frames
+// (with their checksums), to be stored in a sidecar file. The skippable frames must be at the end
+// (e.g. an existing seek table), since the seek table can't describe them.
+func ScanFrames(r io.Reader) (*SeekTable, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxScanFrameSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer decoder.Close()
+	table := &SeekTable{HasChecksums: true}
+	var decompressed []byte
+	for {
+		frame, skippable, err := readFrame(br)
+		if errors.Is(err, io.EOF) {
+			return table, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame %d: %w", len(table.Frames), err)
+		}
+		if skippable {
+			if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+				return table, nil
+			}
+			return nil, fmt.Errorf("frame %d is a skippable frame that is not at the end", len(table.Frames))
+		}
+		decompressed, err = decoder.DecodeAll(frame, decompressed[:0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress frame %d: %w", len(table.Frames), err)
+		}
+		table.Frames = append(table.Frames, Frame{
+			CompressedSize:   uint32(len(frame)),
+			DecompressedSize: uint32(len(decompressed)),
+			Checksum:         uint32(xxhash.Sum64(decompressed)),
+		})
+	}
+}
+
+// readFrame returns the next (whole) frame, walking its blocks to find its end.
+func readFrame(br *bufio.Reader) ([]byte, bool, error) {
+	frame := make([]byte, 4, 1024)
+	if _, err := io.ReadFull(br, frame); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, false, fmt.Errorf("truncated frame")
+		}
+		return nil, false, err
+	}
+	read := func(n int) ([]byte, error) {
+		if len(frame)+n > MaxScanFrameSize {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFrameTooLarge, MaxScanFrameSize)
+		}
+		start := len(frame)
+		frame = append(frame, make([]byte, n)...)
+		if _, err := io.ReadFull(br, frame[start:]); err != nil {
+			return nil, fmt.Errorf("truncated frame: %w", err)
+		}
+		return frame[start:], nil
+	}
+	magic := binary.LittleEndian.Uint32(frame)
+	if magic&skippableMagicMask == skippableMagic&skippableMagicMask {
+		size, err := read(4)
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := read(int(binary.LittleEndian.Uint32(size))); err != nil {
+			return nil, false, err
+		}
+		return frame, true, nil
+	}
+	if magic != frameMagic {
+		return nil, false, fmt.Errorf("not a zstd frame: magic number %#x", magic)
+	}
+	header, err := read(1)
+	if err != nil {
+		return nil, false, err
+	}
+	descriptor := header[0]
+	singleSegment := descriptor&(1<<5) != 0
+	hasChecksum := descriptor&(1<<2) != 0
+	headerSize := [4]int{0, 1, 2, 4}[descriptor&3]
+	switch fcsFlag := descriptor >> 6; {
+	case fcsFlag == 0 && singleSegment:
+		headerSize += 1
+	case fcsFlag > 0:
+		headerSize += [4]int{0, 2, 4, 8}[fcsFlag]
+	}
+	if !singleSegment {
+		// the window descriptor.
+		headerSize++
+	}
+	if _, err := read(headerSize); err != nil {
+		return nil, false, err
+	}
+	for {
+		blockHeader, err := read(3)
+		if err != nil {
+			return nil, false, err
+		}
+		value := uint32(blockHeader[0]) | uint32(blockHeader[1])<<8 | uint32(blockHeader[2])<<16
+		last := value&1 != 0
+		size := int(value >> 3)
+		switch blockType := (value >> 1) & 3; blockType {
+		case 1:
+			// RLE: a single byte, repeated size times.
+			size = 1
+		case 3:
+			return nil, false, fmt.Errorf("reserved block type")
+		}
+		if _, err := read(size); err != nil {
+			return nil, false, err
+		}
+		if last {
+			break
+		}
+	}
+	if hasChecksum {
+		if _, err := read(4); err != nil {
+			return nil, false, err
+		}
+	}
+	return frame, false, nil
+}
@@ -0,0 +1,177 @@
+package seekablezstd
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestData(size int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	for i := range data {
+		// compressible, but not trivially.
+		data[i] = byte(rng.Intn(16))
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := newTestData(100_000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 4096)
+	require.NoError(t, err)
+	// write in odd chunks, so that they don't match the frames.
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 1000+len(rest)%777)
+		_, err := w.Write(rest[:n])
+		require.NoError(t, err)
+		rest = rest[n:]
+	}
+	require.NoError(t, w.Close())
+	require.Len(t, w.SeekTable().Frames, 25)
+	require.Less(t, buf.Len(), len(data))
+
+	compressed := bytes.NewReader(buf.Bytes())
+	rd, err := Open(compressed, compressed.Size())
+	require.NoError(t, err)
+	defer rd.Close()
+	require.Equal(t, int64(len(data)), rd.Size())
+	require.Equal(t, 25, rd.NumFrames())
+
+	// the whole data.
+	got, err := io.ReadAll(io.NewSectionReader(rd, 0, rd.Size()))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	// random ranges, across the frames.
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 200; i++ {
+		off := rng.Int63n(int64(len(data)))
+		p := make([]byte, rng.Intn(10_000))
+		n, err := rd.ReadAt(p, off)
+		if off+int64(len(p)) > int64(len(data)) {
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, len(data)-int(off), n)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, len(p), n)
+		}
+		require.Equal(t, data[off:off+int64(n)], p[:n])
+	}
+	_, err = rd.ReadAt(make([]byte, 1), rd.Size())
+	require.ErrorIs(t, err, io.EOF)
+
+	// the data is also a valid zstd stream (the seek table is skipped).
+	dec, err := zstd.NewReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	defer dec.Close()
+	got, err = io.ReadAll(dec)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestSidecar(t *testing.T) {
+	data := newTestData(10_000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 1000)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the same frames, without the seek table at the end.
+	table := w.SeekTable()
+	sidecar, err := table.MarshalBinary()
+	require.NoError(t, err)
+	frames := buf.Bytes()[:table.CompressedSize()]
+	_, err = ReadSeekTable(bytes.NewReader(frames), int64(len(frames)))
+	require.ErrorIs(t, err, ErrNoSeekTable)
+
+	parsed := new(SeekTable)
+	require.NoError(t, parsed.UnmarshalBinary(sidecar))
+	require.Equal(t, table, parsed)
+
+	rd, err := NewReader(bytes.NewReader(frames), int64(len(frames)), parsed)
+	require.NoError(t, err)
+	defer rd.Close()
+	got := make([]byte, 2500)
+	_, err = rd.ReadAt(got, 3200)
+	require.NoError(t, err)
+	require.Equal(t, data[3200:5700], got)
+}
+
+func TestCorrupted(t *testing.T) {
+	data := newTestData(10_000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 1000)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	{
+		// wrong checksum.
+		table := *w.SeekTable()
+		table.Frames = append([]Frame(nil), table.Frames...)
+		table.Frames[3].Checksum++
+		frames := buf.Bytes()[:table.CompressedSize()]
+		rd, err := NewReader(bytes.NewReader(frames), int64(len(frames)), &table)
+		require.NoError(t, err)
+		defer rd.Close()
+		_, err = rd.ReadAt(make([]byte, 10), 3000)
+		require.Error(t, err)
+		_, err = rd.ReadAt(make([]byte, 10), 2000)
+		require.NoError(t, err)
+	}
+	{
+		// truncated.
+		truncated := buf.Bytes()[:buf.Len()-1]
+		_, err := Open(bytes.NewReader(truncated), int64(len(truncated)))
+		require.ErrorIs(t, err, ErrNoSeekTable)
+	}
+	{
+		// a frame is missing.
+		corrupted := append([]byte(nil), buf.Bytes()[:100]...)
+		corrupted = append(corrupted, buf.Bytes()[int(w.SeekTable().Frames[0].CompressedSize):]...)
+		_, err := Open(bytes.NewReader(corrupted), int64(len(corrupted)))
+		require.Error(t, err)
+	}
+}
+
+func TestScanFrames(t *testing.T) {
+	data := newTestData(10_000)
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 1000)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// the seek table at the end is skipped.
+	table, err := ScanFrames(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, w.SeekTable(), table)
+
+	// frames of another encoder (with the frame checksums and sizes in the headers).
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderCRC(true))
+	require.NoError(t, err)
+	defer enc.Close()
+	var concatenated []byte
+	for _, chunk := range [][]byte{data[:10], data[10:5000], bytes.Repeat([]byte{7}, 3000), data[5000:]} {
+		concatenated = enc.EncodeAll(chunk, concatenated)
+	}
+	table, err = ScanFrames(bytes.NewReader(concatenated))
+	require.NoError(t, err)
+	require.Len(t, table.Frames, 4)
+	require.Equal(t, int64(len(concatenated)), table.CompressedSize())
+	require.Equal(t, int64(len(data)+3000), table.DecompressedSize())
+
+	// truncated.
+	_, err = ScanFrames(bytes.NewReader(concatenated[:len(concatenated)-1]))
+	require.Error(t, err)
+}
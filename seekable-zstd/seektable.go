@@ -0,0 +1,195 @@
+// Package seekablezstd reads and writes zstd files in the seekable format
+// (https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md):
+// the data is compressed in independent frames, followed by a seek table (in a skippable frame)
+// with the compressed and decompressed size of each frame, so that any range of the
+// decompressed data can be read by decompressing only the frames that contain it.
+//
+// The seek table can also be stored in a sidecar file (with the same encoding), for the
+// files made of multiple frames that don't have it.
+package seekablezstd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// skippableMagic is the magic number of the skippable frame that contains the seek table.
+	skippableMagic = 0x184D2A5E
+	// seekableMagic is the magic number at the end of the seek table.
+	seekableMagic = 0x8F92EAB1
+	// footerSize is the size of the footer of the seek table:
+	// the number of frames, the descriptor and the magic number.
+	footerSize = 9
+	// skippableHeaderSize is the size of the header of the skippable frame: the magic number and the frame size.
+	skippableHeaderSize = 8
+
+	checksumFlag = 1 << 7
+	// reservedBits are the bits of the descriptor that must be zero.
+	reservedBits = 0x7c
+
+	// maxNumFrames bounds the size of the seek table that is read.
+	maxNumFrames = 1 << 27
+)
+
+// ErrNoSeekTable is returned when the data doesn't end with a seek table.
+var ErrNoSeekTable = errors.New("no seek table")
+
+// Frame is an entry of the seek table.
+type Frame struct {
+	CompressedSize   uint32
+	DecompressedSize uint32
+	// Checksum is the lower 32 bits of the XXH64 of the decompressed data, if the table has checksums.
+	Checksum uint32
+}
+
+// SeekTable is the list of the frames of a seekable zstd file.
+type SeekTable struct {
+	Frames       []Frame
+	HasChecksums bool
+}
+
+func entrySize(hasChecksums bool) int {
+	if hasChecksums {
+		return 12
+	}
+	return 8
+}
+
+func encodedSize(numFrames int, hasChecksums bool) int64 {
+	return skippableHeaderSize + int64(numFrames)*int64(entrySize(hasChecksums)) + footerSize
+}
+
+// EncodedSize returns the size of the seek table, including the header of its skippable frame.
+func (t *SeekTable) EncodedSize() int {
+	return int(encodedSize(len(t.Frames), t.HasChecksums))
+}
+
+// CompressedSize returns the total size of the frames (without the seek table).
+func (t *SeekTable) CompressedSize() int64 {
+	var size int64
+	for _, frame := range t.Frames {
+		size += int64(frame.CompressedSize)
+	}
+	return size
+}
+
+// DecompressedSize returns the total size of the decompressed data.
+func (t *SeekTable) DecompressedSize() int64 {
+	var size int64
+	for _, frame := range t.Frames {
+		size += int64(frame.DecompressedSize)
+	}
+	return size
+}
+
+// MarshalBinary encodes the seek table as a skippable frame.
+func (t *SeekTable) MarshalBinary() ([]byte, error) {
+	if len(t.Frames) > maxNumFrames {
+		return nil, fmt.Errorf("too many frames: %d", len(t.Frames))
+	}
+	buf := make([]byte, 0, t.EncodedSize())
+	buf = binary.LittleEndian.AppendUint32(buf, skippableMagic)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(t.EncodedSize()-skippableHeaderSize))
+	for _, frame := range t.Frames {
+		buf = binary.LittleEndian.AppendUint32(buf, frame.CompressedSize)
+		buf = binary.LittleEndian.AppendUint32(buf, frame.DecompressedSize)
+		if t.HasChecksums {
+			buf = binary.LittleEndian.AppendUint32(buf, frame.Checksum)
+		}
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.Frames)))
+	var descriptor byte
+	if t.HasChecksums {
+		descriptor |= checksumFlag
+	}
+	buf = append(buf, descriptor)
+	buf = binary.LittleEndian.AppendUint32(buf, seekableMagic)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a seek table encoded as a skippable frame (e.g. the content of a sidecar file).
+func (t *SeekTable) UnmarshalBinary(buf []byte) error {
+	if len(buf) < skippableHeaderSize+footerSize {
+		return fmt.Errorf("%w: %d bytes are too short", ErrNoSeekTable, len(buf))
+	}
+	numFrames, hasChecksums, err := parseFooter(buf[len(buf)-footerSize:])
+	if err != nil {
+		return err
+	}
+	if expected := encodedSize(int(numFrames), hasChecksums); int64(len(buf)) != expected {
+		return fmt.Errorf("seek table has %d bytes, expected %d for %d frames", len(buf), expected, numFrames)
+	}
+	if magic := binary.LittleEndian.Uint32(buf); magic != skippableMagic {
+		return fmt.Errorf("seek table has the wrong skippable magic number: %#x", magic)
+	}
+	if frameSize := binary.LittleEndian.Uint32(buf[4:]); int(frameSize) != len(buf)-skippableHeaderSize {
+		return fmt.Errorf("seek table has the wrong frame size: %d, expected %d", frameSize, len(buf)-skippableHeaderSize)
+	}
+	parsed := SeekTable{
+		Frames:       make([]Frame, numFrames),
+		HasChecksums: hasChecksums,
+	}
+	entries := buf[skippableHeaderSize:]
+	for i := range parsed.Frames {
+		entry := entries[i*entrySize(hasChecksums):]
+		parsed.Frames[i] = Frame{
+			CompressedSize:   binary.LittleEndian.Uint32(entry),
+			DecompressedSize: binary.LittleEndian.Uint32(entry[4:]),
+		}
+		if hasChecksums {
+			parsed.Frames[i].Checksum = binary.LittleEndian.Uint32(entry[8:])
+		}
+	}
+	*t = parsed
+	return nil
+}
+
+func parseFooter(footer []byte) (uint32, bool, error) {
+	if magic := binary.LittleEndian.Uint32(footer[5:]); magic != seekableMagic {
+		return 0, false, ErrNoSeekTable
+	}
+	numFrames := binary.LittleEndian.Uint32(footer)
+	if numFrames > maxNumFrames {
+		return 0, false, fmt.Errorf("seek table has too many frames: %d", numFrames)
+	}
+	descriptor := footer[4]
+	if descriptor&reservedBits != 0 {
+		return 0, false, fmt.Errorf("seek table has reserved bits set: %#x", descriptor)
+	}
+	return numFrames, descriptor&checksumFlag != 0, nil
+}
+
+// ReadSeekTable reads the seek table at the end of the data of the given size.
+// It returns ErrNoSeekTable if there's none.
+func ReadSeekTable(r io.ReaderAt, size int64) (*SeekTable, error) {
+	if size < skippableHeaderSize+footerSize {
+		return nil, fmt.Errorf("%w: %d bytes are too short", ErrNoSeekTable, size)
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return nil, fmt.Errorf("failed to read the seek table footer: %w", err)
+	}
+	numFrames, hasChecksums, err := parseFooter(footer)
+	if err != nil {
+		return nil, err
+	}
+	tableSize := encodedSize(int(numFrames), hasChecksums)
+	if tableSize > size {
+		return nil, fmt.Errorf("seek table of %d frames is larger than the data (%d bytes)", numFrames, size)
+	}
+	buf := make([]byte, tableSize)
+	if _, err := r.ReadAt(buf, size-tableSize); err != nil {
+		return nil, fmt.Errorf("failed to read the seek table: %w", err)
+	}
+	table := new(SeekTable)
+	if err := table.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if compressedSize := table.CompressedSize() + tableSize; compressedSize != size {
+		return nil, fmt.Errorf("the frames of the seek table add up to %d bytes, but the data has %d bytes", compressedSize, size)
+	}
+	return table, nil
+}
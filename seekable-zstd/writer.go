@@ -0,0 +1,104 @@
+package seekablezstd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultFrameSize is the default size of the decompressed data of each frame:
+// the smaller the frames, the less data is decompressed for a read, but the worse the compression ratio.
+const DefaultFrameSize = 1 << 20
+
+// Writer compresses the data in frames of a fixed (decompressed) size, and writes the seek table on Close.
+type Writer struct {
+	w         io.Writer
+	encoder   *zstd.Encoder
+	frameSize int
+	buf       []byte
+	table     SeekTable
+	closed    bool
+}
+
+// NewWriter returns a writer that compresses the data to w, in frames of frameSize bytes
+// (DefaultFrameSize if zero or less).
+func NewWriter(w io.Writer, frameSize int, opts ...zstd.EOption) (*Writer, error) {
+	if frameSize <= 0 {
+		frameSize = DefaultFrameSize
+	}
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	return &Writer{
+		w:         w,
+		encoder:   encoder,
+		frameSize: frameSize,
+		buf:       make([]byte, 0, frameSize),
+		table:     SeekTable{HasChecksums: true},
+	}, nil
+}
+
+func (wr *Writer) Write(p []byte) (int, error) {
+	if wr.closed {
+		return 0, fmt.Errorf("writer is closed")
+	}
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if free := wr.frameSize - len(wr.buf); len(chunk) > free {
+			chunk = chunk[:free]
+		}
+		wr.buf = append(wr.buf, chunk...)
+		n += len(chunk)
+		p = p[len(chunk):]
+		if len(wr.buf) == wr.frameSize {
+			if err := wr.flushFrame(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (wr *Writer) flushFrame() error {
+	if len(wr.buf) == 0 {
+		return nil
+	}
+	compressed := wr.encoder.EncodeAll(wr.buf, nil)
+	if _, err := wr.w.Write(compressed); err != nil {
+		return err
+	}
+	wr.table.Frames = append(wr.table.Frames, Frame{
+		CompressedSize:   uint32(len(compressed)),
+		DecompressedSize: uint32(len(wr.buf)),
+		Checksum:         uint32(xxhash.Sum64(wr.buf)),
+	})
+	wr.buf = wr.buf[:0]
+	return nil
+}
+
+// SeekTable returns the seek table of the frames written so far.
+func (wr *Writer) SeekTable() *SeekTable {
+	return &wr.table
+}
+
+// Close writes the last frame and the seek table; it doesn't close the underlying writer.
+func (wr *Writer) Close() error {
+	if wr.closed {
+		return nil
+	}
+	wr.closed = true
+	defer wr.encoder.Close()
+	if err := wr.flushFrame(); err != nil {
+		return err
+	}
+	table, err := wr.table.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = wr.w.Write(table)
+	return err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	"k8s.io/klog/v2"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// maxBase58SignatureLength is the max length of a base58-encoded signature.
+const maxBase58SignatureLength = 88
+
+// sigPrefixMatcher matches the signatures whose base58 encoding starts with a prefix
+// (e.g. a truncated signature from a user report).
+//
+// The indexes only have hashes of the signatures, so the signatures must be scanned; to make that cheap,
+// the prefix is turned into the candidate buckets, i.e. the possible values of the first 2 bytes
+// of the signatures (like the buckets of the sig-exists index), and only the signatures
+// in these buckets are base58-encoded and compared.
+type sigPrefixMatcher struct {
+	prefix        string
+	buckets       [1 << 16]bool
+	numCandidates int
+}
+
+func newSigPrefixMatcher(prefix string) (*sigPrefixMatcher, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("prefix is empty")
+	}
+	if len(prefix) > maxBase58SignatureLength {
+		return nil, fmt.Errorf("prefix is longer than a signature (%d > %d characters)", len(prefix), maxBase58SignatureLength)
+	}
+	for _, r := range prefix {
+		if !strings.ContainsRune(base58Alphabet, r) {
+			return nil, fmt.Errorf("prefix has a character that is not base58: %q", r)
+		}
+	}
+	m := &sigPrefixMatcher{prefix: prefix}
+	for _, bucketRange := range candidateBucketRanges(prefix) {
+		for bucket := bucketRange[0]; bucket <= bucketRange[1]; bucket++ {
+			if !m.buckets[bucket] {
+				m.buckets[bucket] = true
+				m.numCandidates++
+			}
+		}
+	}
+	return m, nil
+}
+
+// candidateBucketRanges returns the ranges (inclusive) of the first 2 bytes of the signatures
+// whose base58 encoding starts with the prefix.
+//
+// A signature with z leading zero bytes is encoded as z '1's followed by the base58 digits
+// of its value N (that don't start with a '1'); so, for a prefix with k leading '1's followed by r
+// (of length m), the signatures have exactly k leading zero bytes (if r isn't empty), and N is in
+// [r*58^j, (r+1)*58^j) for one of the possible numbers j of remaining digits.
+func candidateBucketRanges(prefix string) [][2]int {
+	k := len(prefix) - len(strings.TrimLeft(prefix, "1"))
+	if k > solana.SignatureLength {
+		return nil
+	}
+	shift := uint((solana.SignatureLength - 2) * 8)
+	// the values of the signatures with at least k leading zero bytes.
+	maxValue := new(big.Int).Lsh(big.NewInt(1), uint((solana.SignatureLength-k)*8))
+	rest := prefix[k:]
+	if rest == "" {
+		// any signature with (at least) k leading zero bytes.
+		return [][2]int{{0, int(new(big.Int).Rsh(new(big.Int).Sub(maxValue, big.NewInt(1)), shift).Int64())}}
+	}
+	r := new(big.Int)
+	for _, c := range rest {
+		r.Mul(r, big.NewInt(58))
+		r.Add(r, big.NewInt(int64(strings.IndexRune(base58Alphabet, c))))
+	}
+	var out [][2]int
+	lo := new(big.Int).Set(r)
+	hi := new(big.Int).Add(r, big.NewInt(1))
+	for j := 0; len(prefix)+j <= maxBase58SignatureLength && lo.Cmp(maxValue) < 0; j++ {
+		// N in [lo, min(hi, maxValue)).
+		last := new(big.Int).Sub(hi, big.NewInt(1))
+		if last.Cmp(maxValue) >= 0 {
+			last.Sub(maxValue, big.NewInt(1))
+		}
+		out = append(out, [2]int{
+			int(new(big.Int).Rsh(lo, shift).Int64()),
+			int(new(big.Int).Rsh(last, shift).Int64()),
+		})
+		lo.Mul(lo, big.NewInt(58))
+		hi.Mul(hi, big.NewInt(58))
+	}
+	return out
+}
+
+// NumCandidateBuckets returns the number of candidate buckets (out of 65536).
+func (m *sigPrefixMatcher) NumCandidateBuckets() int {
+	return m.numCandidates
+}
+
+// Match returns true if the base58 encoding of the signature starts with the prefix.
+func (m *sigPrefixMatcher) Match(sig solana.Signature) bool {
+	if !m.buckets[int(sig[0])<<8|int(sig[1])] {
+		return false
+	}
+	return strings.HasPrefix(sig.String(), m.prefix)
+}
+
+// sigPrefixMatch is a transaction whose signature matches a prefix.
+type sigPrefixMatch struct {
+	Signature solana.Signature
+	Slot      uint64
+	Cid       cid.Cid
+}
+
+// FindSignaturesByPrefix scans the transactions of the blocks in the slot range, and calls fn
+// for each one whose (first) signature matches; it returns the number of transactions scanned.
+func (ser *Epoch) FindSignaturesByPrefix(
+	ctx context.Context,
+	matcher *sigPrefixMatcher,
+	firstSlot uint64,
+	lastSlot uint64,
+	fn func(sigPrefixMatch) error,
+) (uint64, error) {
+	it, err := ser.NewBlockIterator(ctx, firstSlot, lastSlot)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create block iterator: %w", err)
+	}
+	defer it.Close()
+	var numScanned uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return numScanned, err
+		}
+		block, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return numScanned, nil
+		}
+		if err != nil {
+			return numScanned, fmt.Errorf("failed to read block: %w", err)
+		}
+		for _, obj := range block.Objects {
+			kind, err := iplddecoders.GetKind(obj.Data)
+			if err != nil || kind != iplddecoders.KindTransaction {
+				continue
+			}
+			tx, err := iplddecoders.DecodeTransaction(obj.Data)
+			if err != nil {
+				return numScanned, fmt.Errorf("failed to decode transaction %s: %w", obj.Cid, err)
+			}
+			numScanned++
+			// the first signature is at the start of the data, so the first frame is enough.
+			sig, _, err := parseRawTransactionHeader(tx.Data.Bytes())
+			if err != nil {
+				klog.V(2).Infof("Skipping transaction %s of slot %d: %s", obj.Cid, tx.Slot, err)
+				continue
+			}
+			if !matcher.Match(sig) {
+				continue
+			}
+			if err := fn(sigPrefixMatch{Signature: sig, Slot: uint64(tx.Slot), Cid: obj.Cid}); err != nil {
+				return numScanned, err
+			}
+		}
+	}
+}
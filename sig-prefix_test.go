@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigPrefixMatcher(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sigs := make([]solana.Signature, 200)
+	for i := range sigs {
+		rng.Read(sigs[i][:])
+		if i%10 == 0 {
+			// with leading zero bytes (encoded as '1's).
+			copy(sigs[i][:], make([]byte, 1+i%3))
+		}
+	}
+	for _, sig := range sigs {
+		encoded := sig.String()
+		for _, length := range []int{1, 2, 3, 5, 8, 20, len(encoded)} {
+			prefix := encoded[:length]
+			matcher, err := newSigPrefixMatcher(prefix)
+			require.NoError(t, err)
+			require.True(t, matcher.Match(sig), "prefix %q of %s", prefix, encoded)
+			if length >= 8 && !strings.HasPrefix(prefix, "1") {
+				// a long prefix leaves very few candidate buckets.
+				require.LessOrEqual(t, matcher.NumCandidateBuckets(), 4, prefix)
+			}
+			for _, other := range sigs[:20] {
+				require.Equal(t, strings.HasPrefix(other.String(), prefix), matcher.Match(other))
+			}
+		}
+	}
+	{
+		matcher, err := newSigPrefixMatcher("1")
+		require.NoError(t, err)
+		require.Equal(t, 256, matcher.NumCandidateBuckets())
+	}
+	{
+		_, err := newSigPrefixMatcher("")
+		require.Error(t, err)
+		_, err = newSigPrefixMatcher("abc0")
+		require.Error(t, err)
+		_, err = newSigPrefixMatcher(strings.Repeat("a", 89))
+		require.Error(t, err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+	"k8s.io/klog/v2"
+)
+
+// requestTimings collects the duration of the phases of a request.
+type requestTimings struct {
+	mu     sync.Mutex
+	phases []PhaseTiming
+}
+
+type PhaseTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"durationNs"`
+}
+
+func (t *requestTimings) add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, PhaseTiming{Name: name, Duration: d})
+}
+
+func (t *requestTimings) get() []PhaseTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]PhaseTiming(nil), t.phases...)
+}
+
+const requestTimingsKey = MyContextKey("requestTimings")
+
+func setRequestTimingsToContext(ctx context.Context, timings *requestTimings) context.Context {
+	return context.WithValue(ctx, requestTimingsKey, timings)
+}
+
+func getRequestTimingsFromContext(ctx context.Context) *requestTimings {
+	timings, _ := ctx.Value(requestTimingsKey).(*requestTimings)
+	return timings
+}
+
+// traceIDFromRequest returns the trace ID of the request: the one from the W3C traceparent header
+// if present and valid, or else a new random one. The request ID is not used, as a client-provided
+// one can be too long for an exemplar.
+func traceIDFromRequest(reqCtx *fasthttp.RequestCtx) string {
+	// traceparent: {version}-{trace-id}-{parent-id}-{flags}
+	parts := strings.Split(string(reqCtx.Request.Header.Peek("traceparent")), "-")
+	if len(parts) == 4 && isValidTraceID(parts[1]) {
+		return parts[1]
+	}
+	return randomTraceID()
+}
+
+// randomTraceID returns a new random trace ID, in the format of the W3C trace-ids.
+func randomTraceID() string {
+	id := uuid.New()
+	return hex.EncodeToString(id[:])
+}
+
+// isValidTraceID returns true if the ID is a valid W3C trace-id: 32 lowercase hex chars,
+// not all zeros.
+func isValidTraceID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	allZeros := true
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f':
+			allZeros = false
+		default:
+			return false
+		}
+	}
+	return !allZeros
+}
+
+// traceIDExemplarLabel is the name of the exemplar label with the trace ID.
+const traceIDExemplarLabel = "trace_id"
+
+// observeWithTraceID observes the value, attaching the trace ID as an exemplar; the value is
+// observed without it if the trace ID is not a valid exemplar label (ObserveWithExemplar panics).
+func observeWithTraceID(observer prometheus.Observer, value float64, traceID string) {
+	if eo, ok := observer.(prometheus.ExemplarObserver); ok && isValidExemplarValue(traceID) {
+		eo.ObserveWithExemplar(value, prometheus.Labels{traceIDExemplarLabel: traceID})
+		return
+	}
+	observer.Observe(value)
+}
+
+// isValidExemplarValue returns true if the value of the trace ID label is accepted in an exemplar.
+func isValidExemplarValue(traceID string) bool {
+	return traceID != "" &&
+		utf8.ValidString(traceID) &&
+		utf8.RuneCountInString(traceIDExemplarLabel)+utf8.RuneCountInString(traceID) <= prometheus.ExemplarMaxRunes
+}
+
+// SlowQueryLog records the requests that took longer than a threshold,
+// with the timing of their phases, as JSON lines.
+type SlowQueryLog struct {
+	threshold time.Duration
+	mu        sync.Mutex
+	out       io.WriteCloser
+}
+
+type SlowQueryEntry struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"requestId"`
+	TraceID   string        `json:"traceId"`
+	Method    string        `json:"method"`
+	Params    string        `json:"params,omitempty"`
+	Duration  time.Duration `json:"durationNs"`
+	Status    int           `json:"status"`
+	Phases    []PhaseTiming `json:"phases,omitempty"`
+	// Reads is what the request touched, compared with the size of its response.
+	Reads *ReadAmplificationReport `json:"reads,omitempty"`
+}
+
+// maxSlowQueryParamsSize is the max size of the params written to the slow-query log.
+const maxSlowQueryParamsSize = 1024
+
+// NewSlowQueryLog creates a slow-query log that appends to the file at the given path
+// (or writes to the logs if the path is empty).
+func NewSlowQueryLog(threshold time.Duration, path string) (*SlowQueryLog, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("slow-query threshold must be positive")
+	}
+	sql := &SlowQueryLog{
+		threshold: threshold,
+	}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open slow-query log: %w", err)
+		}
+		sql.out = file
+	}
+	return sql, nil
+}
+
+// IsSlow returns true if a request with the given duration must be recorded.
+func (l *SlowQueryLog) IsSlow(d time.Duration) bool {
+	return d >= l.threshold
+}
+
+func (l *SlowQueryLog) Write(entry *SlowQueryEntry) error {
+	if len(entry.Params) > maxSlowQueryParamsSize {
+		entry.Params = entry.Params[:maxSlowQueryParamsSize] + "..."
+	}
+	line, err := fasterJson.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if l.out == nil {
+		klog.Warningf("[%s] slow request: %s", entry.RequestID, line)
+		return nil
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(line)
+	return err
+}
+
+func (l *SlowQueryLog) Close() error {
+	if l.out == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTraceIDFromRequest(t *testing.T) {
+	reqCtx := &fasthttp.RequestCtx{}
+	generated := traceIDFromRequest(reqCtx)
+	require.True(t, isValidTraceID(generated), generated)
+	require.NotEqual(t, generated, traceIDFromRequest(reqCtx))
+
+	reqCtx.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceIDFromRequest(reqCtx))
+
+	reqCtx.Request.Header.Set("traceparent", "garbage")
+	require.True(t, isValidTraceID(traceIDFromRequest(reqCtx)))
+
+	for _, invalid := range []string{
+		// not UTF-8.
+		"00-\xff\xfe" + strings.Repeat("a", 30) + "-00f067aa0ba902b7-01",
+		// too long.
+		"00-" + strings.Repeat("a", 200) + "-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+		"00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01",
+	} {
+		reqCtx.Request.Header.Set("traceparent", invalid)
+		traceID := traceIDFromRequest(reqCtx)
+		require.True(t, isValidTraceID(traceID), invalid)
+		require.NotContains(t, invalid, traceID)
+	}
+}
+
+func TestObserveWithTraceID(t *testing.T) {
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test", Buckets: []float64{1}})
+	// labels that ObserveWithExemplar panics on are not attached.
+	observeWithTraceID(histogram, 0.5, "\xff\xfe")
+	observeWithTraceID(histogram, 0.5, strings.Repeat("a", prometheus.ExemplarMaxRunes))
+	observeWithTraceID(histogram, 0.5, "")
+	var m dto.Metric
+	require.NoError(t, histogram.Write(&m))
+	require.Equal(t, uint64(3), m.GetHistogram().GetSampleCount())
+	require.Nil(t, m.GetHistogram().GetBucket()[0].GetExemplar())
+
+	observeWithTraceID(histogram, 0.5, "4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, histogram.Write(&m))
+	require.Equal(t, uint64(4), m.GetHistogram().GetSampleCount())
+	exemplar := m.GetHistogram().GetBucket()[0].GetExemplar()
+	require.NotNil(t, exemplar)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", exemplar.GetLabel()[0].GetValue())
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	_, err := NewSlowQueryLog(0, "")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "slow.jsonl")
+	slowLog, err := NewSlowQueryLog(time.Second, path)
+	require.NoError(t, err)
+	require.False(t, slowLog.IsSlow(time.Millisecond))
+	require.True(t, slowLog.IsSlow(time.Second))
+
+	timings := &requestTimings{}
+	tim := newTimer(setRequestTimingsToContext(setRequestIDToContext(context.Background(), "req-1"), timings))
+	tim.time("first")
+	tim.time("second")
+
+	params := make([]byte, maxSlowQueryParamsSize*2)
+	for i := range params {
+		params[i] = 'a'
+	}
+	require.NoError(t, slowLog.Write(&SlowQueryEntry{
+		RequestID: "req-1",
+		Method:    "getBlock",
+		Params:    string(params),
+		Duration:  2 * time.Second,
+		Phases:    timings.get(),
+	}))
+	require.NoError(t, slowLog.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	require.True(t, scanner.Scan())
+	var entry SlowQueryEntry
+	require.NoError(t, fasterJson.Unmarshal(scanner.Bytes(), &entry))
+	require.Equal(t, "req-1", entry.RequestID)
+	require.Equal(t, 2*time.Second, entry.Duration)
+	require.Len(t, entry.Phases, 2)
+	require.Equal(t, "first", entry.Phases[0].Name)
+	require.Equal(t, "second", entry.Phases[1].Name)
+	require.Len(t, entry.Params, maxSlowQueryParamsSize+len("..."))
+}
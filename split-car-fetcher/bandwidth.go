@@ -0,0 +1,256 @@
+package splitcarfetcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrafficClass is the kind of remote traffic, for the bandwidth limits.
+type TrafficClass int
+
+const (
+	// TrafficRead is the range reads of the remote files, to serve requests.
+	TrafficRead TrafficClass = iota
+	// TrafficDownload is the bulk transfers (downloads of files, streaming of whole CARs)
+	// that run in the background of the serving traffic.
+	TrafficDownload
+)
+
+// DefaultBandwidth is the bandwidth limits of the remote traffic of the process (unlimited by default).
+var DefaultBandwidth = NewBandwidthLimits()
+
+// BandwidthLimits caps the bandwidth of the remote traffic: globally, per source (host), and
+// for the downloads, whose cap can be lifted during an off-peak window. A limit of 0 is no limit.
+type BandwidthLimits struct {
+	mu            sync.Mutex
+	global        *rateLimiter
+	perSourceRate int64
+	perSource     map[string]*rateLimiter
+	downloads     *rateLimiter
+	offPeak       *OffPeakWindow
+	now           func() time.Time
+}
+
+func NewBandwidthLimits() *BandwidthLimits {
+	return &BandwidthLimits{
+		perSource: make(map[string]*rateLimiter),
+		now:       time.Now,
+	}
+}
+
+// SetGlobal caps the bandwidth of all the remote traffic, in bytes per second.
+func (b *BandwidthLimits) SetGlobal(bytesPerSecond int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.global = newRateLimiter(bytesPerSecond, b.now)
+}
+
+// SetPerSource caps the bandwidth of the remote traffic to each host, in bytes per second.
+func (b *BandwidthLimits) SetPerSource(bytesPerSecond int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.perSourceRate = bytesPerSecond
+	b.perSource = make(map[string]*rateLimiter)
+}
+
+// SetDownloads caps the bandwidth of the downloads, in bytes per second (outside of the off-peak window, if any).
+func (b *BandwidthLimits) SetDownloads(bytesPerSecond int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.downloads = newRateLimiter(bytesPerSecond, b.now)
+}
+
+// SetOffPeak sets the daily window during which the downloads are not capped (beyond the global
+// and per-source caps); nil removes it.
+func (b *BandwidthLimits) SetOffPeak(window *OffPeakWindow) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.offPeak = window
+}
+
+// limitersFor returns the limiters that apply to the traffic of the class to the source.
+func (b *BandwidthLimits) limitersFor(source string, class TrafficClass) []*rateLimiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []*rateLimiter
+	if b.global != nil {
+		out = append(out, b.global)
+	}
+	if b.perSourceRate > 0 {
+		limiter, ok := b.perSource[source]
+		if !ok {
+			limiter = newRateLimiter(b.perSourceRate, b.now)
+			b.perSource[source] = limiter
+		}
+		out = append(out, limiter)
+	}
+	if class == TrafficDownload && b.downloads != nil && !b.offPeak.Contains(b.now()) {
+		out = append(out, b.downloads)
+	}
+	return out
+}
+
+// Wait waits until n bytes of traffic of the class from the source (a URL or a host) fit in the limits.
+func (b *BandwidthLimits) Wait(ctx context.Context, source string, class TrafficClass, n int) error {
+	var wait time.Duration
+	for _, limiter := range b.limitersFor(sourceHost(source), class) {
+		if d := limiter.reserve(n); d > wait {
+			wait = d
+		}
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader returns a reader of r that is paced by the limits of the traffic of the class from the source.
+func (b *BandwidthLimits) Reader(ctx context.Context, source string, class TrafficClass, r io.Reader) io.Reader {
+	return &limitedReader{ctx: ctx, limits: b, source: source, class: class, r: r}
+}
+
+// ReadCloser is Reader for an io.ReadCloser (e.g. the body of an HTTP response).
+func (b *BandwidthLimits) ReadCloser(ctx context.Context, source string, class TrafficClass, rc io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{b.Reader(ctx, source, class, rc), rc}
+}
+
+// limitedReadChunk is the largest read of a limited reader, so that the traffic is paced smoothly.
+const limitedReadChunk = 64 * 1024
+
+type limitedReader struct {
+	ctx    context.Context
+	limits *BandwidthLimits
+	source string
+	class  TrafficClass
+	r      io.Reader
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedReadChunk {
+		p = p[:limitedReadChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limits.Wait(r.ctx, r.source, r.class, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// sourceHost returns the host of the URL (or the source itself, if it's not a URL).
+func sourceHost(source string) string {
+	if parsed, err := url.Parse(source); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return source
+}
+
+// rateLimiter is a token bucket of bytes, with a burst of one second of traffic; a reservation
+// beyond the available tokens is granted in advance, and the reserver waits for it.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// newRateLimiter returns a limiter of the given rate, or nil for no limit.
+func newRateLimiter(bytesPerSecond int64, now func() time.Time) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// reserve takes n bytes from the bucket, and returns how long to wait before using them.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// OffPeakWindow is a daily window of local time, e.g. 01:00-06:00 (it can span midnight, e.g. 22:00-06:00).
+type OffPeakWindow struct {
+	Start time.Duration // since midnight.
+	End   time.Duration // since midnight.
+}
+
+// ParseOffPeakWindow parses a window formatted as HH:MM-HH:MM.
+func ParseOffPeakWindow(s string) (*OffPeakWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid off-peak window %q: expected HH:MM-HH:MM", s)
+	}
+	var window OffPeakWindow
+	for _, part := range []struct {
+		dst *time.Duration
+		src string
+	}{
+		{&window.Start, start},
+		{&window.End, end},
+	} {
+		parsed, err := time.Parse("15:04", strings.TrimSpace(part.src))
+		if err != nil {
+			return nil, fmt.Errorf("invalid off-peak window %q: expected HH:MM-HH:MM", s)
+		}
+		*part.dst = time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute
+	}
+	if window.Start == window.End {
+		return nil, fmt.Errorf("invalid off-peak window %q: it's empty", s)
+	}
+	return &window, nil
+}
+
+// Contains returns true if the time is in the window (false for a nil window).
+func (w *OffPeakWindow) Contains(t time.Time) bool {
+	if w == nil {
+		return false
+	}
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	return sinceMidnight >= w.Start || sinceMidnight < w.End
+}
+
+func (w *OffPeakWindow) String() string {
+	if w == nil {
+		return ""
+	}
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(w.Start) + "-" + format(w.End)
+}
@@ -0,0 +1,119 @@
+package splitcarfetcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(1000, func() time.Time { return now })
+	// the burst is one second of traffic.
+	if wait := limiter.reserve(1000); wait != 0 {
+		t.Fatalf("expected no wait, got %s", wait)
+	}
+	if wait := limiter.reserve(500); wait != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, got %s", wait)
+	}
+	now = now.Add(time.Second)
+	if wait := limiter.reserve(500); wait != 0 {
+		t.Fatalf("expected no wait, got %s", wait)
+	}
+	if newRateLimiter(0, time.Now) != nil {
+		t.Fatal("expected no limiter for a rate of 0")
+	}
+}
+
+func TestBandwidthLimitsLimiters(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	limits := NewBandwidthLimits()
+	limits.now = func() time.Time { return now }
+	if got := limits.limitersFor("a", TrafficDownload); len(got) != 0 {
+		t.Fatalf("expected no limits, got %d", len(got))
+	}
+	limits.SetGlobal(1000)
+	limits.SetPerSource(100)
+	limits.SetDownloads(10)
+	if got := limits.limitersFor("a", TrafficRead); len(got) != 2 {
+		t.Fatalf("expected the global and per-source limits for a read, got %d", len(got))
+	}
+	if got := limits.limitersFor("a", TrafficDownload); len(got) != 3 {
+		t.Fatalf("expected 3 limits for a download, got %d", len(got))
+	}
+	if limits.limitersFor("a", TrafficRead)[1] == limits.limitersFor("b", TrafficRead)[1] {
+		t.Fatal("expected a limiter per source")
+	}
+	window, err := ParseOffPeakWindow("11:00-13:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits.SetOffPeak(window)
+	if got := limits.limitersFor("a", TrafficDownload); len(got) != 2 {
+		t.Fatalf("expected no download limit during the off-peak window, got %d limits", len(got))
+	}
+}
+
+func TestOffPeakWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+	window, err := ParseOffPeakWindow("22:00-06:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window.String() != "22:00-06:30" {
+		t.Fatalf("unexpected window %s", window)
+	}
+	for _, tc := range []struct {
+		at       time.Time
+		expected bool
+	}{
+		{at(21, 59), false},
+		{at(22, 0), true},
+		{at(3, 0), true},
+		{at(6, 29), true},
+		{at(6, 30), false},
+		{at(12, 0), false},
+	} {
+		if got := window.Contains(tc.at); got != tc.expected {
+			t.Errorf("Contains(%s) = %v, expected %v", tc.at.Format("15:04"), got, tc.expected)
+		}
+	}
+	var none *OffPeakWindow
+	if none.Contains(at(3, 0)) {
+		t.Fatal("expected a nil window to contain nothing")
+	}
+	for _, invalid := range []string{"", "22:00", "25:00-01:00", "01:00-01:00"} {
+		if _, err := ParseOffPeakWindow(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestBandwidthLimitsReader(t *testing.T) {
+	limits := NewBandwidthLimits()
+	limits.SetGlobal(1 << 20)
+	data := bytes.Repeat([]byte("x"), 3<<19)
+	startedAt := time.Now()
+	got, err := io.ReadAll(limits.Reader(context.Background(), "https://example.com/a.car", TrafficRead, bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("unexpected data")
+	}
+	// 1.5 MiB at 1 MiB/s, with a burst of 1 MiB.
+	if took := time.Since(startedAt); took < 400*time.Millisecond {
+		t.Fatalf("expected the read to be paced, took %s", took)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = io.ReadAll(limits.Reader(ctx, "https://example.com/a.car", TrafficRead, bytes.NewReader(data)))
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -130,7 +130,7 @@ func remoteReadAt(client *http.Client, url string, p []byte, off int64) (n int,
 	}
 	defer resp.Body.Close()
 	{
-		n, err := io.ReadFull(resp.Body, p)
+		n, err := io.ReadFull(DefaultBandwidth.Reader(context.Background(), url, TrafficRead, resp.Body), p)
 		if err != nil {
 			return 0, err
 		}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"strings"
@@ -10,8 +9,9 @@ import (
 	"github.com/gagliardetto/solana-go"
 	"github.com/ipfs/go-cid"
 	carv2 "github.com/ipld/go-car/v2"
-	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/rpcpool/yellowstone-faithful/dataframe"
 	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/logging"
 	solanatxmetaparsers "github.com/rpcpool/yellowstone-faithful/solana-tx-meta-parsers"
 	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
 	"golang.org/x/exp/mmap"
@@ -61,6 +61,14 @@ func openIndexStorage(
 
 func openCarStorage(ctx context.Context, where string) (*carv2.Reader, ReaderAtCloser, error) {
 	where = strings.TrimSpace(where)
+	if isZstdCarPath(where) {
+		// the decompressed CAR is read at the offsets of the indexes, like a remote CAR.
+		rd, err := openZstdCarStorage(ctx, where)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, rd, nil
+	}
 	if strings.HasPrefix(where, "http://") || strings.HasPrefix(where, "https://") {
 		klog.Infof("opening CAR file from %q as HTTP remote file", where)
 		rem, size, err := splitcarfetcher.NewRemoteHTTPFileAsIoReaderAt(ctx, where)
@@ -103,13 +111,16 @@ func readNodeFromReaderAtWithOffsetAndSize(reader ReaderAtCloser, wantedCid cid.
 }
 
 type GetBlockResponse struct {
-	BlockHeight       *uint64                  `json:"blockHeight"`
-	BlockTime         *uint64                  `json:"blockTime"`
-	Blockhash         string                   `json:"blockhash"`
-	ParentSlot        uint64                   `json:"parentSlot"`
-	PreviousBlockhash *string                  `json:"previousBlockhash"`
-	Rewards           any                      `json:"rewards"` // TODO: use same format as solana
-	Transactions      []GetTransactionResponse `json:"transactions"`
+	BlockHeight       *uint64 `json:"blockHeight"`
+	BlockTime         *uint64 `json:"blockTime"`
+	Blockhash         string  `json:"blockhash"`
+	ParentSlot        uint64  `json:"parentSlot"`
+	PreviousBlockhash *string `json:"previousBlockhash"`
+	// Leader (faithful extension) is the identity of the leader of the slot, from the leader
+	// schedule sidecar of the epoch.
+	Leader       *string                  `json:"leader,omitempty"`
+	Rewards      any                      `json:"rewards"` // TODO: use same format as solana
+	Transactions []GetTransactionResponse `json:"transactions"`
 }
 
 type GetTransactionResponse struct {
@@ -121,92 +132,132 @@ type GetTransactionResponse struct {
 	Version     any                `json:"version"`
 	Position    uint64             `json:"-"` // TODO: enable this
 	Signatures  []solana.Signature `json:"-"` // TODO: enable this
+	// metaResponse is the protobuf meta, mapped directly (see mapMetaDirectly).
+	metaResponse map[string]any
 }
 
+// loadDataFromDataFrames returns the data of the DataFrames that start with the given one (see package dataframe).
 func loadDataFromDataFrames(
+	ctx context.Context,
 	firstDataFrame *ipldbindcode.DataFrame,
 	dataFrameGetter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error),
 ) ([]byte, error) {
-	dataBuffer := new(bytes.Buffer)
-	allFrames, err := getAllFramesFromDataFrame(firstDataFrame, dataFrameGetter)
-	if err != nil {
-		return nil, err
-	}
-	for _, frame := range allFrames {
-		dataBuffer.Write(frame.Bytes())
-	}
-	// verify the data hash (if present)
-	bufHash, ok := firstDataFrame.GetHash()
-	if !ok {
-		return dataBuffer.Bytes(), nil
-	}
-	err = ipldbindcode.VerifyHash(dataBuffer.Bytes(), bufHash)
-	if err != nil {
-		return nil, err
-	}
-	return dataBuffer.Bytes(), nil
-}
-
-func getAllFramesFromDataFrame(
-	firstDataFrame *ipldbindcode.DataFrame,
-	dataFrameGetter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error),
-) ([]*ipldbindcode.DataFrame, error) {
-	frames := []*ipldbindcode.DataFrame{firstDataFrame}
-	// get the next data frames
-	next, ok := firstDataFrame.GetNext()
-	if !ok || len(next) == 0 {
-		return frames, nil
-	}
-	for _, cid := range next {
-		nextDataFrame, err := dataFrameGetter(context.Background(), cid.(cidlink.Link).Cid)
-		if err != nil {
-			return nil, err
-		}
-		nextFrames, err := getAllFramesFromDataFrame(nextDataFrame, dataFrameGetter)
-		if err != nil {
-			return nil, err
-		}
-		frames = append(frames, nextFrames...)
-	}
-	return frames, nil
+	return dataframe.Load(ctx, firstDataFrame, dataFrameGetter)
 }
 
 func parseTransactionAndMetaFromNode(
+	ctx context.Context,
 	transactionNode *ipldbindcode.Transaction,
 	dataFrameGetter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error),
 ) (tx solana.Transaction, meta any, _ error) {
 	{
-		transactionBuffer, err := loadDataFromDataFrames(&transactionNode.Data, dataFrameGetter)
+		transactionBuffer, err := loadDataFromDataFrames(ctx, &transactionNode.Data, dataFrameGetter)
 		if err != nil {
 			return solana.Transaction{}, nil, err
 		}
 		if err := bin.UnmarshalBin(&tx, transactionBuffer); err != nil {
-			klog.Errorf("failed to unmarshal transaction: %v", err)
+			storageLog.Error("failed to unmarshal transaction", logging.Err(err))
 			return solana.Transaction{}, nil, err
 		} else if len(tx.Signatures) == 0 {
-			klog.Errorf("transaction has no signatures")
-			return solana.Transaction{}, nil, err
+			storageLog.Error("transaction has no signatures")
+			return solana.Transaction{}, nil, fmt.Errorf("transaction has no signatures")
 		}
 	}
 
-	{
-		metaBuffer, err := loadDataFromDataFrames(&transactionNode.Metadata, dataFrameGetter)
-		if err != nil {
-			return solana.Transaction{}, nil, err
+	meta, err := parseTransactionMetaFromNode(ctx, transactionNode, dataFrameGetter, tx.Signatures[0])
+	if err != nil {
+		return solana.Transaction{}, nil, err
+	}
+	return tx, meta, nil
+}
+
+// parseRawTransactionAndMetaFromNode is like parseTransactionAndMetaFromNode, but returns the transaction
+// as it is stored in the node (i.e. in its wire format) without decoding it: the binary encodings
+// can use these bytes directly, instead of decoding the transaction and encoding it back to the same bytes.
+func parseRawTransactionAndMetaFromNode(
+	ctx context.Context,
+	transactionNode *ipldbindcode.Transaction,
+	dataFrameGetter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error),
+) (txBuf []byte, meta any, _ error) {
+	txBuf, err := loadDataFromDataFrames(ctx, &transactionNode.Data, dataFrameGetter)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, _, err := parseRawTransactionHeader(txBuf)
+	if err != nil {
+		storageLog.Error("failed to parse transaction", logging.Err(err))
+		return nil, nil, err
+	}
+	meta, err = parseTransactionMetaFromNode(ctx, transactionNode, dataFrameGetter, sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return txBuf, meta, nil
+}
+
+// parseTransactionMetaFromNode returns the parsed meta of the transaction, or nil if there's none
+// (or if it can't be parsed: the error is only logged).
+func parseTransactionMetaFromNode(
+	ctx context.Context,
+	transactionNode *ipldbindcode.Transaction,
+	dataFrameGetter func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error),
+	sig solana.Signature,
+) (any, error) {
+	metaBuffer, err := loadDataFromDataFrames(ctx, &transactionNode.Metadata, dataFrameGetter)
+	if err != nil {
+		return nil, err
+	}
+	if len(metaBuffer) == 0 {
+		return nil, nil
+	}
+	uncompressedMeta, err := decompressZstd(metaBuffer)
+	if err != nil {
+		storageLog.Error("failed to decompress metadata", logging.Signature(sig), logging.Err(err))
+		return nil, nil
+	}
+	status, err := solanatxmetaparsers.ParseAnyTransactionStatusMeta(uncompressedMeta)
+	if err != nil {
+		storageLog.Error("failed to parse metadata", logging.Signature(sig), logging.Err(err))
+		return nil, nil
+	}
+	return status, nil
+}
+
+// parseRawTransactionHeader returns the first signature and the version ("legacy", or the version number)
+// of the transaction in its wire format: the signatures (prefixed by their compact-u16 count), then the message,
+// which starts with 0x80|version if it's versioned.
+func parseRawTransactionHeader(buf []byte) (solana.Signature, any, error) {
+	numSignatures, size, err := decodeCompactU16(buf)
+	if err != nil {
+		return solana.Signature{}, nil, fmt.Errorf("failed to read the number of signatures: %w", err)
+	}
+	if numSignatures == 0 {
+		return solana.Signature{}, nil, fmt.Errorf("transaction has no signatures")
+	}
+	messageStart := size + numSignatures*solana.SignatureLength
+	if len(buf) <= messageStart {
+		return solana.Signature{}, nil, fmt.Errorf("transaction is too short: %d bytes, %d signatures", len(buf), numSignatures)
+	}
+	sig := solana.SignatureFromBytes(buf[size : size+solana.SignatureLength])
+	if prefix := buf[messageStart]; prefix&0x80 != 0 {
+		return sig, int(prefix & 0x7f), nil
+	}
+	return sig, "legacy", nil
+}
+
+// decodeCompactU16 decodes a compact-u16 (as used by solana for the lengths in the wire format),
+// and returns the value and its size in bytes.
+func decodeCompactU16(buf []byte) (int, int, error) {
+	value := 0
+	for i := 0; i < 3; i++ {
+		if i >= len(buf) {
+			return 0, 0, fmt.Errorf("unexpected end of data")
 		}
-		if len(metaBuffer) > 0 {
-			uncompressedMeta, err := decompressZstd(metaBuffer)
-			if err != nil {
-				klog.Errorf("failed to decompress metadata: %v", err)
-				return
-			}
-			status, err := solanatxmetaparsers.ParseAnyTransactionStatusMeta(uncompressedMeta)
-			if err != nil {
-				klog.Errorf("failed to parse metadata: %v", err)
-				return
-			}
-			meta = status
+		b := int(buf[i])
+		value |= (b & 0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return value, i + 1, nil
 		}
 	}
-	return
+	return 0, 0, fmt.Errorf("compact-u16 is too long")
 }
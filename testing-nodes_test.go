@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multihash"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/sourcegraph/jsonrpc2"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// cacheTestNode encodes the node, and puts it in the cache (where the epochs read the nodes
+// from before their CAR); it returns its CID and its bytes.
+func cacheTestNode(t *testing.T, cache *hugecache.Cache, v any, typ schema.Type) (cid.Cid, []byte) {
+	data, err := ipld.Marshal(dagcbor.Encode, v, typ)
+	require.NoError(t, err)
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: multihash.SHA2_256}.Sum(data)
+	require.NoError(t, err)
+	require.NoError(t, cache.PutRawCarObject(c, data))
+	return c, data
+}
+
+// callTestMethod calls the handler of an RPC method with the given params; it returns the
+// error of the handler, or else the result of the method.
+func callTestMethod(t *testing.T, multi *MultiEpoch, handler MethodHandler, params string) (*jsonrpc2.Error, json.RawMessage) {
+	raw := json.RawMessage(params)
+	conn := &requestContext{ctx: &fasthttp.RequestCtx{}}
+	rpcErr, err := handler(multi, context.Background(), conn, &jsonrpc2.Request{Params: &raw})
+	if err != nil {
+		require.NotNil(t, rpcErr)
+		return rpcErr, nil
+	}
+	require.Nil(t, rpcErr)
+	return nil, conn.result
+}
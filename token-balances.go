@@ -0,0 +1,54 @@
+package main
+
+// adaptTokenBalances returns the pre/post token balances of the meta as the RPC returns them:
+//
+//	{"accountIndex": 1, "mint": "...", "owner": "...", "programId": "...",
+//	 "uiTokenAmount": {"amount": "100", "decimals": 2, "uiAmount": 1.0, "uiAmountString": "1"}}
+//
+// The fields are mapped one by one (instead of relying on the generic camelCase conversion of
+// the protobuf names), with the defaults of the fields that the protobuf encoding omits when
+// they are zero; owner and programId are only set when known (the old metas don't have them).
+func adaptTokenBalances(balancesAny any) []any {
+	balances, ok := balancesAny.([]any)
+	if !ok {
+		return []any{}
+	}
+	out := make([]any, 0, len(balances))
+	for _, balanceAny := range balances {
+		balance, ok := balanceAny.(map[string]any)
+		if !ok {
+			continue
+		}
+		adapted := map[string]any{
+			"accountIndex": firstFieldOf(balance, 0, "accountIndex", "account_index"),
+			"mint":         firstFieldOf(balance, "", "mint"),
+		}
+		for _, field := range [][]string{
+			{"owner", "owner"},
+			{"programId", "programId", "program_id"},
+		} {
+			if value := firstFieldOf(balance, "", field[1:]...); value != "" {
+				adapted[field[0]] = value
+			}
+		}
+		uiTokenAmount, _ := firstFieldOf(balance, nil, "uiTokenAmount", "ui_token_amount").(map[string]any)
+		adapted["uiTokenAmount"] = map[string]any{
+			"uiAmount":       firstFieldOf(uiTokenAmount, nil, "uiAmount", "ui_amount"),
+			"decimals":       firstFieldOf(uiTokenAmount, 0, "decimals"),
+			"amount":         firstFieldOf(uiTokenAmount, "0", "amount"),
+			"uiAmountString": firstFieldOf(uiTokenAmount, "0", "uiAmountString", "ui_amount_string"),
+		}
+		out = append(out, adapted)
+	}
+	return out
+}
+
+// firstFieldOf returns the value of the first of the fields that the map has, or the default.
+func firstFieldOf(m map[string]any, def any, fields ...string) any {
+	for _, field := range fields {
+		if value, ok := m[field]; ok && value != nil {
+			return value
+		}
+	}
+	return def
+}
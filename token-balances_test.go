@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptTokenBalances(t *testing.T) {
+	meta := &confirmed_block.TransactionStatusMeta{
+		PreTokenBalances: []*confirmed_block.TokenBalance{
+			{
+				// index 0 and the zero amounts are omitted by the protobuf encoding.
+				AccountIndex: 0,
+				Mint:         "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v",
+				UiTokenAmount: &confirmed_block.UiTokenAmount{
+					Decimals:       6,
+					Amount:         "0",
+					UiAmountString: "0",
+				},
+				Owner:     "5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1",
+				ProgramId: "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+			},
+		},
+		PostTokenBalances: []*confirmed_block.TokenBalance{
+			{
+				AccountIndex: 3,
+				Mint:         "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v",
+				UiTokenAmount: &confirmed_block.UiTokenAmount{
+					UiAmount:       1234.5,
+					Decimals:       6,
+					Amount:         "1234500000",
+					UiAmountString: "1234.5",
+				},
+				Owner:     "5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1",
+				ProgramId: "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+			},
+			{
+				// an old meta, without the owner and program.
+				AccountIndex: 4,
+				Mint:         "So11111111111111111111111111111111111111112",
+				UiTokenAmount: &confirmed_block.UiTokenAmount{
+					UiAmount:       1,
+					Decimals:       9,
+					Amount:         "1000000000",
+					UiAmountString: "1",
+				},
+			},
+		},
+	}
+	m, err := toMapAny(&GetTransactionResponse{Meta: meta})
+	require.NoError(t, err)
+	adapted := adaptTransactionMetaToExpectedOutput(MapToCamelCaseAny(m).(map[string]any))
+	got, err := preciseJson.Marshal(adapted["meta"].(map[string]any)["preTokenBalances"])
+	require.NoError(t, err)
+	// the reference responses of the RPC.
+	require.JSONEq(t, `[
+		{
+			"accountIndex": 0,
+			"mint": "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v",
+			"owner": "5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1",
+			"programId": "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+			"uiTokenAmount": {"amount": "0", "decimals": 6, "uiAmount": null, "uiAmountString": "0"}
+		}
+	]`, string(got))
+	got, err = preciseJson.Marshal(adapted["meta"].(map[string]any)["postTokenBalances"])
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{
+			"accountIndex": 3,
+			"mint": "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v",
+			"owner": "5Q544fKrFoe6tsEbD7S8EmxGTJYAKtTVhAW5Q5pge4j1",
+			"programId": "TokenkegQfeZyiNwAJbNbGKPFXCWuBvf9Ss623VQ5DA",
+			"uiTokenAmount": {"amount": "1234500000", "decimals": 6, "uiAmount": 1234.5, "uiAmountString": "1234.5"}
+		},
+		{
+			"accountIndex": 4,
+			"mint": "So11111111111111111111111111111111111111112",
+			"uiTokenAmount": {"amount": "1000000000", "decimals": 9, "uiAmount": 1, "uiAmountString": "1"}
+		}
+	]`, string(got))
+
+	// the snake_case names are mapped too, and the missing balances are empty lists.
+	require.Equal(t, []any{map[string]any{
+		"accountIndex":  2,
+		"mint":          "",
+		"programId":     "TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb",
+		"uiTokenAmount": map[string]any{"uiAmount": nil, "decimals": 0, "amount": "0", "uiAmountString": "0"},
+	}}, adaptTokenBalances([]any{map[string]any{"account_index": 2, "program_id": "TokenzQdBNbLqP5VEhdkAS6EPFLC1PHnBqCXEpPxuEb"}}))
+	require.Equal(t, []any{}, adaptTokenBalances(nil))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -72,22 +73,30 @@ func loadFromYAML(configFilepath string, dst any) error {
 }
 
 type timer struct {
-	reqID string
-	start time.Time
-	prev  time.Time
+	reqID   string
+	start   time.Time
+	prev    time.Time
+	timings *requestTimings
 }
 
-func newTimer(reqID string) *timer {
+// newTimer creates a timer for the request in the context; the phases timed
+// are also recorded in the request timings (if any), for the slow-query log.
+func newTimer(ctx context.Context) *timer {
 	now := time.Now()
 	return &timer{
-		reqID: reqID,
-		start: now,
-		prev:  now,
+		reqID:   getRequestIDFromContext(ctx),
+		start:   now,
+		prev:    now,
+		timings: getRequestTimingsFromContext(ctx),
 	}
 }
 
 func (t *timer) time(name string) {
-	klog.V(4).Infof("[%s]: %q: %s (overall %s)", t.reqID, name, time.Since(t.prev), time.Since(t.start))
+	took := time.Since(t.prev)
+	klog.V(4).Infof("[%s]: %q: %s (overall %s)", t.reqID, name, took, time.Since(t.start))
+	if t.timings != nil {
+		t.timings.add(name, took)
+	}
 	t.prev = time.Now()
 }
 
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+)
+
+// The supported values of the transactionDetails option of getBlock.
+const (
+	transactionDetailsFull     = "full"
+	transactionDetailsAccounts = "accounts"
+	// transactionDetailsSignatures returns only the (first) signature of each transaction.
+	transactionDetailsSignatures = "signatures"
+	transactionDetailsNone       = "none"
+)
+
+func isValidTransactionDetails(transactionDetails string) bool {
+	switch transactionDetails {
+	case transactionDetailsFull, transactionDetailsAccounts, transactionDetailsSignatures, transactionDetailsNone:
+		return true
+	default:
+		return false
+	}
+}
+
+// withTransactionBodies returns true if the transactionDetails mode returns the transactions
+// themselves (and not just their signatures, or nothing).
+func withTransactionBodies(transactionDetails string) bool {
+	return transactionDetails == transactionDetailsFull || transactionDetails == transactionDetailsAccounts
+}
+
+// loadedAddressesFromMeta returns the addresses loaded from the address lookup tables
+// by the transaction (only the protobuf metas have them).
+func loadedAddressesFromMeta(meta any) (writable []solana.PublicKey, readonly []solana.PublicKey) {
+	if v, ok := meta.(*upstreamTransactionMeta); ok && v != nil {
+		return v.LoadedAddresses.Writable, v.LoadedAddresses.Readonly
+	}
+	v, ok := meta.(*confirmed_block.TransactionStatusMeta)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	for _, addr := range v.LoadedWritableAddresses {
+		writable = append(writable, solana.PublicKeyFromBytes(addr))
+	}
+	for _, addr := range v.LoadedReadonlyAddresses {
+		readonly = append(readonly, solana.PublicKeyFromBytes(addr))
+	}
+	return writable, readonly
+}
+
+// encodeTransactionAccounts returns the transaction as in the "accounts" mode of getBlock:
+// its signatures and all its account keys (including the loaded ones), without the instructions.
+func encodeTransactionAccounts(tx solana.Transaction, meta any) map[string]any {
+	signatures := make([]string, len(tx.Signatures))
+	for i, sig := range tx.Signatures {
+		signatures[i] = sig.String()
+	}
+	accountKeys := make([]map[string]any, 0, len(tx.Message.AccountKeys))
+	for i, key := range tx.Message.AccountKeys {
+		accountKeys = append(accountKeys, map[string]any{
+			"pubkey":   key.String(),
+			"writable": isWritableIndex(&tx.Message, i),
+			"signer":   isSignerIndex(&tx.Message, i),
+			"source":   "transaction",
+		})
+	}
+	writable, readonly := loadedAddressesFromMeta(meta)
+	for _, key := range writable {
+		accountKeys = append(accountKeys, map[string]any{
+			"pubkey":   key.String(),
+			"writable": true,
+			"signer":   false,
+			"source":   "lookupTable",
+		})
+	}
+	for _, key := range readonly {
+		accountKeys = append(accountKeys, map[string]any{
+			"pubkey":   key.String(),
+			"writable": false,
+			"signer":   false,
+			"source":   "lookupTable",
+		})
+	}
+	return map[string]any{
+		"signatures":  signatures,
+		"accountKeys": accountKeys,
+	}
+}
+
+// accountsModeMetaFields are the fields of the (adapted) transaction meta that are kept in the "accounts" mode.
+var accountsModeMetaFields = []string{
+	"err",
+	"status",
+	"fee",
+	"preBalances",
+	"postBalances",
+	"preTokenBalances",
+	"postTokenBalances",
+}
+
+// adaptTransactionMetaToAccountsMode removes from the meta of the (adapted) transaction
+// the fields that are not returned in the "accounts" mode (instructions, logs, etc.).
+func adaptTransactionMetaToAccountsMode(m map[string]any, withRewards bool) map[string]any {
+	meta, ok := m["meta"].(map[string]any)
+	if !ok {
+		return m
+	}
+	out := make(map[string]any, len(accountsModeMetaFields)+1)
+	for _, field := range accountsModeMetaFields {
+		if v, ok := meta[field]; ok {
+			out[field] = v
+		}
+	}
+	if withRewards {
+		out["rewards"] = meta["rewards"]
+	}
+	m["meta"] = out
+	return m
+}
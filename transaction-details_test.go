@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeTransactionAccounts(t *testing.T) {
+	payer := solana.PublicKey{1}
+	readonlySigner := solana.PublicKey{2}
+	writable := solana.PublicKey{3}
+	loadedWritable := solana.PublicKey{4}
+	loadedReadonly := solana.PublicKey{5}
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{9}, {8}},
+		Message: solana.Message{
+			Header: solana.MessageHeader{
+				NumRequiredSignatures:       2,
+				NumReadonlySignedAccounts:   1,
+				NumReadonlyUnsignedAccounts: 1,
+			},
+			AccountKeys: []solana.PublicKey{payer, readonlySigner, writable, solana.SystemProgramID},
+		},
+	}
+	meta := &confirmed_block.TransactionStatusMeta{
+		LoadedWritableAddresses: [][]byte{loadedWritable[:]},
+		LoadedReadonlyAddresses: [][]byte{loadedReadonly[:]},
+	}
+
+	got := encodeTransactionAccounts(tx, meta)
+	require.Equal(t, []string{solana.Signature{9}.String(), solana.Signature{8}.String()}, got["signatures"])
+	key := func(pubkey solana.PublicKey, writable bool, signer bool, source string) map[string]any {
+		return map[string]any{"pubkey": pubkey.String(), "writable": writable, "signer": signer, "source": source}
+	}
+	require.Equal(t, []map[string]any{
+		key(payer, true, true, "transaction"),
+		key(readonlySigner, false, true, "transaction"),
+		key(writable, true, false, "transaction"),
+		key(solana.SystemProgramID, false, false, "transaction"),
+		key(loadedWritable, true, false, "lookupTable"),
+		key(loadedReadonly, false, false, "lookupTable"),
+	}, got["accountKeys"])
+}
+
+func TestAdaptTransactionMetaToAccountsMode(t *testing.T) {
+	newTransaction := func() map[string]any {
+		return map[string]any{
+			"transaction": map[string]any{},
+			"meta": map[string]any{
+				"err":               nil,
+				"status":            map[string]any{"Ok": nil},
+				"fee":               5000,
+				"preBalances":       []any{10},
+				"postBalances":      []any{5},
+				"preTokenBalances":  []any{},
+				"postTokenBalances": []any{},
+				"rewards":           []any{},
+				"logMessages":       []any{"Program log: hi"},
+				"innerInstructions": []any{},
+				"loadedAddresses":   map[string]any{},
+			},
+		}
+	}
+	got := adaptTransactionMetaToAccountsMode(newTransaction(), false)
+	require.Equal(t, map[string]any{
+		"err":               nil,
+		"status":            map[string]any{"Ok": nil},
+		"fee":               5000,
+		"preBalances":       []any{10},
+		"postBalances":      []any{5},
+		"preTokenBalances":  []any{},
+		"postTokenBalances": []any{},
+	}, got["meta"])
+
+	got = adaptTransactionMetaToAccountsMode(newTransaction(), true)
+	require.Contains(t, got["meta"], "rewards")
+	require.NotContains(t, got["meta"], "logMessages")
+}
+
+func TestValidateTransactionDetails(t *testing.T) {
+	for params, wantErr := range map[string]bool{
+		`[1]`:                                      false,
+		`[1, {"transactionDetails":"full"}]`:       false,
+		`[1, {"transactionDetails":"accounts"}]`:   false,
+		`[1, {"transactionDetails":"signatures"}]`: false,
+		`[1, {"transactionDetails":"none"}]`:       false,
+		`[1, {"transactionDetails":"everything"}]`: true,
+	} {
+		raw := json.RawMessage(params)
+		req, err := parseGetBlockRequest(&raw)
+		require.NoError(t, err, params)
+		if wantErr {
+			require.Error(t, req.Validate(), params)
+		} else {
+			require.NoError(t, req.Validate(), params)
+		}
+	}
+	require.True(t, withTransactionBodies(transactionDetailsAccounts))
+	require.False(t, withTransactionBodies(transactionDetailsSignatures))
+}
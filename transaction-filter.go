@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// transactionFilter selects the transactions delivered by the replays; the zero value selects
+// the successful non-vote transactions.
+type transactionFilter struct {
+	// Accounts selects the transactions that reference any of these accounts (including the ones
+	// loaded from lookup tables); empty means any.
+	Accounts []solana.PublicKey
+	// Programs selects the transactions that invoke any of these programs in their top-level
+	// instructions; empty means any.
+	Programs []solana.PublicKey
+	// IncludeVote also selects the transactions with vote instructions.
+	IncludeVote bool
+	// IncludeFailed also selects the failed transactions.
+	IncludeFailed bool
+}
+
+// parsePublicKeys parses the base58 public keys of a flag.
+func parsePublicKeys(flagName string, values []string) ([]solana.PublicKey, error) {
+	out := make([]solana.PublicKey, 0, len(values))
+	for _, value := range values {
+		key, err := solana.PublicKeyFromBase58(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s %q: %w", flagName, value, err)
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
+
+// String returns the description of the filter, for the logs.
+func (f *transactionFilter) String() string {
+	return fmt.Sprintf(
+		"accounts=%d programs=%d includeVote=%v includeFailed=%v",
+		len(f.Accounts), len(f.Programs), f.IncludeVote, f.IncludeFailed,
+	)
+}
+
+// Matches returns true if the transaction (with its meta, in any of the supported formats) is selected.
+func (f *transactionFilter) Matches(tx *solana.Transaction, meta any) bool {
+	if !f.IncludeFailed {
+		if txErr, err := transactionErrorFromMeta(meta); err == nil && txErr != nil {
+			return false
+		}
+	}
+	if !f.IncludeVote && isVoteTransaction(tx) {
+		return false
+	}
+	if len(f.Programs) > 0 {
+		found := false
+		for _, inst := range tx.Message.Instructions {
+			prog, err := tx.ResolveProgramIDIndex(inst.ProgramIDIndex)
+			if err == nil && prog.IsAnyOf(f.Programs...) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Accounts) > 0 {
+		writable, readonly := loadedAddressesFromMeta(meta)
+		found := false
+		for _, keys := range [][]solana.PublicKey{tx.Message.AccountKeys, writable, readonly} {
+			for _, key := range keys {
+				if key.IsAnyOf(f.Accounts...) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isVoteTransaction returns true if the transaction has a vote instruction.
+func isVoteTransaction(tx *solana.Transaction) bool {
+	for _, inst := range tx.Message.Instructions {
+		prog, err := tx.ResolveProgramIDIndex(inst.ProgramIDIndex)
+		if err == nil && prog.Equals(solana.VoteProgramID) {
+			return true
+		}
+	}
+	return false
+}
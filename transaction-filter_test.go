@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionFilter(t *testing.T) {
+	payer := solana.NewWallet().PublicKey()
+	other := solana.NewWallet().PublicKey()
+	loaded := solana.NewWallet().PublicKey()
+	newTx := func(program solana.PublicKey) *solana.Transaction {
+		return &solana.Transaction{
+			Message: solana.Message{
+				AccountKeys: []solana.PublicKey{payer, program},
+				Instructions: []solana.CompiledInstruction{
+					{ProgramIDIndex: 1, Accounts: []uint16{0}},
+				},
+			},
+		}
+	}
+	transfer := newTx(solana.SystemProgramID)
+	vote := newTx(solana.VoteProgramID)
+	successMeta := &confirmed_block.TransactionStatusMeta{
+		LoadedReadonlyAddresses: [][]byte{loaded[:]},
+	}
+
+	var filter transactionFilter
+	require.True(t, filter.Matches(transfer, successMeta))
+	require.True(t, filter.Matches(transfer, nil))
+	require.False(t, filter.Matches(vote, nil))
+	filter.IncludeVote = true
+	require.True(t, filter.Matches(vote, nil))
+
+	filter = transactionFilter{Programs: []solana.PublicKey{solana.SystemProgramID}}
+	require.True(t, filter.Matches(transfer, nil))
+	filter = transactionFilter{Programs: []solana.PublicKey{solana.TokenProgramID}}
+	require.False(t, filter.Matches(transfer, nil))
+
+	filter = transactionFilter{Accounts: []solana.PublicKey{other}}
+	require.False(t, filter.Matches(transfer, successMeta))
+	filter = transactionFilter{Accounts: []solana.PublicKey{payer}}
+	require.True(t, filter.Matches(transfer, successMeta))
+	// the accounts loaded from lookup tables are matched too.
+	filter = transactionFilter{Accounts: []solana.PublicKey{loaded}}
+	require.True(t, filter.Matches(transfer, successMeta))
+	require.False(t, filter.Matches(transfer, nil))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ledgerEntriesWriter writes the entries of the blocks in the format of the validator's ledger:
+// each block is a record with the bincode serialization of `(Slot, Slot, Vec<Entry>)`, i.e. its
+// slot, its parent slot and its entries, as they're given to the shredder of a validator, so
+// that the slots can be shredded and inserted into the blockstore of a test validator for replay.
+// An Entry is `{num_hashes: u64, hash: Hash, transactions: Vec<VersionedTransaction>}`, with the
+// transactions in their wire format; the records are concatenated, without framing.
+type ledgerEntriesWriter struct {
+	w          io.Writer
+	buf        []byte
+	numEntries uint64
+}
+
+func newLedgerEntriesWriter(w io.Writer) *ledgerEntriesWriter {
+	return &ledgerEntriesWriter{w: w}
+}
+
+// add writes the record of the block; the blocks fetched from the upstream, without entries, can't be written.
+func (w *ledgerEntriesWriter) add(block *transcodeBlock) error {
+	buf, err := appendLedgerEntries(w.buf[:0], block)
+	if err != nil {
+		return fmt.Errorf("slot %d: %w", block.Slot, err)
+	}
+	w.buf = buf
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	w.numEntries += uint64(len(block.Entries))
+	return nil
+}
+
+// appendLedgerEntries appends the bincode serialization of the slot, parent slot and entries of the block.
+func appendLedgerEntries(buf []byte, block *transcodeBlock) ([]byte, error) {
+	if len(block.Entries) == 0 {
+		return nil, fmt.Errorf("the block has no entries")
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, block.Slot)
+	buf = binary.LittleEndian.AppendUint64(buf, block.ParentSlot)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(block.Entries)))
+	txIndex := 0
+	for _, entry := range block.Entries {
+		if txIndex+entry.NumTransactions > len(block.Transactions) {
+			return nil, fmt.Errorf("the entries have more transactions than the block (%d)", len(block.Transactions))
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, entry.NumHashes)
+		buf = append(buf, entry.Hash[:]...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.NumTransactions))
+		for _, tx := range block.Transactions[txIndex : txIndex+entry.NumTransactions] {
+			txBuf, err := tx.Transaction.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("failed to serialize transaction %d: %w", tx.Index, err)
+			}
+			buf = append(buf, txBuf...)
+		}
+		txIndex += entry.NumTransactions
+	}
+	if txIndex != len(block.Transactions) {
+		return nil, fmt.Errorf("the entries have %d transactions, the block %d", txIndex, len(block.Transactions))
+	}
+	return buf, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerEntriesWriter(t *testing.T) {
+	tx := solana.Transaction{
+		Signatures: []solana.Signature{{1}},
+		Message: solana.Message{
+			AccountKeys:     []solana.PublicKey{{2}},
+			RecentBlockhash: solana.Hash{3},
+		},
+	}
+	txBuf, err := tx.MarshalBinary()
+	require.NoError(t, err)
+
+	block := &transcodeBlock{
+		Slot:       100,
+		ParentSlot: 98,
+		Transactions: []transcodeTransaction{
+			{Index: 0, Transaction: tx},
+			{Index: 1, Transaction: tx},
+		},
+		Entries: []transcodeEntry{
+			{NumHashes: 12500, Hash: solana.Hash{4}},
+			{NumHashes: 10, Hash: solana.Hash{5}, NumTransactions: 2},
+		},
+	}
+	var out bytes.Buffer
+	writer := newLedgerEntriesWriter(&out)
+	require.NoError(t, writer.add(block))
+	require.Equal(t, uint64(2), writer.numEntries)
+
+	var expected []byte
+	expected = binary.LittleEndian.AppendUint64(expected, 100)
+	expected = binary.LittleEndian.AppendUint64(expected, 98)
+	expected = binary.LittleEndian.AppendUint64(expected, 2)
+	// a tick.
+	expected = binary.LittleEndian.AppendUint64(expected, 12500)
+	expected = append(expected, block.Entries[0].Hash[:]...)
+	expected = binary.LittleEndian.AppendUint64(expected, 0)
+	expected = binary.LittleEndian.AppendUint64(expected, 10)
+	expected = append(expected, block.Entries[1].Hash[:]...)
+	expected = binary.LittleEndian.AppendUint64(expected, 2)
+	expected = append(append(expected, txBuf...), txBuf...)
+	require.Equal(t, expected, out.Bytes())
+
+	// the entries must have all the transactions of the block.
+	block.Entries[1].NumTransactions = 1
+	require.Error(t, writer.add(block))
+	block.Entries[1].NumTransactions = 3
+	require.Error(t, writer.add(block))
+	// e.g. a block fetched from the upstream.
+	require.Error(t, writer.add(&transcodeBlock{Slot: 101}))
+}
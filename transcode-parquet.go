@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/parquet"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+)
+
+// instructionParquetColumns is the schema of the instruction-level Parquet export: one row per
+// instruction, top-level (inner_index is null) or inner (invoked by the top-level instruction
+// instruction_index).
+var instructionParquetColumns = []parquet.Column{
+	{Name: "slot", Type: parquet.Uint64},
+	{Name: "block_time", Type: parquet.Int64},
+	{Name: "signature", Type: parquet.String},
+	{Name: "tx_index", Type: parquet.Uint32},
+	{Name: "success", Type: parquet.Boolean},
+	{Name: "instruction_index", Type: parquet.Uint32},
+	{Name: "inner_index", Type: parquet.Uint32, Repetition: parquet.Optional},
+	{Name: "stack_height", Type: parquet.Uint32, Repetition: parquet.Optional},
+	{Name: "program_id", Type: parquet.String},
+	{Name: "accounts", Type: parquet.String, Repetition: parquet.Repeated},
+	{Name: "data", Type: parquet.Bytes},
+	{Name: "program_name", Type: parquet.String, Repetition: parquet.Optional},
+	{Name: "instruction_type", Type: parquet.String, Repetition: parquet.Optional},
+}
+
+// instructionParquetWriter writes the instructions of the blocks as rows of instructionParquetColumns.
+type instructionParquetWriter struct {
+	w               *parquet.Writer
+	numInstructions uint64
+}
+
+// add writes the rows of the instructions of the transactions of the block; the inner
+// instructions are only available in the protobuf metas (the ones of the recent epochs).
+func (w *instructionParquetWriter) add(block *transcodeBlock) error {
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		signature := ""
+		if len(tx.Transaction.Signatures) > 0 {
+			signature = tx.Transaction.Signatures[0].String()
+		}
+		success := true
+		if txErr, err := transactionErrorFromMeta(tx.Meta); err == nil && txErr != nil {
+			success = false
+		}
+		writable, readonly := loadedAddressesFromMeta(tx.Meta)
+		accountKeys := tx.Transaction.Message.AccountKeys
+		allKeys := make([]solana.PublicKey, 0, len(accountKeys)+len(writable)+len(readonly))
+		allKeys = append(append(append(allKeys, accountKeys...), writable...), readonly...)
+
+		var innerByIndex map[uint32][]*confirmed_block.InnerInstruction
+		if protoMeta, ok := tx.Meta.(*confirmed_block.TransactionStatusMeta); ok {
+			innerByIndex = make(map[uint32][]*confirmed_block.InnerInstruction, len(protoMeta.InnerInstructions))
+			for _, inner := range protoMeta.InnerInstructions {
+				innerByIndex[inner.Index] = append(innerByIndex[inner.Index], inner.Instructions...)
+			}
+		}
+
+		for instIndex, inst := range tx.Transaction.Message.Instructions {
+			accounts := make([]uint32, len(inst.Accounts))
+			for j, account := range inst.Accounts {
+				accounts[j] = uint32(account)
+			}
+			row := instructionRow{
+				programIDIndex: uint32(inst.ProgramIDIndex),
+				accounts:       accounts,
+				data:           inst.Data,
+			}
+			if err := w.writeRow(block, tx, signature, success, allKeys, uint32(instIndex), nil, row); err != nil {
+				return err
+			}
+			for innerIndex, inner := range innerByIndex[uint32(instIndex)] {
+				accounts := make([]uint32, len(inner.Accounts))
+				for j, account := range inner.Accounts {
+					accounts[j] = uint32(account)
+				}
+				innerIndex := uint32(innerIndex)
+				row := instructionRow{
+					programIDIndex: inner.ProgramIdIndex,
+					accounts:       accounts,
+					data:           inner.Data,
+					stackHeight:    inner.StackHeight,
+				}
+				if err := w.writeRow(block, tx, signature, success, allKeys, uint32(instIndex), &innerIndex, row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// instructionRow is a top-level or inner instruction, with indexes into the account keys of the transaction.
+type instructionRow struct {
+	programIDIndex uint32
+	accounts       []uint32
+	data           []byte
+	stackHeight    *uint32
+}
+
+func (w *instructionParquetWriter) writeRow(
+	block *transcodeBlock,
+	tx *transcodeTransaction,
+	signature string,
+	success bool,
+	allKeys []solana.PublicKey,
+	instructionIndex uint32,
+	innerIndex *uint32,
+	inst instructionRow,
+) error {
+	keyAt := func(index uint32) (solana.PublicKey, string) {
+		if int(index) >= len(allKeys) {
+			return solana.PublicKey{}, ""
+		}
+		return allKeys[index], allKeys[index].String()
+	}
+	programID, programIDString := keyAt(inst.programIDIndex)
+	accounts := make([]string, len(inst.accounts))
+	for i, index := range inst.accounts {
+		_, accounts[i] = keyAt(index)
+	}
+	data := inst.data
+	if data == nil {
+		data = []byte{}
+	}
+	var programName, instructionType any
+	if name, typ := decodeInstructionType(programID, inst.data); name != "" {
+		programName = name
+		if typ != "" {
+			instructionType = typ
+		}
+	}
+	var innerIndexValue, stackHeightValue any
+	if innerIndex != nil {
+		innerIndexValue = *innerIndex
+	}
+	if inst.stackHeight != nil {
+		stackHeightValue = *inst.stackHeight
+	}
+	w.numInstructions++
+	return w.w.Write(
+		block.Slot,
+		block.BlockTime,
+		signature,
+		uint32(tx.Index),
+		success,
+		instructionIndex,
+		innerIndexValue,
+		stackHeightValue,
+		programIDString,
+		accounts,
+		data,
+		programName,
+		instructionType,
+	)
+}
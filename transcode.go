@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+	"github.com/gagliardetto/solana-go"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	blockiterator "github.com/rpcpool/yellowstone-faithful/block-iterator"
+	hugecache "github.com/rpcpool/yellowstone-faithful/huge-cache"
+	"github.com/rpcpool/yellowstone-faithful/ipld/ipldbindcode"
+	"github.com/rpcpool/yellowstone-faithful/iplddecoders"
+	metalatest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-latest"
+	metaoldest "github.com/rpcpool/yellowstone-faithful/parse_legacy_transaction_status_meta/v-oldest"
+	splitcarfetcher "github.com/rpcpool/yellowstone-faithful/split-car-fetcher"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/urfave/cli/v2"
+	"github.com/ybbus/jsonrpc/v3"
+	"k8s.io/klog/v2"
+)
+
+// loadConfigsForSlotRange loads the epoch configs found in the given files or directories whose
+// epochs overlap with the slot range (the ones in filecoin mode are skipped), sorted by epoch.
+func loadConfigsForSlotRange(paths []string, includePatterns []string, excludePatterns []string, fromSlot uint64, toSlot uint64) (ConfigSlice, error) {
+	configFiles, err := GetListOfConfigFiles(paths, includePatterns, excludePatterns)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(ConfigSlice, 0)
+	for _, configFile := range configFiles {
+		config, err := LoadConfig(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %q: %w", configFile, err)
+		}
+		if config.IsFilecoinMode() {
+			klog.Infof("Config %q is in filecoin mode; skipping", configFile)
+			continue
+		}
+		start, stop := CalcEpochLimits(*config.Epoch)
+		if !Uint64RangesHavePartialOverlapIncludingEdges([2]uint64{start, stop}, [2]uint64{fromSlot, toSlot}) {
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if err := configs.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating configs: %w", err)
+	}
+	configs.SortByEpoch()
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no epoch configs overlap with the slot range")
+	}
+	if gaps := missingEpochs(configs, fromSlot, toSlot); len(gaps) > 0 {
+		klog.Warningf("No config for the epochs %s of the slot range: their slots will be missing", formatEpochRanges(gaps))
+	}
+	return configs, nil
+}
+
+// missingEpochs returns the ranges of the epochs (inclusive) of the slot range that have no config,
+// up to the last epoch with one; configs must be sorted by epoch.
+func missingEpochs(configs ConfigSlice, fromSlot uint64, toSlot uint64) [][2]uint64 {
+	if len(configs) == 0 {
+		return nil
+	}
+	lastEpoch := min(CalcEpochForSlot(toSlot), *configs[len(configs)-1].Epoch)
+	var gaps [][2]uint64
+	next := CalcEpochForSlot(fromSlot)
+	for _, config := range configs {
+		if *config.Epoch > lastEpoch {
+			break
+		}
+		if *config.Epoch > next {
+			gaps = append(gaps, [2]uint64{next, *config.Epoch - 1})
+		}
+		next = max(next, *config.Epoch+1)
+	}
+	if next <= lastEpoch {
+		gaps = append(gaps, [2]uint64{next, lastEpoch})
+	}
+	return gaps
+}
+
+func formatEpochRanges(ranges [][2]uint64) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			parts = append(parts, fmt.Sprint(r[0]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r[0], r[1]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// epochScanner opens the epochs of the configs to read their CARs sequentially,
+// outside of the RPC server.
+type epochScanner struct {
+	cctx      *cli.Context
+	cache     *hugecache.Cache
+	minerInfo *splitcarfetcher.MinerInfoCache
+
+	mu       sync.Mutex
+	rootCids map[uint64]string // of the opened epochs.
+}
+
+func newEpochScanner(c *cli.Context) (*epochScanner, error) {
+	// The cache is only needed to satisfy the epoch; keep it small.
+	conf := bigcache.DefaultConfig(5 * time.Minute)
+	conf.HardMaxCacheSize = 64
+	allCache, err := hugecache.NewWithConfig(c.Context, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache: %w", err)
+	}
+	lotusAPIAddress := "https://api.node.glif.io"
+	cl := jsonrpc.NewClient(lotusAPIAddress)
+	minerInfo := splitcarfetcher.NewMinerInfo(
+		cl,
+		24*time.Hour,
+		5*time.Second,
+	)
+	return &epochScanner{
+		cctx:      c,
+		cache:     allCache,
+		minerInfo: minerInfo,
+	}, nil
+}
+
+func (s *epochScanner) open(config *Config) (*Epoch, error) {
+	epoch, err := NewEpochFromConfig(config, s.cctx, s.cache, s.minerInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epoch from config %q: %w", config.ConfigFilepath(), err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rootCids == nil {
+		s.rootCids = make(map[uint64]string)
+	}
+	s.rootCids[epoch.Epoch()] = epoch.GetRootCid().String()
+	return epoch, nil
+}
+
+// RootCids returns the root CIDs of the epochs that were opened, by epoch.
+func (s *epochScanner) RootCids() map[uint64]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[uint64]string, len(s.rootCids))
+	for epoch, rootCid := range s.rootCids {
+		out[epoch] = rootCid
+	}
+	return out
+}
+
+// transcodeBlock is a block, with its transactions, decoded for the export to other stores.
+type transcodeBlock struct {
+	Slot         uint64
+	ParentSlot   uint64
+	BlockTime    int64
+	BlockHeight  *uint64
+	Blockhash    solana.Hash
+	Transactions []transcodeTransaction
+	// Entries are the PoH entries of the block, in order; their transactions are the
+	// consecutive ones of Transactions. Empty for the blocks fetched from the upstream.
+	Entries []transcodeEntry
+	// Source is blockSourceUpstream for a block that the archive lacks, fetched from the upstream
+	// RPC server; empty for the blocks of the CARs.
+	Source string
+}
+
+// transcodeTransaction is a transaction of a block, with its meta (in any of the supported formats, or nil).
+type transcodeTransaction struct {
+	Index       int
+	Transaction solana.Transaction
+	Meta        any
+}
+
+// transcodeEntry is a PoH entry of a block.
+type transcodeEntry struct {
+	NumHashes       uint64
+	Hash            solana.Hash
+	NumTransactions int
+}
+
+// transcodeSlotRange calls fn with each block of the slot range (inclusive), in slot order,
+// reading the CARs of the epochs sequentially: the stream continues across the epoch boundaries,
+// and the next epoch is opened while the current one is read, so that the hand-off doesn't stall it.
+func transcodeSlotRange(
+	ctx context.Context,
+	scanner *epochScanner,
+	configs ConfigSlice,
+	fromSlot uint64,
+	toSlot uint64,
+	fn func(*transcodeBlock) error,
+) error {
+	type openedEpoch struct {
+		epoch *Epoch
+		err   error
+	}
+	openAsync := func(config *Config) <-chan openedEpoch {
+		ch := make(chan openedEpoch, 1)
+		go func() {
+			epoch, err := scanner.open(config)
+			ch <- openedEpoch{epoch, err}
+		}()
+		return ch
+	}
+	// the blocks are handed over in strictly increasing slot order, even if the CARs of
+	// consecutive epochs overlap.
+	var lastSlot uint64
+	started := false
+	emit := func(block *transcodeBlock) error {
+		if started && block.Slot <= lastSlot {
+			klog.Warningf("Skipping block %d: already read up to slot %d", block.Slot, lastSlot)
+			return nil
+		}
+		started, lastSlot = true, block.Slot
+		return fn(block)
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	next := openAsync(configs[0])
+	for i, config := range configs {
+		opened := <-next
+		if opened.err != nil {
+			return opened.err
+		}
+		hasNext := i+1 < len(configs)
+		if hasNext {
+			next = openAsync(configs[i+1])
+		}
+		err := transcodeEpoch(ctx, opened.epoch, fromSlot, toSlot, emit)
+		opened.epoch.Close()
+		if err != nil {
+			if hasNext {
+				go func(next <-chan openedEpoch) {
+					if opened := <-next; opened.err == nil {
+						opened.epoch.Close()
+					}
+				}(next)
+			}
+			return fmt.Errorf("epoch %d: %w", *config.Epoch, err)
+		}
+		if hasNext {
+			klog.Infof("Epoch %d done (up to slot %d); continuing with epoch %d", *config.Epoch, lastSlot, *configs[i+1].Epoch)
+		}
+	}
+	return nil
+}
+
+func transcodeEpoch(ctx context.Context, epoch *Epoch, fromSlot uint64, toSlot uint64, fn func(*transcodeBlock) error) error {
+	epochStart, epochStop := CalcEpochLimits(epoch.Epoch())
+	if fromSlot > epochStop || toSlot < epochStart {
+		return nil
+	}
+	it, err := epoch.NewBlockIterator(ctx, fromSlot, toSlot)
+	if err != nil {
+		return fmt.Errorf("failed to create block iterator: %w", err)
+	}
+	defer it.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		block, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read block: %w", err)
+		}
+		decoded, err := decodeTranscodeBlock(ctx, block)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %d: %w", block.Slot(), err)
+		}
+		if err := fn(decoded); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeTranscodeBlock decodes the block, and its transactions in the order of its entries,
+// from the nodes of its DAG.
+func decodeTranscodeBlock(ctx context.Context, block *blockiterator.Block) (*transcodeBlock, error) {
+	objects := make(map[cid.Cid][]byte, len(block.Objects))
+	for _, obj := range block.Objects {
+		objects[obj.Cid] = obj.Data
+	}
+	getObject := func(link datamodel.Link) ([]byte, cid.Cid, error) {
+		c := link.(cidlink.Link).Cid
+		data, ok := objects[c]
+		if !ok {
+			return nil, c, fmt.Errorf("node %s is not in the DAG of the block", c)
+		}
+		return data, c, nil
+	}
+	dataFrameGetter := func(ctx context.Context, wantedCid cid.Cid) (*ipldbindcode.DataFrame, error) {
+		data, ok := objects[wantedCid]
+		if !ok {
+			return nil, fmt.Errorf("dataframe %s is not in the DAG of the block", wantedCid)
+		}
+		return iplddecoders.DecodeDataFrame(data)
+	}
+
+	out := &transcodeBlock{
+		Slot:       uint64(block.Block.Slot),
+		ParentSlot: uint64(block.Block.Meta.Parent_slot),
+		BlockTime:  int64(block.Block.Meta.Blocktime),
+	}
+	if height, ok := block.Block.GetBlockHeight(); ok {
+		out.BlockHeight = &height
+	}
+	for entryIndex, entryLink := range block.Block.Entries {
+		data, entryCid, err := getObject(entryLink)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := iplddecoders.DecodeEntry(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode entry %s: %w", entryCid, err)
+		}
+		if entryIndex == len(block.Block.Entries)-1 {
+			out.Blockhash = solana.HashFromBytes(entry.Hash)
+		}
+		out.Entries = append(out.Entries, transcodeEntry{
+			NumHashes:       uint64(entry.NumHashes),
+			Hash:            solana.HashFromBytes(entry.Hash),
+			NumTransactions: len(entry.Transactions),
+		})
+		for _, txLink := range entry.Transactions {
+			data, txCid, err := getObject(txLink)
+			if err != nil {
+				return nil, err
+			}
+			txNode, err := iplddecoders.DecodeTransaction(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode transaction %s: %w", txCid, err)
+			}
+			tx, meta, err := parseTransactionAndMetaFromNode(ctx, txNode, dataFrameGetter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse transaction %s: %w", txCid, err)
+			}
+			index := len(out.Transactions)
+			if position, ok := txNode.GetPositionIndex(); ok {
+				index = position
+			}
+			out.Transactions = append(out.Transactions, transcodeTransaction{
+				Index:       index,
+				Transaction: tx,
+				Meta:        meta,
+			})
+		}
+	}
+	return out, nil
+}
+
+// transactionFeeFromMeta returns the fee of the transaction with the given meta (in any of the supported formats).
+func transactionFeeFromMeta(meta any) uint64 {
+	switch metaValue := meta.(type) {
+	case *confirmed_block.TransactionStatusMeta:
+		return metaValue.Fee
+	case *metalatest.TransactionStatusMeta:
+		return metaValue.Fee
+	case *metaoldest.TransactionStatusMeta:
+		return metaValue.Fee
+	case *upstreamTransactionMeta:
+		return metaValue.Fee
+	default:
+		return 0
+	}
+}
+
+// transactionVersion returns the version of the transaction as in the RPC responses: "legacy", or the version number.
+func transactionVersion(tx *solana.Transaction) any {
+	if tx.Message.IsVersioned() {
+		return int(tx.Message.GetVersion() - 1)
+	}
+	return "legacy"
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingEpochs(t *testing.T) {
+	configsOf := func(epochs ...uint64) ConfigSlice {
+		configs := make(ConfigSlice, 0, len(epochs))
+		for _, epoch := range epochs {
+			epoch := epoch
+			configs = append(configs, &Config{Epoch: &epoch})
+		}
+		return configs
+	}
+	slotOf := func(epoch uint64) uint64 {
+		start, _ := CalcEpochLimits(epoch)
+		return start
+	}
+
+	require.Empty(t, missingEpochs(configsOf(3, 4, 5), slotOf(3), slotOf(5)+10))
+	// the epochs after the last config are not reported (the range has no upper limit).
+	require.Empty(t, missingEpochs(configsOf(3, 4, 5), slotOf(3)+10, ^uint64(0)))
+
+	gaps := missingEpochs(configsOf(2, 5, 7), 0, ^uint64(0))
+	require.Equal(t, [][2]uint64{{0, 1}, {3, 4}, {6, 6}}, gaps)
+	require.Equal(t, "0-1, 3-4, 6", formatEpochRanges(gaps))
+
+	// the range stops before the last config.
+	require.Equal(t, [][2]uint64{{3, 4}, {6, 6}}, missingEpochs(configsOf(2, 5, 9), slotOf(2), slotOf(6)))
+}
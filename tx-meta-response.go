@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/base64"
+
+	"github.com/mr-tron/base58"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+)
+
+// transactionMetaResponse returns the protobuf meta of a transaction as the RPC returns it, mapped
+// field by field from the protobuf definitions (see confirmed_block.proto); it's the same result
+// as the generic conversion of the meta (toMapAny, MapToCamelCase, then adaptTransactionMetaToExpectedOutput),
+// without its JSON round trip and reflection, which are the bulk of the encoding of the blocks.
+// Like the protobuf encoding, the fields that are zero are left out, unless the RPC has a default for them.
+func transactionMetaResponse(meta *confirmed_block.TransactionStatusMeta) map[string]any {
+	out := make(map[string]any, 16)
+
+	var txErr any
+	if meta.Err != nil && len(meta.Err.Err) > 0 {
+		txErr, _ = decodeTransactionError(meta.Err.Err)
+	}
+	out["err"] = txErr
+	if txErr == nil {
+		out["status"] = map[string]any{"Ok": nil}
+	} else {
+		out["status"] = map[string]any{"Err": txErr}
+	}
+	if meta.Fee != 0 {
+		out["fee"] = meta.Fee
+	}
+	if len(meta.PreBalances) > 0 {
+		out["preBalances"] = meta.PreBalances
+	}
+	if len(meta.PostBalances) > 0 {
+		out["postBalances"] = meta.PostBalances
+	}
+
+	innerInstructions := make([]any, 0, len(meta.InnerInstructions))
+	for _, inner := range meta.InnerInstructions {
+		if inner == nil {
+			innerInstructions = append(innerInstructions, nil)
+			continue
+		}
+		innerInstruction := map[string]any{
+			"index": inner.Index,
+		}
+		if len(inner.Instructions) > 0 {
+			instructions := make([]any, 0, len(inner.Instructions))
+			for _, instruction := range inner.Instructions {
+				if instruction == nil {
+					instructions = append(instructions, nil)
+					continue
+				}
+				instructions = append(instructions, innerInstructionResponse(instruction))
+			}
+			innerInstruction["instructions"] = instructions
+		}
+		innerInstructions = append(innerInstructions, innerInstruction)
+	}
+	out["innerInstructions"] = innerInstructions
+	if meta.InnerInstructionsNone {
+		out["innerInstructionsNone"] = true
+	}
+	if len(meta.LogMessages) > 0 {
+		logMessages := make([]any, len(meta.LogMessages))
+		for i, message := range meta.LogMessages {
+			logMessages[i] = message
+		}
+		out["logMessages"] = logMessages
+	}
+	if meta.LogMessagesNone {
+		out["logMessagesNone"] = true
+	}
+
+	out["preTokenBalances"] = tokenBalancesResponse(meta.PreTokenBalances)
+	out["postTokenBalances"] = tokenBalancesResponse(meta.PostTokenBalances)
+
+	rewards := make([]any, 0, len(meta.Rewards))
+	for _, reward := range meta.Rewards {
+		if reward == nil {
+			rewards = append(rewards, nil)
+			continue
+		}
+		rewards = append(rewards, rewardResponse(reward))
+	}
+	out["rewards"] = rewards
+
+	out["loadedAddresses"] = map[string]any{
+		"readonly": addressesResponse(meta.LoadedReadonlyAddresses),
+		"writable": addressesResponse(meta.LoadedWritableAddresses),
+	}
+	if meta.ReturnData != nil {
+		returnData := make(map[string]any, 2)
+		if len(meta.ReturnData.ProgramId) > 0 {
+			returnData["programId"] = base58.Encode(meta.ReturnData.ProgramId)
+		}
+		if len(meta.ReturnData.Data) > 0 {
+			returnData["data"] = []any{base64.StdEncoding.EncodeToString(meta.ReturnData.Data), "base64"}
+		}
+		out["returnData"] = returnData
+	}
+	if meta.ComputeUnitsConsumed != nil {
+		out["computeUnitsConsumed"] = *meta.ComputeUnitsConsumed
+	}
+	return out
+}
+
+func innerInstructionResponse(instruction *confirmed_block.InnerInstruction) map[string]any {
+	out := make(map[string]any, 4)
+	if instruction.ProgramIdIndex != 0 {
+		out["programIdIndex"] = instruction.ProgramIdIndex
+	}
+	if len(instruction.Accounts) > 0 {
+		out["accounts"] = byteSliceAsIntegerSlice(instruction.Accounts)
+	} else {
+		out["accounts"] = []any{}
+	}
+	if len(instruction.Data) > 0 {
+		// the data of the inner instructions is always base58 (see adaptTransactionMetaToExpectedOutput).
+		out["data"] = base58.Encode(instruction.Data)
+	}
+	if instruction.StackHeight != nil {
+		out["stackHeight"] = *instruction.StackHeight
+	} else {
+		// the stack height is only in the recent metas.
+		out["stackHeight"] = nil
+	}
+	return out
+}
+
+// tokenBalancesResponse is the protobuf counterpart of adaptTokenBalances.
+func tokenBalancesResponse(balances []*confirmed_block.TokenBalance) []any {
+	out := make([]any, 0, len(balances))
+	for _, balance := range balances {
+		if balance == nil {
+			continue
+		}
+		adapted := map[string]any{
+			"accountIndex": balance.AccountIndex,
+			"mint":         balance.Mint,
+		}
+		if balance.Owner != "" {
+			adapted["owner"] = balance.Owner
+		}
+		if balance.ProgramId != "" {
+			adapted["programId"] = balance.ProgramId
+		}
+		uiTokenAmount := map[string]any{
+			"uiAmount":       nil,
+			"decimals":       uint32(0),
+			"amount":         "0",
+			"uiAmountString": "0",
+		}
+		if amount := balance.UiTokenAmount; amount != nil {
+			if amount.UiAmount != 0 {
+				uiTokenAmount["uiAmount"] = amount.UiAmount
+			}
+			uiTokenAmount["decimals"] = amount.Decimals
+			if amount.Amount != "" {
+				uiTokenAmount["amount"] = amount.Amount
+			}
+			if amount.UiAmountString != "" {
+				uiTokenAmount["uiAmountString"] = amount.UiAmountString
+			}
+		}
+		adapted["uiTokenAmount"] = uiTokenAmount
+		out = append(out, adapted)
+	}
+	return out
+}
+
+func rewardResponse(reward *confirmed_block.Reward) map[string]any {
+	out := make(map[string]any, 5)
+	if reward.Pubkey != "" {
+		out["pubkey"] = reward.Pubkey
+	}
+	if reward.Lamports != 0 {
+		out["lamports"] = reward.Lamports
+	}
+	if reward.PostBalance != 0 {
+		out["postBalance"] = reward.PostBalance
+	}
+	if reward.RewardType != 0 {
+		out["rewardType"] = int32(reward.RewardType)
+	}
+	if reward.Commission != "" {
+		out["commission"] = reward.Commission
+	}
+	return out
+}
+
+func addressesResponse(addresses [][]byte) []any {
+	out := make([]any, len(addresses))
+	for i, address := range addresses {
+		if address != nil {
+			out[i] = base58.Encode(address)
+		}
+	}
+	return out
+}
+
+// mapMetaDirectly replaces the protobuf meta of the response with its direct mapping (see
+// transactionMetaResponse); it must be called once the transaction is encoded (which reads the meta),
+// and the meta is put back with withMetaResponse after the generic conversion of the response.
+func (r *GetTransactionResponse) mapMetaDirectly() {
+	meta, ok := r.Meta.(*confirmed_block.TransactionStatusMeta)
+	if !ok || meta == nil {
+		return
+	}
+	r.metaResponse = transactionMetaResponse(meta)
+	r.Meta = nil
+}
+
+// withMetaResponse sets the directly mapped meta (if any) into the converted response.
+func (r *GetTransactionResponse) withMetaResponse(m map[string]any) map[string]any {
+	if r.metaResponse != nil {
+		m["meta"] = r.metaResponse
+	}
+	return m
+}
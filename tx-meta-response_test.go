@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/rpcpool/yellowstone-faithful/third_party/solana_proto/confirmed_block"
+	"github.com/stretchr/testify/require"
+)
+
+// genericMetaResponse is the meta of the response converted the generic way.
+func genericMetaResponse(t *testing.T, meta *confirmed_block.TransactionStatusMeta) any {
+	m, err := toMapAny(&GetTransactionResponse{Meta: meta})
+	require.NoError(t, err)
+	return adaptTransactionMetaToExpectedOutput(MapToCamelCase(m))["meta"]
+}
+
+func requireSameJSON(t *testing.T, expected any, actual any) {
+	expectedJSON, err := preciseJson.Marshal(expected)
+	require.NoError(t, err)
+	actualJSON, err := preciseJson.Marshal(actual)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expectedJSON), string(actualJSON))
+}
+
+func TestTransactionMetaResponse(t *testing.T) {
+	stackHeight := uint32(2)
+	computeUnits := uint64(1400)
+	loaded := solana.PublicKey{7}
+	full := &confirmed_block.TransactionStatusMeta{
+		// InstructionError(0, Custom(6001))
+		Err:          &confirmed_block.TransactionError{Err: []byte{8, 0, 0, 0, 0, 25, 0, 0, 0, 0x71, 0x17, 0, 0}},
+		Fee:          5000,
+		PreBalances:  []uint64{18446744073709551615, 0, 10},
+		PostBalances: []uint64{18446744073709546615, 0, 10},
+		InnerInstructions: []*confirmed_block.InnerInstructions{
+			{Index: 0, Instructions: []*confirmed_block.InnerInstruction{
+				{ProgramIdIndex: 2, Accounts: []byte{0, 1}, Data: []byte{3, 0, 0, 0}, StackHeight: &stackHeight},
+				{ProgramIdIndex: 0},
+			}},
+			{Index: 1},
+		},
+		LogMessages: []string{"Program 11111111111111111111111111111111 invoke [1]", "Program 11111111111111111111111111111111 success"},
+		PreTokenBalances: []*confirmed_block.TokenBalance{
+			{AccountIndex: 1, Mint: "So11111111111111111111111111111111111111112", Owner: loaded.String(), UiTokenAmount: &confirmed_block.UiTokenAmount{UiAmount: 1.5, Decimals: 9, Amount: "1500000000", UiAmountString: "1.5"}},
+			{AccountIndex: 0, Mint: "So11111111111111111111111111111111111111112"},
+		},
+		PostTokenBalances: []*confirmed_block.TokenBalance{
+			{AccountIndex: 1, Mint: "So11111111111111111111111111111111111111112", ProgramId: solana.TokenProgramID.String(), UiTokenAmount: &confirmed_block.UiTokenAmount{Decimals: 9, Amount: "0"}},
+		},
+		Rewards: []*confirmed_block.Reward{
+			{Pubkey: loaded.String(), Lamports: -5, PostBalance: 100, RewardType: confirmed_block.RewardType_Rent},
+		},
+		LoadedWritableAddresses: [][]byte{loaded[:]},
+		ReturnData:              &confirmed_block.ReturnData{ProgramId: loaded[:], Data: []byte("ok")},
+		ComputeUnitsConsumed:    &computeUnits,
+	}
+	requireSameJSON(t, genericMetaResponse(t, full), transactionMetaResponse(full))
+
+	// the zero fields, and the defaults of the RPC.
+	empty := &confirmed_block.TransactionStatusMeta{
+		InnerInstructionsNone: true,
+		LogMessagesNone:       true,
+		ReturnDataNone:        true,
+	}
+	requireSameJSON(t, genericMetaResponse(t, empty), transactionMetaResponse(empty))
+	require.Equal(t, map[string]any{"Ok": nil}, transactionMetaResponse(empty)["status"])
+}
+
+func TestMapMetaDirectly(t *testing.T) {
+	meta := &confirmed_block.TransactionStatusMeta{Fee: 5000}
+	response := &GetTransactionResponse{Meta: meta}
+	response.mapMetaDirectly()
+	require.Nil(t, response.Meta)
+	m, err := toMapAny(response)
+	require.NoError(t, err)
+	m = response.withMetaResponse(adaptTransactionMetaToExpectedOutput(MapToCamelCase(m)))
+	require.Equal(t, uint64(5000), m["meta"].(map[string]any)["fee"])
+
+	// the other metas are converted the generic way.
+	legacy := &GetTransactionResponse{Meta: map[string]any{"fee": 5000}}
+	legacy.mapMetaDirectly()
+	require.NotNil(t, legacy.Meta)
+}
@@ -2,7 +2,6 @@ package txstatus
 
 import (
 	"encoding/json"
-	"fmt"
 
 	"github.com/gagliardetto/solana-go"
 )
@@ -16,6 +15,8 @@ type Message struct {
 	AccountKeys     []AccountKey      `json:"accountKeys"`
 	Instructions    []json.RawMessage `json:"instructions"`
 	RecentBlockhash string            `json:"recentBlockhash"`
+	// AddressTableLookups are the lookups of the versioned transactions (absent for the legacy ones).
+	AddressTableLookups []AddressTableLookup `json:"addressTableLookups,omitempty"`
 }
 
 type AccountKey struct {
@@ -25,26 +26,76 @@ type AccountKey struct {
 	Writable bool   `json:"writable"`
 }
 
+// The sources of the account keys.
+const (
+	SourceTransaction = "transaction"
+	SourceLookupTable = "lookupTable"
+)
+
+type AddressTableLookup struct {
+	AccountKey      string `json:"accountKey"`
+	WritableIndexes []int  `json:"writableIndexes"`
+	ReadonlyIndexes []int  `json:"readonlyIndexes"`
+}
+
 func FromTransaction(solTx solana.Transaction) (Transaction, error) {
+	return FromTransactionWithLoadedAddresses(solTx, nil)
+}
+
+// FromTransactionWithLoadedAddresses converts the transaction; the account keys are the static keys,
+// followed by the addresses loaded from the lookup tables (the writable ones, then the readonly ones),
+// as the instructions of a versioned transaction index them.
+func FromTransactionWithLoadedAddresses(solTx solana.Transaction, loaded *LoadedAddresses) (Transaction, error) {
+	numKeys := len(solTx.Message.AccountKeys)
+	if loaded != nil {
+		numKeys += len(loaded.Writable) + len(loaded.Readonly)
+	}
 	tx := Transaction{
 		Message: Message{
-			AccountKeys:  make([]AccountKey, len(solTx.Message.AccountKeys)),
+			AccountKeys:  make([]AccountKey, 0, numKeys),
 			Instructions: make([]json.RawMessage, len(solTx.Message.Instructions)),
 		},
 		Signatures: solTx.Signatures,
 	}
+	header := solTx.Message.Header
+	numSigners := int(header.NumRequiredSignatures)
 	for i, accKey := range solTx.Message.AccountKeys {
-		isWr, err := solTx.IsWritable(accKey)
-		if err != nil {
-			return tx, fmt.Errorf("failed to check if account key #%d is writable: %w", i, err)
+		// from the header, which (unlike solana.Message.IsWritable) doesn't need the lookup tables.
+		var isWr bool
+		if i < numSigners {
+			isWr = i < numSigners-int(header.NumReadonlySignedAccounts)
+		} else {
+			isWr = i < len(solTx.Message.AccountKeys)-int(header.NumReadonlyUnsignedAccounts)
 		}
-		tx.Message.AccountKeys[i] = AccountKey{
+		tx.Message.AccountKeys = append(tx.Message.AccountKeys, AccountKey{
 			Pubkey:   accKey.String(),
-			Signer:   solTx.IsSigner(accKey),
-			Source:   "transaction", // TODO: what is this?
+			Signer:   i < numSigners,
+			Source:   SourceTransaction,
 			Writable: isWr,
+		})
+	}
+	if loaded != nil {
+		for _, accKey := range loaded.Writable {
+			tx.Message.AccountKeys = append(tx.Message.AccountKeys, AccountKey{
+				Pubkey:   accKey.String(),
+				Source:   SourceLookupTable,
+				Writable: true,
+			})
+		}
+		for _, accKey := range loaded.Readonly {
+			tx.Message.AccountKeys = append(tx.Message.AccountKeys, AccountKey{
+				Pubkey: accKey.String(),
+				Source: SourceLookupTable,
+			})
 		}
 	}
+	for _, lookup := range solTx.Message.AddressTableLookups {
+		tx.Message.AddressTableLookups = append(tx.Message.AddressTableLookups, AddressTableLookup{
+			AccountKey:      lookup.AccountKey.String(),
+			WritableIndexes: indexesToInts(lookup.WritableIndexes),
+			ReadonlyIndexes: indexesToInts(lookup.ReadonlyIndexes),
+		})
+	}
 	for i, inst := range solTx.Message.Instructions {
 		tx.Message.Instructions[i] = json.RawMessage(inst.Data)
 	}
@@ -52,6 +103,15 @@ func FromTransaction(solTx solana.Transaction) (Transaction, error) {
 	return tx, nil
 }
 
+// indexesToInts converts the indexes of a lookup, so that they are encoded as a JSON array of numbers.
+func indexesToInts(indexes []uint8) []int {
+	out := make([]int, len(indexes))
+	for i, index := range indexes {
+		out[i] = int(index)
+	}
+	return out
+}
+
 // {
 //       "message": {
 //         "accountKeys": [
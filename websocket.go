@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// A minimal WebSocket server (RFC 6455), for the faithful subscriptions: text and binary
+// messages (possibly fragmented), ping/pong and close; no extensions.
+
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsMaxMessageSize = 64 * 1024
+	wsWriteTimeout   = 10 * time.Second
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var errWebSocketClosed = errors.New("websocket closed")
+
+// isWebSocketUpgrade returns true if the request is a WebSocket handshake.
+func isWebSocketUpgrade(reqCtx *fasthttp.RequestCtx) bool {
+	return reqCtx.IsGet() &&
+		bytes.EqualFold(reqCtx.Request.Header.Peek("Upgrade"), []byte("websocket")) &&
+		len(reqCtx.Request.Header.Peek("Sec-WebSocket-Key")) > 0
+}
+
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the handshake, and serves the connection with fn, after the handler returns.
+func upgradeWebSocket(reqCtx *fasthttp.RequestCtx, fn func(conn *wsConn)) {
+	if string(reqCtx.Request.Header.Peek("Sec-WebSocket-Version")) != "13" {
+		reqCtx.Response.Header.Set("Sec-WebSocket-Version", "13")
+		reqCtx.Error("unsupported websocket version", fasthttp.StatusUpgradeRequired)
+		return
+	}
+	key := string(reqCtx.Request.Header.Peek("Sec-WebSocket-Key"))
+	reqCtx.SetStatusCode(fasthttp.StatusSwitchingProtocols)
+	reqCtx.Response.Header.Set("Upgrade", "websocket")
+	reqCtx.Response.Header.Set("Connection", "Upgrade")
+	reqCtx.Response.Header.Set("Sec-WebSocket-Accept", webSocketAccept(key))
+	reqCtx.Hijack(func(c net.Conn) {
+		// the subscriptions are long-lived: no read timeout of the server.
+		c.SetDeadline(time.Time{})
+		conn := newWSConn(c)
+		defer conn.Close()
+		fn(conn)
+	})
+}
+
+// wsConn is the server side of a WebSocket connection; WriteMessage can be called concurrently
+// with ReadMessage (and with itself).
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func newWSConn(conn net.Conn) *wsConn {
+	return &wsConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// ReadMessage returns the next text or binary message, answering the pings; it returns
+// errWebSocketClosed when the client closes the connection.
+func (c *wsConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			// echo the status code, as the closing handshake requires.
+			if len(payload) >= 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(wsOpClose, payload)
+			return 0, nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, errors.New("websocket: new message before the end of the previous one")
+			}
+			opcode = op
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, errors.New("websocket: continuation frame without a message")
+			}
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+		if len(message)+len(payload) > wsMaxMessageSize {
+			return 0, nil, fmt.Errorf("websocket: message larger than %d bytes", wsMaxMessageSize)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket: unexpected reserved bits")
+	}
+	masked := header[1]&0x80 != 0
+	if !masked {
+		return false, 0, nil, errors.New("websocket: client frames must be masked")
+	}
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", wsMaxMessageSize)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends a text message.
+func (c *wsConn) WriteMessage(message []byte) error {
+	return c.writeFrame(wsOpText, message)
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return errWebSocketClosed
+	}
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(frame)
+	if opcode == wsOpClose {
+		c.closed = true
+	}
+	return err
+}
+
+// Close closes the connection.
+func (c *wsConn) Close() error {
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+	return c.conn.Close()
+}
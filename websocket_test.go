@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wsTestClient is the client side of a connection, for the tests.
+type wsTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *wsTestClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte) {
+	header := []byte{opcode, 0x80}
+	if fin {
+		header[0] |= 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		header[1] |= byte(len(payload))
+	default:
+		header[1] |= 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame := append(header, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *wsTestClient) readFrame(t *testing.T) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(c.reader, header[:])
+	require.NoError(t, err)
+	require.Zero(t, header[1]&0x80, "server frames are not masked")
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err := io.ReadFull(c.reader, ext[:])
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err := io.ReadFull(c.reader, ext[:])
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0f, payload
+}
+
+func (c *wsTestClient) call(t *testing.T, request string) map[string]any {
+	c.writeFrame(t, true, wsOpText, []byte(request))
+	return c.readMessage(t)
+}
+
+func (c *wsTestClient) readMessage(t *testing.T) map[string]any {
+	opcode, payload := c.readFrame(t)
+	require.Equal(t, byte(wsOpText), opcode)
+	var message map[string]any
+	require.NoError(t, json.Unmarshal(payload, &message))
+	return message
+}
+
+func newWSTestPair() (*wsConn, *wsTestClient) {
+	server, client := net.Pipe()
+	return newWSConn(server), &wsTestClient{conn: client, reader: bufio.NewReader(client)}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// the example of RFC 6455.
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	server, client := newWSTestPair()
+	defer server.Close()
+
+	go func() {
+		// a fragmented message, with a ping in between.
+		client.writeFrame(t, false, wsOpText, []byte("hello "))
+		client.writeFrame(t, true, wsOpPing, []byte("ping"))
+		client.writeFrame(t, true, wsOpContinuation, make([]byte, 300))
+	}()
+	go func() {
+		opcode, payload := client.readFrame(t)
+		if opcode != wsOpPong || string(payload) != "ping" {
+			t.Errorf("expected the pong, got %d %q", opcode, payload)
+		}
+	}()
+	opcode, message, err := server.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, byte(wsOpText), opcode)
+	require.Len(t, message, 306)
+	require.Equal(t, "hello ", string(message[:6]))
+
+	go func() {
+		require.NoError(t, server.WriteMessage(make([]byte, 1000)))
+	}()
+	opcode, payload := client.readFrame(t)
+	require.Equal(t, byte(wsOpText), opcode)
+	require.Len(t, payload, 1000)
+
+	go client.writeFrame(t, true, wsOpClose, []byte{0x03, 0xe8})
+	go func() {
+		opcode, payload := client.readFrame(t)
+		if opcode != wsOpClose || len(payload) != 2 {
+			t.Errorf("expected the close, got %d %q", opcode, payload)
+		}
+	}()
+	_, _, err = server.ReadMessage()
+	require.ErrorIs(t, err, errWebSocketClosed)
+	require.ErrorIs(t, server.WriteMessage([]byte("late")), errWebSocketClosed)
+}
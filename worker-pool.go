@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// dagFetchPool is the server-wide pool used for DAG fetches (entries, transactions, etc.);
+// sharing it between requests keeps the number of concurrent reads bounded
+// no matter how many requests are being served.
+var dagFetchPool = newWorkerPool(runtime.NumCPU() * 2)
+
+// setDagFetchConcurrency replaces the DAG fetch pool; must be called before serving requests.
+func setDagFetchConcurrency(size int) {
+	dagFetchPool = newWorkerPool(size)
+}
+
+// workerPool bounds the number of tasks that run at the same time across all its groups.
+// When all the workers are busy, the waiting tasks get the freed workers according to
+// the weights of their priority classes (weighted round-robin), so that high priority
+// requests are not starved by bulk ones (and vice versa).
+type workerPool struct {
+	size int
+
+	mu      sync.Mutex
+	inUse   int
+	waiting int
+	queues  [numPriorities][]chan struct{}
+	weights [numPriorities]int
+	current [numPriorities]int
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size <= 0 {
+		size = runtime.NumCPU()
+	}
+	return &workerPool{
+		size:    size,
+		weights: defaultPriorityWeights,
+	}
+}
+
+// SetWeights sets the weights of the priority classes (a weight <= 0 is taken as 1).
+func (p *workerPool) SetWeights(weights [numPriorities]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, w := range weights {
+		if w <= 0 {
+			w = 1
+		}
+		p.weights[i] = w
+	}
+}
+
+// Size returns the max number of tasks that can run at the same time.
+func (p *workerPool) Size() int {
+	return p.size
+}
+
+// InUse returns the number of tasks that are currently running.
+func (p *workerPool) InUse() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.inUse
+}
+
+// Waiting returns the number of tasks that are waiting for a free worker.
+func (p *workerPool) Waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.waiting
+}
+
+// acquire blocks until a worker is available for a task of the given priority.
+func (p *workerPool) acquire(ctx context.Context, priority requestPriority) error {
+	p.mu.Lock()
+	if p.inUse < p.size && p.waiting == 0 {
+		p.inUse++
+		p.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	p.queues[priority] = append(p.queues[priority], ready)
+	p.waiting++
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		queue := p.queues[priority]
+		for i, ch := range queue {
+			if ch == ready {
+				p.queues[priority] = append(queue[:i], queue[i+1:]...)
+				p.waiting--
+				return ctx.Err()
+			}
+		}
+		// the worker was handed over while the context was being canceled.
+		p.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+// release frees the worker of a task, handing it over to a waiting task (if any).
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.releaseLocked()
+}
+
+func (p *workerPool) releaseLocked() {
+	if p.waiting == 0 {
+		p.inUse--
+		return
+	}
+	// smooth weighted round-robin among the classes that have waiting tasks.
+	best := -1
+	total := 0
+	for i := range p.queues {
+		if len(p.queues[i]) == 0 {
+			continue
+		}
+		p.current[i] += p.weights[i]
+		total += p.weights[i]
+		if best < 0 || p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= total
+	next := p.queues[best][0]
+	p.queues[best] = p.queues[best][1:]
+	p.waiting--
+	close(next)
+}
+
+// Group returns a new group of tasks that run on the pool; like an errgroup,
+// the returned context is canceled when a task fails or when Wait returns.
+// The tasks are scheduled with the priority of the request (see setRequestPriorityToContext).
+// Tasks must not submit more tasks to the same pool (that could deadlock).
+func (p *workerPool) Group(ctx context.Context) (*poolGroup, context.Context) {
+	priority := getRequestPriorityFromContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	return &poolGroup{
+		pool:     p,
+		priority: priority,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, ctx
+}
+
+type poolGroup struct {
+	pool     *workerPool
+	priority requestPriority
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	errOnce  sync.Once
+	err      error
+}
+
+func (g *poolGroup) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Go runs the task on the pool, blocking until a worker is free
+// (or until the group's context is canceled, in which case the task is not run).
+func (g *poolGroup) Go(fn func() error) {
+	if err := g.pool.acquire(g.ctx, g.priority); err != nil {
+		g.fail(err)
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			g.pool.release()
+			g.wg.Done()
+		}()
+		// a panic in a task must not bring down the whole server.
+		if err := runRecovered("dag_worker", fn); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait waits for all the tasks to complete, and returns the first error (if any).
+func (g *poolGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
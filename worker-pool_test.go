@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := newWorkerPool(2)
+	require.Equal(t, 2, pool.Size())
+
+	var running, maxRunning atomic.Int32
+	wg, _ := pool.Group(context.Background())
+	for i := 0; i < 10; i++ {
+		wg.Go(func() error {
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+			return nil
+		})
+	}
+	require.NoError(t, wg.Wait())
+	require.LessOrEqual(t, maxRunning.Load(), int32(2))
+	require.Equal(t, 0, pool.InUse())
+}
+
+func TestWorkerPoolError(t *testing.T) {
+	pool := newWorkerPool(1)
+	expected := errors.New("boom")
+	wg, ctx := pool.Group(context.Background())
+	wg.Go(func() error {
+		return expected
+	})
+	wg.Go(func() error {
+		return nil
+	})
+	require.ErrorIs(t, wg.Wait(), expected)
+	require.Error(t, ctx.Err())
+	require.Equal(t, 0, pool.InUse())
+}
+
+func TestWorkerPoolPriorities(t *testing.T) {
+	pool := newWorkerPool(1)
+	pool.SetWeights([numPriorities]int{priorityLow: 1, priorityNormal: 1, priorityHigh: 4})
+
+	// keep the only worker busy while the others queue up.
+	require.NoError(t, pool.acquire(context.Background(), priorityNormal))
+
+	var mu sync.Mutex
+	var order []requestPriority
+	var wg sync.WaitGroup
+	enqueue := func(priority requestPriority, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, pool.acquire(context.Background(), priority))
+				mu.Lock()
+				order = append(order, priority)
+				mu.Unlock()
+				pool.release()
+			}()
+		}
+	}
+	enqueue(priorityLow, 5)
+	require.Eventually(t, func() bool { return pool.Waiting() == 5 }, time.Second, time.Millisecond)
+	enqueue(priorityHigh, 4)
+	require.Eventually(t, func() bool { return pool.Waiting() == 9 }, time.Second, time.Millisecond)
+
+	pool.release()
+	wg.Wait()
+
+	require.Len(t, order, 9)
+	// the high priority tasks, queued last, get 4 of the first 5 workers.
+	high := 0
+	for _, priority := range order[:5] {
+		if priority == priorityHigh {
+			high++
+		}
+	}
+	require.Equal(t, 4, high)
+	require.Equal(t, 0, pool.InUse())
+	require.Equal(t, 0, pool.Waiting())
+}
+
+func TestWorkerPoolCancelWhileWaiting(t *testing.T) {
+	pool := newWorkerPool(1)
+	require.NoError(t, pool.acquire(context.Background(), priorityNormal))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pool.acquire(ctx, priorityLow)
+	}()
+	require.Eventually(t, func() bool { return pool.Waiting() == 1 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.Equal(t, 0, pool.Waiting())
+
+	pool.release()
+	require.Equal(t, 0, pool.InUse())
+}
+
+func TestWorkerPoolGroupPriority(t *testing.T) {
+	pool := newWorkerPool(1)
+	wg, _ := pool.Group(setRequestPriorityToContext(context.Background(), priorityHigh))
+	require.Equal(t, priorityHigh, wg.priority)
+	wg, _ = pool.Group(context.Background())
+	require.Equal(t, priorityNormal, wg.priority)
+}
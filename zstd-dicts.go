@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// loadZstdDictionaries reads the zstd dictionaries (e.g. trained with `zstd --train`) used to compress
+// the data of some CARs (see `car recompress-meta`), and makes the decoder use them; the frames
+// compressed with a dictionary have its ID, so the CARs without dictionary are still decoded.
+// It must be called before the decoder is used.
+func loadZstdDictionaries(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	dicts := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		dict, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read zstd dictionary %q: %w", path, err)
+		}
+		dicts = append(dicts, dict)
+	}
+	withDicts, err := zstd.NewReader(nil, zstd.WithDecoderDicts(dicts...))
+	if err != nil {
+		return fmt.Errorf("failed to load zstd dictionaries: %w", err)
+	}
+	decoder = withDicts
+	return nil
+}